@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recorder records the latencies of the operations of a kind, and the number of the ones that
+// failed or were missed.
+type recorder struct {
+	mutex     sync.Mutex
+	latencies []time.Duration
+	nErrors   uint
+	nMissed   uint
+}
+
+func (r *recorder) record(latency time.Duration, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err != nil {
+		r.nErrors++
+		return
+	}
+	r.latencies = append(r.latencies, latency)
+}
+
+func (r *recorder) miss() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.nMissed++
+}
+
+// summary is the summary of the latencies of the operations of a kind that succeeded.
+type summary struct {
+	N, NErrors, NMissed uint
+	// Throughput is the number of the operations that succeeded per second.
+	Throughput float64
+
+	P50, P90, P99, P999, Max time.Duration
+}
+
+func (r *recorder) summarise(elapsed time.Duration) summary {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	sorted := append([]time.Duration(nil), r.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s := summary{
+		N:       uint(len(sorted)),
+		NErrors: r.nErrors,
+		NMissed: r.nMissed,
+		P50:     percentile(sorted, 50),
+		P90:     percentile(sorted, 90),
+		P99:     percentile(sorted, 99),
+		P999:    percentile(sorted, 99.9),
+		Max:     percentile(sorted, 100),
+	}
+	if elapsed > 0 {
+		s.Throughput = float64(len(sorted)) / elapsed.Seconds()
+	}
+	return s
+}
+
+// percentile returns the p-th percentile of the sorted latencies by the nearest rank, or zero if
+// there is none.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// drive calls op at the rate (per second) for the duration, on the workers concurrently, and
+// records their latencies.
+//
+// The load is open: the operations are scheduled at the rate regardless of how long the previous
+// ones take, and their latencies are measured from when they are scheduled (rather than from when
+// a worker picks them up), lest a slow database be measured only as fast as it lets itself be
+// loaded. The operations that cannot be queued as all the workers are busy (with as many queued
+// already) are missed.
+func drive(rate float64, duration time.Duration, workers uint, op func(worker uint) error, r *recorder) {
+	if rate <= 0 {
+		return
+	}
+
+	scheduled := make(chan time.Time, workers)
+	var wg sync.WaitGroup
+	for worker := uint(0); worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker uint) {
+			defer wg.Done()
+			for on := range scheduled {
+				err := op(worker)
+				r.record(time.Since(on), err)
+			}
+		}(worker)
+	}
+
+	interval := time.Duration(float64(time.Second) / rate)
+	startedOn := time.Now()
+	for on := startedOn; on.Sub(startedOn) < duration; on = on.Add(interval) {
+		time.Sleep(time.Until(on))
+		select {
+		case scheduled <- on:
+		default:
+			r.miss()
+		}
+	}
+	close(scheduled)
+	wg.Wait()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var percentileTest_instances = []struct {
+	latencies []time.Duration
+	p         float64
+	expected  time.Duration
+}{
+	{[]time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 50, 5},
+	{[]time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 90, 9},
+	{[]time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 99, 10},
+	{[]time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 100, 10},
+	{[]time.Duration{7}, 50, 7},
+	{[]time.Duration{}, 50, 0},
+}
+
+func TestPercentile(t *testing.T) {
+	for i, instance := range percentileTest_instances {
+		if got := percentile(instance.latencies, instance.p); got != instance.expected {
+			t.Errorf("Percentile of the instance #%d is wrong! Got %d (expected %d)", i+1, got, instance.expected)
+		}
+	}
+}
+
+func TestDrive(t *testing.T) {
+	var r recorder
+	drive(100, 200*time.Millisecond, 2, func(worker uint) error { return nil }, &r)
+
+	// 20 operations are scheduled, give or take the ones that are scheduled as the duration ends.
+	if s := r.summarise(200 * time.Millisecond); s.N+s.NMissed < 19 || s.N+s.NMissed > 21 || s.NErrors != 0 {
+		t.Errorf("Summary is wrong! Got %+v (expected 20 operations)", s)
+	}
+}
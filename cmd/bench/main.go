@@ -0,0 +1,186 @@
+// bench benchmarks the engines of the database by loading them with the torrents (see package synth)
+// and the searches at the given rates, and reports the percentiles of their latencies, so that the
+// performance regressions can be measured before the releases. It can also fill the development
+// databases with the torrents instead (see --generate).
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+	"github.com/boramalper/magnetico/pkg/synth"
+)
+
+type opFlags struct {
+	DatabaseURL string
+	Duration    time.Duration
+	AddRate     float64
+	QueryRate   float64
+	Workers     uint
+	Prefill     uint
+	PageSize    uint
+	Seed        int64
+
+	// Generate is the number of the torrents to fill the database with (discovered over the last
+	// GenerateYears) instead of benchmarking; it is zero if benchmarking.
+	Generate      uint
+	GenerateYears uint
+}
+
+func main() {
+	loggerLevel := zap.NewAtomicLevelAt(zap.WarnLevel)
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()),
+		zapcore.Lock(os.Stderr),
+		loggerLevel,
+	))
+	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
+
+	opFlags, err := parseFlags()
+	if err != nil {
+		// Do not print any error messages as jessevdk/go-flags already did.
+		os.Exit(1)
+	}
+
+	database, err := persistence.MakeDatabase(opFlags.DatabaseURL, logger)
+	if err != nil {
+		logger.Fatal("Could not open the database", zap.String("url", opFlags.DatabaseURL), zap.Error(err))
+	}
+	defer database.Close()
+
+	if opFlags.Generate > 0 {
+		generate(database, opFlags.Generate, opFlags.GenerateYears, opFlags.Seed)
+		return
+	}
+
+	// Each worker synthesizes the torrents and the queries of its own (reproducibly, from the seed),
+	// as the synthesizers are not safe for concurrent use; the workers of the adds are seeded apart
+	// from the ones of the searches, and from the prefill.
+	if opFlags.Prefill > 0 {
+		now := time.Now()
+		if err = synth.Generate(database, opFlags.Prefill, now, now, opFlags.Seed, nil); err != nil {
+			logger.Fatal("Could not prefill the database", zap.Error(err))
+		}
+	}
+
+	adders := make([]*synth.Synthesizer, opFlags.Workers)
+	searchers := make([]*synth.Synthesizer, opFlags.Workers)
+	for i := range adders {
+		adders[i] = synth.NewSynthesizer(opFlags.Seed + 1 + int64(i))
+		searchers[i] = synth.NewSynthesizer(-opFlags.Seed - 1 - int64(i))
+	}
+
+	var adds, queries recorder
+	done := make(chan struct{})
+	startedOn := time.Now()
+	go func() {
+		drive(opFlags.AddRate, opFlags.Duration, opFlags.Workers, func(worker uint) error {
+			torrent := adders[worker].Torrent()
+			return database.AddNewTorrent(torrent.InfoHash, torrent.Name, torrent.Files, torrent.Metadata,
+				persistence.SourceSynthetic)
+		}, &adds)
+		done <- struct{}{}
+	}()
+	go func() {
+		drive(opFlags.QueryRate, opFlags.Duration, opFlags.Workers, func(worker uint) error {
+			query, orderBy := searchers[worker].Query(), persistence.ByRelevance
+			if query == "" {
+				orderBy = persistence.ByDiscoveredOn
+			}
+			_, err := database.QueryTorrents(query, time.Now().Unix(), orderBy, false, opFlags.PageSize, nil, nil,
+				persistence.QueryFilters{}, persistence.AllFields)
+			return err
+		}, &queries)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+	elapsed := time.Since(startedOn)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "operation\tn\terrors\tmissed\tops/s\tp50\tp90\tp99\tp99.9\tmax\t")
+	for _, operation := range []struct {
+		name     string
+		rate     float64
+		recorder *recorder
+	}{
+		{"AddNewTorrent", opFlags.AddRate, &adds},
+		{"QueryTorrents", opFlags.QueryRate, &queries},
+	} {
+		if operation.rate <= 0 {
+			continue
+		}
+		s := operation.recorder.summarise(elapsed)
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t%s\t\n", operation.name, s.N, s.NErrors, s.NMissed,
+			s.Throughput, round(s.P50), round(s.P90), round(s.P99), round(s.P999), round(s.Max))
+	}
+	w.Flush()
+}
+
+func parseFlags() (*opFlags, error) {
+	var cmdF struct {
+		DatabaseURL string        `long:"database"   description:"URL of the database to benchmark." required:"yes"`
+		Duration    time.Duration `long:"duration"   description:"How long the database is loaded for." default:"1m"`
+		AddRate     float64       `long:"add-rate"   description:"Number of the torrents added per second (0 disables)." default:"100"`
+		QueryRate   float64       `long:"query-rate" description:"Number of the searches per second (0 disables)." default:"10"`
+		Workers     uint          `long:"workers"    description:"Number of the concurrent adds, and of the concurrent searches." default:"8"`
+		Prefill     uint          `long:"prefill"    description:"Number of the torrents added before the benchmark (unmeasured), lest the database be empty." default:"0"`
+		PageSize    uint          `long:"page-size"  description:"Number of the torrents in a page of the search results." default:"20"`
+		Seed        int64         `long:"seed"       description:"Seed of the synthesized torrents and searches, which are the same for the same seed." default:"1"`
+
+		Generate      uint `long:"generate"       description:"Fill the database with as many synthesized torrents instead of benchmarking (e.g. for development)."`
+		GenerateYears uint `long:"generate-years" description:"Number of the years over which the generated torrents are discovered (until now)." default:"5"`
+	}
+
+	if _, err := flags.Parse(&cmdF); err != nil {
+		return nil, err
+	}
+
+	if cmdF.Workers == 0 {
+		zap.S().Fatalf("Of argument `workers`: must be greater than 0")
+	}
+	if cmdF.AddRate < 0 || cmdF.QueryRate < 0 {
+		zap.S().Fatalf("Of arguments `add-rate` and `query-rate`: must not be negative")
+	}
+
+	return &opFlags{
+		DatabaseURL: cmdF.DatabaseURL,
+		Duration:    cmdF.Duration,
+		AddRate:     cmdF.AddRate,
+		QueryRate:   cmdF.QueryRate,
+		Workers:     cmdF.Workers,
+		Prefill:     cmdF.Prefill,
+		PageSize:    cmdF.PageSize,
+		Seed:        cmdF.Seed,
+
+		Generate:      cmdF.Generate,
+		GenerateYears: cmdF.GenerateYears,
+	}, nil
+}
+
+// generate fills the database with n torrents synthesized from the seed, discovered over the last
+// years, reporting the progress.
+func generate(database persistence.Database, n uint, years uint, seed int64) {
+	until := time.Now()
+	since := until.AddDate(-int(years), 0, 0)
+	err := synth.Generate(database, n, since, until, seed, func(added uint) {
+		fmt.Fprintf(os.Stderr, "\rGenerated %d of %d torrents...", added, n)
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		zap.L().Fatal("Could not generate the torrents", zap.Error(err))
+	}
+}
+
+// round rounds the latency to the microseconds for readability.
+func round(latency time.Duration) time.Duration {
+	return latency.Round(time.Microsecond)
+}
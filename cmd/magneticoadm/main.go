@@ -0,0 +1,105 @@
+// magneticoadm carries out the maintenance of the databases of magnetico, such as advising the
+// indices that are missing for the searches of the operators (see `magneticoadm indexes --help`).
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+type options struct {
+	DatabaseURL string `long:"database" description:"URL of the database to maintain." required:"yes"`
+
+	Indexes  indexesCommand  `command:"indexes" description:"Recommend (or create) the indices that are missing for the statements run on the database."`
+	Synonyms synonymsCommand `command:"synonyms" description:"Re-index the synonyms of the names of the torrents after the synonym list (see synonyms) is changed."`
+}
+
+var opts options
+
+func main() {
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()),
+		zapcore.Lock(os.Stderr),
+		zap.NewAtomicLevelAt(zap.WarnLevel),
+	))
+	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
+
+	if _, err := flags.Parse(&opts); err != nil {
+		// Do not print any error messages as jessevdk/go-flags already did (unless the command
+		// failed).
+		if _, ok := err.(*flags.Error); !ok {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+		os.Exit(1)
+	}
+}
+
+func openDatabase() (persistence.Database, error) {
+	return persistence.MakeDatabase(opts.DatabaseURL, zap.L())
+}
+
+type indexesCommand struct {
+	SlowQueryLogs []string `long:"slow-query-log" description:"Log file of magneticod or magneticow whose slow queries (see slow_query_threshold) the indices are advised for too. It can be supplied multiple times."`
+	Create        bool     `long:"create" description:"Create the recommended indices too (which might take long, and block the writes to the tables meanwhile)."`
+}
+
+func (c *indexesCommand) Execute(args []string) error {
+	queries, err := readSlowQueries(c.SlowQueryLogs)
+	if err != nil {
+		return err
+	}
+
+	database, err := openDatabase()
+	if err != nil {
+		return fmt.Errorf("could not open the database: %s", err.Error())
+	}
+	defer database.Close()
+
+	advices, err := database.AdviseIndexes(queries, c.Create)
+	if err != nil {
+		return fmt.Errorf("could not advise the indices: %s", err.Error())
+	}
+
+	// The advices are printed as an SQL script, so that they can be reviewed and run as they are.
+	if len(advices) == 0 {
+		fmt.Println("-- No indices are missing for the statements.")
+	}
+	for _, advice := range advices {
+		fmt.Printf("-- %d calls, %s in total, such as:\n", advice.Calls, advice.TotalTime.Round(time.Millisecond))
+		for _, query := range advice.Queries {
+			fmt.Printf("--   %s\n", strings.ReplaceAll(query, "\n", " "))
+		}
+		fmt.Println(advice.DDL)
+		fmt.Println()
+	}
+	if c.Create && len(advices) > 0 {
+		fmt.Printf("-- Created %d indices.\n", len(advices))
+	}
+	return nil
+}
+
+type synonymsCommand struct{}
+
+func (c *synonymsCommand) Execute(args []string) error {
+	database, err := openDatabase()
+	if err != nil {
+		return fmt.Errorf("could not open the database: %s", err.Error())
+	}
+	defer database.Close()
+
+	n, err := database.RefreshSynonyms()
+	if err != nil {
+		return fmt.Errorf("could not refresh the synonyms: %s", err.Error())
+	}
+	fmt.Printf("Re-indexed the synonyms of %d torrents.\n", n)
+	return nil
+}
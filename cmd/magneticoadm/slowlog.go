@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// slowQueryMessage is the message of the entries of the slow queries in the logs.
+const slowQueryMessage = "Slow query"
+
+// readSlowQueries reads the slow queries of the logs, which are either in JSON (e.g. of
+// `magneticod --log-format=json`) or in the console format, summed by their statements.
+func readSlowQueries(paths []string) ([]persistence.QueryStat, error) {
+	stats := make(map[string]*persistence.QueryStat)
+	for _, path := range paths {
+		if err := readSlowQueryLog(path, stats); err != nil {
+			return nil, errors.Wrap(err, path)
+		}
+	}
+
+	queries := make([]persistence.QueryStat, 0, len(stats))
+	for _, stat := range stats {
+		queries = append(queries, *stat)
+	}
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Query < queries[j].Query })
+	return queries, nil
+}
+
+func readSlowQueryLog(path string, stats map[string]*persistence.QueryStat) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		query, elapsed, ok := parseSlowQuery(scanner.Bytes())
+		if !ok {
+			continue
+		}
+		stat, ok := stats[query]
+		if !ok {
+			stat = &persistence.QueryStat{Query: query}
+			stats[query] = stat
+		}
+		stat.Calls++
+		stat.TotalTime += elapsed
+	}
+	return scanner.Err()
+}
+
+// parseSlowQuery parses the statement and the duration of an entry of a slow query, whose fields
+// are a JSON object either way: the entry itself in JSON (whose durations are in seconds), or its
+// tail in the console format (whose durations are strings).
+func parseSlowQuery(line []byte) (string, time.Duration, bool) {
+	if !bytes.Contains(line, []byte(slowQueryMessage)) {
+		return "", 0, false
+	}
+	if !bytes.HasPrefix(line, []byte("{")) {
+		i := bytes.Index(line, []byte(slowQueryMessage+"\t{"))
+		if i == -1 {
+			return "", 0, false
+		}
+		line = line[i+len(slowQueryMessage)+1:]
+	}
+
+	var entry struct {
+		Msg     string          `json:"msg"`
+		Query   string          `json:"query"`
+		Elapsed json.RawMessage `json:"elapsed"`
+	}
+	if err := json.Unmarshal(line, &entry); err != nil || entry.Query == "" {
+		return "", 0, false
+	}
+	if entry.Msg != "" && entry.Msg != slowQueryMessage {
+		return "", 0, false
+	}
+
+	var elapsed time.Duration
+	var seconds float64
+	var duration string
+	if err := json.Unmarshal(entry.Elapsed, &seconds); err == nil {
+		elapsed = time.Duration(seconds * float64(time.Second))
+	} else if err = json.Unmarshal(entry.Elapsed, &duration); err == nil {
+		elapsed, _ = time.ParseDuration(duration)
+	}
+	return strings.Join(strings.Fields(entry.Query), " "), elapsed, true
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var parseSlowQueryTest_instances = []struct {
+	line    string
+	query   string // empty if the line is not of a slow query
+	elapsed time.Duration
+}{
+	{`{"level":"warn","time":"2021-03-14T15:09:26.535Z","logger":"persistence","msg":"Slow query","elapsed":1.5,"query":"SELECT 1 FROM torrents WHERE info_hash = $1;","args":["00"]}`,
+		"SELECT 1 FROM torrents WHERE info_hash = $1;", 1500 * time.Millisecond},
+	{"2021-03-14T15:09:26.535Z\tWARN\tpersistence\tSlow query\t{\"elapsed\": \"250ms\", \"query\": \"SELECT name\\n\\tFROM torrents;\", \"args\": []}",
+		"SELECT name FROM torrents;", 250 * time.Millisecond},
+	{`{"level":"info","msg":"Slow query is not a slow query","query":"SELECT 1;"}`, "", 0},
+	{"2021-03-14T15:09:26.535Z\tINFO\tcrawler\tFetched a torrent\t{\"name\": \"Slow query\"}", "", 0},
+	{"Slow query\t{not json", "", 0},
+}
+
+func TestParseSlowQuery(t *testing.T) {
+	for i, instance := range parseSlowQueryTest_instances {
+		query, elapsed, ok := parseSlowQuery([]byte(instance.line))
+		if ok != (instance.query != "") || query != instance.query || elapsed != instance.elapsed {
+			t.Errorf("Slow query of the instance #%d is wrong! Got %q, %s, %t (expected %q, %s)", i+1, query,
+				elapsed, ok, instance.query, instance.elapsed)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/boramalper/magnetico/pkg/client"
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+type browseCommand struct {
+	searchFlags
+}
+
+func (c *browseCommand) Execute(args []string) error {
+	q, err := c.query()
+	if err != nil {
+		return err
+	}
+
+	s, err := openSource()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	return runProgram(newModel(s, q), os.Stdin, os.Stdout)
+}
+
+// batchSize is the number of the results that are loaded at once, whenever the cursor approaches
+// the end of the ones that are loaded.
+const batchSize = 50
+
+// resultsMsg is a batch of the results of the search of the generation (so that the results of
+// the previous searches are discarded).
+type resultsMsg struct {
+	generation int
+	torrents   []persistence.TorrentMetadata
+	exhausted  bool
+	err        error
+}
+
+// treeMsg is the file tree of the torrent of the infohash.
+type treeMsg struct {
+	infoHash []byte
+	tree     *persistence.FileTreeNode
+	err      error
+}
+
+// stream streams the results of a search from the source, searching them as they are received
+// (which is as they are needed) so that the searches are paged through lazily.
+type stream struct {
+	results chan persistence.TorrentMetadata
+	stop    chan struct{}
+	// err is the error of the search, which is set before results is closed.
+	err error
+}
+
+func newStream(s source, q client.Query) *stream {
+	st := &stream{results: make(chan persistence.TorrentMetadata), stop: make(chan struct{})}
+	go func() {
+		err := s.search(q, 0, func(torrent persistence.TorrentMetadata) error {
+			select {
+			case st.results <- torrent:
+				return nil
+			case <-st.stop:
+				return errEnough
+			}
+		})
+		if err != errEnough {
+			st.err = err
+		}
+		close(st.results)
+	}()
+	return st
+}
+
+// next returns the command that receives the next batch of the results.
+func (st *stream) next(generation int) cmd {
+	return func() msg {
+		message := resultsMsg{generation: generation}
+		for len(message.torrents) < batchSize {
+			torrent, ok := <-st.results
+			if !ok {
+				message.exhausted, message.err = true, st.err
+				break
+			}
+			message.torrents = append(message.torrents, torrent)
+		}
+		return message
+	}
+}
+
+func (st *stream) close() {
+	close(st.stop)
+}
+
+// model is the state of the browser, which is either the list of the results of the search, or the
+// file tree of one of them (if tree is not nil).
+type model struct {
+	source        source
+	query         client.Query
+	width, height int
+
+	torrents       []persistence.TorrentMetadata
+	cursor, offset int
+	stream         *stream
+	generation     int
+	loading        bool
+	exhausted      bool
+
+	// editing is whether the query is being edited (as input).
+	editing bool
+	input   []rune
+
+	tree *treeView
+	// status is shown instead of the help until the next key is pressed.
+	status   string
+	quitting bool
+	// output are the escape sequences to be written to the terminal after the next render (such as
+	// to copy to the clipboard).
+	output []string
+}
+
+// treeView is the file tree of a torrent, whose directories are expanded on demand.
+type treeView struct {
+	torrent        persistence.TorrentMetadata
+	root           *persistence.FileTreeNode
+	expanded       map[*persistence.FileTreeNode]bool
+	cursor, offset int
+}
+
+// treeRow is a visible node of the file tree.
+type treeRow struct {
+	node  *persistence.FileTreeNode
+	depth int
+}
+
+func newModel(s source, q client.Query) *model {
+	return &model{source: s, query: q}
+}
+
+func (m *model) init() cmd {
+	return m.search()
+}
+
+// search starts the search of the query anew.
+func (m *model) search() cmd {
+	if m.stream != nil {
+		m.stream.close()
+	}
+	m.generation++
+	m.torrents, m.cursor, m.offset = nil, 0, 0
+	m.exhausted, m.loading = false, true
+	m.stream = newStream(m.source, m.query)
+	return m.stream.next(m.generation)
+}
+
+// pageHeight is the number of the rows of the results (or of the file tree) on the screen, less the
+// header and the footer.
+func (m *model) pageHeight() int {
+	if m.height < 3 {
+		return 1
+	}
+	return m.height - 2
+}
+
+func (m *model) update(message msg) cmd {
+	switch message := message.(type) {
+	case resizeMsg:
+		m.width, m.height = message.width, message.height
+
+	case resultsMsg:
+		if message.generation != m.generation {
+			return nil
+		}
+		m.loading = false
+		m.torrents = append(m.torrents, message.torrents...)
+		m.exhausted = message.exhausted
+		if message.err != nil {
+			m.status = "Could not search: " + message.err.Error()
+		}
+		return m.loadMore()
+
+	case treeMsg:
+		if m.tree == nil || string(m.tree.torrent.InfoHash) != string(message.infoHash) {
+			return nil
+		}
+		if message.err != nil {
+			m.status = "Could not get the files: " + message.err.Error()
+		} else if message.tree == nil {
+			m.status = "The torrent is not found."
+		}
+		m.tree.root = message.tree
+
+	case keyMsg:
+		m.status = ""
+		if message == "ctrl+c" {
+			m.quit()
+			return nil
+		}
+		if m.editing {
+			return m.updateInput(message)
+		} else if m.tree != nil {
+			m.updateTree(message)
+			return nil
+		}
+		return m.updateList(message)
+	}
+	return nil
+}
+
+func (m *model) quit() {
+	if m.stream != nil {
+		m.stream.close()
+	}
+	m.quitting = true
+}
+
+// loadMore loads the next batch of the results if the cursor approaches the end of the loaded
+// ones.
+func (m *model) loadMore() cmd {
+	if m.loading || m.exhausted || m.cursor+m.pageHeight() < len(m.torrents) {
+		return nil
+	}
+	m.loading = true
+	return m.stream.next(m.generation)
+}
+
+func (m *model) updateInput(key keyMsg) cmd {
+	switch key {
+	case "enter":
+		m.editing = false
+		m.query.Query = strings.TrimSpace(string(m.input))
+		return m.search()
+	case "esc":
+		m.editing = false
+	case "backspace":
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	default:
+		if utf8.RuneCountInString(string(key)) == 1 {
+			m.input = append(m.input, []rune(string(key))...)
+		}
+	}
+	return nil
+}
+
+func (m *model) updateList(key keyMsg) cmd {
+	switch key {
+	case "q":
+		m.quit()
+		return nil
+	case "/":
+		m.editing, m.input = true, []rune(m.query.Query)
+		return nil
+	case "m":
+		if m.cursor < len(m.torrents) {
+			m.copyMagnet(m.torrents[m.cursor])
+		}
+		return nil
+	case "enter", "right":
+		if m.cursor < len(m.torrents) {
+			return m.openTree(m.torrents[m.cursor])
+		}
+		return nil
+	}
+
+	m.cursor, m.offset = move(key, m.cursor, m.offset, len(m.torrents), m.pageHeight())
+	return m.loadMore()
+}
+
+func (m *model) openTree(torrent persistence.TorrentMetadata) cmd {
+	m.tree = &treeView{torrent: torrent, expanded: make(map[*persistence.FileTreeNode]bool)}
+	s := m.source
+	return func() msg {
+		tree, err := s.fileTree(torrent.InfoHash)
+		return treeMsg{infoHash: torrent.InfoHash, tree: tree, err: err}
+	}
+}
+
+func (m *model) updateTree(key keyMsg) {
+	rows := m.tree.rows()
+	switch key {
+	case "q":
+		m.quit()
+		return
+	case "esc", "backspace":
+		m.tree = nil
+		return
+	case "m":
+		m.copyMagnet(m.tree.torrent)
+		return
+	case "enter", " ", "right", "left":
+		if m.tree.cursor >= len(rows) {
+			return
+		}
+		node := rows[m.tree.cursor].node
+		switch {
+		case key == "left" && !m.tree.expanded[node]:
+			m.tree = nil // back to the results
+		case node.IsDir() && key == "right":
+			m.tree.expanded[node] = true
+		case node.IsDir():
+			m.tree.expanded[node] = !m.tree.expanded[node]
+		}
+		return
+	}
+
+	m.tree.cursor, m.tree.offset = move(key, m.tree.cursor, m.tree.offset, len(rows), m.pageHeight())
+}
+
+// copyMagnet copies the magnet link of the torrent to the clipboard using OSC 52, which works over
+// SSH as well, if the terminal supports it (and shows the link otherwise).
+func (m *model) copyMagnet(torrent persistence.TorrentMetadata) {
+	link := magnetLink(hex.EncodeToString(torrent.InfoHash), torrent.Name)
+	m.output = append(m.output, "\x1b]52;c;"+base64.StdEncoding.EncodeToString([]byte(link))+"\a")
+	m.status = "Copied: " + link
+}
+
+// move moves the cursor (and scrolls the offset along) by the key through the n rows, page of which
+// are visible.
+func move(key keyMsg, cursor, offset, n, page int) (int, int) {
+	switch key {
+	case "up", "k":
+		cursor--
+	case "down", "j":
+		cursor++
+	case "pgup":
+		cursor -= page
+	case "pgdown", " ":
+		cursor += page
+	case "home", "g":
+		cursor = 0
+	case "end", "G":
+		cursor = n - 1
+	}
+
+	if cursor >= n {
+		cursor = n - 1
+	}
+	if cursor < 0 {
+		cursor = 0
+	}
+	if cursor < offset {
+		offset = cursor
+	} else if cursor >= offset+page {
+		offset = cursor - page + 1
+	}
+	return cursor, offset
+}
+
+// rows returns the visible nodes of the file tree, i.e. the ones whose parents are all expanded.
+func (t *treeView) rows() []treeRow {
+	var rows []treeRow
+	if t.root == nil {
+		return rows
+	}
+
+	var walk func(node *persistence.FileTreeNode, depth int)
+	walk = func(node *persistence.FileTreeNode, depth int) {
+		for _, child := range node.Children {
+			rows = append(rows, treeRow{node: child, depth: depth})
+			if t.expanded[child] {
+				walk(child, depth+1)
+			}
+		}
+	}
+	walk(t.root, 0)
+	return rows
+}
+
+func (m *model) view() []string {
+	page := m.pageHeight()
+	lines := make([]string, 0, page+2)
+
+	if m.tree != nil {
+		lines = append(lines, "\x1b[1m"+fit(m.tree.torrent.Name, m.width)+"\x1b[0m")
+		rows := m.tree.rows()
+		for i := m.tree.offset; i < len(rows) && i < m.tree.offset+page; i++ {
+			row := rows[i]
+			marker := "  "
+			if row.node.IsDir() && m.tree.expanded[row.node] {
+				marker = "▾ "
+			} else if row.node.IsDir() {
+				marker = "▸ "
+			}
+			lines = append(lines, m.row(strings.Repeat("  ", row.depth)+marker+row.node.Name,
+				humanize.IBytes(uint64(row.node.Size)), i == m.tree.cursor))
+		}
+		if m.tree.root == nil && m.status == "" {
+			lines = append(lines, "Loading the files...")
+		}
+	} else {
+		title := "All torrents"
+		if m.query.Query != "" {
+			title = "Search: " + m.query.Query
+		}
+		lines = append(lines, "\x1b[1m"+fit(title, m.width)+"\x1b[0m")
+		for i := m.offset; i < len(m.torrents) && i < m.offset+page; i++ {
+			torrent := m.torrents[i]
+			lines = append(lines, m.row(torrent.Name, fmt.Sprintf("%s  %s", humanize.IBytes(torrent.Size),
+				torrent.DiscoveredOn.Local().Format("2006-01-02")), i == m.cursor))
+		}
+		if len(m.torrents) == 0 && m.loading {
+			lines = append(lines, "Searching...")
+		} else if len(m.torrents) == 0 && m.status == "" {
+			lines = append(lines, "No torrents are found.")
+		}
+	}
+
+	for len(lines) < page+1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, m.footer())
+	return lines
+}
+
+// row returns the row of the name on the left and the details on the right, which is highlighted
+// if selected.
+func (m *model) row(name string, details string, selected bool) string {
+	details = " " + details
+	width := m.width - utf8.RuneCountInString(details)
+	if width < 1 {
+		return fit(name, m.width)
+	}
+	line := fit(name, width) + details
+	if selected {
+		return "\x1b[7m" + line + "\x1b[0m"
+	}
+	return line
+}
+
+func (m *model) footer() string {
+	switch {
+	case m.editing:
+		return fit("Search: "+string(m.input)+"█", m.width)
+	case m.status != "":
+		return fit(m.status, m.width)
+	case m.tree != nil:
+		return "\x1b[2m" + fit("↑↓ move  enter expand  m copy magnet  esc back  q quit", m.width) + "\x1b[0m"
+	default:
+		loaded := fmt.Sprintf("%d", len(m.torrents))
+		if !m.exhausted {
+			loaded += "+"
+		}
+		return "\x1b[2m" + fit("↑↓ move  enter files  m copy magnet  / search  q quit  ("+loaded+" torrents)", m.width) + "\x1b[0m"
+	}
+}
+
+// fit pads or truncates the text to the width (in runes, as the widths of the characters are not
+// known), whose control characters are replaced lest the names of the torrents inject escape
+// sequences into the terminal.
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s))
+	if len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
@@ -0,0 +1,286 @@
+// magneticoctl searches the torrents of magnetico from the command line, either in a database or
+// through the API of an instance of magneticow, and prints them in a scriptable format if asked, or
+// browses them interactively in the terminal (see `magneticoctl --help`).
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/boramalper/magnetico/pkg/client"
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+type options struct {
+	DatabaseURL string `long:"database" description:"URL of the database to search in (instead of --url)."`
+	URL         string `long:"url"      description:"URL of the instance of magneticow to search through (instead of --database), e.g. https://example.com/magnetico/."`
+	Username    string `long:"username" description:"Username of the instance of magneticow, if it requires the credentials."`
+	Password    string `long:"password" description:"Password of the instance of magneticow (read from MAGNETICOCTL_PASSWORD if not supplied)."`
+
+	Search searchCommand `command:"search" description:"Search the torrents."`
+	Export exportCommand `command:"export" description:"Export all the results of a search (as JSON Lines by default)."`
+	Show   showCommand   `command:"show"   description:"Show the details and the files of the torrents of the infohashes."`
+	Magnet magnetCommand `command:"magnet" description:"Print the magnet links of the torrents of the infohashes."`
+	Browse browseCommand `command:"browse" description:"Browse the torrents interactively in the terminal."`
+}
+
+var opts options
+
+func main() {
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()),
+		zapcore.Lock(os.Stderr),
+		zap.NewAtomicLevelAt(zap.WarnLevel),
+	))
+	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
+
+	if _, err := flags.Parse(&opts); err != nil {
+		// Do not print any error messages as jessevdk/go-flags already did (including the ones of
+		// the commands).
+		os.Exit(1)
+	}
+}
+
+// openSource opens the database, or the client of the instance, whichever is supplied.
+func openSource() (source, error) {
+	switch {
+	case opts.DatabaseURL != "" && opts.URL != "":
+		return nil, fmt.Errorf("either --database or --url must be supplied, not both")
+
+	case opts.DatabaseURL != "":
+		database, err := persistence.MakeDatabase(opts.DatabaseURL, zap.L())
+		if err != nil {
+			return nil, fmt.Errorf("could not open the database: %s", err.Error())
+		}
+		return &databaseSource{database: database}, nil
+
+	case opts.URL != "":
+		c, err := client.New(opts.URL)
+		if err != nil {
+			return nil, fmt.Errorf("could not create the client: %s", err.Error())
+		}
+		c.Username, c.Password = opts.Username, opts.Password
+		if c.Password == "" {
+			c.Password = os.Getenv("MAGNETICOCTL_PASSWORD")
+		}
+		return &apiSource{client: c}, nil
+
+	default:
+		return nil, fmt.Errorf("either --database or --url must be supplied")
+	}
+}
+
+// searchFlags are the flags of the searches, shared by search and export.
+type searchFlags struct {
+	OrderBy        string   `long:"order-by"        description:"Order the results by RELEVANCE, TOTAL_SIZE, DISCOVERED_ON, N_FILES, SPAM_SCORE, or POPULARITY (RELEVANCE if there is a query, DISCOVERED_ON otherwise)."`
+	Reverse        bool     `long:"reverse"         description:"Reverse the order of the results (which are the most relevant, or else the greatest, first by default)."`
+	MaxSpamScore   *float64 `long:"max-spam-score"  description:"Exclude the torrents whose spam score is greater than it (in [0, 1])."`
+	IncludeFlagged bool     `long:"include-flagged" description:"Include the torrents that are flagged by the operators too."`
+	OnlyVerified   bool     `long:"only-verified"   description:"Exclude the torrents that are not verified by the operators."`
+	Since          string   `long:"since"           description:"Exclude the torrents discovered before it (as 2006-01-02 in the local time zone, or in RFC 3339)."`
+	Until          string   `long:"until"           description:"Exclude the torrents discovered on or after it (as --since)."`
+	Refine         []string `long:"refine"          description:"Query to refine the search with. It can be supplied multiple times."`
+	Path           string   `long:"path"            description:"Substring that any of the paths of the files of the torrents must contain."`
+	Resolution     string   `long:"resolution"      description:"Resolution of the releases (e.g. 1080p)."`
+	Codec          string   `long:"codec"           description:"Codec of the releases (e.g. h264)."`
+	Group          string   `long:"group"           description:"Group of the releases."`
+	Year           *int     `long:"year"            description:"Year of the releases."`
+	Season         *int     `long:"season"          description:"Season of the releases."`
+	Episode        *int     `long:"episode"         description:"Episode of the releases."`
+	Artist         string   `long:"artist"          description:"Artist of the albums."`
+	Album          string   `long:"album"           description:"Title of the albums."`
+
+	Args struct {
+		Query []string `positional-arg-name:"QUERY"`
+	} `positional-args:"yes"`
+}
+
+// query returns the query of the flags.
+func (f *searchFlags) query() (client.Query, error) {
+	q := client.Query{
+		Query:          strings.Join(f.Args.Query, " "),
+		Epoch:          time.Now(),
+		OrderBy:        client.OrderBy(strings.ToUpper(f.OrderBy)),
+		MaxSpamScore:   f.MaxSpamScore,
+		IncludeFlagged: f.IncludeFlagged,
+		OnlyVerified:   f.OnlyVerified,
+		Refine:         f.Refine,
+		Path:           f.Path,
+		Resolution:     f.Resolution,
+		Codec:          f.Codec,
+		Group:          f.Group,
+		Year:           f.Year,
+		Season:         f.Season,
+		Episode:        f.Episode,
+		Artist:         f.Artist,
+		Album:          f.Album,
+	}
+
+	// The most relevant (whose relevance is the lowest) first, otherwise the greatest (e.g. the most
+	// recent) first.
+	ascending := (q.OrderBy == client.ByRelevance || q.OrderBy == "" && q.Query != "") != f.Reverse
+	q.Ascending = &ascending
+
+	var err error
+	if q.Since, err = parseTime(f.Since); err != nil {
+		return q, fmt.Errorf("could not parse --since: %s", err.Error())
+	}
+	if q.Until, err = parseTime(f.Until); err != nil {
+		return q, fmt.Errorf("could not parse --until: %s", err.Error())
+	}
+	return q, nil
+}
+
+// parseTime parses the time as a date in the local time zone or in RFC 3339, or returns the zero
+// time if it is empty.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// runSearch prints the results of the search, up to limit of them (all, if zero).
+func runSearch(f *searchFlags, limit uint, format string) error {
+	q, err := f.query()
+	if err != nil {
+		return err
+	}
+	p, err := newPrinter(os.Stdout, format)
+	if err != nil {
+		return err
+	}
+
+	s, err := openSource()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	err = s.search(q, limit, func(torrent persistence.TorrentMetadata) error {
+		return p.print(torrent, nil)
+	})
+	if flushErr := p.flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not search: %s", err.Error())
+	}
+	return nil
+}
+
+type searchCommand struct {
+	searchFlags
+	Limit  uint   `long:"limit"  description:"Maximum number of the results (all of them if zero)." default:"20"`
+	Format string `long:"format" description:"Format of the results: text, json (JSON Lines), tsv, or magnet." default:"text"`
+}
+
+func (c *searchCommand) Execute(args []string) error {
+	return runSearch(&c.searchFlags, c.Limit, c.Format)
+}
+
+type exportCommand struct {
+	searchFlags
+	Limit  uint   `long:"limit"  description:"Maximum number of the results (all of them if zero)."`
+	Format string `long:"format" description:"Format of the results: text, json (JSON Lines), tsv, or magnet." default:"json"`
+}
+
+func (c *exportCommand) Execute(args []string) error {
+	return runSearch(&c.searchFlags, c.Limit, c.Format)
+}
+
+// infoHashArgs are the infohashes of the torrents, as the positional arguments.
+type infoHashArgs struct {
+	Args struct {
+		InfoHashes []string `positional-arg-name:"INFOHASH" required:"1"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// forEach calls f with each torrent of the infohashes (along with its files, if withFiles) in
+// order, and returns an error if any of them is not found after all of them.
+func (a *infoHashArgs) forEach(withFiles bool, f func(torrent persistence.TorrentMetadata, files []persistence.File) error) error {
+	infoHashes := make([][]byte, len(a.Args.InfoHashes))
+	for i, infoHashHex := range a.Args.InfoHashes {
+		infoHash, err := hex.DecodeString(strings.ToLower(infoHashHex))
+		if err != nil || len(infoHash) != 20 {
+			return fmt.Errorf("malformed infohash: %s", infoHashHex)
+		}
+		infoHashes[i] = infoHash
+	}
+
+	s, err := openSource()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	var nNotFound int
+	for _, infoHash := range infoHashes {
+		torrent, err := s.torrent(infoHash)
+		if err != nil {
+			return fmt.Errorf("could not get the torrent: %s", err.Error())
+		} else if torrent == nil {
+			fmt.Fprintf(os.Stderr, "%s is not found.\n", hex.EncodeToString(infoHash))
+			nNotFound++
+			continue
+		}
+
+		var files []persistence.File
+		if withFiles {
+			if files, err = s.files(infoHash); err != nil {
+				return fmt.Errorf("could not get the files: %s", err.Error())
+			}
+		}
+		if err = f(*torrent, files); err != nil {
+			return err
+		}
+	}
+
+	if nNotFound != 0 {
+		return fmt.Errorf("%d torrent(s) are not found", nNotFound)
+	}
+	return nil
+}
+
+type showCommand struct {
+	Format string `long:"format" description:"Format of the torrents: text, json (along with the files), tsv, or magnet." default:"text"`
+	infoHashArgs
+}
+
+func (c *showCommand) Execute(args []string) error {
+	p, err := newPrinter(os.Stdout, c.Format)
+	if err != nil {
+		return err
+	}
+	p.verbose = true
+
+	err = c.forEach(true, p.print)
+	if flushErr := p.flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+type magnetCommand struct {
+	infoHashArgs
+}
+
+func (c *magnetCommand) Execute(args []string) error {
+	p, _ := newPrinter(os.Stdout, "magnet")
+	err := c.forEach(false, p.print)
+	if flushErr := p.flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// printer prints the torrents in one of the formats (see newPrinter).
+type printer struct {
+	w      *bufio.Writer
+	format string
+	// verbose prints the files of the torrents too, if the format allows.
+	verbose bool
+}
+
+// formats are the formats that the torrents can be printed in.
+var formats = []string{"text", "json", "tsv", "magnet"}
+
+// newPrinter returns the printer of the format:
+//
+//   - text is for the humans;
+//   - json is a JSON Line of each torrent (as the API of magneticow responds with it);
+//   - tsv is a line of the tab-separated infohash, name, size, number of the files, discovery time
+//     (in RFC 3339), and magnet link of each torrent;
+//   - magnet is the magnet link of each torrent.
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	for _, f := range formats {
+		if f == format {
+			return &printer{w: bufio.NewWriter(w), format: format}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown format: %s (must be one of %s)", format, strings.Join(formats, ", "))
+}
+
+// print prints the torrent, along with its files if they are not nil and the printer is verbose.
+func (p *printer) print(torrent persistence.TorrentMetadata, files []persistence.File) error {
+	infoHash := hex.EncodeToString(torrent.InfoHash)
+
+	var err error
+	switch p.format {
+	case "json":
+		if !p.verbose {
+			err = json.NewEncoder(p.w).Encode(&torrent)
+			break
+		}
+		// The torrent is not embedded, lest its MarshalJSON is promoted and the files are omitted.
+		err = json.NewEncoder(p.w).Encode(struct {
+			Torrent *persistence.TorrentMetadata `json:"torrent"`
+			Files   []persistence.File           `json:"files"`
+		}{&torrent, files})
+
+	case "tsv":
+		_, err = fmt.Fprintf(p.w, "%s\t%s\t%d\t%d\t%s\t%s\n", infoHash, tsvField(torrent.Name), torrent.Size,
+			torrent.NFiles, torrent.DiscoveredOn.UTC().Format(time.RFC3339), magnetLink(infoHash, torrent.Name))
+
+	case "magnet":
+		_, err = fmt.Fprintln(p.w, magnetLink(infoHash, torrent.Name))
+
+	default:
+		_, err = fmt.Fprintf(p.w, "%s\n    %s  %s in %d file(s), discovered on %s\n", torrent.Name, infoHash,
+			humanize.IBytes(torrent.Size), torrent.NFiles, torrent.DiscoveredOn.Local().Format("2006-01-02 15:04"))
+		if err == nil && p.verbose {
+			err = p.printDetails(torrent, files)
+		}
+	}
+	return err
+}
+
+// printDetails prints the details of the torrent (which are returned by GetTorrent only) in text.
+func (p *printer) printDetails(torrent persistence.TorrentMetadata, files []persistence.File) error {
+	fmt.Fprintf(p.w, "    moderation: %s, spam score: %.2f\n", torrent.Moderation, torrent.SpamScore)
+	if torrent.Source != persistence.SourceUnknown {
+		fmt.Fprintf(p.w, "    source: %s\n", torrent.Source)
+	}
+	if release := torrent.Release; release != nil {
+		fmt.Fprintf(p.w, "    release: %+v\n", *release)
+	}
+	if album := torrent.Album; album != nil {
+		fmt.Fprintf(p.w, "    album: %+v\n", *album)
+	}
+	fmt.Fprintf(p.w, "    %s\n", magnetLink(hex.EncodeToString(torrent.InfoHash), torrent.Name))
+
+	if len(files) != 0 {
+		fmt.Fprintln(p.w)
+	}
+	for _, file := range files {
+		fmt.Fprintf(p.w, "    %10s  %s\n", humanize.IBytes(uint64(file.Size)), file.Path)
+	}
+	_, err := fmt.Fprintln(p.w)
+	return err
+}
+
+func (p *printer) flush() error {
+	return p.w.Flush()
+}
+
+// tsvField escapes the tabs and the line breaks of the field, as the names of the torrents can
+// contain them.
+func tsvField(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r").Replace(s)
+}
+
+func magnetLink(infoHashHex string, name string) string {
+	return "magnet:?xt=urn:btih:" + infoHashHex + "&dn=" + url.QueryEscape(name)
+}
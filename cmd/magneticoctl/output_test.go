@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+func TestPrinter(t *testing.T) {
+	torrent := persistence.TorrentMetadata{
+		ID:           1,
+		InfoHash:     []byte("\xc0\xff\xee\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f\x10"),
+		Name:         "Big\tBuck Bunny",
+		Size:         1024,
+		DiscoveredOn: time.Unix(1600000000, 0).UTC(),
+		NFiles:       2,
+	}
+	files := []persistence.File{{Size: 1000, Path: "a.avi"}, {Size: 24, Path: "b.txt"}}
+
+	scenarios := []struct {
+		format  string
+		verbose bool
+		expect  string
+	}{
+		{"tsv", false, "c0ffee000102030405060708090a0b0c0d0e0f10\tBig\\tBuck Bunny\t1024\t2\t2020-09-13T12:26:40Z\t" +
+			"magnet:?xt=urn:btih:c0ffee000102030405060708090a0b0c0d0e0f10&dn=Big%09Buck+Bunny\n"},
+		{"magnet", false, "magnet:?xt=urn:btih:c0ffee000102030405060708090a0b0c0d0e0f10&dn=Big%09Buck+Bunny\n"},
+		{"json", false, `{"infoHash":"c0ffee000102030405060708090a0b0c0d0e0f10","id":1,"name":"Big\tBuck Bunny",` +
+			`"size":1024,"discoveredOn":"2020-09-13T12:26:40Z","nFiles":2,"relevance":0,"spamScore":0,` +
+			`"moderation":"unmoderated","source":"","popularity":0}` + "\n"},
+		{"json", true, `{"torrent":{"infoHash":"c0ffee000102030405060708090a0b0c0d0e0f10","id":1,"name":"Big\tBuck Bunny",` +
+			`"size":1024,"discoveredOn":"2020-09-13T12:26:40Z","nFiles":2,"relevance":0,"spamScore":0,` +
+			`"moderation":"unmoderated","source":"","popularity":0},"files":[{"size":1000,"path":"a.avi"},{"size":24,"path":"b.txt"}]}` + "\n"},
+	}
+
+	for i, s := range scenarios {
+		var buffer bytes.Buffer
+		p, err := newPrinter(&buffer, s.format)
+		if err != nil {
+			t.Fatalf("Could not create the printer of the instance #%d: %s", i+1, err.Error())
+		}
+		p.verbose = s.verbose
+
+		if err = p.print(torrent, files); err != nil {
+			t.Fatalf("Could not print the instance #%d: %s", i+1, err.Error())
+		}
+		if err = p.flush(); err != nil {
+			t.Fatalf("Could not flush the instance #%d: %s", i+1, err.Error())
+		}
+		if buffer.String() != s.expect {
+			t.Errorf("Output of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, buffer.String(), s.expect)
+		}
+	}
+
+	if _, err := newPrinter(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("Unknown format should be refused!")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	scenarios := []struct {
+		s      string
+		expect time.Time
+	}{
+		{"", time.Time{}},
+		{"2021-03-01", time.Date(2021, 3, 1, 0, 0, 0, 0, time.Local)},
+		{"2021-03-01T13:00:00Z", time.Date(2021, 3, 1, 13, 0, 0, 0, time.UTC)},
+	}
+
+	for i, s := range scenarios {
+		got, err := parseTime(s.s)
+		if err != nil {
+			t.Errorf("Could not parse the instance #%d: %s", i+1, err.Error())
+		} else if !got.Equal(s.expect) {
+			t.Errorf("Time of the instance #%d is wrong! Got %s (expected %s)", i+1, got, s.expect)
+		}
+	}
+
+	if _, err := parseTime("yesterday"); err == nil {
+		t.Error("Malformed time should be refused!")
+	}
+}
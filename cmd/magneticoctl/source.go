@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/boramalper/magnetico/pkg/client"
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// pageSize is the number of the torrents that are searched at once, which is the default maximum
+// page size of magneticow (see --max-page-size).
+const pageSize = 100
+
+// errEnough stops the streams of the results once as many of them as requested are got.
+var errEnough = errors.New("enough results")
+
+// source is where the torrents are searched in: either a database, or the API of an instance.
+type source interface {
+	// search calls f with the results of the search in order, up to limit of them (all, if zero).
+	search(q client.Query, limit uint, f func(torrent persistence.TorrentMetadata) error) error
+	// torrent returns the torrent of the infohash, or nil if it is not discovered (yet).
+	torrent(infoHash []byte) (*persistence.TorrentMetadata, error)
+	// files returns the files of the torrent of the infohash, or nil if it is not discovered (yet).
+	files(infoHash []byte) ([]persistence.File, error)
+	// fileTree returns the file tree of the torrent of the infohash, or nil if it is not discovered
+	// (yet).
+	fileTree(infoHash []byte) (*persistence.FileTreeNode, error)
+	close() error
+}
+
+// apiSource is the source of an instance of magneticow.
+type apiSource struct {
+	client *client.Client
+}
+
+func (s *apiSource) search(q client.Query, limit uint, f func(torrent persistence.TorrentMetadata) error) error {
+	q.Limit = pageSize
+	if limit != 0 && limit < pageSize {
+		q.Limit = limit
+	}
+
+	var n uint
+	err := s.client.Stream(q, func(torrent persistence.TorrentMetadata) error {
+		if err := f(torrent); err != nil {
+			return err
+		}
+		if n++; n == limit {
+			return errEnough
+		}
+		return nil
+	})
+	if err == errEnough {
+		return nil
+	}
+	return err
+}
+
+func (s *apiSource) torrent(infoHash []byte) (*persistence.TorrentMetadata, error) {
+	return s.client.Torrent(infoHash)
+}
+
+func (s *apiSource) files(infoHash []byte) ([]persistence.File, error) {
+	return s.client.Files(infoHash)
+}
+
+func (s *apiSource) fileTree(infoHash []byte) (*persistence.FileTreeNode, error) {
+	return s.client.FileTree(infoHash)
+}
+
+func (s *apiSource) close() error {
+	return nil
+}
+
+// databaseSource is the source of a database, which is searched as magneticow would.
+type databaseSource struct {
+	database persistence.Database
+}
+
+// orderingCriteria are the criteria of the database by the ones of the API.
+var orderingCriteria = map[client.OrderBy]persistence.OrderingCriteria{
+	client.ByRelevance:    persistence.ByRelevance,
+	client.ByTotalSize:    persistence.ByTotalSize,
+	client.ByDiscoveredOn: persistence.ByDiscoveredOn,
+	client.ByNFiles:       persistence.ByNFiles,
+	client.BySpamScore:    persistence.BySpamScore,
+	client.ByPopularity:   persistence.ByPopularity,
+}
+
+func (s *databaseSource) search(q client.Query, limit uint, f func(torrent persistence.TorrentMetadata) error) error {
+	orderBy := persistence.ByDiscoveredOn
+	if q.OrderBy != "" {
+		var ok bool
+		if orderBy, ok = orderingCriteria[q.OrderBy]; !ok {
+			return fmt.Errorf("unknown ordering criterion: %s", q.OrderBy)
+		}
+	} else if q.Query != "" {
+		orderBy = persistence.ByRelevance
+	}
+	ascending := q.Ascending != nil && *q.Ascending
+
+	filters := persistence.QueryFilters{
+		MaxSpamScore:   q.MaxSpamScore,
+		IncludeFlagged: q.IncludeFlagged,
+		OnlyVerified:   q.OnlyVerified,
+		Refinements:    q.Refine,
+		PathContains:   q.Path,
+		Resolution:     q.Resolution,
+		Codec:          q.Codec,
+		ReleaseGroup:   q.Group,
+		Year:           q.Year,
+		Season:         q.Season,
+		Episode:        q.Episode,
+		Artist:         q.Artist,
+		Album:          q.Album,
+	}
+	if !q.Since.IsZero() {
+		filters.DiscoveredSince = new(int64)
+		*filters.DiscoveredSince = q.Since.Unix()
+	}
+	if !q.Until.IsZero() {
+		filters.DiscoveredUntil = new(int64)
+		*filters.DiscoveredUntil = q.Until.Unix()
+	}
+
+	// Page through the results using the keyset cursor, as magneticow does.
+	var lastOrderedValue *float64
+	var lastID *uint64
+	for n := uint(0); limit == 0 || n < limit; {
+		size := uint(pageSize)
+		if limit != 0 && limit-n < size {
+			size = limit - n
+		}
+
+		torrents, err := s.database.QueryTorrents(q.Query, q.Epoch.Unix(), orderBy, ascending, size,
+			lastOrderedValue, lastID, filters, persistence.AllFields)
+		if err != nil {
+			return errors.Wrap(err, "QueryTorrents")
+		}
+		for _, torrent := range torrents {
+			if err = f(torrent); err != nil {
+				return err
+			}
+		}
+		n += uint(len(torrents))
+
+		if uint(len(torrents)) < size {
+			break
+		}
+		last := torrents[len(torrents)-1]
+		lastOrderedValue, lastID = new(float64), new(uint64)
+		*lastOrderedValue, *lastID = orderedValue(last, orderBy), last.ID
+	}
+	return nil
+}
+
+// orderedValue returns the value of the torrent that it is ordered by, to be supplied as the
+// lastOrderedValue of the next page.
+func orderedValue(t persistence.TorrentMetadata, orderBy persistence.OrderingCriteria) float64 {
+	switch orderBy {
+	case persistence.ByRelevance:
+		return t.Relevance
+	case persistence.ByTotalSize:
+		return float64(t.Size)
+	case persistence.ByNFiles:
+		return float64(t.NFiles)
+	case persistence.BySpamScore:
+		return t.SpamScore
+	case persistence.ByPopularity:
+		return float64(t.Popularity)
+	default:
+		return float64(t.DiscoveredOn.Unix())
+	}
+}
+
+func (s *databaseSource) torrent(infoHash []byte) (*persistence.TorrentMetadata, error) {
+	return s.database.GetTorrent(infoHash)
+}
+
+func (s *databaseSource) files(infoHash []byte) ([]persistence.File, error) {
+	return s.database.GetFiles(infoHash)
+}
+
+func (s *databaseSource) fileTree(infoHash []byte) (*persistence.FileTreeNode, error) {
+	return s.database.GetFileTree(infoHash)
+}
+
+func (s *databaseSource) close() error {
+	return s.database.Close()
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// The terminal user interface of `magneticoctl browse` follows the Elm architecture (as bubbletea
+// does): the model is updated with the messages (the keys pressed, and the results of the commands
+// that are run in the background) one at a time, and is rendered anew after each of them.
+
+// msg is a message that the model is updated with.
+type msg interface{}
+
+// cmd is run in the background, and the message that it returns (unless nil) is sent to the model.
+type cmd func() msg
+
+// keyMsg is a key pressed, which is either its rune or one of the names of the special keys (see
+// parseKeys).
+type keyMsg string
+
+// resizeMsg is sent when the terminal is resized.
+type resizeMsg struct {
+	width, height int
+}
+
+// resizePollInterval is how often the size of the terminal is polled, as the terminals are not
+// signalled of their resizes on every platform.
+const resizePollInterval = 250 * time.Millisecond
+
+// runProgram runs the model on the terminal of in and out until it quits, in the alternate screen
+// so that the scrollback of the terminal is left intact.
+func runProgram(m *model, in, out *os.File) error {
+	inFd, outFd := int(in.Fd()), int(out.Fd())
+	if !terminal.IsTerminal(inFd) || !terminal.IsTerminal(outFd) {
+		return fmt.Errorf("browse requires a terminal")
+	}
+	width, height, err := terminal.GetSize(outFd)
+	if err != nil {
+		return fmt.Errorf("could not get the size of the terminal: %s", err.Error())
+	}
+	m.width, m.height = width, height
+
+	state, err := terminal.MakeRaw(inFd)
+	if err != nil {
+		return fmt.Errorf("could not put the terminal into the raw mode: %s", err.Error())
+	}
+	defer terminal.Restore(inFd, state)
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	msgs := make(chan msg)
+	done := make(chan struct{})
+	defer close(done)
+	send := func(message msg) {
+		select {
+		case msgs <- message:
+		case <-done:
+		}
+	}
+	run := func(c cmd) {
+		if c != nil {
+			go func() {
+				if message := c(); message != nil {
+					send(message)
+				}
+			}()
+		}
+	}
+
+	go readKeys(in, send)
+	go func() {
+		ticker := time.NewTicker(resizePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			if w, h, err := terminal.GetSize(outFd); err == nil && (w != width || h != height) {
+				width, height = w, h
+				send(resizeMsg{w, h})
+			}
+		}
+	}()
+
+	w := bufio.NewWriter(out)
+	run(m.init())
+	for {
+		render(w, m.view())
+		for _, sequence := range m.output {
+			w.WriteString(sequence)
+		}
+		m.output = nil
+		if err = w.Flush(); err != nil {
+			return err
+		}
+		if m.quitting {
+			return nil
+		}
+		run(m.update(<-msgs))
+	}
+}
+
+// render draws the lines over the screen, clearing whatever is left of the previous render.
+func render(w io.Writer, lines []string) {
+	fmt.Fprint(w, "\x1b[H")
+	for i, line := range lines {
+		if i > 0 {
+			fmt.Fprint(w, "\r\n")
+		}
+		fmt.Fprint(w, line, "\x1b[K")
+	}
+	fmt.Fprint(w, "\x1b[J")
+}
+
+// readKeys sends the keys read from the terminal until it is closed.
+func readKeys(in io.Reader, send func(msg)) {
+	buffer := make([]byte, 256)
+	for {
+		n, err := in.Read(buffer)
+		if err != nil {
+			return
+		}
+		for _, key := range parseKeys(buffer[:n]) {
+			send(key)
+		}
+	}
+}
+
+// specialKeys are the names of the special keys by their sequences, as sent by the terminals
+// (which do not agree on some of them).
+var specialKeys = map[string]keyMsg{
+	"\x1b[A": "up", "\x1bOA": "up",
+	"\x1b[B": "down", "\x1bOB": "down",
+	"\x1b[C": "right", "\x1bOC": "right",
+	"\x1b[D": "left", "\x1bOD": "left",
+	"\x1b[H": "home", "\x1bOH": "home", "\x1b[1~": "home",
+	"\x1b[F": "end", "\x1bOF": "end", "\x1b[4~": "end",
+	"\x1b[5~": "pgup",
+	"\x1b[6~": "pgdown",
+}
+
+// parseKeys parses the keys of the input of the terminal, where an escape that does not start any
+// known sequence is the escape key itself, and the unknown sequences are skipped.
+func parseKeys(b []byte) []keyMsg {
+	var keys []keyMsg
+	for len(b) > 0 {
+		switch b[0] {
+		case 0x03:
+			keys = append(keys, "ctrl+c")
+			b = b[1:]
+			continue
+		case '\r', '\n':
+			keys = append(keys, "enter")
+			b = b[1:]
+			continue
+		case 0x7f, 0x08:
+			keys = append(keys, "backspace")
+			b = b[1:]
+			continue
+		case '\t':
+			keys = append(keys, "tab")
+			b = b[1:]
+			continue
+		case 0x1b:
+			if len(b) == 1 || (b[1] != '[' && b[1] != 'O') {
+				keys = append(keys, "esc")
+				b = b[1:]
+				continue
+			}
+			// A sequence ends with its first letter or tilde after the introducer.
+			end := 2
+			for end < len(b) && !(b[end] >= 'A' && b[end] <= 'Z' || b[end] >= 'a' && b[end] <= 'z' || b[end] == '~') {
+				end++
+			}
+			if end == len(b) {
+				return keys
+			}
+			if key, ok := specialKeys[string(b[:end+1])]; ok {
+				keys = append(keys, key)
+			}
+			b = b[end+1:]
+			continue
+		}
+
+		r, size := utf8.DecodeRune(b)
+		if r >= ' ' && r != utf8.RuneError {
+			keys = append(keys, keyMsg(string(r)))
+		}
+		b = b[size:]
+	}
+	return keys
+}
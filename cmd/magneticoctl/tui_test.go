@@ -0,0 +1,155 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/boramalper/magnetico/pkg/client"
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+func TestParseKeys(t *testing.T) {
+	scenarios := []struct {
+		input  string
+		expect []keyMsg
+	}{
+		{"q", []keyMsg{"q"}},
+		{"\x1b[A\x1b[B\x1bOC\x1b[5~", []keyMsg{"up", "down", "right", "pgup"}},
+		{"\x1b", []keyMsg{"esc"}},
+		{"ab\rç", []keyMsg{"a", "b", "enter", "ç"}},
+		{"\x1b[200~x", []keyMsg{"x"}}, // unknown sequences are skipped
+		{"\x7f\x03", []keyMsg{"backspace", "ctrl+c"}},
+	}
+
+	for i, s := range scenarios {
+		if got := parseKeys([]byte(s.input)); !reflect.DeepEqual(got, s.expect) {
+			t.Errorf("Keys of the instance #%d are wrong! Got %q (expected %q)", i+1, got, s.expect)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	scenarios := []struct {
+		s      string
+		width  int
+		expect string
+	}{
+		{"abc", 5, "abc  "},
+		{"abcdef", 4, "abc…"},
+		{"a\x1b[2Jb", 6, "a [2Jb"}, // lest the names inject escape sequences
+		{"çğü", 3, "çğü"},
+	}
+
+	for i, s := range scenarios {
+		if got := fit(s.s, s.width); got != s.expect {
+			t.Errorf("Text of the instance #%d is wrong! Got %q (expected %q)", i+1, got, s.expect)
+		}
+	}
+}
+
+// fakeSource is the source of the torrents whose names start with the query.
+type fakeSource struct {
+	torrents []persistence.TorrentMetadata
+	tree     *persistence.FileTreeNode
+}
+
+func (s *fakeSource) search(q client.Query, limit uint, f func(torrent persistence.TorrentMetadata) error) error {
+	for _, torrent := range s.torrents {
+		if strings.HasPrefix(torrent.Name, q.Query) {
+			if err := f(torrent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *fakeSource) torrent(infoHash []byte) (*persistence.TorrentMetadata, error) {
+	return nil, nil
+}
+
+func (s *fakeSource) files(infoHash []byte) ([]persistence.File, error) {
+	return nil, nil
+}
+
+func (s *fakeSource) fileTree(infoHash []byte) (*persistence.FileTreeNode, error) {
+	return s.tree, nil
+}
+
+func (s *fakeSource) close() error {
+	return nil
+}
+
+func TestModel(t *testing.T) {
+	s := &fakeSource{tree: persistence.NewFileTree([]persistence.File{
+		{Size: 1, Path: "dir/a"}, {Size: 2, Path: "dir/b"}, {Size: 3, Path: "c"},
+	})}
+	for _, name := range []string{"apple", "apricot", "banana"} {
+		s.torrents = append(s.torrents, persistence.TorrentMetadata{Name: name, InfoHash: []byte(name)})
+	}
+
+	m := newModel(s, client.Query{})
+	m.width, m.height = 40, 10
+	// run updates the model with the message, and with the messages of the commands that follow.
+	run := func(message msg) {
+		for c := m.update(message); c != nil; c = m.update(c()) {
+		}
+	}
+	names := func() (names []string) {
+		for _, torrent := range m.torrents {
+			names = append(names, torrent.Name)
+		}
+		return
+	}
+
+	run(m.init()())
+	if !reflect.DeepEqual(names(), []string{"apple", "apricot", "banana"}) || !m.exhausted {
+		t.Fatalf("Torrents are wrong! Got %v (exhausted: %t)", names(), m.exhausted)
+	}
+
+	for _, key := range []keyMsg{"/", "a", "p", "x", "backspace", "enter"} {
+		run(key)
+	}
+	if m.query.Query != "ap" || !reflect.DeepEqual(names(), []string{"apple", "apricot"}) {
+		t.Fatalf("Search is wrong! Got %v for `%s`", names(), m.query.Query)
+	}
+
+	run(keyMsg("down"))
+	run(keyMsg("down")) // the cursor stops at the last torrent
+	if m.cursor != 1 {
+		t.Errorf("Cursor is wrong! Got %d (expected 1)", m.cursor)
+	}
+
+	run(keyMsg("enter"))
+	if m.tree == nil || m.tree.torrent.Name != "apricot" || m.tree.root == nil {
+		t.Fatalf("File tree of `apricot` should be open! Got %+v", m.tree)
+	}
+	if n := len(m.tree.rows()); n != 2 {
+		t.Errorf("Number of the rows of the collapsed tree is wrong! Got %d (expected 2)", n)
+	}
+	run(keyMsg("enter"))
+	if n := len(m.tree.rows()); n != 4 {
+		t.Errorf("Number of the rows of the expanded tree is wrong! Got %d (expected 4)", n)
+	}
+
+	run(keyMsg("m"))
+	if len(m.output) != 1 || !strings.HasPrefix(m.output[0], "\x1b]52;c;") {
+		t.Errorf("Magnet link should be copied! Got %q", m.output)
+	}
+
+	run(keyMsg("left")) // collapses the directory
+	run(keyMsg("left")) // and then goes back to the results
+	if m.tree != nil {
+		t.Error("File tree should be closed!")
+	}
+
+	if lines := m.view(); len(lines) != m.height {
+		t.Errorf("Number of the lines of the view is wrong! Got %d (expected %d)", len(lines), m.height)
+	}
+
+	run(keyMsg("q"))
+	if !m.quitting {
+		t.Error("Model should be quitting!")
+	}
+}
@@ -0,0 +1,264 @@
+// Package bdecode decodes the bencoded data (BEP 3) received from the untrusted peers into the
+// generic values. It is hardened against the malformed and the malicious inputs: it never panics,
+// allocates in proportion to the length of its input (never trusting the lengths in it), and limits
+// the nesting of the lists and the dictionaries.
+//
+// The values decoded are either int64, []byte, []interface{}, or map[string]interface{}. The byte
+// strings refer to the input (rather than copies of it), so the input must not be modified while
+// the values are in use.
+package bdecode
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Mode is the strictness of the decoding.
+type Mode int
+
+const (
+	// Lenient tolerates the deviations from the specification that are commonly seen in the wild:
+	// integers and lengths with leading zeros, negative zero, dictionary keys that are not sorted
+	// or are duplicated (the first one is kept), and trailing data after the value.
+	Lenient Mode = iota
+	// Strict rejects anything that is not the canonical encoding of a single value.
+	Strict
+)
+
+// MaxDepth is the maximum nesting of the lists and the dictionaries.
+const MaxDepth = 32
+
+// ErrorKind is the kind of a SyntaxError, suitable as a metric label.
+type ErrorKind string
+
+const (
+	ErrTruncated ErrorKind = "truncated"
+	// ErrUnexpected is an unexpected byte where a value is expected.
+	ErrUnexpected ErrorKind = "unexpected"
+	// ErrInteger is a malformed (or overflowing) integer or length.
+	ErrInteger ErrorKind = "integer"
+	// ErrKey is a dictionary key that is not a byte string.
+	ErrKey ErrorKind = "key"
+	// ErrTooDeep is a nesting deeper than MaxDepth.
+	ErrTooDeep ErrorKind = "too-deep"
+	// ErrTooMany is more values than the maximum of Scan.
+	ErrTooMany ErrorKind = "too-many"
+
+	// The kinds of the errors below are tolerated in Lenient mode.
+
+	// ErrNotCanonical is an integer or a length with leading zeros, or negative zero.
+	ErrNotCanonical ErrorKind = "not-canonical"
+	ErrKeyOrder     ErrorKind = "key-order"
+	ErrDuplicateKey ErrorKind = "duplicate-key"
+	ErrTrailingData ErrorKind = "trailing-data"
+)
+
+// SyntaxError is the error of a malformed input.
+type SyntaxError struct {
+	Kind ErrorKind
+	// Offset is the offset of the input at which the error is detected.
+	Offset int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("bdecode: %s at offset %d", e.Kind, e.Offset)
+}
+
+// Decode decodes the single value that the data consists of.
+func Decode(data []byte, mode Mode) (interface{}, error) {
+	d := decoder{data: data, mode: mode}
+	value, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.offset != len(data) && mode == Strict {
+		return nil, d.error(ErrTrailingData)
+	}
+	return value, nil
+}
+
+// Scan checks that the data consists of a single value, exactly as Decode does, but without
+// decoding it (hence without allocating), and fails if it has more than maxValues values (counting
+// the lists and the dictionaries, and their keys and items, recursively), unless maxValues is zero.
+//
+// It is meant to vet the large inputs, such as the metadata of the torrents, before they are decoded
+// by the decoders that are not hardened (e.g. that recurse without limits).
+func Scan(data []byte, mode Mode, maxValues int) error {
+	d := decoder{data: data, mode: mode, scan: true, maxValues: maxValues}
+	if _, err := d.value(0); err != nil {
+		return err
+	}
+	if d.offset != len(data) && mode == Strict {
+		return d.error(ErrTrailingData)
+	}
+	return nil
+}
+
+type decoder struct {
+	data   []byte
+	offset int
+	mode   Mode
+
+	// scan is true if the values are only checked, not decoded (see Scan), where the values are
+	// counted to be at most maxValues (unless it is zero).
+	scan               bool
+	nValues, maxValues int
+}
+
+func (d *decoder) error(kind ErrorKind) error {
+	return &SyntaxError{Kind: kind, Offset: d.offset}
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if d.offset >= len(d.data) {
+		return nil, d.error(ErrTruncated)
+	}
+	d.nValues++
+	if d.maxValues != 0 && d.nValues > d.maxValues {
+		return nil, d.error(ErrTooMany)
+	}
+
+	switch c := d.data[d.offset]; {
+	case c == 'i':
+		d.offset++
+		n, err := d.integer('e')
+		if err != nil || d.scan {
+			return nil, err
+		}
+		return n, nil
+
+	case c >= '0' && c <= '9':
+		str, err := d.string()
+		if err != nil || d.scan {
+			return nil, err
+		}
+		return str, nil
+
+	case c == 'l':
+		if depth >= MaxDepth {
+			return nil, d.error(ErrTooDeep)
+		}
+		d.offset++
+		var list []interface{}
+		if !d.scan {
+			list = make([]interface{}, 0)
+		}
+		for {
+			if d.offset >= len(d.data) {
+				return nil, d.error(ErrTruncated)
+			}
+			if d.data[d.offset] == 'e' {
+				d.offset++
+				return list, nil
+			}
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if !d.scan {
+				list = append(list, item)
+			}
+		}
+
+	case c == 'd':
+		if depth >= MaxDepth {
+			return nil, d.error(ErrTooDeep)
+		}
+		d.offset++
+		var dict map[string]interface{}
+		if !d.scan {
+			dict = make(map[string]interface{})
+		}
+		var previousKey []byte
+		for {
+			if d.offset >= len(d.data) {
+				return nil, d.error(ErrTruncated)
+			}
+			if d.data[d.offset] == 'e' {
+				d.offset++
+				return dict, nil
+			}
+
+			if c := d.data[d.offset]; c < '0' || c > '9' {
+				return nil, d.error(ErrKey)
+			}
+			keyOffset := d.offset
+			d.nValues++
+			key, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			if previousKey != nil && string(key) <= string(previousKey) && d.mode == Strict {
+				kind := ErrKeyOrder
+				if string(key) == string(previousKey) {
+					kind = ErrDuplicateKey
+				}
+				return nil, &SyntaxError{Kind: kind, Offset: keyOffset}
+			}
+			previousKey = key
+
+			value, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			// The duplicates are rejected in Strict mode already.
+			if _, ok := dict[string(key)]; !ok && !d.scan {
+				dict[string(key)] = value
+			}
+		}
+
+	default:
+		return nil, d.error(ErrUnexpected)
+	}
+}
+
+// integer decodes the integer up to the terminator, which is consumed as well.
+func (d *decoder) integer(terminator byte) (int64, error) {
+	start := d.offset
+	for d.offset < len(d.data) && d.data[d.offset] != terminator {
+		d.offset++
+	}
+	if d.offset >= len(d.data) {
+		return 0, d.error(ErrTruncated)
+	}
+	digits := d.data[start:d.offset]
+	d.offset++
+
+	// strconv accepts a leading plus sign, which is not allowed here.
+	for i, c := range digits {
+		if (c < '0' || c > '9') && !(c == '-' && i == 0) {
+			return 0, &SyntaxError{Kind: ErrInteger, Offset: start + i}
+		}
+	}
+	n, err := strconv.ParseInt(string(digits), 10, 64)
+	if err != nil {
+		return 0, &SyntaxError{Kind: ErrInteger, Offset: start}
+	}
+	if d.mode == Strict {
+		unsigned := digits
+		if len(unsigned) > 0 && unsigned[0] == '-' {
+			unsigned = unsigned[1:]
+		}
+		if (len(unsigned) > 1 && unsigned[0] == '0') || string(digits) == "-0" {
+			return 0, &SyntaxError{Kind: ErrNotCanonical, Offset: start}
+		}
+	}
+	return n, nil
+}
+
+func (d *decoder) string() ([]byte, error) {
+	start := d.offset
+	length, err := d.integer(':')
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return nil, &SyntaxError{Kind: ErrInteger, Offset: start}
+	}
+	if length > int64(len(d.data)-d.offset) {
+		return nil, d.error(ErrTruncated)
+	}
+	str := d.data[d.offset : d.offset+int(length)]
+	d.offset += int(length)
+	return str, nil
+}
@@ -0,0 +1,107 @@
+package bdecode
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var decodeTests = []struct {
+	input string
+	// expected is nil if an error is expected.
+	expected interface{}
+	// strictError and lenientError are the kinds of the errors expected, or empty if none.
+	strictError, lenientError ErrorKind
+}{
+	{"i42e", int64(42), "", ""},
+	{"i-42e", int64(-42), "", ""},
+	{"i0e", int64(0), "", ""},
+	{"4:spam", []byte("spam"), "", ""},
+	{"0:", []byte{}, "", ""},
+	{"l4:spami42ee", []interface{}{[]byte("spam"), int64(42)}, "", ""},
+	{"d3:bar4:spam3:fooi42ee", map[string]interface{}{"bar": []byte("spam"), "foo": int64(42)}, "", ""},
+	{"de", map[string]interface{}{}, "", ""},
+
+	// Tolerated in Lenient mode.
+	{"i042e", int64(42), ErrNotCanonical, ""},
+	{"i-0e", int64(0), ErrNotCanonical, ""},
+	{"04:spam", []byte("spam"), ErrNotCanonical, ""},
+	{"d3:fooi42e3:bar4:spame", map[string]interface{}{"bar": []byte("spam"), "foo": int64(42)}, ErrKeyOrder, ""},
+	{"d3:fooi1e3:fooi2ee", map[string]interface{}{"foo": int64(1)}, ErrDuplicateKey, ""},
+	{"i42ejunk", int64(42), ErrTrailingData, ""},
+
+	// Rejected in both modes.
+	{"", nil, ErrTruncated, ErrTruncated},
+	{"i42", nil, ErrTruncated, ErrTruncated},
+	{"5:spam", nil, ErrTruncated, ErrTruncated},
+	{"l4:spam", nil, ErrTruncated, ErrTruncated},
+	{"ie", nil, ErrInteger, ErrInteger},
+	{"i-e", nil, ErrInteger, ErrInteger},
+	{"i+1e", nil, ErrInteger, ErrInteger},
+	{"i1_0e", nil, ErrInteger, ErrInteger},
+	{"i99999999999999999999e", nil, ErrInteger, ErrInteger},
+	{"-1:a", nil, ErrUnexpected, ErrUnexpected},
+	{"99999999999999999999:a", nil, ErrInteger, ErrInteger},
+	{"di1ei2ee", nil, ErrKey, ErrKey},
+	{"x", nil, ErrUnexpected, ErrUnexpected},
+	{strings.Repeat("l", MaxDepth+1) + strings.Repeat("e", MaxDepth+1), nil, ErrTooDeep, ErrTooDeep},
+}
+
+func TestDecode(t *testing.T) {
+	for i, test := range decodeTests {
+		for _, mode := range []Mode{Strict, Lenient} {
+			expectedError := test.strictError
+			if mode == Lenient {
+				expectedError = test.lenientError
+			}
+
+			value, err := Decode([]byte(test.input), mode)
+			if expectedError != "" {
+				if syntaxErr, ok := err.(*SyntaxError); !ok || syntaxErr.Kind != expectedError {
+					t.Errorf("Error of the instance #%d (mode %d) is wrong! Got %v (expected %s)", i+1,
+						mode, err, expectedError)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("Instance #%d (mode %d) could not be decoded! %s", i+1, mode, err.Error())
+			} else if !reflect.DeepEqual(value, test.expected) {
+				t.Errorf("Value of the instance #%d (mode %d) is wrong! Got %#v (expected %#v)", i+1,
+					mode, value, test.expected)
+			}
+		}
+	}
+}
+
+func TestDecodeDepth(t *testing.T) {
+	input := strings.Repeat("l", MaxDepth) + strings.Repeat("e", MaxDepth)
+	if _, err := Decode([]byte(input), Strict); err != nil {
+		t.Errorf("Nesting of the maximum depth could not be decoded! %s", err.Error())
+	}
+}
+
+func TestScan(t *testing.T) {
+	for i, test := range decodeTests {
+		for _, mode := range []Mode{Strict, Lenient} {
+			_, decodeErr := Decode([]byte(test.input), mode)
+			if scanErr := Scan([]byte(test.input), mode, 0); !reflect.DeepEqual(scanErr, decodeErr) {
+				t.Errorf("Error of the instance #%d (mode %d) is wrong! Got %v (expected %v)", i+1, mode,
+					scanErr, decodeErr)
+			}
+		}
+	}
+}
+
+func TestScanTooMany(t *testing.T) {
+	// A dictionary of a key and a list of two integers is 5 values.
+	input := []byte("d1:ali1ei2eee")
+	if err := Scan(input, Strict, 5); err != nil {
+		t.Errorf("Values of the maximum number could not be scanned! %s", err.Error())
+	}
+	if err, ok := Scan(input, Strict, 4).(*SyntaxError); !ok || err.Kind != ErrTooMany {
+		t.Errorf("Error of too many values is wrong! Got %v (expected %s)", err, ErrTooMany)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { _ = Scan(input, Strict, 0) }); allocs != 0 {
+		t.Errorf("Scan allocates! Got %v allocations (expected 0)", allocs)
+	}
+}
@@ -0,0 +1,91 @@
+//go:build go1.18
+// +build go1.18
+
+package bdecode
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// FuzzDecode checks that the decoder does not panic, that whatever is valid in Strict mode is
+// valid in Lenient mode as well (and decodes to the same value), and that the values decoded in
+// Strict mode are encoded back to their input.
+//
+//	go test -fuzz=FuzzDecode ./cmd/magneticod/bdecode/
+func FuzzDecode(f *testing.F) {
+	for _, test := range decodeTests {
+		f.Add([]byte(test.input))
+	}
+	f.Add([]byte("d1:ad2:id20:abcdefghij01234567896:target20:mnopqrstuvwxyz123456e1:q9:find_node1:t2:aa1:y1:qe"))
+	f.Add([]byte("d1:eli201e23:A Generic Error Ocurrede1:t2:aa1:y1:ee"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		lenient, lenientErr := Decode(data, Lenient)
+		strict, strictErr := Decode(data, Strict)
+		if strictErr != nil {
+			return
+		}
+
+		if lenientErr != nil {
+			t.Fatalf("Valid in Strict mode but not in Lenient mode! %s", lenientErr.Error())
+		}
+		if !reflect.DeepEqual(strict, lenient) {
+			t.Fatalf("Values of the modes differ! Got %#v (strict) and %#v (lenient)", strict, lenient)
+		}
+		if encoded := encode(strict); !bytes.Equal(encoded, data) {
+			t.Fatalf("Value is not encoded back to the input! Got %q (expected %q)", encoded, data)
+		}
+	})
+}
+
+// FuzzScan checks that the scanner does not panic, and that it agrees with the decoder.
+//
+//	go test -fuzz=FuzzScan ./cmd/magneticod/bdecode/
+func FuzzScan(f *testing.F) {
+	for _, test := range decodeTests {
+		f.Add([]byte(test.input))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, mode := range []Mode{Strict, Lenient} {
+			_, decodeErr := Decode(data, mode)
+			if scanErr := Scan(data, mode, 0); !reflect.DeepEqual(scanErr, decodeErr) {
+				t.Fatalf("Scan and Decode disagree (mode %d)! Got %v (expected %v)", mode, scanErr, decodeErr)
+			}
+		}
+	})
+}
+
+// encode is the canonical encoding of the value.
+func encode(value interface{}) []byte {
+	switch value := value.(type) {
+	case int64:
+		return []byte("i" + strconv.FormatInt(value, 10) + "e")
+	case []byte:
+		return append([]byte(strconv.Itoa(len(value))+":"), value...)
+	case []interface{}:
+		encoded := []byte("l")
+		for _, item := range value {
+			encoded = append(encoded, encode(item)...)
+		}
+		return append(encoded, 'e')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		encoded := []byte("d")
+		for _, key := range keys {
+			encoded = append(encoded, encode([]byte(key))...)
+			encoded = append(encoded, encode(value[key])...)
+		}
+		return append(encoded, 'e')
+	default:
+		panic("unknown type")
+	}
+}
@@ -0,0 +1,29 @@
+//go:build go1.18
+// +build go1.18
+
+package metadata
+
+import (
+	"strings"
+	"testing"
+)
+
+// FuzzDecodeInfo checks that the metadata are decoded without panics, and that the info
+// dictionaries accepted are valid.
+//
+//	go test -fuzz=FuzzDecodeInfo ./cmd/magneticod/bittorrent/metadata/
+func FuzzDecodeInfo(f *testing.F) {
+	f.Add([]byte("d6:lengthi1e4:name1:a12:piece lengthi16384e6:pieces20:01234567890123456789e"))
+	f.Add([]byte("d5:filesld6:lengthi1e4:pathl1:a1:beee4:name1:a12:piece lengthi16384e6:pieces20:01234567890123456789e"))
+	f.Add([]byte("d4:name1:a3:xyz" + strings.Repeat("l", 64) + strings.Repeat("e", 64) + "e"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		info, err := decodeInfo(data)
+		if err != nil {
+			return
+		}
+		if err = validateInfo(info); err != nil {
+			t.Fatalf("Invalid info dictionary is accepted! %s", err.Error())
+		}
+	})
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"crypto/sha1"
 	"encoding/binary"
+	"expvar"
 	"fmt"
 	"io"
 	"math"
 	"net"
 	"time"
+	"unicode/utf8"
 
 	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/metainfo"
@@ -16,11 +18,33 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/boramalper/magnetico/cmd/magneticod/bdecode"
 	"github.com/boramalper/magnetico/pkg/persistence"
+	"github.com/boramalper/magnetico/pkg/util"
 )
 
 const MAX_METADATA_SIZE = 10 * 1024 * 1024
 
+// maxMetadataValues is the maximum number of the bencoded values of the metadata (see decodeInfo),
+// which is far more than what the torrents of MAX_METADATA_SIZE of legitimate files have, but bounds
+// the work that the pathological ones (e.g. of millions of empty lists) cause.
+const maxMetadataValues = 2 * 1000 * 1000
+
+// rejections are the numbers of the torrents that are rejected by the guardrails (see Limits and
+// decodeInfo) by their reasons, served by expvar (see --debug-addr).
+var rejections = expvar.NewMap("metadata_rejections")
+
+// Limits are the guardrails against the pathological torrents, which stall the fetches and bloat the
+// files table: the torrents whose metadata are bigger than MaxMetadataSize (at most
+// MAX_METADATA_SIZE) bytes, or that have more than MaxFiles files, are rejected, and the paths of the
+// files that are longer than MaxPathLength bytes are truncated. Zero MaxFiles and MaxPathLength are
+// unlimited.
+type Limits struct {
+	MaxMetadataSize int
+	MaxFiles        int
+	MaxPathLength   int
+}
+
 type rootDict struct {
 	M            mDict `bencode:"m"`
 	MetadataSize int   `bencode:"metadata_size"`
@@ -47,6 +71,11 @@ type Leech struct {
 	metadataReceived, metadataSize uint
 	metadata                       []byte
 
+	// textMaxSize is the maximum size of the text files that are fetched along with the metadata
+	// (see fetchText); zero disables fetching them.
+	textMaxSize int
+	limits      Limits
+
 	connClosed bool
 }
 
@@ -55,11 +84,14 @@ type LeechEventHandlers struct {
 	OnError   func([20]byte, error) // must be supplied. args: infohash, error
 }
 
-func NewLeech(infoHash [20]byte, peerAddr *net.TCPAddr, clientID []byte, ev LeechEventHandlers) *Leech {
+func NewLeech(infoHash [20]byte, peerAddr *net.TCPAddr, clientID []byte, textMaxSize int, limits Limits,
+	ev LeechEventHandlers) *Leech {
 	l := new(Leech)
 	l.infoHash = infoHash
 	l.peerAddr = peerAddr
 	copy(l.clientID[:], clientID)
+	l.textMaxSize = textMaxSize
+	l.limits = limits
 	l.ev = ev
 
 	return l
@@ -132,7 +164,10 @@ func (l *Leech) doExHandshake() error {
 		return errors.Wrap(err, "unmarshal rExMessage")
 	}
 
-	if !(0 < rRootDict.MetadataSize && rRootDict.MetadataSize < MAX_METADATA_SIZE) {
+	if !(0 < rRootDict.MetadataSize && rRootDict.MetadataSize <= l.limits.MaxMetadataSize) {
+		if rRootDict.MetadataSize > 0 {
+			rejections.Add("metadata-size", 1)
+		}
 		return fmt.Errorf("metadata too big or its size is less than or equal zero")
 	}
 
@@ -253,7 +288,7 @@ func (l *Leech) connect(deadline time.Time) error {
 	err = l.conn.SetLinger(0)
 	if err != nil {
 		if err := l.conn.Close(); err != nil {
-			zap.L().Panic("couldn't close leech connection!", zap.Error(err))
+			zap.L().Named("metadata").Panic("couldn't close leech connection!", zap.Error(err))
 		}
 		return errors.Wrap(err, "SetLinger")
 	}
@@ -261,7 +296,7 @@ func (l *Leech) connect(deadline time.Time) error {
 	err = l.conn.SetNoDelay(true)
 	if err != nil {
 		if err := l.conn.Close(); err != nil {
-			zap.L().Panic("couldn't close leech connection!", zap.Error(err))
+			zap.L().Named("metadata").Panic("couldn't close leech connection!", zap.Error(err))
 		}
 		return errors.Wrap(err, "NODELAY")
 	}
@@ -269,7 +304,7 @@ func (l *Leech) connect(deadline time.Time) error {
 	err = l.conn.SetDeadline(deadline)
 	if err != nil {
 		if err := l.conn.Close(); err != nil {
-			zap.L().Panic("couldn't close leech connection!", zap.Error(err))
+			zap.L().Named("metadata").Panic("couldn't close leech connection!", zap.Error(err))
 		}
 		return errors.Wrap(err, "SetDeadline")
 	}
@@ -283,7 +318,7 @@ func (l *Leech) closeConn() {
 	}
 
 	if err := l.conn.Close(); err != nil {
-		zap.L().Panic("couldn't close leech connection!", zap.Error(err))
+		zap.L().Named("metadata").Panic("couldn't close leech connection!", zap.Error(err))
 		return
 	}
 
@@ -372,8 +407,10 @@ func (l *Leech) Do(deadline time.Time) {
 	}
 
 	// We are done with the transfer, close socket as soon as possible (i.e. NOW) to avoid hitting "too many open files"
-	// error.
-	l.closeConn()
+	// error, unless the text is to be fetched too.
+	if l.textMaxSize == 0 {
+		l.closeConn()
+	}
 
 	// Verify the checksum
 	sha1Sum := sha1.Sum(l.metadata)
@@ -383,15 +420,14 @@ func (l *Leech) Do(deadline time.Time) {
 	}
 
 	// Check the info dictionary
-	info := new(metainfo.Info)
-	err = bencode.Unmarshal(l.metadata, info)
+	info, err := decodeInfo(l.metadata)
 	if err != nil {
-		l.OnError(errors.Wrap(err, "unmarshal info"))
+		l.OnError(errors.Wrap(err, "decodeInfo"))
 		return
 	}
-	err = validateInfo(info)
-	if err != nil {
-		l.OnError(errors.Wrap(err, "validateInfo"))
+	if l.limits.MaxFiles != 0 && len(info.Files) > l.limits.MaxFiles {
+		rejections.Add("files", 1)
+		l.OnError(fmt.Errorf("too many files (%d)", len(info.Files)))
 		return
 	}
 
@@ -400,13 +436,13 @@ func (l *Leech) Do(deadline time.Time) {
 	if len(info.Files) == 0 {
 		files = append(files, persistence.File{
 			Size: info.Length,
-			Path: info.Name,
+			Path: truncatePath(info.Name, l.limits.MaxPathLength),
 		})
 	} else {
 		for _, file := range info.Files {
 			files = append(files, persistence.File{
 				Size: file.Length,
-				Path: file.DisplayPath(info),
+				Path: truncatePath(file.DisplayPath(info), l.limits.MaxPathLength),
 			})
 		}
 	}
@@ -421,6 +457,17 @@ func (l *Leech) Do(deadline time.Time) {
 		totalSize += uint64(file.Size)
 	}
 
+	// The metadata is fetched even if its text is not, as the text is merely nice to have.
+	var text *persistence.TorrentText
+	if l.textMaxSize > 0 {
+		text, err = l.fetchText(info, files)
+		if err != nil {
+			zap.L().Named("metadata").Debug("Could not fetch the text!", util.HexField("infoHash", l.infoHash[:]),
+				zap.Error(err))
+		}
+		l.closeConn()
+	}
+
 	l.ev.OnSuccess(Metadata{
 		InfoHash:     l.infoHash[:],
 		Name:         info.Name,
@@ -428,9 +475,49 @@ func (l *Leech) Do(deadline time.Time) {
 		DiscoveredOn: time.Now().Unix(),
 		Files:        files,
 		Metadata:     l.metadata,
+		Text:         text,
 	})
 }
 
+// decodeInfo decodes (and validates) the info dictionary of the metadata, failing closed: the
+// metadata is scanned by the hardened decoder first (see bdecode.Scan), so that the nestings deeper
+// than bdecode.MaxDepth and more than maxMetadataValues values are rejected before they reach the
+// decoder of anacrolix/torrent, which is not hardened against them.
+func decodeInfo(metadata []byte) (*metainfo.Info, error) {
+	if err := bdecode.Scan(metadata, bdecode.Lenient, maxMetadataValues); err != nil {
+		kind := "bencode"
+		if syntaxErr, ok := err.(*bdecode.SyntaxError); ok {
+			kind = "bencode-" + string(syntaxErr.Kind)
+		}
+		rejections.Add(kind, 1)
+		return nil, errors.Wrap(err, "scan info")
+	}
+
+	info := new(metainfo.Info)
+	if err := bencode.Unmarshal(metadata, info); err != nil {
+		rejections.Add("info", 1)
+		return nil, errors.Wrap(err, "unmarshal info")
+	}
+	if err := validateInfo(info); err != nil {
+		rejections.Add("info", 1)
+		return nil, errors.Wrap(err, "validateInfo")
+	}
+	return info, nil
+}
+
+// truncatePath truncates the path to at most maxLength bytes (unless maxLength is zero), without
+// splitting its last character.
+func truncatePath(path string, maxLength int) string {
+	if maxLength == 0 || len(path) <= maxLength {
+		return path
+	}
+	end := maxLength
+	for end > 0 && !utf8.RuneStart(path[end]) {
+		end--
+	}
+	return path[:end]
+}
+
 // COPIED FROM anacrolix/torrent
 func validateInfo(info *metainfo.Info) error {
 	if len(info.Pieces)%20 != 0 {
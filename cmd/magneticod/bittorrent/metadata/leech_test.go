@@ -2,9 +2,12 @@ package metadata
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/anacrolix/torrent/bencode"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
 )
 
 var operationsTest_instances = []struct {
@@ -42,3 +45,92 @@ func TestDecoder(t *testing.T) {
 		}
 	}
 }
+
+var textFileTest_instances = []struct {
+	files  []persistence.File
+	path   string
+	offset int64
+}{
+	{
+		files:  []persistence.File{{Size: 100, Path: "a.mkv"}, {Size: 10, Path: "a.txt"}, {Size: 20, Path: "a.NFO"}},
+		path:   "a.NFO",
+		offset: 110,
+	},
+	{
+		files:  []persistence.File{{Size: 100, Path: "a.mkv"}, {Size: 10, Path: "a.txt"}, {Size: 1e6, Path: "a.nfo"}},
+		path:   "a.txt",
+		offset: 100,
+	},
+	{
+		files:  []persistence.File{{Size: 0, Path: "a.nfo"}, {Size: 100, Path: "a.mkv"}},
+		offset: -1,
+	},
+}
+
+func TestTextFile(t *testing.T) {
+	for i, instance := range textFileTest_instances {
+		file, offset, ok := textFile(instance.files, 1024)
+		if ok != (instance.offset != -1) || file.Path != instance.path || offset != instance.offset {
+			t.Errorf("Text file of the instance #%d is wrong! Got %s at %d (expected %s at %d)",
+				i+1, file.Path, offset, instance.path, instance.offset)
+		}
+	}
+}
+
+func TestPieceRange(t *testing.T) {
+	if first, last := pieceRange(100, 28, 64); first != 1 || last != 1 {
+		t.Errorf("Piece range is wrong! Got %d-%d (expected 1-1)", first, last)
+	}
+	if first, last := pieceRange(100, 29, 64); first != 1 || last != 2 {
+		t.Errorf("Piece range is wrong! Got %d-%d (expected 1-2)", first, last)
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	if text := decodeText([]byte("\xef\xbb\xbfh\xc3\xa9llo\x00")); text != "héllo" {
+		t.Errorf("UTF-8 text is decoded wrong! Got %q", text)
+	}
+	if text := decodeText([]byte("\xdb\xb0\xb1 hi")); text != "█░▒ hi" {
+		t.Errorf("Code page 437 text is decoded wrong! Got %q", text)
+	}
+}
+
+var truncatePathTest_instances = []struct {
+	path      string
+	maxLength int
+	expected  string
+}{
+	{"a/b.txt", 0, "a/b.txt"},
+	{"a/b.txt", 7, "a/b.txt"},
+	{"a/b.txt", 3, "a/b"},
+	{"a/ü.txt", 3, "a/"}, // ü is 2 bytes
+	{"a/ü.txt", 4, "a/ü"},
+}
+
+func TestTruncatePath(t *testing.T) {
+	for i, instance := range truncatePathTest_instances {
+		if path := truncatePath(instance.path, instance.maxLength); path != instance.expected {
+			t.Errorf("Truncated path of the instance #%d is wrong! Got %q (expected %q)", i+1, path, instance.expected)
+		}
+	}
+}
+
+var decodeInfoTest_instances = []struct {
+	metadata string
+	valid    bool
+}{
+	{"d6:lengthi1e4:name1:a12:piece lengthi16384e6:pieces20:01234567890123456789e", true},
+	// The pieces are at odds with the length.
+	{"d6:lengthi1e4:name1:a12:piece lengthi16384e6:pieces40:0123456789012345678901234567890123456789e", false},
+	// A nesting that is too deep, under a key that is not even decoded.
+	{"d4:name1:a3:xyz" + strings.Repeat("l", 64) + strings.Repeat("e", 64) + "e", false},
+	{"d4:name1:a", false},
+}
+
+func TestDecodeInfo(t *testing.T) {
+	for i, instance := range decodeInfoTest_instances {
+		if _, err := decodeInfo([]byte(instance.metadata)); (err == nil) != instance.valid {
+			t.Errorf("Validity of the instance #%d is wrong! Got %v (expected %v)", i+1, err == nil, instance.valid)
+		}
+	}
+}
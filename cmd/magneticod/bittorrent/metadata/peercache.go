@@ -0,0 +1,101 @@
+package metadata
+
+import (
+	"container/list"
+	"net"
+)
+
+const (
+	// peerCacheCapacity is the number of the infohashes whose peers are remembered.
+	peerCacheCapacity = 10000
+	// maxCachedPeers is the maximum number of the peers remembered per infohash.
+	maxCachedPeers = 32
+)
+
+// peerCache remembers the known peers of the most recently sunk infohashes (up to its capacity),
+// gathered from every source (get_peers responses, announces, and so on), so that the infohash can
+// be retried with the other peers when a leech fails without walking the DHT again. The peers that
+// fail are forgotten. It is not safe for concurrent use.
+type peerCache struct {
+	capacity int
+	// order is the infohashes from the most recently used to the least.
+	order    *list.List
+	elements map[[20]byte]*list.Element
+}
+
+type peerCacheEntry struct {
+	infoHash [20]byte
+	peers    []net.TCPAddr
+}
+
+func newPeerCache(capacity int) *peerCache {
+	return &peerCache{
+		capacity: capacity,
+		order:    list.New(),
+		elements: make(map[[20]byte]*list.Element),
+	}
+}
+
+// add merges the peers into the known peers of the infohash.
+func (pc *peerCache) add(infoHash [20]byte, peers []net.TCPAddr) {
+	element, ok := pc.elements[infoHash]
+	if ok {
+		pc.order.MoveToFront(element)
+	} else {
+		if pc.order.Len() >= pc.capacity {
+			oldest := pc.order.Back()
+			delete(pc.elements, oldest.Value.(*peerCacheEntry).infoHash)
+			pc.order.Remove(oldest)
+		}
+		element = pc.order.PushFront(&peerCacheEntry{infoHash: infoHash})
+		pc.elements[infoHash] = element
+	}
+
+	entry := element.Value.(*peerCacheEntry)
+	for _, peer := range peers {
+		if len(entry.peers) >= maxCachedPeers {
+			break
+		}
+		if indexOfPeer(entry.peers, peer) == -1 {
+			entry.peers = append(entry.peers, peer)
+		}
+	}
+}
+
+// next returns the first known peer of the infohash that is not failed yet.
+func (pc *peerCache) next(infoHash [20]byte) (net.TCPAddr, bool) {
+	element, ok := pc.elements[infoHash]
+	if !ok || len(element.Value.(*peerCacheEntry).peers) == 0 {
+		return net.TCPAddr{}, false
+	}
+	return element.Value.(*peerCacheEntry).peers[0], true
+}
+
+// fail forgets the peer of the infohash.
+func (pc *peerCache) fail(infoHash [20]byte, peer net.TCPAddr) {
+	element, ok := pc.elements[infoHash]
+	if !ok {
+		return
+	}
+	entry := element.Value.(*peerCacheEntry)
+	if i := indexOfPeer(entry.peers, peer); i != -1 {
+		entry.peers = append(entry.peers[:i], entry.peers[i+1:]...)
+	}
+}
+
+// forget forgets the infohash altogether (e.g. once its metadata is fetched).
+func (pc *peerCache) forget(infoHash [20]byte) {
+	if element, ok := pc.elements[infoHash]; ok {
+		delete(pc.elements, infoHash)
+		pc.order.Remove(element)
+	}
+}
+
+func indexOfPeer(peers []net.TCPAddr, peer net.TCPAddr) int {
+	for i, p := range peers {
+		if p.Port == peer.Port && p.IP.Equal(peer.IP) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,39 @@
+package metadata
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPeerCache(t *testing.T) {
+	pc := newPeerCache(2)
+	a, b, c := [20]byte{'a'}, [20]byte{'b'}, [20]byte{'c'}
+	peer1 := net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6881}
+	peer2 := net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 6881}
+
+	pc.add(a, []net.TCPAddr{peer1})
+	pc.add(a, []net.TCPAddr{peer1, peer2})
+	if peer, ok := pc.next(a); !ok || peer.String() != peer1.String() {
+		t.Errorf("Next peer is wrong! Got %s (expected %s)", peer.String(), peer1.String())
+	}
+
+	pc.fail(a, peer1)
+	if peer, ok := pc.next(a); !ok || peer.String() != peer2.String() {
+		t.Errorf("Next peer after a failure is wrong! Got %s (expected %s)", peer.String(), peer2.String())
+	}
+	pc.fail(a, peer2)
+	if _, ok := pc.next(a); ok {
+		t.Errorf("Failed peers should have been forgotten")
+	}
+
+	pc.add(b, []net.TCPAddr{peer1})
+	pc.add(c, []net.TCPAddr{peer1}) // evicts a, the least recently used
+	if _, ok := pc.elements[a]; ok || len(pc.elements) != 2 {
+		t.Errorf("Peer cache should not grow beyond its capacity (got %d)", len(pc.elements))
+	}
+
+	pc.forget(b)
+	if _, ok := pc.next(b); ok {
+		t.Errorf("Forgotten infohashes should not have any peers")
+	}
+}
@@ -23,21 +23,47 @@ type Metadata struct {
 	// Files must be populated for both single-file and multi-file torrents!
 	Files    []persistence.File
 	Metadata []byte
+	Source   persistence.Source
+	// Discovery is when the infohash was first seen, and by which peer it was announced (i.e. the
+	// first peer of the first result of the infohash), which is not anonymised.
+	Discovery persistence.Discovery
+	// Text is the text of the torrent (see persistence.TorrentText), which is nil unless the texts
+	// are fetched (see NewSink) and the torrent has one.
+	Text *persistence.TorrentText
+}
+
+// firstSeer is implemented by the results that know when their infohashes were first seen (e.g.
+// the ones that are scheduled by the crawler), else they are taken to be seen when sunk.
+type firstSeer interface {
+	FirstSeen() time.Time
+}
+
+// incoming is an infohash being leeched.
+type incoming struct {
+	source    persistence.Source
+	discovery persistence.Discovery
 }
 
 type Sink struct {
 	PeerID      []byte
 	deadline    time.Duration
 	maxNLeeches int
+	textMaxSize int
+	limits      Limits
 	drain       chan Metadata
 
-	incomingInfoHashes   map[[20]byte][]net.TCPAddr
+	// incomingInfoHashes are the infohashes being leeched (along with their sources and
+	// discoveries), whose peers are in peers.
+	incomingInfoHashes   map[[20]byte]incoming
+	peers                *peerCache
 	incomingInfoHashesMx sync.Mutex
 
 	terminated  bool
 	termination chan interface{}
 
 	deleted int
+
+	logger *zap.Logger
 }
 
 func randomID() []byte {
@@ -74,14 +100,21 @@ func randomDigit() byte {
 	return byte(rand.Intn(max-min) + min)
 }
 
-func NewSink(deadline time.Duration, maxNLeeches int) *Sink {
+// NewSink returns a Sink of at most maxNLeeches leeches at a time. The text files of the torrents
+// (see persistence.IsTextFile) that are at most textMaxSize bytes are fetched too, by downloading
+// the pieces that cover them, unless textMaxSize is zero. The torrents are fetched within the limits.
+func NewSink(deadline time.Duration, maxNLeeches int, textMaxSize int, limits Limits) *Sink {
 	ms := new(Sink)
+	ms.logger = zap.L().Named("metadata")
 
 	ms.PeerID = randomID()
 	ms.deadline = deadline
 	ms.maxNLeeches = maxNLeeches
+	ms.textMaxSize = textMaxSize
+	ms.limits = limits
 	ms.drain = make(chan Metadata, 10)
-	ms.incomingInfoHashes = make(map[[20]byte][]net.TCPAddr)
+	ms.incomingInfoHashes = make(map[[20]byte]incoming)
+	ms.peers = newPeerCache(peerCacheCapacity)
 	ms.termination = make(chan interface{})
 
 	go func() {
@@ -89,7 +122,7 @@ func NewSink(deadline time.Duration, maxNLeeches int) *Sink {
 			ms.incomingInfoHashesMx.Lock()
 			l := len(ms.incomingInfoHashes)
 			ms.incomingInfoHashesMx.Unlock()
-			zap.L().Info("Sink status",
+			ms.logger.Info("Sink status",
 				zap.Int("activeLeeches", l),
 				zap.Int("nDeleted", ms.deleted),
 				zap.Int("drainQueue", len(ms.drain)),
@@ -103,37 +136,95 @@ func NewSink(deadline time.Duration, maxNLeeches int) *Sink {
 
 func (ms *Sink) Sink(res dht.Result) {
 	if ms.terminated {
-		zap.L().Panic("Trying to Sink() an already closed Sink!")
+		ms.logger.Panic("Trying to Sink() an already closed Sink!")
 	}
 	ms.incomingInfoHashesMx.Lock()
 	defer ms.incomingInfoHashesMx.Unlock()
 
+	infoHash := res.InfoHash()
+	// The peers are remembered even if the infohash is being leeched already, so that they can be
+	// tried if the current one fails.
+	ms.peers.add(infoHash, res.PeerAddrs())
+
 	// cap the max # of leeches
 	if len(ms.incomingInfoHashes) >= ms.maxNLeeches {
 		return
 	}
 
-	infoHash := res.InfoHash()
-	peerAddrs := res.PeerAddrs()
-
 	if _, exists := ms.incomingInfoHashes[infoHash]; exists {
 		return
-	} else if len(peerAddrs) > 0 {
-		peer := peerAddrs[0]
-		ms.incomingInfoHashes[infoHash] = peerAddrs[1:]
-
-		go NewLeech(infoHash, &peer, ms.PeerID, LeechEventHandlers{
-			OnSuccess: ms.flush,
-			OnError:   ms.onLeechError,
-		}).Do(time.Now().Add(ms.deadline))
+	} else if peer, ok := ms.peers.next(infoHash); ok {
+		ms.incomingInfoHashes[infoHash] = incoming{source: res.Source(), discovery: discoveryOf(res)}
+		ms.leech(infoHash, peer)
+	}
+
+	ms.logger.Debug("Sunk!", zap.Int("leeches", len(ms.incomingInfoHashes)), util.HexField("infoHash", infoHash[:]))
+}
+
+// discoveryOf returns the discovery of the infohash of the result.
+func discoveryOf(res dht.Result) persistence.Discovery {
+	discovery := persistence.Discovery{On: time.Now()}
+	if fs, ok := res.(firstSeer); ok {
+		discovery.On = fs.FirstSeen()
+	}
+	if peerAddrs := res.PeerAddrs(); len(peerAddrs) > 0 {
+		discovery.PeerIP = peerAddrs[0].IP
+		discovery.PeerPort = uint16(peerAddrs[0].Port)
+	}
+	return discovery
+}
+
+// Incoming is an infohash being leeched, as returned by Sink.Incoming.
+type Incoming struct {
+	InfoHash [20]byte
+	// PeerAddrs are the known peers of the infohash that have not failed yet, the one being tried
+	// first.
+	PeerAddrs []net.TCPAddr
+	Source    persistence.Source
+	FirstSeen time.Time
+}
+
+// Incoming returns the infohashes being leeched, so that they can be resumed after a restart.
+func (ms *Sink) Incoming() []Incoming {
+	ms.incomingInfoHashesMx.Lock()
+	defer ms.incomingInfoHashesMx.Unlock()
+
+	result := make([]Incoming, 0, len(ms.incomingInfoHashes))
+	for infoHash, in := range ms.incomingInfoHashes {
+		var peerAddrs []net.TCPAddr
+		if element, ok := ms.peers.elements[infoHash]; ok {
+			peerAddrs = append(peerAddrs, element.Value.(*peerCacheEntry).peers...)
+		}
+		result = append(result, Incoming{
+			InfoHash:  infoHash,
+			PeerAddrs: peerAddrs,
+			Source:    in.source,
+			FirstSeen: in.discovery.On,
+		})
 	}
+	return result
+}
 
-	zap.L().Debug("Sunk!", zap.Int("leeches", len(ms.incomingInfoHashes)), util.HexField("infoHash", infoHash[:]))
+// Free returns the number of the infohashes that can be sunk before the leeches are capped.
+func (ms *Sink) Free() int {
+	ms.incomingInfoHashesMx.Lock()
+	defer ms.incomingInfoHashesMx.Unlock()
+	return ms.maxNLeeches - len(ms.incomingInfoHashes)
+}
+
+// leech must be called with incomingInfoHashesMx locked.
+func (ms *Sink) leech(infoHash [20]byte, peer net.TCPAddr) {
+	go NewLeech(infoHash, &peer, ms.PeerID, ms.textMaxSize, ms.limits, LeechEventHandlers{
+		OnSuccess: ms.flush,
+		OnError: func(infoHash [20]byte, err error) {
+			ms.onLeechError(infoHash, peer, err)
+		},
+	}).Do(time.Now().Add(ms.deadline))
 }
 
 func (ms *Sink) Drain() <-chan Metadata {
 	if ms.terminated {
-		zap.L().Panic("Trying to Drain() an already closed Sink!")
+		ms.logger.Panic("Trying to Drain() an already closed Sink!")
 	}
 	return ms.drain
 }
@@ -149,30 +240,32 @@ func (ms *Sink) flush(result Metadata) {
 		return
 	}
 
+	var infoHash [20]byte
+	copy(infoHash[:], result.InfoHash)
+	ms.incomingInfoHashesMx.Lock()
+	result.Source = ms.incomingInfoHashes[infoHash].source
+	result.Discovery = ms.incomingInfoHashes[infoHash].discovery
+	ms.incomingInfoHashesMx.Unlock()
+
 	ms.drain <- result
 	// Delete the infoHash from ms.incomingInfoHashes ONLY AFTER once we've flushed the
 	// metadata!
 	ms.incomingInfoHashesMx.Lock()
 	defer ms.incomingInfoHashesMx.Unlock()
 
-	var infoHash [20]byte
-	copy(infoHash[:], result.InfoHash)
 	delete(ms.incomingInfoHashes, infoHash)
+	ms.peers.forget(infoHash)
 }
 
-func (ms *Sink) onLeechError(infoHash [20]byte, err error) {
-	zap.L().Debug("leech error", util.HexField("infoHash", infoHash[:]), zap.Error(err))
+func (ms *Sink) onLeechError(infoHash [20]byte, peer net.TCPAddr, err error) {
+	ms.logger.Debug("leech error", util.HexField("infoHash", infoHash[:]), zap.Error(err))
 
 	ms.incomingInfoHashesMx.Lock()
 	defer ms.incomingInfoHashesMx.Unlock()
 
-	if len(ms.incomingInfoHashes[infoHash]) > 0 {
-		peer := ms.incomingInfoHashes[infoHash][0]
-		ms.incomingInfoHashes[infoHash] = ms.incomingInfoHashes[infoHash][1:]
-		go NewLeech(infoHash, &peer, ms.PeerID, LeechEventHandlers{
-			OnSuccess: ms.flush,
-			OnError:   ms.onLeechError,
-		}).Do(time.Now().Add(ms.deadline))
+	ms.peers.fail(infoHash, peer)
+	if next, ok := ms.peers.next(infoHash); ok {
+		ms.leech(infoHash, next)
 	} else {
 		ms.deleted++
 		delete(ms.incomingInfoHashes, infoHash)
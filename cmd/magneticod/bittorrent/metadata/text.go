@@ -0,0 +1,228 @@
+package metadata
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+const (
+	// textPiecesMaxSize is the maximum total size of the pieces that are downloaded to fetch the
+	// text of a torrent, as the pieces of the big torrents are much bigger than their texts.
+	textPiecesMaxSize = 4 * 1024 * 1024
+	// textTimeout is how long the pieces of the text are waited for, after the metadata is fetched.
+	textTimeout = 10 * time.Second
+	// blockSize is the size of the blocks that the pieces are requested in, which is the largest
+	// that the peers are expected to serve.
+	blockSize = 16 * 1024
+)
+
+// The IDs of the messages of the peer wire protocol that are used to fetch the texts.
+const (
+	msgChoke      = 0
+	msgUnchoke    = 1
+	msgInterested = 2
+	msgHave       = 4
+	msgBitfield   = 5
+	msgRequest    = 6
+	msgPiece      = 7
+)
+
+// textFile returns the file that is to be fetched as the text of the torrent, and its offset in the
+// torrent: the first .nfo file whose size is (non-zero and) at most maxSize, else the first such
+// .txt file. ok is false if there is none.
+func textFile(files []persistence.File, maxSize int) (file persistence.File, offset int64, ok bool) {
+	var txt persistence.File
+	var txtOffset int64 = -1
+	var position int64
+	for _, f := range files {
+		if 0 < f.Size && f.Size <= int64(maxSize) && persistence.IsTextFile(f.Path) {
+			if strings.HasSuffix(strings.ToLower(f.Path), ".nfo") {
+				return f, position, true
+			} else if txtOffset == -1 {
+				txt, txtOffset = f, position
+			}
+		}
+		position += f.Size
+	}
+	return txt, txtOffset, txtOffset != -1
+}
+
+// pieceRange returns the (inclusive) range of the pieces that cover the size bytes at the offset.
+func pieceRange(offset, size, pieceLength int64) (first, last int) {
+	return int(offset / pieceLength), int((offset + size - 1) / pieceLength)
+}
+
+// decodeText decodes the contents of a text file, which are either UTF-8 (sans the byte order mark)
+// or, as most of the .nfo files are, of the code page 437 for their ASCII art.
+func decodeText(b []byte) string {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	text := string(b)
+	if !utf8.Valid(b) {
+		if decoded, err := charmap.CodePage437.NewDecoder().Bytes(b); err == nil {
+			text = string(decoded)
+		}
+	}
+	return strings.ReplaceAll(text, "\x00", "")
+}
+
+// fetchText fetches the text of the torrent (see textFile) from the peer, after its metadata is
+// fetched, by downloading (and verifying) the pieces that cover it. The text is nil (and the error
+// too) if the torrent has no text file.
+func (l *Leech) fetchText(info *metainfo.Info, files []persistence.File) (*persistence.TorrentText, error) {
+	file, offset, ok := textFile(files, l.textMaxSize)
+	if !ok {
+		return nil, nil
+	}
+	first, last := pieceRange(offset, file.Size, info.PieceLength)
+	if int64(last-first+1)*info.PieceLength > textPiecesMaxSize {
+		return nil, fmt.Errorf("pieces of the text are too big (%d bytes each)", info.PieceLength)
+	}
+
+	if err := l.conn.SetDeadline(time.Now().Add(textTimeout)); err != nil {
+		return nil, errors.Wrap(err, "SetDeadline")
+	}
+	if err := l.writeAll([]byte{0, 0, 0, 1, msgInterested}); err != nil {
+		return nil, errors.Wrap(err, "writeAll interested")
+	}
+	if err := l.awaitUnchoke(first, last); err != nil {
+		return nil, errors.Wrap(err, "awaitUnchoke")
+	}
+
+	pieces, err := l.downloadPieces(info, first, last)
+	if err != nil {
+		return nil, errors.Wrap(err, "downloadPieces")
+	}
+	start := offset - int64(first)*info.PieceLength
+	return &persistence.TorrentText{
+		Path:    file.Path,
+		Content: decodeText(pieces[start : start+file.Size]),
+	}, nil
+}
+
+// awaitUnchoke waits for the peer to unchoke us, and fails if the bitfield of the peer shows that
+// it does not have all the pieces in the (inclusive) range.
+func (l *Leech) awaitUnchoke(first, last int) error {
+	var bitfield []byte
+	for {
+		message, err := l.readMessage()
+		if err != nil {
+			return errors.Wrap(err, "readMessage")
+		}
+		if len(message) == 0 { // keep-alive
+			continue
+		}
+
+		switch message[0] {
+		case msgBitfield:
+			bitfield = message[1:]
+		case msgHave:
+			if len(message) == 5 && bitfield != nil {
+				if piece := int(binary.BigEndian.Uint32(message[1:])); piece/8 < len(bitfield) {
+					bitfield[piece/8] |= 0x80 >> (piece % 8)
+				}
+			}
+		case msgUnchoke:
+			if bitfield == nil {
+				return nil
+			}
+			for piece := first; piece <= last; piece++ {
+				if piece/8 >= len(bitfield) || bitfield[piece/8]&(0x80>>(piece%8)) == 0 {
+					return fmt.Errorf("peer does not have the piece %d", piece)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// downloadPieces requests the pieces in the (inclusive) range from the peer, and returns them
+// concatenated once all are received and verified.
+func (l *Leech) downloadPieces(info *metainfo.Info, first, last int) ([]byte, error) {
+	totalLength := info.TotalLength()
+	pieceLength := func(piece int) int64 {
+		if rest := totalLength - int64(piece)*info.PieceLength; rest < info.PieceLength {
+			return rest
+		}
+		return info.PieceLength
+	}
+	blockLength := func(piece int, begin int64) int64 {
+		if rest := pieceLength(piece) - begin; rest < blockSize {
+			return rest
+		}
+		return blockSize
+	}
+
+	var size int64
+	for piece := first; piece <= last; piece++ {
+		size += pieceLength(piece)
+	}
+	data := make([]byte, size)
+	received := make(map[int64]bool)
+
+	for piece := first; piece <= last; piece++ {
+		for begin := int64(0); begin < pieceLength(piece); begin += blockSize {
+			length := blockLength(piece, begin)
+			request := make([]byte, 17)
+			binary.BigEndian.PutUint32(request[0:], 13)
+			request[4] = msgRequest
+			binary.BigEndian.PutUint32(request[5:], uint32(piece))
+			binary.BigEndian.PutUint32(request[9:], uint32(begin))
+			binary.BigEndian.PutUint32(request[13:], uint32(length))
+			if err := l.writeAll(request); err != nil {
+				return nil, errors.Wrap(err, "writeAll request")
+			}
+		}
+	}
+
+	var nReceived int64
+	for nReceived < size {
+		message, err := l.readMessage()
+		if err != nil {
+			return nil, errors.Wrap(err, "readMessage")
+		}
+		if len(message) == 0 {
+			continue
+		}
+		if message[0] == msgChoke {
+			return nil, fmt.Errorf("choked by the peer")
+		}
+		if message[0] != msgPiece || len(message) < 9 {
+			continue
+		}
+
+		piece := int(binary.BigEndian.Uint32(message[1:]))
+		begin := int64(binary.BigEndian.Uint32(message[5:]))
+		block := message[9:]
+		if piece < first || piece > last || begin%blockSize != 0 || begin >= pieceLength(piece) ||
+			int64(len(block)) != blockLength(piece, begin) {
+			return nil, fmt.Errorf("unrequested block (piece %d, begin %d, length %d)", piece, begin, len(block))
+		}
+		position := int64(piece-first)*info.PieceLength + begin
+		if received[position] {
+			continue
+		}
+		received[position] = true
+		copy(data[position:], block)
+		nReceived += int64(len(block))
+	}
+
+	for piece := first; piece <= last; piece++ {
+		start := int64(piece-first) * info.PieceLength
+		sum := sha1.Sum(data[start : start+pieceLength(piece)])
+		if !bytes.Equal(sum[:], info.Pieces[piece*20:(piece+1)*20]) {
+			return nil, fmt.Errorf("piece %d hash mismatch", piece)
+		}
+	}
+	return data, nil
+}
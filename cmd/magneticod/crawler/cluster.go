@@ -0,0 +1,63 @@
+package crawler
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/dht/mainline"
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// slotInterval is how often the standby crawlers try to acquire a slot of the cluster, and how often
+// the slot that is held is checked.
+const slotInterval = 30 * time.Second
+
+// coordinate partitions the keyspace of the crawler among the size crawlers of the cluster that
+// share the database (see persistence.Database.AcquireSlot), so that they do not fetch the metadata
+// of the same torrents: the crawler that holds the i-th slot crawls the i-th partition of the
+// keyspace (see mainline.Keyspace.Partition), and the ones that hold none stand by until a slot is freed. It returns
+// once the crawler is terminated, releasing its slot.
+func (c *Crawler) coordinate(size int) {
+	defer close(c.coordinated)
+	logger := zap.L().Named("crawler")
+
+	var slot persistence.Slot
+	for {
+		if slot == nil {
+			var err error
+			slot, err = c.database.AcquireSlot(size)
+			if err == persistence.NotImplementedError {
+				logger.Info("The slots of the cluster are not supported by the database, crawling the keyspace in full.")
+				c.trawlingManager.SetKeyspace(c.keyspace)
+				return
+			} else if err != nil {
+				logger.Error("Could not acquire a slot of the cluster!", zap.Error(err))
+			} else if slot != nil {
+				keyspace := c.keyspace.Partition(slot.Index(), size)
+				logger.Info("Acquired a slot of the cluster", zap.Int("slot", slot.Index()),
+					zap.Int("size", size), zap.Stringer("keyspace", keyspace))
+				c.trawlingManager.SetKeyspace(keyspace)
+			}
+		} else if err := slot.Check(); err != nil {
+			logger.Warn("Lost the slot of the cluster, standing by!", zap.Int("slot", slot.Index()), zap.Error(err))
+			c.trawlingManager.SetKeyspace(mainline.Keyspace{})
+			// The slot is released by the database already, or is released as its connection is
+			// closed, hence the error is of no consequence.
+			_ = slot.Release()
+			slot = nil
+			continue
+		}
+
+		select {
+		case <-time.After(slotInterval):
+		case <-c.termination:
+			if slot != nil {
+				if err := slot.Release(); err != nil {
+					logger.Warn("Could not release the slot of the cluster!", zap.Error(err))
+				}
+			}
+			return
+		}
+	}
+}
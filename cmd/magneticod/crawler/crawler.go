@@ -0,0 +1,606 @@
+// Package crawler ties the DHT indexer and the metadata leeches together: the torrents that are
+// discovered on the DHT are leeched unless they are in the database already, and are added to the
+// database once their metadata is fetched.
+//
+// It is used by magneticod, and by magneticow when it is run in the combined mode (i.e. crawling and
+// serving in the same process).
+package crawler
+
+import (
+	"expvar"
+	"net"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/bdecode"
+	"github.com/boramalper/magnetico/cmd/magneticod/bittorrent/metadata"
+	"github.com/boramalper/magnetico/cmd/magneticod/dht"
+	"github.com/boramalper/magnetico/cmd/magneticod/dht/mainline"
+	"github.com/boramalper/magnetico/cmd/magneticod/nat"
+	"github.com/boramalper/magnetico/pkg/geoip"
+	"github.com/boramalper/magnetico/pkg/notify"
+	"github.com/boramalper/magnetico/pkg/persistence"
+	"github.com/boramalper/magnetico/pkg/util"
+)
+
+// trawledStats and fetchedStats are the numbers of the infohashes trawled and the torrents fetched
+// by their sources, served by expvar (see --debug-addr) to evaluate the crawl strategies.
+var (
+	trawledStats = expvar.NewMap("trawled")
+	fetchedStats = expvar.NewMap("fetched")
+)
+
+const (
+	natDiscoveryTimeout = 3 * time.Second
+	// natLifetime is the lifetime of the port mappings, which are renewed halfway through.
+	natLifetime = time.Hour
+
+	// requestsInterval is how often the requests of the users for the torrents are read from the
+	// database, of which at most requestsBatch are looked up each time.
+	requestsInterval = time.Minute
+	requestsBatch    = 16
+	// maxRequestAttempts is the number of the times that a requested infohash is looked up before
+	// the request is given up on.
+	maxRequestAttempts = 10
+
+	// trendingInterval is how often the sightings of the torrents are flushed to the database, and
+	// the trending torrents are ranked anew (see persistence.Database.UpdateTrending).
+	trendingInterval = 10 * time.Minute
+	// sightingsCapacity is the maximum number of the distinct infohashes whose sightings are
+	// counted between the flushes.
+	sightingsCapacity = 100000
+
+	// statsInterval is how often the statistics of the crawler are flushed to the database (see
+	// persistence.Database.AddCrawlerStats), to the hour of the flush.
+	statsInterval = 5 * time.Minute
+)
+
+type Config struct {
+	IndexerAddrs        []string
+	IndexerInterval     time.Duration
+	IndexerMaxNeighbors uint
+	// IndexerResponder is true if the indexers are to respond to the queries of the other nodes
+	// (and store their announces), which increases the announces received.
+	IndexerResponder bool
+	// IndexerStrict is true if the indexers are to drop the messages that are not strictly valid,
+	// rather than tolerating the deviations commonly seen in the wild (see mainline.decodeMessage).
+	IndexerStrict bool
+	// Keyspace is the keyspace of the DHT that the indexers target (see mainline.ParseKeyspace); the
+	// zero Keyspace is the whole keyspace.
+	Keyspace mainline.Keyspace
+
+	LeechMaxN int
+	// TextMaxSize is the maximum size (in bytes) of the .nfo and .txt files that are fetched from
+	// the peers (see persistence.TorrentText); zero disables fetching them.
+	TextMaxSize int
+	// Limits are the guardrails against the pathological torrents (see metadata.Limits).
+	Limits metadata.Limits
+	// FetchWindow is how long the trawled infohashes wait to be fetched (while the leeches are busy),
+	// during which their announces are counted to fetch the most announced ones first.
+	FetchWindow time.Duration
+
+	// DedupeCapacity is the number of the most recently seen infohashes that are remembered (to
+	// not be processed again); zero disables the dedupe.
+	DedupeCapacity int
+	// Claimant is the name of the crawler among the crawlers that share the database, by which the
+	// fetches of the torrents are claimed for ClaimTTL (see persistence.Database.ClaimFetch), lest
+	// they fetch the same torrents; it is empty if the fetches are not claimed.
+	Claimant string
+	ClaimTTL time.Duration
+	// ClusterSize is the number of the crawlers that share the database, among which the Keyspace is
+	// partitioned (see Crawler.coordinate); zero if the keyspace is not partitioned.
+	ClusterSize int
+
+	// NAT is the method to map the ports of the indexers on the router with (see nat.Discover); it
+	// is empty if the ports are not to be mapped.
+	NAT string
+
+	// RecordPath is the path of the file to record the messages received by the indexers to (see
+	// mainline.Recorder); it is empty if not recording.
+	RecordPath string
+	// RecordRate is the maximum number of the messages recorded per second (zero is unlimited).
+	RecordRate uint
+	// RecordAnonymize is true if the addresses in the recording are to be pseudonymized.
+	RecordAnonymize bool
+
+	// SessionPath is the path of the file to save the infohashes that are waiting to be fetched (and
+	// their peers) to, and to resume them from on start (see Crawler.saveSession); it is empty if
+	// the sessions are not resumed.
+	SessionPath string
+
+	// Discoveries is true if the discoveries of the torrents that are fetched are to be recorded
+	// (see persistence.Discovery), with as much of their peers as DiscoveryPeers permits.
+	Discoveries    bool
+	DiscoveryPeers persistence.PeerPrivacy
+	// GeoIP looks up the countries of the peers of the discoveries (see
+	// persistence.Discovery.Country); nil if they are not looked up.
+	GeoIP *geoip.Reader
+
+	// Notifier is notified of the torrents as soon as they are added to the database; nil if no one
+	// is to be notified.
+	Notifier *notify.Notifier
+
+	// Privacy is true if no IP address of the peers (nor of the nodes) is to be persisted, which is
+	// asserted by New (see CheckPrivacy). Scrubbing them off the logs is up to the caller (see
+	// util.NewScrubbingCore).
+	Privacy bool
+}
+
+// CheckPrivacy returns an error if the configuration would persist the IP addresses of the peers (or
+// of the nodes) although Privacy is true.
+func (config Config) CheckPrivacy() error {
+	if !config.Privacy {
+		return nil
+	}
+	if config.RecordPath != "" && !config.RecordAnonymize {
+		return errors.New("the recording must be anonymized in the privacy mode")
+	}
+	if config.Discoveries && config.DiscoveryPeers != persistence.PeerNone {
+		return errors.New("the peers of the discoveries cannot be recorded in the privacy mode")
+	}
+	if config.SessionPath != "" {
+		return errors.New("the session (which has the peers) cannot be saved in the privacy mode")
+	}
+	return nil
+}
+
+type Crawler struct {
+	database        persistence.Database
+	trawlingManager *dht.Manager
+	keyspace        mainline.Keyspace
+	metadataSink    *metadata.Sink
+	scheduler       *scheduler
+	dedupe          *dedupe            // nil if disabled
+	recorder        *mainline.Recorder // nil if not recording
+	sessionPath     string             // empty if the sessions are not resumed
+	// requestsDisabled is true if the database does not support the requests for the torrents.
+	requestsDisabled bool
+	sightings        *sightings // nil if the database does not support the sightings
+	// stats are the statistics of the crawler since the last flush; nil if the database does not
+	// support them.
+	stats *persistence.CrawlerStats
+	// discoveries is true if the discoveries of the torrents are recorded, which is disabled if the
+	// database does not support them.
+	discoveries    bool
+	discoveryPeers persistence.PeerPrivacy
+	geoIP          *geoip.Reader    // nil if the countries of the peers are not looked up
+	notifier       *notify.Notifier // nil if no one is notified of the torrents
+	// textsDisabled is true if the database does not support the texts of the torrents.
+	textsDisabled bool
+	// claimant is empty if the fetches are not claimed, or if the database does not support it.
+	claimant string
+	claimTTL time.Duration
+
+	termination chan interface{}
+	terminated  chan interface{}
+	// natUnmapped is closed once the ports are unmapped; nil if the ports are not mapped.
+	natUnmapped chan interface{}
+	// coordinated is closed once the slot of the cluster is released; nil if not in a cluster.
+	coordinated chan interface{}
+}
+
+// New starts crawling the DHT right away, but the torrents are not fetched until Run is called.
+func New(database persistence.Database, config Config) *Crawler {
+	if err := config.CheckPrivacy(); err != nil {
+		zap.L().Named("crawler").Fatal("Could not guarantee the privacy!", zap.Error(err))
+	}
+	var recorder *mainline.Recorder
+	if config.RecordPath != "" {
+		recorder = openRecording(config.RecordPath, config.RecordRate, config.RecordAnonymize)
+	}
+	mode := bdecode.Lenient
+	if config.IndexerStrict {
+		mode = bdecode.Strict
+	}
+	keyspace := config.Keyspace
+	if keyspace.IsEmpty() {
+		keyspace = mainline.WholeKeyspace
+	}
+	trawlingManager := dht.NewManager(config.IndexerAddrs, config.IndexerInterval, config.IndexerMaxNeighbors,
+		config.IndexerResponder, recorder, mode, keyspace)
+	c := &Crawler{
+		database:        database,
+		recorder:        recorder,
+		trawlingManager: trawlingManager,
+		keyspace:        keyspace,
+		metadataSink:    metadata.NewSink(5*time.Second, config.LeechMaxN, config.TextMaxSize, config.Limits),
+		scheduler:       newScheduler(config.FetchWindow),
+		sightings:       newSightings(sightingsCapacity),
+		stats:           new(persistence.CrawlerStats),
+		discoveries:     config.Discoveries,
+		discoveryPeers:  config.DiscoveryPeers,
+		geoIP:           config.GeoIP,
+		notifier:        config.Notifier,
+		claimant:        config.Claimant,
+		claimTTL:        config.ClaimTTL,
+		sessionPath:     config.SessionPath,
+		termination:     make(chan interface{}),
+		terminated:      make(chan interface{}),
+	}
+	if config.DedupeCapacity > 0 {
+		c.dedupe = newDedupe(config.DedupeCapacity)
+	}
+	if c.sessionPath != "" {
+		if err := c.loadSession(time.Now()); err != nil {
+			zap.L().Named("crawler").Error("Could not resume the session!", zap.String("path", c.sessionPath),
+				zap.Error(err))
+		}
+	}
+	if config.NAT != "" {
+		c.natUnmapped = make(chan interface{})
+		go c.mapPorts(config.NAT)
+	}
+	if config.ClusterSize > 0 {
+		// The crawler stands by until it acquires a slot of the cluster.
+		trawlingManager.SetKeyspace(mainline.Keyspace{})
+		c.coordinated = make(chan interface{})
+		go c.coordinate(config.ClusterSize)
+	}
+	return c
+}
+
+// openRecording starts a recording on the file at path, which is overwritten if it exists.
+func openRecording(path string, rate uint, anonymize bool) *mainline.Recorder {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		zap.L().Named("crawler").Fatal("Could not create the recording!", zap.String("path", path), zap.Error(err))
+	}
+	recorder, err := mainline.NewRecorder(file, rate, anonymize)
+	if err != nil {
+		zap.L().Named("crawler").Fatal("Could not start the recording!", zap.Error(err))
+	}
+	return recorder
+}
+
+// Run is the event loop of the crawler, which returns after Terminate is called.
+func (c *Crawler) Run() {
+	defer close(c.terminated)
+
+	// The leeches that fail do not signal the crawler, hence their slots are checked periodically.
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	requestsTicker := time.NewTicker(requestsInterval)
+	defer requestsTicker.Stop()
+	trendingTicker := time.NewTicker(trendingInterval)
+	defer trendingTicker.Stop()
+	statsTicker := time.NewTicker(statsInterval)
+	defer statsTicker.Stop()
+	sessionTicker := time.NewTicker(sessionInterval)
+	defer sessionTicker.Stop()
+
+	for {
+		select {
+		case result := <-c.trawlingManager.Output():
+			infoHash := result.InfoHash()
+			// The requested infohashes skip the dedupe and the scheduler, as they are few and wanted.
+			if result.Source() == persistence.SourceRequest {
+				zap.L().Named("crawler").Info("Found the peers of a requested torrent!",
+					util.HexField("infoHash", infoHash[:]), zap.Int("peers", len(result.PeerAddrs())))
+				trawledStats.Add(string(result.Source()), 1)
+				c.countTrawled()
+				c.metadataSink.Sink(result)
+				continue
+			}
+			// The sightings are counted regardless of the dedupe, as the torrents that are trawled
+			// over and over again are the most active ones.
+			if c.sightings != nil {
+				c.sightings.add(infoHash)
+			}
+			if c.dedupe != nil && c.dedupe.contains(infoHash) {
+				continue
+			}
+
+			zap.L().Named("crawler").Debug("Trawled!", util.HexField("infoHash", infoHash[:]))
+			trawledStats.Add(string(result.Source()), 1)
+			c.countTrawled()
+			c.scheduler.add(result, time.Now())
+
+		case md := <-c.metadataSink.Drain():
+			if err := c.database.AddNewTorrent(md.InfoHash, md.Name, md.Files, md.Metadata, md.Source); err != nil {
+				zap.L().Named("crawler").Fatal("Could not add new torrent to the database",
+					util.HexField("infohash", md.InfoHash), zap.Error(err))
+			}
+			zap.L().Named("crawler").Info("Fetched!", zap.String("name", md.Name), util.HexField("infoHash", md.InfoHash),
+				zap.String("source", string(md.Source)))
+			fetchedStats.Add(string(md.Source), 1)
+			if c.stats != nil {
+				c.stats.NFetched++
+			}
+			if c.discoveries {
+				c.addDiscovery(md.InfoHash, md.Discovery)
+			}
+			if md.Text != nil && !c.textsDisabled {
+				c.setText(md.InfoHash, *md.Text)
+			}
+			if md.Source == persistence.SourceRequest {
+				c.updateRequest(md.InfoHash, persistence.RequestFetched)
+			}
+			if c.notifier != nil {
+				c.notifier.Notify(notify.NewTorrent(md.InfoHash, md.Name, md.Files, md.Source))
+			}
+
+		case now := <-ticker.C:
+			c.scheduler.expire(now)
+
+		case <-requestsTicker.C:
+			if !c.requestsDisabled {
+				c.lookupRequests()
+			}
+
+		case now := <-trendingTicker.C:
+			if c.sightings != nil {
+				c.updateTrending(now)
+			}
+
+		case now := <-statsTicker.C:
+			if c.stats != nil {
+				c.flushStats(now)
+			}
+
+		case <-sessionTicker.C:
+			if c.sessionPath != "" {
+				c.persistSession()
+			}
+
+		case <-c.termination:
+			c.trawlingManager.Terminate()
+			if c.sessionPath != "" {
+				c.persistSession()
+			}
+			if c.sightings != nil {
+				c.flushSightings(time.Now())
+			}
+			if c.stats != nil {
+				c.flushStats(time.Now())
+			}
+			if c.recorder != nil {
+				if err := c.recorder.Close(); err != nil {
+					zap.L().Named("crawler").Error("Could not close the recording!", zap.Error(err))
+				}
+			}
+			return
+		}
+
+		c.dispatch()
+	}
+}
+
+// dispatch leeches the most announced infohashes that are not in the database already, as long as
+// there are free leech slots.
+func (c *Crawler) dispatch() {
+	for c.metadataSink.Free() > 0 {
+		candidate := c.scheduler.pop()
+		if candidate == nil {
+			return
+		}
+		if c.dedupe != nil && c.dedupe.seen(candidate.infoHash) {
+			continue
+		}
+
+		exists, err := c.database.DoesTorrentExist(candidate.infoHash[:])
+		if err != nil {
+			zap.L().Named("crawler").Fatal("Could not check whether torrent exists!", zap.Error(err))
+		} else if !exists && c.claim(candidate.infoHash) {
+			c.metadataSink.Sink(candidate)
+		}
+	}
+}
+
+// claim claims the fetch of the infohash, and returns true if it is to be fetched: if it is claimed,
+// or if the fetches are not claimed at all. The infohashes are fetched if they cannot be claimed due
+// to an error, as fetching a torrent twice is harmless (see persistence.Database.AddNewTorrent).
+func (c *Crawler) claim(infoHash [20]byte) bool {
+	if c.claimant == "" {
+		return true
+	}
+	claimed, err := c.database.ClaimFetch(infoHash[:], c.claimant, c.claimTTL)
+	if err == persistence.NotImplementedError {
+		zap.L().Named("crawler").Info("The claims of the fetches are not supported by the database, not claiming them.")
+		c.claimant = ""
+		return true
+	} else if err != nil {
+		zap.L().Named("crawler").Error("Could not claim the fetch of the torrent!",
+			util.HexField("infoHash", infoHash[:]), zap.Error(err))
+		return true
+	}
+	if !claimed {
+		dedupeStats.Add("claimedElsewhere", 1)
+	}
+	return claimed
+}
+
+// addDiscovery records the discovery of the torrent, anonymised as configured, along with the
+// country of its peer (which is looked up before the peer is anonymised).
+func (c *Crawler) addDiscovery(infoHash []byte, discovery persistence.Discovery) {
+	if c.geoIP != nil && discovery.PeerIP != nil {
+		country, err := c.geoIP.Country(discovery.PeerIP)
+		if err != nil {
+			zap.L().Named("crawler").Debug("Could not look the country of the peer up!", zap.Error(err))
+		}
+		discovery.Country = country
+	}
+	err := c.database.AddDiscovery(infoHash, discovery.Anonymise(c.discoveryPeers))
+	if err == persistence.NotImplementedError {
+		zap.L().Named("crawler").Info("The discoveries are not supported by the database, not recording them.")
+		c.discoveries = false
+	} else if err != nil {
+		zap.L().Named("crawler").Error("Could not add the discovery of the torrent!",
+			util.HexField("infoHash", infoHash), zap.Error(err))
+	}
+}
+
+// setText stores the text of the torrent.
+func (c *Crawler) setText(infoHash []byte, text persistence.TorrentText) {
+	err := c.database.SetText(infoHash, text)
+	if err == persistence.NotImplementedError {
+		zap.L().Named("crawler").Info("The texts are not supported by the database, not storing them.")
+		c.textsDisabled = true
+	} else if err != nil {
+		zap.L().Named("crawler").Error("Could not set the text of the torrent!",
+			util.HexField("infoHash", infoHash), zap.Error(err))
+	}
+}
+
+// lookupRequests looks up the infohashes that are requested by the users (see
+// persistence.TorrentRequest) on the DHT, and updates the status of their requests.
+func (c *Crawler) lookupRequests() {
+	requests, err := c.database.GetPendingTorrentRequests(requestsBatch)
+	if err == persistence.NotImplementedError {
+		zap.L().Named("crawler").Info("The requests for the torrents are not supported by the database, ignoring them.")
+		c.requestsDisabled = true
+		return
+	} else if err != nil {
+		zap.L().Named("crawler").Error("Could not get the requests for the torrents!", zap.Error(err))
+		return
+	}
+
+	for _, request := range requests {
+		exists, err := c.database.DoesTorrentExist(request.InfoHash)
+		if err != nil {
+			zap.L().Named("crawler").Error("Could not check whether torrent exists!", zap.Error(err))
+			continue
+		}
+
+		if exists {
+			c.updateRequest(request.InfoHash, persistence.RequestFetched)
+		} else if request.Attempts >= maxRequestAttempts {
+			zap.L().Named("crawler").Info("Gave up on a requested torrent",
+				util.HexField("infoHash", request.InfoHash), zap.Uint("attempts", request.Attempts))
+			c.updateRequest(request.InfoHash, persistence.RequestFailed)
+		} else {
+			var infoHash [20]byte
+			copy(infoHash[:], request.InfoHash)
+			zap.L().Named("crawler").Debug("Looking up a requested torrent...", util.HexField("infoHash", infoHash[:]))
+			c.updateRequest(request.InfoHash, persistence.RequestLookingUp)
+			c.trawlingManager.Lookup(infoHash)
+		}
+	}
+}
+
+// updateTrending flushes the sightings of the torrents to the database, and ranks the trending
+// torrents anew.
+func (c *Crawler) updateTrending(now time.Time) {
+	if !c.flushSightings(now) {
+		return
+	}
+	if err := c.database.UpdateTrending(now.Add(-persistence.TrendingWindow).Unix()); err != nil {
+		zap.L().Named("crawler").Error("Could not update the trending torrents!", zap.Error(err))
+	}
+}
+
+// flushSightings flushes the sightings of the torrents to the database, and returns false if they
+// are not supported by the database (in which case they are not counted anymore).
+func (c *Crawler) flushSightings(now time.Time) bool {
+	err := c.database.AddSightings(c.sightings.flush(), now.Unix())
+	if err == persistence.NotImplementedError {
+		zap.L().Named("crawler").Info("The sightings of the torrents are not supported by the database, ignoring them.")
+		c.sightings = nil
+		return false
+	} else if err != nil {
+		zap.L().Named("crawler").Error("Could not add the sightings of the torrents!", zap.Error(err))
+	}
+	return true
+}
+
+func (c *Crawler) countTrawled() {
+	if c.stats != nil {
+		c.stats.NTrawled++
+	}
+}
+
+// flushStats adds the statistics of the crawler since the last flush to the ones of the hour of now
+// in the database.
+func (c *Crawler) flushStats(now time.Time) {
+	stats := *c.stats
+	stats.Hour = now.Unix()
+	err := c.database.AddCrawlerStats(stats)
+	if err == persistence.NotImplementedError {
+		zap.L().Named("crawler").Info("The statistics of the crawler are not supported by the database, not storing them.")
+		c.stats = nil
+		return
+	} else if err != nil {
+		// The statistics are kept to be flushed the next time.
+		zap.L().Named("crawler").Error("Could not add the statistics of the crawler!", zap.Error(err))
+		return
+	}
+	*c.stats = persistence.CrawlerStats{}
+}
+
+func (c *Crawler) updateRequest(infoHash []byte, status persistence.RequestStatus) {
+	if err := c.database.UpdateTorrentRequest(infoHash, status); err != nil && err != persistence.NotImplementedError {
+		zap.L().Named("crawler").Error("Could not update the request for the torrent!",
+			util.HexField("infoHash", infoHash), zap.String("status", string(status)), zap.Error(err))
+	}
+}
+
+// Terminate stops the crawler, and waits for Run to return so that the database can be closed
+// safely afterwards.
+func (c *Crawler) Terminate() {
+	close(c.termination)
+	<-c.terminated
+	if c.natUnmapped != nil {
+		<-c.natUnmapped
+	}
+	if c.coordinated != nil {
+		<-c.coordinated
+	}
+}
+
+// mapPorts maps the ports of the indexers on the router, and keeps renewing the mappings until the
+// crawler is terminated, when they are deleted.
+func (c *Crawler) mapPorts(method string) {
+	defer close(c.natUnmapped)
+	logger := zap.L().Named("crawler")
+
+	mapper, err := nat.Discover(method, natDiscoveryTimeout)
+	if err != nil {
+		logger.Warn("Could not discover the router to map the ports on!", zap.Error(err))
+		return
+	}
+	if ip, err := mapper.ExternalIP(); err == nil {
+		logger.Info("Discovered the router", zap.String("protocol", mapper.Name()),
+			zap.String("externalIP", ip.String()))
+	}
+
+	mappings := make(map[int]int) // internal port -> external port
+	for {
+		for _, addr := range c.trawlingManager.LocalAddrs() {
+			externalPort, err := mapper.AddPortMapping("udp", addr.Port, "magnetico", natLifetime)
+			if err != nil {
+				logger.Warn("Could not map the port!", zap.Int("port", addr.Port), zap.Error(err))
+				continue
+			}
+			if _, ok := mappings[addr.Port]; !ok {
+				logger.Info("Mapped the port", zap.Int("port", addr.Port), zap.Int("externalPort", externalPort))
+			}
+			mappings[addr.Port] = externalPort
+		}
+
+		select {
+		case <-time.After(natLifetime / 2):
+		case <-c.termination:
+			for internalPort, externalPort := range mappings {
+				if err := mapper.DeletePortMapping("udp", internalPort, externalPort); err != nil {
+					logger.Warn("Could not unmap the port!", zap.Int("port", internalPort), zap.Error(err))
+				}
+			}
+			return
+		}
+	}
+}
+
+// CheckAddrs checks if the indexer addresses are valid.
+func CheckAddrs(addrs []string) error {
+	for i, addr := range addrs {
+		// We are using ResolveUDPAddr but it works equally well for checking TCPAddr(esses) as
+		// well.
+		_, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return errors.Wrapf(err, "%d(th) address (%s) error", i+1, addr)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+func TestCheckPrivacy(t *testing.T) {
+	for i, instance := range []struct {
+		config Config
+		valid  bool
+	}{
+		{Config{RecordPath: "dht.rec", Discoveries: true, DiscoveryPeers: persistence.PeerFull}, true},
+		{Config{Privacy: true}, true},
+		{Config{Privacy: true, RecordPath: "dht.rec", RecordAnonymize: true}, true},
+		{Config{Privacy: true, RecordPath: "dht.rec"}, false},
+		{Config{Privacy: true, Discoveries: true}, true},
+		{Config{Privacy: true, Discoveries: true, DiscoveryPeers: persistence.PeerSubnet}, false},
+		{Config{Privacy: true, DiscoveryPeers: persistence.PeerFull}, true}, // not recording at all
+		{Config{Privacy: true, SessionPath: "session.json"}, false},
+	} {
+		if err := instance.config.CheckPrivacy(); (err == nil) != instance.valid {
+			t.Errorf("Instance #%d is wrong! Got %v (expected valid: %t)", i+1, err, instance.valid)
+		}
+	}
+}
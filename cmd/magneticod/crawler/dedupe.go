@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"container/list"
+	"expvar"
+)
+
+// dedupeStats are the statistics of the dedupe stage, served by expvar (see --debug-addr).
+var dedupeStats = expvar.NewMap("dedupe")
+
+func init() {
+	dedupeStats.Set("hitRate", expvar.Func(func() interface{} {
+		hits, misses := expvarInt(dedupeStats.Get("hits")), expvarInt(dedupeStats.Get("misses"))
+		if hits+misses == 0 {
+			return 0.0
+		}
+		return float64(hits) / float64(hits+misses)
+	}))
+}
+
+func expvarInt(v expvar.Var) int64 {
+	if i, ok := v.(*expvar.Int); ok {
+		return i.Value()
+	}
+	return 0
+}
+
+// dedupe remembers the most recently seen infohashes (up to its capacity), so that the infohashes
+// that are trawled over and over again are not checked against the database and leeched each
+// time. It is not safe for concurrent use.
+type dedupe struct {
+	capacity int
+	// order is the infohashes from the most recently seen to the least.
+	order    *list.List
+	elements map[[20]byte]*list.Element
+}
+
+func newDedupe(capacity int) *dedupe {
+	return &dedupe{
+		capacity: capacity,
+		order:    list.New(),
+		elements: make(map[[20]byte]*list.Element, capacity),
+	}
+}
+
+// contains returns true if the infohash is seen recently, without remembering it otherwise (e.g.
+// while it is waiting to be fetched).
+func (d *dedupe) contains(infoHash [20]byte) bool {
+	element, ok := d.elements[infoHash]
+	if ok {
+		d.order.MoveToFront(element)
+		dedupeStats.Add("hits", 1)
+	}
+	return ok
+}
+
+// seen returns true if the infohash is seen recently, and remembers it as the most recently seen
+// one in either case.
+func (d *dedupe) seen(infoHash [20]byte) bool {
+	if element, ok := d.elements[infoHash]; ok {
+		d.order.MoveToFront(element)
+		dedupeStats.Add("hits", 1)
+		return true
+	}
+	dedupeStats.Add("misses", 1)
+
+	if d.order.Len() >= d.capacity {
+		oldest := d.order.Back()
+		delete(d.elements, oldest.Value.([20]byte))
+		d.order.Remove(oldest)
+	}
+	d.elements[infoHash] = d.order.PushFront(infoHash)
+	return false
+}
@@ -0,0 +1,29 @@
+package crawler
+
+import "testing"
+
+func TestDedupe(t *testing.T) {
+	d := newDedupe(2)
+	a, b, c := [20]byte{'a'}, [20]byte{'b'}, [20]byte{'c'}
+
+	for i, instance := range []struct {
+		infoHash [20]byte
+		seen     bool
+	}{
+		{a, false},
+		{b, false},
+		{a, true},
+		{c, false}, // evicts b, the least recently seen
+		{b, false}, // evicts a
+		{c, true},
+		{a, false},
+	} {
+		if seen := d.seen(instance.infoHash); seen != instance.seen {
+			t.Errorf("Instance #%d is wrong! Got %t (expected %t)", i+1, seen, instance.seen)
+		}
+	}
+
+	if len(d.elements) != 2 || d.order.Len() != 2 {
+		t.Errorf("Dedupe should not grow beyond its capacity (got %d)", d.order.Len())
+	}
+}
@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"encoding/hex"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/dht/mainline"
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// ReplayStatistics are the statistics of a replay, for benchmarking the persistence.
+type ReplayStatistics struct {
+	mainline.ReplayStatistics
+	// NDuplicates is the number of the infohashes that are skipped by the dedupe, or that are in
+	// the database already.
+	NDuplicates uint64
+	NAdded      uint64
+	Elapsed     time.Duration
+}
+
+// Replay replays the recorded DHT messages (see mainline.Replay) through the dedupe and into the
+// database, deterministically and without touching the network. Since the metadata cannot be
+// fetched, a placeholder torrent (with a single file of one byte, named after its infohash) is
+// added for each infohash; hence the database must be a scratch one.
+func Replay(database persistence.Database, r io.Reader, dedupeCapacity int) (*ReplayStatistics, error) {
+	stats := new(ReplayStatistics)
+	var d *dedupe
+	if dedupeCapacity > 0 {
+		d = newDedupe(dedupeCapacity)
+	}
+
+	var err error
+	startedOn := time.Now()
+	replayStats, replayErr := mainline.Replay(r, func(result mainline.IndexingResult) {
+		infoHash := result.InfoHash()
+		if err != nil {
+			return
+		}
+		if d != nil && d.seen(infoHash) {
+			stats.NDuplicates++
+			return
+		}
+
+		var exists bool
+		if exists, err = database.DoesTorrentExist(infoHash[:]); err != nil {
+			err = errors.Wrap(err, "DoesTorrentExist")
+			return
+		} else if exists {
+			stats.NDuplicates++
+			return
+		}
+
+		name := hex.EncodeToString(infoHash[:])
+		if err = database.AddNewTorrent(infoHash[:], name, []persistence.File{{Size: 1, Path: name}}, []byte{},
+			result.Source()); err != nil {
+			err = errors.Wrap(err, "AddNewTorrent")
+			return
+		}
+		stats.NAdded++
+	})
+	stats.Elapsed = time.Since(startedOn)
+	if replayStats != nil {
+		stats.ReplayStatistics = *replayStats
+	}
+
+	if replayErr != nil {
+		return stats, replayErr
+	}
+	return stats, err
+}
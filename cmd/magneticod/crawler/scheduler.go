@@ -0,0 +1,184 @@
+package crawler
+
+import (
+	"container/heap"
+	"expvar"
+	"net"
+	"time"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/dht"
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// schedulerStats are the statistics of the fetch scheduler, served by expvar (see --debug-addr).
+var schedulerStats = expvar.NewMap("scheduler")
+
+const (
+	// schedulerInterval is how often the expired infohashes are dropped, and the free leech slots
+	// are filled.
+	schedulerInterval = 250 * time.Millisecond
+	// maxPendingFetches is the maximum number of the infohashes waiting to be fetched; the newly
+	// trawled infohashes are ignored until some of them are fetched or expired.
+	maxPendingFetches = 10000
+	// maxCandidatePeers is the maximum number of the peers collected for an infohash.
+	maxCandidatePeers = 16
+)
+
+// candidate is an infohash waiting to be fetched, along with the peers that announced it.
+type candidate struct {
+	infoHash   [20]byte
+	peerAddrs  []net.TCPAddr
+	nAnnounces int
+	firstSeen  time.Time
+	// queuedOn is when the window of the infohash started, which is when it was first seen unless
+	// it is resumed (see scheduler.resume).
+	queuedOn time.Time
+	// source is the source of the first result of the infohash.
+	source persistence.Source
+	index  int // in the heap
+}
+
+func (c *candidate) InfoHash() [20]byte {
+	return c.infoHash
+}
+
+func (c *candidate) PeerAddrs() []net.TCPAddr {
+	return c.peerAddrs
+}
+
+func (c *candidate) Source() persistence.Source {
+	return c.source
+}
+
+// FirstSeen returns when the infohash was first trawled (see metadata.Metadata.Discovery).
+func (c *candidate) FirstSeen() time.Time {
+	return c.firstSeen
+}
+
+// scheduler prioritises the fetches of the infohashes by the number of times they are announced
+// within a window (since they are first seen), for the infohashes announced by many peers are
+// both more valuable and easier to fetch. The infohashes that could not be fetched within the
+// window are dropped. It is not safe for concurrent use.
+type scheduler struct {
+	window  time.Duration
+	pending map[[20]byte]*candidate
+	queue   candidateHeap
+}
+
+func newScheduler(window time.Duration) *scheduler {
+	return &scheduler{
+		window:  window,
+		pending: make(map[[20]byte]*candidate),
+	}
+}
+
+func (s *scheduler) add(result dht.Result, now time.Time) {
+	c, ok := s.pending[result.InfoHash()]
+	if !ok {
+		if len(s.pending) >= maxPendingFetches {
+			schedulerStats.Add("ignored", 1)
+			return
+		}
+		c = &candidate{infoHash: result.InfoHash(), firstSeen: now, queuedOn: now, source: result.Source()}
+		s.pending[c.infoHash] = c
+		heap.Push(&s.queue, c)
+	}
+
+	c.nAnnounces++
+	for _, peerAddr := range result.PeerAddrs() {
+		if len(c.peerAddrs) >= maxCandidatePeers {
+			break
+		}
+		if !containsAddr(c.peerAddrs, peerAddr) {
+			c.peerAddrs = append(c.peerAddrs, peerAddr)
+		}
+	}
+	heap.Fix(&s.queue, c.index)
+}
+
+// resume queues the candidate of a previous session anew, whose window starts now. It is ignored if
+// the infohash is pending already.
+func (s *scheduler) resume(c *candidate, now time.Time) {
+	if _, ok := s.pending[c.infoHash]; ok {
+		return
+	} else if len(s.pending) >= maxPendingFetches {
+		schedulerStats.Add("ignored", 1)
+		return
+	}
+	c.queuedOn = now
+	s.pending[c.infoHash] = c
+	heap.Push(&s.queue, c)
+	schedulerStats.Add("resumed", 1)
+}
+
+// candidates returns the infohashes waiting to be fetched, in no particular order.
+func (s *scheduler) candidates() []*candidate {
+	candidates := make([]*candidate, 0, len(s.pending))
+	for _, c := range s.pending {
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+// pop returns the most announced infohash (the earliest seen one among the equals), or nil if
+// there is none.
+func (s *scheduler) pop() *candidate {
+	if s.queue.Len() == 0 {
+		return nil
+	}
+	c := heap.Pop(&s.queue).(*candidate)
+	delete(s.pending, c.infoHash)
+	schedulerStats.Add("dispatched", 1)
+	return c
+}
+
+// expire drops the infohashes whose window has passed.
+func (s *scheduler) expire(now time.Time) {
+	for infoHash, c := range s.pending {
+		if now.Sub(c.queuedOn) > s.window {
+			heap.Remove(&s.queue, c.index)
+			delete(s.pending, infoHash)
+			schedulerStats.Add("expired", 1)
+		}
+	}
+}
+
+func containsAddr(addrs []net.TCPAddr, addr net.TCPAddr) bool {
+	for _, a := range addrs {
+		if a.Port == addr.Port && a.IP.Equal(addr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidateHeap implements heap.Interface, where the most announced candidate is at the top.
+type candidateHeap []*candidate
+
+func (h candidateHeap) Len() int { return len(h) }
+
+func (h candidateHeap) Less(i, j int) bool {
+	if h[i].nAnnounces != h[j].nAnnounces {
+		return h[i].nAnnounces > h[j].nAnnounces
+	}
+	return h[i].firstSeen.Before(h[j].firstSeen)
+}
+
+func (h candidateHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *candidateHeap) Push(x interface{}) {
+	c := x.(*candidate)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *candidateHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+type testResult struct {
+	infoHash  [20]byte
+	peerAddrs []net.TCPAddr
+}
+
+func (r testResult) InfoHash() [20]byte         { return r.infoHash }
+func (r testResult) PeerAddrs() []net.TCPAddr   { return r.peerAddrs }
+func (r testResult) Source() persistence.Source { return persistence.SourceSample }
+
+func TestScheduler(t *testing.T) {
+	s := newScheduler(time.Minute)
+	now := time.Now()
+	a, b, c := [20]byte{'a'}, [20]byte{'b'}, [20]byte{'c'}
+	peer1 := net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6881}
+	peer2 := net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 6881}
+
+	s.add(testResult{a, []net.TCPAddr{peer1}}, now)
+	s.add(testResult{b, []net.TCPAddr{peer1}}, now)
+	s.add(testResult{c, []net.TCPAddr{peer1}}, now)
+	s.add(testResult{b, []net.TCPAddr{peer1, peer2}}, now)
+	s.add(testResult{b, []net.TCPAddr{peer2}}, now)
+	s.add(testResult{c, []net.TCPAddr{peer2}}, now)
+
+	for i, expected := range []struct {
+		infoHash [20]byte
+		nPeers   int
+	}{
+		{b, 2}, // announced thrice
+		{c, 2}, // announced twice
+		{a, 1},
+	} {
+		candidate := s.pop()
+		if candidate == nil {
+			t.Fatalf("Candidate #%d is missing!", i+1)
+		}
+		if candidate.infoHash != expected.infoHash {
+			t.Errorf("Candidate #%d is wrong! Got %c (expected %c)", i+1, candidate.infoHash[0], expected.infoHash[0])
+		}
+		if len(candidate.peerAddrs) != expected.nPeers {
+			t.Errorf("Peers of the candidate #%d are wrong! Got %d (expected %d)", i+1, len(candidate.peerAddrs), expected.nPeers)
+		}
+	}
+	if s.pop() != nil {
+		t.Errorf("Scheduler should have been empty")
+	}
+
+	s.add(testResult{a, []net.TCPAddr{peer1}}, now)
+	s.add(testResult{b, []net.TCPAddr{peer1}}, now.Add(time.Minute))
+	s.expire(now.Add(time.Minute + time.Second))
+	if candidate := s.pop(); candidate == nil || candidate.infoHash != b {
+		t.Errorf("Only the infohashes whose window has passed should have expired")
+	}
+	if s.pop() != nil {
+		t.Errorf("Expired infohashes should have been dropped")
+	}
+}
@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+const (
+	// sessionInterval is how often the session is saved, besides on exit, lest it is lost if the
+	// crawler crashes.
+	sessionInterval = time.Minute
+	// sessionMaxAge is the age beyond which the infohashes of a session are not resumed, as their
+	// peers are likely gone.
+	sessionMaxAge = 6 * time.Hour
+)
+
+// sessionEntry is an infohash waiting to be fetched (or being fetched) in a session, as saved to
+// the session file (in JSON).
+type sessionEntry struct {
+	InfoHash   string             `json:"infoHash"`
+	Peers      []string           `json:"peers"`
+	NAnnounces int                `json:"nAnnounces"`
+	FirstSeen  int64              `json:"firstSeen"`
+	Source     persistence.Source `json:"source"`
+}
+
+// persistSession saves the session (see saveSession), logging the errors.
+func (c *Crawler) persistSession() {
+	if err := c.saveSession(); err != nil {
+		zap.L().Named("crawler").Error("Could not save the session!", zap.String("path", c.sessionPath),
+			zap.Error(err))
+	}
+}
+
+// saveSession saves the infohashes that are waiting to be fetched and the ones that are being
+// fetched to the session file, atomically (by renaming a temporary file over it).
+func (c *Crawler) saveSession() error {
+	candidates := c.scheduler.candidates()
+	incoming := c.metadataSink.Incoming()
+	entries := make([]sessionEntry, 0, len(candidates)+len(incoming))
+	for _, in := range incoming {
+		entries = append(entries, newSessionEntry(in.InfoHash, in.PeerAddrs, 1, in.FirstSeen, in.Source))
+	}
+	for _, candidate := range candidates {
+		entries = append(entries, newSessionEntry(candidate.infoHash, candidate.peerAddrs, candidate.nAnnounces,
+			candidate.firstSeen, candidate.source))
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+	temporary := c.sessionPath + ".tmp"
+	if err = ioutil.WriteFile(temporary, data, 0600); err != nil {
+		return errors.Wrap(err, "ioutil.WriteFile")
+	}
+	return errors.Wrap(os.Rename(temporary, c.sessionPath), "os.Rename")
+}
+
+func newSessionEntry(infoHash [20]byte, peerAddrs []net.TCPAddr, nAnnounces int, firstSeen time.Time,
+	source persistence.Source) sessionEntry {
+	peers := make([]string, len(peerAddrs))
+	for i, peerAddr := range peerAddrs {
+		peers[i] = peerAddr.String()
+	}
+	return sessionEntry{
+		InfoHash:   hex.EncodeToString(infoHash[:]),
+		Peers:      peers,
+		NAnnounces: nAnnounces,
+		FirstSeen:  firstSeen.Unix(),
+		Source:     source,
+	}
+}
+
+// loadSession resumes the infohashes of the session file (see saveSession) that have peers, and
+// that are not older than sessionMaxAge. A missing session file is no error, as it is of the first
+// session.
+func (c *Crawler) loadSession(now time.Time) error {
+	data, err := ioutil.ReadFile(c.sessionPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "ioutil.ReadFile")
+	}
+	var entries []sessionEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return errors.Wrap(err, "json.Unmarshal")
+	}
+
+	nResumed := 0
+	for _, entry := range entries {
+		if candidate := entry.candidate(); candidate != nil && now.Sub(candidate.firstSeen) <= sessionMaxAge {
+			c.scheduler.resume(candidate, now)
+			nResumed++
+		}
+	}
+	zap.L().Named("crawler").Info("Resumed the session", zap.Int("infoHashes", nResumed),
+		zap.Int("dropped", len(entries)-nResumed))
+	return nil
+}
+
+// candidate returns the candidate of the entry, or nil if the entry is invalid or has no peers.
+func (entry sessionEntry) candidate() *candidate {
+	infoHash, err := hex.DecodeString(entry.InfoHash)
+	if err != nil || len(infoHash) != 20 {
+		return nil
+	}
+	c := &candidate{
+		nAnnounces: entry.NAnnounces,
+		firstSeen:  time.Unix(entry.FirstSeen, 0),
+		source:     entry.Source,
+	}
+	copy(c.infoHash[:], infoHash)
+	for _, peer := range entry.Peers {
+		if addr, err := net.ResolveTCPAddr("tcp", peer); err == nil && addr.IP != nil {
+			c.peerAddrs = append(c.peerAddrs, *addr)
+		}
+	}
+	if len(c.peerAddrs) == 0 {
+		return nil
+	}
+	return c
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/bittorrent/metadata"
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+func TestSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "magnetico-session")
+	if err != nil {
+		t.Fatalf("Could not create the temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Unix(1600000000, 0)
+	peer := net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 6881}
+	newCrawler := func() *Crawler {
+		return &Crawler{
+			scheduler:    newScheduler(time.Minute),
+			metadataSink: metadata.NewSink(time.Second, 1, 0, metadata.Limits{}),
+			sessionPath:  path.Join(dir, "session.json"),
+		}
+	}
+
+	saved := newCrawler()
+	saved.scheduler.add(testResult{[20]byte{1}, []net.TCPAddr{peer}}, now)
+	saved.scheduler.add(testResult{[20]byte{1}, nil}, now)
+	saved.scheduler.add(testResult{[20]byte{2}, []net.TCPAddr{peer}}, now.Add(-sessionMaxAge)) // too old
+	saved.scheduler.add(testResult{[20]byte{3}, nil}, now)                                     // with no peers
+	if err = saved.saveSession(); err != nil {
+		t.Fatalf("Could not save the session: %s", err.Error())
+	}
+
+	// The window of the resumed infohashes starts anew.
+	later := now.Add(time.Hour)
+	resumed := newCrawler()
+	if err = resumed.loadSession(later); err != nil {
+		t.Fatalf("Could not load the session: %s", err.Error())
+	}
+	resumed.scheduler.expire(later.Add(30 * time.Second))
+	candidates := resumed.scheduler.candidates()
+	if len(candidates) != 1 {
+		t.Fatalf("The number of the resumed infohashes is wrong! Got %d (expected 1)", len(candidates))
+	}
+	c := candidates[0]
+	if c.infoHash != [20]byte{1} || c.nAnnounces != 2 || !c.firstSeen.Equal(now) ||
+		c.source != persistence.SourceSample || len(c.peerAddrs) != 1 || !c.peerAddrs[0].IP.Equal(peer.IP) {
+		t.Errorf("The resumed infohash is wrong! Got %+v", c)
+	}
+
+	// A missing session file is of the first session.
+	first := newCrawler()
+	first.sessionPath = path.Join(dir, "missing.json")
+	if err = first.loadSession(now); err != nil {
+		t.Errorf("Could not load the missing session: %s", err.Error())
+	}
+}
@@ -0,0 +1,42 @@
+package crawler
+
+import (
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// sightings counts the times that the infohashes are trawled between the flushes to the database
+// (see persistence.Database.AddSightings), of at most capacity distinct infohashes lest a flood of
+// them exhausts the memory; the infohashes beyond the capacity are not counted until the next
+// flush. It is not safe for concurrent use.
+type sightings struct {
+	capacity int
+	counts   map[[20]byte]uint
+}
+
+func newSightings(capacity int) *sightings {
+	return &sightings{
+		capacity: capacity,
+		counts:   make(map[[20]byte]uint),
+	}
+}
+
+// add counts a sighting of the infohash, and returns false if it is not counted as the capacity is
+// reached.
+func (s *sightings) add(infoHash [20]byte) bool {
+	if _, ok := s.counts[infoHash]; !ok && len(s.counts) >= s.capacity {
+		return false
+	}
+	s.counts[infoHash]++
+	return true
+}
+
+// flush returns the sightings counted since the last flush, and starts counting anew.
+func (s *sightings) flush() []persistence.Sighting {
+	flushed := make([]persistence.Sighting, 0, len(s.counts))
+	for infoHash, count := range s.counts {
+		infoHash := infoHash
+		flushed = append(flushed, persistence.Sighting{InfoHash: infoHash[:], Count: count})
+	}
+	s.counts = make(map[[20]byte]uint)
+	return flushed
+}
@@ -0,0 +1,40 @@
+package crawler
+
+import "testing"
+
+func TestSightings(t *testing.T) {
+	s := newSightings(2)
+	a, b, c := [20]byte{'a'}, [20]byte{'b'}, [20]byte{'c'}
+
+	for i, instance := range []struct {
+		infoHash [20]byte
+		counted  bool
+	}{
+		{a, true},
+		{b, true},
+		{a, true},
+		{c, false}, // the capacity is reached
+		{b, true},
+	} {
+		if counted := s.add(instance.infoHash); counted != instance.counted {
+			t.Errorf("Instance #%d is wrong! Got %t (expected %t)", i+1, counted, instance.counted)
+		}
+	}
+
+	counts := make(map[[20]byte]uint)
+	for _, sighting := range s.flush() {
+		var infoHash [20]byte
+		copy(infoHash[:], sighting.InfoHash)
+		counts[infoHash] = sighting.Count
+	}
+	if len(counts) != 2 || counts[a] != 2 || counts[b] != 2 {
+		t.Errorf("Flushed sightings are wrong! Got %v", counts)
+	}
+
+	if len(s.flush()) != 0 {
+		t.Error("Sightings should be counted anew after a flush")
+	}
+	if !s.add(c) {
+		t.Error("Sightings should not be at capacity after a flush")
+	}
+}
@@ -1,12 +1,15 @@
 package mainline
 
 import (
-	"math/rand"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/bdecode"
+	"github.com/boramalper/magnetico/pkg/persistence"
 )
 
 type IndexingService struct {
@@ -25,8 +28,21 @@ type IndexingService struct {
 	routingTableMutex sync.RWMutex
 	maxNeighbors      uint
 
+	// getPeersMutex guards counter, getPeersRequests and lookups, as the lookups are started by
+	// the crawler (whereas the rest is run by the protocol).
+	getPeersMutex    sync.Mutex
 	counter          uint16
 	getPeersRequests map[[2]byte][20]byte // GetPeersQuery.`t` -> infohash
+	lookups          map[[20]byte]*lookup
+
+	// peerStore is nil unless in the responder mode.
+	peerStore *peerStore
+
+	// keyspace is the Keyspace of the infohashes that are sampled and announced, which is set by
+	// the crawler (see SetKeyspace).
+	keyspace atomic.Value
+
+	logger *zap.Logger
 }
 
 type IndexingServiceEventHandlers struct {
@@ -36,6 +52,7 @@ type IndexingServiceEventHandlers struct {
 type IndexingResult struct {
 	infoHash  [20]byte
 	peerAddrs []net.TCPAddr
+	source    persistence.Source
 }
 
 func (ir IndexingResult) InfoHash() [20]byte {
@@ -46,37 +63,81 @@ func (ir IndexingResult) PeerAddrs() []net.TCPAddr {
 	return ir.peerAddrs
 }
 
-func NewIndexingService(laddr string, interval time.Duration, maxNeighbors uint, eventHandlers IndexingServiceEventHandlers) *IndexingService {
+func (ir IndexingResult) Source() persistence.Source {
+	return ir.source
+}
+
+// NewIndexingService creates an indexing service, which also responds to the queries of the other
+// nodes (storing their announces) if responder is true. recorder records the messages received, and
+// is nil if not recording; mode is the strictness of the decoding of the messages received; keyspace
+// is the keyspace that it targets (see SetKeyspace), where its node ID is if it is a responder.
+func NewIndexingService(laddr string, interval time.Duration, maxNeighbors uint, responder bool, recorder *Recorder, mode bdecode.Mode, keyspace Keyspace, eventHandlers IndexingServiceEventHandlers) *IndexingService {
 	service := new(IndexingService)
+	service.logger = zap.L().Named("dht")
 	service.interval = interval
-	service.protocol = NewProtocol(
-		laddr,
-		ProtocolEventHandlers{
-			OnFindNodeResponse:         service.onFindNodeResponse,
-			OnGetPeersResponse:         service.onGetPeersResponse,
-			OnSampleInfohashesResponse: service.onSampleInfohashesResponse,
-		},
-	)
+	protocolEventHandlers := ProtocolEventHandlers{
+		OnFindNodeResponse:         service.onFindNodeResponse,
+		OnGetPeersResponse:         service.onGetPeersResponse,
+		OnSampleInfohashesResponse: service.onSampleInfohashesResponse,
+	}
 	service.nodeID = make([]byte, 20)
+	if responder {
+		protocolEventHandlers.OnPingQuery = service.onPingQuery
+		protocolEventHandlers.OnFindNodeQuery = service.onFindNodeQuery
+		protocolEventHandlers.OnGetPeersQuery = service.onGetPeersQuery
+		protocolEventHandlers.OnAnnouncePeerQuery = service.onAnnouncePeerQuery
+		service.peerStore = newPeerStore()
+		// The other nodes would not keep a node whose ID is all zeros in their routing tables, and
+		// route the announces of the infohashes that are close to its ID to it.
+		service.nodeID = keyspace.randomKey()
+	}
+	service.protocol = NewProtocol(laddr, protocolEventHandlers)
+	service.protocol.transport.recorder = recorder
+	service.protocol.transport.mode = mode
 	service.routingTable = make(map[string]*net.UDPAddr)
 	service.maxNeighbors = maxNeighbors
 	service.eventHandlers = eventHandlers
 
 	service.getPeersRequests = make(map[[2]byte][20]byte)
+	service.lookups = make(map[[20]byte]*lookup)
+	service.keyspace.Store(keyspace)
 
 	return service
 }
 
+// SetKeyspace sets the keyspace of the infohashes that are sampled and announced, whose peers are
+// looked up (for the metadata of the torrents to be fetched); the rest are ignored. The infohashes
+// that are looked up by the crawler (see Lookup) are not filtered.
+//
+// The nodes are also sampled by the targets in the keyspace, so that the routing table leans
+// towards the nodes whose IDs are in (or close to) it, which store more of its infohashes.
+func (is *IndexingService) SetKeyspace(keyspace Keyspace) {
+	is.keyspace.Store(keyspace)
+}
+
+func (is *IndexingService) inKeyspace(infoHash []byte) bool {
+	return is.keyspace.Load().(Keyspace).Contains(infoHash)
+}
+
+// randomTarget returns a random target in the keyspace (see SetKeyspace) to find the nodes by.
+func (is *IndexingService) randomTarget() []byte {
+	return is.keyspace.Load().(Keyspace).randomKey()
+}
+
 func (is *IndexingService) Start() {
 	if is.started {
-		zap.L().Panic("Attempting to Start() a mainline/IndexingService that has been already started! (Programmer error.)")
+		is.logger.Panic("Attempting to Start() a mainline/IndexingService that has been already started! (Programmer error.)")
 	}
 	is.started = true
 
 	is.protocol.Start()
 	go is.index()
 
-	zap.L().Info("Indexing Service started!")
+	is.logger.Info("Indexing Service started!")
+}
+
+func (is *IndexingService) LocalAddr() *net.UDPAddr {
+	return is.protocol.LocalAddr()
 }
 
 func (is *IndexingService) Terminate() {
@@ -91,7 +152,7 @@ func (is *IndexingService) index() {
 		if routingTableLen == 0 {
 			is.bootstrap()
 		} else {
-			zap.L().Info("Latest status:", zap.Int("n", routingTableLen),
+			is.logger.Info("Latest status:", zap.Int("n", routingTableLen),
 				zap.Uint("maxNeighbors", is.maxNeighbors))
 			//TODO
 			is.findNeighbors()
@@ -109,17 +170,13 @@ func (is *IndexingService) bootstrap() {
 		"dht.libtorrent.org:25401",
 	}
 
-	zap.L().Info("Bootstrapping as routing table is empty...")
+	is.logger.Info("Bootstrapping as routing table is empty...")
 	for _, node := range bootstrappingNodes {
-		target := make([]byte, 20)
-		_, err := rand.Read(target)
-		if err != nil {
-			zap.L().Panic("Could NOT generate random bytes during bootstrapping!")
-		}
+		target := is.randomTarget()
 
 		addr, err := net.ResolveUDPAddr("udp", node)
 		if err != nil {
-			zap.L().Error("Could NOT resolve (UDP) address of the bootstrapping node!",
+			is.logger.Error("Could NOT resolve (UDP) address of the bootstrapping node!",
 				zap.String("node", node))
 			continue
 		}
@@ -129,8 +186,6 @@ func (is *IndexingService) bootstrap() {
 }
 
 func (is *IndexingService) findNeighbors() {
-	target := make([]byte, 20)
-
 	/*
 		We could just RLock and defer RUnlock here, but that would mean that each response that we get could not Lock
 		the table because we are sending. So we would basically make read and write NOT concurrent.
@@ -144,13 +199,8 @@ func (is *IndexingService) findNeighbors() {
 	is.routingTableMutex.RUnlock()
 
 	for _, addr := range addressesToSend {
-		_, err := rand.Read(target)
-		if err != nil {
-			zap.L().Panic("Could NOT generate random bytes during bootstrapping!")
-		}
-
 		is.protocol.SendMessage(
-			NewSampleInfohashesQuery(is.nodeID, []byte("aa"), target),
+			NewSampleInfohashesQuery(is.nodeID, []byte("aa"), is.randomTarget()),
 			addr,
 		)
 	}
@@ -170,13 +220,8 @@ func (is *IndexingService) onFindNodeResponse(response *Message, addr *net.UDPAd
 
 		is.routingTable[string(node.ID)] = &node.Addr
 
-		target := make([]byte, 20)
-		_, err := rand.Read(target)
-		if err != nil {
-			zap.L().Panic("Could NOT generate random bytes!")
-		}
 		is.protocol.SendMessage(
-			NewSampleInfohashesQuery(is.nodeID, []byte("aa"), target),
+			NewSampleInfohashesQuery(is.nodeID, []byte("aa"), is.randomTarget()),
 			&node.Addr,
 		)
 	}
@@ -186,9 +231,15 @@ func (is *IndexingService) onGetPeersResponse(msg *Message, addr *net.UDPAddr) {
 	var t [2]byte
 	copy(t[:], msg.T)
 
-	infoHash := is.getPeersRequests[t]
+	is.getPeersMutex.Lock()
+	infoHash, ok := is.getPeersRequests[t]
 	// We got a response, so free the key!
 	delete(is.getPeersRequests, t)
+	is.getPeersMutex.Unlock()
+	if !ok {
+		return
+	}
+	source, l := is.sourceOf(infoHash)
 
 	// BEP 51 specifies that
 	//     The new sample_infohashes remote procedure call requests that a remote node return a string of multiple
@@ -196,6 +247,10 @@ func (is *IndexingService) onGetPeersResponse(msg *Message, addr *net.UDPAddr) {
 	//                                                                          ^^^^^^
 	// So theoretically we should never hit the case where `values` is empty, but c'est la vie.
 	if len(msg.R.Values) == 0 {
+		// The nodes that are closer to a looked up infohash are followed, until its peers are found.
+		if l != nil {
+			is.followNodes(infoHash, l, msg.R.Nodes)
+		}
 		return
 	}
 
@@ -214,6 +269,7 @@ func (is *IndexingService) onGetPeersResponse(msg *Message, addr *net.UDPAddr) {
 	is.eventHandlers.OnResult(IndexingResult{
 		infoHash:  infoHash,
 		peerAddrs: peerAddrs,
+		source:    source,
 	})
 }
 
@@ -221,16 +277,12 @@ func (is *IndexingService) onSampleInfohashesResponse(msg *Message, addr *net.UD
 	// request samples
 	for i := 0; i < len(msg.R.Samples)/20; i++ {
 		var infoHash [20]byte
-		copy(infoHash[:], msg.R.Samples[i:(i+1)*20])
-
-		msg := NewGetPeersQuery(is.nodeID, infoHash[:])
-		t := uint16BE(is.counter)
-		msg.T = t[:]
-
-		is.protocol.SendMessage(msg, addr)
+		copy(infoHash[:], msg.R.Samples[i*20:(i+1)*20])
+		if !is.inKeyspace(infoHash[:]) {
+			continue
+		}
 
-		is.getPeersRequests[t] = infoHash
-		is.counter++
+		is.sendGetPeers(infoHash, addr)
 	}
 
 	// TODO: good idea, but also need to track how long they have been here
@@ -257,7 +309,7 @@ func (is *IndexingService) onSampleInfohashesResponse(msg *Message, addr *net.UD
 			target := make([]byte, 20)
 			_, err := rand.Read(target)
 			if err != nil {
-				zap.L().Panic("Could NOT generate random bytes!")
+				is.logger.Panic("Could NOT generate random bytes!")
 			}
 			is.protocol.SendMessage(
 				NewSampleInfohashesQuery(is.nodeID, []byte("aa"), target),
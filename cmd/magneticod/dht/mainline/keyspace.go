@@ -0,0 +1,107 @@
+package mainline
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// keyspaceBits is the number of the leading bits of the keys (i.e. of the infohashes and of the node
+// IDs) by which the keyspace is partitioned, which suffices for the partitions to be even.
+const keyspaceBits = 32
+
+// Keyspace is a (half-open) range of the keyspace of the DHT, by the leading keyspaceBits bits of
+// the keys, which is either targeted by the user (see ParseKeyspace), or partitioned among the
+// instances of magneticod so that they do not fetch the metadata of the same torrents (see
+// Partition).
+type Keyspace struct {
+	lo, hi uint64
+}
+
+// WholeKeyspace is the whole keyspace, which is the keyspace of the sole instance.
+var WholeKeyspace = Keyspace{lo: 0, hi: 1 << keyspaceBits}
+
+// ParseKeyspace parses a keyspace as either a prefix of the keys in hexadecimal (e.g. "a0" for the
+// keys from a000... to a0ff...), or a range of them (e.g. "a0-bf" for the keys from a000... to
+// bfff...), of at most 8 digits each. The empty string is the whole keyspace.
+func ParseKeyspace(s string) (Keyspace, error) {
+	if s == "" {
+		return WholeKeyspace, nil
+	}
+	from, to := s, s
+	if i := strings.IndexByte(s, '-'); i != -1 {
+		from, to = s[:i], s[i+1:]
+	}
+	lo, _, err := parsePrefix(from)
+	if err != nil {
+		return Keyspace{}, err
+	}
+	_, hi, err := parsePrefix(to)
+	if err != nil {
+		return Keyspace{}, err
+	}
+	if lo >= hi {
+		return Keyspace{}, fmt.Errorf("keyspace %s is empty", s)
+	}
+	return Keyspace{lo: lo, hi: hi}, nil
+}
+
+// parsePrefix returns the range of the keys that start with the prefix (in hexadecimal).
+func parsePrefix(prefix string) (lo, hi uint64, err error) {
+	if len(prefix) == 0 || len(prefix) > keyspaceBits/4 {
+		return 0, 0, fmt.Errorf("prefix %q is not of 1 to %d digits", prefix, keyspaceBits/4)
+	}
+	p, err := strconv.ParseUint(prefix, 16, keyspaceBits)
+	if err != nil {
+		return 0, 0, fmt.Errorf("prefix %q is not hexadecimal", prefix)
+	}
+	shift := uint(keyspaceBits - 4*len(prefix))
+	return p << shift, (p + 1) << shift, nil
+}
+
+// Partition returns the index-th of the count (even) partitions of the keyspace.
+func (k Keyspace) Partition(index, count int) Keyspace {
+	if count <= 0 || index < 0 || index >= count || k.IsEmpty() {
+		return Keyspace{}
+	}
+	size := k.hi - k.lo
+	return Keyspace{
+		lo: k.lo + size*uint64(index)/uint64(count),
+		hi: k.lo + size*uint64(index+1)/uint64(count),
+	}
+}
+
+// Contains returns whether the key is in the keyspace. The keys shorter than 4 bytes are in none.
+func (k Keyspace) Contains(key []byte) bool {
+	if len(key) < keyspaceBits/8 {
+		return false
+	}
+	prefix := uint64(binary.BigEndian.Uint32(key))
+	return k.lo <= prefix && prefix < k.hi
+}
+
+// IsEmpty returns whether the keyspace contains no keys, as of a standby instance.
+func (k Keyspace) IsEmpty() bool {
+	return k.lo >= k.hi
+}
+
+// randomKey returns a random key (of 20 bytes) in the keyspace, or in the whole keyspace if it is
+// empty.
+func (k Keyspace) randomKey() []byte {
+	if k.IsEmpty() {
+		k = WholeKeyspace
+	}
+	key := make([]byte, 20)
+	_, _ = rand.Read(key)
+	binary.BigEndian.PutUint32(key, uint32(k.lo+uint64(rand.Int63n(int64(k.hi-k.lo)))))
+	return key
+}
+
+func (k Keyspace) String() string {
+	if k.IsEmpty() {
+		return "none"
+	}
+	return fmt.Sprintf("%08x-%08x", k.lo, k.hi-1)
+}
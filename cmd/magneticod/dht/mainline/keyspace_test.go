@@ -0,0 +1,110 @@
+package mainline
+
+import (
+	"testing"
+)
+
+func TestPartition(t *testing.T) {
+	instances := []struct {
+		index, count int
+		expected     string
+	}{
+		{0, 1, "00000000-ffffffff"},
+		{0, 2, "00000000-7fffffff"},
+		{1, 2, "80000000-ffffffff"},
+		{1, 3, "55555555-aaaaaaa9"},
+		{2, 3, "aaaaaaaa-ffffffff"},
+		{2, 2, "none"},
+		{0, 0, "none"},
+		{-1, 2, "none"},
+	}
+
+	for i, instance := range instances {
+		if got := WholeKeyspace.Partition(instance.index, instance.count).String(); got != instance.expected {
+			t.Errorf("Partition of the instance #%d is wrong! Got %s (expected %s)", i+1, got,
+				instance.expected)
+		}
+	}
+}
+
+func TestKeyspaceContains(t *testing.T) {
+	instances := []struct {
+		keyspace Keyspace
+		key      []byte
+		expected bool
+	}{
+		{WholeKeyspace, []byte{0xff, 0xff, 0xff, 0xff, 0xff}, true},
+		{WholeKeyspace, []byte{0x00, 0x00, 0x00}, false},
+		{WholeKeyspace.Partition(0, 2), []byte{0x7f, 0xff, 0xff, 0xff}, true},
+		{WholeKeyspace.Partition(0, 2), []byte{0x80, 0x00, 0x00, 0x00}, false},
+		{WholeKeyspace.Partition(1, 2), []byte{0x80, 0x00, 0x00, 0x00}, true},
+		{Keyspace{}, []byte{0x00, 0x00, 0x00, 0x00}, false},
+	}
+
+	for i, instance := range instances {
+		if got := instance.keyspace.Contains(instance.key); got != instance.expected {
+			t.Errorf("Contains of the instance #%d is wrong! Got %t (expected %t)", i+1, got,
+				instance.expected)
+		}
+	}
+
+	// Every key is in exactly one of the partitions.
+	for _, prefix := range []uint32{0, 1, 0x55555554, 0x55555555, 0xaaaaaaaa, 0xffffffff} {
+		key := []byte{byte(prefix >> 24), byte(prefix >> 16), byte(prefix >> 8), byte(prefix)}
+		n := 0
+		for index := 0; index < 3; index++ {
+			if WholeKeyspace.Partition(index, 3).Contains(key) {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("The key %x is in %d of the partitions (expected 1)", key, n)
+		}
+	}
+}
+
+func TestParseKeyspace(t *testing.T) {
+	instances := []struct {
+		keyspace string
+		expected string // empty if invalid
+	}{
+		{"", "00000000-ffffffff"},
+		{"a0", "a0000000-a0ffffff"},
+		{"A0", "a0000000-a0ffffff"},
+		{"a0-bf", "a0000000-bfffffff"},
+		{"0-7", "00000000-7fffffff"},
+		{"12345678", "12345678-12345678"},
+		{"00000000-ffffffff", "00000000-ffffffff"},
+		{"bf-a0", ""},
+		{"123456789", ""},
+		{"xy", ""},
+		{"a0-", ""},
+	}
+
+	for i, instance := range instances {
+		keyspace, err := ParseKeyspace(instance.keyspace)
+		if instance.expected == "" {
+			if err == nil {
+				t.Errorf("ParseKeyspace of the instance #%d is wrong! Got %s (expected an error)", i+1, keyspace)
+			}
+		} else if err != nil {
+			t.Errorf("ParseKeyspace of the instance #%d failed: %s", i+1, err.Error())
+		} else if keyspace.String() != instance.expected {
+			t.Errorf("ParseKeyspace of the instance #%d is wrong! Got %s (expected %s)", i+1, keyspace,
+				instance.expected)
+		}
+	}
+}
+
+func TestKeyspaceRandomKey(t *testing.T) {
+	for i, keyspace := range []Keyspace{WholeKeyspace, {lo: 0xa0, hi: 0xa1}, WholeKeyspace.Partition(2, 3)} {
+		for j := 0; j < 100; j++ {
+			if key := keyspace.randomKey(); len(key) != 20 || !keyspace.Contains(key) {
+				t.Fatalf("randomKey of the instance #%d is wrong! Got %x (expected in %s)", i+1, key, keyspace)
+			}
+		}
+	}
+	if key := (Keyspace{}).randomKey(); len(key) != 20 {
+		t.Errorf("randomKey of the empty keyspace is wrong! Got %x", key)
+	}
+}
@@ -0,0 +1,223 @@
+package mainline
+
+import (
+	"encoding/binary"
+	"expvar"
+	"fmt"
+	"net"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/bdecode"
+)
+
+// decodeErrors are the numbers of the messages that could not be decoded by the kinds of their
+// errors (see errorKind), served by expvar (see --debug-addr).
+var decodeErrors = expvar.NewMap("krpc_errors")
+
+// MessageError is the error of a message that is valid bencode but not a valid KRPC message.
+type MessageError struct {
+	// Key is the key of the message whose value is of the wrong type, or is missing.
+	Key string
+}
+
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("krpc: `%s` is missing or malformed", e.Key)
+}
+
+// errorKind returns the kind of the decoding error, as a metric label.
+func errorKind(err error) string {
+	switch err := err.(type) {
+	case *bdecode.SyntaxError:
+		return string(err.Kind)
+	case *MessageError:
+		return "krpc-" + err.Key
+	default:
+		return "other"
+	}
+}
+
+// decodeMessage decodes a KRPC message (BEP 5), where the unknown keys are ignored. In Lenient mode,
+// besides the deviations tolerated by the bencode decoder, the optional keys of the wrong types are
+// ignored, as are the compact node infos that are cut short and the peers of invalid lengths;
+// whereas the messages are rejected in Strict mode.
+//
+// The semantic validity of the messages (e.g. the lengths of the IDs) is left to Protocol.
+func decodeMessage(data []byte, mode bdecode.Mode) (*Message, error) {
+	// The values decoded refer to the data, which might be a reused buffer.
+	data = append([]byte(nil), data...)
+	value, err := bdecode.Decode(data, mode)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, &MessageError{Key: "message"}
+	}
+
+	msg := new(Message)
+	// t and y are required (in any mode).
+	if msg.T, ok = dict["t"].([]byte); !ok {
+		return nil, &MessageError{Key: "t"}
+	}
+	y, ok := dict["y"].([]byte)
+	if !ok {
+		return nil, &MessageError{Key: "y"}
+	}
+	msg.Y = string(y)
+
+	d := messageDecoder{mode: mode}
+	q := d.bytes(dict, "q")
+	msg.Q = string(q)
+
+	if a := d.dict(dict, "a"); a != nil {
+		msg.A.ID = d.bytes(a, "id")
+		msg.A.InfoHash = d.bytes(a, "info_hash")
+		msg.A.Target = d.bytes(a, "target")
+		msg.A.Token = d.bytes(a, "token")
+		msg.A.Port = d.int(a, "port")
+		msg.A.ImpliedPort = d.int(a, "implied_port")
+		msg.A.Seed = d.int(a, "seed")
+		msg.A.NoSeed = d.int(a, "noseed")
+		msg.A.Scrape = d.int(a, "scrape")
+	}
+
+	if r := d.dict(dict, "r"); r != nil {
+		msg.R.ID = d.bytes(r, "id")
+		msg.R.Token = d.bytes(r, "token")
+		msg.R.Interval = d.int(r, "interval")
+		msg.R.Num = d.int(r, "num")
+		msg.R.Samples = d.bytes(r, "samples")
+		if nodes := d.bytes(r, "nodes"); nodes != nil {
+			msg.R.Nodes = d.nodes(nodes)
+		}
+		if values := d.list(r, "values"); values != nil {
+			msg.R.Values = d.peers(values)
+		}
+		// The bloom filters of BEP 33 (BFsd and BFpe) are not used.
+	}
+
+	if e := d.list(dict, "e"); e != nil {
+		msg.E = d.error(e)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return msg, nil
+}
+
+// messageDecoder decodes the values of a message, and keeps the first error (in Strict mode).
+type messageDecoder struct {
+	mode bdecode.Mode
+	err  error
+}
+
+func (d *messageDecoder) fail(key string) {
+	if d.mode == bdecode.Strict && d.err == nil {
+		d.err = &MessageError{Key: key}
+	}
+}
+
+func (d *messageDecoder) bytes(dict map[string]interface{}, key string) []byte {
+	value, ok := dict[key]
+	if !ok {
+		return nil
+	}
+	str, ok := value.([]byte)
+	if !ok {
+		d.fail(key)
+		return nil
+	}
+	return str
+}
+
+func (d *messageDecoder) int(dict map[string]interface{}, key string) int {
+	value, ok := dict[key]
+	if !ok {
+		return 0
+	}
+	n, ok := value.(int64)
+	// The integers of the messages are ports and counts, which fit in 32 bits.
+	if !ok || n < -1<<31 || n >= 1<<31 {
+		d.fail(key)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *messageDecoder) dict(dict map[string]interface{}, key string) map[string]interface{} {
+	value, ok := dict[key]
+	if !ok {
+		return nil
+	}
+	subDict, ok := value.(map[string]interface{})
+	if !ok {
+		d.fail(key)
+		return nil
+	}
+	return subDict
+}
+
+func (d *messageDecoder) list(dict map[string]interface{}, key string) []interface{} {
+	value, ok := dict[key]
+	if !ok {
+		return nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		d.fail(key)
+		return nil
+	}
+	return list
+}
+
+// nodes decodes the compact node infos, dropping the incomplete one at the end (if any).
+func (d *messageDecoder) nodes(b []byte) CompactNodeInfos {
+	if len(b)%26 != 0 {
+		d.fail("nodes")
+	}
+	nodes := make(CompactNodeInfos, len(b)/26)
+	for i := range nodes {
+		info := b[i*26 : (i+1)*26]
+		nodes[i].ID = info[:20]
+		nodes[i].Addr = net.UDPAddr{IP: net.IP(info[20:24]), Port: int(binary.BigEndian.Uint16(info[24:26]))}
+	}
+	return nodes
+}
+
+// peers decodes the compact peers (of either IPv4 or IPv6), skipping the invalid ones.
+func (d *messageDecoder) peers(values []interface{}) []CompactPeer {
+	peers := make([]CompactPeer, 0, len(values))
+	for _, value := range values {
+		var peer CompactPeer
+		str, ok := value.([]byte)
+		if !ok || peer.UnmarshalBinary(str) != nil {
+			d.fail("values")
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// error decodes the list of the error code and the error message.
+func (d *messageDecoder) error(e []interface{}) Error {
+	var krpcError Error
+	if len(e) != 2 {
+		d.fail("e")
+	}
+	if len(e) > 0 {
+		if code, ok := e[0].(int64); ok && code >= 0 && code < 1<<31 {
+			krpcError.Code = int(code)
+		} else {
+			d.fail("e")
+		}
+	}
+	if len(e) > 1 {
+		if message, ok := e[1].([]byte); ok {
+			krpcError.Message = message
+		} else {
+			d.fail("e")
+		}
+	}
+	return krpcError
+}
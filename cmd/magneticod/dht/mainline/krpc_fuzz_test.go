@@ -0,0 +1,27 @@
+//go:build go1.18
+// +build go1.18
+
+package mainline
+
+import (
+	"testing"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/bdecode"
+)
+
+// FuzzDecodeMessage checks that the messages are decoded without panics, and that whatever is
+// valid in Strict mode is valid in Lenient mode as well.
+//
+//	go test -fuzz=FuzzDecodeMessage ./cmd/magneticod/dht/mainline/
+func FuzzDecodeMessage(f *testing.F) {
+	for _, test := range decodeMessageTests {
+		f.Add([]byte(test.input))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, lenientErr := decodeMessage(data, bdecode.Lenient)
+		if _, strictErr := decodeMessage(data, bdecode.Strict); strictErr == nil && lenientErr != nil {
+			t.Fatalf("Valid in Strict mode but not in Lenient mode! %s", lenientErr.Error())
+		}
+	})
+}
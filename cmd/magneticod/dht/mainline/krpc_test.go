@@ -0,0 +1,72 @@
+package mainline
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/bdecode"
+)
+
+var decodeMessageTests = []struct {
+	input string
+	// strictError and lenientError are the kinds of the errors expected (see errorKind), or empty
+	// if none.
+	strictError, lenientError string
+}{
+	{"d1:ad2:id20:abcdefghij0123456789e1:q4:ping1:t2:aa1:y1:qe", "", ""},
+	{"d1:rd2:id20:mnopqrstuvwxyz123456e1:t2:aa1:y1:re", "", ""},
+	{"d1:eli201e23:A Generic Error Ocurrede1:t2:aa1:y1:ee", "", ""},
+	// Unknown keys are ignored in both modes.
+	{"d1:ad2:id20:abcdefghij0123456789e1:q4:ping1:t2:aa1:v4:UT011:y1:qe", "", ""},
+
+	// Tolerated in Lenient mode.
+	{"d1:t2:aa1:y1:q1:q4:ping1:ad2:id20:abcdefghij0123456789ee", "key-order", ""},
+	{"d1:ad2:id20:abcdefghij0123456789e1:q4:ping1:t2:aa1:y1:qe\x00\x00", "trailing-data", ""},
+	{"d1:ad2:id20:abcdefghij01234567894:port4:6881e1:q4:ping1:t2:aa1:y1:qe", "krpc-port", ""},
+	{"d1:rd2:id20:mnopqrstuvwxyz1234565:nodes27:abcdefghij0123456789\x7f\x00\x00\x01\x1a\xe1!e1:t2:aa1:y1:re", "krpc-nodes", ""},
+	{"d1:rd2:id20:mnopqrstuvwxyz1234566:valuesl6:\x7f\x00\x00\x01\x1a\xe13:badee1:t2:aa1:y1:re", "krpc-values", ""},
+	{"d1:eli201ee1:t2:aa1:y1:ee", "krpc-e", ""},
+
+	// Rejected in both modes.
+	{"d1:ad2:id20:abcdefghij0123456789e1:q4:ping1:y1:qe", "krpc-t", "krpc-t"},
+	{"d1:ad2:id20:abcdefghij0123456789e1:q4:ping1:t2:aa1:yi1ee", "krpc-y", "krpc-y"},
+	{"l1:t1:ye", "krpc-message", "krpc-message"},
+	{"d1:t2:aa1:y1:q", "truncated", "truncated"},
+}
+
+func TestDecodeMessage(t *testing.T) {
+	for i, test := range decodeMessageTests {
+		for _, mode := range []bdecode.Mode{bdecode.Strict, bdecode.Lenient} {
+			expectedError := test.strictError
+			if mode == bdecode.Lenient {
+				expectedError = test.lenientError
+			}
+
+			_, err := decodeMessage([]byte(test.input), mode)
+			if expectedError == "" && err != nil {
+				t.Errorf("Instance #%d (mode %d) could not be decoded! %s", i+1, mode, err.Error())
+			} else if expectedError != "" && (err == nil || errorKind(err) != expectedError) {
+				t.Errorf("Error of the instance #%d (mode %d) is wrong! Got %v (expected %s)", i+1, mode,
+					err, expectedError)
+			}
+		}
+	}
+}
+
+func TestDecodeMessageLenient(t *testing.T) {
+	msg, err := decodeMessage([]byte(decodeMessageTests[7].input), bdecode.Lenient)
+	if err != nil {
+		t.Fatalf("Could not decode the message! %s", err.Error())
+	}
+	if len(msg.R.Nodes) != 1 || msg.R.Nodes[0].Addr.Port != 6881 || !bytes.Equal(msg.R.Nodes[0].ID, []byte("abcdefghij0123456789")) {
+		t.Errorf("Nodes are wrong! Got %v (expected the incomplete node to be dropped)", msg.R.Nodes)
+	}
+
+	msg, err = decodeMessage([]byte(decodeMessageTests[8].input), bdecode.Lenient)
+	if err != nil {
+		t.Fatalf("Could not decode the message! %s", err.Error())
+	}
+	if len(msg.R.Values) != 1 || msg.R.Values[0].Port != 6881 {
+		t.Errorf("Peers are wrong! Got %v (expected the invalid peer to be skipped)", msg.R.Values)
+	}
+}
@@ -0,0 +1,114 @@
+package mainline
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+const (
+	// lookupBudget is the number of the get_peers queries that are sent for a looked up infohash,
+	// lest a lookup that never converges floods the DHT.
+	lookupBudget = 64
+	// lookupTimeout is how long the responses to the get_peers queries of a lookup are awaited.
+	lookupTimeout = time.Minute
+)
+
+// lookup is the state of an iterative get_peers lookup of an infohash that is requested by the
+// users (instead of being sampled or announced).
+type lookup struct {
+	budget  int
+	queried map[string]bool // addresses of the nodes that are queried
+	started time.Time
+}
+
+// Lookup looks the infohash up by sending get_peers queries to the nodes in the routing table that
+// are closest to it, and then to the closer nodes that they return, until its peers are found (and
+// reported as a result whose source is persistence.SourceRequest) or the budget is exhausted.
+func (is *IndexingService) Lookup(infoHash [20]byte) {
+	now := time.Now()
+
+	is.getPeersMutex.Lock()
+	for ih, l := range is.lookups {
+		if now.Sub(l.started) > lookupTimeout {
+			delete(is.lookups, ih)
+		}
+	}
+	l := &lookup{
+		budget:  lookupBudget,
+		queried: make(map[string]bool),
+		started: now,
+	}
+	is.lookups[infoHash] = l
+	is.getPeersMutex.Unlock()
+
+	nodes := is.closestNodes(infoHash[:])
+	if len(nodes) == 0 {
+		zap.L().Named("dht").Debug("Could NOT look up the infohash as the routing table is empty!",
+			zap.ByteString("infoHash", infoHash[:]))
+	}
+	is.followNodes(infoHash, l, nodes)
+}
+
+// followNodes sends get_peers queries for the looked up infohash to the nodes (closest first) that
+// are not queried yet, within the budget of the lookup.
+func (is *IndexingService) followNodes(infoHash [20]byte, l *lookup, nodes []CompactNodeInfo) {
+	sortByDistance(nodes, infoHash[:])
+	for i, node := range nodes {
+		if i >= maxResponseNodes {
+			break
+		}
+		if node.Addr.Port == 0 { // Ignore nodes who "use" port 0.
+			continue
+		}
+
+		is.getPeersMutex.Lock()
+		if l.budget <= 0 || l.queried[node.Addr.String()] {
+			is.getPeersMutex.Unlock()
+			continue
+		}
+		l.budget--
+		l.queried[node.Addr.String()] = true
+		is.getPeersMutex.Unlock()
+
+		addr := node.Addr
+		is.sendGetPeers(infoHash, &addr)
+	}
+}
+
+// sendGetPeers sends a get_peers query for the infohash, whose response is matched by its
+// transaction ID.
+func (is *IndexingService) sendGetPeers(infoHash [20]byte, addr *net.UDPAddr) {
+	is.getPeersMutex.Lock()
+	t := uint16BE(is.counter)
+	is.getPeersRequests[t] = infoHash
+	is.counter++
+	is.getPeersMutex.Unlock()
+
+	msg := NewGetPeersQuery(is.nodeID, infoHash[:])
+	msg.T = t[:]
+	is.protocol.SendMessage(msg, addr)
+}
+
+// sourceOf returns the source of the peers found for the infohash, and the lookup of it if it is
+// looked up.
+func (is *IndexingService) sourceOf(infoHash [20]byte) (persistence.Source, *lookup) {
+	is.getPeersMutex.Lock()
+	defer is.getPeersMutex.Unlock()
+	if l, ok := is.lookups[infoHash]; ok {
+		return persistence.SourceRequest, l
+	}
+	return persistence.SourceSample, nil
+}
+
+// sortByDistance sorts the nodes by their distance to the target (by the XOR metric).
+func sortByDistance(nodes []CompactNodeInfo, target []byte) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return bytes.Compare(xor(nodes[i].ID, target), xor(nodes[j].ID, target)) < 0
+	})
+}
@@ -0,0 +1,24 @@
+package mainline
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSortByDistance(t *testing.T) {
+	target := []byte{0x0f, 0x00}
+	nodes := []CompactNodeInfo{
+		{ID: []byte{0xf0, 0x00}},
+		{ID: []byte{0x0f, 0x01}},
+		{ID: []byte{0x0e, 0xff}},
+		{ID: []byte{0x0f, 0x00}},
+	}
+	expected := [][]byte{{0x0f, 0x00}, {0x0f, 0x01}, {0x0e, 0xff}, {0xf0, 0x00}}
+
+	sortByDistance(nodes, target)
+	for i, node := range nodes {
+		if !bytes.Equal(node.ID, expected[i]) {
+			t.Errorf("Node #%d is wrong! Got %x (expected %x)", i+1, node.ID, expected[i])
+		}
+	}
+}
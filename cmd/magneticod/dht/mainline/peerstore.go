@@ -0,0 +1,101 @@
+package mainline
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// maxStoredInfoHashes is the maximum number of the infohashes whose peers are stored.
+	maxStoredInfoHashes = 20000
+	// maxStoredPeers is the maximum number of the peers stored per infohash, which is also the
+	// maximum number of the values in a get_peers response (so that it fits in a UDP datagram).
+	maxStoredPeers = 50
+	// storedPeerTTL is how long an announce is stored for; the peers re-announce every 15 to 30
+	// minutes typically.
+	storedPeerTTL = 30 * time.Minute
+)
+
+// peerStore stores the peers announced to our nodes (using announce_peer queries), to be served in
+// response to the get_peers queries.
+type peerStore struct {
+	sync.Mutex
+	infoHashes map[[20]byte][]storedPeer
+}
+
+type storedPeer struct {
+	peer        CompactPeer
+	announcedOn time.Time
+}
+
+func newPeerStore() *peerStore {
+	return &peerStore{infoHashes: make(map[[20]byte][]storedPeer)}
+}
+
+// add stores the peer of the infohash, unless the store is full. The peers of an infohash that are
+// announced earliest are replaced by the newer ones when there are too many of them.
+func (ps *peerStore) add(infoHash [20]byte, peer CompactPeer, now time.Time) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	peers, ok := ps.infoHashes[infoHash]
+	if !ok && len(ps.infoHashes) >= maxStoredInfoHashes {
+		ps.expire(now)
+		if len(ps.infoHashes) >= maxStoredInfoHashes {
+			return
+		}
+	}
+
+	for i := range peers {
+		if peers[i].peer.Port == peer.Port && peers[i].peer.IP.Equal(peer.IP) {
+			peers[i].announcedOn = now
+			return
+		}
+	}
+	if len(peers) >= maxStoredPeers {
+		peers = peers[1:]
+	}
+	ps.infoHashes[infoHash] = append(peers, storedPeer{peer: peer, announcedOn: now})
+}
+
+// get returns the peers of the infohash that have not expired yet.
+func (ps *peerStore) get(infoHash [20]byte, now time.Time) []CompactPeer {
+	ps.Lock()
+	defer ps.Unlock()
+
+	var peers []CompactPeer
+	for _, stored := range ps.infoHashes[infoHash] {
+		if now.Sub(stored.announcedOn) < storedPeerTTL {
+			peers = append(peers, stored.peer)
+		}
+	}
+	return peers
+}
+
+// expire drops the expired peers, and the infohashes without any peers left; it must be called
+// with the store locked.
+func (ps *peerStore) expire(now time.Time) {
+	for infoHash, peers := range ps.infoHashes {
+		fresh := peers[:0]
+		for _, stored := range peers {
+			if now.Sub(stored.announcedOn) < storedPeerTTL {
+				fresh = append(fresh, stored)
+			}
+		}
+		if len(fresh) == 0 {
+			delete(ps.infoHashes, infoHash)
+		} else {
+			ps.infoHashes[infoHash] = fresh
+		}
+	}
+}
+
+func peerFromAnnounce(msg *Message, addr *net.UDPAddr) CompactPeer {
+	// The port of the UDP datagram is used instead of the one in the query if implied_port is set
+	// (for the peers behind NATs).
+	if msg.A.ImpliedPort != 0 {
+		return CompactPeer{IP: addr.IP, Port: addr.Port}
+	}
+	return CompactPeer{IP: addr.IP, Port: msg.A.Port}
+}
@@ -3,6 +3,7 @@ package mainline
 import (
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/subtle"
 	"net"
 	"sync"
 	"time"
@@ -16,6 +17,7 @@ type Protocol struct {
 	transport                               *Transport
 	eventHandlers                           ProtocolEventHandlers
 	started                                 bool
+	logger                                  *zap.Logger
 }
 
 type ProtocolEventHandlers struct {
@@ -36,13 +38,14 @@ type ProtocolEventHandlers struct {
 
 func NewProtocol(laddr string, eventHandlers ProtocolEventHandlers) (p *Protocol) {
 	p = new(Protocol)
+	p.logger = zap.L().Named("dht")
 	p.eventHandlers = eventHandlers
 	p.transport = NewTransport(laddr, p.onMessage, p.eventHandlers.OnCongestion)
 
 	p.currentTokenSecret, p.previousTokenSecret = make([]byte, 20), make([]byte, 20)
 	_, err := rand.Read(p.currentTokenSecret)
 	if err != nil {
-		zap.L().Fatal("Could NOT generate random bytes for token secret!", zap.Error(err))
+		p.logger.Fatal("Could NOT generate random bytes for token secret!", zap.Error(err))
 	}
 	copy(p.previousTokenSecret, p.currentTokenSecret)
 
@@ -51,7 +54,7 @@ func NewProtocol(laddr string, eventHandlers ProtocolEventHandlers) (p *Protocol
 
 func (p *Protocol) Start() {
 	if p.started {
-		zap.L().Panic("Attempting to Start() a mainline/Protocol that has been already started! (Programmer error.)")
+		p.logger.Panic("Attempting to Start() a mainline/Protocol that has been already started! (Programmer error.)")
 	}
 	p.started = true
 
@@ -59,9 +62,13 @@ func (p *Protocol) Start() {
 	go p.updateTokenSecret()
 }
 
+func (p *Protocol) LocalAddr() *net.UDPAddr {
+	return p.transport.LocalAddr()
+}
+
 func (p *Protocol) Terminate() {
 	if !p.started {
-		zap.L().Panic("Attempted to Terminate() a mainline/Protocol that has not been Start()ed! (Programmer error.)")
+		p.logger.Panic("Attempted to Terminate() a mainline/Protocol that has not been Start()ed! (Programmer error.)")
 	}
 
 	p.transport.Terminate()
@@ -177,7 +184,7 @@ func (p *Protocol) onMessage(msg *Message, addr *net.UDPAddr) {
 		//   - 202  Server Error
 		//   - 204  Method Unknown / Unknown query type
 		if msg.E.Code != 202 && msg.E.Code != 204 {
-			zap.L().Sugar().Debugf("Protocol error received: `%s` (%d)", msg.E.Message, msg.E.Code)
+			p.logger.Sugar().Debugf("Protocol error received: `%s` (%d)", msg.E.Message, msg.E.Code)
 		}
 	default:
 		/* zap.L().Debug("A KRPC message of an unknown type received!",
@@ -245,11 +252,26 @@ func NewPingResponse(t []byte, id []byte) *Message {
 }
 
 func NewFindNodeResponse(t []byte, id []byte, nodes []CompactNodeInfo) *Message {
-	panic("Not implemented yet!")
+	return &Message{
+		Y: "r",
+		T: t,
+		R: ResponseValues{
+			ID:    id,
+			Nodes: nodes,
+		},
+	}
 }
 
 func NewGetPeersResponseWithValues(t []byte, id []byte, token []byte, values []CompactPeer) *Message {
-	panic("Not implemented yet!")
+	return &Message{
+		Y: "r",
+		T: t,
+		R: ResponseValues{
+			ID:     id,
+			Token:  token,
+			Values: values,
+		},
+	}
 }
 
 func NewGetPeersResponseWithNodes(t []byte, id []byte, token []byte, nodes []CompactNodeInfo) *Message {
@@ -272,15 +294,24 @@ func NewAnnouncePeerResponse(t []byte, id []byte) *Message {
 func (p *Protocol) CalculateToken(address net.IP) []byte {
 	p.tokenLock.Lock()
 	defer p.tokenLock.Unlock()
-	sum := sha1.Sum(append(p.currentTokenSecret, address...))
-	return sum[:]
+	return calculateToken(p.currentTokenSecret, address)
 }
 
+// VerifyToken returns true if the token is given to the address within the last two token secrets
+// (i.e. 10 to 20 minutes), as BEP 5 recommends.
 func (p *Protocol) VerifyToken(address net.IP, token []byte) bool {
 	p.tokenLock.Lock()
 	defer p.tokenLock.Unlock()
-	// TODO: implement VerifyToken()
-	panic("VerifyToken() not implemented yet!")
+	return subtle.ConstantTimeCompare(token, calculateToken(p.currentTokenSecret, address)) == 1 ||
+		subtle.ConstantTimeCompare(token, calculateToken(p.previousTokenSecret, address)) == 1
+}
+
+func calculateToken(secret []byte, address net.IP) []byte {
+	if ip4 := address.To4(); ip4 != nil {
+		address = ip4
+	}
+	sum := sha1.Sum(append(append([]byte{}, secret...), address...))
+	return sum[:]
 }
 
 func (p *Protocol) updateTokenSecret() {
@@ -290,7 +321,7 @@ func (p *Protocol) updateTokenSecret() {
 		_, err := rand.Read(p.currentTokenSecret)
 		if err != nil {
 			p.tokenLock.Unlock()
-			zap.L().Fatal("Could NOT generate random bytes for token secret!", zap.Error(err))
+			p.logger.Fatal("Could NOT generate random bytes for token secret!", zap.Error(err))
 		}
 		p.tokenLock.Unlock()
 	}
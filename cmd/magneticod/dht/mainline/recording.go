@@ -0,0 +1,337 @@
+package mainline
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/bdecode"
+)
+
+// RecordedMessage is a KRPC message received from a DHT node, as recorded.
+type RecordedMessage struct {
+	ReceivedOn time.Time
+	From       *net.UDPAddr
+	// Data is the bencoded message (i.e. the payload of the UDP datagram), which might not be a
+	// valid message at all.
+	Data []byte
+}
+
+// recordingMagic is the magic of the recordings of magnetico, which consist of the records of
+// (big-endian):
+//
+//	received on (in Unix nanoseconds)  int64
+//	IPv4 address of the sender         [4]byte
+//	port of the sender                 uint16
+//	length of the data                 uint32
+//	data                               [length]byte
+var recordingMagic = []byte("MKRPC001")
+
+const (
+	pcapMagic             = 0xa1b2c3d4
+	pcapMagicNanoseconds  = 0xa1b23c4d
+	pcapLinkTypeEthernet  = 1
+	pcapLinkTypeRaw       = 101
+	pcapLinkTypeLinuxSLL  = 113
+	maxRecordedDataLength = 65507 // the maximum length of the payload of a UDP datagram
+)
+
+// RecordReader reads the messages from either a recording of magnetico or a pcap file (of
+// Ethernet, raw IP, or Linux "cooked" captures), where only the UDP datagrams over IPv4 are read.
+type RecordReader struct {
+	r *bufio.Reader
+	// pcap is nil for the recordings of magnetico.
+	pcap *pcapHeader
+}
+
+type pcapHeader struct {
+	byteOrder   binary.ByteOrder
+	nanoseconds bool
+	linkType    uint32
+}
+
+func NewRecordReader(r io.Reader) (*RecordReader, error) {
+	rr := &RecordReader{r: bufio.NewReader(r)}
+
+	magic, err := rr.r.Peek(len(recordingMagic))
+	if err != nil {
+		return nil, errors.Wrap(err, "magic")
+	}
+	if string(magic) == string(recordingMagic) {
+		_, _ = rr.r.Discard(len(recordingMagic))
+		return rr, nil
+	}
+
+	header := make([]byte, 24)
+	if _, err = io.ReadFull(rr.r, header); err != nil {
+		return nil, errors.Wrap(err, "pcap header")
+	}
+	rr.pcap = new(pcapHeader)
+	for _, byteOrder := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		switch byteOrder.Uint32(header[0:4]) {
+		case pcapMagic:
+			rr.pcap.byteOrder = byteOrder
+		case pcapMagicNanoseconds:
+			rr.pcap.byteOrder, rr.pcap.nanoseconds = byteOrder, true
+		}
+	}
+	if rr.pcap.byteOrder == nil {
+		return nil, fmt.Errorf("neither a recording nor a pcap file")
+	}
+	rr.pcap.linkType = rr.pcap.byteOrder.Uint32(header[20:24])
+	switch rr.pcap.linkType {
+	case pcapLinkTypeEthernet, pcapLinkTypeRaw, pcapLinkTypeLinuxSLL:
+	default:
+		return nil, fmt.Errorf("unsupported pcap link type %d", rr.pcap.linkType)
+	}
+	return rr, nil
+}
+
+// Next returns the next message, or io.EOF if there are no more messages.
+func (rr *RecordReader) Next() (*RecordedMessage, error) {
+	if rr.pcap != nil {
+		return rr.nextPcap()
+	}
+
+	header := make([]byte, 18)
+	if _, err := io.ReadFull(rr.r, header); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, errors.Wrap(err, "record header")
+	}
+	length := binary.BigEndian.Uint32(header[14:18])
+	if length > maxRecordedDataLength {
+		return nil, fmt.Errorf("record is too long (%d bytes)", length)
+	}
+	msg := &RecordedMessage{
+		ReceivedOn: time.Unix(0, int64(binary.BigEndian.Uint64(header[0:8]))),
+		From:       &net.UDPAddr{IP: net.IP(header[8:12]), Port: int(binary.BigEndian.Uint16(header[12:14]))},
+		Data:       make([]byte, length),
+	}
+	if _, err := io.ReadFull(rr.r, msg.Data); err != nil {
+		return nil, errors.Wrap(err, "record data")
+	}
+	return msg, nil
+}
+
+func (rr *RecordReader) nextPcap() (*RecordedMessage, error) {
+	for {
+		header := make([]byte, 16)
+		if _, err := io.ReadFull(rr.r, header); err == io.EOF {
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, errors.Wrap(err, "pcap record header")
+		}
+		seconds := rr.pcap.byteOrder.Uint32(header[0:4])
+		fraction := rr.pcap.byteOrder.Uint32(header[4:8])
+		length := rr.pcap.byteOrder.Uint32(header[8:12])
+		if length > 1<<18 {
+			return nil, fmt.Errorf("pcap record is too long (%d bytes)", length)
+		}
+		packet := make([]byte, length)
+		if _, err := io.ReadFull(rr.r, packet); err != nil {
+			return nil, errors.Wrap(err, "pcap record data")
+		}
+
+		if !rr.pcap.nanoseconds {
+			fraction *= 1000
+		}
+		receivedOn := time.Unix(int64(seconds), int64(fraction))
+		if from, data, ok := rr.pcap.udpPayload(packet); ok {
+			return &RecordedMessage{ReceivedOn: receivedOn, From: from, Data: data}, nil
+		}
+	}
+}
+
+// udpPayload returns the sender and the payload of the packet if it is a UDP datagram over IPv4.
+func (h *pcapHeader) udpPayload(packet []byte) (*net.UDPAddr, []byte, bool) {
+	switch h.linkType {
+	case pcapLinkTypeEthernet:
+		if len(packet) < 14 || binary.BigEndian.Uint16(packet[12:14]) != 0x0800 {
+			return nil, nil, false
+		}
+		packet = packet[14:]
+	case pcapLinkTypeLinuxSLL:
+		if len(packet) < 16 || binary.BigEndian.Uint16(packet[14:16]) != 0x0800 {
+			return nil, nil, false
+		}
+		packet = packet[16:]
+	}
+
+	// IPv4
+	if len(packet) < 20 || packet[0]>>4 != 4 || packet[9] != 17 {
+		return nil, nil, false
+	}
+	ihl := int(packet[0]&0x0f) * 4
+	if ihl < 20 || len(packet) < ihl+8 {
+		return nil, nil, false
+	}
+	// Fragments are not reassembled.
+	if flagsAndOffset := binary.BigEndian.Uint16(packet[6:8]); flagsAndOffset&0x3fff != 0 {
+		return nil, nil, false
+	}
+	from := &net.UDPAddr{IP: net.IP(append([]byte{}, packet[12:16]...))}
+
+	// UDP
+	udp := packet[ihl:]
+	from.Port = int(binary.BigEndian.Uint16(udp[0:2]))
+	length := int(binary.BigEndian.Uint16(udp[4:6]))
+	if length < 8 || length > len(udp) {
+		return nil, nil, false
+	}
+	return from, udp[8:length], true
+}
+
+// encodeRecord encodes the message as a record of the recordings of magnetico.
+func encodeRecord(msg *RecordedMessage) []byte {
+	record := make([]byte, 18+len(msg.Data))
+	binary.BigEndian.PutUint64(record[0:8], uint64(msg.ReceivedOn.UnixNano()))
+	copy(record[8:12], msg.From.IP.To4())
+	binary.BigEndian.PutUint16(record[12:14], uint16(msg.From.Port))
+	binary.BigEndian.PutUint32(record[14:18], uint32(len(msg.Data)))
+	copy(record[18:], msg.Data)
+	return record
+}
+
+// Recorder records (a sample of) the messages received by the transports in the format of the
+// recordings of magnetico, to be analysed offline, replayed (see Replay), or turned into the test
+// fixtures. It is safe for concurrent use, so that the indexers can share a single recording.
+type Recorder struct {
+	mutex sync.Mutex
+	w     *bufio.Writer
+	file  io.WriteCloser
+
+	// rate is the maximum number of the messages recorded per second (zero is unlimited), which are
+	// sampled using a token bucket of allowance.
+	rate          float64
+	allowance     float64
+	lastCheckedOn time.Time
+
+	// anonymizationKey is the (random) key of the pseudonyms of the addresses; it is nil if the
+	// messages are recorded as received.
+	anonymizationKey []byte
+
+	nRecorded, nDropped uint64
+	// closed is true once the recording is closed, as the transports might still be receiving.
+	closed bool
+}
+
+// NewRecorder starts a recording on file, which is closed by Close. If anonymize is true, the
+// addresses of the senders, and the addresses of the nodes and of the peers in the messages, are
+// replaced with their pseudonyms (see pseudonymize), and the messages that cannot be decoded (and
+// hence cannot be anonymized) are not recorded.
+func NewRecorder(file io.WriteCloser, rate uint, anonymize bool) (*Recorder, error) {
+	r := &Recorder{
+		w:             bufio.NewWriterSize(file, 1<<16),
+		file:          file,
+		rate:          float64(rate),
+		allowance:     float64(rate),
+		lastCheckedOn: time.Now(),
+	}
+	if anonymize {
+		r.anonymizationKey = make([]byte, 32)
+		if _, err := rand.Read(r.anonymizationKey); err != nil {
+			return nil, errors.Wrap(err, "rand.Read")
+		}
+	}
+	if _, err := r.w.Write(recordingMagic); err != nil {
+		return nil, errors.Wrap(err, "magic")
+	}
+	return r, nil
+}
+
+// Record records the message received from the sender, unless it exceeds the rate.
+func (r *Recorder) Record(data []byte, from *net.UDPAddr) {
+	now := time.Now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return
+	}
+	if r.rate > 0 {
+		r.allowance += now.Sub(r.lastCheckedOn).Seconds() * r.rate
+		r.lastCheckedOn = now
+		if r.allowance > r.rate {
+			r.allowance = r.rate
+		}
+		if r.allowance < 1 {
+			r.nDropped++
+			return
+		}
+		r.allowance--
+	}
+
+	if r.anonymizationKey != nil {
+		var ok bool
+		if data, ok = r.anonymize(data); !ok {
+			r.nDropped++
+			return
+		}
+		from = &net.UDPAddr{IP: r.pseudonymize(from.IP), Port: from.Port}
+	}
+
+	if _, err := r.w.Write(encodeRecord(&RecordedMessage{ReceivedOn: now, From: from, Data: data})); err != nil {
+		zap.L().Named("dht").Warn("Could not record the message!", zap.Error(err))
+		return
+	}
+	r.nRecorded++
+}
+
+// anonymize returns the message with the addresses in it replaced by their pseudonyms, re-encoded
+// (which drops the unknown keys as well).
+func (r *Recorder) anonymize(data []byte) ([]byte, bool) {
+	msg, err := decodeMessage(data, bdecode.Lenient)
+	if err != nil {
+		return nil, false
+	}
+	for i := range msg.R.Nodes {
+		msg.R.Nodes[i].Addr.IP = r.pseudonymize(msg.R.Nodes[i].Addr.IP)
+	}
+	for i := range msg.R.Values {
+		msg.R.Values[i].IP = r.pseudonymize(msg.R.Values[i].IP)
+	}
+	anonymized, err := bencode.Marshal(msg)
+	if err != nil {
+		return nil, false
+	}
+	return anonymized, true
+}
+
+// pseudonymize returns the pseudonym of the IP address, which is an address in 240.0.0.0/4 (that
+// is reserved, so that the pseudonyms are never mistaken for the real addresses) derived from the
+// HMAC of the address. The pseudonyms are consistent throughout a recording, so that the messages
+// of a node can still be told apart.
+func (r *Recorder) pseudonymize(ip net.IP) net.IP {
+	mac := hmac.New(sha256.New, r.anonymizationKey)
+	_, _ = mac.Write(ip.To16())
+	sum := mac.Sum(nil)
+	return net.IPv4(0xf0|(sum[0]&0x0f), sum[1], sum[2], sum[3]).To4()
+}
+
+// Close flushes the recording and closes its file.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+	zap.L().Named("dht").Info("Closing the recording",
+		zap.Uint64("recorded", r.nRecorded), zap.Uint64("dropped", r.nDropped))
+	if err := r.w.Flush(); err != nil {
+		_ = r.file.Close()
+		return errors.Wrap(err, "flush")
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,107 @@
+package mainline
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+type closingBuffer struct {
+	bytes.Buffer
+}
+
+func (*closingBuffer) Close() error { return nil }
+
+func readRecording(t *testing.T, r io.Reader) []*RecordedMessage {
+	rr, err := NewRecordReader(r)
+	if err != nil {
+		t.Fatalf("Could not read the recording! %s", err.Error())
+	}
+	var msgs []*RecordedMessage
+	for {
+		msg, err := rr.Next()
+		if err == io.EOF {
+			return msgs
+		} else if err != nil {
+			t.Fatalf("Could not read the record #%d! %s", len(msgs)+1, err.Error())
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	from := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6881}
+	data := mustMarshal(t, &Message{Y: "r", T: []byte("aa"), R: ResponseValues{
+		ID:     []byte("abcdefghij0123456789"),
+		Values: []CompactPeer{{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 51413}},
+	}})
+
+	file := new(closingBuffer)
+	recorder, err := NewRecorder(file, 2, false)
+	if err != nil {
+		t.Fatalf("Could not start the recording! %s", err.Error())
+	}
+	// The third message exceeds the rate (of 2 per second).
+	for i := 0; i < 3; i++ {
+		recorder.Record(data, from)
+	}
+	if err = recorder.Close(); err != nil {
+		t.Fatalf("Could not close the recording! %s", err.Error())
+	}
+
+	msgs := readRecording(t, file)
+	if len(msgs) != 2 {
+		t.Fatalf("Number of the messages recorded is wrong! Got %d (expected 2)", len(msgs))
+	}
+	if !msgs[0].From.IP.Equal(from.IP) || msgs[0].From.Port != from.Port || !bytes.Equal(msgs[0].Data, data) {
+		t.Errorf("Recorded message is wrong! Got %s %q (expected %s %q)", msgs[0].From, msgs[0].Data, from, data)
+	}
+}
+
+func TestRecorderAnonymize(t *testing.T) {
+	from := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6881}
+	peer := net.IPv4(10, 0, 0, 2).To4()
+	data := mustMarshal(t, &Message{Y: "r", T: []byte("aa"), R: ResponseValues{
+		ID:     []byte("abcdefghij0123456789"),
+		Values: []CompactPeer{{IP: peer, Port: 51413}},
+	}})
+
+	file := new(closingBuffer)
+	recorder, err := NewRecorder(file, 0, true)
+	if err != nil {
+		t.Fatalf("Could not start the recording! %s", err.Error())
+	}
+	recorder.Record(data, from)
+	recorder.Record(data, from)
+	// Cannot be anonymized, hence not recorded.
+	recorder.Record([]byte("not bencoded"), from)
+	if err = recorder.Close(); err != nil {
+		t.Fatalf("Could not close the recording! %s", err.Error())
+	}
+
+	msgs := readRecording(t, file)
+	if len(msgs) != 2 {
+		t.Fatalf("Number of the messages recorded is wrong! Got %d (expected 2)", len(msgs))
+	}
+	for i, msg := range msgs {
+		if msg.From.IP.Equal(from.IP) || msg.From.IP[0]&0xf0 != 0xf0 {
+			t.Errorf("Sender of the message #%d is not pseudonymized! Got %s", i+1, msg.From.IP)
+		}
+		if !msg.From.IP.Equal(msgs[0].From.IP) {
+			t.Errorf("Pseudonym of the message #%d is inconsistent! Got %s (expected %s)", i+1,
+				msg.From.IP, msgs[0].From.IP)
+		}
+
+		var decoded Message
+		if err = bencode.Unmarshal(msg.Data, &decoded); err != nil {
+			t.Fatalf("Could not decode the message #%d! %s", i+1, err.Error())
+		}
+		if len(decoded.R.Values) != 1 || decoded.R.Values[0].IP.Equal(peer) ||
+			decoded.R.Values[0].Port != 51413 {
+			t.Errorf("Peers of the message #%d are not pseudonymized! Got %v", i+1, decoded.R.Values)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package mainline
+
+import (
+	"io"
+	"net"
+
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/bdecode"
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// ReplayStatistics are the statistics of a replay.
+type ReplayStatistics struct {
+	NMessages uint64
+	// NInvalid is the number of the messages that could not be decoded, or are not valid.
+	NInvalid uint64
+	NResults uint64
+}
+
+// Replay replays the recorded messages (see NewRecordReader) through the decoder and the
+// validators, in order and without touching the network, and calls onResult with the infohashes
+// discovered by them. Since no queries are sent during a replay, the infohashes are discovered
+// from the sample_infohashes responses and the announce_peer queries only, without their peers
+// (except the announcing ones).
+func Replay(r io.Reader, onResult func(IndexingResult)) (*ReplayStatistics, error) {
+	rr, err := NewRecordReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := new(ReplayStatistics)
+	valid := false
+	p := &Protocol{logger: zap.L().Named("dht"), eventHandlers: ProtocolEventHandlers{
+		OnSampleInfohashesResponse: func(msg *Message, addr *net.UDPAddr) {
+			valid = true
+			for i := 0; i < len(msg.R.Samples)/20; i++ {
+				var infoHash [20]byte
+				copy(infoHash[:], msg.R.Samples[i*20:(i+1)*20])
+				onResult(IndexingResult{infoHash: infoHash, source: persistence.SourceSample})
+				stats.NResults++
+			}
+		},
+		OnAnnouncePeerQuery: func(msg *Message, addr *net.UDPAddr) {
+			valid = true
+			var infoHash [20]byte
+			copy(infoHash[:], msg.A.InfoHash)
+			peer := peerFromAnnounce(msg, addr)
+			onResult(IndexingResult{
+				infoHash:  infoHash,
+				peerAddrs: []net.TCPAddr{{IP: peer.IP, Port: peer.Port}},
+				source:    persistence.SourceAnnounce,
+			})
+			stats.NResults++
+		},
+	}}
+	// The other kinds of messages are only validated.
+	markValid := func(*Message, *net.UDPAddr) { valid = true }
+	p.eventHandlers.OnPingQuery = markValid
+	p.eventHandlers.OnFindNodeQuery = markValid
+	p.eventHandlers.OnGetPeersQuery = markValid
+	p.eventHandlers.OnSampleInfohashesQuery = markValid
+	p.eventHandlers.OnGetPeersResponse = markValid
+	p.eventHandlers.OnFindNodeResponse = markValid
+	p.eventHandlers.OnPingORAnnouncePeerResponse = markValid
+
+	for {
+		recorded, err := rr.Next()
+		if err == io.EOF {
+			return stats, nil
+		} else if err != nil {
+			return stats, err
+		}
+		stats.NMessages++
+
+		valid = false
+		if msg, err := decodeMessage(recorded.Data, bdecode.Lenient); err == nil {
+			p.onMessage(msg, recorded.From)
+			// Errors are not handled, but they are valid messages too.
+			valid = valid || msg.Y == "e"
+		}
+		if !valid {
+			stats.NInvalid++
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package mainline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+func mustMarshal(t *testing.T, msg *Message) []byte {
+	data, err := bencode.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Could not marshal the message! %s", err.Error())
+	}
+	return data
+}
+
+func TestReplay(t *testing.T) {
+	from := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6881}
+	samples := append(bytes.Repeat([]byte{'a'}, 20), bytes.Repeat([]byte{'b'}, 20)...)
+
+	var recording bytes.Buffer
+	recording.Write(recordingMagic)
+	for _, data := range [][]byte{
+		mustMarshal(t, &Message{Y: "r", T: []byte("aa"), R: ResponseValues{
+			ID: []byte("abcdefghij0123456789"), Samples: samples, Num: 2, Interval: 60}}),
+		mustMarshal(t, &Message{Y: "q", T: []byte("bb"), Q: "announce_peer", A: QueryArguments{
+			ID: []byte("abcdefghij0123456789"), InfoHash: bytes.Repeat([]byte{'c'}, 20), Port: 51413,
+			Token: []byte("token")}}),
+		[]byte("not bencoded"),
+	} {
+		recording.Write(encodeRecord(&RecordedMessage{ReceivedOn: time.Now(), From: from, Data: data}))
+	}
+
+	var results []IndexingResult
+	stats, err := Replay(&recording, func(result IndexingResult) {
+		results = append(results, result)
+	})
+	if err != nil {
+		t.Fatalf("Could not replay! %s", err.Error())
+	}
+
+	if stats.NMessages != 3 || stats.NInvalid != 1 || stats.NResults != 3 {
+		t.Errorf("Statistics are wrong! Got %+v (expected 3 messages, 1 invalid, 3 results)", *stats)
+	}
+	for i, expected := range []struct {
+		infoHash byte
+		source   persistence.Source
+		port     int
+	}{
+		{'a', persistence.SourceSample, 0},
+		{'b', persistence.SourceSample, 0},
+		{'c', persistence.SourceAnnounce, 51413},
+	} {
+		if i >= len(results) {
+			break
+		}
+		if results[i].infoHash[0] != expected.infoHash || results[i].source != expected.source {
+			t.Errorf("Result #%d is wrong! Got %c from %s (expected %c from %s)", i+1,
+				results[i].infoHash[0], results[i].source, expected.infoHash, expected.source)
+		}
+		if expected.port != 0 && (len(results[i].peerAddrs) != 1 || results[i].peerAddrs[0].Port != expected.port) {
+			t.Errorf("Peers of the result #%d are wrong! Got %v", i+1, results[i].peerAddrs)
+		}
+	}
+}
+
+func TestRecordReaderPcap(t *testing.T) {
+	payload := []byte("d1:y1:ee")
+
+	var pcap bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], pcapMagic)
+	binary.LittleEndian.PutUint32(header[20:24], pcapLinkTypeEthernet)
+	pcap.Write(header)
+
+	packet := make([]byte, 14+20+8+len(payload))
+	binary.BigEndian.PutUint16(packet[12:14], 0x0800) // IPv4
+	ip := packet[14:]
+	ip[0] = 0x45 // version 4, IHL 5
+	ip[9] = 17   // UDP
+	copy(ip[12:16], net.IPv4(192, 0, 2, 1).To4())
+	udp := ip[20:]
+	binary.BigEndian.PutUint16(udp[0:2], 6881)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(8+len(payload)))
+	copy(udp[8:], payload)
+
+	recordHeader := make([]byte, 16)
+	binary.LittleEndian.PutUint32(recordHeader[0:4], 1600000000)
+	binary.LittleEndian.PutUint32(recordHeader[8:12], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(recordHeader[12:16], uint32(len(packet)))
+	pcap.Write(recordHeader)
+	pcap.Write(packet)
+
+	rr, err := NewRecordReader(&pcap)
+	if err != nil {
+		t.Fatalf("Could not read the pcap header! %s", err.Error())
+	}
+	msg, err := rr.Next()
+	if err != nil {
+		t.Fatalf("Could not read the packet! %s", err.Error())
+	}
+	if msg.From.String() != "192.0.2.1:6881" || !bytes.Equal(msg.Data, payload) || msg.ReceivedOn.Unix() != 1600000000 {
+		t.Errorf("Message is wrong! Got %s %q at %d", msg.From.String(), msg.Data, msg.ReceivedOn.Unix())
+	}
+}
@@ -0,0 +1,88 @@
+package mainline
+
+import (
+	"net"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// maxResponseNodes is the number of the nodes in the find_node and get_peers responses (i.e. K).
+const maxResponseNodes = 8
+
+// The handlers below respond to the queries of the other nodes in the responder mode, so that our
+// nodes are kept in their routing tables (and thus receive their announces). The announces are
+// stored to be served to the get_peers queries, as well as being reported as results.
+
+func (is *IndexingService) onPingQuery(msg *Message, addr *net.UDPAddr) {
+	is.protocol.SendMessage(NewPingResponse(msg.T, is.nodeID), addr)
+}
+
+func (is *IndexingService) onFindNodeQuery(msg *Message, addr *net.UDPAddr) {
+	is.protocol.SendMessage(NewFindNodeResponse(msg.T, is.nodeID, is.closestNodes(msg.A.Target)), addr)
+}
+
+func (is *IndexingService) onGetPeersQuery(msg *Message, addr *net.UDPAddr) {
+	var infoHash [20]byte
+	copy(infoHash[:], msg.A.InfoHash)
+
+	token := is.protocol.CalculateToken(addr.IP)
+	if peers := is.peerStore.get(infoHash, time.Now()); len(peers) > 0 {
+		is.protocol.SendMessage(NewGetPeersResponseWithValues(msg.T, is.nodeID, token, peers), addr)
+	} else {
+		is.protocol.SendMessage(NewGetPeersResponseWithNodes(msg.T, is.nodeID, token, is.closestNodes(msg.A.InfoHash)), addr)
+	}
+}
+
+func (is *IndexingService) onAnnouncePeerQuery(msg *Message, addr *net.UDPAddr) {
+	if !is.protocol.VerifyToken(addr.IP, msg.A.Token) {
+		is.protocol.SendMessage(&Message{
+			Y: "e",
+			T: msg.T,
+			E: Error{Code: 203, Message: []byte("bad token")},
+		}, addr)
+		return
+	}
+
+	var infoHash [20]byte
+	copy(infoHash[:], msg.A.InfoHash)
+	peer := peerFromAnnounce(msg, addr)
+	is.peerStore.add(infoHash, peer, time.Now())
+	is.protocol.SendMessage(NewAnnouncePeerResponse(msg.T, is.nodeID), addr)
+	if !is.inKeyspace(infoHash[:]) {
+		return
+	}
+
+	is.eventHandlers.OnResult(IndexingResult{
+		infoHash:  infoHash,
+		peerAddrs: []net.TCPAddr{{IP: peer.IP, Port: peer.Port}},
+		source:    persistence.SourceAnnounce,
+	})
+}
+
+// closestNodes returns the nodes in the routing table that are closest to the target (by the XOR
+// metric).
+func (is *IndexingService) closestNodes(target []byte) []CompactNodeInfo {
+	is.routingTableMutex.RLock()
+	nodes := make([]CompactNodeInfo, 0, len(is.routingTable))
+	for id, addr := range is.routingTable {
+		nodes = append(nodes, CompactNodeInfo{ID: []byte(id), Addr: *addr})
+	}
+	is.routingTableMutex.RUnlock()
+
+	sortByDistance(nodes, target)
+	if len(nodes) > maxResponseNodes {
+		nodes = nodes[:maxResponseNodes]
+	}
+	return nodes
+}
+
+func xor(a []byte, b []byte) []byte {
+	result := make([]byte, len(a))
+	for i := range a {
+		if i < len(b) {
+			result[i] = a[i] ^ b[i]
+		}
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package mainline
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPeerStore(t *testing.T) {
+	ps := newPeerStore()
+	now := time.Now()
+	a := [20]byte{'a'}
+	peer1 := CompactPeer{IP: net.IPv4(10, 0, 0, 1), Port: 6881}
+	peer2 := CompactPeer{IP: net.IPv4(10, 0, 0, 2), Port: 6881}
+
+	ps.add(a, peer1, now)
+	ps.add(a, peer1, now.Add(20*time.Minute)) // re-announce
+	ps.add(a, peer2, now)
+
+	if peers := ps.get(a, now.Add(time.Minute)); len(peers) != 2 {
+		t.Errorf("Number of the stored peers is wrong! Got %d (expected 2)", len(peers))
+	}
+	peers := ps.get(a, now.Add(storedPeerTTL+time.Minute))
+	if len(peers) != 1 || !peers[0].IP.Equal(peer1.IP) {
+		t.Errorf("Only the re-announced peer should have been left! Got %v", peers)
+	}
+
+	for i := 0; i < maxStoredPeers+10; i++ {
+		ps.add(a, CompactPeer{IP: net.IPv4(10, 0, 1, byte(i)), Port: 6881}, now)
+	}
+	if peers := ps.get(a, now); len(peers) != maxStoredPeers {
+		t.Errorf("Store should not grow beyond its capacity per infohash! Got %d", len(peers))
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	p := NewProtocol("0.0.0.0:0", ProtocolEventHandlers{})
+	address := net.IPv4(10, 0, 0, 1)
+
+	token := p.CalculateToken(address)
+	if !p.VerifyToken(address, token) {
+		t.Errorf("Token should have been verified")
+	}
+	if p.VerifyToken(net.IPv4(10, 0, 0, 2), token) {
+		t.Errorf("Token of another address should not have been verified")
+	}
+
+	// Tokens are valid until the secret is updated twice.
+	copy(p.previousTokenSecret, p.currentTokenSecret)
+	p.currentTokenSecret[0]++
+	if !p.VerifyToken(address, token) {
+		t.Errorf("Token of the previous secret should have been verified")
+	}
+	copy(p.previousTokenSecret, p.currentTokenSecret)
+	if p.VerifyToken(address, token) {
+		t.Errorf("Token of an older secret should not have been verified")
+	}
+}
@@ -7,6 +7,8 @@ import (
 	sockaddr "github.com/libp2p/go-sockaddr/net"
 	"go.uber.org/zap"
 	"golang.org/x/sys/unix"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/bdecode"
 )
 
 type Transport struct {
@@ -21,10 +23,17 @@ type Transport struct {
 	onMessage func(*Message, *net.UDPAddr)
 	// OnCongestion
 	onCongestion func()
+	// recorder records the messages received; nil if not recording.
+	recorder *Recorder
+	// mode is the strictness of the decoding of the messages received.
+	mode bdecode.Mode
+
+	logger *zap.Logger
 }
 
 func NewTransport(laddr string, onMessage func(*Message, *net.UDPAddr), onCongestion func()) *Transport {
 	t := new(Transport)
+	t.logger = zap.L().Named("dht")
 	/*   The field size sets a theoretical limit of 65,535 bytes (8 byte header + 65,527 bytes of
 	 * data) for a UDP datagram. However the actual limit for the data length, which is imposed by
 	 * the underlying IPv4 protocol, is 65,507 bytes (65,535 − 8 byte UDP header − 20 byte IP
@@ -43,10 +52,10 @@ func NewTransport(laddr string, onMessage func(*Message, *net.UDPAddr), onConges
 	var err error
 	t.laddr, err = net.ResolveUDPAddr("udp", laddr)
 	if err != nil {
-		zap.L().Panic("Could not resolve the UDP address for the trawler!", zap.Error(err))
+		t.logger.Panic("Could not resolve the UDP address for the trawler!", zap.Error(err))
 	}
 	if t.laddr.IP.To4() == nil {
-		zap.L().Panic("IP address is not IPv4!")
+		t.logger.Panic("IP address is not IPv4!")
 	}
 
 	return t
@@ -62,26 +71,37 @@ func (t *Transport) Start() {
 	// end up in a debugging horror.
 	//                                                                   Here ends my justification.
 	if t.started {
-		zap.L().Panic("Attempting to Start() a mainline/Transport that has been already started! (Programmer error.)")
+		t.logger.Panic("Attempting to Start() a mainline/Transport that has been already started! (Programmer error.)")
 	}
 	t.started = true
 
 	var err error
 	t.fd, err = unix.Socket(unix.SOCK_DGRAM, unix.AF_INET, 0)
 	if err != nil {
-		zap.L().Fatal("Could NOT create a UDP socket!", zap.Error(err))
+		t.logger.Fatal("Could NOT create a UDP socket!", zap.Error(err))
 	}
 
 	var ip [4]byte
 	copy(ip[:], t.laddr.IP.To4())
 	err = unix.Bind(t.fd, &unix.SockaddrInet4{Addr: ip, Port: t.laddr.Port})
 	if err != nil {
-		zap.L().Fatal("Could NOT bind the socket!", zap.Error(err))
+		t.logger.Fatal("Could NOT bind the socket!", zap.Error(err))
+	}
+	// The port is chosen by the kernel if it is zero.
+	if sa, err := unix.Getsockname(t.fd); err == nil {
+		if sa4, ok := sa.(*unix.SockaddrInet4); ok {
+			t.laddr.Port = sa4.Port
+		}
 	}
 
 	go t.readMessages()
 }
 
+// LocalAddr returns the address that the transport is bound to, once started.
+func (t *Transport) LocalAddr() *net.UDPAddr {
+	return t.laddr
+}
+
 func (t *Transport) Terminate() {
 	unix.Close(t.fd)
 }
@@ -91,7 +111,7 @@ func (t *Transport) readMessages() {
 	for {
 		n, fromSA, err := unix.Recvfrom(t.fd, t.buffer, 0)
 		if err == unix.EPERM || err == unix.ENOBUFS { // todo: are these errors possible for recvfrom?
-			zap.L().Warn("READ CONGESTION!", zap.Error(err))
+			t.logger.Warn("READ CONGESTION!", zap.Error(err))
 			t.onCongestion()
 		} else if err != nil {
 			// Socket is probably closed
@@ -107,29 +127,32 @@ func (t *Transport) readMessages() {
 
 		from := sockaddr.SockaddrToUDPAddr(fromSA)
 		if from == nil {
-			zap.L().Panic("dht mainline transport SockaddrToUDPAddr: nil")
+			t.logger.Panic("dht mainline transport SockaddrToUDPAddr: nil")
+		}
+
+		if t.recorder != nil {
+			t.recorder.Record(t.buffer[:n], from)
 		}
 
-		var msg Message
-		err = bencode.Unmarshal(t.buffer[:n], &msg)
+		msg, err := decodeMessage(t.buffer[:n], t.mode)
 		if err != nil {
-			// couldn't unmarshal packet data
+			decodeErrors.Add(errorKind(err), 1)
 			continue
 		}
 
-		t.onMessage(&msg, from)
+		t.onMessage(msg, from)
 	}
 }
 
 func (t *Transport) WriteMessages(msg *Message, addr *net.UDPAddr) {
 	data, err := bencode.Marshal(msg)
 	if err != nil {
-		zap.L().Panic("Could NOT marshal an outgoing message! (Programmer error.)")
+		t.logger.Panic("Could NOT marshal an outgoing message! (Programmer error.)")
 	}
 
 	addrSA := sockaddr.NetAddrToSockaddr(addr)
 	if addrSA == nil {
-		zap.L().Debug("Wrong net address for the remote peer!",
+		t.logger.Debug("Wrong net address for the remote peer!",
 			zap.String("addr", addr.String()))
 		return
 	}
@@ -150,11 +173,11 @@ func (t *Transport) WriteMessages(msg *Message, addr *net.UDPAddr) {
 		 *
 		 * Source: https://docs.python.org/3/library/asyncio-protocol.html#flow-control-callbacks
 		 */
-		zap.L().Warn("WRITE CONGESTION!", zap.Error(err))
+		t.logger.Warn("WRITE CONGESTION!", zap.Error(err))
 		if t.onCongestion != nil {
 			t.onCongestion()
 		}
 	} else if err != nil {
-		zap.L().Warn("Could NOT write an UDP packet!", zap.Error(err))
+		t.logger.Warn("Could NOT write an UDP packet!", zap.Error(err))
 	}
 }
@@ -6,17 +6,24 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/boramalper/magnetico/cmd/magneticod/bdecode"
 	"github.com/boramalper/magnetico/cmd/magneticod/dht/mainline"
+	"github.com/boramalper/magnetico/pkg/persistence"
 )
 
 type Service interface {
 	Start()
 	Terminate()
+	LocalAddr() *net.UDPAddr
+	Lookup(infoHash [20]byte)
+	SetKeyspace(keyspace mainline.Keyspace)
 }
 
 type Result interface {
 	InfoHash() [20]byte
 	PeerAddrs() []net.TCPAddr
+	// Source is the mechanism by which the infohash is discovered.
+	Source() persistence.Source
 }
 
 type Manager struct {
@@ -24,12 +31,14 @@ type Manager struct {
 	indexingServices []Service
 }
 
-func NewManager(addrs []string, interval time.Duration, maxNeighbors uint) *Manager {
+// NewManager starts an indexing service on each of the addresses, targeting the keyspace (see
+// SetKeyspace); recorder records the messages received by them, and is nil if not recording.
+func NewManager(addrs []string, interval time.Duration, maxNeighbors uint, responder bool, recorder *mainline.Recorder, mode bdecode.Mode, keyspace mainline.Keyspace) *Manager {
 	manager := new(Manager)
 	manager.output = make(chan Result, 20)
 
 	for _, addr := range addrs {
-		service := mainline.NewIndexingService(addr, interval, maxNeighbors, mainline.IndexingServiceEventHandlers{
+		service := mainline.NewIndexingService(addr, interval, maxNeighbors, responder, recorder, mode, keyspace, mainline.IndexingServiceEventHandlers{
 			OnResult: manager.onIndexingResult,
 		})
 		manager.indexingServices = append(manager.indexingServices, service)
@@ -43,7 +52,7 @@ func (m *Manager) onIndexingResult(res mainline.IndexingResult) {
 	select {
 	case m.output <- res:
 	default:
-		zap.L().Debug("DHT manager output ch is full, idx result dropped!")
+		zap.L().Named("dht").Debug("DHT manager output ch is full, idx result dropped!")
 	}
 }
 
@@ -51,6 +60,31 @@ func (m *Manager) Output() <-chan Result {
 	return m.output
 }
 
+// Lookup looks the infohash up on the DHT by each of the indexing services, whose peers (if found)
+// are output as a result whose source is persistence.SourceRequest.
+func (m *Manager) Lookup(infoHash [20]byte) {
+	for _, service := range m.indexingServices {
+		service.Lookup(infoHash)
+	}
+}
+
+// SetKeyspace sets the keyspace of the infohashes that the indexing services discover (see
+// mainline.IndexingService.SetKeyspace).
+func (m *Manager) SetKeyspace(keyspace mainline.Keyspace) {
+	for _, service := range m.indexingServices {
+		service.SetKeyspace(keyspace)
+	}
+}
+
+// LocalAddrs returns the addresses that the indexing services are bound to.
+func (m *Manager) LocalAddrs() []*net.UDPAddr {
+	addrs := make([]*net.UDPAddr, len(m.indexingServices))
+	for i, service := range m.indexingServices {
+		addrs[i] = service.LocalAddr()
+	}
+	return addrs
+}
+
 func (m *Manager) Terminate() {
 	for _, service := range m.indexingServices {
 		service.Terminate()
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/boramalper/magnetico/pkg/util"
+)
+
+// subsystems are the names of the loggers of the subsystems of magneticod, whose levels can be set
+// individually.
+var subsystems = []string{"dht", "metadata", "crawler", "persistence", "dump"}
+
+type logConfig struct {
+	// Levels are the levels of the subsystems whose level is set individually.
+	Levels map[string]zapcore.Level
+	JSON   bool
+	// Path is the path of the log file, which is empty to log to stderr.
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+	// Sampling is the number of the identical entries logged per second (and every Sampling-th of
+	// them thereafter); zero disables sampling.
+	Sampling int
+	// Privacy is true if the IP addresses are to be scrubbed off the entries (see
+	// util.NewScrubbingCore).
+	Privacy bool
+}
+
+// parseLogLevel parses a --log-level flag of the form <SUBSYSTEM>=<LEVEL>.
+func parseLogLevel(flag string) (string, zapcore.Level, error) {
+	var level zapcore.Level
+	tokens := strings.SplitN(flag, "=", 2)
+	if len(tokens) != 2 {
+		return "", level, fmt.Errorf("log level must be of the form <SUBSYSTEM>=<LEVEL> (got `%s`)", flag)
+	}
+
+	isSubsystem := false
+	for _, subsystem := range subsystems {
+		isSubsystem = isSubsystem || subsystem == tokens[0]
+	}
+	if !isSubsystem {
+		return "", level, fmt.Errorf("unknown subsystem `%s` (expected one of %s)", tokens[0], strings.Join(subsystems, ", "))
+	}
+
+	if err := level.UnmarshalText([]byte(tokens[1])); err != nil {
+		return "", level, err
+	}
+	return tokens[0], level, nil
+}
+
+// newLogger returns the logger as configured, whose level is the given one except for the
+// subsystems whose levels are set individually.
+func newLogger(config logConfig, level zapcore.LevelEnabler) (*zap.Logger, error) {
+	var encoder zapcore.Encoder
+	if config.JSON {
+		encoderConfig := zap.NewProductionEncoderConfig()
+		encoderConfig.TimeKey = "time"
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	} else {
+		encoder = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	}
+
+	var sink zapcore.WriteSyncer
+	if config.Path == "" {
+		sink = zapcore.Lock(os.Stderr)
+	} else {
+		file, err := util.OpenRotatingFile(config.Path, config.MaxSize, config.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sink = file
+	}
+
+	// The levels are enforced by subsystemsCore instead.
+	core := zapcore.NewCore(encoder, sink, zapcore.DebugLevel)
+	// The entries are scrubbed beneath the sampler, so that they are sampled as they are logged.
+	if config.Privacy {
+		core = util.NewScrubbingCore(core)
+	}
+	if config.Sampling > 0 {
+		core = zapcore.NewSampler(core, time.Second, config.Sampling, config.Sampling)
+	}
+	return zap.New(newSubsystemsCore(core, level, config.Levels)), nil
+}
+
+// subsystemsCore filters the entries by the levels of their subsystems, which are told apart by
+// the names of their loggers (e.g. zap.L().Named("dht")).
+type subsystemsCore struct {
+	zapcore.Core
+	level  zapcore.LevelEnabler
+	levels map[string]zapcore.Level
+	// minimum is the lowest of the levels of the subsystems.
+	minimum zapcore.Level
+}
+
+func newSubsystemsCore(core zapcore.Core, level zapcore.LevelEnabler, levels map[string]zapcore.Level) *subsystemsCore {
+	c := &subsystemsCore{Core: core, level: level, levels: levels, minimum: zapcore.FatalLevel}
+	for _, l := range levels {
+		if l < c.minimum {
+			c.minimum = l
+		}
+	}
+	return c
+}
+
+func (c *subsystemsCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level) || (len(c.levels) > 0 && level >= c.minimum)
+}
+
+func (c *subsystemsCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.Core = c.Core.With(fields)
+	return &clone
+}
+
+func (c *subsystemsCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	// The names of the descendants of the loggers of the subsystems are dot-separated.
+	subsystem := strings.SplitN(entry.LoggerName, ".", 2)[0]
+	if level, ok := c.levels[subsystem]; ok {
+		if entry.Level < level {
+			return checked
+		}
+	} else if !c.level.Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var parseLogLevel_instances = []struct {
+	flag      string
+	subsystem string
+	level     zapcore.Level
+	err       bool
+}{
+	{"dht=error", "dht", zapcore.ErrorLevel, false},
+	{"persistence=debug", "persistence", zapcore.DebugLevel, false},
+	{"dht", "", 0, true},
+	{"foo=error", "", 0, true},
+	{"dht=loud", "", 0, true},
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for i, instance := range parseLogLevel_instances {
+		subsystem, level, err := parseLogLevel(instance.flag)
+		if (err != nil) != instance.err {
+			t.Errorf("Error of the instance #%d is wrong! Got %v", i+1, err)
+		} else if subsystem != instance.subsystem || level != instance.level {
+			t.Errorf("Instance #%d is wrong! Got %s=%s (expected %s=%s)", i+1, subsystem, level, instance.subsystem, instance.level)
+		}
+	}
+}
+
+func TestSubsystemsCore(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(newSubsystemsCore(core, zapcore.WarnLevel, map[string]zapcore.Level{
+		"dht":         zapcore.ErrorLevel,
+		"persistence": zapcore.DebugLevel,
+	}))
+
+	logger.Info("main info")                               // dropped
+	logger.Warn("main warn")                               // logged
+	logger.Named("dht").Warn("dht warn")                   // dropped
+	logger.Named("dht").Named("mainline").Error("dht err") // logged
+	logger.Named("persistence").Debug("persistence debug") // logged
+	logger.Named("metadata").Info("metadata info")         // dropped
+
+	var messages []string
+	for _, entry := range logs.All() {
+		messages = append(messages, entry.Message)
+	}
+	expected := []string{"main warn", "dht err", "persistence debug"}
+	if len(messages) != len(expected) {
+		t.Fatalf("Logged entries are wrong! Got %v (expected %v)", messages, expected)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Errorf("Logged entries are wrong! Got %v (expected %v)", messages, expected)
+		}
+	}
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"math/rand"
-	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/pkg/errors"
 	"github.com/pkg/profile"
 
 	"github.com/jessevdk/go-flags"
@@ -17,9 +18,14 @@ import (
 	"github.com/Wessie/appdirs"
 
 	"github.com/boramalper/magnetico/cmd/magneticod/bittorrent/metadata"
-	"github.com/boramalper/magnetico/cmd/magneticod/dht"
+	"github.com/boramalper/magnetico/cmd/magneticod/crawler"
+	"github.com/boramalper/magnetico/cmd/magneticod/dht/mainline"
 
+	"github.com/boramalper/magnetico/pkg/dump"
+	"github.com/boramalper/magnetico/pkg/geoip"
+	"github.com/boramalper/magnetico/pkg/notify"
 	"github.com/boramalper/magnetico/pkg/persistence"
+	"github.com/boramalper/magnetico/pkg/service"
 	"github.com/boramalper/magnetico/pkg/util"
 )
 
@@ -29,16 +35,84 @@ type opFlags struct {
 	IndexerAddrs        []string
 	IndexerInterval     time.Duration
 	IndexerMaxNeighbors uint
+	IndexerResponder    bool
+	IndexerStrict       bool
+	Keyspace            mainline.Keyspace
 
-	LeechMaxN int
+	LeechMaxN   int
+	FetchWindow time.Duration
+	// TextMaxSize is the maximum size (in bytes) of the texts to fetch; zero if not fetching them.
+	TextMaxSize int
+	Limits      metadata.Limits
+
+	DedupeCapacity int
+
+	// Claimant is the name of the instance to claim the fetches by; it is empty if not claiming.
+	Claimant string
+	ClaimTTL time.Duration
+
+	ClusterSize int
+
+	NAT string
+
+	RecordPath      string
+	RecordRate      uint
+	RecordAnonymize bool
+
+	SessionPath string
+
+	Discoveries    bool
+	DiscoveryPeers persistence.PeerPrivacy
+	GeoIP          *geoip.Reader
+
+	// Notifier is nil if no one is to be notified of the torrents.
+	Notifier *notify.Notifier
+
+	// Privacy is true if no IP address of the peers (nor of the nodes) is to be persisted or logged.
+	Privacy bool
+
+	// ReplayPath is the path of the recording to replay instead of crawling; it is empty if not
+	// replaying.
+	ReplayPath string
+
+	// ExportPath and ImportPath are the paths of the dumps (in DumpFormat) to export the database to,
+	// or to import into the database, instead of crawling; they are empty if not exporting or
+	// importing respectively.
+	ExportPath string
+	ImportPath string
+	DumpFormat dump.Format
+
+	// ScheduledExport is the destination of the scheduled exports (see dump.ParseDestination); it is
+	// nil if the torrents are not exported periodically.
+	ScheduledExport         dump.Destination
+	ScheduledExportInterval time.Duration
+	ScheduledExportState    string
 
 	Verbosity int
 	Profile   string
+	// DebugAddr is the address to serve the runtime diagnostics on; it is empty if disabled.
+	DebugAddr string
+
+	Log logConfig
 }
 
 var compiledOn string
 
+var serviceConfig = service.Config{
+	Name:        "magneticod",
+	DisplayName: "magneticod",
+	Description: "Autonomous (self-hosted) BitTorrent DHT search engine daemon",
+}
+
 func main() {
+	if service.IsCommand(os.Args) {
+		if err := service.Command(serviceConfig, os.Args); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	loggerLevel := zap.NewAtomicLevel()
 	// Logging levels: ("debug", "info", "warn", "error", "dpanic", "panic", and "fatal").
 	logger := zap.New(zapcore.NewCore(
@@ -56,6 +130,12 @@ func main() {
 		return
 	}
 
+	if logger, err = newLogger(opFlags.Log, loggerLevel); err != nil {
+		zap.L().Fatal("Could not set up logging", zap.Error(err))
+	}
+	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
+
 	zap.L().Info("magneticod v0.12.0 has been started.")
 	zap.L().Info("Copyright (C) 2017-2020  Mert Bora ALPER <bora@boramalper.org>.")
 	zap.L().Info("Dedicated to Cemile Binay, in whose hands I thrived.")
@@ -85,46 +165,84 @@ func main() {
 		).Stop()
 	}
 
+	if opFlags.DebugAddr != "" {
+		go func() {
+			zap.S().Infof("Serving the runtime diagnostics on http://%s/debug/", opFlags.DebugAddr)
+			if err := http.ListenAndServe(opFlags.DebugAddr, util.DebugHandler()); err != nil {
+				zap.L().Error("Could not serve the runtime diagnostics", zap.Error(err))
+			}
+		}()
+	}
+
 	// Initialise the random number generator
 	rand.Seed(time.Now().UnixNano())
 
-	// Handle Ctrl-C gracefully.
+	// Handle Ctrl-C gracefully, and the stop requests of the service managers likewise.
 	interruptChan := make(chan os.Signal, 1)
-	signal.Notify(interruptChan, os.Interrupt)
+	signal.Notify(interruptChan, os.Interrupt, syscall.SIGTERM)
+	service.Notify(serviceConfig.Name, interruptChan)
+	defer service.Stopped()
 
 	database, err := persistence.MakeDatabase(opFlags.DatabaseURL, logger)
 	if err != nil {
 		logger.Fatal("Could not open the database", zap.String("url", opFlags.DatabaseURL), zap.Error(err))
 	}
 
-	trawlingManager := dht.NewManager(opFlags.IndexerAddrs, opFlags.IndexerInterval, opFlags.IndexerMaxNeighbors)
-	metadataSink := metadata.NewSink(5*time.Second, opFlags.LeechMaxN)
-
-	// The Event Loop
-	for stopped := false; !stopped; {
-		select {
-		case result := <-trawlingManager.Output():
-			infoHash := result.InfoHash()
-
-			zap.L().Debug("Trawled!", util.HexField("infoHash", infoHash[:]))
-			exists, err := database.DoesTorrentExist(infoHash[:])
-			if err != nil {
-				zap.L().Fatal("Could not check whether torrent exists!", zap.Error(err))
-			} else if !exists {
-				metadataSink.Sink(result)
-			}
+	if opFlags.ReplayPath != "" {
+		replay(database, opFlags.ReplayPath, opFlags.DedupeCapacity)
+		return
+	}
+	if opFlags.ExportPath != "" {
+		exportDump(database, opFlags.ExportPath, opFlags.DumpFormat)
+		return
+	}
+	if opFlags.ImportPath != "" {
+		importDump(database, opFlags.ImportPath, opFlags.DumpFormat)
+		return
+	}
 
-		case md := <-metadataSink.Drain():
-			if err := database.AddNewTorrent(md.InfoHash, md.Name, md.Files, md.Metadata); err != nil {
-				zap.L().Fatal("Could not add new torrent to the database",
-					util.HexField("infohash", md.InfoHash), zap.Error(err))
-			}
-			zap.L().Info("Fetched!", zap.String("name", md.Name), util.HexField("infoHash", md.InfoHash))
+	c := crawler.New(database, crawler.Config{
+		IndexerAddrs:        opFlags.IndexerAddrs,
+		IndexerInterval:     opFlags.IndexerInterval,
+		IndexerMaxNeighbors: opFlags.IndexerMaxNeighbors,
+		IndexerResponder:    opFlags.IndexerResponder,
+		IndexerStrict:       opFlags.IndexerStrict,
+		Keyspace:            opFlags.Keyspace,
+		LeechMaxN:           opFlags.LeechMaxN,
+		FetchWindow:         opFlags.FetchWindow,
+		TextMaxSize:         opFlags.TextMaxSize,
+		Limits:              opFlags.Limits,
+		DedupeCapacity:      opFlags.DedupeCapacity,
+		Claimant:            opFlags.Claimant,
+		ClaimTTL:            opFlags.ClaimTTL,
+		ClusterSize:         opFlags.ClusterSize,
+		NAT:                 opFlags.NAT,
+		RecordPath:          opFlags.RecordPath,
+		RecordRate:          opFlags.RecordRate,
+		RecordAnonymize:     opFlags.RecordAnonymize,
+		SessionPath:         opFlags.SessionPath,
+		Discoveries:         opFlags.Discoveries,
+		DiscoveryPeers:      opFlags.DiscoveryPeers,
+		GeoIP:               opFlags.GeoIP,
+		Notifier:            opFlags.Notifier,
+		Privacy:             opFlags.Privacy,
+	})
+	go c.Run()
+
+	var scheduledExport *dump.ScheduledExport
+	if opFlags.ScheduledExport != nil {
+		scheduledExport = dump.NewScheduledExport(database, opFlags.ScheduledExport, opFlags.DumpFormat,
+			opFlags.ScheduledExportInterval, opFlags.ScheduledExportState)
+		go scheduledExport.Run()
+	}
 
-		case <-interruptChan:
-			trawlingManager.Terminate()
-			stopped = true
-		}
+	<-interruptChan
+	c.Terminate()
+	if scheduledExport != nil {
+		scheduledExport.Terminate()
+	}
+	if opFlags.Notifier != nil {
+		opFlags.Notifier.Close()
 	}
 
 	if err = database.Close(); err != nil {
@@ -139,11 +257,66 @@ func parseFlags() (*opFlags, error) {
 		IndexerAddrs        []string `long:"indexer-addr" description:"Address(es) to be used by indexing DHT nodes." default:"0.0.0.0:0"`
 		IndexerInterval     uint     `long:"indexer-interval" description:"Indexing interval in integer seconds." default:"1"`
 		IndexerMaxNeighbors uint     `long:"indexer-max-neighbors" description:"Maximum number of neighbors of an indexer." default:"1000"`
+		IndexerResponder    bool     `long:"indexer-responder" description:"Respond to the queries of the other DHT nodes, and store their announces."`
+		IndexerStrict       bool     `long:"indexer-strict" description:"Drop the DHT messages that are not strictly valid, rather than tolerating the common deviations."`
+		Keyspace            string   `long:"keyspace" description:"Crawl only the infohashes of the prefix (in hexadecimal, e.g. a0) or of the range of prefixes (e.g. a0-bf), towards which the indexers lean too."`
+
+		LeechMaxN   uint `long:"leech-max-n" description:"Maximum number of leeches." default:"50"`
+		IndexTexts  bool `long:"index-texts" description:"Fetch the small .nfo (else .txt) file of the torrents too, by downloading the pieces that cover it from the peers, and index its contents for search."`
+		TextMaxSize uint `long:"text-max-size" description:"Maximum size (in KiB) of the files to fetch with --index-texts." default:"64"`
+
+		MetadataMaxSize uint `long:"metadata-max-size" description:"Maximum size (in KiB) of the metadata of the torrents to accept." default:"10240"`
+		MaxFiles        uint `long:"max-files" description:"Maximum number of the files of the torrents to accept (0 is unlimited)." default:"100000"`
+		MaxPathLength   uint `long:"max-path-length" description:"Maximum length (in bytes) of the paths of the files, beyond which they are truncated (0 is unlimited)." default:"1024"`
+
+		FetchWindow uint `long:"fetch-window" description:"Time in integer seconds that the infohashes wait to be fetched while the leeches are busy (the most announced ones are fetched first)." default:"60"`
+
+		DedupeCapacity uint `long:"dedupe-capacity" description:"Number of the recently seen infohashes to remember, lest they are processed again (0 disables)." default:"100000"`
+
+		ClaimFetches bool   `long:"claim-fetches" description:"Claim the fetches of the torrents in the database, so that the instances that share the database do not fetch the same torrents."`
+		ClaimTTL     uint   `long:"claim-ttl" description:"Time in integer seconds that the claims of the fetches last." default:"600"`
+		InstanceName string `long:"instance-name" description:"Name of the instance to claim the fetches by (the hostname and the process ID by default)."`
+
+		ClusterSize uint `long:"cluster-size" description:"Number of the instances that share the (PostgreSQL) database, among which the keyspace of the DHT is partitioned (0 disables)."`
+
+		Record          string `long:"record" description:"Record (a sample of) the DHT messages received to the file, to be analysed offline or replayed (see --replay)."`
+		RecordRate      uint   `long:"record-rate" description:"Maximum number of the messages recorded per second (0 is unlimited)." default:"100"`
+		RecordAnonymize bool   `long:"record-anonymize" description:"Replace the IP addresses in the recording with their pseudonyms."`
+
+		SessionFile string `long:"session-file" description:"Save the infohashes waiting to be fetched (and their peers) to the file periodically and on exit, and resume them on start."`
 
-		LeechMaxN uint `long:"leech-max-n" description:"Maximum number of leeches." default:"50"`
+		Discoveries   bool   `long:"discoveries" description:"Record when the torrents were first seen (to the millisecond) and by which peers, for studying the DHT (see --discovery-peer)."`
+		DiscoveryPeer string `long:"discovery-peer" description:"How much of the peers to record along with the discoveries: none, their /24 (IPv4) or /48 (IPv6) subnet, or their full address and port." choice:"none" choice:"subnet" choice:"full" default:"none"`
+		GeoIPDB       string `long:"geoip-db" description:"Record the countries of the peers along with the discoveries too, looked up in the MaxMind DB (e.g. GeoLite2-Country.mmdb) at the path."`
+
+		Notify  []string `long:"notify" description:"Notify the target(s) of the URL(s) of the torrents as soon as they are fetched (e.g. mqtt://broker:1883/magnetico, or discord+https://discord.com/api/webhooks/<ID>/<TOKEN>)."`
+		Watches []string `long:"watch" description:"Notify the targets of the torrents that match the watch(es) in particular, in the form of NAME=QUERY (e.g. ubuntu=ubuntu -beta)."`
+
+		Privacy bool `long:"privacy" description:"Guarantee that no IP address of the peers (nor of the nodes) is persisted or logged, refusing to start otherwise."`
+
+		Replay string `long:"replay" description:"Replay the recorded DHT messages (a recording of magnetico or a pcap file) into the (scratch!) database instead of crawling, and exit."`
+
+		Export     string `long:"export" description:"Export the torrents (that are not flagged) to the file (- for stdout) in the dump format instead of crawling, and exit."`
+		Import     string `long:"import" description:"Import the torrents of the dump in the dump format (- for stdin) into the database instead of crawling, and exit."`
+		DumpFormat string `long:"dump-format" description:"Format of the dumps to export or import." choice:"torrents-csv" choice:"dht-dump" default:"torrents-csv"`
+
+		ScheduledExport         string `long:"scheduled-export" description:"Export the torrents discovered since the last export periodically (in the dump format) to the directory, or to the http(s):// or s3:// URL."`
+		ScheduledExportInterval uint   `long:"scheduled-export-interval" description:"Interval of the scheduled exports in integer seconds." default:"86400"`
+		ScheduledExportState    string `long:"scheduled-export-state" description:"Path of the file to save the position of the last scheduled export to."`
+
+		NAT string `long:"nat" description:"Map the port(s) of the indexer(s) on the router using UPnP, NAT-PMP, or either (any)." choice:"none" choice:"any" choice:"upnp" choice:"natpmp" default:"none"`
 
 		Verbose []bool `short:"v" long:"verbose" description:"Increases verbosity."`
 		Profile string `long:"profile" description:"Enable profiling." choice:"cpu" choice:"memory"`
+
+		DebugAddr string `long:"debug-addr" description:"Address (e.g. 127.0.0.1:6060) to serve the runtime diagnostics (pprof, expvar, and heap statistics) on, without authorisation."`
+
+		LogLevels     []string `long:"log-level" description:"Level of a subsystem (dht, metadata, crawler, persistence, or dump) as <SUBSYSTEM>=<LEVEL>, overriding the verbosity (can be supplied multiple times)"`
+		LogFormat     string   `long:"log-format" description:"Format of the log." choice:"console" choice:"json" default:"console"`
+		LogFile       string   `long:"log-file" description:"Path of the log file (instead of stderr)."`
+		LogMaxSize    uint     `long:"log-max-size" description:"Size (in MiB) after which the log file is rotated (0 disables)." default:"100"`
+		LogMaxBackups uint     `long:"log-max-backups" description:"Number of the rotated log files to keep." default:"5"`
+		LogSampling   uint     `long:"log-sampling" description:"Log only this many of the identical messages per second, and every so many of them thereafter (0 disables)."`
 	}
 
 	opF := new(opFlags)
@@ -166,7 +339,7 @@ func parseFlags() (*opFlags, error) {
 		opF.DatabaseURL = cmdF.DatabaseURL
 	}
 
-	if err = checkAddrs(cmdF.IndexerAddrs); err != nil {
+	if err = crawler.CheckAddrs(cmdF.IndexerAddrs); err != nil {
 		zap.S().Fatalf("Of argument (list) `trawler-ml-addr`", zap.Error(err))
 	} else {
 		opF.IndexerAddrs = cmdF.IndexerAddrs
@@ -174,6 +347,11 @@ func parseFlags() (*opFlags, error) {
 
 	opF.IndexerInterval = time.Duration(cmdF.IndexerInterval) * time.Second
 	opF.IndexerMaxNeighbors = cmdF.IndexerMaxNeighbors
+	opF.IndexerResponder = cmdF.IndexerResponder
+	opF.IndexerStrict = cmdF.IndexerStrict
+	if opF.Keyspace, err = mainline.ParseKeyspace(cmdF.Keyspace); err != nil {
+		zap.S().Fatalf("Of argument `keyspace`: %s", err.Error())
+	}
 
 	opF.LeechMaxN = int(cmdF.LeechMaxN)
 	if opF.LeechMaxN > 1000 {
@@ -183,21 +361,208 @@ func parseFlags() (*opFlags, error) {
 		)
 	}
 
+	if cmdF.IndexTexts {
+		if cmdF.TextMaxSize == 0 || cmdF.TextMaxSize*1024 > persistence.MaxTextSize {
+			zap.S().Fatalf("Of argument `text-max-size`: must be between 1 and %d", persistence.MaxTextSize/1024)
+		}
+		opF.TextMaxSize = int(cmdF.TextMaxSize) * 1024
+	}
+
+	if cmdF.MetadataMaxSize == 0 || cmdF.MetadataMaxSize*1024 > metadata.MAX_METADATA_SIZE {
+		zap.S().Fatalf("Of argument `metadata-max-size`: must be between 1 and %d", metadata.MAX_METADATA_SIZE/1024)
+	}
+	opF.Limits = metadata.Limits{
+		MaxMetadataSize: int(cmdF.MetadataMaxSize) * 1024,
+		MaxFiles:        int(cmdF.MaxFiles),
+		MaxPathLength:   int(cmdF.MaxPathLength),
+	}
+
+	opF.FetchWindow = time.Duration(cmdF.FetchWindow) * time.Second
+
+	opF.DedupeCapacity = int(cmdF.DedupeCapacity)
+
+	if cmdF.ClaimFetches {
+		if cmdF.ClaimTTL == 0 {
+			zap.S().Fatalf("Of argument `claim-ttl`: must be greater than 0")
+		}
+		opF.ClaimTTL = time.Duration(cmdF.ClaimTTL) * time.Second
+		opF.Claimant = cmdF.InstanceName
+		if opF.Claimant == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				zap.S().Fatalf("Could not get the hostname (supply `instance-name` instead): %s", err.Error())
+			}
+			opF.Claimant = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		}
+	}
+
+	opF.ClusterSize = int(cmdF.ClusterSize)
+
+	opF.RecordPath = cmdF.Record
+	opF.RecordRate = cmdF.RecordRate
+	opF.RecordAnonymize = cmdF.RecordAnonymize
+
+	opF.SessionPath = cmdF.SessionFile
+
+	opF.Discoveries = cmdF.Discoveries
+	if opF.DiscoveryPeers, err = persistence.ParsePeerPrivacy(cmdF.DiscoveryPeer); err != nil {
+		zap.S().Fatalf("Of argument `discovery-peer`: %s", err.Error())
+	}
+	if cmdF.GeoIPDB != "" {
+		if !cmdF.Discoveries {
+			zap.S().Fatalf("Of argument `geoip-db`: requires `discoveries`")
+		}
+		if opF.GeoIP, err = geoip.Open(cmdF.GeoIPDB); err != nil {
+			zap.S().Fatalf("Of argument `geoip-db`: %s", err.Error())
+		}
+	}
+
+	if len(cmdF.Notify) > 0 {
+		var subscriptions []*notify.Subscription
+		for _, rawURL := range cmdF.Notify {
+			subscription, err := notify.ParseTarget(rawURL)
+			if err != nil {
+				zap.S().Fatalf("Of argument (list) `notify`: %s", err.Error())
+			}
+			subscriptions = append(subscriptions, subscription)
+		}
+		var watches []notify.Watch
+		for _, flag := range cmdF.Watches {
+			watch, err := notify.ParseWatch(flag)
+			if err != nil {
+				zap.S().Fatalf("Of argument (list) `watch`: %s", err.Error())
+			}
+			watches = append(watches, watch)
+		}
+		if opF.Notifier, err = notify.New(subscriptions, watches); err != nil {
+			zap.S().Fatalf("Of argument (list) `notify`: %s", err.Error())
+		}
+	} else if len(cmdF.Watches) > 0 {
+		zap.S().Fatalf("Of argument (list) `watch`: requires `notify`")
+	}
+
+	opF.Privacy = cmdF.Privacy
+	opF.Log.Privacy = cmdF.Privacy
+
+	opF.ReplayPath = cmdF.Replay
+
+	opF.ExportPath = cmdF.Export
+	opF.ImportPath = cmdF.Import
+	if opF.DumpFormat, err = dump.ParseFormat(cmdF.DumpFormat); err != nil {
+		zap.S().Fatalf("Of argument `dump-format`: %s", err.Error())
+	}
+
+	if cmdF.ScheduledExport != "" {
+		if opF.ScheduledExport, err = dump.ParseDestination(cmdF.ScheduledExport); err != nil {
+			zap.S().Fatalf("Of argument `scheduled-export`: %s", err.Error())
+		}
+		if cmdF.ScheduledExportInterval == 0 {
+			zap.S().Fatalf("Of argument `scheduled-export-interval`: must be greater than 0")
+		}
+	}
+	opF.ScheduledExportInterval = time.Duration(cmdF.ScheduledExportInterval) * time.Second
+	if cmdF.ScheduledExportState == "" {
+		opF.ScheduledExportState = appdirs.UserDataDir("magneticod", "", "", false) + "/export-state.json"
+	} else {
+		opF.ScheduledExportState = cmdF.ScheduledExportState
+	}
+
+	if cmdF.NAT != "none" {
+		opF.NAT = cmdF.NAT
+	}
+
 	opF.Verbosity = len(cmdF.Verbose)
 
 	opF.Profile = cmdF.Profile
+	opF.DebugAddr = cmdF.DebugAddr
+
+	opF.Log.Levels = make(map[string]zapcore.Level)
+	for _, flag := range cmdF.LogLevels {
+		subsystem, level, err := parseLogLevel(flag)
+		if err != nil {
+			zap.S().Fatalf("Of argument (list) `log-level`: %s", err.Error())
+		}
+		opF.Log.Levels[subsystem] = level
+	}
+	opF.Log.JSON = cmdF.LogFormat == "json"
+	opF.Log.Path = cmdF.LogFile
+	opF.Log.MaxSize = int64(cmdF.LogMaxSize) << 20
+	opF.Log.MaxBackups = int(cmdF.LogMaxBackups)
+	opF.Log.Sampling = int(cmdF.LogSampling)
 
 	return opF, nil
 }
 
-func checkAddrs(addrs []string) error {
-	for i, addr := range addrs {
-		// We are using ResolveUDPAddr but it works equally well for checking TCPAddr(esses) as
-		// well.
-		_, err := net.ResolveUDPAddr("udp", addr)
-		if err != nil {
-			return errors.Wrapf(err, "%d(th) address (%s) error", i+1, addr)
+// replay replays the recording into the database, and reports the throughput.
+func replay(database persistence.Database, path string, dedupeCapacity int) {
+	defer func() {
+		if err := database.Close(); err != nil {
+			zap.L().Error("Could not close database!", zap.Error(err))
+		}
+	}()
+
+	file, err := os.Open(path)
+	if err != nil {
+		zap.L().Fatal("Could not open the recording", zap.Error(err))
+	}
+	defer file.Close()
+
+	stats, err := crawler.Replay(database, file, dedupeCapacity)
+	if err != nil {
+		zap.L().Error("Could not replay the recording", zap.Error(err))
+	}
+	fmt.Printf("Replayed %d messages (%d invalid) in %s, yielding %d infohashes:\n",
+		stats.NMessages, stats.NInvalid, stats.Elapsed, stats.NResults)
+	fmt.Printf("  %d duplicates skipped\n", stats.NDuplicates)
+	fmt.Printf("  %d torrents added (%.1f per second)\n", stats.NAdded, float64(stats.NAdded)/stats.Elapsed.Seconds())
+}
+
+// exportDump exports the database to the dump at path (or to stdout if path is "-").
+func exportDump(database persistence.Database, path string, format dump.Format) {
+	defer func() {
+		if err := database.Close(); err != nil {
+			zap.L().Error("Could not close database!", zap.Error(err))
+		}
+	}()
+
+	file := os.Stdout
+	if path != "-" {
+		var err error
+		if file, err = os.Create(path); err != nil {
+			zap.L().Fatal("Could not create the dump", zap.Error(err))
+		}
+		defer file.Close()
+	}
+
+	n, _, err := dump.Export(database, file, format, nil)
+	if err != nil {
+		zap.L().Error("Could not export the database", zap.Error(err))
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d torrents as %s\n", n, format)
+}
+
+// importDump imports the dump at path (or from stdin if path is "-") into the database.
+func importDump(database persistence.Database, path string, format dump.Format) {
+	defer func() {
+		if err := database.Close(); err != nil {
+			zap.L().Error("Could not close database!", zap.Error(err))
+		}
+	}()
+
+	file := os.Stdin
+	if path != "-" {
+		var err error
+		if file, err = os.Open(path); err != nil {
+			zap.L().Fatal("Could not open the dump", zap.Error(err))
 		}
+		defer file.Close()
+	}
+
+	stats, err := dump.Import(database, file, format)
+	if err != nil {
+		zap.L().Error("Could not import the dump", zap.Error(err))
 	}
-	return nil
+	fmt.Printf("Imported %d records (%d invalid):\n", stats.NRecords, stats.NInvalid)
+	fmt.Printf("  %d torrents existing skipped\n", stats.NExisting)
+	fmt.Printf("  %d torrents added\n", stats.NAdded)
 }
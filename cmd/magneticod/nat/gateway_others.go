@@ -0,0 +1,12 @@
+// +build !linux
+
+package nat
+
+import (
+	"fmt"
+	"net"
+)
+
+func defaultGateway() (net.IP, error) {
+	return nil, fmt.Errorf("discovering the default gateway is not supported on this platform")
+}
@@ -0,0 +1,74 @@
+// Package nat maps the ports of the router (i.e. the NAT gateway) to the ports of this host using
+// either UPnP IGD or NAT-PMP, so that the DHT nodes behind home routers can receive the inbound
+// traffic (which is what the most of the discoveries are owed to) without manual port forwarding.
+package nat
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Mapper maps the ports of the router to the ports of this host.
+type Mapper interface {
+	// Name is the name of the protocol, for the logs.
+	Name() string
+	ExternalIP() (net.IP, error)
+	// AddPortMapping maps an external port (the same one as the internal port, if available) to
+	// the internal port for the lifetime, and returns the external port.
+	AddPortMapping(protocol string, internalPort int, description string, lifetime time.Duration) (int, error)
+	DeletePortMapping(protocol string, internalPort int, externalPort int) error
+}
+
+// Discover discovers the router using the method, which is either "upnp", "natpmp", or "any"
+// (which tries NAT-PMP first, and then UPnP).
+func Discover(method string, timeout time.Duration) (Mapper, error) {
+	switch method {
+	case "natpmp":
+		return discoverNATPMP(timeout)
+
+	case "upnp":
+		return discoverUPnP(timeout)
+
+	case "any":
+		mapper, err := discoverNATPMP(timeout)
+		if err == nil {
+			return mapper, nil
+		}
+		mapper, err2 := discoverUPnP(timeout)
+		if err2 != nil {
+			return nil, fmt.Errorf("neither NAT-PMP (%s) nor UPnP (%s) is available", err.Error(), err2.Error())
+		}
+		return mapper, nil
+
+	default:
+		return nil, fmt.Errorf("unknown method `%s` (expected upnp, natpmp, or any)", method)
+	}
+}
+
+func discoverNATPMP(timeout time.Duration) (Mapper, error) {
+	gateway, err := defaultGateway()
+	if err != nil {
+		return nil, errors.Wrap(err, "defaultGateway")
+	}
+	mapper := &natPMP{gateway: &net.UDPAddr{IP: gateway, Port: natPMPPort}, timeout: timeout}
+	// Routers that do not support NAT-PMP do not respond at all, hence the external address
+	// request doubles as the discovery.
+	if _, err = mapper.ExternalIP(); err != nil {
+		return nil, err
+	}
+	return mapper, nil
+}
+
+// localIPTowards returns the IP address of this host that is used to reach the host, without
+// sending any packets.
+func localIPTowards(host string) (net.IP, error) {
+	conn, err := net.Dial("udp4", net.JoinHostPort(host, "9"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
@@ -0,0 +1,141 @@
+package nat
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRoutes(t *testing.T) {
+	routes := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+		"eth0\t0000A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n" +
+		"eth0\t00000000\t0101A8C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n"
+
+	gateway, err := parseRoutes(strings.NewReader(routes))
+	if err != nil {
+		t.Fatalf("Could not parse the routes! %s", err.Error())
+	}
+	if !gateway.Equal(net.IPv4(192, 168, 1, 1)) {
+		t.Errorf("Gateway is wrong! Got %s (expected 192.168.1.1)", gateway.String())
+	}
+
+	if _, err = parseRoutes(strings.NewReader(routes[:strings.LastIndex(routes[:len(routes)-1], "\n")+1])); err == nil {
+		t.Errorf("Routes without a default route should have been rejected")
+	}
+}
+
+func TestNATPMP(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("Skipping due to an error during initialization!")
+	}
+	defer conn.Close()
+
+	// A fake gateway whose external IP is 203.0.113.7, and which maps every internal port to the
+	// next one.
+	go func() {
+		buffer := make([]byte, 16)
+		for {
+			n, addr, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			response := make([]byte, 16)
+			response[1] = 128 + buffer[1]
+			if buffer[1] == 0 && n == 2 {
+				copy(response[8:12], net.IPv4(203, 0, 113, 7).To4())
+				_, _ = conn.WriteToUDP(response[:12], addr)
+			} else {
+				copy(response[8:10], buffer[4:6])
+				binary.BigEndian.PutUint16(response[10:12], binary.BigEndian.Uint16(buffer[4:6])+1)
+				copy(response[12:16], buffer[8:12])
+				_, _ = conn.WriteToUDP(response, addr)
+			}
+		}
+	}()
+
+	n := &natPMP{gateway: conn.LocalAddr().(*net.UDPAddr), timeout: time.Second}
+	ip, err := n.ExternalIP()
+	if err != nil {
+		t.Fatalf("Could not get the external IP! %s", err.Error())
+	}
+	if !ip.Equal(net.IPv4(203, 0, 113, 7)) {
+		t.Errorf("External IP is wrong! Got %s (expected 203.0.113.7)", ip.String())
+	}
+
+	port, err := n.AddPortMapping("udp", 6881, "magneticod", time.Hour)
+	if err != nil {
+		t.Fatalf("Could not map the port! %s", err.Error())
+	}
+	if port != 6882 {
+		t.Errorf("External port is wrong! Got %d (expected 6882)", port)
+	}
+}
+
+func TestUPnP(t *testing.T) {
+	var actions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rootDesc.xml":
+			_, _ = w.Write([]byte(`<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+	<device>
+		<deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+		<deviceList><device>
+			<deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+			<deviceList><device>
+				<deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+				<serviceList><service>
+					<serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+					<controlURL>/ctl/IPConn</controlURL>
+				</service></serviceList>
+			</device></deviceList>
+		</device></deviceList>
+	</device>
+</root>`))
+
+		case "/ctl/IPConn":
+			body, _ := ioutil.ReadAll(r.Body)
+			actions = append(actions, r.Header.Get("SOAPAction"))
+			if strings.Contains(string(body), "GetExternalIPAddress") {
+				_, _ = w.Write([]byte(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewExternalIPAddress>203.0.113.7</NewExternalIPAddress>
+</u:GetExternalIPAddressResponse></s:Body></s:Envelope>`))
+			}
+
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	u, err := newUPnP(server.Client(), server.URL+"/rootDesc.xml")
+	if err != nil {
+		t.Fatalf("Could not read the device description! %s", err.Error())
+	}
+	if u.controlURL != server.URL+"/ctl/IPConn" {
+		t.Errorf("Control URL is wrong! Got %s", u.controlURL)
+	}
+
+	ip, err := u.ExternalIP()
+	if err != nil {
+		t.Fatalf("Could not get the external IP! %s", err.Error())
+	}
+	if !ip.Equal(net.IPv4(203, 0, 113, 7)) {
+		t.Errorf("External IP is wrong! Got %s (expected 203.0.113.7)", ip.String())
+	}
+
+	if _, err = u.AddPortMapping("udp", 6881, "magneticod", time.Hour); err != nil {
+		t.Fatalf("Could not map the port! %s", err.Error())
+	}
+	if len(actions) != 2 || actions[1] != `"urn:schemas-upnp-org:service:WANIPConnection:1#AddPortMapping"` {
+		t.Errorf("SOAP actions are wrong! Got %v", actions)
+	}
+}
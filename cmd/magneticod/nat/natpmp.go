@@ -0,0 +1,100 @@
+package nat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const natPMPPort = 5351
+
+// natPMP implements NAT-PMP (RFC 6886).
+type natPMP struct {
+	gateway *net.UDPAddr
+	timeout time.Duration
+}
+
+func (n *natPMP) Name() string { return "NAT-PMP" }
+
+func (n *natPMP) ExternalIP() (net.IP, error) {
+	response, err := n.request([]byte{0, 0}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IPv4(response[8], response[9], response[10], response[11]), nil
+}
+
+func (n *natPMP) AddPortMapping(protocol string, internalPort int, description string, lifetime time.Duration) (int, error) {
+	response, err := n.mapPort(protocol, internalPort, internalPort, lifetime)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(response[10:12])), nil
+}
+
+func (n *natPMP) DeletePortMapping(protocol string, internalPort int, externalPort int) error {
+	// The external port must be zero when deleting (RFC 6886, Section 3.4).
+	_, err := n.mapPort(protocol, internalPort, 0, 0)
+	return err
+}
+
+func (n *natPMP) mapPort(protocol string, internalPort int, externalPort int, lifetime time.Duration) ([]byte, error) {
+	request := make([]byte, 12)
+	switch strings.ToUpper(protocol) {
+	case "UDP":
+		request[1] = 1
+	case "TCP":
+		request[1] = 2
+	default:
+		return nil, fmt.Errorf("unknown protocol `%s`", protocol)
+	}
+	binary.BigEndian.PutUint16(request[4:6], uint16(internalPort))
+	binary.BigEndian.PutUint16(request[6:8], uint16(externalPort))
+	binary.BigEndian.PutUint32(request[8:12], uint32(lifetime.Seconds()))
+	return n.request(request, 16)
+}
+
+// request sends the request to the gateway, and returns the response of the expected length, after
+// checking its opcode and result code.
+func (n *natPMP) request(request []byte, length int) ([]byte, error) {
+	conn, err := net.DialUDP("udp4", nil, n.gateway)
+	if err != nil {
+		return nil, errors.Wrap(err, "DialUDP")
+	}
+	defer conn.Close()
+
+	response := make([]byte, 16)
+	// The request is retransmitted with the timeout doubled each time (RFC 6886, Section 3.1),
+	// starting from 250 ms.
+	deadline := time.Now().Add(n.timeout)
+	for wait := 250 * time.Millisecond; time.Now().Before(deadline); wait *= 2 {
+		if _, err = conn.Write(request); err != nil {
+			return nil, errors.Wrap(err, "Write")
+		}
+		if until := time.Now().Add(wait); until.Before(deadline) {
+			_ = conn.SetReadDeadline(until)
+		} else {
+			_ = conn.SetReadDeadline(deadline)
+		}
+
+		m, err := conn.Read(response)
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrap(err, "Read")
+		}
+		if m < length || response[1] != 128+request[1] {
+			continue // not a response to the request
+		}
+		if result := binary.BigEndian.Uint16(response[2:4]); result != 0 {
+			return nil, fmt.Errorf("NAT-PMP gateway responded with result code %d", result)
+		}
+		return response[:length], nil
+	}
+
+	return nil, fmt.Errorf("NAT-PMP gateway %s did not respond", n.gateway.IP.String())
+}
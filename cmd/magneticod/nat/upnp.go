@@ -0,0 +1,244 @@
+package nat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ssdpAddr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// upnpServiceTypes are the types of the services (of an Internet Gateway Device) that can map
+// ports, in the order of preference.
+var upnpServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// upnp implements the port mapping of the UPnP Internet Gateway Device (IGD) protocol.
+type upnp struct {
+	controlURL  string
+	serviceType string
+	// localIP is the address of this host that the ports are mapped to.
+	localIP net.IP
+	http    *http.Client
+}
+
+func (u *upnp) Name() string { return "UPnP" }
+
+func discoverUPnP(timeout time.Duration) (Mapper, error) {
+	locations, err := searchSSDP(timeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "searchSSDP")
+	}
+
+	client := &http.Client{Timeout: timeout}
+	for _, location := range locations {
+		u, err := newUPnP(client, location)
+		if err == nil {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("no Internet Gateway Device is found")
+}
+
+// searchSSDP multicasts an SSDP search for the Internet Gateway Devices, and returns the locations
+// (i.e. the URLs of the descriptions) of the devices that responded within the timeout.
+func searchSSDP(timeout time.Duration) ([]string, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	if _, err = conn.WriteToUDP([]byte(search), ssdpAddr); err != nil {
+		return nil, err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var locations []string
+	buffer := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buffer[:n])), nil)
+		if err != nil {
+			continue
+		}
+		response.Body.Close()
+		if location := response.Header.Get("Location"); location != "" {
+			locations = append(locations, location)
+			// The first device is good enough; the others (if any) are tried only if it is not.
+			_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		}
+	}
+	return locations, nil
+}
+
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// newUPnP reads the description of the device at the location, and finds the service to map the
+// ports with.
+func newUPnP(client *http.Client, location string) (*upnp, error) {
+	locationURL, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("device responded with %d", response.StatusCode)
+	}
+
+	var description struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err = xml.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&description); err != nil {
+		return nil, errors.Wrap(err, "decode")
+	}
+	base := locationURL
+	if description.URLBase != "" {
+		if base, err = url.Parse(description.URLBase); err != nil {
+			return nil, errors.Wrap(err, "URLBase")
+		}
+	}
+
+	for _, serviceType := range upnpServiceTypes {
+		controlURL := findControlURL(description.Device, serviceType)
+		if controlURL == "" {
+			continue
+		}
+		resolved, err := base.Parse(controlURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "controlURL")
+		}
+		localIP, err := localIPTowards(locationURL.Hostname())
+		if err != nil {
+			return nil, errors.Wrap(err, "localIPTowards")
+		}
+		return &upnp{controlURL: resolved.String(), serviceType: serviceType, localIP: localIP, http: client}, nil
+	}
+	return nil, fmt.Errorf("device does not have a WAN connection service")
+}
+
+func findControlURL(device upnpDevice, serviceType string) string {
+	for _, service := range device.Services {
+		if service.ServiceType == serviceType {
+			return service.ControlURL
+		}
+	}
+	for _, child := range device.Devices {
+		if controlURL := findControlURL(child, serviceType); controlURL != "" {
+			return controlURL
+		}
+	}
+	return ""
+}
+
+func (u *upnp) ExternalIP() (net.IP, error) {
+	var response struct {
+		ExternalIP string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}
+	if err := u.call("GetExternalIPAddress", nil, &response); err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(response.ExternalIP)
+	if ip == nil {
+		return nil, fmt.Errorf("device responded with an invalid external IP `%s`", response.ExternalIP)
+	}
+	return ip, nil
+}
+
+func (u *upnp) AddPortMapping(protocol string, internalPort int, description string, lifetime time.Duration) (int, error) {
+	err := u.call("AddPortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(internalPort)},
+		{"NewProtocol", strings.ToUpper(protocol)},
+		{"NewInternalPort", strconv.Itoa(internalPort)},
+		{"NewInternalClient", u.localIP.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", description},
+		{"NewLeaseDuration", strconv.Itoa(int(lifetime.Seconds()))},
+	}, nil)
+	if err != nil {
+		return 0, err
+	}
+	return internalPort, nil
+}
+
+func (u *upnp) DeletePortMapping(protocol string, internalPort int, externalPort int) error {
+	return u.call("DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(externalPort)},
+		{"NewProtocol", strings.ToUpper(protocol)},
+	}, nil)
+}
+
+// call calls the action of the service with the arguments (in order), and decodes the response
+// into the result, if not nil.
+func (u *upnp) call(action string, arguments [][2]string, result interface{}) error {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:` + action + ` xmlns:u="` + u.serviceType + `">`)
+	for _, argument := range arguments {
+		body.WriteString("<" + argument[0] + ">")
+		_ = xml.EscapeText(&body, []byte(argument[1]))
+		body.WriteString("</" + argument[0] + ">")
+	}
+	body.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+
+	req, err := http.NewRequest("POST", u.controlURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+u.serviceType+`#`+action+`"`)
+
+	res, err := u.http.Do(req)
+	if err != nil {
+		return errors.Wrap(err, action)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("device responded to %s with %d", action, res.StatusCode)
+	}
+	if result != nil {
+		if err = xml.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(result); err != nil {
+			return errors.Wrap(err, "decode")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// clientHashKey is regenerated every time magneticow starts so that the client hashes cannot be
+// reversed (by brute-forcing the IPv4 address space, for instance) even if the database leaks.
+var clientHashKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err.Error())
+	}
+	return key
+}()
+
+// clientHash returns an anonymous identifier of the client that made the request.
+func clientHash(r *http.Request) []byte {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	mac := hmac.New(sha256.New, clientHashKey)
+	_, _ = mac.Write([]byte(host))
+	return mac.Sum(nil)[:16]
+}
+
+// logSearch records the search for the search analytics, if enabled.
+func logSearch(r *http.Request, query string, nResults int, latency time.Duration) {
+	if opts.SearchLogRetention == 0 {
+		return
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return
+	}
+
+	err := database.LogSearch(persistence.SearchLogEntry{
+		ClientHash: clientHash(r),
+		Query:      query,
+		NResults:   uint(nResults),
+		LatencyMs:  float64(latency) / float64(time.Millisecond),
+		SearchedOn: time.Now().Unix(),
+	})
+	if err != nil {
+		zap.L().Warn("Could not log search", zap.Error(err))
+	}
+}
+
+// purgeSearchLog periodically deletes the searches that are older than the retention period.
+func purgeSearchLog() {
+	for ; true; <-time.After(time.Hour) {
+		if err := database.PurgeSearchLog(time.Now().Add(-opts.SearchLogRetention).Unix()); err != nil {
+			zap.L().Warn("Could not purge search log", zap.Error(err))
+		}
+	}
+}
+
+func apiSearchAnalytics(w http.ResponseWriter, r *http.Request) {
+	var aq struct {
+		Since *int64 `schema:"since"`
+		Limit *uint  `schema:"limit"`
+	}
+	if err := decoder.Decode(&aq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return
+	}
+
+	if aq.Since == nil {
+		aq.Since = new(int64)
+		*aq.Since = time.Now().AddDate(0, 0, -7).Unix() // since, if not supplied, is a week ago.
+	}
+	if aq.Limit == nil {
+		aq.Limit = new(uint)
+		*aq.Limit = 50
+	} else if *aq.Limit == 0 || *aq.Limit > 1000 {
+		respondError(w, 400, "limit must be in range [1, 1000]")
+		return
+	}
+
+	analytics, err := database.GetSearchAnalytics(*aq.Since, *aq.Limit)
+	if err != nil {
+		respondError(w, 500, "couldn't get search analytics: %s", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(analytics); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// apiStorageReport responds with the disk usage of the database and its growth, projected to when
+// the disk will be full.
+func apiStorageReport(w http.ResponseWriter, r *http.Request) {
+	report, err := database.GetStorageReport()
+	if err != nil {
+		respondError(w, 500, "couldn't get storage report: %s", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+func analyticsHandler(w http.ResponseWriter, r *http.Request) {
+	data := mustPage("templates/analytics.html")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(data)
+}
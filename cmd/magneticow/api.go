@@ -12,16 +12,34 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/storage"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"golang.org/x/text/encoding/charmap"
 
 	"github.com/boramalper/magnetico/pkg/persistence"
 )
 
+// maxRefinements is the maximum number of the queries that a search can be refined with, as each
+// of them is matched separately.
+const maxRefinements = 8
+
+// respondQueryError responds with the error of a search, where the searches that are rejected only
+// because the database is overloaded (see persistence.ExpensiveQueryError) can be retried later.
+func respondQueryError(w http.ResponseWriter, err error) {
+	var expensive *persistence.ExpensiveQueryError
+	if errors.As(err, &expensive) && expensive.Overloaded {
+		w.Header().Set("Retry-After", "60")
+		respondError(w, 503, "query error: %s", err.Error())
+		return
+	}
+	respondError(w, 400, "query error: %s", err.Error())
+}
+
 type ApiReadmeHandler struct {
 	client  *torrent.Client
 	tempdir string
@@ -159,6 +177,8 @@ func (h *ApiReadmeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func apiTorrents(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
 	// @lastOrderedValue AND @lastID are either both supplied or neither of them should be supplied
 	// at all; and if that is NOT the case, then return an error.
 	if q := r.URL.Query(); !((q.Get("lastOrderedValue") != "" && q.Get("lastID") != "") ||
@@ -175,6 +195,41 @@ func apiTorrents(w http.ResponseWriter, r *http.Request) {
 		LastOrderedValue *float64 `schema:"lastOrderedValue"`
 		LastID           *uint64  `schema:"lastID"`
 		Limit            *uint    `schema:"limit"`
+		MaxSpamScore     *float64 `schema:"maxSpamScore"`
+		IncludeFlagged   *bool    `schema:"includeFlagged"`
+		OnlyVerified     *bool    `schema:"onlyVerified"`
+		// Since and Until bound the discovery time of the torrents (in Unix time), where Until is
+		// exclusive.
+		Since *int64 `schema:"since"`
+		Until *int64 `schema:"until"`
+		// Refine are the queries to refine the search with, which can be supplied more than once.
+		Refine []string `schema:"refine"`
+		// Path is the substring that any of the paths of the files of the torrents must contain, if
+		// the path search is enabled on the database.
+		Path *string `schema:"path"`
+		// Resolution, Codec, Group, Year, Season, and Episode are the attributes of the releases that
+		// the names of the torrents must be of (see persistence.ParseRelease), e.g. resolution=1080p.
+		Resolution *string `schema:"resolution"`
+		Codec      *string `schema:"codec"`
+		Group      *string `schema:"group"`
+		Year       *int    `schema:"year"`
+		Season     *int    `schema:"season"`
+		Episode    *int    `schema:"episode"`
+		// Artist and Album are of the albums that the audio torrents must be of (see
+		// persistence.ParseAlbum).
+		Artist *string `schema:"artist"`
+		Album  *string `schema:"album"`
+		// Fields is the comma-separated list of the fields to respond with (see
+		// persistence.ParseFields), all of them if not supplied.
+		Fields *string `schema:"fields"`
+		// Envelope wraps the torrents in an object along with the additional information (such as
+		// the spelling corrections), instead of responding with a bare array of torrents.
+		Envelope *bool `schema:"envelope"`
+		// Facets includes the facet counts of the search in the envelope, on the first page only.
+		Facets *bool `schema:"facets"`
+		// Explain includes the plan of the search in the envelope (or logs it, if the torrents are
+		// not enveloped) with --debug-query-plans; see explainSearch.
+		Explain *bool `schema:"explain"`
 	}
 	if err := decoder.Decode(&tq, r.URL.Query()); err != nil {
 		respondError(w, 400, "error while parsing the URL: %s", err.Error())
@@ -217,23 +272,179 @@ func apiTorrents(w http.ResponseWriter, r *http.Request) {
 
 	if tq.Limit == nil {
 		tq.Limit = new(uint)
-		*tq.Limit = 20
+		*tq.Limit = opts.DefaultPageSize
+	} else if *tq.Limit == 0 || *tq.Limit > opts.MaxPageSize {
+		respondError(w, 400, "limit must be in range [1, %d]", opts.MaxPageSize)
+		return
 	}
 
-	torrents, err := database.QueryTorrents(
-		*tq.Query, *tq.Epoch, orderBy,
-		*tq.Ascending, *tq.Limit, tq.LastOrderedValue, tq.LastID)
-	if err != nil {
-		respondError(w, 400, "query error: %s", err.Error())
+	if tq.MaxSpamScore != nil && (*tq.MaxSpamScore < 0 || *tq.MaxSpamScore > 1) {
+		respondError(w, 400, "maxSpamScore must be in range [0, 1]")
+		return
+	}
+
+	if tq.Since != nil && tq.Until != nil && *tq.Since >= *tq.Until {
+		respondError(w, 400, "since must be less than until")
+		return
+	}
+
+	if len(tq.Refine) > maxRefinements {
+		respondError(w, 400, "refine must not be supplied more than %d times", maxRefinements)
+		return
+	}
+
+	fields := persistence.AllFields
+	if tq.Fields != nil {
+		var err error
+		if fields, err = persistence.ParseFields(*tq.Fields); err != nil {
+			respondError(w, 400, err.Error())
+			return
+		}
+	}
+
+	if tq.Explain != nil && *tq.Explain && !opts.DebugQueryPlans {
+		respondError(w, 400, "explain requires --debug-query-plans")
 		return
 	}
 
+	filters := persistence.QueryFilters{
+		MaxSpamScore:    tq.MaxSpamScore,
+		IncludeFlagged:  tq.IncludeFlagged != nil && *tq.IncludeFlagged,
+		OnlyVerified:    tq.OnlyVerified != nil && *tq.OnlyVerified,
+		DiscoveredSince: tq.Since,
+		DiscoveredUntil: tq.Until,
+		Refinements:     tq.Refine,
+		Year:            tq.Year,
+		Season:          tq.Season,
+		Episode:         tq.Episode,
+	}
+	if tq.Path != nil {
+		filters.PathContains = *tq.Path
+	}
+	if tq.Resolution != nil {
+		filters.Resolution = *tq.Resolution
+	}
+	if tq.Codec != nil {
+		filters.Codec = *tq.Codec
+	}
+	if tq.Group != nil {
+		filters.ReleaseGroup = *tq.Group
+	}
+	if tq.Artist != nil {
+		filters.Artist = *tq.Artist
+	}
+	if tq.Album != nil {
+		filters.Album = *tq.Album
+	}
+
+	var torrents []persistence.TorrentMetadata
+	var err error
+	infoHash, lookUp := lookedUpInfoHash(*tq.Query)
+	if lookUp {
+		// The torrent of the infohash (or of the magnet link) is the only result, on the first page.
+		torrents = make([]persistence.TorrentMetadata, 0, 1)
+		if tq.LastID == nil {
+			torrent, err := database.GetTorrent(infoHash)
+			if err != nil {
+				respondError(w, 500, "couldn't get torrent: %s", err.Error())
+				return
+			}
+			if torrent != nil {
+				torrents = append(torrents, *torrent)
+			}
+		}
+	} else {
+		torrents, err = database.QueryTorrents(
+			*tq.Query, *tq.Epoch, orderBy,
+			*tq.Ascending, *tq.Limit, tq.LastOrderedValue, tq.LastID,
+			filters, fields)
+		if err != nil {
+			respondQueryError(w, err)
+			return
+		}
+	}
+	// Log only the first pages so that the searches are not counted once per page.
+	if tq.LastID == nil {
+		logSearch(r, *tq.Query, len(torrents), time.Since(start))
+	}
+	countRows(r, len(torrents))
+
+	var plan *persistence.QueryPlan
+	if tq.Explain != nil && *tq.Explain && !lookUp {
+		plan = explainSearch(r, *tq.Query, *tq.Epoch, orderBy, *tq.Ascending, *tq.Limit, tq.LastOrderedValue,
+			tq.LastID, filters, fields)
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	if err = json.NewEncoder(w).Encode(torrents); err != nil {
+	if tq.Envelope == nil || !*tq.Envelope {
+		if plan != nil {
+			zap.L().Info("Query plan", zap.String("query", *tq.Query), zap.String("sql", plan.SQL),
+				zap.Strings("plan", plan.Plan), zap.Bool("analyzed", plan.Analyzed),
+				zap.Float64("elapsed", plan.Elapsed), zap.Uint("rows", plan.Rows))
+		}
+		if err = json.NewEncoder(w).Encode(torrents); err != nil {
+			zap.L().Warn("JSON encode error", zap.Error(err))
+		}
+		return
+	}
+
+	var response struct {
+		Torrents   []persistence.TorrentMetadata `json:"torrents"`
+		DidYouMean []string                      `json:"didYouMean,omitempty"`
+		Facets     *persistence.Facets           `json:"facets,omitempty"`
+		// UnknownInfoHash is the infohash that is looked up, if its torrent is not in the database.
+		UnknownInfoHash string                 `json:"unknownInfoHash,omitempty"`
+		Plan            *persistence.QueryPlan `json:"plan,omitempty"`
+	}
+	response.Torrents = torrents
+	response.Plan = plan
+	if lookUp {
+		if len(torrents) == 0 && tq.LastID == nil {
+			response.UnknownInfoHash = hex.EncodeToString(infoHash)
+		}
+	} else if len(torrents) == 0 && *tq.Query != "" && tq.LastID == nil {
+		// Corrections are nice-to-have, so do not fail the whole search.
+		if response.DidYouMean, err = database.GetCorrections(*tq.Query, 3); err != nil {
+			zap.L().Warn("Could not get corrections", zap.Error(err))
+		}
+	}
+	if tq.Facets != nil && *tq.Facets && tq.LastID == nil && !lookUp {
+		// Neither are the facets.
+		if response.Facets, err = database.GetFacets(*tq.Query, *tq.Epoch, filters); err != nil {
+			zap.L().Warn("Could not get facets", zap.Error(err))
+		}
+	}
+	if err = json.NewEncoder(w).Encode(response); err != nil {
 		zap.L().Warn("JSON encode error", zap.Error(err))
 	}
 }
 
+// explainSearch returns the plan of the search, which is analyzed (i.e. the search is run once more
+// to measure it) only for the operators as it is as expensive as the search itself, or nil if the
+// plan cannot be got as it is nice-to-have.
+func explainSearch(
+	r *http.Request,
+	query string,
+	epoch int64,
+	orderBy persistence.OrderingCriteria,
+	ascending bool,
+	limit uint,
+	lastOrderedValue *float64,
+	lastID *uint64,
+	filters persistence.QueryFilters,
+	fields persistence.Fields,
+) *persistence.QueryPlan {
+	// The credentials are verified by BasicAuth already.
+	username, _, _ := r.BasicAuth()
+	plan, err := database.ExplainTorrents(opts.Admins[username], query, epoch, orderBy, ascending, limit,
+		lastOrderedValue, lastID, filters, fields)
+	if err != nil {
+		zap.L().Warn("Could not explain the search", zap.Error(err))
+		return nil
+	}
+	return plan
+}
+
 func apiTorrent(w http.ResponseWriter, r *http.Request) {
 	infohashHex := mux.Vars(r)["infohash"]
 
@@ -267,7 +478,45 @@ func apiFilelist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	files, err := database.GetFiles(infohash)
+	var fq struct {
+		Path   *string `schema:"path"`
+		Offset *uint   `schema:"offset"`
+		Limit  *uint   `schema:"limit"`
+	}
+	if err := decoder.Decode(&fq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return
+	}
+
+	var files []persistence.File
+	// For backwards compatibility, the whole file list is returned if none of the parameters are
+	// supplied.
+	if fq.Path == nil && fq.Offset == nil && fq.Limit == nil {
+		files, err = database.GetFiles(infohash)
+	} else {
+		if fq.Path == nil {
+			fq.Path = new(string)
+		}
+		if fq.Offset == nil {
+			fq.Offset = new(uint)
+		}
+		if fq.Limit == nil {
+			fq.Limit = new(uint)
+			*fq.Limit = 100
+		} else if *fq.Limit == 0 || *fq.Limit > 1000 {
+			respondError(w, 400, "limit must be in range [1, 1000]")
+			return
+		}
+
+		files, err = database.QueryFiles(infohash, *fq.Path, *fq.Offset, *fq.Limit)
+		// An empty page does not tell whether the torrent exists or not.
+		if err == nil && len(files) == 0 {
+			var exists bool
+			if exists, err = database.DoesTorrentExist(infohash); err == nil && !exists {
+				files = nil
+			}
+		}
+	}
 	if err != nil {
 		respondError(w, 500, "couldn't get files: %s", err.Error())
 		return
@@ -276,12 +525,37 @@ func apiFilelist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	countRows(r, len(files))
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	if err = json.NewEncoder(w).Encode(files); err != nil {
 		zap.L().Warn("JSON encode error", zap.Error(err))
 	}
 }
 
+func apiFiletree(w http.ResponseWriter, r *http.Request) {
+	infohashHex := mux.Vars(r)["infohash"]
+
+	infohash, err := hex.DecodeString(infohashHex)
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	tree, err := database.GetFileTree(infohash)
+	if err != nil {
+		respondError(w, 500, "couldn't get file tree: %s", err.Error())
+		return
+	} else if tree == nil {
+		respondError(w, 404, "not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(tree); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
 func apiStatistics(w http.ResponseWriter, r *http.Request) {
 	from := r.URL.Query().Get("from")
 
@@ -296,13 +570,23 @@ func apiStatistics(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			respondError(w, 400, "couldn't parse n: %s", err.Error())
 			return
-		} else if n <= 0 {
-			respondError(w, 400, "n must be a positive number")
+		} else if n <= 0 || n > persistence.MaxStatisticsPeriods {
+			respondError(w, 400, "n must be a positive number up to %d", persistence.MaxStatisticsPeriods)
 			return
 		}
 	}
 
-	stats, err := database.GetStatistics(from, uint(n))
+	// The statistics are in UTC unless a time zone (e.g. Europe/London) is supplied.
+	loc := time.UTC
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			respondError(w, 400, "couldn't load time zone: %s", err.Error())
+			return
+		}
+	}
+
+	stats, err := database.GetStatistics(from, uint(n), loc)
 	if err != nil {
 		respondError(w, 400, "error while getting statistics: %s", err.Error())
 		return
@@ -314,6 +598,68 @@ func apiStatistics(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func apiDashboard(w http.ResponseWriter, r *http.Request) {
+	var dq struct {
+		From *int64 `schema:"from"`
+	}
+	if err := decoder.Decode(&dq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return
+	}
+
+	if dq.From == nil {
+		dq.From = new(int64)
+		*dq.From = time.Now().AddDate(0, 0, -1).Unix() // from, if not supplied, is a day ago.
+	} else if *dq.From < 0 {
+		respondError(w, 400, "from must not be negative")
+		return
+	}
+
+	dashboard, err := database.GetDashboard(*dq.From)
+	if err != nil {
+		respondError(w, 500, "couldn't get dashboard: %s", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(dashboard); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// apiCrawlerStats serves the hourly statistics of the crawlers (see persistence.CrawlerStats), which
+// are empty if the database does not support them.
+func apiCrawlerStats(w http.ResponseWriter, r *http.Request) {
+	var cq struct {
+		From *int64 `schema:"from"`
+	}
+	if err := decoder.Decode(&cq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return
+	}
+
+	if cq.From == nil {
+		cq.From = new(int64)
+		*cq.From = time.Now().AddDate(0, 0, -1).Unix() // from, if not supplied, is a day ago.
+	} else if *cq.From < 0 {
+		respondError(w, 400, "from must not be negative")
+		return
+	}
+
+	stats, err := database.GetCrawlerStats(*cq.From)
+	if err == persistence.NotImplementedError {
+		stats = make([]persistence.CrawlerStats, 0)
+	} else if err != nil {
+		respondError(w, 500, "couldn't get crawler stats: %s", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(stats); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
 func parseOrderBy(s string) (persistence.OrderingCriteria, error) {
 	switch s {
 	case "RELEVANCE":
@@ -337,7 +683,307 @@ func parseOrderBy(s string) (persistence.OrderingCriteria, error) {
 	case "N_LEECHERS":
 		return persistence.ByNLeechers, nil
 
+	case "SPAM_SCORE":
+		return persistence.BySpamScore, nil
+
+	case "POPULARITY":
+		return persistence.ByPopularity, nil
+
 	default:
 		return persistence.ByDiscoveredOn, fmt.Errorf("unknown orderBy string: %s", s)
 	}
 }
+
+func apiReport(w http.ResponseWriter, r *http.Request) {
+	infohash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	if err = r.ParseForm(); err != nil {
+		respondError(w, 400, "error while parsing the form: %s", err.Error())
+		return
+	}
+	var rq struct {
+		Reason string `schema:"reason"`
+	}
+	if err = decoder.Decode(&rq, r.PostForm); err != nil {
+		respondError(w, 400, "error while parsing the form: %s", err.Error())
+		return
+	}
+	rq.Reason = strings.TrimSpace(rq.Reason)
+	if rq.Reason == "" || len(rq.Reason) > 1000 {
+		respondError(w, 400, "reason must be supplied and be at most 1000 bytes long")
+		return
+	}
+
+	if exists, err := database.DoesTorrentExist(infohash); err != nil {
+		respondError(w, 500, "couldn't check torrent: %s", err.Error())
+		return
+	} else if !exists {
+		respondError(w, 404, "not found")
+		return
+	}
+
+	if err = database.ReportTorrent(infohash, rq.Reason); err != nil {
+		respondError(w, 500, "couldn't report torrent: %s", err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiRequestTorrent requests a torrent that is not in the database to be looked up on the DHT by
+// the crawler (see persistence.TorrentRequest), and responds with the request.
+func apiRequestTorrent(w http.ResponseWriter, r *http.Request) {
+	infohash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	request, err := database.RequestTorrent(infohash)
+	if err != nil {
+		respondError(w, 500, "couldn't request torrent: %s", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(request); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// apiTorrentRequest responds with the request for a torrent, so that its status can be followed.
+func apiTorrentRequest(w http.ResponseWriter, r *http.Request) {
+	infohash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	request, err := database.GetTorrentRequest(infohash)
+	if err != nil {
+		respondError(w, 500, "couldn't get request: %s", err.Error())
+		return
+	} else if request == nil {
+		respondError(w, 404, "not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(request); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+func apiModerate(w http.ResponseWriter, r *http.Request) {
+	infohash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	if err = r.ParseForm(); err != nil {
+		respondError(w, 400, "error while parsing the form: %s", err.Error())
+		return
+	}
+	var mq struct {
+		State string `schema:"state,required"`
+	}
+	if err = decoder.Decode(&mq, r.PostForm); err != nil {
+		respondError(w, 400, "error while parsing the form: %s", err.Error())
+		return
+	}
+	state, err := persistence.ParseModerationState(mq.State)
+	if err != nil {
+		respondError(w, 400, err.Error())
+		return
+	}
+
+	if ok, err := database.SetModerationState(infohash, state); err != nil {
+		respondError(w, 500, "couldn't moderate torrent: %s", err.Error())
+		return
+	} else if !ok {
+		respondError(w, 404, "not found")
+		return
+	}
+
+	username, _, _ := r.BasicAuth()
+	zap.L().Info("Torrent is moderated",
+		zap.String("infohash", hex.EncodeToString(infohash)),
+		zap.Stringer("state", state),
+		zap.String("by", username))
+	audit(r, "moderate", zap.String("infohash", hex.EncodeToString(infohash)), zap.Stringer("state", state))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiModerationQueue(w http.ResponseWriter, r *http.Request) {
+	var mq struct {
+		Limit *uint `schema:"limit"`
+	}
+	if err := decoder.Decode(&mq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return
+	}
+	if mq.Limit == nil {
+		mq.Limit = new(uint)
+		*mq.Limit = 50
+	} else if *mq.Limit == 0 || *mq.Limit > 1000 {
+		respondError(w, 400, "limit must be in range [1, 1000]")
+		return
+	}
+
+	items, err := database.GetModerationQueue(*mq.Limit)
+	if err != nil {
+		respondError(w, 500, "couldn't get moderation queue: %s", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(items); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// apiRecentTorrents responds with the most recently discovered torrents, which are kept apart by
+// the database so that they can be listed (e.g. on the homepage) without a search.
+func apiRecentTorrents(w http.ResponseWriter, r *http.Request) {
+	var rq struct {
+		Limit *uint `schema:"limit"`
+	}
+	if err := decoder.Decode(&rq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return
+	}
+
+	if rq.Limit == nil {
+		rq.Limit = new(uint)
+		*rq.Limit = 20
+	} else if *rq.Limit == 0 || *rq.Limit > persistence.MaxRecentTorrents {
+		respondError(w, 400, "limit must be in range [1, %d]", persistence.MaxRecentTorrents)
+		return
+	}
+
+	torrents, err := database.GetRecentTorrents(*rq.Limit)
+	if err != nil {
+		respondError(w, 500, "couldn't get recent torrents: %s", err.Error())
+		return
+	}
+	countRows(r, len(torrents))
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	// The list changes every few seconds on a busy instance, but it need not be any fresher.
+	w.Header().Set("Cache-Control", "max-age=60")
+	if err = json.NewEncoder(w).Encode(torrents); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// apiTrendingTorrents responds with the trending torrents, i.e. the ones that are seen the most on
+// the DHT by the crawler recently, as ranked periodically by the crawler.
+func apiTrendingTorrents(w http.ResponseWriter, r *http.Request) {
+	var tq struct {
+		Limit *uint `schema:"limit"`
+	}
+	if err := decoder.Decode(&tq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return
+	}
+
+	if tq.Limit == nil {
+		tq.Limit = new(uint)
+		*tq.Limit = 20
+	} else if *tq.Limit == 0 || *tq.Limit > persistence.MaxTrendingTorrents {
+		respondError(w, 400, "limit must be in range [1, %d]", persistence.MaxTrendingTorrents)
+		return
+	}
+
+	torrents, err := database.GetTrendingTorrents(*tq.Limit)
+	if err != nil {
+		respondError(w, 500, "couldn't get trending torrents: %s", err.Error())
+		return
+	}
+	countRows(r, len(torrents))
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	// The trending torrents are ranked anew only every few minutes.
+	w.Header().Set("Cache-Control", "max-age=300")
+	if err = json.NewEncoder(w).Encode(torrents); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+func apiSuggest(w http.ResponseWriter, r *http.Request) {
+	var sq struct {
+		Prefix string  `schema:"prefix,required"`
+		Limit  *uint   `schema:"limit"`
+		Format *string `schema:"format"`
+	}
+	if err := decoder.Decode(&sq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return
+	}
+
+	// OpenSearch format is what the browsers expect from a search engine; see
+	// https://github.com/dewitt/opensearch/blob/master/mediawiki/Specifications/OpenSearch/Extensions/Suggestions/1.1/Draft%201.wiki
+	opensearch := false
+	if sq.Format != nil {
+		if *sq.Format != "opensearch" {
+			respondError(w, 400, "format must be `opensearch`, if supplied")
+			return
+		}
+		opensearch = true
+	}
+
+	sq.Prefix = strings.TrimLeft(sq.Prefix, " ")
+	// Suggestions for a single character are neither useful nor cheap.
+	if utf8.RuneCountInString(sq.Prefix) < 2 {
+		if opensearch { // browsers ask for suggestions from the very first character
+			writeOpenSearchSuggestions(w, sq.Prefix, []string{})
+			return
+		}
+		respondError(w, 400, "prefix must be at least 2 characters long")
+		return
+	}
+
+	if sq.Limit == nil {
+		sq.Limit = new(uint)
+		*sq.Limit = 10
+	} else if *sq.Limit == 0 || *sq.Limit > 50 {
+		respondError(w, 400, "limit must be in range [1, 50]")
+		return
+	}
+
+	suggestions, err := database.GetSuggestions(sq.Prefix, *sq.Limit)
+	if err != nil {
+		respondError(w, 500, "couldn't get suggestions: %s", err.Error())
+		return
+	}
+
+	// Suggestions do not need to be fresh, and a search box asks for them on every key stroke.
+	w.Header().Set("Cache-Control", "max-age=300")
+	if opensearch {
+		writeOpenSearchSuggestions(w, sq.Prefix, suggestions)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(suggestions); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// writeOpenSearchSuggestions writes the suggestions in the format of OpenSearch Suggestions, that
+// is an array of the prefix and the array of the suggestions.
+func writeOpenSearchSuggestions(w http.ResponseWriter, prefix string, suggestions []string) {
+	if suggestions == nil {
+		suggestions = []string{}
+	}
+	w.Header().Set("Content-Type", "application/x-suggestions+json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode([]interface{}{prefix, suggestions}); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// The API keys are issued by the operators so that others (e.g. the other services of theirs) can
+// use the API without the credentials of a user, within the limits of each key. The keys are
+// supplied in the X-API-Key header, and only their SHA-256 hashes are stored.
+
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyPrefix is prepended to the keys so that they can be told apart (e.g. by the secret scanners
+// of the code hosts).
+const apiKeyPrefix = "mgw_"
+
+// apiKeyUsageKey is the key of the *apiKeyUsage of the requests with API keys in their contexts.
+type apiKeyUsageKey struct{}
+
+// apiKeyUsage is the number of the rows in the response to a request with an API key, as counted
+// by the handler (see countRows).
+type apiKeyUsage struct {
+	nRows uint64
+}
+
+// countRows counts the rows (e.g. the torrents of the search results) in the response to the
+// request against the daily quota of its API key, if any.
+func countRows(r *http.Request, n int) {
+	if usage, ok := r.Context().Value(apiKeyUsageKey{}).(*apiKeyUsage); ok {
+		atomic.AddUint64(&usage.nRows, uint64(n))
+	}
+}
+
+// requestLimiter limits the numbers of the requests of each client (e.g. of an API key, see
+// persistence.APIKeyLimits.RequestsPerMinute) in each minute, which are not stored as they are
+// short-lived.
+type requestLimiter struct {
+	mu        sync.Mutex
+	minute    int64             // in Unix time
+	nRequests map[string]uint64 // by the clients, in the minute
+}
+
+func newRequestLimiter() *requestLimiter {
+	return &requestLimiter{nRequests: make(map[string]uint64)}
+}
+
+var apiKeyLimiter = newRequestLimiter()
+
+// allow counts a request of the client in the minute of @now, and returns false if it exceeds the
+// limit (which is not counted then).
+func (l *requestLimiter) allow(client string, limit uint64, now time.Time) bool {
+	if limit == 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// The counts of the previous minutes are of no use, so they are dropped altogether.
+	if minute := now.Unix() / 60; minute != l.minute {
+		l.minute = minute
+		l.nRequests = make(map[string]uint64)
+	}
+	if l.nRequests[client] >= limit {
+		return false
+	}
+	l.nRequests[client]++
+	return true
+}
+
+// reset forgets the requests of the client in the current minute.
+func (l *requestLimiter) reset(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.nRequests, client)
+}
+
+// APIAuth is BasicAuth that alternatively accepts an API key in the X-API-Key header, whose limits
+// are enforced instead.
+func APIAuth(handler http.HandlerFunc, realm string) http.HandlerFunc {
+	basicAuth := BasicAuth(handler, realm)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(apiKeyHeader) == "" {
+			basicAuth(w, r)
+			return
+		}
+
+		now := time.Now()
+		keyHash := sha256.Sum256([]byte(r.Header.Get(apiKeyHeader)))
+		key, err := database.GetAPIKey(keyHash[:], now.Unix())
+		if err != nil {
+			respondError(w, 500, "couldn't get API key: %s", err.Error())
+			return
+		}
+		if key == nil || key.RevokedOn != 0 {
+			respondError(w, 401, "invalid API key")
+			return
+		}
+
+		if key.RowsPerDay != 0 && key.NRows >= key.RowsPerDay {
+			tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			w.Header().Set("Retry-After", strconv.Itoa(int(tomorrow.Sub(now).Seconds())+1))
+			respondError(w, 429, "daily quota of %d rows is exceeded", key.RowsPerDay)
+			return
+		}
+		if !apiKeyLimiter.allow(strconv.FormatUint(key.ID, 10), key.RequestsPerMinute, now) {
+			w.Header().Set("Retry-After", strconv.Itoa(60-now.Second()))
+			respondError(w, 429, "rate limit of %d requests per minute is exceeded", key.RequestsPerMinute)
+			return
+		}
+
+		usage := new(apiKeyUsage)
+		handler(w, r.WithContext(context.WithValue(r.Context(), apiKeyUsageKey{}, usage)))
+
+		// The rows of the request are counted only after it is responded, so the last request of
+		// the day might exceed the quota.
+		if err = database.AddAPIKeyUsage(key.ID, 1, atomic.LoadUint64(&usage.nRows), now.Unix()); err != nil {
+			zap.L().Warn("Could not count the usage of the API key", zap.Uint64("id", key.ID), zap.Error(err))
+		}
+	}
+}
+
+// apiAPIKeys responds with all the API keys (without the keys themselves) and their usages today.
+func apiAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := database.GetAPIKeys(time.Now().Unix())
+	if err != nil {
+		respondError(w, 500, "couldn't get API keys: %s", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(keys); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// apiAddAPIKey issues an API key with the given name and limits, and responds with its ID and the
+// key itself, which cannot be retrieved again.
+func apiAddAPIKey(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondError(w, 400, "error while parsing the form: %s", err.Error())
+		return
+	}
+	var kq struct {
+		Name              string `schema:"name,required"`
+		RequestsPerMinute uint64 `schema:"requestsPerMinute"`
+		RowsPerDay        uint64 `schema:"rowsPerDay"`
+	}
+	if err := decoder.Decode(&kq, r.PostForm); err != nil {
+		respondError(w, 400, "error while parsing the form: %s", err.Error())
+		return
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		respondError(w, 500, "couldn't generate API key: %s", err.Error())
+		return
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+	keyHash := sha256.Sum256([]byte(key))
+
+	limits := persistence.APIKeyLimits{RequestsPerMinute: kq.RequestsPerMinute, RowsPerDay: kq.RowsPerDay}
+	id, err := database.AddAPIKey(kq.Name, keyHash[:], limits, time.Now().Unix())
+	if err != nil {
+		respondError(w, 500, "couldn't add API key: %s", err.Error())
+		return
+	}
+	audit(r, "issue API key", zap.Uint64("id", id), zap.String("name", kq.Name),
+		zap.Uint64("requestsPerMinute", limits.RequestsPerMinute), zap.Uint64("rowsPerDay", limits.RowsPerDay))
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(struct {
+		ID  uint64 `json:"id"`
+		Key string `json:"key"`
+	}{id, key}); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// apiUpdateAPIKey sets the limits of the API key, which apply from its next request on.
+func apiUpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondError(w, 400, "couldn't parse id: %s", err.Error())
+		return
+	}
+
+	if err = r.ParseForm(); err != nil {
+		respondError(w, 400, "error while parsing the form: %s", err.Error())
+		return
+	}
+	var kq struct {
+		RequestsPerMinute uint64 `schema:"requestsPerMinute,required"`
+		RowsPerDay        uint64 `schema:"rowsPerDay,required"`
+	}
+	if err = decoder.Decode(&kq, r.PostForm); err != nil {
+		respondError(w, 400, "error while parsing the form: %s", err.Error())
+		return
+	}
+
+	limits := persistence.APIKeyLimits{RequestsPerMinute: kq.RequestsPerMinute, RowsPerDay: kq.RowsPerDay}
+	if ok, err := database.UpdateAPIKey(id, limits); err != nil {
+		respondError(w, 500, "couldn't update API key: %s", err.Error())
+		return
+	} else if !ok {
+		respondError(w, 404, "not found")
+		return
+	}
+	audit(r, "update API key", zap.Uint64("id", id),
+		zap.Uint64("requestsPerMinute", limits.RequestsPerMinute), zap.Uint64("rowsPerDay", limits.RowsPerDay))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiRevokeAPIKey revokes the API key, which is kept (along with its usage) for the records.
+func apiRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondError(w, 400, "couldn't parse id: %s", err.Error())
+		return
+	}
+
+	if ok, err := database.RevokeAPIKey(id, time.Now().Unix()); err != nil {
+		respondError(w, 500, "couldn't revoke API key: %s", err.Error())
+		return
+	} else if !ok {
+		respondError(w, 404, "not found")
+		return
+	}
+	audit(r, "revoke API key", zap.Uint64("id", id))
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var requestLimiter_instances = []struct {
+	client   string
+	limit    uint64
+	second   int64
+	expected bool
+}{
+	{"1", 2, 0, true},
+	{"1", 2, 10, true},
+	{"1", 2, 59, false}, // the third request in the same minute
+	{"2", 2, 59, true},  // of another client
+	{"1", 2, 60, true},  // in the next minute
+	{"1", 0, 61, true},  // unlimited
+	{"1", 2, 62, true},
+	{"1", 2, 63, false},
+}
+
+func TestRequestLimiter(t *testing.T) {
+	limiter := newRequestLimiter()
+	for i, instance := range requestLimiter_instances {
+		got := limiter.allow(instance.client, instance.limit, time.Unix(instance.second, 0))
+		if got != instance.expected {
+			t.Errorf("result of the instance #%d is wrong! Got %t (expected %t)", i+1, got, instance.expected)
+		}
+	}
+
+	limiter.reset("1")
+	if !limiter.allow("1", 2, time.Unix(64, 0)) {
+		t.Errorf("request after the reset is not allowed!")
+	}
+}
+
+func TestCountRows(t *testing.T) {
+	// The requests without API keys are not counted.
+	countRows(httptest.NewRequest("GET", "/api/v0.1/torrents", nil), 10)
+
+	usage := new(apiKeyUsage)
+	r := httptest.NewRequest("GET", "/api/v0.1/torrents", nil)
+	r = r.WithContext(context.WithValue(r.Context(), apiKeyUsageKey{}, usage))
+	countRows(r, 10)
+	countRows(r, 5)
+	if usage.nRows != 15 {
+		t.Errorf("number of the rows is wrong! Got %d (expected 15)", usage.nRows)
+	}
+}
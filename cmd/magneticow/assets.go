@@ -0,0 +1,165 @@
+package main
+
+import (
+	"embed"
+	"encoding/hex"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// embeddedData are the assets embedded into the binary, including the brotli-compressed ones if
+// they are pre-compressed by the Makefile.
+//
+//go:embed data
+var embeddedData embed.FS
+
+// assets are the templates, the static files, and the message catalogs of magneticow, which are
+// embedded into the binary unless --dev is supplied, in which case they are read from the disk.
+var assets = embeddedAssets()
+
+func embeddedAssets() fs.FS {
+	assets, err := fs.Sub(embeddedData, "data")
+	if err != nil {
+		panic(err)
+	}
+	return assets
+}
+
+func Asset(name string) ([]byte, error) {
+	return fs.ReadFile(assets, name)
+}
+
+var templateFunctions = template.FuncMap{
+	"add": func(augend int, addends int) int {
+		return augend + addends
+	},
+
+	"subtract": func(minuend int, subtrahend int) int {
+		return minuend - subtrahend
+	},
+
+	"bytesToHex": func(bytes []byte) string {
+		return hex.EncodeToString(bytes)
+	},
+
+	"unixTimeToYearMonthDay": func(s int64) string {
+		tm := time.Unix(s, 0)
+		// > Format and Parse use example-based layouts. Usually you’ll use a constant from time
+		// > for these layouts, but you can also supply custom layouts. Layouts must use the
+		// > reference time Mon Jan 2 15:04:05 MST 2006 to show the pattern with which to
+		// > format/parse a given time/string. The example time must be exactly as shown: the
+		// > year 2006, 15 for the hour, Monday for the day of the week, etc.
+		// https://gobyexample.com/time-formatting-parsing
+		// Why you gotta be so weird Go?
+		return tm.Format("02/01/2006")
+	},
+
+	"humanizeSize": func(s uint64) string {
+		return humanize.IBytes(s)
+	},
+
+	"humanizeSizeF": func(s int64) string {
+		if s < 0 {
+			return ""
+		}
+		return humanize.IBytes(uint64(s))
+	},
+
+	"comma": func(s uint) string {
+		return humanize.Comma(int64(s))
+	},
+
+	// permalink is relative to the base path, as the pages are.
+	"permalink": func(torrent persistence.TorrentMetadata) string {
+		return strings.TrimPrefix(permalink(&torrent), "/")
+	},
+}
+
+func parseTemplates() (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	for _, t := range []struct {
+		name, path string
+		page       bool
+	}{
+		{"feed", "templates/feed.xml", false},
+		{"opensearch", "templates/opensearch.xml", false},
+		{"homepage", "templates/homepage.html", true},
+	} {
+		data, err := Asset(t.path)
+		if err != nil {
+			return nil, err
+		}
+		if t.page {
+			data = withBasePath(data)
+		}
+
+		if templates[t.name], err = template.New(t.name).Funcs(templateFunctions).Parse(string(data)); err != nil {
+			return nil, errors.Wrap(err, t.path)
+		}
+	}
+	return templates, nil
+}
+
+// getTemplate returns the template, which is parsed anew each time in the development mode so
+// that the changes can be seen without restarting magneticow.
+func getTemplate(name string) *template.Template {
+	if opts.DevDir == "" {
+		return templates[name]
+	}
+
+	fresh, err := parseTemplates()
+	if err != nil {
+		zap.L().Error("Could not parse templates", zap.Error(err))
+		return templates[name]
+	}
+	return fresh[name]
+}
+
+// Dev prevents the browsers from caching the responses in the development mode.
+func Dev(handler http.Handler) http.Handler {
+	if opts.DevDir == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(noCacheResponseWriter{w}, r)
+	})
+}
+
+// noCacheResponseWriter overrides the Cache-Control header that the handlers set.
+type noCacheResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w noCacheResponseWriter) WriteHeader(statusCode int) {
+	w.Header().Set("Cache-Control", "no-cache")
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w noCacheResponseWriter) Write(data []byte) (int, error) {
+	w.Header().Set("Cache-Control", "no-cache")
+	return w.ResponseWriter.Write(data)
+}
+
+// assetModTime returns the modification time of the asset, which is when magneticow has started
+// if the assets are embedded (as they cannot have changed since then).
+func assetModTime(name string) time.Time {
+	if opts.DevDir == "" {
+		return startedOn
+	}
+
+	info, err := fs.Stat(assets, name)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
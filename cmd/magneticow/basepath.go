@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var basePathRE = regexp.MustCompile(`^(?:/[A-Za-z0-9._~-]+)*$`)
+
+// normaliseBasePath returns the base path with a leading slash and without a trailing one (e.g.
+// "magnetico/" becomes "/magnetico"), which is empty if magneticow is served at the root.
+func normaliseBasePath(basePath string) (string, error) {
+	basePath = strings.Trim(basePath, "/")
+	if basePath != "" {
+		basePath = "/" + basePath
+	}
+	if !basePathRE.MatchString(basePath) {
+		return "", fmt.Errorf("base path must consist of the unreserved characters of URLs (got `%s`)", basePath)
+	}
+	return basePath, nil
+}
+
+// BasePath serves the handler under opts.BasePath by stripping it off the paths of the requests,
+// so that magneticow can share a domain with other sites behind a reverse proxy (which must pass
+// the paths intact).
+func BasePath(handler http.Handler) http.Handler {
+	if opts.BasePath == "" {
+		return handler
+	}
+
+	stripped := http.StripPrefix(opts.BasePath, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == opts.BasePath {
+			http.Redirect(w, r, opts.BasePath+"/", http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, opts.BasePath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		stripped.ServeHTTP(w, r)
+	})
+}
+
+// withBasePath sets the base URL of the page to the base path. All the links of the pages are
+// relative to their base URL (instead of being absolute) for this to work.
+func withBasePath(page []byte) []byte {
+	return bytes.Replace(page, []byte(`<base href="/">`), []byte(`<base href="`+opts.BasePath+`/">`), 1)
+}
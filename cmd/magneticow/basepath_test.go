@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var normaliseBasePath_instances = []struct {
+	basePath string
+	expected string
+	err      bool
+}{
+	{"", "", false},
+	{"/", "", false},
+	{"magnetico", "/magnetico", false},
+	{"/magnetico/", "/magnetico", false},
+	{"/apps/magnetico", "/apps/magnetico", false},
+	{"/apps//magnetico", "", true},
+	{`/magnetico"`, "", true},
+	{"/magnetico?query", "", true},
+}
+
+func TestNormaliseBasePath(t *testing.T) {
+	for i, instance := range normaliseBasePath_instances {
+		basePath, err := normaliseBasePath(instance.basePath)
+		if (err != nil) != instance.err {
+			t.Errorf("error of the instance #%d is wrong! Got %v", i+1, err)
+		} else if basePath != instance.expected {
+			t.Errorf("base path of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, basePath, instance.expected)
+		}
+	}
+}
+
+var basePathHandler_instances = []struct {
+	path       string
+	statusCode int
+	// strippedPath is the path the wrapped handler sees.
+	strippedPath string
+}{
+	{"/magnetico/", 200, "/"},
+	{"/magnetico/torrents", 200, "/torrents"},
+	{"/magnetico", 301, ""},
+	{"/magneticow/", 404, ""},
+	{"/torrents", 404, ""},
+}
+
+func TestBasePath(t *testing.T) {
+	opts.BasePath = "/magnetico"
+	defer func() { opts.BasePath = "" }()
+
+	var strippedPath string
+	handler := BasePath(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		strippedPath = r.URL.Path
+	}))
+
+	for i, instance := range basePathHandler_instances {
+		strippedPath = ""
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", instance.path, nil))
+
+		if recorder.Code != instance.statusCode {
+			t.Errorf("status code of the instance #%d is wrong! Got %d (expected %d)", i+1, recorder.Code, instance.statusCode)
+		}
+		if strippedPath != instance.strippedPath {
+			t.Errorf("stripped path of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, strippedPath, instance.strippedPath)
+		}
+	}
+
+	if page := string(withBasePath([]byte(`<head><base href="/"></head>`))); page != `<head><base href="/magnetico/"></head>` {
+		t.Errorf("page is wrong! Got `%s`", page)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressibleTypes are the prefixes of the content types that are worth compressing; images
+// (except SVG) and fonts are compressed already.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/manifest+json",
+	"application/opensearchdescription+xml",
+	"application/rss+xml",
+	"application/x-suggestions+json",
+	"application/xml",
+	"image/svg+xml",
+}
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	},
+}
+
+// Compress compresses the responses of the handler using gzip, if the client accepts it and the
+// response is worth compressing. Static assets might be served compressed using brotli already
+// (see staticHandler), in which case they are left intact.
+func Compress(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsEncoding(r, "gzip") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressingResponseWriter{ResponseWriter: w}
+		defer cw.Close()
+		handler.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsEncoding returns true if the Accept-Encoding header of the request lists the encoding
+// with a non-zero quality.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		tokens := strings.Split(accepted, ";")
+		if strings.TrimSpace(tokens[0]) != encoding {
+			continue
+		}
+		for _, param := range tokens[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				return err == nil && q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressingResponseWriter decides whether to compress the response once the handler writes
+// the header (i.e. once the content type is known).
+type compressingResponseWriter struct {
+	http.ResponseWriter
+	gzipWriter  *gzip.Writer
+	wroteHeader bool
+}
+
+func (cw *compressingResponseWriter) WriteHeader(statusCode int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	header := cw.Header()
+	// Partial responses (to range requests) are left intact as well, since their ranges are of the
+	// uncompressed representation.
+	if statusCode == http.StatusOK && header.Get("Content-Encoding") == "" &&
+		isCompressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		// Strong ETags identify the exact bytes, which the compressed representation is not.
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			header.Set("ETag", "W/"+etag)
+		}
+
+		cw.gzipWriter = gzipWriterPool.Get().(*gzip.Writer)
+		cw.gzipWriter.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *compressingResponseWriter) Write(data []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.gzipWriter == nil {
+		return cw.ResponseWriter.Write(data)
+	}
+	return cw.gzipWriter.Write(data)
+}
+
+// Flush flushes the compressed data written so far, so that streaming responses are not held
+// back by the compression.
+func (cw *compressingResponseWriter) Flush() {
+	if cw.gzipWriter != nil {
+		_ = cw.gzipWriter.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cw *compressingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (cw *compressingResponseWriter) Close() {
+	if cw.gzipWriter == nil {
+		return
+	}
+	_ = cw.gzipWriter.Close()
+	cw.gzipWriter.Reset(ioutil.Discard)
+	gzipWriterPool.Put(cw.gzipWriter)
+	cw.gzipWriter = nil
+}
+
+func isCompressible(contentType string) bool {
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var acceptsEncodingTest_instances = []struct {
+	acceptEncoding string
+	accepts        bool
+}{
+	{"", false},
+	{"gzip", true},
+	{"deflate, gzip;q=1.0, *;q=0.5", true},
+	{"br;q=1.0, gzip;q=0", false},
+	{"gzipx", false},
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	for i, instance := range acceptsEncodingTest_instances {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", instance.acceptEncoding)
+		if accepts := acceptsEncoding(r, "gzip"); accepts != instance.accepts {
+			t.Errorf("Instance #%d is wrong! Got %t (expected %t)", i+1, accepts, instance.accepts)
+		}
+	}
+}
+
+// TestCompressConditional tests that the API responses are compressed, and that they are not
+// sent again if the client has them already.
+func TestCompressConditional(t *testing.T) {
+	body := strings.Repeat(`{"name": "ubuntu"}`, 100)
+	handler := Compress(Conditional(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = w.Write([]byte(body))
+	})))
+
+	r := httptest.NewRequest("GET", "/api/v0.1/torrents", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("response is not compressed")
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("could not decompress the response: %s", err.Error())
+	}
+	if decompressed, _ := ioutil.ReadAll(reader); string(decompressed) != body {
+		t.Errorf("decompressed response is wrong")
+	}
+
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("ETag of the compressed response should be weak, got `%s`", etag)
+	}
+
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("response should be 304 without a body, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+}
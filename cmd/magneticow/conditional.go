@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Conditional adds ETags to the successful responses of the GET requests to the API, and
+// responds with 304 Not Modified if the client has the same representation already, which saves
+// the bandwidth of the (potentially large) JSON result sets to be sent again.
+//
+// The handler is still executed for every request since the freshness of the results can only be
+// known by querying the database; use Cache-Control to spare the database as well.
+func Conditional(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != "GET" && r.Method != "HEAD") || !strings.HasPrefix(r.URL.Path, "/api/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		bw := &bufferingResponseWriter{header: make(http.Header), statusCode: http.StatusOK}
+		handler.ServeHTTP(bw, r)
+
+		for key, values := range bw.header {
+			w.Header()[key] = values
+		}
+		if bw.statusCode != http.StatusOK || w.Header().Get("ETag") != "" {
+			w.WriteHeader(bw.statusCode)
+			_, _ = w.Write(bw.body.Bytes())
+			return
+		}
+
+		sum := sha256.Sum256(bw.body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(bw.body.Bytes())
+	})
+}
+
+// etagMatches returns true if the ETag is in the If-None-Match header, using the weak comparison
+// (as the compression might have weakened the ETag that the client has).
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+type bufferingResponseWriter struct {
+	header      http.Header
+	body        bytes.Buffer
+	statusCode  int
+	wroteHeader bool
+}
+
+func (bw *bufferingResponseWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *bufferingResponseWriter) WriteHeader(statusCode int) {
+	if bw.wroteHeader {
+		return
+	}
+	bw.wroteHeader = true
+	bw.statusCode = statusCode
+}
+
+func (bw *bufferingResponseWriter) Write(data []byte) (int, error) {
+	bw.WriteHeader(http.StatusOK)
+	return bw.body.Write(data)
+}
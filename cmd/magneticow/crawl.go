@@ -0,0 +1,47 @@
+// +build !windows
+
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/boramalper/magnetico/cmd/magneticod/crawler"
+)
+
+type crawlerConfig = crawler.Config
+
+func makeCrawlerConfig(flags crawlerFlags) (*crawlerConfig, error) {
+	if err := crawler.CheckAddrs(flags.IndexerAddrs); err != nil {
+		return nil, errors.Wrap(err, "indexer-addr")
+	}
+
+	config := &crawlerConfig{
+		IndexerAddrs:        flags.IndexerAddrs,
+		IndexerInterval:     time.Duration(flags.IndexerInterval) * time.Second,
+		IndexerMaxNeighbors: flags.IndexerMaxNeighbors,
+		IndexerResponder:    flags.IndexerResponder,
+		IndexerStrict:       flags.IndexerStrict,
+		LeechMaxN:           int(flags.LeechMaxN),
+		FetchWindow:         time.Duration(flags.FetchWindow) * time.Second,
+		DedupeCapacity:      int(flags.DedupeCapacity),
+		RecordPath:          flags.Record,
+		RecordRate:          flags.RecordRate,
+		RecordAnonymize:     flags.RecordAnonymize,
+	}
+	if flags.NAT != "none" {
+		config.NAT = flags.NAT
+	}
+	return config, nil
+}
+
+// startCrawler starts crawling the DHT into the database, and returns the function to terminate
+// the crawler with.
+func startCrawler(config crawlerConfig) func() {
+	rand.Seed(time.Now().UnixNano())
+	c := crawler.New(database, config)
+	go c.Run()
+	return c.Terminate
+}
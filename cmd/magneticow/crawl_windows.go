@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+// crawlerConfig is a placeholder on Windows, where the crawler is not available since the DHT
+// indexer uses the socket API of Unix.
+type crawlerConfig struct{}
+
+func makeCrawlerConfig(flags crawlerFlags) (*crawlerConfig, error) {
+	return nil, fmt.Errorf("`crawl` is not supported on Windows")
+}
+
+func startCrawler(config crawlerConfig) func() {
+	return func() {}
+}
@@ -0,0 +1,82 @@
+"use strict";
+
+let daysElem = null;
+
+window.onload = function() {
+    daysElem = document.getElementById("days");
+    daysElem.onchange = load;
+
+    load();
+    loadStorage();
+};
+
+function load() {
+    const since = Math.floor(Date.now() / 1000) - daysElem.valueAsNumber * 24 * 60 * 60;
+
+    myFetch("api/v0.1/analytics/searches?" + encodeQueryData({
+        since: since,
+        limit: 100,
+    })).then(x => x.json()).then(analytics => {
+        document.getElementById("summary").innerText =
+            analytics.nSearches + " searches by " + analytics.nClients + " clients.";
+
+        fill("topQueries", analytics.topQueries);
+        fill("zeroResultQueries", analytics.zeroResultQueries);
+    }).catch(err => {
+        alert("Could not load search analytics: " + err);
+    });
+}
+
+function fill(tableID, queries) {
+    const tbody = document.querySelector("#" + tableID + " tbody");
+    tbody.textContent = "";
+
+    for (let q of queries) {
+        const tr = document.createElement("tr");
+        for (let cell of [
+            q.query,
+            q.nSearches,
+            q.nClients,
+            q.avgNResults.toFixed(1),
+            q.avgLatencyMs.toFixed(1) + " ms",
+            humaniseDate(q.lastSearchedOn),
+        ]) {
+            const td = document.createElement("td");
+            td.textContent = cell;
+            tr.appendChild(td);
+        }
+        tbody.appendChild(tr);
+    }
+}
+
+function loadStorage() {
+    myFetch("api/v0.1/analytics/storage").then(x => x.json()).then(report => {
+        let summary = "The database is " + fileSize(report.totalBytes) + ", growing by " +
+            fileSize(report.bytesPerDay) + " a day.";
+        if (report.freeBytes) {
+            summary += " " + fileSize(report.freeBytes) + " of the disk is free";
+            summary += report.fullOn ? ", which will be full on " + humaniseDate(report.fullOn) + "." : ".";
+        }
+        document.getElementById("storageSummary").innerText = summary;
+
+        const tbody = document.querySelector("#storage tbody");
+        tbody.textContent = "";
+        for (let table of report.tables) {
+            const tr = document.createElement("tr");
+            for (let cell of [
+                table.name,
+                table.rows,
+                fileSize(table.bytes),
+                Math.round(table.rowsPerDay),
+                fileSize(table.bytesPerDay),
+            ]) {
+                const td = document.createElement("td");
+                td.textContent = cell;
+                tr.appendChild(td);
+            }
+            tbody.appendChild(tr);
+        }
+    }).catch(err => {
+        alert("Could not load storage report: " + err);
+    });
+}
@@ -34,12 +34,22 @@ function humaniseDate(unixTime) {
 
 // a fetch() that errs on anything but HTTP 2XX
 // Source: https://github.com/github/fetch/issues/155#issuecomment-108288863
+//
+// The requests that are limited with a proof-of-work challenge (see proofofwork.go) are retried once
+// the challenge is solved.
 function myFetch(url, options) {
     if (options == null) options = {}
     if (options.credentials == null) options.credentials = 'same-origin'
     return fetch(url, options).then(function(response) {
         if (response.status >= 200 && response.status < 300) {
             return Promise.resolve(response)
+        } else if (response.status === 429 && response.headers.get("X-Proof-Of-Work-Challenge") &&
+                   !(options.headers && options.headers["X-Proof-Of-Work"])) {
+            return solveChallenge(response.headers.get("X-Proof-Of-Work-Challenge"),
+                                  Number(response.headers.get("X-Proof-Of-Work-Difficulty")))
+                .then(solution => myFetch(url, Object.assign({}, options, {
+                    headers: Object.assign({}, options.headers, {"X-Proof-Of-Work": solution}),
+                })))
         } else {
             var error = new Error(response.statusText || response.status)
             error.response = response
@@ -48,6 +58,56 @@ function myFetch(url, options) {
     })
 }
 
+// solveChallenge resolves to the solution of the proof-of-work challenge, which is the challenge
+// and a nonce (as <CHALLENGE>:<NONCE>) whose SHA-256 starts with @difficulty zero bits.
+async function solveChallenge(challenge, difficulty) {
+    if (!window.crypto || !crypto.subtle)  // e.g. when not served over HTTPS
+        throw new Error(t("common.challengeUnsupported", "Too many requests; try again in a minute."));
+
+    const encoder = new TextEncoder();
+    for (let nonce = 0; ; nonce++) {
+        const solution = challenge + ":" + nonce;
+        const digest = new Uint8Array(await crypto.subtle.digest("SHA-256", encoder.encode(solution)));
+
+        let zeros = 0;
+        for (const x of digest) {
+            if (x !== 0) {
+                zeros += Math.clz32(x) - 24;
+                break;
+            }
+            zeros += 8;
+        }
+        if (zeros >= difficulty)
+            return solution;
+    }
+}
+
+// downloadClient resolves to the name of the download client of the user, or null if they do
+// not have one; use getDownloadClient()
+let downloadClient = null;
+
+function getDownloadClient() {
+    if (downloadClient === null)
+        downloadClient = fetch("api/v0.1/downloadclient", {credentials: "same-origin"})
+            .then(response => response.ok ? response.json().then(x => x.name) : null)
+            .catch(() => null);
+    return downloadClient;
+}
+
+// sendToDownloadClient sends the torrent to the download client of the user, using the button
+// to display the progress.
+function sendToDownloadClient(infoHash, button) {
+    button.disabled = true;
+    myFetch("api/v0.1/torrents/" + infoHash + "/send", {method: "POST"})
+        .then(() => {
+            button.textContent = t("common.sent", "Sent!");
+        })
+        .catch(err => {
+            button.disabled = false;
+            alert(t("common.sendFailed", "Could not send the torrent:") + " " + err);
+        });
+}
+
 /**
  * Returns the ISO 8601 week number for this date.
  *
@@ -82,4 +142,114 @@ Date.prototype.getWeek = function (dowOffset) {
         weeknum = Math.floor((daynum+day-1)/7);
     }
     return weeknum;
-};
\ No newline at end of file
+};
+
+// Offer type-ahead suggestions on every search box.
+document.addEventListener("DOMContentLoaded", function () {
+    for (let input of document.querySelectorAll("input[name=query]"))
+        enableSuggestions(input);
+});
+
+function enableSuggestions(input) {
+    const datalist = document.createElement("datalist");
+    datalist.id = "suggestions-" + (input.id || input.name);
+    input.parentNode.appendChild(datalist);
+    input.setAttribute("list", datalist.id);
+
+    let timeout = null;
+    input.addEventListener("input", function () {
+        clearTimeout(timeout);
+
+        const prefix = input.value;
+        if (prefix.trim().length < 2)
+            return;
+
+        // Wait for the user to stop typing instead of asking on every single key stroke.
+        timeout = setTimeout(function () {
+            myFetch("api/v1/suggest?" + encodeQueryData({prefix: prefix}))
+                .then(x => x.json())
+                .then(suggestions => {
+                    // Ignore the responses of the outdated requests.
+                    if (prefix !== input.value)
+                        return;
+
+                    datalist.textContent = "";
+                    for (let suggestion of suggestions) {
+                        const option = document.createElement("option");
+                        option.value = suggestion;
+                        datalist.appendChild(option);
+                    }
+                })
+                .catch(() => {});  // Suggestions are nice-to-have, so fail silently.
+        }, 200);
+    });
+}
+
+
+// Messages of the negotiated language by their keys; null until they are loaded.
+let messages = null;
+
+fetch("api/v0.1/i18n", {credentials: "same-origin"})
+    .then(x => x.json())
+    .then(x => {
+        messages = x.messages;
+        document.documentElement.lang = x.language;
+
+        const onLoad = function () {
+            translate(document);
+
+            const languageSelect = document.getElementById("language");
+            if (languageSelect)
+                languageSelect.value = x.language;
+        };
+        if (document.readyState === "loading")
+            document.addEventListener("DOMContentLoaded", onLoad);
+        else
+            onLoad();
+    })
+    .catch(err => console.log("could not load the messages", err));
+
+// t returns the message of the key in the negotiated language, or the fallback (in English) if
+// the messages are not loaded (yet).
+function t(key, fallback) {
+    return (messages && messages[key]) || fallback;
+}
+
+// translate translates the elements under the root that are marked with data-i18n (for their
+// text), data-i18n-placeholder, and data-i18n-title attributes. Call it after rendering templates.
+function translate(root) {
+    if (messages === null)
+        return;
+
+    for (let e of root.querySelectorAll("[data-i18n]"))
+        e.textContent = t(e.dataset.i18n, e.textContent);
+    for (let e of root.querySelectorAll("[data-i18n-placeholder]"))
+        e.placeholder = t(e.dataset.i18nPlaceholder, e.placeholder);
+    for (let e of root.querySelectorAll("[data-i18n-title]"))
+        e.title = t(e.dataset.i18nTitle, e.title);
+}
+
+// setLanguage overrides the language negotiated from the browser's preferences.
+function setLanguage(language) {
+    document.cookie = "lang=" + encodeURIComponent(language) + "; path=/; max-age=31536000; SameSite=Lax";
+    location.reload();
+}
+
+// The clicks of the magnet links are counted (without recording who clicked) as the popularities of
+// the torrents; the browsers open the links themselves, hence they are reported using beacons.
+document.addEventListener("click", function (event) {
+    const a = event.target.closest && event.target.closest("a[href^='magnet:']");
+    if (!a || !navigator.sendBeacon)
+        return;
+    const infoHash = a.getAttribute("href").match(/btih:([0-9a-f]{40})/i);
+    if (infoHash)
+        navigator.sendBeacon("api/v0.1/torrents/" + infoHash[1].toLowerCase() + "/interactions",
+            new URLSearchParams({interaction: "magnet"}));
+});
+
+// The service worker caches the shell so that magneticow can be installed as an app and opened
+// offline; see sw.js
+if ("serviceWorker" in navigator) {
+    navigator.serviceWorker.register("sw.js")
+        .catch(err => console.log("could not register the service worker", err));
+}
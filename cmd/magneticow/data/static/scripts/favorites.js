@@ -0,0 +1,36 @@
+"use strict";
+
+window.onload = function () {
+    myFetch("api/v0.1/favorites").then(x => x.json()).then(favorites => {
+        const template = document.getElementById("item-template").innerHTML;
+        const ul = document.querySelector("main ul");
+
+        for (let favorite of favorites) {
+            const torrent = favorite.torrent;
+            ul.insertAdjacentHTML("beforeend", Mustache.render(template, {
+                infoHash: torrent.infoHash,
+                name: torrent.name,
+                size: fileSize(torrent.size),
+                discoveredOn: humaniseDate(torrent.discoveredOn),
+            }));
+        }
+        translate(ul);
+
+        document.getElementById("empty").hidden = favorites.length > 0;
+    }).catch(err => {
+        alert(t("favorites.loadFailed", "Could not load the favorites:") + " " + err);
+    });
+};
+
+
+function removeFavorite(infoHash, button) {
+    button.disabled = true;
+    myFetch("api/v0.1/torrents/" + infoHash + "/favorite", {method: "DELETE"}).then(() => {
+        const ul = button.closest("ul");
+        button.closest("li").remove();
+        document.getElementById("empty").hidden = ul.children.length > 0;
+    }).catch(err => {
+        button.disabled = false;
+        alert(t("favorites.removeFailed", "Could not remove the favorite:") + " " + err);
+    });
+}
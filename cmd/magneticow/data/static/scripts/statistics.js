@@ -13,34 +13,44 @@ window.onload = function() {
     load();
 };
 
+// themed returns the layout with the colours of the current theme, so that the graphs are legible
+// in the dark theme too.
+function themed(layout) {
+    const style = getComputedStyle(document.documentElement);
+    layout.paper_bgcolor = style.getPropertyValue("--background").trim();
+    layout.plot_bgcolor = layout.paper_bgcolor;
+    layout.font = {color: style.getPropertyValue("--foreground").trim()};
+    return layout;
+}
+
 function plot(stats) {
     Plotly.newPlot("nDiscovered", [{
         x: Object.keys(stats.nDiscovered),
         y: Object.values(stats.nDiscovered),
         mode: "lines+markers"
-    }], {
-        title: "Torrents Discovered",
+    }], themed({
+        title: t("statistics.torrentsDiscovered", "Torrents Discovered"),
         xaxis: {
-            title: "Date / Time",
+            title: t("statistics.dateTime", "Date / Time"),
         },
         yaxis: {
-            title: "Number of Torrents Discovered",
+            title: t("statistics.nTorrentsDiscovered", "Number of Torrents Discovered"),
         }
-    });
+    }));
 
     Plotly.newPlot("nFiles", [{
         x: Object.keys(stats.nFiles),
         y: Object.values(stats.nFiles),
         mode: "lines+markers"
-    }], {
-        title: "Files Discovered",
+    }], themed({
+        title: t("statistics.filesDiscovered", "Files Discovered"),
         xaxis: {
-            title: "Date / Time",
+            title: t("statistics.dateTime", "Date / Time"),
         },
         yaxis: {
-            title: "Number of Files Discovered",
+            title: t("statistics.nFilesDiscovered", "Number of Files Discovered"),
         }
-    });
+    }));
 
     let totalSize = Object.values(stats.totalSize);
     for (let i in totalSize) {
@@ -51,15 +61,125 @@ function plot(stats) {
         x: Object.keys(stats.totalSize),
         y: totalSize,
         mode: "lines+markers"
-    }], {
-        title: "Total Size of Files Discovered",
+    }], themed({
+        title: t("statistics.totalSize", "Total Size of Files Discovered"),
         xaxis: {
-            title: "Date / Time",
+            title: t("statistics.dateTime", "Date / Time"),
         },
         yaxis: {
-            title: "Total Size of Files Discovered (in TiB)",
+            title: t("statistics.totalSizeTiB", "Total Size of Files Discovered (in TiB)"),
         }
-    });
+    }));
+}
+
+
+// plotDashboard plots the summary of the torrents discovered in the period, and displays the
+// health of the crawler.
+function plotDashboard(dashboard, from) {
+    const now = Date.now() / 1000;
+    const hours = Math.max((now - from) / 3600, 1);
+
+    document.getElementById("nDiscoveredPeriod").textContent = dashboard.nDiscovered.toLocaleString();
+    document.getElementById("perHour").textContent = (dashboard.nDiscovered / hours).toFixed(1);
+    document.getElementById("lastDiscovered").textContent = dashboard.lastDiscoveredOn ?
+        new Date(dashboard.lastDiscoveredOn * 1000).toLocaleString(document.documentElement.lang) :
+        t("statistics.never", "never");
+
+    // The crawler is assumed to be stalled if it has not discovered anything in the past hour.
+    const status = document.getElementById("status");
+    const stalled = now - dashboard.lastDiscoveredOn > 3600;
+    status.className = stalled ? "stalled" : "healthy";
+    status.textContent = stalled ?
+        t("statistics.stalled", "The crawler seems to be stalled: nothing has been discovered in the past hour.") :
+        t("statistics.healthy", "The crawler is healthy.");
+
+    Plotly.newPlot("sizeDistribution", [{
+        x: dashboard.sizeDistribution.map(bucket => bucket.maxSize ?
+            fileSize(bucket.minSize) + " – " + fileSize(bucket.maxSize) : "≥ " + fileSize(bucket.minSize)),
+        y: dashboard.sizeDistribution.map(bucket => bucket.nTorrents),
+        type: "bar"
+    }], themed({
+        title: t("statistics.sizeDistribution", "Size Distribution"),
+        yaxis: {
+            title: t("statistics.nTorrents", "Number of Torrents"),
+        }
+    }));
+
+    const categories = Object.keys(dashboard.categories);
+    Plotly.newPlot("categories", [{
+        labels: categories.map(category => t("statistics.category." + (category || "unknown"), category || "unknown")),
+        values: categories.map(category => dashboard.categories[category]),
+        type: "pie"
+    }], themed({
+        title: t("statistics.categories", "Categories"),
+    }));
+
+    const sources = Object.keys(dashboard.sources);
+    Plotly.newPlot("sources", [{
+        labels: sources.map(source => t("statistics.source." + (source || "unknown"), source || "unknown")),
+        values: sources.map(source => dashboard.sources[source]),
+        type: "pie"
+    }], themed({
+        title: t("statistics.sources", "Sources"),
+    }));
+
+    Plotly.newPlot("topExtensions", [{
+        x: dashboard.topExtensions.map(x => "." + x.extension),
+        y: dashboard.topExtensions.map(x => x.nFiles),
+        type: "bar"
+    }], themed({
+        title: t("statistics.topExtensions", "Top File Extensions"),
+        yaxis: {
+            title: t("statistics.nFiles", "Number of Files"),
+        }
+    }));
+
+    // Countries are recorded only if magneticod is run with --geoip-db, so there may be none.
+    const countries = Object.keys(dashboard.countries || {})
+        .sort((a, b) => dashboard.countries[b] - dashboard.countries[a])
+        .slice(0, 20);
+    Plotly.newPlot("countries", [{
+        x: countries,
+        y: countries.map(country => dashboard.countries[country]),
+        type: "bar"
+    }], themed({
+        title: t("statistics.countries", "Top Countries of the Peers"),
+        yaxis: {
+            title: t("statistics.nTorrents", "Number of Torrents"),
+        }
+    }));
+}
+
+
+// plotCrawlerStats plots the hourly statistics of the crawler(s), which are kept across their
+// restarts.
+function plotCrawlerStats(stats) {
+    const hours = stats.map(s => new Date(s.hour * 1000));
+    Plotly.newPlot("crawlerStats", [{
+        x: hours,
+        y: stats.map(s => s.nTrawled),
+        name: t("statistics.nTrawled", "Infohashes Trawled"),
+        mode: "lines+markers"
+    }, {
+        x: hours,
+        y: stats.map(s => s.nFetched),
+        name: t("statistics.nFetched", "Metadata Fetched"),
+        mode: "lines+markers",
+        yaxis: "y2"
+    }], themed({
+        title: t("statistics.crawlerPerformance", "Crawler Performance (per Hour)"),
+        xaxis: {
+            title: t("statistics.dateTime", "Date / Time"),
+        },
+        yaxis: {
+            title: t("statistics.nTrawled", "Infohashes Trawled"),
+        },
+        yaxis2: {
+            title: t("statistics.nFetched", "Metadata Fetched"),
+            overlaying: "y",
+            side: "right"
+        }
+    }));
 }
 
 
@@ -67,9 +187,20 @@ function load() {
     const n = nElem.valueAsNumber;
     const unit = unitElem.options[unitElem.selectedIndex].value;
 
-    const reqURL = "/api/v0.1/statistics?" + encodeQueryData({
+    const from = Math.floor(Date.now() / 1000 - n * unit2seconds(unit));
+    myFetch("api/v0.1/dashboard?" + encodeQueryData({from: from}))
+        .then(response => response.json())
+        .then(dashboard => plotDashboard(dashboard, from))
+        .catch(err => console.log("could not load the dashboard", err));
+    myFetch("api/v0.1/crawlerStats?" + encodeQueryData({from: from}))
+        .then(response => response.json())
+        .then(plotCrawlerStats)
+        .catch(err => console.log("could not load the crawler stats", err));
+
+    const reqURL = "api/v0.1/statistics?" + encodeQueryData({
         from: fromString(n, unit),
         n   : n,
+        tz  : Intl.DateTimeFormat().resolvedOptions().timeZone,
     });
     console.log("reqURL", reqURL);
 
@@ -92,24 +223,24 @@ function load() {
 
 function fromString(n, unit) {
     const from = new Date(Date.now() - n * unit2seconds(unit) * 1000);
-    console.log("frommmm", unit, unit2seconds(unit), from);
 
-    let str = "" + from.getUTCFullYear();
+    let str = "" + from.getFullYear();
     if (unit === "years")
         return str;
     else if (unit === "weeks") {
-        str += "-W" + leftpad(from.getWeek());
-        return str;
+        // ISO 8601 weeks belong to the year of their Thursday, e.g. 2021-01-03 is in 2020-W53.
+        const thursday = new Date(from.getFullYear(), from.getMonth(), from.getDate() + 3 - (from.getDay() + 6) % 7);
+        return thursday.getFullYear() + "-W" + leftpad(thursday.getWeek());
     } else {
-        str += "-" + leftpad(from.getUTCMonth() + 1);
+        str += "-" + leftpad(from.getMonth() + 1);
         if (unit === "months")
             return str;
 
-        str += "-" + leftpad(from.getUTCDate());
+        str += "-" + leftpad(from.getDate());
         if (unit === "days")
             return str;
 
-        str += "T" + leftpad(from.getUTCHours());
+        str += "T" + leftpad(from.getHours());
         if (unit === "hours")
             return str;
     }
@@ -117,15 +248,6 @@ function fromString(n, unit) {
     return str;
 
 
-    function unit2seconds(u) {
-        if (u === "hours")  return            60 * 60;
-        if (u === "days")   return       24 * 60 * 60;
-        if (u === "weeks")  return   7 * 24 * 60 * 60;
-        if (u === "months") return  30 * 24 * 60 * 60;
-        if (u === "years")  return 365 * 24 * 60 * 60;
-    }
-
-
     // pad x to minimum of n characters with c
     function leftpad(x, n, c) {
         if (n === undefined)
@@ -140,3 +262,12 @@ function fromString(n, unit) {
             return x;
     }
 }
+
+
+function unit2seconds(u) {
+    if (u === "hours")  return            60 * 60;
+    if (u === "days")   return       24 * 60 * 60;
+    if (u === "weeks")  return   7 * 24 * 60 * 60;
+    if (u === "months") return  30 * 24 * 60 * 60;
+    if (u === "years")  return 365 * 24 * 60 * 60;
+}
@@ -0,0 +1,89 @@
+"use strict";
+
+// sw.js is the service worker of magneticow, served at the base path (instead of under static/) so
+// that its scope is the whole site. It caches the shell (i.e. the pages and the static resources)
+// so that the web interface can be opened offline; the API is never cached, for the results would
+// be stale.
+
+// Bump the version whenever the shell changes, so that the stale caches are cleared.
+const CACHE = "magneticow-v22";
+
+// The paths are relative to the base path, which magneticow might be served under (see
+// --base-path), as is this script.
+const BASE = new URL(self.registration.scope).pathname;
+
+const SHELL = [
+    "./",
+    "torrents",
+    "statistics",
+    "favorites",
+    "custom.css",
+    "static/manifest.webmanifest",
+    "static/assets/icon-192.png",
+    "static/styles/reset.css",
+    "static/styles/essential.css",
+    "static/styles/homepage.css",
+    "static/styles/torrents.css",
+    "static/styles/torrent.css",
+    "static/styles/statistics.css",
+    "static/styles/vanillatree-v0.0.3.css",
+    "static/scripts/theme.js",
+    "static/scripts/common.js",
+    "static/scripts/torrents.js",
+    "static/scripts/torrent.js",
+    "static/scripts/statistics.js",
+    "static/scripts/favorites.js",
+    "static/scripts/mustache-v2.3.0.min.js",
+    "static/scripts/naturalSort-v0.8.1.js",
+    "static/scripts/vanillatree-v0.0.3.js",
+];
+
+self.addEventListener("install", event => {
+    event.waitUntil(
+        caches.open(CACHE)
+            .then(cache => cache.addAll(SHELL))
+            .then(() => self.skipWaiting())
+    );
+});
+
+self.addEventListener("activate", event => {
+    event.waitUntil(
+        caches.keys()
+            .then(keys => Promise.all(keys.filter(key => key !== CACHE).map(key => caches.delete(key))))
+            .then(() => self.clients.claim())
+    );
+});
+
+self.addEventListener("fetch", event => {
+    const request = event.request;
+    const url = new URL(request.url);
+    if (request.method !== "GET" || url.origin !== location.origin || url.pathname.startsWith(BASE + "api/"))
+        return;
+
+    if (url.pathname.startsWith(BASE + "static/")) {
+        // Cache-first, for the static resources rarely change.
+        event.respondWith(
+            caches.match(request).then(cached => cached || fetch(request).then(response => {
+                if (response.ok) {
+                    const copy = response.clone();
+                    caches.open(CACHE).then(cache => cache.put(request, copy));
+                }
+                return response;
+            }))
+        );
+    } else if (request.mode === "navigate" || url.pathname === BASE + "custom.css") {
+        // Network-first, falling back to the cached page (ignoring the query, so that e.g. a
+        // search can at least show the shell), and to the homepage as a last resort.
+        event.respondWith(
+            fetch(request).then(response => {
+                if (response.ok && !url.search) {
+                    const copy = response.clone();
+                    caches.open(CACHE).then(cache => cache.put(request, copy));
+                }
+                return response;
+            }).catch(() =>
+                caches.match(request, {ignoreSearch: true}).then(cached => cached || caches.match("./"))
+            )
+        );
+    }
+});
@@ -0,0 +1,24 @@
+"use strict";
+
+// theme.js must be loaded synchronously in <head> so that the chosen theme is applied before
+// anything is rendered, lest the page flashes in the other theme.
+(function () {
+    const match = document.cookie.match(/(?:^|;\s*)theme=(light|dark)(?:;|$)/);
+    if (match)
+        document.documentElement.dataset.theme = match[1];
+})();
+
+// toggleTheme cycles through the automatic (i.e. whatever the browser prefers), dark, and light
+// themes, persisting the choice in a cookie.
+function toggleTheme() {
+    const root = document.documentElement;
+    const next = {"": "dark", "dark": "light", "light": ""}[root.dataset.theme || ""];
+
+    if (next) {
+        root.dataset.theme = next;
+        document.cookie = "theme=" + next + "; path=/; max-age=31536000; SameSite=Lax";
+    } else {
+        delete root.dataset.theme;
+        document.cookie = "theme=; path=/; max-age=0; SameSite=Lax";
+    }
+}
@@ -9,9 +9,13 @@
 
 
 window.onload = function () {
-    let infoHash = window.location.pathname.split("/")[2];
+    // The path is either torrent/<infohash>/<slug> or torrent/<infohash> (see permalink.go).
+    let infoHash = window.location.pathname.match(/[0-9a-f]{40}/)[0];
 
-    fetch("/api/v0.1/torrents/" + infoHash).then(x => x.json()).then(x => {
+    Promise.all([
+        fetch("api/v0.1/torrents/" + infoHash).then(x => x.json()),
+        getDownloadClient(),
+    ]).then(([x, clientName]) => {
         document.querySelector("title").innerText = x.name + " - magneticow";
 
         const template = document.getElementById("main-template").innerHTML;
@@ -21,28 +25,121 @@ window.onload = function () {
             sizeHumanised: fileSize(x.size),
             discoveredOnHumanised: humaniseDate(x.discoveredOn),
             nFiles: x.nFiles,
+            extensionsHumanised: humaniseExtensions(x.extensions),
+            popularity: x.popularity,
+            verified: x.moderation === "verified",
+            flagged: x.moderation === "flagged",
+            downloadClient: clientName,
+            sendTo: t("common.sendTo", "Send to") + " " + clientName,
         });
+        translate(document.querySelector("main"));
 
-        fetch("/api/v0.1/torrents/" + infoHash + "/filelist").then(x => x.json()).then(x => {
+        const send = document.getElementById("send");
+        if (send)
+            send.onclick = () => sendToDownloadClient(infoHash, send);
+
+        const favorite = document.getElementById("favorite");
+        const setFavorite = function (isFavorite) {
+            favorite.setAttribute("aria-pressed", isFavorite);
+            favorite.innerHTML = isFavorite ? "&#9733;" : "&#9734;";
+            favorite.title = isFavorite ? t("torrent.unfavorite", "Remove from the favorites")
+                : t("torrent.favorite", "Add to the favorites");
+        };
+        // The favorites are not served with --no-auth, in which case they stay hidden.
+        myFetch("api/v0.1/torrents/" + infoHash + "/favorite").then(x => x.json()).then(x => {
+            setFavorite(x.favorite);
+            favorite.hidden = false;
+            document.getElementById("favorites").hidden = false;
+        }).catch(() => {});
+        favorite.onclick = function () {
+            const isFavorite = favorite.getAttribute("aria-pressed") === "true";
+            favorite.disabled = true;
+            myFetch("api/v0.1/torrents/" + infoHash + "/favorite", {
+                method: isFavorite ? "DELETE" : "PUT",
+            }).then(() => {
+                setFavorite(!isFavorite);
+            }).catch(err => {
+                alert(t("torrent.favoriteFailed", "Could not change the favorite:") + " " + err);
+            }).finally(() => {
+                favorite.disabled = false;
+            });
+        };
+
+        const report = document.getElementById("report");
+        report.onclick = function () {
+            const reason = window.prompt(t("torrent.reportPrompt", "Why are you reporting this torrent?"));
+            if (!reason)
+                return;
+
+            myFetch("api/v0.1/torrents/" + infoHash + "/report", {
+                method: "POST",
+                body: new URLSearchParams({reason: reason}),
+            }).then(() => {
+                report.disabled = true;
+                report.innerText = t("torrent.reported", "Reported, thank you!");
+            }).catch(err => {
+                alert(t("torrent.reportFailed", "Could not report the torrent:") + " " + err);
+            });
+        };
+
+        myFetch("api/v0.1/torrents/" + infoHash + "/filetree").then(x => x.json()).then(root => {
             const tree = new VanillaTree('#fileTree', {
                 placeholder: 'Loading...',
             });
 
-            for (let e of x) {
-                let pathElems = e.path.split("/");
+            // Torrents with thousands of files would render a gigantic list if every directory
+            // were opened, so open only the top-level ones in that case.
+            const openAll = root.nFiles <= 100;
+
+            (function add(node, parentID, depth) {
+                for (let child of node.children || []) {
+                    const id = parentID === undefined ? child.name : parentID + "/" + child.name;
+                    const isDir = child.children !== undefined;
 
-                for (let i = 0; i < pathElems.length; i++) {
                     tree.add({
-                        id: pathElems.slice(0, i + 1).join("/"),
-                        parent: i >= 1 ? pathElems.slice(0, i).join("/") : undefined,
-                        label: pathElems[i] + (i === pathElems.length - 1 ? "&emsp;<tt>" + fileSize(e.size) + "</tt>" : ""),
-                        opened: true,
+                        id: id,
+                        parent: parentID,
+                        label: child.name + "&emsp;<tt>" + fileSize(child.size) +
+                            (isDir ? ", " + child.nFiles + " " + t("torrent.filesUnit", "files") : "") + "</tt>",
+                        opened: openAll || depth === 0,
                     });
+                    add(child, id, depth + 1);
                 }
-            }
+            })(root, undefined, 0);
         });
 
-        myFetch("/api/v0.1/torrents/" + infoHash + "/readme")
+        const fileFilter = document.getElementById("fileFilter");
+        fileFilter.oninput = function () {
+            const fileTree = document.getElementById("fileTree");
+            const fileMatches = document.getElementById("fileMatches");
+
+            if (fileFilter.value === "") {
+                fileMatches.hidden = true;
+                fileTree.hidden = false;
+                return;
+            }
+
+            const path = fileFilter.value;
+            myFetch("api/v0.1/torrents/" + infoHash + "/filelist?" + encodeQueryData({
+                path : path,
+                limit: 100,
+            })).then(x => x.json()).then(files => {
+                // Ignore the responses of the outdated requests.
+                if (path !== fileFilter.value)
+                    return;
+
+                fileMatches.textContent = "";
+                for (let file of files) {
+                    const li = document.createElement("li");
+                    li.textContent = file.path + " (" + fileSize(file.size) + ")";
+                    fileMatches.appendChild(li);
+                }
+                fileMatches.hidden = false;
+                fileTree.hidden = true;
+            });
+        };
+
+        myFetch("api/v0.1/torrents/" + infoHash + "/readme")
             .then(response => {
                 return response.text();
             })
@@ -56,3 +153,22 @@ window.onload = function () {
             });
     });
 };
+
+
+// humaniseExtensions lists the most significant extensions with their shares of the total size,
+// such as "95% mkv, 5% srt".
+function humaniseExtensions(extensions) {
+    if (!extensions)
+        return "";
+
+    let shares = [];
+    for (let e of extensions.slice(0, 5)) {
+        // Skip the insignificant ones.
+        if (e.share < 0.01 && shares.length > 0)
+            break;
+
+        shares.push(Math.round(e.share * 100) + "% " + (e.extension || t("torrent.noExtension", "(no extension)")) +
+            " (" + e.nFiles + " " + (e.nFiles === 1 ? t("torrent.fileUnit", "file") : t("torrent.filesUnit", "files")) + ")");
+    }
+    return shares.join(", ");
+}
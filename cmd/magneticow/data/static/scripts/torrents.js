@@ -1,10 +1,18 @@
 "use strict";
 
-const query = (new URL(location)).searchParams.get("query")
+const params = (new URL(location)).searchParams
+    , query = params.get("query")
     , epoch = Math.floor(Date.now() / 1000)
+    // The discovery window of the advanced search, whose dates (in UTC) are both inclusive.
+    , since = parseDate(params.get("since"), 0)
+    , until = parseDate(params.get("until"), 1)
 ;
 let orderBy, ascending;  // use `setOrderBy()` to modify orderBy
 let lastOrderedValue, lastID;
+let loading = false, exhausted = false;
+let selected = null;  // the <li> of the torrent selected using the keyboard, if any
+let clientName = null;  // the name of the download client of the user, if any
+let proofOfWork = null;  // the solution of the challenge that the next page is requested with, if any
 
 
 window.onload = function() {
@@ -20,21 +28,69 @@ window.onload = function() {
 
         setOrderBy("RELEVANCE");
     } else {
-        title.textContent = "Most recent torrents - magneticow";
+        title.textContent = t("torrents.mostRecent", "Most recent torrents") + " - magneticow";
 
         ascending = false;
         setOrderBy("DISCOVERED_ON");
     }
+    // The most popular first (see the advanced search).
+    if (params.get("orderBy") === "POPULARITY") {
+        ascending = false;
+        setOrderBy("POPULARITY");
+    }
+
+    if (since !== undefined || until !== undefined || orderBy === "POPULARITY") {
+        const advanced = document.getElementById("advanced");
+        advanced.setAttribute("open", "");
+        advanced.querySelector("input[name=since]").value = params.get("since");
+        advanced.querySelector("input[name=until]").value = params.get("until");
+        advanced.querySelector("select[name=orderBy]").value = orderBy === "POPULARITY" ? orderBy : "";
+    }
 
     if (query) {
         const feedAnchor = document.getElementById("feed-anchor");
-        feedAnchor.setAttribute("href", "/feed?query=" + encodeURIComponent(query));
+        feedAnchor.setAttribute("href", "feed?query=" + encodeURIComponent(query));
+    }
+
+    const exportAnchor = document.getElementById("export-anchor");
+    exportAnchor.setAttribute("href", "api/v0.1/torrents/export?" + encodeQueryData({
+        query    : query || undefined,
+        epoch    : epoch,
+        orderBy  : orderBy,
+        ascending: ascending,
+        since    : since,
+        until    : until,
+    }));
+
+    getDownloadClient().then(name => {
+        clientName = name;
+        load();
+    });
+
+    // Load the next page as soon as the footer scrolls into view (the button is still there for
+    // the browsers without IntersectionObserver).
+    if ("IntersectionObserver" in window) {
+        const observer = new IntersectionObserver(entries => {
+            if (entries.some(entry => entry.isIntersecting))
+                load();
+        }, {rootMargin: "200px"});
+        observer.observe(document.querySelector("footer"));
     }
 
-    load();
+    document.addEventListener("keydown", onKeyDown);
 };
 
 
+// parseDate returns the Unix time of the start of the day (in UTC) that is @days after the given
+// date (in YYYY-MM-DD), or undefined if it is empty or invalid.
+function parseDate(date, days) {
+    const time = Date.parse(date || "");
+    if (isNaN(time))
+        return undefined;
+    return time / 1000 + days * 86400;
+}
+
+
 function setOrderBy(x) {
     const validValues = [
         "TOTAL_SIZE",
@@ -43,6 +99,8 @@ function setOrderBy(x) {
         "N_FILES",
         "N_SEEDERS",
         "N_LEECHERS",
+        "SPAM_SCORE",
+        "POPULARITY",
         "RELEVANCE"
     ];
     if (!validValues.includes(x)) {
@@ -58,24 +116,35 @@ function orderedValue(torrent) {
     else if (orderBy === "N_FILES")       return torrent.nFiles;
     else if (orderBy === "N_SEEDERS")     alert("implement it server side first!");
     else if (orderBy === "N_LEECHERS")    alert("implement it server side first!");
+    else if (orderBy === "SPAM_SCORE")    return torrent.spamScore;
+    else if (orderBy === "POPULARITY")    return torrent.popularity;
     else if (orderBy === "RELEVANCE")     return torrent.relevance;
 }
 
 
 function load() {
-    const button   = document.getElementsByTagName("button")[0];
-    button.textContent = "Loading More Results...";
+    if (loading || exhausted)
+        return;
+    loading = true;
+
+    const button   = document.querySelector("footer button");
+    button.textContent = t("torrents.loading", "Loading More Results...");
     button.setAttribute("disabled", "");  // disable the button whilst loading...
 
     const ul       = document.querySelector("main ul");
     const template = document.getElementById("item-template").innerHTML;
-    const reqURL   = "/api/v0.1/torrents?" + encodeQueryData({
+    const reqURL   = "api/v0.1/torrents?" + encodeQueryData({
         query           : query,
         epoch           : epoch,
         lastID          : lastID,
         lastOrderedValue: lastOrderedValue,
         orderBy         : orderBy,
-        ascending       : ascending
+        ascending       : ascending,
+        since           : since,
+        until           : until,
+        // Only the fields that are listed (and the one ordered by, which is always included).
+        fields          : "size,discoveredOn",
+        envelope        : true
     });
 
     console.log("reqURL", reqURL);
@@ -85,15 +154,47 @@ function load() {
         if (req.readyState !== 4)
             return;
 
-        button.textContent = "Load More Results";
+        loading = false;
+        button.textContent = t("torrents.loadMore", "Load More Results");
         button.removeAttribute("disabled");
 
-        if (req.status !== 200)
+        // Load the page again once the proof-of-work challenge is solved (see common.js).
+        const challenge = req.getResponseHeader("X-Proof-Of-Work-Challenge");
+        if (req.status === 429 && challenge && proofOfWork === null) {
+            loading = true;
+            button.textContent = t("torrents.solvingChallenge", "Too many searches, please wait...");
+            button.setAttribute("disabled", "");
+            solveChallenge(challenge, Number(req.getResponseHeader("X-Proof-Of-Work-Difficulty")))
+                .then(solution => {
+                    proofOfWork = solution;
+                    loading = false;
+                    load();
+                })
+                .catch(err => {
+                    loading = false;
+                    button.textContent = t("torrents.loadMore", "Load More Results");
+                    button.removeAttribute("disabled");
+                    alert(err.message);
+                });
+            return;
+        }
+        proofOfWork = null;
+
+        if (req.status !== 200) {
             alert(req.responseText);
+            return;
+        }
+
+        const response = JSON.parse(req.responseText);
+        if (response.didYouMean)
+            showDidYouMean(response.didYouMean);
+        if (response.unknownInfoHash)
+            showUnknownInfoHash(response.unknownInfoHash);
 
-        let torrents = JSON.parse(req.responseText);
+        let torrents = response.torrents;
         if (torrents.length === 0) {
-            button.textContent = "No More Results";
+            exhausted = true;
+            button.textContent = t("torrents.noMore", "No More Results");
             button.setAttribute("disabled", "");
             return;
         }
@@ -102,14 +203,160 @@ function load() {
         lastID           = last.id;
         lastOrderedValue = orderedValue(last);
 
+        const sendTo = t("common.sendTo", "Send to") + " " + clientName;
         for (let t of torrents) {
             t.size = fileSize(t.size);
             t.discoveredOn = humaniseDate(t.discoveredOn);
+            t.downloadClient = clientName;
+            t.sendTo = sendTo;
 
-            ul.innerHTML += Mustache.render(template, t);
+            ul.insertAdjacentHTML("beforeend", Mustache.render(template, t));
         }
+        translate(ul);
     };
 
     req.open("GET", reqURL);
+    if (proofOfWork !== null)
+        req.setRequestHeader("X-Proof-Of-Work", proofOfWork);
     req.send();
 }
+
+
+function showUnknownInfoHash(infoHash) {
+    const p = document.getElementById("unknownInfoHash");
+    p.textContent = t("torrents.unknownInfoHash", "The torrent of this infohash has not been discovered yet:") + " " + infoHash + " ";
+    p.removeAttribute("hidden");
+
+    const status = document.createElement("span");
+    const button = document.createElement("button");
+    button.textContent = t("torrents.request", "request it");
+    button.hidden = true;
+    button.onclick = function() {
+        button.disabled = true;
+        myFetch("api/v0.1/torrents/" + infoHash + "/request", {method: "POST"})
+            .then(response => response.json())
+            .then(request => {
+                button.hidden = true;
+                showRequestStatus(infoHash, request, status);
+            })
+            .catch(err => {
+                button.disabled = false;
+                alert(t("torrents.requestFailed", "Could not request the torrent:") + " " + err);
+            });
+    };
+    p.appendChild(button);
+    p.appendChild(status);
+
+    // The torrent might have been requested already, in which case its status is shown instead.
+    myFetch("api/v0.1/torrents/" + infoHash + "/request")
+        .then(response => response.json())
+        .then(request => showRequestStatus(infoHash, request, status))
+        .catch(() => { button.hidden = false; });
+}
+
+
+// showRequestStatus shows the status of the request for the torrent, which is polled until the
+// torrent is either fetched or given up on by the crawler.
+function showRequestStatus(infoHash, request, status) {
+    const messages = {
+        "pending":    t("torrents.request.pending", "Requested; it will be looked up on the DHT shortly."),
+        "looking-up": t("torrents.request.looking-up", "Looking it up on the DHT..."),
+        "fetched":    t("torrents.request.fetched", "Fetched! Search again to see it."),
+        "failed":     t("torrents.request.failed", "Could not find it on the DHT."),
+    };
+    status.textContent = messages[request.status] || request.status;
+
+    if (request.status === "pending" || request.status === "looking-up") {
+        setTimeout(function() {
+            myFetch("api/v0.1/torrents/" + infoHash + "/request")
+                .then(response => response.json())
+                .then(request => showRequestStatus(infoHash, request, status))
+                .catch(() => {});
+        }, 15000);
+    }
+}
+
+
+function showDidYouMean(corrections) {
+    const p = document.getElementById("didYouMean");
+    p.textContent = t("torrents.didYouMean", "Did you mean") + " ";
+    corrections.forEach((correction, i) => {
+        if (i > 0)
+            p.appendChild(document.createTextNode(i === corrections.length - 1 ? " " + t("torrents.or", "or") + " " : ", "));
+
+        const a = document.createElement("a");
+        a.href = "torrents?" + encodeQueryData({query: correction});
+        a.textContent = correction;
+        p.appendChild(a);
+    });
+    p.appendChild(document.createTextNode("?"));
+    p.hidden = false;
+}
+
+
+// onKeyDown handles the keyboard shortcuts: j/k to select the next/previous torrent, enter to open
+// the selected one, m to copy its magnet link, and / to focus the search box.
+function onKeyDown(event) {
+    if (event.ctrlKey || event.altKey || event.metaKey)
+        return;
+    if (["INPUT", "TEXTAREA", "SELECT"].includes(document.activeElement.tagName))
+        return;
+
+    switch (event.key) {
+    case "j":
+        select(selected ? selected.nextElementSibling : document.querySelector("main ul li"));
+        break;
+    case "k":
+        select(selected ? selected.previousElementSibling : null);
+        break;
+    case "Enter":
+        if (!selected)
+            return;
+        location.href = selected.querySelector("h3 a").href;
+        break;
+    case "m":
+        if (!selected)
+            return;
+        copyMagnet(selected.querySelector("a[href^='magnet:']").href);
+        break;
+    case "/":
+        document.querySelector("header input").focus();
+        break;
+    default:
+        return;
+    }
+    event.preventDefault();
+}
+
+
+function select(li) {
+    if (!li)
+        return;
+
+    if (selected)
+        selected.classList.remove("selected");
+    selected = li;
+    selected.classList.add("selected");
+    selected.scrollIntoView({block: "nearest"});
+
+    // Load the next page ahead of time when the last torrent is selected.
+    if (!selected.nextElementSibling)
+        load();
+}
+
+
+function copyMagnet(magnet) {
+    if (!navigator.clipboard) {  // e.g. when not served over HTTPS
+        prompt(t("common.magnetTitle", "Download this torrent using magnet"), magnet);
+        return;
+    }
+
+    navigator.clipboard.writeText(magnet)
+        .then(() => {
+            const status = document.getElementById("status");
+            status.textContent = t("torrents.magnetCopied", "Magnet link copied");
+            status.hidden = false;
+            setTimeout(() => status.hidden = true, 2000);
+        })
+        .catch(err => console.log("could not copy the magnet link", err));
+}
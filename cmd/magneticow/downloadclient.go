@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// downloadClient is a BitTorrent client that the magnet links can be sent to, so that the users
+// can start downloading a torrent with a single click.
+type downloadClient interface {
+	// Name is the name of the client, as displayed to the users.
+	Name() string
+	AddMagnet(magnet string) error
+}
+
+var downloadClientSpecRE = regexp.MustCompile(`^([a-z](?:_?[a-z0-9])*)=(.+)$`)
+
+// parseDownloadClientSpec parses a --download-client flag of the form [<USERNAME>=]<URL>, where the
+// URL is of the form <CLIENT>[+https]://[<USERNAME>:<PASSWORD>@]<HOST>:<PORT> and CLIENT is
+// either qbittorrent, transmission, or deluge. The username is empty for the instance-wide client.
+func parseDownloadClientSpec(spec string) (string, downloadClient, error) {
+	var username string
+	if match := downloadClientSpecRE.FindStringSubmatch(spec); match != nil {
+		username, spec = match[1], match[2]
+	}
+
+	client, err := makeDownloadClient(spec)
+	return username, client, err
+}
+
+func makeDownloadClient(rawURL string) (downloadClient, error) {
+	url_, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "url.Parse")
+	}
+
+	scheme := "http"
+	kind := url_.Scheme
+	if i := strings.IndexByte(url_.Scheme, '+'); i != -1 {
+		kind, scheme = url_.Scheme[:i], url_.Scheme[i+1:]
+		if scheme != "http" && scheme != "https" {
+			return nil, fmt.Errorf("unknown transport `%s` (expected http or https)", scheme)
+		}
+	}
+	if url_.Host == "" {
+		return nil, fmt.Errorf("host of the download client is missing")
+	}
+
+	base := url.URL{Scheme: scheme, Host: url_.Host, Path: strings.TrimSuffix(url_.Path, "/")}
+	username := url_.User.Username()
+	password, _ := url_.User.Password()
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	switch kind {
+	case "qbittorrent":
+		httpClient.Jar, _ = cookiejar.New(nil)
+		return &qBittorrentClient{base: base.String(), username: username, password: password, http: httpClient}, nil
+
+	case "transmission":
+		return &transmissionClient{base: base.String(), username: username, password: password, http: httpClient}, nil
+
+	case "deluge":
+		httpClient.Jar, _ = cookiejar.New(nil)
+		return &delugeClient{base: base.String(), password: password, http: httpClient}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown download client `%s` (expected qbittorrent, transmission, or deluge)", kind)
+	}
+}
+
+// downloadClientOf returns the download client of the user, or the instance-wide one if the user
+// does not have their own.
+func downloadClientOf(r *http.Request) downloadClient {
+	if username, _, ok := r.BasicAuth(); ok && opts.Credentials != nil {
+		if client, ok := opts.DownloadClients[username]; ok {
+			return client
+		}
+	}
+	return opts.DownloadClients[""]
+}
+
+// qBittorrentClient uses the Web API (v2) of qBittorrent.
+type qBittorrentClient struct {
+	base               string
+	username, password string
+	http               *http.Client
+}
+
+func (c *qBittorrentClient) Name() string { return "qBittorrent" }
+
+func (c *qBittorrentClient) AddMagnet(magnet string) error {
+	status, err := c.post("/api/v2/torrents/add", url.Values{"urls": {magnet}})
+	if err != nil {
+		return err
+	}
+	if status == http.StatusForbidden { // not logged in (yet), or the session has expired
+		if err = c.login(); err != nil {
+			return err
+		}
+		if status, err = c.post("/api/v2/torrents/add", url.Values{"urls": {magnet}}); err != nil {
+			return err
+		}
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("qBittorrent responded with %d", status)
+	}
+	return nil
+}
+
+func (c *qBittorrentClient) login() error {
+	status, err := c.post("/api/v2/auth/login", url.Values{"username": {c.username}, "password": {c.password}})
+	if err != nil {
+		return errors.Wrap(err, "login")
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("could not log in to qBittorrent (%d)", status)
+	}
+	return nil
+}
+
+func (c *qBittorrentClient) post(path string, form url.Values) (int, error) {
+	req, err := http.NewRequest("POST", c.base+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// qBittorrent rejects the requests whose Referer/Origin does not match its host (as a CSRF
+	// protection).
+	req.Header.Set("Referer", c.base)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Even though it responds with 200, qBittorrent signals a failed login using the body.
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	if res.StatusCode == http.StatusOK && bytes.Equal(bytes.TrimSpace(body), []byte("Fails.")) {
+		return http.StatusForbidden, nil
+	}
+	return res.StatusCode, nil
+}
+
+// transmissionClient uses the RPC of Transmission.
+type transmissionClient struct {
+	base               string
+	username, password string
+	http               *http.Client
+
+	sessionIDMutex sync.Mutex
+	sessionID      string
+}
+
+func (c *transmissionClient) Name() string { return "Transmission" }
+
+func (c *transmissionClient) AddMagnet(magnet string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"method":    "torrent-add",
+		"arguments": map[string]interface{}{"filename": magnet},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Transmission responds with 409 along with a (new) session ID to the requests without a (valid)
+	// session ID (as a CSRF protection), in which case the request is retried once with it.
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequest("POST", c.base+"/transmission/rpc", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if c.username != "" {
+			req.SetBasicAuth(c.username, c.password)
+		}
+		c.sessionIDMutex.Lock()
+		req.Header.Set("X-Transmission-Session-Id", c.sessionID)
+		c.sessionIDMutex.Unlock()
+
+		res, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if res.StatusCode == http.StatusConflict {
+			res.Body.Close()
+			c.sessionIDMutex.Lock()
+			c.sessionID = res.Header.Get("X-Transmission-Session-Id")
+			c.sessionIDMutex.Unlock()
+			continue
+		}
+
+		var response struct {
+			Result string `json:"result"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&response)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("Transmission responded with %d", res.StatusCode)
+		} else if err != nil {
+			return errors.Wrap(err, "decode")
+		} else if response.Result != "success" {
+			return fmt.Errorf("Transmission responded with `%s`", response.Result)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("could not get a session ID from Transmission")
+}
+
+// delugeClient uses the JSON-RPC of the web UI of Deluge, which must be connected to a daemon.
+type delugeClient struct {
+	base     string
+	password string
+	http     *http.Client
+
+	requestID uint64
+	mutex     sync.Mutex
+}
+
+func (c *delugeClient) Name() string { return "Deluge" }
+
+func (c *delugeClient) AddMagnet(magnet string) error {
+	_, err := c.call("core.add_torrent_magnet", magnet, map[string]interface{}{})
+	if err == errDelugeNotAuthenticated {
+		var loggedIn bool
+		result, err := c.call("auth.login", c.password)
+		if err != nil {
+			return errors.Wrap(err, "login")
+		}
+		if err = json.Unmarshal(result, &loggedIn); err != nil || !loggedIn {
+			return fmt.Errorf("could not log in to Deluge")
+		}
+		_, err = c.call("core.add_torrent_magnet", magnet, map[string]interface{}{})
+		return err
+	}
+	return err
+}
+
+var errDelugeNotAuthenticated = errors.New("not authenticated")
+
+func (c *delugeClient) call(method string, params ...interface{}) (json.RawMessage, error) {
+	c.mutex.Lock()
+	c.requestID++
+	id := c.requestID
+	c.mutex.Unlock()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"method": method,
+		"params": params,
+		"id":     id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.http.Post(c.base+"/json", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Deluge responded with %d", res.StatusCode)
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "decode")
+	}
+	if response.Error != nil {
+		if response.Error.Code == 1 { // https://github.com/deluge-torrent/deluge/blob/develop/deluge/ui/web/json_api.py
+			return nil, errDelugeNotAuthenticated
+		}
+		return nil, fmt.Errorf("Deluge responded with `%s`", response.Error.Message)
+	}
+	return response.Result, nil
+}
+
+// apiDownloadClient responds with the name of the download client of the user, if any, so that
+// the web interface can offer sending the torrents to it.
+func apiDownloadClient(w http.ResponseWriter, r *http.Request) {
+	client := downloadClientOf(r)
+	if client == nil {
+		respondError(w, 404, "no download client is configured")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(struct {
+		Name string `json:"name"`
+	}{client.Name()}); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// apiSendToDownloadClient sends the torrent to the download client of the user, which starts
+// downloading it; hence the cross-site requests are rejected (see isSameOrigin), lest any web page
+// can start downloads on the client using the cached credentials of the user (or without any, with
+// --no-auth).
+func apiSendToDownloadClient(w http.ResponseWriter, r *http.Request) {
+	if !isSameOrigin(r) {
+		respondError(w, 403, "cross-site requests are forbidden")
+		return
+	}
+
+	client := downloadClientOf(r)
+	if client == nil {
+		respondError(w, 404, "no download client is configured")
+		return
+	}
+
+	infohash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	torrent, err := database.GetTorrent(infohash)
+	if err != nil {
+		respondError(w, 500, "couldn't get torrent: %s", err.Error())
+		return
+	} else if torrent == nil {
+		respondError(w, 404, "not found")
+		return
+	}
+
+	if err = client.AddMagnet(magnetLink(hex.EncodeToString(torrent.InfoHash), torrent.Name)); err != nil {
+		zap.L().Warn("Could not send the torrent to the download client",
+			zap.String("client", client.Name()), zap.Error(err))
+		respondError(w, 502, "couldn't send the torrent to %s: %s", client.Name(), err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isSameOrigin returns false if the request is made by a web page of another site, as told by its
+// Sec-Fetch-Site, Origin, or Referer headers (in the order of preference). The requests without any
+// of them are not made by a (modern) browser, hence are not cross-site requests.
+func isSameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
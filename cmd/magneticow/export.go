@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// exportPageSize is the number of the torrents queried from the database at once whilst exporting.
+const exportPageSize = 500
+
+type exportedMagnet struct {
+	InfoHash string `json:"infoHash"`
+	Name     string `json:"name"`
+	Magnet   string `json:"magnet"`
+}
+
+// apiExport responds with the magnet links of all the torrents that match the query (up to
+// opts.MaxScanDepth, lest a single export scans the whole database), either as a plain-text file with one link per line or as JSON, to be
+// downloaded and added to a BitTorrent client at once.
+func apiExport(w http.ResponseWriter, r *http.Request) {
+	var eq struct {
+		Epoch          *int64   `schema:"epoch"`
+		Query          *string  `schema:"query"`
+		OrderBy        *string  `schema:"orderBy"`
+		Ascending      *bool    `schema:"ascending"`
+		Limit          *uint    `schema:"limit"`
+		MaxSpamScore   *float64 `schema:"maxSpamScore"`
+		IncludeFlagged *bool    `schema:"includeFlagged"`
+		OnlyVerified   *bool    `schema:"onlyVerified"`
+		Since          *int64   `schema:"since"`
+		Until          *int64   `schema:"until"`
+		Refine         []string `schema:"refine"`
+		Path           *string  `schema:"path"`
+		Resolution     *string  `schema:"resolution"`
+		Codec          *string  `schema:"codec"`
+		Group          *string  `schema:"group"`
+		Year           *int     `schema:"year"`
+		Season         *int     `schema:"season"`
+		Episode        *int     `schema:"episode"`
+		Artist         *string  `schema:"artist"`
+		Album          *string  `schema:"album"`
+		Format         *string  `schema:"format"`
+	}
+	if err := decoder.Decode(&eq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return
+	}
+
+	if eq.Query == nil {
+		eq.Query = new(string)
+	}
+
+	if eq.Epoch == nil {
+		eq.Epoch = new(int64)
+		*eq.Epoch = time.Now().Unix()
+	} else if *eq.Epoch <= 0 {
+		respondError(w, 400, "epoch must be greater than 0")
+		return
+	}
+
+	if eq.Ascending == nil {
+		eq.Ascending = new(bool)
+		*eq.Ascending = *eq.Query != "" // most relevant or most recent first
+	}
+
+	var orderBy persistence.OrderingCriteria
+	if eq.OrderBy == nil {
+		if *eq.Query == "" {
+			orderBy = persistence.ByDiscoveredOn
+		} else {
+			orderBy = persistence.ByRelevance
+		}
+	} else {
+		var err error
+		orderBy, err = parseOrderBy(*eq.OrderBy)
+		if err != nil {
+			respondError(w, 400, err.Error())
+			return
+		}
+	}
+
+	if eq.Limit == nil {
+		eq.Limit = new(uint)
+		*eq.Limit = opts.MaxScanDepth
+	} else if *eq.Limit == 0 || *eq.Limit > opts.MaxScanDepth {
+		respondError(w, 400, "limit must be in range [1, %d]", opts.MaxScanDepth)
+		return
+	}
+
+	if eq.Format == nil {
+		eq.Format = new(string)
+		*eq.Format = "text"
+	} else if *eq.Format != "text" && *eq.Format != "json" {
+		respondError(w, 400, "format must be either `text` or `json`")
+		return
+	}
+
+	if eq.MaxSpamScore != nil && (*eq.MaxSpamScore < 0 || *eq.MaxSpamScore > 1) {
+		respondError(w, 400, "maxSpamScore must be in range [0, 1]")
+		return
+	}
+	if eq.Since != nil && eq.Until != nil && *eq.Since >= *eq.Until {
+		respondError(w, 400, "since must be less than until")
+		return
+	}
+	if len(eq.Refine) > maxRefinements {
+		respondError(w, 400, "refine must not be supplied more than %d times", maxRefinements)
+		return
+	}
+	filters := persistence.QueryFilters{
+		MaxSpamScore:    eq.MaxSpamScore,
+		IncludeFlagged:  eq.IncludeFlagged != nil && *eq.IncludeFlagged,
+		OnlyVerified:    eq.OnlyVerified != nil && *eq.OnlyVerified,
+		DiscoveredSince: eq.Since,
+		DiscoveredUntil: eq.Until,
+		Refinements:     eq.Refine,
+		Year:            eq.Year,
+		Season:          eq.Season,
+		Episode:         eq.Episode,
+	}
+	if eq.Path != nil {
+		filters.PathContains = *eq.Path
+	}
+	if eq.Resolution != nil {
+		filters.Resolution = *eq.Resolution
+	}
+	if eq.Codec != nil {
+		filters.Codec = *eq.Codec
+	}
+	if eq.Group != nil {
+		filters.ReleaseGroup = *eq.Group
+	}
+	if eq.Artist != nil {
+		filters.Artist = *eq.Artist
+	}
+	if eq.Album != nil {
+		filters.Album = *eq.Album
+	}
+
+	// Page through the results using the keyset cursor, as the web interface does.
+	magnets := make([]exportedMagnet, 0)
+	var lastOrderedValue *float64
+	var lastID *uint64
+	for uint(len(magnets)) < *eq.Limit {
+		pageSize := *eq.Limit - uint(len(magnets))
+		if pageSize > exportPageSize {
+			pageSize = exportPageSize
+		}
+
+		torrents, err := database.QueryTorrents(*eq.Query, *eq.Epoch, orderBy, *eq.Ascending,
+			pageSize, lastOrderedValue, lastID, filters, 0)
+		if err != nil {
+			respondQueryError(w, err)
+			return
+		}
+
+		for _, t := range torrents {
+			infoHash := hex.EncodeToString(t.InfoHash)
+			magnets = append(magnets, exportedMagnet{
+				InfoHash: infoHash,
+				Name:     t.Name,
+				Magnet:   magnetLink(infoHash, t.Name),
+			})
+		}
+
+		if uint(len(torrents)) < pageSize {
+			break
+		}
+		last := torrents[len(torrents)-1]
+		lastOrderedValue, lastID = new(float64), new(uint64)
+		*lastOrderedValue, *lastID = orderedValue(last, orderBy), last.ID
+	}
+
+	countRows(r, len(magnets))
+
+	if *eq.Format == "json" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="magnets.json"`)
+		if err := json.NewEncoder(w).Encode(magnets); err != nil {
+			zap.L().Warn("JSON encode error", zap.Error(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="magnets.txt"`)
+	for _, m := range magnets {
+		if _, err := fmt.Fprintln(w, m.Magnet); err != nil {
+			zap.L().Warn("Could not write the magnet links", zap.Error(err))
+			return
+		}
+	}
+}
+
+func magnetLink(infoHashHex string, name string) string {
+	return "magnet:?xt=urn:btih:" + infoHashHex + "&dn=" + url.QueryEscape(name)
+}
+
+// orderedValue returns the value of the torrent that it is ordered by, to be supplied as the
+// lastOrderedValue of the next page.
+func orderedValue(t persistence.TorrentMetadata, orderBy persistence.OrderingCriteria) float64 {
+	switch orderBy {
+	case persistence.ByRelevance:
+		return t.Relevance
+	case persistence.ByTotalSize:
+		return float64(t.Size)
+	case persistence.ByNFiles:
+		return float64(t.NFiles)
+	case persistence.BySpamScore:
+		return t.SpamScore
+	case persistence.ByPopularity:
+		return float64(t.Popularity)
+	default:
+		return float64(t.DiscoveredOn.Unix())
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+var magnetLinkTest_instances = []struct {
+	infoHash string
+	name     string
+	magnet   string
+}{
+	{"0123456789abcdef0123456789abcdef01234567", "ubuntu",
+		"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=ubuntu"},
+	{"0123456789abcdef0123456789abcdef01234567", "Tom & Jerry [1940]",
+		"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=Tom+%26+Jerry+%5B1940%5D"},
+}
+
+func TestMagnetLink(t *testing.T) {
+	for i, instance := range magnetLinkTest_instances {
+		if magnet := magnetLink(instance.infoHash, instance.name); magnet != instance.magnet {
+			t.Errorf("Magnet link of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, magnet,
+				instance.magnet)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// The favorites are kept for each user, by the username of the request; hence they are not served
+// at all with --no-auth (see main), as every request has the empty username then.
+
+func favoritesHandler(w http.ResponseWriter, r *http.Request) {
+	data := mustPage("templates/favorites.html")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Cache static resources for a day
+	w.Header().Set("Cache-Control", "max-age=86400")
+	_, _ = w.Write(data)
+}
+
+// apiFavorites responds with the favorites of the user, the most recently favorited first.
+func apiFavorites(w http.ResponseWriter, r *http.Request) {
+	favorites, ok := getFavorites(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(favorites); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// apiExportFavorites responds with the magnet links of the favorites of the user, in the same
+// formats as apiExport.
+func apiExportFavorites(w http.ResponseWriter, r *http.Request) {
+	favorites, ok := getFavorites(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "text"
+	} else if format != "text" && format != "json" {
+		respondError(w, 400, "format must be either `text` or `json`")
+		return
+	}
+
+	magnets := make([]exportedMagnet, len(favorites))
+	for i, favorite := range favorites {
+		infoHash := hex.EncodeToString(favorite.Torrent.InfoHash)
+		magnets[i] = exportedMagnet{
+			InfoHash: infoHash,
+			Name:     favorite.Torrent.Name,
+			Magnet:   magnetLink(infoHash, favorite.Torrent.Name),
+		}
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="favorites.json"`)
+		if err := json.NewEncoder(w).Encode(magnets); err != nil {
+			zap.L().Warn("JSON encode error", zap.Error(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="favorites.txt"`)
+	for _, m := range magnets {
+		if _, err := fmt.Fprintln(w, m.Magnet); err != nil {
+			zap.L().Warn("Could not write the magnet links", zap.Error(err))
+			return
+		}
+	}
+}
+
+// getFavorites gets the favorites of the user of the request, up to the limit in the URL, and
+// responds with the error (returning false) if it cannot.
+func getFavorites(w http.ResponseWriter, r *http.Request) ([]persistence.Favorite, bool) {
+	var fq struct {
+		Limit  *uint   `schema:"limit"`
+		Format *string `schema:"format"` // see apiExportFavorites
+	}
+	if err := decoder.Decode(&fq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return nil, false
+	}
+	if fq.Limit == nil {
+		fq.Limit = new(uint)
+		*fq.Limit = persistence.MaxFavorites
+	} else if *fq.Limit == 0 || *fq.Limit > persistence.MaxFavorites {
+		respondError(w, 400, "limit must be in range [1, %d]", persistence.MaxFavorites)
+		return nil, false
+	}
+
+	username, _, _ := r.BasicAuth()
+	favorites, err := database.GetFavorites(username, *fq.Limit)
+	if err != nil {
+		respondError(w, 500, "couldn't get favorites: %s", err.Error())
+		return nil, false
+	}
+	return favorites, true
+}
+
+// apiFavorite responds whether the torrent is a favorite of the user, as {"favorite": bool}.
+func apiFavorite(w http.ResponseWriter, r *http.Request) {
+	infohash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	username, _, _ := r.BasicAuth()
+	favorite, err := database.IsFavorite(username, infohash)
+	if err != nil {
+		respondError(w, 500, "couldn't check favorite: %s", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(struct {
+		Favorite bool `json:"favorite"`
+	}{favorite}); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// apiAddFavorite adds the torrent to the favorites of the user; adding a favorite again is a no-op.
+func apiAddFavorite(w http.ResponseWriter, r *http.Request) {
+	infohash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	username, _, _ := r.BasicAuth()
+	if ok, err := database.AddFavorite(username, infohash); err != nil {
+		respondError(w, 500, "couldn't add favorite: %s", err.Error())
+		return
+	} else if !ok {
+		if exists, err := database.DoesTorrentExist(infohash); err != nil {
+			respondError(w, 500, "couldn't check torrent: %s", err.Error())
+		} else if !exists {
+			respondError(w, 404, "not found")
+		} else {
+			respondError(w, 409, "cannot have more than %d favorites", persistence.MaxFavorites)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiRemoveFavorite(w http.ResponseWriter, r *http.Request) {
+	infohash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	username, _, _ := r.BasicAuth()
+	if ok, err := database.RemoveFavorite(username, infohash); err != nil {
+		respondError(w, 500, "couldn't remove favorite: %s", err.Error())
+		return
+	} else if !ok {
+		respondError(w, 404, "not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,16 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 
 	"github.com/boramalper/magnetico/pkg/persistence"
 )
 
 // DONE
+// homepageRecentTorrents and homepageTrendingTorrents are the numbers of the most recently
+// discovered and of the trending torrents listed on the homepage.
+const (
+	homepageRecentTorrents   = 10
+	homepageTrendingTorrents = 10
+)
+
 func rootHandler(w http.ResponseWriter, r *http.Request) {
 	nTorrents, err := database.GetNumberOfTorrents()
 	if err != nil {
@@ -18,35 +30,75 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_ = templates["homepage"].Execute(w, struct {
+	recent, err := database.GetRecentTorrents(homepageRecentTorrents)
+	if err != nil {
+		handlerError(errors.Wrap(err, "GetRecentTorrents"), w)
+		return
+	}
+
+	trending, err := database.GetTrendingTorrents(homepageTrendingTorrents)
+	if err != nil {
+		handlerError(errors.Wrap(err, "GetTrendingTorrents"), w)
+		return
+	}
+
+	_ = getTemplate("homepage").Execute(w, struct {
 		NTorrents uint
+		Recent    []persistence.TorrentMetadata
+		Trending  []persistence.TorrentMetadata
+		Favorites bool // whether the favorites are served, see main
 	}{
 		NTorrents: nTorrents,
+		Recent:    recent,
+		Trending:  trending,
+		Favorites: opts.Credentials != nil,
 	})
 }
 
 func torrentsHandler(w http.ResponseWriter, r *http.Request) {
-	data := mustAsset("templates/torrents.html")
+	data := mustPage("templates/torrents.html")
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	// Cache static resources for a day
 	w.Header().Set("Cache-Control", "max-age=86400")
 	_, _ = w.Write(data)
 }
 
-func torrentsInfohashHandler(w http.ResponseWriter, r *http.Request) {
-	data := mustAsset("templates/torrent.html")
+func statisticsHandler(w http.ResponseWriter, r *http.Request) {
+	data := mustPage("templates/statistics.html")
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	// Cache static resources for a day
 	w.Header().Set("Cache-Control", "max-age=86400")
 	_, _ = w.Write(data)
 }
 
-func statisticsHandler(w http.ResponseWriter, r *http.Request) {
-	data := mustAsset("templates/statistics.html")
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	// Cache static resources for a day
-	w.Header().Set("Cache-Control", "max-age=86400")
-	_, _ = w.Write(data)
+// customCSSHandler serves the stylesheet of the operator, which is read on every request so that it
+// can be changed without restarting magneticow. An empty stylesheet is served if there is none.
+func customCSSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	if opts.CustomCSSPath == "" {
+		// Cache static resources for a day
+		w.Header().Set("Cache-Control", "max-age=86400")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(w, r, opts.CustomCSSPath)
+}
+
+// serviceWorkerHandler serves the service worker at the root (instead of under /static/), for the
+// scope of a service worker is limited to the path it is served from.
+func serviceWorkerHandler(w http.ResponseWriter, r *http.Request) {
+	// The service worker would serve the stale (cached) static resources in the development mode.
+	if opts.DevDir != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	// Browsers check for the updates of the service worker regardless, but never cache it for long
+	// lest the stale shell is served for long after an upgrade.
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(mustAsset("static/scripts/sw.js"))
 }
 
 func feedHandler(w http.ResponseWriter, r *http.Request) {
@@ -75,6 +127,9 @@ func feedHandler(w http.ResponseWriter, r *http.Request) {
 		20,
 		nil,
 		nil,
+		persistence.QueryFilters{},
+		// Only the names (and the infohashes) are in the feed.
+		0,
 	)
 	if err != nil {
 		handlerError(errors.Wrap(err, "query torrent"), w)
@@ -88,7 +143,7 @@ func feedHandler(w http.ResponseWriter, r *http.Request) {
 	//
 	// TODO: maybe do it properly, even if it's inconvenient?
 	_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8" standalone="yes"?>`))
-	_ = templates["feed"].Execute(w, struct {
+	_ = getTemplate("feed").Execute(w, struct {
 		Title    string
 		Torrents []persistence.TorrentMetadata
 	}{
@@ -97,6 +152,31 @@ func feedHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// opensearchHandler serves the OpenSearch description document so that the users can add
+// magneticow as a search engine to their browsers.
+func opensearchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml; charset=utf-8")
+	// See feedHandler for why the XML declaration is written manually.
+	_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>`))
+	if err := getTemplate("opensearch").Execute(w, struct {
+		BaseURL string
+	}{
+		BaseURL: baseURL(r),
+	}); err != nil {
+		zap.L().Warn("Could not execute the OpenSearch template", zap.Error(err))
+	}
+}
+
+// baseURL returns the absolute URL that magneticow is served at (including the base path), as seen
+// by the client (possibly through a reverse proxy).
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + opts.BasePath
+}
+
 func staticHandler(w http.ResponseWriter, r *http.Request) {
 	data, err := Asset(r.URL.Path[1:])
 	if err != nil {
@@ -109,11 +189,42 @@ func staticHandler(w http.ResponseWriter, r *http.Request) {
 		contentType = "text/css; charset=utf-8"
 	} else if strings.HasSuffix(r.URL.Path, ".js") {
 		contentType = "text/javascript; charset=utf-8"
+	} else if strings.HasSuffix(r.URL.Path, ".webmanifest") {
+		contentType = "application/manifest+json; charset=utf-8"
 	} else { // fallback option
 		contentType = http.DetectContentType(data)
 	}
 	w.Header().Set("Content-Type", contentType)
 	// Cache static resources for a day
 	w.Header().Set("Cache-Control", "max-age=86400")
-	_, _ = w.Write(data)
+	w.Header().Set("ETag", assetETag(r.URL.Path[1:], data))
+
+	// Serve the brotli-compressed version of the asset, if it is bundled (see Makefile); brotli
+	// compresses better than gzip but it is too slow to compress on the fly.
+	if acceptsEncoding(r, "br") {
+		if compressed, err := Asset(r.URL.Path[1:] + ".br"); err == nil {
+			w.Header().Set("Content-Encoding", "br")
+			w.Header().Set("ETag", `W/`+w.Header().Get("ETag"))
+			data = compressed
+		}
+	}
+
+	http.ServeContent(w, r, r.URL.Path, assetModTime(r.URL.Path[1:]), bytes.NewReader(data))
+}
+
+var assetETags sync.Map
+
+// assetETag returns the ETag of the asset, which is computed once per asset (unless in the
+// development mode, where the assets might change).
+func assetETag(name string, data []byte) string {
+	if etag, ok := assetETags.Load(name); ok {
+		return etag.(string)
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if opts.DevDir == "" {
+		assetETags.Store(name, etag)
+	}
+	return etag
 }
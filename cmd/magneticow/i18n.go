@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+)
+
+// languageCookie is the name of the cookie that overrides the language negotiated from the
+// Accept-Language header.
+const languageCookie = "lang"
+
+// supportedLanguages are the languages with a message catalog at data/i18n/<language>.json; the
+// first one is the fallback for both the unsupported languages and the missing messages.
+var supportedLanguages = []language.Tag{
+	language.English,
+	language.German,
+	language.French,
+	language.Russian,
+	language.Chinese,
+	language.Spanish,
+}
+
+var languageMatcher = language.NewMatcher(supportedLanguages)
+
+// catalogs maps the (base) languages to their messages, by their keys.
+var catalogs map[string]map[string]string
+
+func loadCatalogs() error {
+	catalogs = make(map[string]map[string]string)
+	for _, tag := range supportedLanguages {
+		base, _ := tag.Base()
+
+		var messages map[string]string
+		if err := json.Unmarshal(mustAsset("i18n/"+base.String()+".json"), &messages); err != nil {
+			return errors.Wrapf(err, "message catalog of %s", base.String())
+		}
+		catalogs[base.String()] = messages
+	}
+	return nil
+}
+
+// negotiateLanguage returns the (base) language that the messages should be in, for the client
+// that made the request.
+func negotiateLanguage(r *http.Request) string {
+	var preferences []language.Tag
+	if cookie, err := r.Cookie(languageCookie); err == nil {
+		if tag, err := language.Parse(cookie.Value); err == nil {
+			preferences = append(preferences, tag)
+		}
+	}
+	if tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language")); err == nil {
+		preferences = append(preferences, tags...)
+	}
+
+	_, index, _ := languageMatcher.Match(preferences...)
+	base, _ := supportedLanguages[index].Base()
+	return base.String()
+}
+
+// messagesOf returns the messages of the language, with the missing ones taken from the fallback
+// language.
+func messagesOf(lang string) map[string]string {
+	fallback, _ := supportedLanguages[0].Base()
+
+	messages := make(map[string]string, len(catalogs[fallback.String()]))
+	for key, message := range catalogs[fallback.String()] {
+		messages[key] = message
+	}
+	for key, message := range catalogs[lang] {
+		messages[key] = message
+	}
+	return messages
+}
+
+func apiI18n(w http.ResponseWriter, r *http.Request) {
+	lang := negotiateLanguage(r)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Vary", "Accept-Language, Cookie")
+	if err := json.NewEncoder(w).Encode(struct {
+		Language string            `json:"language"`
+		Messages map[string]string `json:"messages"`
+	}{
+		Language: lang,
+		Messages: messagesOf(lang),
+	}); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
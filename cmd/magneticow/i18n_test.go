@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"path"
+	"testing"
+)
+
+var negotiateLanguageTest_instances = []struct {
+	acceptLanguage string
+	cookie         string
+	lang           string
+}{
+	{"", "", "en"},
+	{"de-DE,de;q=0.9,en;q=0.8", "", "de"},
+	{"pt-BR,pt;q=0.9", "", "en"}, // unsupported
+	{"ja,zh-CN;q=0.8", "", "zh"},
+	{"fr-CH, fr;q=0.9, en;q=0.8", "ru", "ru"}, // cookie overrides
+	{"es", "invalid!", "es"},
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+	for i, instance := range negotiateLanguageTest_instances {
+		r := httptest.NewRequest("GET", "/api/v0.1/i18n", nil)
+		if instance.acceptLanguage != "" {
+			r.Header.Set("Accept-Language", instance.acceptLanguage)
+		}
+		if instance.cookie != "" {
+			r.Header.Set("Cookie", languageCookie+"="+instance.cookie)
+		}
+
+		if lang := negotiateLanguage(r); lang != instance.lang {
+			t.Errorf("Language of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, lang,
+				instance.lang)
+		}
+	}
+}
+
+// TestCatalogsComplete tests that every catalog has every message of the fallback catalog, and
+// nothing else.
+func TestCatalogsComplete(t *testing.T) {
+	read := func(lang string) map[string]string {
+		data, err := ioutil.ReadFile(path.Join("data", "i18n", lang+".json"))
+		if err != nil {
+			t.Fatalf("could not read the catalog of %s: %s", lang, err.Error())
+		}
+		var messages map[string]string
+		if err = json.Unmarshal(data, &messages); err != nil {
+			t.Fatalf("could not parse the catalog of %s: %s", lang, err.Error())
+		}
+		return messages
+	}
+
+	fallback := read("en")
+	for _, tag := range supportedLanguages[1:] {
+		base, _ := tag.Base()
+		messages := read(base.String())
+
+		for key := range fallback {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("catalog of %s is missing `%s`", base.String(), key)
+			}
+		}
+		for key := range messages {
+			if _, ok := fallback[key]; !ok {
+				t.Errorf("catalog of %s has the unknown `%s`", base.String(), key)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dustin/go-humanize"
+	"go.uber.org/zap"
+)
+
+// startedOn is when magneticow is started, for its uptime.
+var startedOn = time.Now()
+
+// instanceStatsTTL is how long the instance statistics are cached for, since the endpoints are
+// public and the badges might be embedded in busy sites.
+const instanceStatsTTL = time.Minute
+
+type instanceStats struct {
+	NTorrents uint   `json:"nTorrents"`
+	TotalSize uint64 `json:"totalSize"`
+	// Uptime is in seconds.
+	Uptime int64 `json:"uptime"`
+	// DiscoveryRate is the number of the torrents discovered in the past hour.
+	DiscoveryRate uint64 `json:"discoveryRate"`
+	// DatabaseSize is in bytes, and so is DatabaseGrowth (a day). DiskFullOn is when the disk of
+	// the database is projected to be full (in Unix time), if known.
+	DatabaseSize   uint64  `json:"databaseSize"`
+	DatabaseGrowth float64 `json:"databaseGrowth"`
+	DiskFullOn     int64   `json:"diskFullOn,omitempty"`
+	// Version is empty unless the operator opts in.
+	Version string `json:"version,omitempty"`
+}
+
+var instanceStatsCache struct {
+	sync.Mutex
+	stats     instanceStats
+	updatedOn time.Time
+}
+
+func getInstanceStats() (instanceStats, error) {
+	instanceStatsCache.Lock()
+	defer instanceStatsCache.Unlock()
+
+	if time.Since(instanceStatsCache.updatedOn) < instanceStatsTTL {
+		stats := instanceStatsCache.stats
+		stats.Uptime = int64(time.Since(startedOn).Seconds())
+		return stats, nil
+	}
+
+	var stats instanceStats
+	var err error
+	if stats.NTorrents, err = database.GetNumberOfTorrents(); err != nil {
+		return stats, err
+	}
+	if stats.TotalSize, err = database.GetTotalSize(); err != nil {
+		return stats, err
+	}
+	if stats.DiscoveryRate, err = database.GetNumberOfDiscoveredTorrents(time.Now().Add(-time.Hour).Unix()); err != nil {
+		return stats, err
+	}
+	storage, err := database.GetStorageReport()
+	if err != nil {
+		return stats, err
+	}
+	stats.DatabaseSize, stats.DatabaseGrowth, stats.DiskFullOn = storage.TotalBytes, storage.BytesPerDay, storage.FullOn
+	if opts.InstanceStatsVersion {
+		stats.Version = compiledOn
+	}
+
+	instanceStatsCache.stats, instanceStatsCache.updatedOn = stats, time.Now()
+	stats.Uptime = int64(time.Since(startedOn).Seconds())
+	return stats, nil
+}
+
+func apiInstance(w http.ResponseWriter, r *http.Request) {
+	stats, err := getInstanceStats()
+	if err != nil {
+		respondError(w, 500, "couldn't get instance statistics: %s", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	// So that the statistics can be fetched by the sites of the operators too.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(instanceStatsTTL.Seconds())))
+	if err = json.NewEncoder(w).Encode(stats); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
+
+// apiInstanceBadge responds with a shields.io-style SVG badge of one of the instance statistics,
+// to be embedded in the sites of the operators.
+func apiInstanceBadge(w http.ResponseWriter, r *http.Request) {
+	var bq struct {
+		Metric *string `schema:"metric"`
+		Label  *string `schema:"label"`
+	}
+	if err := decoder.Decode(&bq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return
+	}
+
+	if bq.Metric == nil {
+		bq.Metric = new(string)
+		*bq.Metric = "torrents"
+	}
+	if bq.Label == nil {
+		bq.Label = new(string)
+		*bq.Label = "magnetico"
+	} else if utf8.RuneCountInString(*bq.Label) > 32 {
+		respondError(w, 400, "label must be at most 32 characters long")
+		return
+	}
+
+	stats, err := getInstanceStats()
+	if err != nil {
+		respondError(w, 500, "couldn't get instance statistics: %s", err.Error())
+		return
+	}
+
+	var value string
+	switch *bq.Metric {
+	case "torrents":
+		value = humanize.Comma(int64(stats.NTorrents)) + " torrents"
+	case "size":
+		value = humanize.IBytes(stats.TotalSize)
+	case "rate":
+		value = humanize.Comma(int64(stats.DiscoveryRate)) + "/hour"
+	case "uptime":
+		value = humanizeDuration(time.Duration(stats.Uptime) * time.Second)
+	default:
+		respondError(w, 400, "metric must be one of `torrents`, `size`, `rate`, or `uptime`")
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(instanceStatsTTL.Seconds())))
+	_, _ = w.Write([]byte(badge(*bq.Label, value)))
+}
+
+// badge returns the SVG of a badge with the label on the left and the value on the right.
+func badge(label, value string) string {
+	// The widths are estimated (as the fonts might differ) assuming 7 pixels per character.
+	labelWidth := 10 + 7*utf8.RuneCountInString(label)
+	valueWidth := 10 + 7*utf8.RuneCountInString(value)
+	width := labelWidth + valueWidth
+	label, value = html.EscapeString(label), html.EscapeString(value)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">`+
+		`<title>%[4]s: %[5]s</title>`+
+		`<rect width="%[2]d" height="20" fill="#555"/>`+
+		`<rect x="%[2]d" width="%[3]d" height="20" fill="#d32f2f"/>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%[6]d" y="14">%[4]s</text>`+
+		`<text x="%[7]d" y="14">%[5]s</text>`+
+		`</g></svg>`,
+		width, labelWidth, valueWidth, label, value, labelWidth/2, labelWidth+valueWidth/2)
+}
+
+// humanizeDuration returns the duration in its largest unit (days, hours, or minutes).
+func humanizeDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBadgeEscapes(t *testing.T) {
+	svg := badge(`<script>"`, "1,234 torrents")
+	if strings.Contains(svg, "<script>") {
+		t.Error("label is not escaped")
+	}
+	if !strings.Contains(svg, "1,234 torrents") {
+		t.Error("value is missing")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// The interactions of the users with the torrents (the clicks of the magnet links, and the
+// downloads of the .torrent files) are counted by the day, as the popularities of the torrents on
+// this instance, without recording who interacted; see persistence.Interaction.
+
+// maxInteractionsWindow is how far back the interactions with a torrent can be requested at once.
+const maxInteractionsWindow = 366 * 24 * time.Hour
+
+// apiTorrentFile responds with the .torrent file of the torrent, which is built out of its
+// metadata, and counts its download. The torrents whose metadata is not known (e.g. the imported
+// ones) are not found.
+func apiTorrentFile(w http.ResponseWriter, r *http.Request) {
+	infohash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	metadata, err := database.GetMetadata(infohash)
+	if err != nil {
+		respondError(w, 500, "couldn't get metadata: %s", err.Error())
+		return
+	}
+	// The metadata is the info dictionary of the torrent, whose hash is the infohash.
+	if sum := sha1.Sum(metadata); len(metadata) == 0 || !bytes.Equal(sum[:], infohash) {
+		respondError(w, 404, "not found")
+		return
+	}
+
+	countInteraction(infohash, persistence.InteractionDownload)
+
+	name := hex.EncodeToString(infohash)
+	if torrent, err := database.GetTorrent(infohash); err == nil && torrent != nil && slugify(torrent.Name) != "" {
+		name = slugify(torrent.Name)
+	}
+	w.Header().Set("Content-Type", "application/x-bittorrent")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.torrent"`, name))
+	w.Header().Set("Content-Length", strconv.Itoa(len("d4:info")+len(metadata)+len("e")))
+	_, _ = w.Write([]byte("d4:info"))
+	_, _ = w.Write(metadata)
+	_, _ = w.Write([]byte("e"))
+}
+
+// apiAddInteraction counts a click of the magnet link of the torrent, which is reported by the web
+// interface (e.g. using navigator.sendBeacon), as the browsers open the magnet links themselves.
+// The cross-site requests are rejected (see SameOrigin) lest other sites inflate the popularity.
+func apiAddInteraction(w http.ResponseWriter, r *http.Request) {
+	infohash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	if err = r.ParseForm(); err != nil {
+		respondError(w, 400, "error while parsing the form: %s", err.Error())
+		return
+	}
+	var iq struct {
+		Interaction string `schema:"interaction,required"`
+	}
+	if err = decoder.Decode(&iq, r.PostForm); err != nil {
+		respondError(w, 400, "error while parsing the form: %s", err.Error())
+		return
+	}
+	// The downloads are counted as the .torrent files are downloaded (see apiTorrentFile).
+	if interaction, err := persistence.ParseInteraction(iq.Interaction); err != nil ||
+		interaction != persistence.InteractionMagnet {
+		respondError(w, 400, "interaction must be `magnet`")
+		return
+	}
+
+	if !countInteraction(infohash, persistence.InteractionMagnet) {
+		respondError(w, 404, "not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// countInteraction counts the interaction with the torrent, and returns false if the torrent does
+// not exist. The errors are logged, lest the users are bothered by the counters.
+func countInteraction(infohash []byte, interaction persistence.Interaction) bool {
+	ok, err := database.AddInteraction(infohash, interaction, time.Now().Unix())
+	if err != nil {
+		zap.L().Warn("Could not count the interaction",
+			zap.String("infohash", hex.EncodeToString(infohash)),
+			zap.String("interaction", string(interaction)),
+			zap.Error(err))
+		return true
+	}
+	return ok
+}
+
+// apiInteractions responds with the daily numbers of the interactions with the torrent since
+// `from` (in Unix time, 30 days ago by default), the earliest first.
+func apiInteractions(w http.ResponseWriter, r *http.Request) {
+	infohash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	var iq struct {
+		From *int64 `schema:"from"`
+	}
+	if err = decoder.Decode(&iq, r.URL.Query()); err != nil {
+		respondError(w, 400, "error while parsing the URL: %s", err.Error())
+		return
+	}
+	now := time.Now()
+	if iq.From == nil {
+		iq.From = new(int64)
+		*iq.From = now.AddDate(0, 0, -30).Unix()
+	} else if *iq.From < now.Add(-maxInteractionsWindow).Unix() {
+		respondError(w, 400, "from must be at most %d days ago", int(maxInteractionsWindow.Hours()/24))
+		return
+	}
+
+	interactions, err := database.GetInteractions(infohash, *iq.From)
+	if err != nil {
+		respondError(w, 500, "couldn't get interactions: %s", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(interactions); err != nil {
+		zap.L().Warn("JSON encode error", zap.Error(err))
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/boramalper/magnetico/pkg/util"
+)
+
+// accessLog and auditLog are the loggers of the requests and of the actions of the operators
+// respectively, which are separate from the (diagnostic) log of magneticow so that they can be
+// processed by the tools of the operators; they discard everything unless enabled.
+var accessLog, auditLog = zap.NewNop(), zap.NewNop()
+
+// openLog returns a logger that writes JSON lines to the file (rotating it), or to stdout if the
+// path is "-".
+func openLog(path string, maxSize int64, maxBackups int) (*zap.Logger, error) {
+	var sink zapcore.WriteSyncer
+	if path == "-" {
+		sink = zapcore.Lock(os.Stdout)
+	} else {
+		file, err := util.OpenRotatingFile(path, maxSize, maxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sink = file
+	}
+
+	config := zap.NewProductionEncoderConfig()
+	config.TimeKey = "time"
+	config.EncodeTime = zapcore.ISO8601TimeEncoder
+	config.EncodeDuration = zapcore.MillisDurationEncoder
+	return zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(config), sink, zap.InfoLevel)), nil
+}
+
+// AccessLog logs every request to the access log, once it is responded.
+func AccessLog(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		handler.ServeHTTP(lw, r)
+
+		username, _, _ := r.BasicAuth()
+		accessLog.Info("request",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.String("query", r.URL.RawQuery),
+			zap.Int("status", lw.statusCode),
+			zap.Int64("bytes", lw.nBytes),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("user", username),
+		)
+	})
+}
+
+// audit logs an action of an operator to the audit log.
+func audit(r *http.Request, action string, fields ...zap.Field) {
+	username, _, _ := r.BasicAuth()
+	auditLog.Info(action, append([]zap.Field{zap.String("user", username)}, fields...)...)
+}
+
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	nBytes      int64
+	wroteHeader bool
+}
+
+func (lw *loggingResponseWriter) WriteHeader(statusCode int) {
+	if !lw.wroteHeader {
+		lw.wroteHeader = true
+		lw.statusCode = statusCode
+	}
+	lw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (lw *loggingResponseWriter) Write(data []byte) (int, error) {
+	lw.wroteHeader = true
+	n, err := lw.ResponseWriter.Write(data)
+	lw.nBytes += int64(n)
+	return n, err
+}
+
+func (lw *loggingResponseWriter) Flush() {
+	if flusher, ok := lw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
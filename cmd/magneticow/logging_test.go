@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	accessLog = zap.New(core)
+	defer func() { accessLog = zap.NewNop() }()
+
+	handler := AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondError(w, 404, "not found")
+	}))
+	r := httptest.NewRequest("GET", "/api/v0.1/torrents?query=ubuntu", nil)
+	r.SetBasicAuth("alice", "secret")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if logs.Len() != 1 {
+		t.Fatalf("Exactly one request should have been logged, got %d", logs.Len())
+	}
+	fields := logs.All()[0].ContextMap()
+	for key, expected := range map[string]interface{}{
+		"method": "GET",
+		"path":   "/api/v0.1/torrents",
+		"query":  "query=ubuntu",
+		"status": int64(404),
+		"bytes":  int64(len("not found")),
+		"user":   "alice",
+	} {
+		if fields[key] != expected {
+			t.Errorf("`%s` is wrong! Got %v (expected %v)", key, fields[key], expected)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// lookedUpInfoHash returns the infohash that the search query consists of, if it is a 40-character
+// hex or 32-character base32 infohash, or a magnet link (of which the first BitTorrent v1 infohash
+// is returned), so that the torrent is looked up directly instead of being searched for.
+func lookedUpInfoHash(query string) ([]byte, bool) {
+	query = strings.TrimSpace(query)
+
+	if strings.HasPrefix(strings.ToLower(query), "magnet:") {
+		magnet, err := url.Parse(query)
+		if err != nil {
+			return nil, false
+		}
+		for _, xt := range magnet.Query()["xt"] {
+			if len(xt) > len("urn:btih:") && strings.EqualFold(xt[:len("urn:btih:")], "urn:btih:") {
+				if infoHash, ok := decodeInfoHash(xt[len("urn:btih:"):]); ok {
+					return infoHash, true
+				}
+			}
+		}
+		return nil, false
+	}
+
+	return decodeInfoHash(query)
+}
+
+// decodeInfoHash decodes a 40-character hex or a 32-character base32 infohash (as in the magnet
+// links), case-insensitively.
+func decodeInfoHash(s string) ([]byte, bool) {
+	var infoHash []byte
+	var err error
+	switch len(s) {
+	case 40:
+		infoHash, err = hex.DecodeString(s)
+	case 32:
+		infoHash, err = base32.StdEncoding.DecodeString(strings.ToUpper(s))
+	default:
+		return nil, false
+	}
+	if err != nil || len(infoHash) != 20 {
+		return nil, false
+	}
+	return infoHash, true
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+var lookedUpInfoHashTest_instances = []struct {
+	query string
+	// infoHash is the hex of the infohash that is looked up, or empty if the query is searched for.
+	infoHash string
+}{
+	{"0123456789abcdef0123456789abcdef01234567", "0123456789abcdef0123456789abcdef01234567"},
+	{" 0123456789ABCDEF0123456789ABCDEF01234567 ", "0123456789abcdef0123456789abcdef01234567"},
+	{"AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH", "0123456789abcdef0123456789abcdef01234567"},
+	{"aeruKZ4JVPG66AJDIVTYTK6N54ASGRLH", "0123456789abcdef0123456789abcdef01234567"},
+	{"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=ubuntu",
+		"0123456789abcdef0123456789abcdef01234567"},
+	{"magnet:?dn=ubuntu&tr=udp%3A%2F%2Ftracker&xt=urn:btmh:1220abcd&xt=URN:BTIH:AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH",
+		"0123456789abcdef0123456789abcdef01234567"},
+
+	{"ubuntu", ""},
+	{"0123456789abcdef0123456789abcdef0123456", ""},
+	{"0123456789abcdef0123456789abcdef0123456z", ""},
+	{"ubuntu 20.04 desktop amd64 iso image", ""},
+	{"magnet:?xt=urn:btih:0123&dn=ubuntu", ""},
+	{"magnet:?dn=ubuntu", ""},
+}
+
+func TestLookedUpInfoHash(t *testing.T) {
+	for i, instance := range lookedUpInfoHashTest_instances {
+		infoHash, ok := lookedUpInfoHash(instance.query)
+		if ok != (instance.infoHash != "") || hex.EncodeToString(infoHash) != instance.infoHash {
+			t.Errorf("Infohash of the instance #%d is wrong! Got `%x` (expected `%s`)", i+1, infoHash,
+				instance.infoHash)
+		}
+	}
+}
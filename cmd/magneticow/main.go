@@ -3,10 +3,10 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"encoding/hex"
 	"fmt"
 	"html/template"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,11 +15,13 @@ import (
 	"sync"
 	"syscall"
 	"time"
+	// The time zones of the statistics are loaded from the embedded database, as the (static)
+	// binary might be run where there is none, such as on Windows and in the Docker image.
+	_ "time/tzdata"
 
 	"github.com/pkg/errors"
 
 	"github.com/Wessie/appdirs"
-	"github.com/dustin/go-humanize"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
 	"github.com/jessevdk/go-flags"
@@ -28,6 +30,8 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/boramalper/magnetico/pkg/persistence"
+	"github.com/boramalper/magnetico/pkg/service"
+	"github.com/boramalper/magnetico/pkg/util"
 )
 
 var compiledOn string
@@ -48,9 +52,94 @@ var opts struct {
 	// CredentialsPath is nil when no-auth is supplied.
 	CredentialsPath string
 	Verbosity       int
+
+	// Admins are the usernames of the operators who can moderate torrents. It is nil when no-auth
+	// is supplied.
+	Admins map[string]bool
+
+	// SearchLogRetention is how long the searches are kept for the search analytics; zero (the
+	// default) disables the search analytics altogether.
+	SearchLogRetention time.Duration
+
+	// InstanceStats enables the public (i.e. unauthenticated) instance statistics and badges;
+	// InstanceStatsVersion additionally reveals the version of magneticow there.
+	InstanceStats        bool
+	InstanceStatsVersion bool
+
+	// DownloadClients are the download clients of the users by their usernames, and the
+	// instance-wide one by the empty string.
+	DownloadClients map[string]downloadClient
+
+	// CustomCSSPath is the path to the stylesheet of the operator that is applied on top of the
+	// others (for branding, for instance); it is empty if not supplied.
+	CustomCSSPath string
+
+	// BasePath is the path prefix that magneticow is served under (e.g. "/magnetico"), without a
+	// trailing slash; it is empty if magneticow is served at the root.
+	BasePath string
+
+	// Crawler is the configuration of the crawler when magneticow crawls the DHT as well (i.e.
+	// magneticod and magneticow are combined in the same process); it is nil otherwise.
+	Crawler *crawlerConfig
+
+	// DefaultPageSize and MaxPageSize are the default and the maximum numbers of the torrents in
+	// a page of the search results; MaxScanDepth is the maximum number of the torrents that are
+	// read from the database by a single request (e.g. an export), so that the operators can bound
+	// the cost of any single request.
+	DefaultPageSize uint
+	MaxPageSize     uint
+	MaxScanDepth    uint
+
+	// RobotsRules are the policies of the search engines by the prefixes of the paths, from which
+	// robots.txt and the X-Robots-Tag headers are generated; RobotsPath is the path of the
+	// robots.txt of the operator that is served instead, and is empty if not supplied.
+	RobotsRules []robotsRule
+	RobotsPath  string
+
+	// DevDir is the directory that the assets are read from in the development mode (instead of
+	// the embedded ones); it is empty otherwise.
+	DevDir string
+
+	// AnonymousRateLimit is the number of the expensive requests (e.g. the searches) in a minute of
+	// each anonymous client (see AnonymousLimit), which is zero if unlimited; ProofOfWorkDifficulty
+	// is the difficulty (in bits) of the challenges that let them exceed it, which is zero if
+	// disabled.
+	AnonymousRateLimit    uint64
+	ProofOfWorkDifficulty uint
+	// TrustedProxies are the networks of the reverse proxies whose X-Forwarded-For headers are
+	// trusted to tell the IP addresses of the anonymous clients (see clientSubnet).
+	TrustedProxies []*net.IPNet
+
+	// DebugEndpoints enables the runtime diagnostics (pprof, expvar, and so on) for the operators.
+	DebugEndpoints bool
+	// DebugQueryPlans enables the plans of the searches to be attached to the responses of the API
+	// upon request, which are analyzed (i.e. the searches are run to measure them) for the
+	// operators only.
+	DebugQueryPlans bool
+
+	// AccessLogPath and AuditLogPath are the paths of the access and audit logs ("-" for stdout);
+	// they are empty if disabled.
+	AccessLogPath string
+	AuditLogPath  string
+	LogMaxSize    int64
+	LogMaxBackups int
+}
+
+var serviceConfig = service.Config{
+	Name:        "magneticow",
+	DisplayName: "magneticow",
+	Description: "Lightweight web interface for magnetico",
 }
 
 func main() {
+	if service.IsCommand(os.Args) {
+		if err := service.Command(serviceConfig, os.Args); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	loggerLevel := zap.NewAtomicLevel()
 	// Logging levels: ("debug", "info", "warn", "error", "dpanic", "panic", and "fatal").
 	logger := zap.New(zapcore.NewCore(
@@ -83,6 +172,20 @@ func main() {
 
 	zap.ReplaceGlobals(logger)
 
+	var err error
+	if opts.AccessLogPath != "" {
+		if accessLog, err = openLog(opts.AccessLogPath, opts.LogMaxSize, opts.LogMaxBackups); err != nil {
+			zap.L().Fatal("could not open the access log", zap.Error(err))
+		}
+		defer accessLog.Sync()
+	}
+	if opts.AuditLogPath != "" {
+		if auditLog, err = openLog(opts.AuditLogPath, opts.LogMaxSize, opts.LogMaxBackups); err != nil {
+			zap.L().Fatal("could not open the audit log", zap.Error(err))
+		}
+		defer auditLog.Sync()
+	}
+
 	// Reload credentials when you receive SIGHUP
 	sighupChan := make(chan os.Signal, 1)
 	signal.Notify(sighupChan, syscall.SIGHUP)
@@ -98,6 +201,8 @@ func main() {
 			opts.CredentialsRWMutex.Unlock()
 			if err := loadCred(opts.CredentialsPath); err != nil { // Reload credentials
 				zap.L().Warn("couldn't load credentials", zap.Error(err))
+			} else {
+				auditLog.Info("reload credentials")
 			}
 		}
 	}()
@@ -112,83 +217,164 @@ func main() {
 	router.HandleFunc("/",
 		BasicAuth(rootHandler, "magneticow"))
 
+	router.HandleFunc("/api/v0.1/i18n",
+		BasicAuth(apiI18n, "magneticow"))
 	router.HandleFunc("/api/v0.1/statistics",
-		BasicAuth(apiStatistics, "magneticow"))
+		APIAuth(apiStatistics, "magneticow"))
+	router.HandleFunc("/api/v0.1/dashboard",
+		BasicAuth(apiDashboard, "magneticow"))
+	router.HandleFunc("/api/v0.1/crawlerStats",
+		BasicAuth(apiCrawlerStats, "magneticow"))
 	router.HandleFunc("/api/v0.1/torrents",
-		BasicAuth(apiTorrents, "magneticow"))
+		APIAuth(AnonymousLimit(apiTorrents), "magneticow"))
+	router.HandleFunc("/api/v0.1/torrents/export",
+		APIAuth(AnonymousLimit(apiExport), "magneticow"))
+	router.HandleFunc("/api/v0.1/torrents/recent",
+		APIAuth(apiRecentTorrents, "magneticow"))
+	router.HandleFunc("/api/v0.1/torrents/trending",
+		APIAuth(apiTrendingTorrents, "magneticow"))
+	router.HandleFunc("/api/v0.1/downloadclient",
+		BasicAuth(apiDownloadClient, "magneticow"))
+	router.HandleFunc("/api/v1/suggest",
+		APIAuth(apiSuggest, "magneticow"))
+	// The search engines that are added already (see opensearch.xml) keep the suggestions URL of
+	// the time that they are added.
+	router.HandleFunc("/api/v0.1/suggest",
+		APIAuth(apiSuggest, "magneticow"))
 	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}",
-		BasicAuth(apiTorrent, "magneticow"))
+		APIAuth(apiTorrent, "magneticow"))
 	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/filelist",
-		BasicAuth(apiFilelist, "magneticow"))
-	router.Handle("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/readme",
-		apiReadmeHandler)
+		APIAuth(AnonymousLimit(apiFilelist), "magneticow"))
+	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/filetree",
+		APIAuth(AnonymousLimit(apiFiletree), "magneticow"))
+	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/report",
+		BasicAuth(SameOrigin(apiReport), "magneticow")).Methods("POST")
+	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/request",
+		BasicAuth(SameOrigin(apiRequestTorrent), "magneticow")).Methods("POST")
+	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/request",
+		BasicAuth(apiTorrentRequest, "magneticow")).Methods("GET")
+	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/send",
+		BasicAuth(apiSendToDownloadClient, "magneticow")).Methods("POST")
+	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/torrent",
+		APIAuth(apiTorrentFile, "magneticow"))
+	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/interactions",
+		BasicAuth(SameOrigin(apiAddInteraction), "magneticow")).Methods("POST")
+	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/interactions",
+		APIAuth(apiInteractions, "magneticow")).Methods("GET")
+	// The favorites are of the users, so there are none when no-auth is supplied (lest everyone
+	// shares, and can tamper with, the same favorites).
+	if opts.Credentials != nil {
+		router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/favorite",
+			BasicAuth(apiFavorite, "magneticow")).Methods("GET")
+		router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/favorite",
+			BasicAuth(apiAddFavorite, "magneticow")).Methods("PUT")
+		router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/favorite",
+			BasicAuth(apiRemoveFavorite, "magneticow")).Methods("DELETE")
+		router.HandleFunc("/api/v0.1/favorites",
+			BasicAuth(apiFavorites, "magneticow"))
+		router.HandleFunc("/api/v0.1/favorites/export",
+			BasicAuth(apiExportFavorites, "magneticow"))
+		router.HandleFunc("/favorites",
+			BasicAuth(favoritesHandler, "magneticow"))
+	}
+	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/moderation",
+		AdminAuth(SameOrigin(apiModerate), "magneticow")).Methods("POST")
+	router.HandleFunc("/api/v0.1/moderation/queue",
+		AdminAuth(apiModerationQueue, "magneticow"))
+	router.HandleFunc("/api/v0.1/analytics/searches",
+		AdminAuth(apiSearchAnalytics, "magneticow"))
+	router.HandleFunc("/api/v0.1/analytics/storage",
+		AdminAuth(apiStorageReport, "magneticow"))
+	router.HandleFunc("/api/v0.1/apikeys",
+		AdminAuth(apiAPIKeys, "magneticow")).Methods("GET")
+	router.HandleFunc("/api/v0.1/apikeys",
+		AdminAuth(SameOrigin(apiAddAPIKey), "magneticow")).Methods("POST")
+	router.HandleFunc("/api/v0.1/apikeys/{id:[0-9]+}",
+		AdminAuth(SameOrigin(apiUpdateAPIKey), "magneticow")).Methods("PATCH")
+	router.HandleFunc("/api/v0.1/apikeys/{id:[0-9]+}",
+		AdminAuth(SameOrigin(apiRevokeAPIKey), "magneticow")).Methods("DELETE")
+	router.HandleFunc("/api/v0.1/torrents/{infohash:[a-f0-9]{40}}/readme",
+		AnonymousLimit(apiReadmeHandler.ServeHTTP))
+
+	if opts.InstanceStats {
+		router.HandleFunc("/api/v1/instance", apiInstance)
+		router.HandleFunc("/api/v1/instance/badge.svg", apiInstanceBadge)
+		// The badges that are embedded already keep the URLs of the time that they are embedded.
+		router.HandleFunc("/api/v0.1/instance", apiInstance)
+		router.HandleFunc("/api/v0.1/instance/badge.svg", apiInstanceBadge)
+	}
+
+	if opts.DebugEndpoints {
+		router.PathPrefix("/debug/").HandlerFunc(
+			AdminAuth(util.DebugHandler().ServeHTTP, "magneticow"))
+	}
 
+	// robots.txt is for the search engines, which cannot authenticate.
+	router.HandleFunc("/robots.txt", robotsHandler)
 	router.HandleFunc("/feed",
 		BasicAuth(feedHandler, "magneticow"))
+	router.HandleFunc("/opensearch.xml",
+		BasicAuth(opensearchHandler, "magneticow"))
+	router.HandleFunc("/custom.css",
+		BasicAuth(customCSSHandler, "magneticow"))
+	router.HandleFunc("/sw.js",
+		BasicAuth(serviceWorkerHandler, "magneticow"))
 	router.PathPrefix("/static").HandlerFunc(
 		BasicAuth(staticHandler, "magneticow"))
 	router.HandleFunc("/statistics",
 		BasicAuth(statisticsHandler, "magneticow"))
+	router.HandleFunc("/analytics",
+		AdminAuth(analyticsHandler, "magneticow"))
 	router.HandleFunc("/torrents",
 		BasicAuth(torrentsHandler, "magneticow"))
 	router.HandleFunc("/torrents/{infohash:[a-f0-9]{40}}",
-		BasicAuth(torrentsInfohashHandler, "magneticow"))
-
-	templateFunctions := template.FuncMap{
-		"add": func(augend int, addends int) int {
-			return augend + addends
-		},
-
-		"subtract": func(minuend int, subtrahend int) int {
-			return minuend - subtrahend
-		},
-
-		"bytesToHex": func(bytes []byte) string {
-			return hex.EncodeToString(bytes)
-		},
-
-		"unixTimeToYearMonthDay": func(s int64) string {
-			tm := time.Unix(s, 0)
-			// > Format and Parse use example-based layouts. Usually you’ll use a constant from time
-			// > for these layouts, but you can also supply custom layouts. Layouts must use the
-			// > reference time Mon Jan 2 15:04:05 MST 2006 to show the pattern with which to
-			// > format/parse a given time/string. The example time must be exactly as shown: the
-			// > year 2006, 15 for the hour, Monday for the day of the week, etc.
-			// https://gobyexample.com/time-formatting-parsing
-			// Why you gotta be so weird Go?
-			return tm.Format("02/01/2006")
-		},
-
-		"humanizeSize": func(s uint64) string {
-			return humanize.IBytes(s)
-		},
-
-		"humanizeSizeF": func(s int64) string {
-			if s < 0 {
-				return ""
-			}
-			return humanize.IBytes(uint64(s))
-		},
-
-		"comma": func(s uint) string {
-			return humanize.Comma(int64(s))
-		},
+		BasicAuth(torrentPermalinkHandler, "magneticow"))
+	router.HandleFunc("/torrent/{infohash:[a-f0-9]{40}}",
+		BasicAuth(torrentPermalinkHandler, "magneticow"))
+	router.HandleFunc("/torrent/{infohash:[a-f0-9]{40}}/{slug}",
+		BasicAuth(torrentPermalinkHandler, "magneticow"))
+
+	if templates, err = parseTemplates(); err != nil {
+		zap.L().Fatal("could not parse templates", zap.Error(err))
 	}
 
-	templates = make(map[string]*template.Template)
-	templates["feed"] = template.Must(template.New("feed").Funcs(templateFunctions).Parse(string(mustAsset("templates/feed.xml"))))
-	templates["homepage"] = template.Must(template.New("homepage").Funcs(templateFunctions).Parse(string(mustAsset("templates/homepage.html"))))
+	if err = loadCatalogs(); err != nil {
+		zap.L().Fatal("could not load message catalogs", zap.Error(err))
+	}
 
 	database, err = persistence.MakeDatabase(opts.Database, logger)
 	if err != nil {
 		zap.L().Fatal("could not access to database", zap.Error(err))
 	}
 
+	if opts.SearchLogRetention > 0 {
+		go purgeSearchLog()
+	}
+
+	terminateCrawler := func() {}
+	if opts.Crawler != nil {
+		terminateCrawler = startCrawler(*opts.Crawler)
+	}
+
+	// Handle Ctrl-C gracefully, and the stop requests of the service managers likewise.
+	interruptChan := make(chan os.Signal, 1)
+	signal.Notify(interruptChan, os.Interrupt, syscall.SIGTERM)
+	service.Notify(serviceConfig.Name, interruptChan)
+	go func() {
+		<-interruptChan
+		terminateCrawler()
+		if err := database.Close(); err != nil {
+			zap.L().Error("Could not close database!", zap.Error(err))
+		}
+		service.Stopped()
+		os.Exit(0)
+	}()
+
 	decoder.IgnoreUnknownKeys(false)
 	decoder.ZeroEmpty(true)
 
-	zap.S().Infof("magneticow is ready to serve on %s!", opts.Addr)
-	err = http.ListenAndServe(opts.Addr, router)
+	zap.S().Infof("magneticow is ready to serve on %s%s/!", opts.Addr, opts.BasePath)
+	err = http.ListenAndServe(opts.Addr, AccessLog(Compress(BasePath(Robots(Conditional(Dev(router)))))))
 	if err != nil {
 		zap.L().Error("ListenAndServe error", zap.Error(err))
 	}
@@ -209,6 +395,31 @@ func mustAsset(name string) []byte {
 	return data
 }
 
+// mustPage returns the page (i.e. a template that is not executed) with the base path set.
+func mustPage(name string) []byte {
+	return withBasePath(mustAsset(name))
+}
+
+// crawlerFlags are the flags of the crawler, which is run with --crawl.
+type crawlerFlags struct {
+	IndexerAddrs        []string `long:"indexer-addr" description:"Address(es) to be used by indexing DHT nodes." default:"0.0.0.0:0"`
+	IndexerInterval     uint     `long:"indexer-interval" description:"Indexing interval in integer seconds." default:"1"`
+	IndexerMaxNeighbors uint     `long:"indexer-max-neighbors" description:"Maximum number of neighbors of an indexer." default:"1000"`
+	IndexerResponder    bool     `long:"indexer-responder" description:"Respond to the queries of the other DHT nodes, and store their announces."`
+	IndexerStrict       bool     `long:"indexer-strict" description:"Drop the DHT messages that are not strictly valid, rather than tolerating the common deviations."`
+
+	LeechMaxN   uint `long:"leech-max-n" description:"Maximum number of leeches." default:"50"`
+	FetchWindow uint `long:"fetch-window" description:"Time in integer seconds that the infohashes wait to be fetched while the leeches are busy (the most announced ones are fetched first)." default:"60"`
+
+	DedupeCapacity uint `long:"dedupe-capacity" description:"Number of the recently seen infohashes to remember, lest they are processed again (0 disables)." default:"100000"`
+
+	Record          string `long:"record" description:"Record (a sample of) the DHT messages received to the file, to be analysed offline or replayed (see --replay of magneticod)."`
+	RecordRate      uint   `long:"record-rate" description:"Maximum number of the messages recorded per second (0 is unlimited)." default:"100"`
+	RecordAnonymize bool   `long:"record-anonymize" description:"Replace the IP addresses in the recording with their pseudonyms."`
+
+	NAT string `long:"nat" description:"Map the port(s) of the indexer(s) on the router using UPnP, NAT-PMP, or either (any)." choice:"none" choice:"any" choice:"upnp" choice:"natpmp" default:"none"`
+}
+
 func parseFlags() error {
 	var cmdFlags struct {
 		Addr     string `short:"a" long:"addr"        description:"Address (host:port) to serve on"  default:":8080"`
@@ -216,7 +427,44 @@ func parseFlags() error {
 		Cred     string `short:"c" long:"credentials" description:"Path to the credentials file"`
 		NoAuth   bool   `          long:"no-auth"     description:"Disables authorisation"`
 
+		Admins []string `long:"admin" description:"Username of an operator who can moderate torrents (can be supplied multiple times)"`
+
+		SearchLogRetention time.Duration `long:"search-log-retention" description:"How long the searches are kept for the analytics (0 disables)" default:"0"`
+
+		InstanceStats        bool `long:"instance-stats"         description:"Serve the instance statistics and badges publicly (i.e. without authorisation)"`
+		InstanceStatsVersion bool `long:"instance-stats-version" description:"Reveal the version of magneticow in the instance statistics"`
+
+		DownloadClients []string `long:"download-client" description:"[USERNAME=]URL of a download client to send the torrents to (can be supplied multiple times)"`
+
+		CustomCSS string `long:"custom-css" description:"Path to a stylesheet to be applied on top of the others (e.g. for branding)"`
+
+		BasePath string `long:"base-path" description:"Path prefix to serve under (e.g. /magnetico) when sharing a domain behind a reverse proxy"`
+
+		DefaultPageSize uint `long:"default-page-size" description:"Number of the torrents in a page of the search results if not specified" default:"20"`
+		MaxPageSize     uint `long:"max-page-size"     description:"Maximum number of the torrents in a page of the search results" default:"100"`
+		MaxScanDepth    uint `long:"max-scan-depth"    description:"Maximum number of the torrents read by a single request (e.g. an export of the magnet links)" default:"10000"`
+
+		Robots     []string `long:"robots"      description:"PREFIX=POLICY of the search engines for the paths under the prefix, where the policy is allow, noindex, or disallow (can be supplied multiple times)" default:"/=disallow"`
+		RobotsFile string   `long:"robots-file" description:"Path to a robots.txt to be served instead of the one generated from --robots"`
+
+		AnonymousRateLimit uint64   `long:"anonymous-rate-limit" description:"Number of the expensive requests (e.g. searches) that each IP address can make in a minute with no-auth (0 disables)"`
+		ProofOfWork        uint     `long:"proof-of-work"        description:"Difficulty (in bits) of the proof-of-work challenges that let the IP addresses exceed anonymous-rate-limit instead of being blocked (0 disables)"`
+		TrustedProxies     []string `long:"trusted-proxy"      description:"IP address or CIDR of a reverse proxy whose X-Forwarded-For header tells the IP addresses of the clients for anonymous-rate-limit (can be supplied multiple times)"`
+
 		Verbose []bool `short:"v" long:"verbose" description:"Increases verbosity."`
+
+		AccessLog     string `long:"access-log"      description:"Path to write the access log (of the requests) to as JSON lines (- for stdout)"`
+		AuditLog      string `long:"audit-log"       description:"Path to write the audit log (of the actions of the operators) to as JSON lines (- for stdout)"`
+		LogMaxSize    uint   `long:"log-max-size"    description:"Size (in MiB) after which the access and audit logs are rotated (0 disables)" default:"100"`
+		LogMaxBackups uint   `long:"log-max-backups" description:"Number of the rotated access and audit logs to keep" default:"5"`
+
+		DebugEndpoints  bool `long:"debug-endpoints"   description:"Serve the runtime diagnostics (pprof, expvar, heap statistics, and metrics) under /debug/ to the operators"`
+		DebugQueryPlans bool `long:"debug-query-plans" description:"Attach the plans of the searches to the responses of the API upon request (with explain=true), analyzed for the operators"`
+
+		Dev string `long:"dev" description:"Development mode: read the assets from the directory (instead of the embedded ones) and reload the templates on every request" optional:"yes" optional-value:"cmd/magneticow/data"`
+
+		Crawl   bool         `long:"crawl" description:"Crawl the DHT in the same process as well (i.e. run magneticod too)"`
+		Crawler crawlerFlags `group:"Crawler Options (with --crawl)"`
 	}
 
 	if _, err := flags.Parse(&cmdFlags); err != nil {
@@ -227,9 +475,22 @@ func parseFlags() error {
 		return fmt.Errorf("`credentials` and `no-auth` cannot be supplied together")
 	}
 
+	if len(cmdFlags.Admins) > 0 && cmdFlags.NoAuth {
+		return fmt.Errorf("`admin` and `no-auth` cannot be supplied together")
+	}
+
 	opts.Addr = cmdFlags.Addr
 
-	if cmdFlags.Database == "" {
+	if cmdFlags.Database == "" && cmdFlags.Crawl {
+		// Same as the default of magneticod, as the database is written as well.
+		opts.Database =
+			"sqlite3://" +
+				appdirs.UserDataDir("magneticod", "", "", false) +
+				"/database.sqlite3" +
+				"?_journal_mode=WAL" + // https://github.com/mattn/go-sqlite3#connection-string
+				"&_busy_timeout=3000" + // in milliseconds
+				"&_foreign_keys=true"
+	} else if cmdFlags.Database == "" {
 		opts.Database =
 			"sqlite3://" +
 				appdirs.UserDataDir("magneticod", "", "", false) +
@@ -255,6 +516,124 @@ func parseFlags() error {
 		if err := loadCred(opts.CredentialsPath); err != nil {
 			return err
 		}
+
+		opts.Admins = make(map[string]bool)
+		for _, admin := range cmdFlags.Admins {
+			if _, ok := opts.Credentials[admin]; !ok {
+				zap.S().Warnf("Admin `%s` is not found in the credentials file", admin)
+			}
+			opts.Admins[admin] = true
+		}
+	}
+
+	opts.SearchLogRetention = cmdFlags.SearchLogRetention
+
+	if cmdFlags.AnonymousRateLimit != 0 && !cmdFlags.NoAuth {
+		return fmt.Errorf("`anonymous-rate-limit` can be supplied only along with `no-auth`")
+	}
+	if cmdFlags.ProofOfWork != 0 && cmdFlags.AnonymousRateLimit == 0 {
+		return fmt.Errorf("`proof-of-work` cannot be supplied without `anonymous-rate-limit`")
+	}
+	if cmdFlags.ProofOfWork > 32 {
+		return fmt.Errorf("`proof-of-work` must be in range [0, 32]")
+	}
+	opts.AnonymousRateLimit = cmdFlags.AnonymousRateLimit
+	opts.ProofOfWorkDifficulty = cmdFlags.ProofOfWork
+
+	if len(cmdFlags.TrustedProxies) != 0 && cmdFlags.AnonymousRateLimit == 0 {
+		return fmt.Errorf("`trusted-proxy` cannot be supplied without `anonymous-rate-limit`")
+	}
+	for _, proxy := range cmdFlags.TrustedProxies {
+		network, err := parseTrustedProxy(proxy)
+		if err != nil {
+			return err
+		}
+		opts.TrustedProxies = append(opts.TrustedProxies, network)
+	}
+
+	if cmdFlags.InstanceStatsVersion && !cmdFlags.InstanceStats {
+		return fmt.Errorf("`instance-stats-version` cannot be supplied without `instance-stats`")
+	}
+	opts.InstanceStats = cmdFlags.InstanceStats
+	opts.InstanceStatsVersion = cmdFlags.InstanceStatsVersion
+
+	opts.DownloadClients = make(map[string]downloadClient)
+	for _, spec := range cmdFlags.DownloadClients {
+		username, client, err := parseDownloadClientSpec(spec)
+		if err != nil {
+			return errors.Wrap(err, "download client")
+		}
+		if username != "" && cmdFlags.NoAuth {
+			return fmt.Errorf("download clients of the users cannot be supplied along with `no-auth`")
+		}
+		if _, ok := opts.DownloadClients[username]; ok {
+			return fmt.Errorf("download client of `%s` is supplied multiple times", username)
+		}
+		opts.DownloadClients[username] = client
+	}
+
+	if cmdFlags.CustomCSS != "" {
+		if _, err := os.Stat(cmdFlags.CustomCSS); err != nil {
+			return errors.Wrap(err, "custom CSS")
+		}
+		opts.CustomCSSPath = cmdFlags.CustomCSS
+	}
+
+	if cmdFlags.Crawl {
+		crawlerConfig, err := makeCrawlerConfig(cmdFlags.Crawler)
+		if err != nil {
+			return err
+		}
+		opts.Crawler = crawlerConfig
+	}
+
+	basePath, err := normaliseBasePath(cmdFlags.BasePath)
+	if err != nil {
+		return err
+	}
+	opts.BasePath = basePath
+
+	if cmdFlags.DefaultPageSize == 0 || cmdFlags.DefaultPageSize > cmdFlags.MaxPageSize {
+		return fmt.Errorf("`default-page-size` must be in range [1, max-page-size]")
+	}
+	if cmdFlags.MaxScanDepth < cmdFlags.MaxPageSize {
+		return fmt.Errorf("`max-scan-depth` must not be less than `max-page-size`")
+	}
+	opts.DefaultPageSize = cmdFlags.DefaultPageSize
+	opts.MaxPageSize = cmdFlags.MaxPageSize
+	opts.MaxScanDepth = cmdFlags.MaxScanDepth
+
+	for _, spec := range cmdFlags.Robots {
+		rule, err := parseRobotsRule(spec)
+		if err != nil {
+			return errors.Wrap(err, "robots")
+		}
+		opts.RobotsRules = append(opts.RobotsRules, rule)
+	}
+	if cmdFlags.RobotsFile != "" {
+		if _, err := os.Stat(cmdFlags.RobotsFile); err != nil {
+			return errors.Wrap(err, "robots file")
+		}
+		opts.RobotsPath = cmdFlags.RobotsFile
+	}
+
+	if cmdFlags.DebugEndpoints && cmdFlags.NoAuth {
+		return fmt.Errorf("`debug-endpoints` and `no-auth` cannot be supplied together")
+	}
+	opts.DebugEndpoints = cmdFlags.DebugEndpoints
+	opts.DebugQueryPlans = cmdFlags.DebugQueryPlans
+
+	opts.AccessLogPath = cmdFlags.AccessLog
+	opts.AuditLogPath = cmdFlags.AuditLog
+	opts.LogMaxSize = int64(cmdFlags.LogMaxSize) << 20
+	opts.LogMaxBackups = int(cmdFlags.LogMaxBackups)
+
+	if cmdFlags.Dev != "" {
+		if _, err := os.Stat(path.Join(cmdFlags.Dev, "templates")); err != nil {
+			return errors.Wrap(err, "dev")
+		}
+		opts.DevDir = cmdFlags.Dev
+		assets = os.DirFS(opts.DevDir)
 	}
 
 	opts.Verbosity = len(cmdFlags.Verbose)
@@ -310,7 +689,7 @@ func loadCred(cred string) error {
 //
 // Most web browser display a dialog with something like:
 //
-//    The website says: "<realm>"
+//	The website says: "<realm>"
 //
 // Which is really stupid so you may want to set the realm to a message rather than
 // an actual realm.
@@ -346,6 +725,38 @@ func BasicAuth(handler http.HandlerFunc, realm string) http.HandlerFunc {
 	}
 }
 
+// AdminAuth is BasicAuth that additionally requires the user to be one of the operators. Since
+// the operators cannot be told apart from the others when no-auth is supplied, everyone is
+// forbidden in that case.
+func AdminAuth(handler http.HandlerFunc, realm string) http.HandlerFunc {
+	return BasicAuth(func(w http.ResponseWriter, r *http.Request) {
+		if opts.Credentials == nil { // --no-auth is supplied by the user.
+			respondError(w, 403, "moderation is disabled when authorisation is disabled")
+			return
+		}
+
+		if username, _, _ := r.BasicAuth(); !opts.Admins[username] {
+			respondError(w, 403, "only the operators can moderate")
+			return
+		}
+
+		handler(w, r)
+	}, realm)
+}
+
+// SameOrigin rejects the cross-site requests (see isSameOrigin) to the state-changing endpoints, lest
+// any web page can submit a form to them using the cached credentials of the user (or without any,
+// with --no-auth).
+func SameOrigin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isSameOrigin(r) {
+			respondError(w, 403, "cross-site requests are forbidden")
+			return
+		}
+		handler(w, r)
+	}
+}
+
 func authenticate(w http.ResponseWriter, realm string) {
 	w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
 	w.WriteHeader(401)
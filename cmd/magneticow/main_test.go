@@ -1,6 +1,8 @@
 package main
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -113,3 +115,22 @@ func TestSchemaRequired(t *testing.T) {
 		t.Error("err is nil")
 	}
 }
+
+func TestSameOrigin(t *testing.T) {
+	called := false
+	handler := SameOrigin(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	r := httptest.NewRequest("POST", "http://magneticow.example/api/v0.1/torrents/x/report", nil)
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if called || w.Code != 403 {
+		t.Errorf("cross-site request is not rejected! Got %d (expected 403)", w.Code)
+	}
+
+	r.Header.Set("Sec-Fetch-Site", "same-origin")
+	handler(httptest.NewRecorder(), r)
+	if !called {
+		t.Error("same-origin request is rejected")
+	}
+}
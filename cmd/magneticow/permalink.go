@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gorilla/mux"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// maxSlugLength is the maximum length of the slugs in runes, lest the names that are paragraphs
+// long make unwieldy links.
+const maxSlugLength = 80
+
+// slugify returns the human-readable part of the permalink of a torrent, which consists of the
+// (lowercase) letters and the digits of its name separated by hyphens, e.g.
+// "Ubuntu 20.04 Desktop (amd64)" becomes "ubuntu-20-04-desktop-amd64". The letters of all the
+// scripts are kept, as the search engines and the browsers handle them well.
+func slugify(name string) string {
+	var sb strings.Builder
+	hyphen, n := false, 0
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			hyphen = hyphen && n > 0
+			if hyphen && n+2 > maxSlugLength || n+1 > maxSlugLength {
+				break
+			}
+			if hyphen {
+				sb.WriteRune('-')
+				n++
+			}
+			sb.WriteRune(unicode.ToLower(r))
+			hyphen = false
+			n++
+		} else {
+			hyphen = true
+		}
+	}
+	return sb.String()
+}
+
+// permalink returns the canonical path of the page of the torrent (relative to the base path).
+func permalink(torrent *persistence.TorrentMetadata) string {
+	path := "/torrent/" + hex.EncodeToString(torrent.InfoHash)
+	if slug := slugify(torrent.Name); slug != "" {
+		path += "/" + url.PathEscape(slug)
+	}
+	return path
+}
+
+// torrentPermalinkHandler serves the page of the torrent at its permalink, to which the other
+// paths of the torrent (i.e. with an outdated or without a slug, or the older /torrents/<infohash>)
+// are redirected. The metadata of the page are filled in by the server (rather than by the script)
+// for the previews of the links shared on the social media, whose crawlers do not run scripts.
+func torrentPermalinkHandler(w http.ResponseWriter, r *http.Request) {
+	infoHash, err := hex.DecodeString(mux.Vars(r)["infohash"])
+	if err != nil {
+		respondError(w, 400, "couldn't decode infohash: %s", err.Error())
+		return
+	}
+
+	torrent, err := database.GetTorrent(infoHash)
+	if err != nil {
+		respondError(w, 500, "couldn't get torrent: %s", err.Error())
+		return
+	} else if torrent == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	canonical := permalink(torrent)
+	// The paths are compared unescaped, as the clients escape the non-ASCII slugs differently.
+	if unescaped, _ := url.PathUnescape(canonical); r.URL.Path != unescaped {
+		http.Redirect(w, r, opts.BasePath+canonical, http.StatusMovedPermanently)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Cache static resources for a day
+	w.Header().Set("Cache-Control", "max-age=86400")
+	_, _ = w.Write(withTorrentMeta(mustPage("templates/torrent.html"), torrent, baseURL(r)+canonical))
+}
+
+// withTorrentMeta sets the title of the page of the torrent, and adds its canonical URL and its
+// Open Graph and Twitter Card metadata.
+func withTorrentMeta(page []byte, torrent *persistence.TorrentMetadata, canonicalURL string) []byte {
+	description := fmt.Sprintf("%s in %d file(s), discovered on %s", humanize.IBytes(torrent.Size),
+		torrent.NFiles, torrent.DiscoveredOn.UTC().Format("2006-01-02"))
+
+	var meta bytes.Buffer
+	escape := template.HTMLEscapeString
+	fmt.Fprintf(&meta, `<link rel="canonical" href="%s">`+"\n", escape(canonicalURL))
+	for _, property := range [][2]string{
+		{"og:type", "website"},
+		{"og:site_name", "magneticow"},
+		{"og:title", torrent.Name},
+		{"og:description", description},
+		{"og:url", canonicalURL},
+	} {
+		fmt.Fprintf(&meta, `    <meta property="%s" content="%s">`+"\n", property[0], escape(property[1]))
+	}
+	for _, name := range [][2]string{
+		{"twitter:card", "summary"},
+		{"twitter:title", torrent.Name},
+		{"twitter:description", description},
+		{"description", description},
+	} {
+		fmt.Fprintf(&meta, `    <meta name="%s" content="%s">`+"\n", name[0], escape(name[1]))
+	}
+
+	page = bytes.Replace(page, []byte("<title>Loading... - magneticow</title>"),
+		[]byte("<title>"+escape(torrent.Name)+" - magneticow</title>"), 1)
+	return bytes.Replace(page, []byte("<!-- meta -->\n"), meta.Bytes(), 1)
+}
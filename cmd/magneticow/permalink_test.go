@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+var slugify_instances = []struct {
+	name     string
+	expected string
+}{
+	{"Ubuntu 20.04 Desktop (amd64)", "ubuntu-20-04-desktop-amd64"},
+	{"  --Big_Buck_Bunny_1080p--  ", "big-buck-bunny-1080p"},
+	{"Été à Paris", "été-à-paris"},
+	{"東京 2020", "東京-2020"},
+	{"!!!", ""},
+	{strings.Repeat("a", 100), strings.Repeat("a", maxSlugLength)},
+	{strings.Repeat("a ", 100), strings.TrimSuffix(strings.Repeat("a-", maxSlugLength/2), "-")},
+}
+
+func TestSlugify(t *testing.T) {
+	for i, instance := range slugify_instances {
+		if slug := slugify(instance.name); slug != instance.expected {
+			t.Errorf("slug of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, slug, instance.expected)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The public instances (i.e. with --no-auth) can limit the expensive requests (e.g. the searches)
+// of each client by its IP address; the clients that exceed the limit are blocked for the rest of
+// the minute unless they solve a proof-of-work challenge (if enabled), each solution of which lets
+// them carry on for another --anonymous-rate-limit requests. The challenges are stateless (i.e.
+// signed by magneticow), and the solutions are remembered only until their challenges expire.
+
+const (
+	proofOfWorkHeader           = "X-Proof-Of-Work"
+	proofOfWorkChallengeHeader  = "X-Proof-Of-Work-Challenge"
+	proofOfWorkDifficultyHeader = "X-Proof-Of-Work-Difficulty"
+)
+
+// challengeLifetime is how long a proof-of-work challenge can be solved in.
+const challengeLifetime = 5 * time.Minute
+
+// challengeKey signs the challenges, and is regenerated every time magneticow starts (invalidating
+// the outstanding ones, which are short-lived anyway).
+var challengeKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err.Error())
+	}
+	return key
+}()
+
+var anonymousLimiter = newRequestLimiter()
+
+// solvedChallenges are the challenges that are solved already, by their expiries (in Unix time),
+// lest a solution is reused.
+var solvedChallenges = struct {
+	sync.Mutex
+	expiries map[string]int64
+}{expiries: make(map[string]int64)}
+
+// AnonymousLimit limits the requests of the anonymous clients (i.e. without API keys) by their IP
+// addresses to --anonymous-rate-limit in a minute, which the clients can exceed by solving a
+// proof-of-work challenge if --proof-of-work is supplied.
+func AnonymousLimit(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if opts.AnonymousRateLimit == 0 || r.Context().Value(apiKeyUsageKey{}) != nil {
+			handler(w, r)
+			return
+		}
+
+		now := time.Now()
+		client := clientSubnet(r)
+		if anonymousLimiter.allow(client, opts.AnonymousRateLimit, now) {
+			handler(w, r)
+			return
+		}
+
+		if opts.ProofOfWorkDifficulty == 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(60-now.Second()))
+			respondError(w, 429, "rate limit of %d requests per minute is exceeded", opts.AnonymousRateLimit)
+			return
+		}
+
+		var err error
+		if solution := r.Header.Get(proofOfWorkHeader); solution != "" {
+			if err = verifySolution(solution, client, opts.ProofOfWorkDifficulty, now); err == nil {
+				anonymousLimiter.reset(client)
+				anonymousLimiter.allow(client, opts.AnonymousRateLimit, now)
+				handler(w, r)
+				return
+			}
+		}
+
+		w.Header().Set(proofOfWorkChallengeHeader, newChallenge(client, now))
+		w.Header().Set(proofOfWorkDifficultyHeader, strconv.Itoa(int(opts.ProofOfWorkDifficulty)))
+		if err != nil {
+			respondError(w, 429, "invalid proof of work (%s); solve the new challenge to carry on", err.Error())
+		} else {
+			respondError(w, 429, "rate limit of %d requests per minute is exceeded; solve the proof-of-work "+
+				"challenge to carry on", opts.AnonymousRateLimit)
+		}
+	}
+}
+
+// clientSubnet returns the IP address of the client that made the request, or the /64 subnet of it
+// if it is an IPv6 address (as the clients usually have a whole subnet at least).
+//
+// The IP address of the client is that of the peer, unless the peer is a trusted proxy (see
+// --trusted-proxy), in which case it is the last address in X-Forwarded-For that is not of a
+// trusted proxy (as the earlier ones can be forged by the client).
+func clientSubnet(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if isTrustedProxy(ip) {
+		forwardedFor := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(forwardedFor) - 1; i >= 0; i-- {
+			forwarded := net.ParseIP(strings.TrimSpace(forwardedFor[i]))
+			if forwarded == nil {
+				break
+			}
+			ip = forwarded
+			if !isTrustedProxy(ip) {
+				break
+			}
+		}
+	}
+
+	if ip.To4() == nil {
+		return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+	}
+	return ip.To4().String()
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range opts.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxy parses a --trusted-proxy flag, which is either an IP address or a CIDR.
+func parseTrustedProxy(proxy string) (*net.IPNet, error) {
+	if !strings.Contains(proxy, "/") {
+		ip := net.ParseIP(proxy)
+		if ip == nil {
+			return nil, fmt.Errorf("trusted proxy must be an IP address or a CIDR (got `%s`)", proxy)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("trusted proxy must be an IP address or a CIDR (got `%s`)", proxy)
+	}
+	return network, nil
+}
+
+// newChallenge returns a challenge for the client, which is <SALT>.<EXPIRY>.<MAC> where the expiry
+// is in Unix time, and the MAC binds the challenge to the client.
+func newChallenge(client string, now time.Time) string {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err.Error())
+	}
+	unsigned := hex.EncodeToString(salt) + "." + strconv.FormatInt(now.Add(challengeLifetime).Unix(), 10)
+	return unsigned + "." + challengeMAC(unsigned, client)
+}
+
+func challengeMAC(unsigned string, client string) string {
+	mac := hmac.New(sha256.New, challengeKey)
+	_, _ = mac.Write([]byte(client + " " + unsigned))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// verifySolution verifies the solution <CHALLENGE>:<NONCE> of the client, where the SHA-256 of the
+// solution must start with @difficulty zero bits, and remembers the challenge as solved.
+func verifySolution(solution string, client string, difficulty uint, now time.Time) error {
+	i := strings.LastIndexByte(solution, ':')
+	if i == -1 {
+		return fmt.Errorf("the solution must be <CHALLENGE>:<NONCE>")
+	}
+	challenge := solution[:i]
+
+	fields := strings.Split(challenge, ".")
+	if len(fields) != 3 {
+		return fmt.Errorf("malformed challenge")
+	}
+	unsigned := fields[0] + "." + fields[1]
+	if !hmac.Equal([]byte(fields[2]), []byte(challengeMAC(unsigned, client))) {
+		return fmt.Errorf("not a challenge of this client")
+	}
+	expiry, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || expiry < now.Unix() {
+		return fmt.Errorf("expired challenge")
+	}
+
+	if sum := sha256.Sum256([]byte(solution)); leadingZeroBits(sum[:]) < difficulty {
+		return fmt.Errorf("not enough work")
+	}
+
+	solvedChallenges.Lock()
+	defer solvedChallenges.Unlock()
+	if _, ok := solvedChallenges.expiries[challenge]; ok {
+		return fmt.Errorf("solved already")
+	}
+	for c, e := range solvedChallenges.expiries {
+		if e < now.Unix() {
+			delete(solvedChallenges.expiries, c)
+		}
+	}
+	solvedChallenges.expiries[challenge] = expiry
+	return nil
+}
+
+func leadingZeroBits(b []byte) uint {
+	var n uint
+	for _, x := range b {
+		if x != 0 {
+			return n + uint(bits.LeadingZeros8(x))
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/sha256"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var clientSubnet_instances = []struct {
+	remoteAddr   string
+	forwardedFor string
+	expected     string
+}{
+	{"192.0.2.1:1234", "", "192.0.2.1"},
+	{"[2001:db8:1:2:3:4:5:6]:1234", "", "2001:db8:1:2::/64"},
+	{"[::ffff:192.0.2.1]:1234", "", "192.0.2.1"},
+	{"pipe", "", "pipe"},
+	// X-Forwarded-For is ignored unless the peer is a trusted proxy.
+	{"192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+	{"127.0.0.1:1234", "", "127.0.0.1"},
+	{"127.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+	{"127.0.0.1:1234", "203.0.113.1, 198.51.100.1", "198.51.100.1"},
+	{"127.0.0.1:1234", "198.51.100.1, 10.0.0.1", "198.51.100.1"},
+	{"127.0.0.1:1234", "2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+	{"127.0.0.1:1234", "forged, 10.0.0.1", "10.0.0.1"},
+}
+
+func TestClientSubnet(t *testing.T) {
+	for _, proxy := range []string{"127.0.0.1", "10.0.0.0/8"} {
+		network, err := parseTrustedProxy(proxy)
+		if err != nil {
+			t.Fatalf("Could not parse the trusted proxy: %s", err.Error())
+		}
+		opts.TrustedProxies = append(opts.TrustedProxies, network)
+	}
+	defer func() { opts.TrustedProxies = nil }()
+
+	for i, instance := range clientSubnet_instances {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = instance.remoteAddr
+		if instance.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", instance.forwardedFor)
+		}
+		if got := clientSubnet(r); got != instance.expected {
+			t.Errorf("subnet of the instance #%d is wrong! Got %s (expected %s)", i+1, got, instance.expected)
+		}
+	}
+}
+
+func TestParseTrustedProxy(t *testing.T) {
+	for _, proxy := range []string{"localhost", "10.0.0.0/33", ""} {
+		if _, err := parseTrustedProxy(proxy); err == nil {
+			t.Errorf("trusted proxy `%s` is accepted", proxy)
+		}
+	}
+}
+
+// solve brute-forces the challenge, as the clients do.
+func solve(challenge string, difficulty uint) string {
+	for nonce := 0; ; nonce++ {
+		solution := challenge + ":" + strconv.Itoa(nonce)
+		if sum := sha256.Sum256([]byte(solution)); leadingZeroBits(sum[:]) >= difficulty {
+			return solution
+		}
+	}
+}
+
+func TestVerifySolution(t *testing.T) {
+	const difficulty = 8
+	now := time.Now()
+	challenge := newChallenge("192.0.2.1", now)
+	solution := solve(challenge, difficulty)
+	// A nonce that is not a solution, which is not necessarily the first one.
+	unsolved := challenge + ":0"
+	for nonce := 1; ; nonce++ {
+		if sum := sha256.Sum256([]byte(unsolved)); leadingZeroBits(sum[:]) < difficulty {
+			break
+		}
+		unsolved = challenge + ":" + strconv.Itoa(nonce)
+	}
+
+	instances := []struct {
+		solution string
+		client   string
+		now      time.Time
+		valid    bool
+	}{
+		{unsolved, "192.0.2.1", now, false},
+		{solution, "192.0.2.2", now, false},                                      // of another client
+		{solution, "192.0.2.1", now.Add(challengeLifetime + time.Second), false}, // expired
+		{"malformed:0", "192.0.2.1", now, false},
+		{solution, "192.0.2.1", now, true},
+		{solution, "192.0.2.1", now, false}, // reused
+	}
+	for i, instance := range instances {
+		err := verifySolution(instance.solution, instance.client, difficulty, instance.now)
+		if (err == nil) != instance.valid {
+			t.Errorf("validity of the instance #%d is wrong! Got %v (expected %t)", i+1, err, instance.valid)
+		}
+	}
+}
+
+var leadingZeroBits_instances = []struct {
+	b        []byte
+	expected uint
+}{
+	{[]byte{0x80}, 0},
+	{[]byte{0x00, 0x01}, 15},
+	{[]byte{0x00, 0x00}, 16},
+	{[]byte{0x0f, 0xff}, 4},
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	for i, instance := range leadingZeroBits_instances {
+		if got := leadingZeroBits(instance.b); got != instance.expected {
+			t.Errorf("number of the instance #%d is wrong! Got %d (expected %d)", i+1, got, instance.expected)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// robotsPolicy is how the search engines are to treat the paths under a prefix.
+type robotsPolicy string
+
+const (
+	// robotsAllow paths may be crawled and indexed.
+	robotsAllow robotsPolicy = "allow"
+	// robotsNoIndex paths may be crawled (e.g. to follow their links) but not indexed, which is
+	// signalled by the X-Robots-Tag header (hence they must not be disallowed in robots.txt, lest
+	// the header is never seen).
+	robotsNoIndex robotsPolicy = "noindex"
+	// robotsDisallow paths may be neither crawled nor indexed.
+	robotsDisallow robotsPolicy = "disallow"
+)
+
+// robotsRule is the policy of the paths under a prefix, where the rule of the longest matching
+// prefix applies.
+type robotsRule struct {
+	prefix string
+	policy robotsPolicy
+}
+
+// parseRobotsRule parses a rule of the form PREFIX=POLICY (e.g. /torrents=noindex).
+func parseRobotsRule(spec string) (robotsRule, error) {
+	tokens := strings.SplitN(spec, "=", 2)
+	if len(tokens) != 2 || !strings.HasPrefix(tokens[0], "/") {
+		return robotsRule{}, fmt.Errorf("robots rule must be of the form PREFIX=POLICY, where PREFIX starts with a slash (got `%s`)", spec)
+	}
+
+	rule := robotsRule{prefix: tokens[0], policy: robotsPolicy(tokens[1])}
+	switch rule.policy {
+	case robotsAllow, robotsNoIndex, robotsDisallow:
+		return rule, nil
+	default:
+		return robotsRule{}, fmt.Errorf("robots policy must be one of allow, noindex, and disallow (got `%s`)", tokens[1])
+	}
+}
+
+// robotsPolicyOf returns the policy of the path (without the base path), which is robotsAllow if
+// no rule matches.
+func robotsPolicyOf(path string) robotsPolicy {
+	policy, longest := robotsAllow, -1
+	for _, rule := range opts.RobotsRules {
+		if strings.HasPrefix(path, rule.prefix) && len(rule.prefix) > longest {
+			policy, longest = rule.policy, len(rule.prefix)
+		}
+	}
+	return policy
+}
+
+// robotsTxt generates the robots.txt of the rules, whose paths are prefixed with the base path.
+func robotsTxt() string {
+	rules := make([]robotsRule, len(opts.RobotsRules))
+	copy(rules, opts.RobotsRules)
+	// The most specific rules are listed first, for the crawlers that apply the first match.
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].prefix) > len(rules[j].prefix)
+	})
+
+	var sb strings.Builder
+	sb.WriteString("User-agent: *\n")
+	for _, rule := range rules {
+		if rule.policy == robotsDisallow {
+			sb.WriteString("Disallow: " + opts.BasePath + rule.prefix + "\n")
+		} else {
+			sb.WriteString("Allow: " + opts.BasePath + rule.prefix + "\n")
+		}
+	}
+	return sb.String()
+}
+
+func robotsHandler(w http.ResponseWriter, r *http.Request) {
+	if opts.RobotsPath != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeFile(w, r, opts.RobotsPath)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(robotsTxt()))
+}
+
+// Robots sets the X-Robots-Tag header of the responses by the policy of their paths, so that the
+// pages that are not to be indexed are kept out of the search engines even if they are linked to
+// from elsewhere.
+func Robots(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch robotsPolicyOf(r.URL.Path) {
+		case robotsNoIndex:
+			w.Header().Set("X-Robots-Tag", "noindex")
+		case robotsDisallow:
+			w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
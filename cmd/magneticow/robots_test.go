@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var parseRobotsRule_instances = []struct {
+	spec     string
+	expected robotsRule
+	err      bool
+}{
+	{"/=disallow", robotsRule{"/", robotsDisallow}, false},
+	{"/torrents/=allow", robotsRule{"/torrents/", robotsAllow}, false},
+	{"/torrents=noindex", robotsRule{"/torrents", robotsNoIndex}, false},
+	{"torrents=allow", robotsRule{}, true},
+	{"/torrents", robotsRule{}, true},
+	{"/torrents=index", robotsRule{}, true},
+}
+
+func TestParseRobotsRule(t *testing.T) {
+	for i, instance := range parseRobotsRule_instances {
+		rule, err := parseRobotsRule(instance.spec)
+		if (err != nil) != instance.err {
+			t.Errorf("error of the instance #%d is wrong! Got %v", i+1, err)
+		} else if rule != instance.expected {
+			t.Errorf("rule of the instance #%d is wrong! Got %v (expected %v)", i+1, rule, instance.expected)
+		}
+	}
+}
+
+var robots_instances = []struct {
+	path       string
+	xRobotsTag string
+}{
+	{"/", "noindex, nofollow"},
+	{"/statistics", "noindex, nofollow"},
+	{"/torrents", "noindex"},
+	{"/torrents?query=ubuntu", "noindex"},
+	{"/torrents/0123456789abcdef0123456789abcdef01234567", ""},
+}
+
+func TestRobots(t *testing.T) {
+	opts.RobotsRules = []robotsRule{{"/", robotsDisallow}, {"/torrents/", robotsAllow}, {"/torrents", robotsNoIndex}}
+	opts.BasePath = "/magnetico"
+	defer func() { opts.RobotsRules, opts.BasePath = nil, "" }()
+
+	handler := Robots(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, instance := range robots_instances {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", instance.path, nil))
+		if xRobotsTag := recorder.Header().Get("X-Robots-Tag"); xRobotsTag != instance.xRobotsTag {
+			t.Errorf("X-Robots-Tag of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, xRobotsTag,
+				instance.xRobotsTag)
+		}
+	}
+
+	expected := "User-agent: *\nAllow: /magnetico/torrents/\nAllow: /magnetico/torrents\nDisallow: /magnetico/\n"
+	if txt := robotsTxt(); txt != expected {
+		t.Errorf("robots.txt is wrong! Got\n%s\n(expected\n%s)", txt, expected)
+	}
+}
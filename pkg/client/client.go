@@ -0,0 +1,128 @@
+// Package client is a client of the HTTP API of magneticow, for the Go tools that integrate with
+// the instances of magnetico (such as magneticoctl) without re-implementing the HTTP plumbing.
+//
+// The models of the API are the ones of pkg/persistence, as magneticow serves them as they are.
+package client
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// apiPath is the path of the API relative to the root of the instance.
+const apiPath = "api/v0.1/"
+
+// maxErrorLength is the maximum number of the bytes of the responses of the errors that are read
+// into Error.Message, as magneticow responds with a short message only.
+const maxErrorLength = 4096
+
+// Client is a client of an instance of magneticow. It is safe to use concurrently.
+type Client struct {
+	// HTTPClient is the client that the requests are made with, which times out after a minute by
+	// default.
+	HTTPClient *http.Client
+	// Username and Password are the credentials of the instance, if it requires them.
+	Username, Password string
+
+	baseURL *url.URL
+}
+
+// Error is the error that magneticow responds with.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("magneticow responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound returns true if the error is that the requested resource (e.g. the torrent) is not
+// found.
+func IsNotFound(err error) bool {
+	e, ok := errors.Cause(err).(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// New returns a client of the instance at the URL, which may have a path if the instance is served
+// under one (see --base-path of magneticow), e.g. https://example.com/magnetico/.
+func New(rawURL string) (*Client, error) {
+	baseURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "url.Parse")
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme: %s", baseURL.Scheme)
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+
+	return &Client{
+		HTTPClient: &http.Client{Timeout: time.Minute},
+		baseURL:    baseURL,
+	}, nil
+}
+
+// get requests the endpoint (relative to the API) with the query, and decodes its JSON response
+// into v.
+func (c *Client) get(endpoint string, query url.Values, v interface{}) error {
+	body, err := c.open(endpoint, query)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err = json.NewDecoder(body).Decode(v); err != nil {
+		return errors.Wrap(err, "json.Decoder.Decode "+endpoint)
+	}
+	return nil
+}
+
+// open requests the endpoint (relative to the API) with the query, and returns the body of its
+// response, which must be closed by the caller.
+func (c *Client) open(endpoint string, query url.Values) (io.ReadCloser, error) {
+	u := c.baseURL.ResolveReference(&url.URL{Path: apiPath + endpoint})
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "http.NewRequest")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "http.Client.Do")
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		message, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorLength))
+		return nil, &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return res.Body, nil
+}
+
+// infoHashPath returns the path of the endpoint of the torrent of the infohash.
+func infoHashPath(infoHash []byte, endpoint string) (string, error) {
+	if len(infoHash) != 20 {
+		return "", fmt.Errorf("infohash must be 20 bytes long (not %d)", len(infoHash))
+	}
+	path := "torrents/" + hex.EncodeToString(infoHash)
+	if endpoint != "" {
+		path += "/" + endpoint
+	}
+	return path, nil
+}
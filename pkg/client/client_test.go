@@ -0,0 +1,103 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+var testInfoHash = []byte("\xc0\xff\xee\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f\x10")
+
+// newTestServer returns a server that serves the torrent of testInfoHash under /magnetico/ to
+// magnetico:secret only.
+func newTestServer(t *testing.T) *httptest.Server {
+	torrent := &persistence.TorrentMetadata{
+		ID:           1,
+		InfoHash:     testInfoHash,
+		Name:         "Torrent",
+		DiscoveredOn: time.Unix(1600000000, 0).UTC(),
+		Moderation:   persistence.Verified,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/magnetico/api/v0.1/torrents/c0ffee000102030405060708090a0b0c0d0e0f10",
+		func(w http.ResponseWriter, r *http.Request) {
+			if username, password, _ := r.BasicAuth(); username != "magnetico" || password != "secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(torrent)
+		})
+	mux.HandleFunc("/magnetico/api/v0.1/dashboard", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "couldn't get dashboard: database is locked", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/", http.NotFound)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTorrent(t *testing.T) {
+	server := newTestServer(t)
+	c, err := New(server.URL + "/magnetico")
+	if err != nil {
+		t.Fatalf("Could not create the client: %s", err.Error())
+	}
+	c.Username, c.Password = "magnetico", "secret"
+
+	torrent, err := c.Torrent(testInfoHash)
+	if err != nil {
+		t.Fatalf("Could not get the torrent: %s", err.Error())
+	}
+	if torrent == nil || torrent.Name != "Torrent" || torrent.Moderation != persistence.Verified ||
+		string(torrent.InfoHash) != string(testInfoHash) {
+		t.Errorf("Torrent is wrong! Got %+v", torrent)
+	}
+
+	if torrent, err = c.Torrent(make([]byte, 20)); err != nil || torrent != nil {
+		t.Errorf("Unknown torrent should be nil! Got %+v (error %v)", torrent, err)
+	}
+
+	if _, err = c.Torrent([]byte("short")); err == nil {
+		t.Error("Malformed infohash should be refused!")
+	}
+
+	c.Password = "wrong"
+	if _, err = c.Torrent(testInfoHash); err == nil {
+		t.Error("Wrong credentials should fail!")
+	} else if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusUnauthorized || e.Message != "unauthorized" {
+		t.Errorf("Error is wrong! Got %#v", err)
+	}
+}
+
+func TestError(t *testing.T) {
+	server := newTestServer(t)
+	c, err := New(server.URL + "/magnetico/")
+	if err != nil {
+		t.Fatalf("Could not create the client: %s", err.Error())
+	}
+
+	_, err = c.Dashboard(time.Time{})
+	if err == nil {
+		t.Fatal("Dashboard should fail!")
+	}
+	if expected := "magneticow responded with 500: couldn't get dashboard: database is locked"; err.Error() != expected {
+		t.Errorf("Error is wrong! Got `%s` (expected `%s`)", err.Error(), expected)
+	}
+	if IsNotFound(err) {
+		t.Error("Error should not be of a resource that is not found!")
+	}
+}
+
+func TestNew(t *testing.T) {
+	for i, rawURL := range []string{"ftp://example.com", "example.com", "http://[::1"} {
+		if _, err := New(rawURL); err == nil {
+			t.Errorf("URL of the instance #%d should be refused! Got `%s`", i+1, rawURL)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// OrderBy is the criterion that the results of the searches are ordered by.
+type OrderBy string
+
+const (
+	ByRelevance    OrderBy = "RELEVANCE"
+	ByTotalSize    OrderBy = "TOTAL_SIZE"
+	ByDiscoveredOn OrderBy = "DISCOVERED_ON"
+	ByNFiles       OrderBy = "N_FILES"
+	BySpamScore    OrderBy = "SPAM_SCORE"
+	ByPopularity   OrderBy = "POPULARITY"
+)
+
+// Query is a search of the torrents, whose zero values are left to the defaults of the instance.
+type Query struct {
+	// Query is the search query (or an infohash, or a magnet link, to look its torrent up), all the
+	// torrents if empty.
+	Query string
+	// Epoch is the time as of which the torrents are searched, so that the pages of the results are
+	// consistent whilst new torrents are discovered; now if zero.
+	Epoch time.Time
+	// OrderBy is ByRelevance if there is a query, ByDiscoveredOn otherwise, if empty.
+	OrderBy   OrderBy
+	Ascending *bool
+	// Limit is the number of the torrents of a page.
+	Limit uint
+	// Fields are the names of the fields (as in the JSON of persistence.TorrentMetadata) to be
+	// returned, all of them if empty.
+	Fields []string
+	// Facets requests the facet counts of the search along with its first page.
+	Facets bool
+
+	MaxSpamScore   *float64
+	IncludeFlagged bool
+	OnlyVerified   bool
+	// Since and Until bound the discovery time of the torrents, where Until is exclusive.
+	Since, Until time.Time
+	// Refine are the queries to refine the search with.
+	Refine []string
+	// Path is the substring that any of the paths of the files of the torrents must contain.
+	Path string
+	// Resolution, Codec, Group, Year, Season, and Episode are the attributes of the releases that
+	// the names of the torrents must be of (see persistence.ParseRelease).
+	Resolution, Codec, Group string
+	Year, Season, Episode    *int
+	// Artist and Album are of the albums that the audio torrents must be of (see
+	// persistence.ParseAlbum).
+	Artist, Album string
+}
+
+// Page is a page of the results of a search.
+type Page struct {
+	Torrents []persistence.TorrentMetadata `json:"torrents"`
+	// DidYouMean are the spelling corrections of the query, if it has no results.
+	DidYouMean []string `json:"didYouMean,omitempty"`
+	// Facets are returned on the first page only, if requested.
+	Facets *persistence.Facets `json:"facets,omitempty"`
+	// UnknownInfoHash is the infohash that is looked up, if its torrent is not discovered (yet).
+	UnknownInfoHash string `json:"unknownInfoHash,omitempty"`
+}
+
+// Search returns the first page of the results of the search. See Pages to get the rest of them.
+func (c *Client) Search(q Query) (*Page, error) {
+	return c.search(q, nil)
+}
+
+func (c *Client) search(q Query, after *cursor) (*Page, error) {
+	page := new(Page)
+	if err := c.get("torrents", q.values(after), page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Pager pages through the results of a search, using the keyset cursor as the web interface does.
+type Pager struct {
+	client    *Client
+	query     Query
+	after     *cursor
+	exhausted bool
+}
+
+// cursor is the last torrent of the previous page, which the next page starts after.
+type cursor struct {
+	orderedValue float64
+	id           uint64
+}
+
+// Pages returns the pager of the results of the search, whose epoch is fixed at now (unless
+// supplied) so that the pages are consistent.
+func (c *Client) Pages(q Query) *Pager {
+	if q.Epoch.IsZero() {
+		q.Epoch = time.Now()
+	}
+	return &Pager{client: c, query: q}
+}
+
+// Next returns the next page of the results, or nil once they are exhausted.
+func (p *Pager) Next() (*Page, error) {
+	if p.exhausted {
+		return nil, nil
+	}
+
+	page, err := p.client.search(p.query, p.after)
+	if err != nil {
+		return nil, err
+	}
+	n := uint(len(page.Torrents))
+	if n == 0 {
+		p.exhausted = true
+		return nil, nil
+	}
+	// A short page is the last one, which saves a request if the limit is known.
+	p.exhausted = p.query.Limit != 0 && n < p.query.Limit
+
+	last := page.Torrents[n-1]
+	p.after = &cursor{orderedValue: orderedValue(last, p.query.orderBy()), id: last.ID}
+	return page, nil
+}
+
+// Stream calls f with every result of the search in order, until they are exhausted or f returns
+// an error, which is returned as it is.
+func (c *Client) Stream(q Query, f func(torrent persistence.TorrentMetadata) error) error {
+	pager := c.Pages(q)
+	for {
+		page, err := pager.Next()
+		if err != nil {
+			return err
+		} else if page == nil {
+			return nil
+		}
+
+		for _, torrent := range page.Torrents {
+			if err = f(torrent); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// orderBy returns the criterion that the results are ordered by, as the instance determines it.
+func (q Query) orderBy() OrderBy {
+	if q.OrderBy != "" {
+		return q.OrderBy
+	} else if q.Query != "" {
+		return ByRelevance
+	}
+	return ByDiscoveredOn
+}
+
+// orderedValue returns the value of the torrent that it is ordered by, to be supplied as the
+// lastOrderedValue of the next page.
+func orderedValue(t persistence.TorrentMetadata, orderBy OrderBy) float64 {
+	switch orderBy {
+	case ByRelevance:
+		return t.Relevance
+	case ByTotalSize:
+		return float64(t.Size)
+	case ByNFiles:
+		return float64(t.NFiles)
+	case BySpamScore:
+		return t.SpamScore
+	case ByPopularity:
+		return float64(t.Popularity)
+	default:
+		return float64(t.DiscoveredOn.Unix())
+	}
+}
+
+// values returns the query of the URL of the search of the page after the cursor (the first one,
+// if nil).
+func (q Query) values(after *cursor) url.Values {
+	v := url.Values{}
+	v.Set("envelope", "true")
+	if q.Query != "" {
+		v.Set("query", q.Query)
+	}
+	if !q.Epoch.IsZero() {
+		v.Set("epoch", strconv.FormatInt(q.Epoch.Unix(), 10))
+	}
+	if q.OrderBy != "" {
+		v.Set("orderBy", string(q.OrderBy))
+	}
+	if q.Ascending != nil {
+		v.Set("ascending", strconv.FormatBool(*q.Ascending))
+	}
+	if q.Limit != 0 {
+		v.Set("limit", strconv.FormatUint(uint64(q.Limit), 10))
+	}
+	if len(q.Fields) != 0 {
+		v.Set("fields", strings.Join(q.Fields, ","))
+	}
+	if q.Facets {
+		v.Set("facets", "true")
+	}
+	if after != nil {
+		v.Set("lastOrderedValue", strconv.FormatFloat(after.orderedValue, 'g', -1, 64))
+		v.Set("lastID", strconv.FormatUint(after.id, 10))
+	}
+
+	if q.MaxSpamScore != nil {
+		v.Set("maxSpamScore", strconv.FormatFloat(*q.MaxSpamScore, 'g', -1, 64))
+	}
+	if q.IncludeFlagged {
+		v.Set("includeFlagged", "true")
+	}
+	if q.OnlyVerified {
+		v.Set("onlyVerified", "true")
+	}
+	if !q.Since.IsZero() {
+		v.Set("since", strconv.FormatInt(q.Since.Unix(), 10))
+	}
+	if !q.Until.IsZero() {
+		v.Set("until", strconv.FormatInt(q.Until.Unix(), 10))
+	}
+	for _, refinement := range q.Refine {
+		v.Add("refine", refinement)
+	}
+	for name, value := range map[string]string{
+		"path":       q.Path,
+		"resolution": q.Resolution,
+		"codec":      q.Codec,
+		"group":      q.Group,
+		"artist":     q.Artist,
+		"album":      q.Album,
+	} {
+		if value != "" {
+			v.Set(name, value)
+		}
+	}
+	for name, value := range map[string]*int{"year": q.Year, "season": q.Season, "episode": q.Episode} {
+		if value != nil {
+			v.Set(name, strconv.Itoa(*value))
+		}
+	}
+	return v
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+func TestQueryValues(t *testing.T) {
+	ascending, year := false, 2021
+	scenarios := []struct {
+		query  Query
+		after  *cursor
+		expect string
+	}{
+		{Query{}, nil, "envelope=true"},
+		{
+			Query{Query: "ubuntu iso", OrderBy: ByTotalSize, Ascending: &ascending, Limit: 50},
+			&cursor{orderedValue: 1.5e9, id: 42},
+			"ascending=false&envelope=true&lastID=42&lastOrderedValue=1.5e%2B09&limit=50&orderBy=TOTAL_SIZE&query=ubuntu+iso",
+		},
+		{
+			Query{Epoch: time.Unix(1600000000, 0), Since: time.Unix(1500000000, 0), Year: &year,
+				Refine: []string{"a", "b"}, Fields: []string{"size", "nFiles"}, Resolution: "1080p"},
+			nil,
+			"envelope=true&epoch=1600000000&fields=size%2CnFiles&refine=a&refine=b&resolution=1080p&since=1500000000&year=2021",
+		},
+	}
+
+	for i, s := range scenarios {
+		if got := s.query.values(s.after).Encode(); got != s.expect {
+			t.Errorf("Query of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, got, s.expect)
+		}
+	}
+}
+
+// TestStream pages through 7 torrents that are discovered one per second, the most recent first,
+// three at a time.
+func TestStream(t *testing.T) {
+	var torrents []persistence.TorrentMetadata
+	for i := 1; i <= 7; i++ {
+		torrents = append(torrents, persistence.TorrentMetadata{
+			ID:           uint64(i),
+			InfoHash:     testInfoHash,
+			DiscoveredOn: time.Unix(1600000000-int64(i), 0).UTC(),
+		})
+	}
+
+	var nRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nRequests++
+		q := r.URL.Query()
+		if q.Get("epoch") == "" {
+			http.Error(w, "the epoch should be fixed", http.StatusBadRequest)
+			return
+		}
+
+		var page Page
+		for _, torrent := range torrents {
+			if lastOrderedValue, err := strconv.ParseFloat(q.Get("lastOrderedValue"), 64); err == nil &&
+				lastOrderedValue <= float64(torrent.DiscoveredOn.Unix()) {
+				continue
+			}
+			if len(page.Torrents) < 3 {
+				page.Torrents = append(page.Torrents, torrent)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatalf("Could not create the client: %s", err.Error())
+	}
+
+	var ids []uint64
+	ascending := false
+	err = c.Stream(Query{Ascending: &ascending, Limit: 3}, func(torrent persistence.TorrentMetadata) error {
+		ids = append(ids, torrent.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Could not stream the torrents: %s", err.Error())
+	}
+	if len(ids) != 7 || ids[0] != 1 || ids[6] != 7 {
+		t.Errorf("Streamed torrents are wrong! Got %v (expected 1 to 7)", ids)
+	}
+	// The short third page is the last one.
+	if nRequests != 3 {
+		t.Errorf("Number of the requests is wrong! Got %d (expected 3)", nRequests)
+	}
+
+	// Unless the limit is known, the pages are requested until an empty one.
+	nRequests = 0
+	pager := c.Pages(Query{})
+	for {
+		page, err := pager.Next()
+		if err != nil {
+			t.Fatalf("Could not get the page: %s", err.Error())
+		} else if page == nil {
+			break
+		}
+	}
+	if nRequests != 4 {
+		t.Errorf("Number of the requests is wrong! Got %d (expected 4)", nRequests)
+	}
+
+	if _, err = c.Search(Query{}); err == nil {
+		t.Error("Search without an epoch should fail on the test server!")
+	} else if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusBadRequest {
+		t.Errorf("Error is wrong! Got %#v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// Statistics returns the statistics of the n (up to persistence.MaxStatisticsPeriods) consecutive
+// periods from the one of from on, which is in ISO 8601 (e.g. 2021-W09, see
+// persistence.ParseISO8601) in the time zone loc (UTC if nil).
+func (c *Client) Statistics(from string, n uint, loc *time.Location) (*persistence.Statistics, error) {
+	query := url.Values{}
+	query.Set("from", from)
+	query.Set("n", strconv.FormatUint(uint64(n), 10))
+	if loc != nil {
+		query.Set("tz", loc.String())
+	}
+
+	stats := new(persistence.Statistics)
+	if err := c.get("statistics", query, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Dashboard returns the summary of the torrents discovered since from (see persistence.Dashboard).
+func (c *Client) Dashboard(from time.Time) (*persistence.Dashboard, error) {
+	dashboard := new(persistence.Dashboard)
+	if err := c.get("dashboard", fromQuery(from), dashboard); err != nil {
+		return nil, err
+	}
+	return dashboard, nil
+}
+
+// CrawlerStats returns the hourly statistics of the crawlers since from, the earliest first, which
+// are empty if the database of the instance does not support them.
+func (c *Client) CrawlerStats(from time.Time) ([]persistence.CrawlerStats, error) {
+	var stats []persistence.CrawlerStats
+	if err := c.get("crawlerStats", fromQuery(from), &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// fromQuery returns the query of from, which is left to the default of the instance (a day ago) if
+// zero.
+func fromQuery(from time.Time) url.Values {
+	query := url.Values{}
+	if !from.IsZero() {
+		query.Set("from", strconv.FormatInt(from.Unix(), 10))
+	}
+	return query
+}
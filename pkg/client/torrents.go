@@ -0,0 +1,89 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// Torrent returns the torrent of the infohash, or nil if it is not discovered (yet).
+func (c *Client) Torrent(infoHash []byte) (*persistence.TorrentMetadata, error) {
+	path, err := infoHashPath(infoHash, "")
+	if err != nil {
+		return nil, err
+	}
+
+	torrent := new(persistence.TorrentMetadata)
+	if err = c.get(path, nil, torrent); IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return torrent, nil
+}
+
+// Files returns all the files of the torrent of the infohash, or nil if it is not discovered (yet).
+func (c *Client) Files(infoHash []byte) ([]persistence.File, error) {
+	path, err := infoHashPath(infoHash, "filelist")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []persistence.File
+	if err = c.get(path, nil, &files); IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if files == nil {
+		files = make([]persistence.File, 0)
+	}
+	return files, nil
+}
+
+// FileTree returns the files of the torrent of the infohash as a tree of directories, or nil if it
+// is not discovered (yet).
+func (c *Client) FileTree(infoHash []byte) (*persistence.FileTreeNode, error) {
+	path, err := infoHashPath(infoHash, "filetree")
+	if err != nil {
+		return nil, err
+	}
+
+	tree := new(persistence.FileTreeNode)
+	if err = c.get(path, nil, tree); IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// Recent returns the limit (up to persistence.MaxRecentTorrents) most recently discovered torrents,
+// the most recent first.
+func (c *Client) Recent(limit uint) ([]persistence.TorrentMetadata, error) {
+	var torrents []persistence.TorrentMetadata
+	if err := c.get("torrents/recent", limitQuery(limit), &torrents); err != nil {
+		return nil, err
+	}
+	return torrents, nil
+}
+
+// Trending returns the limit (up to persistence.MaxTrendingTorrents) trending torrents, along with
+// the number of the times that they are seen recently (as Sightings).
+func (c *Client) Trending(limit uint) ([]persistence.TorrentMetadata, error) {
+	var torrents []persistence.TorrentMetadata
+	if err := c.get("torrents/trending", limitQuery(limit), &torrents); err != nil {
+		return nil, err
+	}
+	return torrents, nil
+}
+
+// limitQuery returns the query of the limit, which is left to the default of the instance if zero.
+func limitQuery(limit uint) url.Values {
+	query := url.Values{}
+	if limit != 0 {
+		query.Set("limit", strconv.FormatUint(uint64(limit), 10))
+	}
+	return query
+}
@@ -0,0 +1,102 @@
+package dump
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Destination is where the dumps of the scheduled exports (see ScheduledExport) are stored.
+type Destination interface {
+	// Put stores the dump of the given name, whose size bytes are read from r (which can be read
+	// more than once by seeking back to the start).
+	Put(name string, r io.ReadSeeker, size int64) error
+}
+
+// ParseDestination parses the destination from its URL:
+//
+//   - the path of a directory (or a file:// URL), into which the dumps are written;
+//   - an http:// or https:// URL, to which the dumps are PUT (as <URL>/<NAME>);
+//   - an s3://<BUCKET>/<PREFIX> URL, into which the dumps are uploaded (see s3Destination).
+func ParseDestination(rawURL string) (Destination, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "url.Parse")
+	}
+
+	switch u.Scheme {
+	case "", "file":
+		path := rawURL
+		if u.Scheme == "file" {
+			path = u.Path
+		}
+		return &directoryDestination{path: path}, nil
+	case "http", "https":
+		return &httpDestination{url: strings.TrimSuffix(rawURL, "/"), client: http.DefaultClient}, nil
+	case "s3":
+		return newS3Destination(u)
+	default:
+		return nil, fmt.Errorf("unknown scheme of the destination: %s", u.Scheme)
+	}
+}
+
+type directoryDestination struct {
+	path string
+}
+
+func (d *directoryDestination) Put(name string, r io.ReadSeeker, size int64) error {
+	// The dump is written to a temporary file first, lest the consumers read it half-written.
+	tmp, err := ioutil.TempFile(d.path, "."+name+".*")
+	if err != nil {
+		return errors.Wrap(err, "ioutil.TempFile")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "io.Copy")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "os.File.Close")
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return errors.Wrap(err, "os.Chmod")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), filepath.Join(d.path, name)), "os.Rename")
+}
+
+type httpDestination struct {
+	url    string
+	client *http.Client
+}
+
+func (d *httpDestination) Put(name string, r io.ReadSeeker, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, d.url+"/"+url.PathEscape(name), ioutil.NopCloser(r))
+	if err != nil {
+		return errors.Wrap(err, "http.NewRequest")
+	}
+	req.ContentLength = size
+	return do(d.client, req)
+}
+
+// do sends the request, and returns an error unless it is responded with a 2xx status.
+func do(client *http.Client, req *http.Request) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "http.Client.Do")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s %s responded %s: %s", req.Method, req.URL.Redacted(), res.Status, body)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package dump
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPDestination(t *testing.T) {
+	var gotPath, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		gotPath, gotBody = r.Method+" "+r.URL.Path, string(body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	destination, err := ParseDestination(server.URL + "/dumps/")
+	if err != nil {
+		t.Fatalf("Could not parse the destination: %s", err.Error())
+	}
+	if err = destination.Put("magnetico.csv", strings.NewReader("dump"), 4); err != nil {
+		t.Fatalf("Could not put the dump: %s", err.Error())
+	}
+	if gotPath != "PUT /dumps/magnetico.csv" || gotBody != "dump" {
+		t.Errorf("Request is wrong! Got `%s` with `%s`", gotPath, gotBody)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer failing.Close()
+	if destination, err = ParseDestination(failing.URL); err != nil {
+		t.Fatalf("Could not parse the destination: %s", err.Error())
+	}
+	if err = destination.Put("magnetico.csv", strings.NewReader("dump"), 4); err == nil {
+		t.Errorf("Put to a failing destination did not return an error!")
+	}
+}
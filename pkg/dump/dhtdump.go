@@ -0,0 +1,87 @@
+package dump
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// maxDHTDumpLine is the maximum length of a line of the DHT dumps, as the torrents with many files
+// are long.
+const maxDHTDumpLine = 64 << 20
+
+type dhtDumpRecord struct {
+	InfoHash     string             `json:"infohash"`
+	Name         string             `json:"name"`
+	Size         uint64             `json:"size"`
+	DiscoveredOn int64              `json:"discovered_on"`
+	Files        []persistence.File `json:"files,omitempty"`
+}
+
+type dhtDumpWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newDHTDumpWriter(w io.Writer) *dhtDumpWriter {
+	bw := bufio.NewWriter(w)
+	return &dhtDumpWriter{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (dw *dhtDumpWriter) Write(t Torrent) error {
+	// Encode terminates each record with a newline.
+	return dw.enc.Encode(dhtDumpRecord{
+		InfoHash:     hex.EncodeToString(t.InfoHash),
+		Name:         t.Name,
+		Size:         t.Size,
+		DiscoveredOn: t.DiscoveredOn.Unix(),
+		Files:        t.Files,
+	})
+}
+
+func (dw *dhtDumpWriter) Flush() error {
+	return dw.w.Flush()
+}
+
+type dhtDumpReader struct {
+	s *bufio.Scanner
+}
+
+func newDHTDumpReader(r io.Reader) *dhtDumpReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxDHTDumpLine)
+	return &dhtDumpReader{s: s}
+}
+
+func (dr *dhtDumpReader) Read() (Torrent, error) {
+	var line []byte
+	for len(line) == 0 {
+		if !dr.s.Scan() {
+			if err := dr.s.Err(); err != nil {
+				return Torrent{}, err
+			}
+			return Torrent{}, io.EOF
+		}
+		line = dr.s.Bytes()
+	}
+
+	var record dhtDumpRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return Torrent{}, invalidRecord{err}
+	}
+	infoHash, err := hex.DecodeString(record.InfoHash)
+	if err != nil {
+		return Torrent{}, invalidRecord{err}
+	}
+	return Torrent{
+		InfoHash:     infoHash,
+		Name:         record.Name,
+		Size:         record.Size,
+		DiscoveredOn: time.Unix(record.DiscoveredOn, 0).UTC(),
+		Files:        record.Files,
+	}, nil
+}
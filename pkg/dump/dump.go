@@ -0,0 +1,231 @@
+// Package dump exports the torrents of the databases in the interchange formats of the community
+// (see Format), and imports the dumps in those formats into the databases, so that the databases
+// of magnetico can contribute to, and be bootstrapped from, the public datasets.
+package dump
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// Format is an interchange format of the torrents.
+type Format string
+
+const (
+	// TorrentsCSV is the format of torrents-csv: semicolon-separated values with a header, of the
+	// infohash (in hex), the name, the size (in bytes), the creation time (in Unix time), and the
+	// numbers of the seeders, the leechers, and the downloads (and the time they are scraped on),
+	// which are exported as zero as they are not tracked by magnetico. The files are not carried.
+	TorrentsCSV Format = "torrents-csv"
+	// DHTDump is the format of the DHT dumps: JSON lines of the infohash (in hex), the name, the size
+	// (in bytes), the discovery time (in Unix time), and the files (see dhtDumpRecord).
+	DHTDump Format = "dht-dump"
+)
+
+// ParseFormat parses the Format from its name.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case TorrentsCSV, DHTDump:
+		return Format(s), nil
+	default:
+		return "", fmt.Errorf("unknown format: %s (expected %s or %s)", s, TorrentsCSV, DHTDump)
+	}
+}
+
+// Torrent is a torrent as it is carried by the formats.
+type Torrent struct {
+	InfoHash     []byte
+	Name         string
+	Size         uint64
+	DiscoveredOn time.Time
+	// Files is nil if the format does not carry the files (e.g. TorrentsCSV).
+	Files []persistence.File
+}
+
+type writer interface {
+	Write(t Torrent) error
+	// Flush writes the buffered torrents, and returns the first error of the writes, if any.
+	Flush() error
+}
+
+// reader reads the torrents one by one, returning io.EOF at the end of the dump, or an
+// invalidRecord if a record cannot be read (after which the next one can be read still).
+type reader interface {
+	Read() (Torrent, error)
+}
+
+type invalidRecord struct {
+	err error
+}
+
+func (ir invalidRecord) Error() string {
+	return "invalid record: " + ir.err.Error()
+}
+
+func newWriter(w io.Writer, format Format) (writer, error) {
+	switch format {
+	case TorrentsCSV:
+		return newTorrentsCSVWriter(w)
+	case DHTDump:
+		return newDHTDumpWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func newReader(r io.Reader, format Format) (reader, error) {
+	switch format {
+	case TorrentsCSV:
+		return newTorrentsCSVReader(r), nil
+	case DHTDump:
+		return newDHTDumpReader(r), nil
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+// exportPageSize is the number of the torrents queried from the database at once whilst exporting.
+const exportPageSize = 1000
+
+// Cursor is the position of a torrent in the order of the exports, after which an export can be
+// continued (e.g. to export only the torrents that are discovered since the last export).
+type Cursor struct {
+	DiscoveredOn int64  `json:"discoveredOn"` // in Unix time
+	ID           uint64 `json:"id"`
+}
+
+// Export writes the torrents that are not flagged to w in the format, the least recently discovered
+// first, after the cursor (if not nil). Returns the number of the torrents exported and the cursor
+// of the last one, which is the given cursor if none is exported.
+func Export(database persistence.Database, w io.Writer, format Format, after *Cursor) (uint, *Cursor, error) {
+	dw, err := newWriter(w, format)
+	if err != nil {
+		return 0, after, err
+	}
+
+	var lastOrderedValue *float64
+	var lastID *uint64
+	if after != nil {
+		lastOrderedValue, lastID = new(float64), new(uint64)
+		*lastOrderedValue, *lastID = float64(after.DiscoveredOn), after.ID
+	}
+
+	// The torrents that are discovered whilst exporting are left to the next export.
+	epoch := time.Now().Unix()
+	var n uint
+	for {
+		torrents, err := database.QueryTorrents("", epoch, persistence.ByDiscoveredOn, true, exportPageSize,
+			lastOrderedValue, lastID, persistence.QueryFilters{}, persistence.FieldSize|persistence.FieldDiscoveredOn)
+		if err != nil {
+			return n, after, errors.Wrap(err, "QueryTorrents")
+		}
+
+		for _, t := range torrents {
+			torrent := Torrent{InfoHash: t.InfoHash, Name: t.Name, Size: t.Size, DiscoveredOn: t.DiscoveredOn}
+			if format == DHTDump {
+				if torrent.Files, err = database.GetFiles(t.InfoHash); err != nil {
+					return n, after, errors.Wrap(err, "GetFiles")
+				}
+			}
+			if err = dw.Write(torrent); err != nil {
+				return n, after, errors.Wrap(err, "Write")
+			}
+			n++
+			after = &Cursor{DiscoveredOn: t.DiscoveredOn.Unix(), ID: t.ID}
+		}
+
+		if len(torrents) < exportPageSize {
+			break
+		}
+		lastOrderedValue, lastID = new(float64), new(uint64)
+		*lastOrderedValue, *lastID = float64(after.DiscoveredOn), after.ID
+	}
+
+	if err = dw.Flush(); err != nil {
+		return n, after, errors.Wrap(err, "Flush")
+	}
+	return n, after, nil
+}
+
+// ImportStatistics are the statistics of an import.
+type ImportStatistics struct {
+	NRecords uint
+	// NInvalid is the number of the records that cannot be read, or whose torrents are not valid.
+	NInvalid uint
+	// NExisting is the number of the torrents that are in the database already, which are skipped.
+	NExisting uint
+	NAdded    uint
+}
+
+// Import adds the torrents of the dump in the format to the database (as of persistence.SourceImport),
+// unless they are in the database already. The invalid records are skipped. Since the metadata of
+// the torrents are not carried by the formats, they are empty; the torrents whose files are not
+// carried either are added with a single file named after the torrent. The statistics are returned
+// even if the import fails halfway.
+func Import(database persistence.Database, r io.Reader, format Format) (*ImportStatistics, error) {
+	stats := new(ImportStatistics)
+	dr, err := newReader(r, format)
+	if err != nil {
+		return stats, err
+	}
+
+	for {
+		torrent, err := dr.Read()
+		if err == io.EOF {
+			return stats, nil
+		}
+		stats.NRecords++
+		if _, ok := err.(invalidRecord); ok {
+			stats.NInvalid++
+			continue
+		} else if err != nil {
+			return stats, errors.Wrap(err, "Read")
+		}
+		if err = validate(&torrent); err != nil {
+			stats.NInvalid++
+			continue
+		}
+
+		exists, err := database.DoesTorrentExist(torrent.InfoHash)
+		if err != nil {
+			return stats, errors.Wrap(err, "DoesTorrentExist")
+		} else if exists {
+			stats.NExisting++
+			continue
+		}
+		if err = database.AddNewTorrent(torrent.InfoHash, torrent.Name, torrent.Files, []byte{},
+			persistence.SourceImport); err != nil {
+			return stats, errors.Wrap(err, "AddNewTorrent")
+		}
+		stats.NAdded++
+	}
+}
+
+// validate returns an error if the torrent is not valid, else populates its files with a single
+// file (named after the torrent) if they are not carried by the format.
+func validate(t *Torrent) error {
+	if len(t.InfoHash) != 20 {
+		return fmt.Errorf("infohash is %d bytes long (expected 20)", len(t.InfoHash))
+	}
+	if t.Name == "" || !utf8.ValidString(t.Name) {
+		return fmt.Errorf("name is empty or not valid UTF-8")
+	}
+	if t.Files == nil {
+		t.Files = []persistence.File{{Size: int64(t.Size), Path: t.Name}}
+	}
+	if len(t.Files) == 0 {
+		return fmt.Errorf("torrent has no files")
+	}
+	for _, file := range t.Files {
+		if file.Size < 0 || file.Path == "" || !utf8.ValidString(file.Path) {
+			return fmt.Errorf("file is not valid")
+		}
+	}
+	return nil
+}
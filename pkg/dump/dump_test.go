@@ -0,0 +1,86 @@
+//go:build fts5
+// +build fts5
+
+package dump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+func openDatabase(t *testing.T) persistence.Database {
+	dir, err := ioutil.TempDir("", "magnetico-dump")
+	if err != nil {
+		t.Fatalf("Could not create the temporary directory: %s", err.Error())
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	db, err := persistence.MakeDatabase("sqlite3://"+path.Join(dir, "database.sqlite3"), nil)
+	if err != nil {
+		t.Fatalf("Could not open the database: %s", err.Error())
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{TorrentsCSV, DHTDump} {
+		t.Run(string(format), func(t *testing.T) {
+			source := openDatabase(t)
+			for i, name := range []string{"Ubuntu; 20.04", "Debian \"bullseye\"", "Arch\nLinux"} {
+				infoHash := bytes.Repeat([]byte{byte(i + 1)}, 20)
+				files := []persistence.File{{Size: 100, Path: "a.iso"}, {Size: int64(i), Path: "dir/b.txt"}}
+				if err := source.AddNewTorrent(infoHash, name, files, []byte("d"), persistence.SourceAnnounce); err != nil {
+					t.Fatalf("Could not add the torrent: %s", err.Error())
+				}
+			}
+
+			var buf bytes.Buffer
+			n, cursor, err := Export(source, &buf, format, nil)
+			if err != nil {
+				t.Fatalf("Could not export: %s", err.Error())
+			}
+			if n != 3 || cursor == nil || cursor.ID != 3 {
+				t.Fatalf("Export is wrong! Got %d torrents up to %+v (expected 3 up to the ID 3)", n, cursor)
+			}
+			// Nothing is left to export after the cursor.
+			if n, next, err := Export(source, ioutil.Discard, format, cursor); err != nil || n != 0 || *next != *cursor {
+				t.Errorf("Export after the cursor is wrong! Got %d torrents up to %+v (error: %v)", n, next, err)
+			}
+
+			target := openDatabase(t)
+			// The first torrent is in the target database already.
+			if err := target.AddNewTorrent(bytes.Repeat([]byte{1}, 20), "existing",
+				[]persistence.File{{Size: 1, Path: "x"}}, []byte("d"), persistence.SourceAnnounce); err != nil {
+				t.Fatalf("Could not add the torrent: %s", err.Error())
+			}
+			stats, err := Import(target, strings.NewReader(buf.String()), format)
+			if err != nil {
+				t.Fatalf("Could not import: %s", err.Error())
+			}
+			expected := ImportStatistics{NRecords: 3, NExisting: 1, NAdded: 2}
+			if *stats != expected {
+				t.Errorf("Statistics of the import are wrong! Got %+v (expected %+v)", *stats, expected)
+			}
+
+			torrent, err := target.GetTorrent(bytes.Repeat([]byte{3}, 20))
+			if err != nil || torrent == nil {
+				t.Fatalf("Could not get the imported torrent: %v", err)
+			}
+			if torrent.Name != "Arch\nLinux" || torrent.Size != 102 || torrent.Source != persistence.SourceImport {
+				t.Errorf("Imported torrent is wrong! Got %+v", *torrent)
+			}
+			nFiles := map[Format]uint{TorrentsCSV: 1, DHTDump: 2}[format]
+			if torrent.NFiles != nFiles {
+				t.Errorf("Number of the files of the imported torrent is wrong! Got %d (expected %d)",
+					torrent.NFiles, nFiles)
+			}
+		})
+	}
+}
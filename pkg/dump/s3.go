@@ -0,0 +1,156 @@
+package dump
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// s3Destination uploads the dumps to a bucket of S3 (or of a service compatible with S3, such as
+// MinIO), as s3://<BUCKET>/<PREFIX>?region=<REGION>&endpoint=<ENDPOINT> where the region defaults
+// to $AWS_REGION (or us-east-1), and the endpoint to the one of the region on AWS. The credentials
+// are read from $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY (and $AWS_SESSION_TOKEN, if any).
+//
+// The objects are addressed by path (i.e. <ENDPOINT>/<BUCKET>/<PREFIX><NAME>), and the requests are
+// signed using Signature Version 4.
+type s3Destination struct {
+	endpoint string
+	bucket   string
+	prefix   string
+	region   string
+
+	accessKey    string
+	secretKey    string
+	sessionToken string
+
+	client *http.Client
+}
+
+func newS3Destination(u *url.URL) (*s3Destination, error) {
+	d := &s3Destination{
+		bucket:       u.Host,
+		prefix:       strings.TrimPrefix(u.Path, "/"),
+		region:       u.Query().Get("region"),
+		endpoint:     strings.TrimSuffix(u.Query().Get("endpoint"), "/"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       http.DefaultClient,
+	}
+	if d.bucket == "" {
+		return nil, fmt.Errorf("the bucket of the destination is missing")
+	}
+	if d.accessKey == "" || d.secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set for the S3 destinations")
+	}
+	if d.region == "" {
+		if d.region = os.Getenv("AWS_REGION"); d.region == "" {
+			d.region = "us-east-1"
+		}
+	}
+	if d.endpoint == "" {
+		d.endpoint = "https://s3." + d.region + ".amazonaws.com"
+	}
+	return d, nil
+}
+
+func (d *s3Destination) Put(name string, r io.ReadSeeker, size int64) error {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return errors.Wrap(err, "io.Copy")
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "io.Seeker.Seek")
+	}
+
+	req, err := http.NewRequest(http.MethodPut, d.endpoint+s3EscapePath("/"+d.bucket+"/"+d.prefix+name),
+		ioutil.NopCloser(r))
+	if err != nil {
+		return errors.Wrap(err, "http.NewRequest")
+	}
+	req.ContentLength = size
+	if d.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", d.sessionToken)
+	}
+	signV4(req, hex.EncodeToString(hash.Sum(nil)), d.accessKey, d.secretKey, d.region, time.Now())
+	return do(d.client, req)
+}
+
+// signV4 signs the request for S3 using Signature Version 4, along with all of its headers.
+func signV4(req *http.Request, payloadHash string, accessKey string, secretKey string, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var canonicalHeaders strings.Builder
+	for _, key := range keys {
+		canonicalHeaders.WriteString(key + ":" + headers[key] + "\n")
+	}
+	signedHeaders := strings.Join(keys, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath escapes the path as S3 does: every byte except the unreserved characters and the
+// slashes.
+func s3EscapePath(path string) string {
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
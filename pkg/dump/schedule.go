@@ -0,0 +1,163 @@
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// extensions are the extensions of the names of the dumps by their formats.
+var extensions = map[Format]string{
+	TorrentsCSV: ".csv",
+	DHTDump:     ".jsonl",
+}
+
+// ScheduledExport exports the torrents that are discovered since the last export (i.e. after its
+// cursor) every interval, as incremental dumps that are stored to the destination as
+// magnetico-<TIME><EXT> (e.g. magnetico-20200229T123456Z.csv). No dump is stored if no torrent is
+// discovered since the last export.
+//
+// The cursor is saved to the state file once a dump is stored, so that the exports are continued
+// across restarts; hence a dump might be stored again (rather than be skipped) if magnetico stops
+// in between.
+type ScheduledExport struct {
+	database    persistence.Database
+	destination Destination
+	format      Format
+	interval    time.Duration
+	statePath   string
+
+	termination chan interface{}
+	terminated  chan interface{}
+}
+
+func NewScheduledExport(database persistence.Database, destination Destination, format Format,
+	interval time.Duration, statePath string) *ScheduledExport {
+	return &ScheduledExport{
+		database:    database,
+		destination: destination,
+		format:      format,
+		interval:    interval,
+		statePath:   statePath,
+		termination: make(chan interface{}),
+		terminated:  make(chan interface{}),
+	}
+}
+
+// Run exports the torrents every interval (starting right away) until Terminate is called.
+func (se *ScheduledExport) Run() {
+	defer close(se.terminated)
+
+	ticker := time.NewTicker(se.interval)
+	defer ticker.Stop()
+
+	now := time.Now()
+	for {
+		if err := se.Export(now); err != nil {
+			zap.L().Named("dump").Error("Could not export the torrents!", zap.Error(err))
+		}
+
+		select {
+		case now = <-ticker.C:
+		case <-se.termination:
+			return
+		}
+	}
+}
+
+// Terminate stops the exports, and returns once the ongoing one (if any) is finished.
+func (se *ScheduledExport) Terminate() {
+	close(se.termination)
+	<-se.terminated
+}
+
+// Export exports the torrents that are discovered since the last export right away, as if it is
+// the given time.
+func (se *ScheduledExport) Export(now time.Time) error {
+	cursor, err := readCursor(se.statePath)
+	if err != nil {
+		return errors.Wrap(err, "readCursor")
+	}
+
+	tmp, err := ioutil.TempFile("", "magnetico-export-*")
+	if err != nil {
+		return errors.Wrap(err, "ioutil.TempFile")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	n, next, err := Export(se.database, tmp, se.format, cursor)
+	if err != nil {
+		return errors.Wrap(err, "Export")
+	} else if n == 0 {
+		zap.L().Named("dump").Debug("No torrents to export.")
+		return nil
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "os.File.Seek")
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "os.File.Seek")
+	}
+	name := fmt.Sprintf("magnetico-%s%s", now.UTC().Format("20060102T150405Z"), extensions[se.format])
+	if err = se.destination.Put(name, tmp, size); err != nil {
+		return errors.Wrap(err, "Put")
+	}
+
+	if err = writeCursor(se.statePath, next); err != nil {
+		return errors.Wrap(err, "writeCursor")
+	}
+	zap.L().Named("dump").Info("Exported the torrents.", zap.String("name", name), zap.Uint("torrents", n))
+	return nil
+}
+
+// readCursor reads the cursor of the last export from the state file, or returns nil if there is
+// none (i.e. nothing is exported yet).
+func readCursor(path string) (*Cursor, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	cursor := new(Cursor)
+	if err = json.Unmarshal(data, cursor); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// writeCursor writes the cursor to the state file atomically.
+func writeCursor(path string, cursor *Cursor) error {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
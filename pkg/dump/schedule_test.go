@@ -0,0 +1,71 @@
+//go:build fts5
+// +build fts5
+
+package dump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+func addTorrents(t *testing.T, db persistence.Database, first byte, n int) {
+	for i := 0; i < n; i++ {
+		infoHash := bytes.Repeat([]byte{first + byte(i)}, 20)
+		if err := db.AddNewTorrent(infoHash, "torrent", []persistence.File{{Size: 1, Path: "a"}}, []byte("d"),
+			persistence.SourceAnnounce); err != nil {
+			t.Fatalf("Could not add the torrent: %s", err.Error())
+		}
+	}
+}
+
+func TestScheduledExport(t *testing.T) {
+	db := openDatabase(t)
+	dir, err := ioutil.TempDir("", "magnetico-scheduled-export")
+	if err != nil {
+		t.Fatalf("Could not create the temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	destination, err := ParseDestination(dir)
+	if err != nil {
+		t.Fatalf("Could not parse the destination: %s", err.Error())
+	}
+	se := NewScheduledExport(db, destination, TorrentsCSV, time.Hour, path.Join(dir, "state.json"))
+
+	for i, instance := range []struct {
+		nAdded    int
+		nExported int // -1 if no dump is expected
+	}{
+		{3, 3},
+		{0, -1},
+		{2, 2},
+	} {
+		addTorrents(t, db, byte(10*i+1), instance.nAdded)
+		now := time.Date(2020, 2, 29, 12, 0, i, 0, time.UTC)
+		if err := se.Export(now); err != nil {
+			t.Fatalf("Could not export of the instance #%d: %s", i+1, err.Error())
+		}
+
+		data, err := ioutil.ReadFile(path.Join(dir, "magnetico-"+now.Format("20060102T150405Z")+".csv"))
+		if instance.nExported == -1 {
+			if !os.IsNotExist(err) {
+				t.Errorf("Dump of the instance #%d is stored although nothing is exported!", i+1)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("Could not read the dump of the instance #%d: %s", i+1, err.Error())
+		}
+		// The header is followed by the torrents.
+		if nLines := strings.Count(string(data), "\n"); nLines != instance.nExported+1 {
+			t.Errorf("Number of the lines of the dump of the instance #%d is wrong! Got %d (expected %d)",
+				i+1, nLines, instance.nExported+1)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package dump
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"time"
+)
+
+var torrentsCSVHeader = []string{
+	"infohash", "name", "size_bytes", "created_unix", "seeders", "leechers", "completed", "scraped_date",
+}
+
+type torrentsCSVWriter struct {
+	w *csv.Writer
+}
+
+func newTorrentsCSVWriter(w io.Writer) (*torrentsCSVWriter, error) {
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	if err := cw.Write(torrentsCSVHeader); err != nil {
+		return nil, err
+	}
+	return &torrentsCSVWriter{w: cw}, nil
+}
+
+func (tw *torrentsCSVWriter) Write(t Torrent) error {
+	return tw.w.Write([]string{
+		hex.EncodeToString(t.InfoHash),
+		t.Name,
+		strconv.FormatUint(t.Size, 10),
+		strconv.FormatInt(t.DiscoveredOn.Unix(), 10),
+		"0", "0", "0", "0",
+	})
+}
+
+func (tw *torrentsCSVWriter) Flush() error {
+	tw.w.Flush()
+	return tw.w.Error()
+}
+
+type torrentsCSVReader struct {
+	r *csv.Reader
+}
+
+func newTorrentsCSVReader(r io.Reader) *torrentsCSVReader {
+	cr := csv.NewReader(r)
+	cr.Comma = ';'
+	// The columns of the dumps have been added over time, and only the first four are read.
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.ReuseRecord = true
+	return &torrentsCSVReader{r: cr}
+}
+
+func (tr *torrentsCSVReader) Read() (Torrent, error) {
+	record, err := tr.r.Read()
+	if err == nil && record[0] == torrentsCSVHeader[0] {
+		record, err = tr.r.Read()
+	}
+	if err == io.EOF {
+		return Torrent{}, err
+	} else if _, ok := err.(*csv.ParseError); ok {
+		return Torrent{}, invalidRecord{err}
+	} else if err != nil {
+		return Torrent{}, err
+	}
+
+	if len(record) < 4 {
+		return Torrent{}, invalidRecord{csv.ErrFieldCount}
+	}
+	infoHash, err := hex.DecodeString(record[0])
+	if err != nil {
+		return Torrent{}, invalidRecord{err}
+	}
+	size, err := strconv.ParseUint(record[2], 10, 64)
+	if err != nil {
+		return Torrent{}, invalidRecord{err}
+	}
+	createdOn, err := strconv.ParseInt(record[3], 10, 64)
+	if err != nil {
+		return Torrent{}, invalidRecord{err}
+	}
+	return Torrent{InfoHash: infoHash, Name: record[1], Size: size, DiscoveredOn: time.Unix(createdOn, 0).UTC()}, nil
+}
@@ -0,0 +1,44 @@
+package dump
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+const torrentsCSV = `infohash;name;size_bytes;created_unix;seeders;leechers;completed;scraped_date
+0123456789abcdef0123456789abcdef01234567;"Ubuntu; 20.04";2715254784;1587600000;1000;20;50000;1600000000
+not-hex;Invalid;1;1;0;0;0;0
+89abcdef0123456789abcdef0123456789abcdef;Too few columns
+fedcba9876543210fedcba9876543210fedcba98;Debian;42;1600000000
+`
+
+func TestTorrentsCSVReader(t *testing.T) {
+	r := newTorrentsCSVReader(strings.NewReader(torrentsCSV))
+
+	var names []string
+	var nInvalid int
+	for {
+		torrent, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if _, ok := err.(invalidRecord); ok {
+			nInvalid++
+			continue
+		} else if err != nil {
+			t.Fatalf("Could not read the torrents: %s", err.Error())
+		}
+		names = append(names, torrent.Name)
+
+		if torrent.Name == "Ubuntu; 20.04" && (torrent.Size != 2715254784 || torrent.DiscoveredOn.Unix() != 1587600000) {
+			t.Errorf("Torrent is read wrong! Got %+v", torrent)
+		}
+	}
+
+	if len(names) != 2 || names[0] != "Ubuntu; 20.04" || names[1] != "Debian" {
+		t.Errorf("Torrents are read wrong! Got %v", names)
+	}
+	if nInvalid != 2 {
+		t.Errorf("Number of the invalid records is wrong! Got %d (expected 2)", nInvalid)
+	}
+}
@@ -0,0 +1,195 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// The types of the data section of the MaxMind DB.
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBoolean  = 14
+	typeFloat    = 15
+)
+
+// maxDepth is the maximum depth of the nested maps and arrays, lest a malicious database overflows
+// the stack.
+const maxDepth = 32
+
+// decoder decodes the data section of the MaxMind DB into the maps (map[string]interface{}), the
+// arrays ([]interface{}), the strings, the byte slices, the unsigned integers (uint64, of which the
+// 128-bit ones are truncated), the signed integers (int32), the floats (float64), and the booleans.
+type decoder struct {
+	data []byte
+}
+
+// decode decodes the value at the offset, and returns it along with the offset of the next value.
+func (d *decoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("too deeply nested")
+	}
+	kind, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if kind == typePointer {
+		pointer, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// The value that is pointed to is not a pointer itself.
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	// The sizes of the maps and the arrays are not trusted to preallocate them, as each of their
+	// elements takes a byte at least.
+	capacity := size
+	if remaining := uint(len(d.data)) - offset; capacity > remaining {
+		capacity = remaining
+	}
+	switch kind {
+	case typeMap:
+		m := make(map[string]interface{}, capacity)
+		for i := uint(0); i < size; i++ {
+			var key, value interface{}
+			if key, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("key of a map is not a string")
+			}
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+		}
+		return m, offset, nil
+
+	case typeArray:
+		a := make([]interface{}, 0, capacity)
+		for i := uint(0); i < size; i++ {
+			var value interface{}
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+
+	case typeBoolean:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.data)) {
+		return nil, 0, fmt.Errorf("value is beyond the data section")
+	}
+	b := d.data[offset : offset+size]
+	next := offset + size
+	switch kind {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double of %d bytes", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float of %d bytes", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, next, nil
+	case typeInt32:
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int32(n), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported type %d", kind)
+	}
+}
+
+// control decodes the control byte (and the extended type and size) at the offset, and returns the
+// offset of the payload.
+func (d *decoder) control(offset uint) (kind, size, next uint, err error) {
+	if offset >= uint(len(d.data)) {
+		return 0, 0, 0, fmt.Errorf("control byte is beyond the data section")
+	}
+	c := d.data[offset]
+	offset++
+	kind = uint(c >> 5)
+	if kind == typeExtended {
+		if offset >= uint(len(d.data)) {
+			return 0, 0, 0, fmt.Errorf("extended type is beyond the data section")
+		}
+		kind = 7 + uint(d.data[offset])
+		offset++
+	}
+	size = uint(c & 0x1f)
+	if kind == typePointer || size < 29 {
+		return kind, size, offset, nil
+	}
+
+	n := size - 28 // the number of the bytes of the size
+	if offset+n > uint(len(d.data)) {
+		return 0, 0, 0, fmt.Errorf("size is beyond the data section")
+	}
+	var extra uint
+	for _, b := range d.data[offset : offset+n] {
+		extra = extra<<8 | uint(b)
+	}
+	switch size {
+	case 29:
+		size = 29 + extra
+	case 30:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+	return kind, size, offset + n, nil
+}
+
+// pointer decodes the pointer whose (5) bits of size are given, and returns the offset that it
+// points to along with the offset after it.
+func (d *decoder) pointer(size, offset uint) (pointer, next uint, err error) {
+	n := (size>>3)&0x3 + 1 // the number of the bytes of the pointer
+	if offset+n > uint(len(d.data)) {
+		return 0, 0, fmt.Errorf("pointer is beyond the data section")
+	}
+	var p uint
+	for _, b := range d.data[offset : offset+n] {
+		p = p<<8 | uint(b)
+	}
+	switch n {
+	case 1:
+		p |= (size & 0x7) << 8
+	case 2:
+		p = 2048 + ((size&0x7)<<16 | p)
+	case 3:
+		p = 526336 + ((size&0x7)<<24 | p)
+	}
+	return p, offset + n, nil
+}
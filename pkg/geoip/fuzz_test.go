@@ -0,0 +1,30 @@
+//go:build go1.18
+// +build go1.18
+
+package geoip
+
+import (
+	"net"
+	"testing"
+)
+
+// FuzzFromBytes checks that neither reading a (malformed) database nor looking the addresses up in
+// it panics.
+//
+//	go test -fuzz=FuzzFromBytes ./pkg/geoip/
+func FuzzFromBytes(f *testing.F) {
+	db := newTestDB(28, 6)
+	db.data = encodeMap("country", encodeMap("iso_code", encodeString("TR")))
+	db.insert("10.0.0.0/8", 0)
+	f.Add(db.bytes())
+
+	f.Fuzz(func(t *testing.T, buffer []byte) {
+		r, err := FromBytes(buffer)
+		if err != nil {
+			return
+		}
+		for _, ip := range []string{"10.0.0.1", "0.0.0.0", "255.255.255.255", "::1", "2001:db8::1"} {
+			_, _ = r.Country(net.ParseIP(ip))
+		}
+	})
+}
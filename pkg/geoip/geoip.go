@@ -0,0 +1,167 @@
+// Package geoip looks up the countries of the IP addresses in the MaxMind DB files (such as the
+// GeoLite2 Country and City databases), without any dependency.
+//
+// Only as much of the MaxMind DB format (https://maxmind.github.io/MaxMind-DB/) as is needed to find
+// the ISO 3166-1 codes of the countries is implemented.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// metadataMarker precedes the metadata at the end of the database.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// maxMetadataSize is how far from the end of the database the metadata are looked for.
+const maxMetadataSize = 128 * 1024
+
+// Reader looks up the countries of the IP addresses in a MaxMind DB, which is read into the memory
+// at once. It is safe for concurrent use.
+type Reader struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// ipv4Start is the node at which the IPv4 addresses start (i.e. after the 96 zero bits of
+	// ::/96) in an IPv6 tree.
+	ipv4Start uint
+}
+
+// Open reads the MaxMind DB at path.
+func Open(path string) (*Reader, error) {
+	buffer, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "ioutil.ReadFile")
+	}
+	return FromBytes(buffer)
+}
+
+// FromBytes reads the MaxMind DB in buffer, which is not to be modified afterwards.
+func FromBytes(buffer []byte) (*Reader, error) {
+	tail := buffer
+	if len(tail) > maxMetadataSize {
+		tail = tail[len(tail)-maxMetadataSize:]
+	}
+	i := bytes.LastIndex(tail, metadataMarker)
+	if i == -1 {
+		return nil, fmt.Errorf("not a MaxMind DB (no metadata)")
+	}
+	metadataStart := len(buffer) - len(tail) + i + len(metadataMarker)
+	value, _, err := (&decoder{data: buffer[metadataStart:]}).decode(0, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode metadata")
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("metadata is not a map")
+	}
+
+	r := &Reader{
+		nodeCount:  uintOf(metadata["node_count"]),
+		recordSize: uintOf(metadata["record_size"]),
+		ipVersion:  uintOf(metadata["ip_version"]),
+	}
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	} else if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", r.ipVersion)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	// The search tree is followed by 16 zero bytes, and then the data section.
+	if treeSize+16 > uint(i+len(buffer)-len(tail)) {
+		return nil, fmt.Errorf("search tree is bigger than the database")
+	}
+	r.tree = buffer[:treeSize]
+	r.data = buffer[treeSize+16 : len(buffer)-len(tail)+i]
+
+	if r.ipVersion == 6 {
+		for bit := 0; bit < 96 && r.ipv4Start < r.nodeCount; bit++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country of the IP address (e.g. "TR"), which
+// is the registered country of the network if the country is unknown; it is empty if the address is
+// not in the database at all.
+func (r *Reader) Country(ip net.IP) (string, error) {
+	record, err := r.lookup(ip)
+	if err != nil || record == nil {
+		return "", err
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		if country, ok := record[key].(map[string]interface{}); ok {
+			if code, ok := country["iso_code"].(string); ok {
+				return code, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// lookup returns the record of the IP address, or nil if it is not in the database.
+func (r *Reader) lookup(ip net.IP) (map[string]interface{}, error) {
+	node := uint(0)
+	bits := ip.To16()
+	if bits == nil {
+		return nil, fmt.Errorf("invalid IP address %v", ip)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		bits, node = ip4, r.ipv4Start
+	} else if r.ipVersion == 4 {
+		return nil, nil // an IPv6 address in an IPv4 database
+	}
+
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		node = r.record(node, uint(bits[i/8]>>(7-i%8))&1)
+	}
+	if node <= r.nodeCount {
+		return nil, nil // not found (node == r.nodeCount), or a malformed tree
+	}
+
+	value, _, err := (&decoder{data: r.data}).decode(node-r.nodeCount-16, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode record")
+	}
+	record, _ := value.(map[string]interface{})
+	return record, nil
+}
+
+// record returns the left (bit 0) or the right (bit 1) record of the node, which is either another
+// node, r.nodeCount (not found), or a pointer to the data section (beyond r.nodeCount).
+func (r *Reader) record(node, bit uint) uint {
+	nodeSize := r.recordSize / 4
+	offset := node * nodeSize
+	if offset+nodeSize > uint(len(r.tree)) {
+		return r.nodeCount
+	}
+	b := r.tree[offset : offset+nodeSize]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+func uintOf(value interface{}) uint {
+	if n, ok := value.(uint64); ok && n <= math.MaxUint32 {
+		return uint(n)
+	}
+	return 0
+}
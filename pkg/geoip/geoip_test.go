@@ -0,0 +1,171 @@
+package geoip
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+// testDB builds a MaxMind DB of the given record size and IP version, in which the networks are of
+// the records (whose offsets in the data section are given).
+type testDB struct {
+	recordSize, ipVersion uint
+	nodes                 [][2]int // the children: a node (> 0), empty (0), or a record (< 0)
+	data                  []byte
+}
+
+func newTestDB(recordSize, ipVersion uint) *testDB {
+	return &testDB{recordSize: recordSize, ipVersion: ipVersion, nodes: make([][2]int, 1)}
+}
+
+// insert maps the network to the record at the offset in the data section.
+func (db *testDB) insert(cidr string, offset int) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	bits := []byte(network.IP.To16())
+	ones, _ := network.Mask.Size()
+	if ip4 := network.IP.To4(); ip4 != nil {
+		// The IPv4 networks are in ::/96 of the IPv6 databases.
+		if db.ipVersion == 4 {
+			bits = ip4
+		} else {
+			bits, ones = append(make([]byte, 12), ip4...), ones+96
+		}
+	}
+
+	node := 0
+	for i := 0; i < ones; i++ {
+		bit := (bits[i/8] >> (7 - i%8)) & 1
+		if i == ones-1 {
+			db.nodes[node][bit] = -offset - 1
+		} else {
+			if db.nodes[node][bit] <= 0 {
+				db.nodes = append(db.nodes, [2]int{})
+				db.nodes[node][bit] = len(db.nodes) - 1
+			}
+			node = db.nodes[node][bit]
+		}
+	}
+}
+
+func (db *testDB) bytes() []byte {
+	nodeCount := uint(len(db.nodes))
+	var buffer bytes.Buffer
+	for _, node := range db.nodes {
+		var records [2]uint
+		for i, child := range node {
+			switch {
+			case child > 0:
+				records[i] = uint(child)
+			case child == 0:
+				records[i] = nodeCount
+			default:
+				records[i] = nodeCount + 16 + uint(-child-1)
+			}
+		}
+		l, r := records[0], records[1]
+		switch db.recordSize {
+		case 24:
+			buffer.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 28:
+			buffer.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(l>>20&0xf0 | r>>24&0x0f),
+				byte(r >> 16), byte(r >> 8), byte(r)})
+		case 32:
+			buffer.Write([]byte{byte(l >> 24), byte(l >> 16), byte(l >> 8), byte(l),
+				byte(r >> 24), byte(r >> 16), byte(r >> 8), byte(r)})
+		}
+	}
+	buffer.Write(make([]byte, 16))
+	buffer.Write(db.data)
+	buffer.Write(metadataMarker)
+	buffer.Write(encodeMap("node_count", encodeUint(6, uint64(nodeCount)), "record_size",
+		encodeUint(5, uint64(db.recordSize)), "ip_version", encodeUint(5, uint64(db.ipVersion))))
+	return buffer.Bytes()
+}
+
+func encodeString(s string) []byte {
+	return append([]byte{typeString<<5 | byte(len(s))}, s...)
+}
+
+func encodeUint(kind byte, n uint64) []byte {
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{kind<<5 | byte(len(b))}, b...)
+}
+
+// encodeMap encodes the map of the keys (strings) and the values (encoded), in order.
+func encodeMap(pairs ...interface{}) []byte {
+	b := []byte{typeMap<<5 | byte(len(pairs)/2)}
+	for i := 0; i < len(pairs); i += 2 {
+		b = append(b, encodeString(pairs[i].(string))...)
+		b = append(b, pairs[i+1].([]byte)...)
+	}
+	return b
+}
+
+func TestCountry(t *testing.T) {
+	for _, recordSize := range []uint{24, 28, 32} {
+		for _, ipVersion := range []uint{4, 6} {
+			db := newTestDB(recordSize, ipVersion)
+			tr := encodeMap("country", encodeMap("iso_code", encodeString("TR")))
+			de := encodeMap("registered_country", encodeMap("iso_code", encodeString("DE")))
+			// The record of JP is pointed to by the one of the network that is inserted last.
+			jp := encodeMap("country", encodeMap("iso_code", encodeString("JP")))
+			pointer := []byte{typePointer << 5, byte(len(tr) + len(de))}
+			db.data = bytes.Join([][]byte{tr, de, jp, pointer}, nil)
+
+			db.insert("10.0.0.0/8", 0)
+			db.insert("192.0.2.0/24", len(tr))
+			db.insert("198.51.100.0/25", len(tr)+len(de)+len(jp))
+			if ipVersion == 6 {
+				db.insert("2001:db8::/32", 0)
+			}
+
+			r, err := FromBytes(db.bytes())
+			if err != nil {
+				t.Fatalf("Could not read the database of %d-bit records (IPv%d): %s", recordSize, ipVersion,
+					err.Error())
+			}
+			instances := []struct {
+				ip       string
+				expected string
+			}{
+				{"10.1.2.3", "TR"},
+				{"192.0.2.200", "DE"},
+				{"198.51.100.1", "JP"},
+				{"198.51.100.129", ""},
+				{"11.0.0.1", ""},
+				{"2001:db8::1", map[uint]string{4: "", 6: "TR"}[ipVersion]},
+				{"2001:db9::1", ""},
+			}
+			for i, instance := range instances {
+				country, err := r.Country(net.ParseIP(instance.ip))
+				if err != nil {
+					t.Errorf("Country of the instance #%d (%d-bit records, IPv%d) failed: %s", i+1, recordSize,
+						ipVersion, err.Error())
+				} else if country != instance.expected {
+					t.Errorf("Country of the instance #%d (%d-bit records, IPv%d) is wrong! Got %q (expected %q)",
+						i+1, recordSize, ipVersion, country, instance.expected)
+				}
+			}
+		}
+	}
+}
+
+func TestFromBytesInvalid(t *testing.T) {
+	for i, buffer := range [][]byte{
+		nil,
+		[]byte("not a database"),
+		append(append([]byte{}, metadataMarker...), encodeMap("node_count", encodeUint(6, 1))...),
+		append(append([]byte{}, metadataMarker...), encodeMap("node_count", encodeUint(6, 1000),
+			"record_size", encodeUint(5, 24), "ip_version", encodeUint(5, 4))...),
+	} {
+		if _, err := FromBytes(buffer); err == nil {
+			t.Errorf("FromBytes of the instance #%d is wrong! Got no error", i+1)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// chatTimeout is how long each request to a chat service may take.
+	chatTimeout = 30 * time.Second
+	// maxRetryAfter is how long a chat target waits at most when it is told to slow down (by a 429
+	// Too Many Requests) before retrying, beyond which the event is failed.
+	maxRetryAfter = time.Minute
+)
+
+// chatService is a chat service that the events are posted to as messages.
+type chatService struct {
+	// defaultTemplate is the template of the messages unless one is supplied.
+	defaultTemplate string
+	// defaultRate is the maximum number of the messages per minute unless one is supplied, in line
+	// with the limits of the service.
+	defaultRate uint
+	// maxLength is the maximum number of the characters of the messages, beyond which they are
+	// truncated.
+	maxLength int
+	// escape escapes the text for the markup of the messages.
+	escape func(s string) string
+	// request returns the request that posts the message to the endpoint.
+	request func(endpoint *url.URL, message string) (*http.Request, error)
+}
+
+var (
+	// discordEscaper escapes the Markdown of Discord.
+	discordEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`,
+		">", `\>`)
+	// slackEscaper escapes the control characters of the mrkdwn of Slack (see "Escaping text" of
+	// its documentation).
+	slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+// discordService posts the messages to a webhook of a Discord channel.
+var discordService = chatService{
+	defaultTemplate: "{{if .Watch}}**[{{escape .Watch}}]** {{end}}{{escape .Name}} ({{size .Size}})\n`{{.Magnet}}`",
+	defaultRate:     30,
+	maxLength:       2000,
+	escape:          discordEscaper.Replace,
+	request: func(endpoint *url.URL, message string) (*http.Request, error) {
+		return newJSONRequest(http.MethodPost, endpoint.String(), map[string]interface{}{
+			"content": message,
+			// Lest the names (or the templates) mention anyone after all.
+			"allowed_mentions": map[string][]string{"parse": {}},
+		})
+	},
+}
+
+// slackService posts the messages to an incoming webhook of a Slack channel.
+var slackService = chatService{
+	defaultTemplate: "{{if .Watch}}*[{{escape .Watch}}]* {{end}}{{escape .Name}} ({{size .Size}})\n`{{.Magnet}}`",
+	defaultRate:     60,
+	maxLength:       40000,
+	escape:          slackEscaper.Replace,
+	request: func(endpoint *url.URL, message string) (*http.Request, error) {
+		return newJSONRequest(http.MethodPost, endpoint.String(), map[string]string{"text": message})
+	},
+}
+
+// matrixTransaction numbers the transactions of the Matrix messages, which must be unique per
+// access token (along with the start time of the process).
+var matrixTransaction uint64
+
+// matrixStart tells the transactions of the process apart from the ones of the earlier processes.
+var matrixStart = time.Now().UnixNano()
+
+// matrixService posts the messages to a Matrix room as notices (i.e. the messages of the bots), in
+// plain text. The endpoint is the URL of the homeserver, whose password is the access token of the
+// user, and whose path is the identifier of the room (which the user must have joined).
+var matrixService = chatService{
+	defaultTemplate: "{{if .Watch}}[{{.Watch}}] {{end}}{{.Name}} ({{size .Size}})\n{{.Magnet}}",
+	defaultRate:     60,
+	maxLength:       10000,
+	escape:          func(s string) string { return s },
+	request: func(endpoint *url.URL, message string) (*http.Request, error) {
+		accessToken, _ := endpoint.User.Password()
+		room := strings.TrimPrefix(endpoint.Path, "/")
+		if accessToken == "" || room == "" {
+			return nil, fmt.Errorf("URL must have the access token as the password and the room as the path")
+		}
+		transaction := fmt.Sprintf("magnetico-%d-%d", matrixStart, atomic.AddUint64(&matrixTransaction, 1))
+		api := url.URL{
+			Scheme: endpoint.Scheme,
+			Host:   endpoint.Host,
+			Path:   "/_matrix/client/r0/rooms/" + room + "/send/m.room.message/" + transaction,
+		}
+		request, err := newJSONRequest(http.MethodPut, api.String(), map[string]string{
+			"msgtype": "m.notice",
+			"body":    message,
+		})
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+		return request, nil
+	},
+}
+
+// chatTarget posts the events to a chat service as messages, made of the template (see
+// chatService.defaultTemplate), at most rate messages per minute; the ones that exceed the rate
+// wait for their turn.
+//
+// The URL of the target is the URL of the endpoint prefixed by the service, namely:
+//   - discord+https://discord.com/api/webhooks/<ID>/<TOKEN>, the URL of a webhook of Discord;
+//   - slack+https://hooks.slack.com/services/<...>, the URL of an incoming webhook of Slack;
+//   - matrix+https://:<ACCESS TOKEN>@<HOMESERVER>/<ROOM ID>, for Matrix;
+//
+// (or +http, such as for the Slack-compatible webhooks of Mattermost that are served over HTTP)
+// with the parameters:
+//   - template (or template_file): the template of the messages (see templateOf), where `escape`
+//     escapes the text for the markup of the service;
+//   - rate: the maximum number of the messages per minute.
+type chatTarget struct {
+	service  chatService
+	endpoint *url.URL
+	template *template.Template
+	interval time.Duration
+	client   *http.Client
+
+	lastSentOn time.Time
+}
+
+func makeChatTarget(service chatService) TargetFactory {
+	return func(url_ *url.URL) (Target, error) {
+		t := &chatTarget{
+			service: service,
+			client:  &http.Client{Timeout: chatTimeout},
+		}
+
+		query := url_.Query()
+		var err error
+		if t.template, err = templateOf(query, service.defaultTemplate, service.escape); err != nil {
+			return nil, err
+		}
+		rate := service.defaultRate
+		if query.Get("rate") != "" {
+			parsed, err := strconv.ParseUint(query.Get("rate"), 10, 32)
+			if err != nil || parsed == 0 {
+				return nil, fmt.Errorf("rate must be a positive integer")
+			}
+			rate = uint(parsed)
+		}
+		t.interval = time.Minute / time.Duration(rate)
+		query.Del("rate")
+
+		endpoint := *url_
+		endpoint.Scheme = url_.Scheme[strings.IndexByte(url_.Scheme, '+')+1:]
+		endpoint.RawQuery = query.Encode()
+		t.endpoint = &endpoint
+		return t, nil
+	}
+}
+
+func (t *chatTarget) Send(event Event) error {
+	var buffer strings.Builder
+	if err := t.template.Execute(&buffer, event); err != nil {
+		return errors.Wrap(err, "template.Execute")
+	}
+	message := buffer.String()
+	if runes := []rune(message); len(runes) > t.service.maxLength {
+		message = string(runes[:t.service.maxLength-1]) + "…"
+	}
+
+	if wait := time.Until(t.lastSentOn.Add(t.interval)); wait > 0 {
+		time.Sleep(wait)
+	}
+	retryAfter, err := t.post(message)
+	if retryAfter > 0 && retryAfter <= maxRetryAfter {
+		time.Sleep(retryAfter)
+		_, err = t.post(message)
+	}
+	return err
+}
+
+// post posts the message, and returns how long to wait before retrying if the service asks to
+// slow down.
+func (t *chatTarget) post(message string) (time.Duration, error) {
+	t.lastSentOn = time.Now()
+	request, err := t.service.request(t.endpoint, message)
+	if err != nil {
+		return 0, err
+	}
+	response, err := t.client.Do(request)
+	if err != nil {
+		return 0, errors.Wrap(err, "http.Client.Do")
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		retryAfter, err := strconv.ParseFloat(response.Header.Get("Retry-After"), 64)
+		if err != nil || retryAfter <= 0 {
+			retryAfter = t.interval.Seconds()
+		}
+		return time.Duration(retryAfter * float64(time.Second)),
+			fmt.Errorf("rate limited by the service (retry after %.1fs)", retryAfter)
+	}
+	if response.StatusCode/100 != 2 {
+		return 0, fmt.Errorf("unexpected status %s: %s", response.Status, bytes.TrimSpace(body))
+	}
+	return 0, nil
+}
+
+func (t *chatTarget) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+func newJSONRequest(method string, url_ string, body interface{}) (*http.Request, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Marshal")
+	}
+	request, err := http.NewRequest(method, url_, bytes.NewReader(encoded))
+	if err != nil {
+		return nil, errors.Wrap(err, "http.NewRequest")
+	}
+	request.Header.Set("Content-Type", "application/json")
+	return request, nil
+}
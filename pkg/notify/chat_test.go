@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type chatRequest struct {
+	method        string
+	path          string
+	authorization string
+	body          map[string]interface{}
+	receivedOn    time.Time
+}
+
+// serveTestChat serves the chat services, answering the first request with 429 Too Many Requests if
+// tooMany is true.
+func serveTestChat(t *testing.T, tooMany bool) (*httptest.Server, *[]chatRequest) {
+	var requests []chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := chatRequest{
+			method:        r.Method,
+			path:          r.URL.Path,
+			authorization: r.Header.Get("Authorization"),
+			receivedOn:    time.Now(),
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request.body); err != nil {
+			t.Errorf("Could not decode the body: %s", err.Error())
+		}
+		requests = append(requests, request)
+		if tooMany && len(requests) == 1 {
+			w.Header().Set("Retry-After", "0.1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	return server, &requests
+}
+
+func TestChatTargets(t *testing.T) {
+	scenarios := []struct {
+		scheme        string
+		path          string
+		expectMethod  string
+		expectPath    string
+		expectField   string
+		expectMessage string
+	}{
+		{"discord+", "/api/webhooks/1/token", http.MethodPost, "/api/webhooks/1/token", "content",
+			"**[ubuntu]** Ubuntu \\*Desktop\\* (4.0 KiB)\n`magnet:?xt=urn:btih:abcd&dn=Ubuntu+%2ADesktop%2A`"},
+		{"slack+", "/services/T/B/X", http.MethodPost, "/services/T/B/X", "text",
+			"*[ubuntu]* Ubuntu *Desktop* (4.0 KiB)\n`magnet:?xt=urn:btih:abcd&dn=Ubuntu+%2ADesktop%2A`"},
+		{"matrix+", "/!room:example.org", http.MethodPut, "/_matrix/client/r0/rooms/!room:example.org/send/m.room.message/", "body",
+			"[ubuntu] Ubuntu *Desktop* (4.0 KiB)\nmagnet:?xt=urn:btih:abcd&dn=Ubuntu+%2ADesktop%2A"},
+	}
+
+	for i, s := range scenarios {
+		server, requests := serveTestChat(t, false)
+		rawURL := s.scheme + strings.Replace(server.URL, "://", "://:secret@", 1) + s.path
+		subscription, err := ParseTarget(rawURL)
+		if err != nil {
+			t.Fatalf("Could not parse the target of the instance #%d: %s", i+1, err.Error())
+		}
+
+		event := Event{Kind: KindMatch, Watch: "ubuntu", Torrent: Torrent{
+			Name:   "Ubuntu *Desktop*",
+			Size:   4096,
+			Magnet: "magnet:?xt=urn:btih:abcd&dn=Ubuntu+%2ADesktop%2A",
+		}}
+		if err = subscription.target.Send(event); err != nil {
+			t.Fatalf("Could not send the event of the instance #%d: %s", i+1, err.Error())
+		}
+		server.Close()
+
+		if len(*requests) != 1 {
+			t.Fatalf("Number of the requests of the instance #%d is wrong! Got %d (expected 1)", i+1, len(*requests))
+		}
+		request := (*requests)[0]
+		if request.method != s.expectMethod || !strings.HasPrefix(request.path, s.expectPath) {
+			t.Errorf("Request of the instance #%d is wrong! Got %s %s (expected %s %s)", i+1,
+				request.method, request.path, s.expectMethod, s.expectPath)
+		}
+		if got := request.body[s.expectField]; got != s.expectMessage {
+			t.Errorf("Message of the instance #%d is wrong! Got %q (expected %q)", i+1, got, s.expectMessage)
+		}
+		if s.scheme == "matrix+" && request.authorization != "Bearer secret" {
+			t.Errorf("Authorization of the instance #%d is wrong! Got %q", i+1, request.authorization)
+		}
+	}
+}
+
+func TestChatTargetRateLimit(t *testing.T) {
+	server, requests := serveTestChat(t, true)
+	defer server.Close()
+
+	// 600 messages per minute is a message per 100ms.
+	subscription, err := ParseTarget("slack+" + server.URL + "/services/T/B/X?rate=600&template={{.Name}}")
+	if err != nil {
+		t.Fatalf("Could not parse the target: %s", err.Error())
+	}
+	for _, name := range []string{"a", "b"} {
+		if err = subscription.target.Send(Event{Kind: KindTorrent, Torrent: Torrent{Name: name}}); err != nil {
+			t.Fatalf("Could not send the event: %s", err.Error())
+		}
+	}
+
+	// The first message is retried after it is rate limited.
+	if len(*requests) != 3 {
+		t.Fatalf("Number of the requests is wrong! Got %d (expected 3)", len(*requests))
+	}
+	for i, expect := range []string{"a", "a", "b"} {
+		if got := (*requests)[i].body["text"]; got != expect {
+			t.Errorf("Message of the request #%d is wrong! Got %q (expected %q)", i+1, got, expect)
+		}
+		if i > 0 {
+			if interval := (*requests)[i].receivedOn.Sub((*requests)[i-1].receivedOn); interval < 90*time.Millisecond {
+				t.Errorf("Interval before the request #%d is too short! Got %s", i+1, interval)
+			}
+		}
+	}
+}
+
+func TestParseChatTarget(t *testing.T) {
+	scenarios := []struct {
+		rawURL    string
+		expectErr bool
+	}{
+		{"discord+https://discord.com/api/webhooks/1/token", false},
+		{"discord+https://discord.com/api/webhooks/1/token?template={{.Name", true},
+		{"discord+https://discord.com/api/webhooks/1/token?template={{.Nonexistent}}", true},
+		{"slack+https://hooks.slack.com/services/T/B/X?rate=0", true},
+		{"slack+https://hooks.slack.com/services/T/B/X?rate=10", false},
+		{"matrix+https://:token@matrix.org/!room:matrix.org", false},
+	}
+
+	for i, s := range scenarios {
+		if _, err := ParseTarget(s.rawURL); (err != nil) != s.expectErr {
+			t.Errorf("Error of the instance #%d is wrong! Got %v (expected an error: %t)", i+1, err, s.expectErr)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// emailTimeout is how long sending an email may take.
+	emailTimeout = time.Minute
+	// maxDigestMatches is the maximum number of the matches listed in a digest, beyond which they
+	// are only counted (see Digest.Omitted).
+	maxDigestMatches = 1000
+)
+
+const (
+	defaultEmailSubject = "[magnetico] {{if .Watch}}{{.Watch}}: {{end}}{{.Name}}"
+	defaultEmailBody    = `{{.Name}}
+
+Size: {{size .Size}} ({{.NFiles}} files)
+Discovered on: {{time .DiscoveredOn}}
+{{- if .Watch}}
+Watch: {{.Rule.Name}} ({{.Rule.Query}})
+{{- end}}
+
+{{.Magnet}}
+`
+	defaultDigestSubject = "[magnetico] {{.Rule.Name}}: {{.Total}} new torrent(s)"
+	defaultDigestBody    = `{{.Total}} new torrent(s) matched {{.Rule.Name}} ({{.Rule.Query}}) from {{.Since.Format "Jan 2 15:04"}} to {{.Until.Format "Jan 2 15:04"}}:
+{{range .Matches}}
+{{.Name}} ({{size .Size}})
+{{.Magnet}}
+{{end}}
+{{- if .Omitted}}
+...and {{.Omitted}} more.
+{{end}}`
+)
+
+// Digest is the matches of a watch over a period, which are mailed together as a single email (see
+// emailTarget).
+type Digest struct {
+	Rule  Watch
+	Since time.Time
+	Until time.Time
+	// Matches are in the order that they are discovered.
+	Matches []Event
+	// Omitted is the number of the matches beyond maxDigestMatches, which are not listed.
+	Omitted int
+}
+
+// Total returns the number of the matches of the digest, including the omitted ones.
+func (d Digest) Total() int {
+	return len(d.Matches) + d.Omitted
+}
+
+// emailTarget mails the events, either each as soon as it is discovered, or as the digests of the
+// matches of each watch, daily or weekly (in which case the events of every torrent are ignored).
+//
+// The URL of the target is smtp://[USER:PASSWORD@]HOST[:PORT]/ (on port 587 by default, using
+// STARTTLS if the server supports it), or smtps:// over TLS (on port 465 by default), with the
+// parameters:
+//   - from: the address of the sender (required);
+//   - to: the comma-separated addresses of the recipients (required);
+//   - digest: `none` (the default) to mail every event, or `daily` or `weekly` (on Mondays) to mail
+//     the digests of the matches of each watch;
+//   - at: the local time of the day to mail the digests at, `08:00` by default;
+//   - subject: the template of the subjects (see templateOf);
+//   - template (or template_file): the template of the bodies, in plain text.
+//
+// The templates of the digests are executed on the Digest, rather than on the Event.
+type emailTarget struct {
+	scheme      string
+	address     string
+	host        string
+	implicitTLS bool
+	auth        smtp.Auth // nil if not authenticating
+	from        *mail.Address
+	to          []*mail.Address
+	subject     *template.Template
+	body        *template.Template
+
+	digest           bool // false if every event is mailed as soon as it is sent
+	weekly           bool
+	atHour, atMinute int
+
+	mutex   sync.Mutex
+	digests map[string]*Digest // by the names of their watches
+	since   time.Time
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func makeEmailTarget(url_ *url.URL) (Target, error) {
+	t := &emailTarget{
+		scheme:      url_.Scheme,
+		address:     url_.Host,
+		host:        url_.Hostname(),
+		implicitTLS: url_.Scheme == "smtps",
+	}
+	if url_.Port() == "" {
+		if t.implicitTLS {
+			t.address = net.JoinHostPort(t.host, "465")
+		} else {
+			t.address = net.JoinHostPort(t.host, "587")
+		}
+	}
+	if url_.User != nil {
+		// PlainAuth refuses to send the password unless the connection is encrypted (or to
+		// localhost).
+		password, _ := url_.User.Password()
+		t.auth = smtp.PlainAuth("", url_.User.Username(), password, t.host)
+	}
+
+	query := url_.Query()
+	var err error
+	if query.Get("from") == "" || query.Get("to") == "" {
+		return nil, fmt.Errorf("from and to must be supplied")
+	}
+	if t.from, err = mail.ParseAddress(query.Get("from")); err != nil {
+		return nil, fmt.Errorf("could not parse from: %s", err.Error())
+	}
+	if t.to, err = mail.ParseAddressList(query.Get("to")); err != nil {
+		return nil, fmt.Errorf("could not parse to: %s", err.Error())
+	}
+
+	switch query.Get("digest") {
+	case "", "none":
+	case "daily":
+		t.digest = true
+	case "weekly":
+		t.digest, t.weekly = true, true
+	default:
+		return nil, fmt.Errorf("digest must be either none, daily, or weekly")
+	}
+	atText := "08:00"
+	if query.Get("at") != "" {
+		atText = query.Get("at")
+	}
+	at, err := time.Parse("15:04", atText)
+	if err != nil {
+		return nil, fmt.Errorf("at must be a time of the day such as 08:00")
+	}
+	t.atHour, t.atMinute = at.Hour(), at.Minute()
+
+	subject, body, examples := defaultEmailSubject, defaultEmailBody, exampleEvents()
+	if t.digest {
+		subject, body, examples = defaultDigestSubject, defaultDigestBody, exampleDigests()
+	}
+	if query.Get("subject") != "" {
+		subject = query.Get("subject")
+	}
+	if body, err = templateText(query, body); err != nil {
+		return nil, err
+	}
+	if t.subject, err = parseTemplate("subject", subject, nil, examples...); err != nil {
+		return nil, err
+	}
+	if t.body, err = parseTemplate("body", body, nil, examples...); err != nil {
+		return nil, err
+	}
+
+	if t.digest {
+		t.digests = make(map[string]*Digest)
+		t.since = time.Now()
+		t.stop = make(chan struct{})
+		t.stopped = make(chan struct{})
+		go t.run()
+	}
+	return t, nil
+}
+
+// exampleDigests are the digests that the templates of the digests are validated on.
+func exampleDigests() []interface{} {
+	event := exampleEvents()[1].(Event)
+	return []interface{}{Digest{
+		Rule:    event.Rule,
+		Since:   time.Now().Add(-24 * time.Hour),
+		Until:   time.Now(),
+		Matches: []Event{event},
+		Omitted: 1,
+	}}
+}
+
+func (t *emailTarget) Send(event Event) error {
+	if !t.digest {
+		return t.mail(event)
+	}
+	if event.Kind != KindMatch {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	digest, ok := t.digests[event.Watch]
+	if !ok {
+		digest = &Digest{Rule: event.Rule}
+		t.digests[event.Watch] = digest
+	}
+	if len(digest.Matches) < maxDigestMatches {
+		digest.Matches = append(digest.Matches, event)
+	} else {
+		digest.Omitted++
+	}
+	return nil
+}
+
+// Close mails the digests of the matches so far (if any), lest they are lost.
+func (t *emailTarget) Close() error {
+	if t.digest {
+		close(t.stop)
+		<-t.stopped
+		t.flush(time.Now())
+	}
+	return nil
+}
+
+func (t *emailTarget) run() {
+	defer close(t.stopped)
+	for {
+		timer := time.NewTimer(time.Until(nextDigest(time.Now(), t.weekly, t.atHour, t.atMinute)))
+		select {
+		case now := <-timer.C:
+			t.flush(now)
+		case <-t.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// nextDigest returns when the digests are mailed next after now: at the time of the day every day,
+// or on Mondays if weekly.
+func nextDigest(now time.Time, weekly bool, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	for !next.After(now) || weekly && next.Weekday() != time.Monday {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// flush mails the digests of the matches since the last flush, one for each watch.
+func (t *emailTarget) flush(until time.Time) {
+	t.mutex.Lock()
+	digests, since := t.digests, t.since
+	t.digests, t.since = make(map[string]*Digest), until
+	t.mutex.Unlock()
+
+	names := make([]string, 0, len(digests))
+	for name := range digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		digest := digests[name]
+		digest.Since, digest.Until = since, until
+		if err := t.mail(*digest); err != nil {
+			notificationStats.Add(t.scheme+".failed", 1)
+			zap.L().Named("notify").Warn("Could not mail the digest!", zap.String("watch", name),
+				zap.Int("matches", digest.Total()), zap.Error(err))
+			continue
+		}
+		notificationStats.Add(t.scheme+".digests", 1)
+	}
+}
+
+// mail mails the email of the data, which is either an Event or a Digest.
+func (t *emailTarget) mail(data interface{}) error {
+	var subject, body strings.Builder
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return errors.Wrap(err, "template.Execute")
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return errors.Wrap(err, "template.Execute")
+	}
+	// The subject must be a single line, lest the names inject headers.
+	message, err := t.message(strings.Join(strings.Fields(subject.String()), " "), body.String(), time.Now())
+	if err != nil {
+		return err
+	}
+	return t.send(message)
+}
+
+// message returns the email of the subject and the body, in plain text.
+func (t *emailTarget) message(subject string, body string, date time.Time) ([]byte, error) {
+	var to []string
+	for _, address := range t.to {
+		to = append(to, address.String())
+	}
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "From: %s\r\n", t.from.String())
+	fmt.Fprintf(&buffer, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buffer.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	// The line breaks of the body are written as CRLF.
+	writer := quotedprintable.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(body)); err != nil {
+		return nil, errors.Wrap(err, "quotedprintable.Writer.Write")
+	}
+	if err := writer.Close(); err != nil {
+		return nil, errors.Wrap(err, "quotedprintable.Writer.Close")
+	}
+	return buffer.Bytes(), nil
+}
+
+// send sends the message to the recipients through the SMTP server.
+func (t *emailTarget) send(message []byte) error {
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	var conn net.Conn
+	var err error
+	if t.implicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", t.address, &tls.Config{ServerName: t.host})
+	} else {
+		conn, err = dialer.Dial("tcp", t.address)
+	}
+	if err != nil {
+		return errors.Wrap(err, "net.Dial")
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(emailTimeout)); err != nil {
+		return errors.Wrap(err, "net.Conn.SetDeadline")
+	}
+
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		return errors.Wrap(err, "smtp.NewClient")
+	}
+	if !t.implicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err = client.StartTLS(&tls.Config{ServerName: t.host}); err != nil {
+				return errors.Wrap(err, "smtp.Client.StartTLS")
+			}
+		}
+	}
+	if t.auth != nil {
+		if err = client.Auth(t.auth); err != nil {
+			return errors.Wrap(err, "smtp.Client.Auth")
+		}
+	}
+
+	if err = client.Mail(t.from.Address); err != nil {
+		return errors.Wrap(err, "smtp.Client.Mail")
+	}
+	for _, to := range t.to {
+		if err = client.Rcpt(to.Address); err != nil {
+			return errors.Wrap(err, "smtp.Client.Rcpt")
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return errors.Wrap(err, "smtp.Client.Data")
+	}
+	if _, err = writer.Write(message); err != nil {
+		return errors.Wrap(err, "write")
+	}
+	if err = writer.Close(); err != nil {
+		return errors.Wrap(err, "smtp.Client.Data")
+	}
+	return errors.Wrap(client.Quit(), "smtp.Client.Quit")
+}
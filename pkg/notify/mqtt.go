@@ -0,0 +1,351 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// mqttTimeout is how long connecting to the broker, and each exchange with it, may take.
+	mqttTimeout = 10 * time.Second
+	// mqttPingInterval is how long the connection may be idle before it is checked (by a ping)
+	// before publishing, as the idle connections are dropped silently by the NATs and the
+	// firewalls.
+	mqttPingInterval = time.Minute
+)
+
+// The types of the MQTT control packets (see MQTT 3.1.1, section 2.2.1).
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttPingreq    = 12
+	mqttPingresp   = 13
+	mqttDisconnect = 14
+)
+
+// mqttTarget publishes the events to an MQTT broker (using MQTT 3.1.1), the ones of KindTorrent to
+// the topic <PREFIX>/torrents, and the ones of KindMatch to <PREFIX>/watches/<WATCH>, as JSON.
+//
+// The URL of the target is mqtt://[USER:PASSWORD@]HOST[:PORT][/PREFIX] (or mqtts:// over TLS),
+// whose prefix is `magnetico` if not supplied, with the parameters:
+//   - qos: 0 (the default) or 1, to have the events acknowledged by the broker;
+//   - retain: true to have the broker retain the last event of each topic;
+//   - client_id: the client identifier, a random one if not supplied;
+//   - template (or template_file): the template of the payloads (see templateOf), instead of the
+//     events in JSON.
+type mqttTarget struct {
+	address  string
+	tls      *tls.Config // nil if not over TLS
+	clientID string
+	username *string
+	password *string
+	prefix   string
+	qos      byte
+	retain   bool
+	template *template.Template // nil if the events are published as JSON
+
+	mutex    sync.Mutex
+	conn     net.Conn // nil if not connected
+	reader   *bufio.Reader
+	lastUsed time.Time
+	packetID uint16
+}
+
+func makeMQTTTarget(url_ *url.URL) (Target, error) {
+	t := &mqttTarget{
+		address: url_.Host,
+		prefix:  strings.Trim(url_.Path, "/"),
+	}
+	if t.prefix == "" {
+		t.prefix = "magnetico"
+	} else if strings.ContainsAny(t.prefix, mqttReserved[1:]) {
+		return nil, fmt.Errorf("prefix must not contain #, +, or NUL")
+	}
+	if url_.Port() == "" {
+		if url_.Scheme == "mqtts" {
+			t.address = net.JoinHostPort(url_.Hostname(), "8883")
+		} else {
+			t.address = net.JoinHostPort(url_.Hostname(), "1883")
+		}
+	}
+	if url_.Scheme == "mqtts" {
+		t.tls = &tls.Config{ServerName: url_.Hostname()}
+	}
+	if url_.User != nil {
+		username := url_.User.Username()
+		t.username = &username
+		if password, ok := url_.User.Password(); ok {
+			t.password = &password
+		}
+	}
+
+	query := url_.Query()
+	var err error
+	if t.template, err = templateOf(query, "", nil); err != nil {
+		return nil, err
+	}
+	switch query.Get("qos") {
+	case "", "0":
+	case "1":
+		t.qos = 1
+	default:
+		return nil, fmt.Errorf("qos must be either 0 or 1")
+	}
+	if retain := query.Get("retain"); retain != "" {
+		if t.retain, err = strconv.ParseBool(retain); err != nil {
+			return nil, fmt.Errorf("retain must be either true or false")
+		}
+	}
+	t.clientID = query.Get("client_id")
+	if t.clientID == "" {
+		random := make([]byte, 6)
+		if _, err := rand.Read(random); err != nil {
+			return nil, errors.Wrap(err, "rand.Read")
+		}
+		t.clientID = "magnetico-" + hex.EncodeToString(random)
+	}
+	return t, nil
+}
+
+// mqttReserved are the characters that have a meaning in the topics of MQTT: the separator of the
+// levels, the wildcards (which are forbidden in the topics of PUBLISH), and the null character.
+const mqttReserved = "/#+\x00"
+
+// topic returns the topic of the event, whose watch is a single level (as ParseWatch ensures).
+func (t *mqttTarget) topic(event Event) string {
+	if event.Kind == KindMatch {
+		return t.prefix + "/watches/" + event.Watch
+	}
+	return t.prefix + "/torrents"
+}
+
+// Send publishes the event, reconnecting (once) if the connection is found to be broken.
+func (t *mqttTarget) Send(event Event) error {
+	var payload []byte
+	if t.template != nil {
+		var buffer bytes.Buffer
+		if err := t.template.Execute(&buffer, event); err != nil {
+			return errors.Wrap(err, "template.Execute")
+		}
+		payload = buffer.Bytes()
+	} else {
+		var err error
+		if payload, err = json.Marshal(event); err != nil {
+			return errors.Wrap(err, "json.Marshal")
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.conn != nil && time.Since(t.lastUsed) > mqttPingInterval {
+		if err := t.ping(); err != nil {
+			t.disconnect()
+		}
+	}
+	err := t.publish(t.topic(event), payload)
+	if err != nil && t.conn != nil {
+		t.disconnect()
+		err = t.publish(t.topic(event), payload)
+	}
+	if err != nil {
+		t.disconnect()
+	}
+	return err
+}
+
+func (t *mqttTarget) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.conn == nil {
+		return nil
+	}
+	_ = t.writePacket(mqttDisconnect<<4, nil)
+	return t.disconnect()
+}
+
+func (t *mqttTarget) disconnect() error {
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn, t.reader = nil, nil
+	return err
+}
+
+// connect connects to the broker, unless connected already.
+func (t *mqttTarget) connect() error {
+	if t.conn != nil {
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var err error
+	if t.tls != nil {
+		t.conn, err = tls.DialWithDialer(dialer, "tcp", t.address, t.tls)
+	} else {
+		t.conn, err = dialer.Dial("tcp", t.address)
+	}
+	if err != nil {
+		t.conn = nil
+		return errors.Wrap(err, "net.Dial")
+	}
+	t.reader = bufio.NewReader(t.conn)
+
+	// The variable header is the protocol name, its level (4 for 3.1.1), the flags, and the keep
+	// alive (which is turned off, as the connection is checked before publishing instead).
+	var flags byte = 0x02 // clean session
+	packet := appendString(nil, "MQTT")
+	payload := appendString(nil, t.clientID)
+	if t.username != nil {
+		flags |= 0x80
+		payload = appendString(payload, *t.username)
+	}
+	if t.password != nil {
+		flags |= 0x40
+		payload = appendString(payload, *t.password)
+	}
+	packet = append(packet, 4, flags, 0, 0)
+	packet = append(packet, payload...)
+
+	if err = t.writePacket(mqttConnect<<4, packet); err != nil {
+		return err
+	}
+	response, err := t.readPacket(mqttConnack)
+	if err != nil {
+		return err
+	}
+	if len(response) != 2 {
+		return fmt.Errorf("malformed CONNACK")
+	} else if response[1] != 0 {
+		return fmt.Errorf("connection refused by the broker (return code %d)", response[1])
+	}
+	return nil
+}
+
+func (t *mqttTarget) publish(topic string, payload []byte) error {
+	if err := t.connect(); err != nil {
+		return err
+	}
+
+	header := byte(mqttPublish<<4) | t.qos<<1
+	if t.retain {
+		header |= 0x01
+	}
+	packet := appendString(nil, topic)
+	if t.qos > 0 {
+		t.packetID++
+		if t.packetID == 0 { // packet identifiers must be non-zero
+			t.packetID++
+		}
+		packet = append(packet, byte(t.packetID>>8), byte(t.packetID))
+	}
+	packet = append(packet, payload...)
+
+	if err := t.writePacket(header, packet); err != nil {
+		return err
+	}
+	if t.qos == 0 {
+		return nil
+	}
+
+	response, err := t.readPacket(mqttPuback)
+	if err != nil {
+		return err
+	}
+	if len(response) != 2 || binary.BigEndian.Uint16(response) != t.packetID {
+		return fmt.Errorf("malformed PUBACK")
+	}
+	return nil
+}
+
+func (t *mqttTarget) ping() error {
+	if err := t.writePacket(mqttPingreq<<4, nil); err != nil {
+		return err
+	}
+	_, err := t.readPacket(mqttPingresp)
+	return err
+}
+
+// writePacket writes the packet of the first byte of the fixed header (i.e. its type and its flags),
+// followed by its remaining length.
+func (t *mqttTarget) writePacket(header byte, packet []byte) error {
+	buffer := []byte{header}
+	// The remaining length is encoded 7 bits at a time, the least significant ones first (see
+	// section 2.2.3).
+	for n := len(packet); ; {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		buffer = append(buffer, b)
+		if n == 0 {
+			break
+		}
+	}
+	buffer = append(buffer, packet...)
+
+	if err := t.conn.SetDeadline(time.Now().Add(mqttTimeout)); err != nil {
+		return errors.Wrap(err, "net.Conn.SetDeadline")
+	}
+	if _, err := t.conn.Write(buffer); err != nil {
+		return errors.Wrap(err, "net.Conn.Write")
+	}
+	t.lastUsed = time.Now()
+	return nil
+}
+
+// readPacket reads a packet of the type, and returns the rest of it after its fixed header.
+func (t *mqttTarget) readPacket(packetType byte) ([]byte, error) {
+	header, err := t.reader.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+	if header>>4 != packetType {
+		return nil, fmt.Errorf("unexpected packet of type %d (expected %d)", header>>4, packetType)
+	}
+
+	var length, shift int
+	for {
+		b, err := t.reader.ReadByte()
+		if err != nil {
+			return nil, errors.Wrap(err, "read")
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return nil, fmt.Errorf("malformed remaining length")
+		}
+	}
+
+	packet := make([]byte, length)
+	if _, err = io.ReadFull(t.reader, packet); err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+	return packet, nil
+}
+
+// appendString appends the UTF-8 encoded string, prefixed by its length (see section 1.5.3).
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,179 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+)
+
+// readTestPacket reads a packet of any type, returning its type and its flags (the first byte of its
+// fixed header) and the rest of it.
+func readTestPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var length, shift int
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	packet := make([]byte, length)
+	_, err = io.ReadFull(r, packet)
+	return header, packet, err
+}
+
+// readTestString reads a length-prefixed string off the packet, and returns the rest of it.
+func readTestString(packet []byte) (string, []byte) {
+	n := int(binary.BigEndian.Uint16(packet))
+	return string(packet[2 : 2+n]), packet[2+n:]
+}
+
+type published struct {
+	topic   string
+	payload []byte
+}
+
+// serveTestBroker accepts a single connection, and publishes what is published to it until it is
+// disconnected.
+func serveTestBroker(t *testing.T, listener net.Listener, username, password *string, publishes chan<- published) {
+	defer close(publishes)
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Errorf("Could not accept: %s", err.Error())
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	header, packet, err := readTestPacket(r)
+	if err != nil || header != mqttConnect<<4 {
+		t.Errorf("Expected CONNECT! Got %x (%v)", header, err)
+		return
+	}
+	protocol, packet := readTestString(packet)
+	if protocol != "MQTT" || packet[0] != 4 {
+		t.Errorf("Protocol is wrong! Got %s %d", protocol, packet[0])
+	}
+	flags := packet[1]
+	_, packet = readTestString(packet[4:]) // the client identifier
+	if flags&0x80 != 0 {
+		*username, packet = readTestString(packet)
+	}
+	if flags&0x40 != 0 {
+		*password, _ = readTestString(packet)
+	}
+	if _, err = conn.Write([]byte{mqttConnack << 4, 2, 0, 0}); err != nil {
+		t.Errorf("Could not write CONNACK: %s", err.Error())
+		return
+	}
+
+	for {
+		header, packet, err := readTestPacket(r)
+		if err != nil {
+			t.Errorf("Could not read: %s", err.Error())
+			return
+		}
+		switch header >> 4 {
+		case mqttPublish:
+			topic, rest := readTestString(packet)
+			if header&0x06 != 0 { // QoS 1
+				if _, err = conn.Write([]byte{mqttPuback << 4, 2, rest[0], rest[1]}); err != nil {
+					t.Errorf("Could not write PUBACK: %s", err.Error())
+					return
+				}
+				rest = rest[2:]
+			}
+			publishes <- published{topic: topic, payload: rest}
+		case mqttDisconnect:
+			return
+		default:
+			t.Errorf("Unexpected packet of type %d!", header>>4)
+			return
+		}
+	}
+}
+
+func TestMQTTTarget(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err.Error())
+	}
+	defer listener.Close()
+
+	var username, password string
+	publishes := make(chan published, 10)
+	go serveTestBroker(t, listener, &username, &password, publishes)
+
+	subscription, err := ParseTarget("mqtt://alice:secret@" + listener.Addr().String() + "/home/magnetico?qos=1&events=matches")
+	if err != nil {
+		t.Fatalf("Could not parse the target: %s", err.Error())
+	}
+	if !subscription.matchesOnly {
+		t.Error("Subscription should be of the matches only!")
+	}
+
+	torrent := NewTorrent([]byte{0xab, 0xcd}, "Ubuntu Desktop", nil, "")
+	events := []Event{{Kind: KindTorrent, Torrent: torrent}, {Kind: KindMatch, Watch: "ubuntu", Torrent: torrent}}
+	for _, event := range events {
+		if err = subscription.target.Send(event); err != nil {
+			t.Fatalf("Could not send the event: %s", err.Error())
+		}
+	}
+	if err = subscription.target.Close(); err != nil {
+		t.Fatalf("Could not close the target: %s", err.Error())
+	}
+
+	var got []published
+	for p := range publishes {
+		got = append(got, p)
+	}
+	if username != "alice" || password != "secret" {
+		t.Errorf("Credentials are wrong! Got %s:%s (expected alice:secret)", username, password)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Number of the published events is wrong! Got %d (expected 2)", len(got))
+	}
+	for i, topic := range []string{"home/magnetico/torrents", "home/magnetico/watches/ubuntu"} {
+		if got[i].topic != topic {
+			t.Errorf("Topic of the event #%d is wrong! Got %s (expected %s)", i+1, got[i].topic, topic)
+		}
+		var event Event
+		if err = json.Unmarshal(got[i].payload, &event); err != nil {
+			t.Fatalf("Could not unmarshal the payload of the event #%d: %s", i+1, err.Error())
+		}
+		if event.Kind != events[i].Kind || event.InfoHash != "abcd" || event.Watch != events[i].Watch {
+			t.Errorf("Payload of the event #%d is wrong! Got %+v (expected %+v)", i+1, event, events[i])
+		}
+	}
+}
+
+var mqttPrefix_instances = []struct {
+	target    string
+	expectErr bool
+}{
+	{"mqtt://localhost", false},
+	{"mqtt://localhost/home/magnetico", false},
+	{"mqtt://localhost/home/%23", true},
+	{"mqtt://localhost/home/+", true},
+	{"mqtt://localhost/home%00", true},
+}
+
+func TestMQTTPrefix(t *testing.T) {
+	for i, instance := range mqttPrefix_instances {
+		if _, err := ParseTarget(instance.target); (err != nil) != instance.expectErr {
+			t.Errorf("Error of the instance #%d is wrong! Got %v (expected an error: %t)", i+1, err,
+				instance.expectErr)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Package notify notifies the users of the torrents as soon as they are fetched by magneticod, and
+// of the ones that match their watches (see Watch) in particular, through the targets of their
+// choice (see ParseTarget), such as an MQTT broker, a Discord, Slack, or Matrix channel, or an email
+// (or a daily or weekly digest of the matches).
+package notify
+
+import (
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// queueCapacity is the number of the events that are queued for each target, beyond which the
+// events are dropped (lest a slow or an unreachable target hold the crawler up).
+const queueCapacity = 1024
+
+// closeTimeout is how long Close waits for the queued events to be sent.
+const closeTimeout = 5 * time.Second
+
+// notificationStats are the numbers of the events sent, failed, and dropped by the schemes of their
+// targets (e.g. `mqtt.sent`), served by expvar (see --debug-addr of magneticod).
+var notificationStats = expvar.NewMap("notifications")
+
+// Kind is the kind of an event.
+type Kind string
+
+const (
+	// KindTorrent is the event of every torrent that is fetched.
+	KindTorrent Kind = "torrent"
+	// KindMatch is the event of a torrent that matches a watch.
+	KindMatch Kind = "match"
+)
+
+// Torrent is the torrent of an event.
+type Torrent struct {
+	InfoHash string `json:"infoHash"`
+	Name     string `json:"name"`
+	Size     uint64 `json:"size"`
+	NFiles   int    `json:"nFiles"`
+	// DiscoveredOn is in Unix time.
+	DiscoveredOn int64              `json:"discoveredOn"`
+	Magnet       string             `json:"magnet"`
+	Source       persistence.Source `json:"source,omitempty"`
+}
+
+// NewTorrent returns the torrent of the metadata that is just fetched.
+func NewTorrent(infoHash []byte, name string, files []persistence.File, source persistence.Source) Torrent {
+	var size uint64
+	for _, file := range files {
+		size += uint64(file.Size)
+	}
+	infoHashHex := hex.EncodeToString(infoHash)
+	return Torrent{
+		InfoHash:     infoHashHex,
+		Name:         name,
+		Size:         size,
+		NFiles:       len(files),
+		DiscoveredOn: time.Now().Unix(),
+		Magnet:       "magnet:?xt=urn:btih:" + infoHashHex + "&dn=" + url.QueryEscape(name),
+		Source:       source,
+	}
+}
+
+// Event is the notification of a torrent.
+type Event struct {
+	Kind Kind `json:"event"`
+	// Watch is the name of the watch that the torrent matches, if the event is a KindMatch.
+	Watch string `json:"watch,omitempty"`
+	// Rule is the watch that the torrent matches (for the templates, see templateOf), or the zero
+	// Watch if the event is a KindTorrent.
+	Rule Watch `json:"-"`
+	Torrent
+}
+
+// Target is where the events are sent to.
+type Target interface {
+	// Send sends the event, and returns an error if it cannot be sent (after retrying, if the
+	// target sees fit). The events are sent one at a time.
+	Send(event Event) error
+	Close() error
+}
+
+// TargetFactory returns the target of the URL (whose scheme is the one that the target is for).
+type TargetFactory func(url_ *url.URL) (Target, error)
+
+// targets are the factories of the targets by the schemes of their URLs.
+var targets = map[string]TargetFactory{
+	"mqtt":          makeMQTTTarget,
+	"mqtts":         makeMQTTTarget,
+	"discord+https": makeChatTarget(discordService),
+	"discord+http":  makeChatTarget(discordService),
+	"slack+https":   makeChatTarget(slackService),
+	"slack+http":    makeChatTarget(slackService),
+	"matrix+https":  makeChatTarget(matrixService),
+	"matrix+http":   makeChatTarget(matrixService),
+	"smtp":          makeEmailTarget,
+	"smtps":         makeEmailTarget,
+}
+
+// ParseTarget returns the target of the URL, such as mqtt://broker:1883/magnetico (see mqttTarget),
+// discord+https://discord.com/api/webhooks/<ID>/<TOKEN> (see chatTarget), or
+// smtp://mail.example.com/?to=alice@example.com (see emailTarget). The parameters of the URL that are
+// common to all the targets are:
+//   - events: either `all` (the default), or `matches` to send the events of the watches only;
+//   - watches: the comma-separated names of the watches whose events (only) are sent, which implies
+//     `events=matches`.
+func ParseTarget(rawURL string) (*Subscription, error) {
+	url_, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the URL: %s", err.Error())
+	}
+
+	query := url_.Query()
+	subscription := &Subscription{scheme: url_.Scheme}
+	switch query.Get("events") {
+	case "", "all":
+	case "matches":
+		subscription.matchesOnly = true
+	default:
+		return nil, fmt.Errorf("events must be either all or matches")
+	}
+	if query.Get("watches") != "" {
+		subscription.matchesOnly = true
+		subscription.watches = make(map[string]bool)
+		for _, name := range strings.Split(query.Get("watches"), ",") {
+			subscription.watches[strings.TrimSpace(name)] = true
+		}
+	}
+	query.Del("events")
+	query.Del("watches")
+	url_.RawQuery = query.Encode()
+
+	factory, ok := targets[url_.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown target scheme: `%s`", url_.Scheme)
+	}
+	if subscription.target, err = factory(url_); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// Subscription is a target along with the events that it is sent.
+type Subscription struct {
+	target      Target
+	scheme      string
+	matchesOnly bool
+	watches     map[string]bool // nil if the events of all the watches are sent
+}
+
+// wants returns true if the event is to be sent to the target.
+func (s *Subscription) wants(event Event) bool {
+	if event.Kind != KindMatch {
+		return !s.matchesOnly
+	}
+	return s.watches == nil || s.watches[event.Watch]
+}
+
+// checkWatches returns an error if the subscription is of a watch that does not exist, as it is
+// most likely a typo.
+func (s *Subscription) checkWatches(watches []Watch) error {
+	for name := range s.watches {
+		found := false
+		for _, watch := range watches {
+			found = found || watch.Name == name
+		}
+		if !found {
+			return fmt.Errorf("unknown watch `%s` of the target `%s`", name, s.scheme)
+		}
+	}
+	return nil
+}
+
+// Notifier matches the torrents against the watches, and sends the events to the targets in the
+// background, each at its own pace.
+type Notifier struct {
+	watches       []Watch
+	subscriptions []*Subscription
+	queues        []chan Event
+	wg            sync.WaitGroup
+}
+
+// New starts sending the events to the subscriptions, unless a subscription is of a watch that does
+// not exist.
+func New(subscriptions []*Subscription, watches []Watch) (*Notifier, error) {
+	for _, subscription := range subscriptions {
+		if err := subscription.checkWatches(watches); err != nil {
+			return nil, err
+		}
+	}
+
+	n := &Notifier{watches: watches, subscriptions: subscriptions}
+	for _, subscription := range subscriptions {
+		queue := make(chan Event, queueCapacity)
+		n.queues = append(n.queues, queue)
+		n.wg.Add(1)
+		go n.send(subscription, queue)
+	}
+	return n, nil
+}
+
+func (n *Notifier) send(subscription *Subscription, queue chan Event) {
+	defer n.wg.Done()
+	for event := range queue {
+		if err := subscription.target.Send(event); err != nil {
+			notificationStats.Add(subscription.scheme+".failed", 1)
+			zap.L().Named("notify").Warn("Could not send the event!", zap.String("target", subscription.scheme),
+				zap.String("infoHash", event.InfoHash), zap.Error(err))
+			continue
+		}
+		notificationStats.Add(subscription.scheme+".sent", 1)
+	}
+}
+
+// Notify queues the events of the torrent: one of KindTorrent, and one of KindMatch for each watch
+// that it matches.
+func (n *Notifier) Notify(torrent Torrent) {
+	events := []Event{{Kind: KindTorrent, Torrent: torrent}}
+	for _, watch := range n.watches {
+		if watch.Matches(torrent.Name) {
+			events = append(events, Event{Kind: KindMatch, Watch: watch.Name, Rule: watch, Torrent: torrent})
+		}
+	}
+
+	for i, subscription := range n.subscriptions {
+		for _, event := range events {
+			if !subscription.wants(event) {
+				continue
+			}
+			select {
+			case n.queues[i] <- event:
+			default:
+				notificationStats.Add(subscription.scheme+".dropped", 1)
+			}
+		}
+	}
+}
+
+// Close sends the events that are queued (waiting for them for closeTimeout at most), and closes
+// the targets.
+func (n *Notifier) Close() {
+	for _, queue := range n.queues {
+		close(queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(closeTimeout):
+		zap.L().Named("notify").Warn("Gave up on sending the queued events.")
+	}
+
+	for _, subscription := range n.subscriptions {
+		if err := subscription.target.Close(); err != nil {
+			zap.L().Named("notify").Warn("Could not close the target!", zap.String("target", subscription.scheme),
+				zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeTarget records the events sent to it.
+type fakeTarget struct {
+	mutex  sync.Mutex
+	events []Event
+	closed bool
+}
+
+func (t *fakeTarget) Send(event Event) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.events = append(t.events, event)
+	return nil
+}
+
+func (t *fakeTarget) Close() error {
+	t.closed = true
+	return nil
+}
+
+func TestNotifier(t *testing.T) {
+	all, matches, debianOnly := new(fakeTarget), new(fakeTarget), new(fakeTarget)
+	ubuntu, _ := ParseWatch("ubuntu=ubuntu")
+	debian, _ := ParseWatch("debian=debian fedora")
+	n, err := New([]*Subscription{
+		{target: all, scheme: "fake"},
+		{target: matches, scheme: "fake", matchesOnly: true},
+		{target: debianOnly, scheme: "fake", matchesOnly: true, watches: map[string]bool{"debian": true}},
+	}, []Watch{ubuntu, debian})
+	if err != nil {
+		t.Fatalf("Could not create the notifier: %s", err.Error())
+	}
+
+	n.Notify(Torrent{InfoHash: "01", Name: "Ubuntu 20.04"})
+	n.Notify(Torrent{InfoHash: "02", Name: "Fedora 33"})
+	n.Notify(Torrent{InfoHash: "03", Name: "Debian on Fedora"})
+	n.Close()
+
+	kinds := func(events []Event) (kinds []string) {
+		for _, event := range events {
+			kinds = append(kinds, event.InfoHash+":"+string(event.Kind)+":"+event.Watch)
+		}
+		return
+	}
+	if got, expect := kinds(all.events), []string{"01:torrent:", "01:match:ubuntu", "02:torrent:", "03:torrent:",
+		"03:match:debian"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Events of all are wrong! Got %v (expected %v)", got, expect)
+	}
+	if got, expect := kinds(matches.events), []string{"01:match:ubuntu", "03:match:debian"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Events of the matches are wrong! Got %v (expected %v)", got, expect)
+	}
+	if got, expect := kinds(debianOnly.events), []string{"03:match:debian"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Events of the watch are wrong! Got %v (expected %v)", got, expect)
+	}
+	if !all.closed || !matches.closed || !debianOnly.closed {
+		t.Error("Targets should be closed!")
+	}
+
+	subscription, err := ParseTarget("mqtt://broker/?watches=ubuntu,debain")
+	if err != nil {
+		t.Fatalf("Could not parse the target: %s", err.Error())
+	}
+	if _, err = New([]*Subscription{subscription}, []Watch{ubuntu, debian}); err == nil {
+		t.Error("Subscription of an unknown watch should be refused!")
+	}
+}
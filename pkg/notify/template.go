@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// templateOf returns the template of the target that is supplied by the parameters of its URL (see
+// templateText), or the template of the text if none is supplied, or nil if the text is empty too.
+//
+// The templates (see text/template) are executed on the Event, whose Rule is the watch that the
+// torrent matches, with the functions:
+//   - size: formats the size, e.g. `{{size .Size}}` as "4.0 GiB";
+//   - time: formats the Unix time in RFC 3339, e.g. `{{time .DiscoveredOn}}`;
+//   - json: encodes the value in JSON, e.g. `{"title": {{json .Name}}}`;
+//   - escape: escapes the text for the markup of the target (if any).
+func templateOf(query url.Values, text string, escape func(s string) string) (*template.Template, error) {
+	text, err := templateText(query, text)
+	if err != nil || text == "" {
+		return nil, err
+	}
+	return parseTemplate("notification", text, escape, exampleEvents()...)
+}
+
+// templateText returns the text of the template that is supplied by the parameters of the URL of
+// a target, either inline as `template`, or as the path of the file to read it from as
+// `template_file`, or the text if none is supplied. The parameters are removed from the query.
+func templateText(query url.Values, text string) (string, error) {
+	if path := query.Get("template_file"); path != "" {
+		if query.Get("template") != "" {
+			return "", fmt.Errorf("template and template_file are mutually exclusive")
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read the template file: %s", err.Error())
+		}
+		text = string(contents)
+	} else if query.Get("template") != "" {
+		text = query.Get("template")
+	}
+	query.Del("template")
+	query.Del("template_file")
+	return text, nil
+}
+
+// parseTemplate parses the template (with the functions of templateOf), and validates it by
+// executing it on the examples, lest its mistakes go unnoticed until a torrent matches.
+func parseTemplate(name string, text string, escape func(s string) string, examples ...interface{}) (
+	*template.Template, error) {
+	if escape == nil {
+		escape = func(s string) string { return s }
+	}
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		"size":   func(size uint64) string { return humanize.IBytes(size) },
+		"time":   func(t int64) string { return time.Unix(t, 0).UTC().Format(time.RFC3339) },
+		"json":   templateJSON,
+		"escape": escape,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the template of the %s: %s", name, err.Error())
+	}
+
+	for _, example := range examples {
+		if err = tmpl.Execute(ioutil.Discard, example); err != nil {
+			return nil, fmt.Errorf("could not execute the template of the %s (on an example): %s", name,
+				err.Error())
+		}
+	}
+	return tmpl, nil
+}
+
+// exampleEvents are the events of both kinds that the templates of the events are validated on.
+func exampleEvents() []interface{} {
+	torrent := NewTorrent(make([]byte, 20), "Example", []persistence.File{{Size: 1, Path: "example"}},
+		persistence.SourceAnnounce)
+	watch, _ := ParseWatch("example=example")
+	return []interface{}{
+		Event{Kind: KindTorrent, Torrent: torrent},
+		Event{Kind: KindMatch, Watch: watch.Name, Rule: watch, Torrent: torrent},
+	}
+}
+
+func templateJSON(v interface{}) (string, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
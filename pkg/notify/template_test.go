@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplateOf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "magnetico-notify")
+	if err != nil {
+		t.Fatalf("Could not create the temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "message.tmpl")
+	if err = ioutil.WriteFile(path, []byte("{{.Rule.Name}}: {{.Name}}"), 0644); err != nil {
+		t.Fatalf("Could not write the template file: %s", err.Error())
+	}
+
+	watch, _ := ParseWatch("linux=ubuntu* -beta")
+	event := Event{Kind: KindMatch, Watch: watch.Name, Rule: watch, Torrent: Torrent{
+		Name:         `Ubuntu "Focal"`,
+		Size:         4 << 30,
+		DiscoveredOn: 1602756600,
+	}}
+
+	scenarios := []struct {
+		query     url.Values
+		expect    string
+		expectErr bool
+	}{
+		{url.Values{}, "default", false},
+		{url.Values{"template": {"{{.Rule.Query}} ({{size .Size}}, {{time .DiscoveredOn}})"}},
+			"ubuntu* -beta (4.0 GiB, 2020-10-15T10:10:00Z)", false},
+		{url.Values{"template": {`{"title": {{json .Name}}}`}}, `{"title": "Ubuntu \"Focal\""}`, false},
+		{url.Values{"template_file": {path}}, `linux: Ubuntu "Focal"`, false},
+		{url.Values{"template_file": {path}, "template": {"{{.Name}}"}}, "", true},
+		{url.Values{"template_file": {filepath.Join(dir, "nonexistent")}}, "", true},
+		{url.Values{"template": {"{{.Name"}}, "", true},
+		{url.Values{"template": {"{{.Nonexistent}}"}}, "", true},    // caught at load
+		{url.Values{"template": {"{{index .Name 100}}"}}, "", true}, // so are the errors of execution
+	}
+
+	for i, s := range scenarios {
+		tmpl, err := templateOf(s.query, "default", nil)
+		if (err != nil) != s.expectErr {
+			t.Errorf("Error of the instance #%d is wrong! Got %v (expected an error: %t)", i+1, err, s.expectErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if _, ok := s.query["template"]; ok {
+			t.Errorf("Parameters of the instance #%d should be removed!", i+1)
+		}
+		var sb strings.Builder
+		if err = tmpl.Execute(&sb, event); err != nil {
+			t.Errorf("Could not execute the template of the instance #%d: %s", i+1, err.Error())
+		} else if sb.String() != s.expect {
+			t.Errorf("Output of the instance #%d is wrong! Got %q (expected %q)", i+1, sb.String(), s.expect)
+		}
+	}
+
+	if tmpl, err := templateOf(url.Values{}, "", nil); tmpl != nil || err != nil {
+		t.Errorf("Template should be nil if none is supplied! Got %v (%v)", tmpl, err)
+	}
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// Watch is a search that the new torrents are matched against, so that the users are notified of
+// the ones that they are interested in as soon as they are discovered.
+type Watch struct {
+	Name  string
+	Query string
+
+	// terms are the tokens that the names of the torrents must have, and excluded the ones that
+	// they must not; the terms that end with an asterisk are prefixes.
+	terms, excluded []string
+}
+
+// ParseWatch parses the watch of `NAME=QUERY`, whose query is a list of the terms that the names
+// of the torrents must have (as words, case- and accent-insensitively), where the terms that start
+// with a hyphen are the ones that they must not have, and the ones that end with an asterisk are
+// the prefixes of the words (as in the searches), e.g. `ubuntu=ubuntu desktop* -beta`.
+func ParseWatch(s string) (Watch, error) {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return Watch{}, fmt.Errorf("watch must be in the form of NAME=QUERY: %s", s)
+	}
+	w := Watch{Name: strings.TrimSpace(s[:i]), Query: strings.TrimSpace(s[i+1:])}
+	// The name is a level of the topics of MQTT (see mqttTarget.topic), hence must not have the
+	// separator of the levels, the wildcards, or the null character.
+	if w.Name == "" || strings.ContainsAny(w.Name, mqttReserved) {
+		return Watch{}, fmt.Errorf("name of the watch must not be empty nor contain /, #, +, or NUL: %q", s)
+	}
+
+	for _, term := range strings.Fields(w.Query) {
+		excluded := strings.HasPrefix(term, "-")
+		prefix := strings.HasSuffix(term, "*")
+		tokens := tokenize(strings.TrimSuffix(strings.TrimPrefix(term, "-"), "*"))
+		for j, token := range tokens {
+			// Only the last token of a term is a prefix, as in "desktop-amd*".
+			if prefix && j == len(tokens)-1 {
+				token += "*"
+			}
+			if excluded {
+				w.excluded = append(w.excluded, token)
+			} else {
+				w.terms = append(w.terms, token)
+			}
+		}
+	}
+	if len(w.terms) == 0 {
+		return Watch{}, fmt.Errorf("query of the watch must have a term to match: %s", s)
+	}
+	return w, nil
+}
+
+// Matches returns true if the name of the torrent has all the terms of the watch, and none of the
+// excluded ones.
+func (w Watch) Matches(name string) bool {
+	tokens := tokenize(name)
+	for _, term := range w.terms {
+		if !hasToken(tokens, term) {
+			return false
+		}
+	}
+	for _, term := range w.excluded {
+		if hasToken(tokens, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenize splits the text into its words, lower-cased and without their diacritics, as the
+// unicode61 tokenizer of SQLite does (roughly) for the searches.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(persistence.FoldDiacritics(s)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func hasToken(tokens []string, term string) bool {
+	prefix := strings.HasSuffix(term, "*")
+	term = strings.TrimSuffix(term, "*")
+	for _, token := range tokens {
+		if token == term || prefix && strings.HasPrefix(token, term) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package notify
+
+import "testing"
+
+func TestWatchMatches(t *testing.T) {
+	scenarios := []struct {
+		query  string
+		name   string
+		expect bool
+	}{
+		{"ubuntu", "Ubuntu 20.04 Desktop", true},
+		{"ubuntu desktop", "ubuntu-20.04-desktop-amd64.iso", true},
+		{"ubuntu server", "ubuntu-20.04-desktop-amd64.iso", false},
+		{"ubuntu -beta", "Ubuntu 20.10 Beta", false},
+		{"ubuntu -beta", "Ubuntu 20.10", true},
+		{"ubu", "Ubuntu 20.10", false}, // the terms are words, not substrings
+		{"ubu*", "Ubuntu 20.10", true},
+		{"desktop-amd*", "ubuntu-desktop-amd64", true},
+		{"amelie", "Le Fabuleux Destin d'Amélie Poulain", true},
+		{"AMÉLIE", "amelie", true},
+	}
+
+	for i, s := range scenarios {
+		watch, err := ParseWatch("test=" + s.query)
+		if err != nil {
+			t.Fatalf("Could not parse the watch of the instance #%d: %s", i+1, err.Error())
+		}
+		if got := watch.Matches(s.name); got != s.expect {
+			t.Errorf("Match of the instance #%d is wrong! Got %t (expected %t)", i+1, got, s.expect)
+		}
+	}
+}
+
+func TestParseWatch(t *testing.T) {
+	scenarios := []struct {
+		flag      string
+		expectErr bool
+	}{
+		{"ubuntu=ubuntu", false},
+		{" ubuntu = ubuntu desktop ", false},
+		{"ubuntu", true},
+		{"=ubuntu", true},
+		{"ubuntu/lts=ubuntu", true}, // lest the name break the topics of MQTT
+		{"ubuntu#=ubuntu", true},
+		{"ubuntu+lts=ubuntu", true},
+		{"ubuntu\x00=ubuntu", true},
+		{"ubuntu=", true},
+		{"ubuntu=-beta", true}, // a watch must have a term to match
+	}
+
+	for i, s := range scenarios {
+		if _, err := ParseWatch(s.flag); (err != nil) != s.expectErr {
+			t.Errorf("Error of the instance #%d is wrong! Got %v (expected an error: %t)", i+1, err, s.expectErr)
+		}
+	}
+}
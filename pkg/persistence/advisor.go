@@ -0,0 +1,222 @@
+package persistence
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QueryStat is the statistics of a statement, such as of pg_stat_statements or of the slow-query
+// log (see parseQueryLimits), whose arguments are placeholders.
+type QueryStat struct {
+	Query     string
+	Calls     uint64
+	TotalTime time.Duration
+}
+
+// IndexAdvice is an index that is missing for the statements that filter, join, or order the rows
+// of the table by the column (see Database.AdviseIndexes).
+type IndexAdvice struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	// Trigram is true if the index is a trigram one (of pg_trgm) for the pattern matches (e.g.
+	// ILIKE), else a B-tree one.
+	Trigram bool `json:"trigram"`
+	// DDL is the statement that creates the index.
+	DDL string `json:"ddl"`
+	// Calls and TotalTime are the sums of the ones of the statements that would use the index, of
+	// which Queries are a few.
+	Calls     uint64        `json:"calls"`
+	TotalTime time.Duration `json:"totalTime"`
+	Queries   []string      `json:"queries"`
+}
+
+// maxAdviceQueries is the maximum number of the statements that are listed in an IndexAdvice.
+const maxAdviceQueries = 3
+
+// indexSchema is what the advisor knows of the schema of a database: the columns of its tables,
+// and the leading columns of its indices.
+type indexSchema struct {
+	columns map[string]map[string]bool
+	// indexed are the leading columns of the indices of the tables, as indexKey.
+	indexed map[string]map[string]bool
+}
+
+func newIndexSchema() *indexSchema {
+	return &indexSchema{columns: make(map[string]map[string]bool), indexed: make(map[string]map[string]bool)}
+}
+
+func (s *indexSchema) addColumn(table string, column string) {
+	if s.columns[table] == nil {
+		s.columns[table] = make(map[string]bool)
+	}
+	s.columns[table][column] = true
+}
+
+func (s *indexSchema) addIndex(table string, column string, trigram bool) {
+	if s.indexed[table] == nil {
+		s.indexed[table] = make(map[string]bool)
+	}
+	s.indexed[table][indexKey(column, trigram)] = true
+}
+
+func indexKey(column string, trigram bool) string {
+	if trigram {
+		return column + " gin_trgm_ops"
+	}
+	return column
+}
+
+var (
+	// advisorTables matches the tables (and their aliases) after FROM, JOIN, UPDATE, and the commas
+	// of the lists of the tables.
+	advisorTables = regexp.MustCompile(`(?i)(?:\bFROM|\bJOIN|\bUPDATE|,)\s+(\w+)(?:\s+(?:AS\s+)?(\w+))?`)
+	// advisorPredicates matches the (possibly qualified) columns that are compared.
+	advisorPredicates = regexp.MustCompile(
+		`(?i)(?:\b(\w+)\.)?\b(\w+)\s*(=|<>|!=|<=|>=|<|>|\bI?LIKE\b|\bIN\b|\bBETWEEN\b)`)
+	// advisorOperands matches the (possibly qualified) columns that are compared to, such as the
+	// ones of the other side of a join.
+	advisorOperands = regexp.MustCompile(`(?i)(?:=|<>|!=|<=|>=|<|>)\s*(?:(\w+)\.)?(\w+)\b`)
+	// advisorOrderBy matches the first (possibly qualified) column of an ORDER BY clause.
+	advisorOrderBy = regexp.MustCompile(`(?i)\bORDER\s+BY\s+(?:(\w+)\.)?(\w+)`)
+)
+
+// adviseIndexes returns the indices that are missing in the schema for the statements, the ones
+// that would save the most time first. The trigram indices are advised only if @trigram is true
+// (i.e. if the engine has pg_trgm), else the pattern matches are ignored.
+//
+// The statements are not parsed but scanned for the columns that they compare or order by, which
+// is good enough for the statements of magnetico (but not for any SQL).
+func adviseIndexes(stats []QueryStat, schema *indexSchema, trigram bool) []IndexAdvice {
+	advices := make(map[string]*IndexAdvice)
+	for _, stat := range stats {
+		seen := make(map[string]bool)
+		for _, column := range statementColumns(stat.Query, schema) {
+			if column.trigram && !trigram {
+				continue
+			}
+			key := column.table + "." + indexKey(column.name, column.trigram)
+			if seen[key] || schema.indexed[column.table][indexKey(column.name, column.trigram)] {
+				continue
+			}
+			seen[key] = true
+
+			advice, ok := advices[key]
+			if !ok {
+				advice = &IndexAdvice{
+					Table:   column.table,
+					Column:  column.name,
+					Trigram: column.trigram,
+					DDL:     indexDDL(column.table, column.name, column.trigram),
+					Queries: make([]string, 0, maxAdviceQueries),
+				}
+				advices[key] = advice
+			}
+			advice.Calls += stat.Calls
+			advice.TotalTime += stat.TotalTime
+			if len(advice.Queries) < maxAdviceQueries {
+				advice.Queries = append(advice.Queries, strings.Join(strings.Fields(stat.Query), " "))
+			}
+		}
+	}
+
+	sorted := make([]IndexAdvice, 0, len(advices))
+	for _, advice := range advices {
+		sorted = append(sorted, *advice)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].TotalTime != sorted[j].TotalTime {
+			return sorted[i].TotalTime > sorted[j].TotalTime
+		}
+		if sorted[i].Calls != sorted[j].Calls {
+			return sorted[i].Calls > sorted[j].Calls
+		}
+		return sorted[i].DDL < sorted[j].DDL
+	})
+	return sorted
+}
+
+type statementColumn struct {
+	table   string
+	name    string
+	trigram bool
+}
+
+// statementColumns returns the columns of the tables of the schema that the statement compares or
+// orders by, whether by a pattern match (i.e. trigram) or not.
+func statementColumns(query string, schema *indexSchema) []statementColumn {
+	// The aliases of the tables, including the tables themselves.
+	aliases := make(map[string]string)
+	var tables []string
+	for _, match := range advisorTables.FindAllStringSubmatch(query, -1) {
+		table := strings.ToLower(match[1])
+		if schema.columns[table] == nil {
+			continue
+		}
+		tables = append(tables, table)
+		aliases[table] = table
+		if alias := strings.ToLower(match[2]); alias != "" && !isKeyword(alias) {
+			aliases[alias] = table
+		}
+	}
+
+	resolve := func(qualifier string, name string) (string, bool) {
+		name = strings.ToLower(name)
+		if qualifier != "" {
+			table, ok := aliases[strings.ToLower(qualifier)]
+			return table, ok && schema.columns[table][name]
+		}
+		// An unqualified column is of the only table that has it.
+		var found string
+		for _, table := range tables {
+			if schema.columns[table][name] {
+				if found != "" && found != table {
+					return "", false
+				}
+				found = table
+			}
+		}
+		return found, found != ""
+	}
+
+	var columns []statementColumn
+	for _, match := range advisorPredicates.FindAllStringSubmatch(query, -1) {
+		if table, ok := resolve(match[1], match[2]); ok {
+			operator := strings.ToUpper(match[3])
+			trigram := operator == "LIKE" || operator == "ILIKE"
+			columns = append(columns, statementColumn{table, strings.ToLower(match[2]), trigram})
+		}
+	}
+	for _, match := range advisorOperands.FindAllStringSubmatch(query, -1) {
+		if table, ok := resolve(match[1], match[2]); ok {
+			columns = append(columns, statementColumn{table, strings.ToLower(match[2]), false})
+		}
+	}
+	for _, match := range advisorOrderBy.FindAllStringSubmatch(query, -1) {
+		if table, ok := resolve(match[1], match[2]); ok {
+			columns = append(columns, statementColumn{table, strings.ToLower(match[2]), false})
+		}
+	}
+	return columns
+}
+
+func isKeyword(word string) bool {
+	switch strings.ToUpper(word) {
+	case "WHERE", "ON", "INNER", "LEFT", "RIGHT", "FULL", "CROSS", "JOIN", "USING", "GROUP", "ORDER",
+		"LIMIT", "OFFSET", "SET", "UNION", "NATURAL", "WINDOW", "HAVING":
+		return true
+	}
+	return false
+}
+
+// indexDDL returns the statement that creates the index, which is named as the other indices of
+// magnetico are.
+func indexDDL(table string, column string, trigram bool) string {
+	if trigram {
+		return fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_%s_gin_trgm ON %s USING GIN (%s gin_trgm_ops);",
+			table, column, table, column)
+	}
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_%s ON %s (%s);", table, column, table, column)
+}
@@ -0,0 +1,121 @@
+//go:build fts5
+// +build fts5
+
+package persistence
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func advisorTestSchema() *indexSchema {
+	schema := newIndexSchema()
+	for _, column := range []string{"id", "info_hash", "name", "category", "discovered_on"} {
+		schema.addColumn("torrents", column)
+	}
+	for _, column := range []string{"id", "torrent_id", "path"} {
+		schema.addColumn("files", column)
+	}
+	schema.addIndex("torrents", "id", false)
+	schema.addIndex("torrents", "info_hash", false)
+	schema.addIndex("torrents", "name", true)
+	schema.addIndex("files", "id", false)
+	return schema
+}
+
+var adviseIndexesTest_instances = []struct {
+	query   string
+	trigram bool
+	ddls    []string
+}{
+	// The indexed columns are not advised.
+	{"SELECT 1 FROM torrents WHERE info_hash = $1;", true, []string{}},
+	{"SELECT name FROM torrents WHERE category = $1 ORDER BY discovered_on DESC;", true, []string{
+		"CREATE INDEX IF NOT EXISTS idx_torrents_category ON torrents (category);",
+		"CREATE INDEX IF NOT EXISTS idx_torrents_discovered_on ON torrents (discovered_on);",
+	}},
+	// The columns are resolved by the aliases, either side of the joins.
+	{"SELECT f.path FROM files f, torrents AS t WHERE t.id = f.torrent_id AND t.info_hash = $1;", true,
+		[]string{"CREATE INDEX IF NOT EXISTS idx_files_torrent_id ON files (torrent_id);"}},
+	{"SELECT path FROM files INNER JOIN torrents ON files.torrent_id = torrents.id WHERE path ILIKE $1;", true,
+		[]string{
+			"CREATE INDEX IF NOT EXISTS idx_files_path_gin_trgm ON files USING GIN (path gin_trgm_ops);",
+			"CREATE INDEX IF NOT EXISTS idx_files_torrent_id ON files (torrent_id);",
+		}},
+	// The pattern matches are ignored without the trigram indices.
+	{"SELECT path FROM files WHERE path LIKE ? ESCAPE '\\';", false, []string{}},
+	// The columns of the other tables, and the ambiguous ones, are ignored.
+	{"SELECT id FROM search_log WHERE query = $1;", true, []string{}},
+	{"SELECT 1 FROM files, torrents WHERE id = $1;", true, []string{}},
+}
+
+func TestAdviseIndexes(t *testing.T) {
+	schema := advisorTestSchema()
+	for i, instance := range adviseIndexesTest_instances {
+		advices := adviseIndexes([]QueryStat{{instance.query, 1, time.Second}}, schema, instance.trigram)
+		ddls := make([]string, 0)
+		for _, advice := range advices {
+			ddls = append(ddls, advice.DDL)
+		}
+		if !reflect.DeepEqual(ddls, instance.ddls) {
+			t.Errorf("Advices of the instance #%d are wrong! Got %v (expected %v)", i+1, ddls, instance.ddls)
+		}
+	}
+}
+
+func TestAdviseIndexesOrder(t *testing.T) {
+	advices := adviseIndexes([]QueryStat{
+		{"SELECT name FROM torrents WHERE category = $1;", 10, time.Second},
+		{"SELECT name FROM torrents WHERE discovered_on > $1;", 1, time.Minute},
+		{"SELECT name FROM torrents WHERE category = $1 LIMIT 10;", 5, time.Second},
+	}, advisorTestSchema(), true)
+
+	if len(advices) != 2 {
+		t.Fatalf("Number of the advices is wrong! Got %d (expected 2)", len(advices))
+	}
+	if advices[0].Column != "discovered_on" || advices[1].Column != "category" {
+		t.Errorf("Order of the advices is wrong! Got %s, %s (expected discovered_on, category)",
+			advices[0].Column, advices[1].Column)
+	}
+	if advices[1].Calls != 15 || advices[1].TotalTime != 2*time.Second || len(advices[1].Queries) != 2 {
+		t.Errorf("Statistics of the advice are wrong! Got %+v", advices[1])
+	}
+}
+
+func TestSqlite3AdviseIndexes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "magnetico-advisor")
+	if err != nil {
+		t.Fatalf("Could not create the temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := MakeDatabase("sqlite3://"+path.Join(dir, "database.sqlite3"), nil)
+	if err != nil {
+		t.Fatalf("Could not open the database: %s", err.Error())
+	}
+	defer db.Close()
+
+	queries := []QueryStat{
+		{"SELECT id FROM torrents WHERE info_hash = ?;", 1, time.Second},
+		{"SELECT id FROM torrents WHERE category = ?;", 1, time.Second},
+	}
+	advices, err := db.AdviseIndexes(queries, true)
+	if err != nil {
+		t.Fatalf("Could not advise the indices: %s", err.Error())
+	}
+	if len(advices) != 1 || advices[0].DDL != "CREATE INDEX IF NOT EXISTS idx_torrents_category ON torrents (category);" {
+		t.Fatalf("Advices are wrong! Got %+v", advices)
+	}
+
+	// The index is created, hence no longer advised.
+	if advices, err = db.AdviseIndexes(queries, false); err != nil {
+		t.Fatalf("Could not advise the indices: %s", err.Error())
+	}
+	if len(advices) != 0 {
+		t.Errorf("Advices are wrong! Got %+v (expected none)", advices)
+	}
+}
@@ -0,0 +1,52 @@
+package persistence
+
+// SearchLogEntry is a single search made by a user, as recorded for the search analytics.
+type SearchLogEntry struct {
+	// ClientHash identifies the client anonymously; it must NOT be reversible to the IP address or
+	// the username of the client.
+	ClientHash []byte
+	Query      string
+	NResults   uint
+	// LatencyMs is how long the search took, in milliseconds.
+	LatencyMs float64
+	// SearchedOn is in Unix time.
+	SearchedOn int64
+}
+
+// QueryStats is the aggregated statistics of the searches of the same query.
+type QueryStats struct {
+	Query     string `json:"query"`
+	NSearches uint   `json:"nSearches"`
+	// NClients is the number of distinct clients that searched for the query.
+	NClients       uint    `json:"nClients"`
+	AvgNResults    float64 `json:"avgNResults"`
+	AvgLatencyMs   float64 `json:"avgLatencyMs"`
+	LastSearchedOn int64   `json:"lastSearchedOn"`
+}
+
+// SearchAnalytics summarises the searches made since a point in time.
+type SearchAnalytics struct {
+	NSearches uint `json:"nSearches"`
+	NClients  uint `json:"nClients"`
+	// TopQueries are the most searched queries, in descending order of their number of searches.
+	TopQueries []QueryStats `json:"topQueries"`
+	// ZeroResultQueries are the most searched queries that yielded no results at all, in
+	// descending order of their number of searches.
+	ZeroResultQueries []QueryStats `json:"zeroResultQueries"`
+}
+
+// scanQueryStats scans the rows of (query, nSearches, nClients, avgNResults, avgLatencyMs,
+// lastSearchedOn) tuples.
+func scanQueryStats(rows *timedRows) ([]QueryStats, error) {
+	stats := make([]QueryStats, 0)
+	for rows.Next() {
+		var qs QueryStats
+		err := rows.Scan(&qs.Query, &qs.NSearches, &qs.NClients, &qs.AvgNResults, &qs.AvgLatencyMs,
+			&qs.LastSearchedOn)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, qs)
+	}
+	return stats, rows.Err()
+}
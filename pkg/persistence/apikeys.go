@@ -0,0 +1,48 @@
+package persistence
+
+// APIKey is a key to the API of magneticow that the operators issue to share access with others
+// (see Database.AddAPIKey). Only the hash of the key itself is stored, so it is not a part of it.
+type APIKey struct {
+	ID   uint64 `json:"id"`
+	Name string `json:"name"`
+	APIKeyLimits
+	// CreatedOn is in Unix time.
+	CreatedOn int64 `json:"createdOn"`
+	// RevokedOn is in Unix time, and is zero unless the key is revoked.
+	RevokedOn int64 `json:"revokedOn,omitempty"`
+	// NRequests and NRows are the usage of the key on the day (in UTC) that it is got on (see
+	// Database.AddAPIKeyUsage).
+	NRequests uint64 `json:"nRequests"`
+	NRows     uint64 `json:"nRows"`
+}
+
+// APIKeyLimits are the limits of an APIKey, where zero is unlimited.
+type APIKeyLimits struct {
+	// RequestsPerMinute is the maximum number of the requests in a minute.
+	RequestsPerMinute uint64 `json:"requestsPerMinute"`
+	// RowsPerDay is the maximum number of the rows (e.g. the torrents of the search results) in the
+	// responses on a day (in UTC).
+	RowsPerDay uint64 `json:"rowsPerDay"`
+}
+
+// apiKeyUsageDay returns the start of the day (in Unix time) of the time, by which the usage of the
+// API keys is counted.
+func apiKeyUsageDay(on int64) int64 {
+	return on - on%86400
+}
+
+// scanAPIKeys scans the rows of (id, name, requestsPerMinute, rowsPerDay, createdOn, revokedOn,
+// nRequests, nRows) tuples.
+func scanAPIKeys(rows *timedRows) ([]APIKey, error) {
+	keys := make([]APIKey, 0)
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(&key.ID, &key.Name, &key.RequestsPerMinute, &key.RowsPerDay, &key.CreatedOn,
+			&key.RevokedOn, &key.NRequests, &key.NRows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
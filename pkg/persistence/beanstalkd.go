@@ -29,7 +29,7 @@ func makeBeanstalkDatabase(url_ *url.URL) (Database, error) {
 		return nil, errors.Wrap(err, "Beanstalkd tube set error")
 	}
 
-	zap.L().Info(
+	zap.L().Named("persistence").Info(
 		"Beanstalkd connection created",
 		zap.String("host", url_.Hostname()),
 		zap.String("port", url_.Port()),
@@ -43,7 +43,7 @@ type beanstalkd struct {
 	bsQueue *gobeanstalk.Conn
 }
 
-func (s *beanstalkd) Engine() databaseEngine {
+func (s *beanstalkd) Engine() DatabaseEngine {
 	return Beanstalkd
 }
 
@@ -53,11 +53,12 @@ func (s *beanstalkd) DoesTorrentExist(infoHash []byte) (bool, error) {
 	return false, nil
 }
 
-func (s *beanstalkd) AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte) error {
+func (s *beanstalkd) AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) error {
 	payloadJson, err := json.Marshal(SimpleTorrentSummary{
 		InfoHash: hex.EncodeToString(infoHash),
 		Name:     name,
 		Files:    files,
+		Source:   source,
 	})
 
 	if err != nil {
@@ -70,11 +71,23 @@ func (s *beanstalkd) AddNewTorrent(infoHash []byte, name string, files []File, m
 		return errors.Wrap(err, "DB engine beanstalkd Put() error")
 	}
 
-	zap.L().Debug("New item put into the queue", zap.Uint64("job_id", jobId))
+	zap.L().Named("persistence").Debug("New item put into the queue", zap.Uint64("job_id", jobId))
 
 	return nil
 }
 
+func (s *beanstalkd) UpsertTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *beanstalkd) WithTx(fn func(tx Database) error) error {
+	return NotImplementedError
+}
+
+func (s *beanstalkd) SetDiscoveredOn(infoHash []byte, discoveredOn int64) error {
+	return NotImplementedError
+}
+
 func (s *beanstalkd) Close() error {
 	s.bsQueue.Quit()
 	return nil
@@ -84,6 +97,18 @@ func (s *beanstalkd) GetNumberOfTorrents() (uint, error) {
 	return 0, NotImplementedError
 }
 
+func (s *beanstalkd) GetTotalSize() (uint64, error) {
+	return 0, NotImplementedError
+}
+
+func (s *beanstalkd) GetNumberOfDiscoveredTorrents(from int64) (uint64, error) {
+	return 0, NotImplementedError
+}
+
+func (s *beanstalkd) GetRecentTorrents(limit uint) ([]TorrentMetadata, error) {
+	return nil, NotImplementedError
+}
+
 func (s *beanstalkd) QueryTorrents(
 	query string,
 	epoch int64,
@@ -92,10 +117,27 @@ func (s *beanstalkd) QueryTorrents(
 	limit uint,
 	lastOrderedValue *float64,
 	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
 ) ([]TorrentMetadata, error) {
 	return nil, NotImplementedError
 }
 
+func (s *beanstalkd) ExplainTorrents(
+	analyze bool,
+	query string,
+	epoch int64,
+	orderBy OrderingCriteria,
+	ascending bool,
+	limit uint,
+	lastOrderedValue *float64,
+	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
+) (*QueryPlan, error) {
+	return nil, NotImplementedError
+}
+
 func (s *beanstalkd) GetTorrent(infoHash []byte) (*TorrentMetadata, error) {
 	return nil, NotImplementedError
 }
@@ -104,6 +146,174 @@ func (s *beanstalkd) GetFiles(infoHash []byte) ([]File, error) {
 	return nil, NotImplementedError
 }
 
-func (s *beanstalkd) GetStatistics(from string, n uint) (*Statistics, error) {
+func (s *beanstalkd) GetMetadata(infoHash []byte) ([]byte, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) QueryFiles(infoHash []byte, pathContains string, offset uint, limit uint) ([]File, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) GetFileTree(infoHash []byte) (*FileTreeNode, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) GetStatistics(from string, n uint, loc *time.Location) (*Statistics, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) GetDashboard(from int64) (*Dashboard, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) GetFacets(query string, epoch int64, filters QueryFilters) (*Facets, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) GetStorageReport() (*StorageReport, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) GetPoolStats() (*PoolStats, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) AdviseIndexes(queries []QueryStat, create bool) ([]IndexAdvice, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) RefreshSynonyms() (uint64, error) {
+	return 0, NotImplementedError
+}
+
+func (s *beanstalkd) ReportTorrent(infoHash []byte, reason string) error {
+	return NotImplementedError
+}
+
+func (s *beanstalkd) GetModerationQueue(limit uint) ([]ModerationQueueItem, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) SetModerationState(infoHash []byte, state ModerationState) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *beanstalkd) RequestTorrent(infoHash []byte) (*TorrentRequest, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) GetTorrentRequest(infoHash []byte) (*TorrentRequest, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) GetPendingTorrentRequests(limit uint) ([]TorrentRequest, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) UpdateTorrentRequest(infoHash []byte, status RequestStatus) error {
+	return NotImplementedError
+}
+
+func (s *beanstalkd) AddFavorite(username string, infoHash []byte) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *beanstalkd) RemoveFavorite(username string, infoHash []byte) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *beanstalkd) IsFavorite(username string, infoHash []byte) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *beanstalkd) GetFavorites(username string, limit uint) ([]Favorite, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) AddInteraction(infoHash []byte, interaction Interaction, on int64) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *beanstalkd) GetInteractions(infoHash []byte, from int64) ([]Interactions, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) AddAPIKey(name string, keyHash []byte, limits APIKeyLimits, createdOn int64) (uint64, error) {
+	return 0, NotImplementedError
+}
+
+func (s *beanstalkd) GetAPIKey(keyHash []byte, on int64) (*APIKey, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) GetAPIKeys(on int64) ([]APIKey, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) UpdateAPIKey(id uint64, limits APIKeyLimits) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *beanstalkd) RevokeAPIKey(id uint64, on int64) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *beanstalkd) AddAPIKeyUsage(id uint64, nRequests uint64, nRows uint64, on int64) error {
+	return NotImplementedError
+}
+
+func (s *beanstalkd) AddSightings(sightings []Sighting, on int64) error {
+	return NotImplementedError
+}
+
+func (s *beanstalkd) UpdateTrending(since int64) error {
+	return NotImplementedError
+}
+
+func (s *beanstalkd) GetTrendingTorrents(limit uint) ([]TorrentMetadata, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) AddCrawlerStats(stats CrawlerStats) error {
+	return NotImplementedError
+}
+
+func (s *beanstalkd) GetCrawlerStats(from int64) ([]CrawlerStats, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) AddDiscovery(infoHash []byte, discovery Discovery) error {
+	return NotImplementedError
+}
+
+func (s *beanstalkd) SetText(infoHash []byte, text TorrentText) error {
+	return NotImplementedError
+}
+
+func (s *beanstalkd) ClaimFetch(infoHash []byte, claimant string, ttl time.Duration) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *beanstalkd) AcquireSlot(n int) (Slot, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) LogSearch(entry SearchLogEntry) error {
+	return NotImplementedError
+}
+
+func (s *beanstalkd) GetSearchAnalytics(since int64, limit uint) (*SearchAnalytics, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) PurgeSearchLog(before int64) error {
+	return NotImplementedError
+}
+
+func (s *beanstalkd) GetSuggestions(prefix string, limit uint) ([]string, error) {
+	return nil, NotImplementedError
+}
+
+func (s *beanstalkd) GetCorrections(query string, limit uint) ([]string, error) {
 	return nil, NotImplementedError
 }
@@ -0,0 +1,192 @@
+package persistence
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxStatisticsPeriods is the maximum @n of GetStatistics.
+const MaxStatisticsPeriods = 1000
+
+// statisticsWorkers is the maximum number of the queries of GetStatistics that are run
+// concurrently, which is at most the number of the connections of the pools of the engines.
+const statisticsWorkers = 3
+
+// bucket is a period of the statistics, from start (inclusive) to end (exclusive) in Unix time.
+type bucket struct {
+	label      string
+	start, end int64
+}
+
+// statisticsBuckets returns the n consecutive periods of the granularity from the one that t is in,
+// in the time zone of t. The periods are computed in Go (rather than by the date functions of the
+// engines, which differ in the weeks, for instance) so that the statistics are identical
+// regardless of the engine.
+func statisticsBuckets(t time.Time, gran Granularity, n uint) []bucket {
+	buckets := make([]bucket, 0, n)
+	start := periodStart(t, gran)
+	for i := uint(0); i < n; i++ {
+		end := nextPeriod(start, gran)
+		buckets = append(buckets, bucket{label: periodLabel(start, gran), start: start.Unix(), end: end.Unix()})
+		start = end
+	}
+	return buckets
+}
+
+// periodStart returns the start of the period of the granularity that t is in, where the weeks
+// start on Monday (as in ISO 8601).
+func periodStart(t time.Time, gran Granularity) time.Time {
+	switch gran {
+	case Year:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case Week:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, t.Location())
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	}
+}
+
+// nextPeriod returns the start of the period of the granularity that follows the one starting at
+// start. The days are calendar days, which are 23 or 25 hours long across the daylight saving time
+// transitions, whereas the hours are always an hour long.
+func nextPeriod(start time.Time, gran Granularity) time.Time {
+	switch gran {
+	case Year:
+		return start.AddDate(1, 0, 0)
+	case Month:
+		return start.AddDate(0, 1, 0)
+	case Week:
+		return start.AddDate(0, 0, 7)
+	case Day:
+		return start.AddDate(0, 0, 1)
+	default:
+		return start.Add(time.Hour)
+	}
+}
+
+// periodLabel returns the ISO 8601 representation of the period of the granularity starting at
+// start, which is also accepted by ParseISO8601. The hours that are repeated at the end of the
+// daylight saving time have the same label, hence their statistics are merged.
+func periodLabel(start time.Time, gran Granularity) string {
+	switch gran {
+	case Year:
+		return start.Format("2006")
+	case Month:
+		return start.Format("2006-01")
+	case Week:
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case Day:
+		return start.Format("2006-01-02")
+	default:
+		return start.Format("2006-01-02T15")
+	}
+}
+
+// bucketsValues returns the buckets as the rows of a VALUES list of (index, start, end), whose
+// times are converted by timef (e.g. to the timestamps of the engine), for the statistics to be
+// grouped by the buckets in the database.
+func bucketsValues(buckets []bucket, timef string) string {
+	rows := make([]string, len(buckets))
+	for i, b := range buckets {
+		rows[i] = fmt.Sprintf("(%d, "+timef+", "+timef+")", i, b.start, b.end)
+	}
+	return "VALUES " + strings.Join(rows, ", ")
+}
+
+// scanStatistics scans the statistics of the buckets from the rows of (index, total size, number
+// of torrents, number of files), where the buckets that have no rows are zero.
+func scanStatistics(rows *timedRows, buckets []bucket) (*Statistics, error) {
+	stats := NewStatistics()
+	for _, b := range buckets {
+		stats.NDiscovered[b.label], stats.TotalSize[b.label], stats.NFiles[b.label] = 0, 0, 0
+	}
+
+	for rows.Next() {
+		var i int
+		var tS, nD, nF uint64
+		if err := rows.Scan(&i, &tS, &nD, &nF); err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= len(buckets) {
+			return nil, fmt.Errorf("bucket index %d is out of range", i)
+		}
+		label := buckets[i].label
+		stats.NDiscovered[label] += nD
+		stats.TotalSize[label] += tS
+		stats.NFiles[label] += nF
+	}
+	return stats, rows.Err()
+}
+
+// bucketRanges splits the buckets into at most n contiguous ranges whose sizes differ by one at
+// most.
+func bucketRanges(buckets []bucket, n int) [][]bucket {
+	if n > len(buckets) {
+		n = len(buckets)
+	}
+	ranges := make([][]bucket, 0, n)
+	for i := 0; i < n; i++ {
+		ranges = append(ranges, buckets[i*len(buckets)/n:(i+1)*len(buckets)/n])
+	}
+	return ranges
+}
+
+// parallelStatistics computes the statistics of the buckets by querying the ranges of them (see
+// bucketRanges) concurrently, at most workers at once, where query returns the rows of a range as
+// scanStatistics expects them (indexed within the range). The ranges are queried one after another
+// if workers is one (e.g. in a transaction, whose statements cannot be run concurrently).
+func parallelStatistics(buckets []bucket, workers int, query func(buckets []bucket) (*timedRows, error)) (*Statistics, error) {
+	ranges := bucketRanges(buckets, workers)
+	results := make([]*Statistics, len(ranges))
+	errs := make([]error, len(ranges))
+
+	queryRange := func(i int) {
+		rows, err := query(ranges[i])
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		defer closeRows(rows)
+		results[i], errs[i] = scanStatistics(rows, ranges[i])
+	}
+	if len(ranges) == 1 {
+		queryRange(0)
+	} else {
+		var wg sync.WaitGroup
+		for i := range ranges {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				queryRange(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	stats := NewStatistics()
+	for i := range ranges {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		// The hours that are repeated at the end of the daylight saving time might fall into two
+		// ranges, hence the statistics are added up.
+		for label, n := range results[i].NDiscovered {
+			stats.NDiscovered[label] += n
+		}
+		for label, size := range results[i].TotalSize {
+			stats.TotalSize[label] += size
+		}
+		for label, n := range results[i].NFiles {
+			stats.NFiles[label] += n
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,102 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // lest the time zones are missing on the host
+)
+
+var statisticsBucketsTest_instances = []struct {
+	from   string
+	zone   string
+	n      uint
+	labels []string
+	// start is the start of the first bucket, and hours are the lengths of the buckets.
+	start string
+	hours []int
+}{
+	// The first week of 2021 starts on the 4th of January, and the last week of 2020 is the 53rd.
+	{"2021-W01", "UTC", 2, []string{"2021-W01", "2021-W02"}, "2021-01-04T00:00:00Z", []int{168, 168}},
+	{"2020-W53", "UTC", 2, []string{"2020-W53", "2021-W01"}, "2020-12-28T00:00:00Z", []int{168, 168}},
+	// April has 30 days.
+	{"2018-04", "UTC", 2, []string{"2018-04", "2018-05"}, "2018-04-01T00:00:00Z", []int{720, 744}},
+	{"2020", "UTC", 2, []string{"2020", "2021"}, "2020-01-01T00:00:00Z", []int{8784, 8760}},
+	// The day that the clocks go forward is 23 hours long.
+	{"2021-03-28", "Europe/London", 2, []string{"2021-03-28", "2021-03-29"}, "2021-03-28T00:00:00Z", []int{23, 24}},
+	// The hours start at the half hours in UTC in India.
+	{"2021-01-01T00", "Asia/Kolkata", 2, []string{"2021-01-01T00", "2021-01-01T01"}, "2020-12-31T18:30:00Z", []int{1, 1}},
+}
+
+func TestStatisticsBuckets(t *testing.T) {
+	for i, instance := range statisticsBucketsTest_instances {
+		loc, err := time.LoadLocation(instance.zone)
+		if err != nil {
+			t.Fatalf("Could not load the time zone of the instance #%d: %s", i+1, err.Error())
+		}
+		from, gran, err := ParseISO8601(instance.from)
+		if err != nil {
+			t.Fatalf("Could not parse the date of the instance #%d: %s", i+1, err.Error())
+		}
+
+		buckets := statisticsBuckets(InLocation(*from, loc), gran, instance.n)
+		if len(buckets) != len(instance.labels) {
+			t.Errorf("Number of the buckets of the instance #%d is wrong! Got %d (expected %d)", i+1,
+				len(buckets), len(instance.labels))
+			continue
+		}
+		if start := time.Unix(buckets[0].start, 0).UTC().Format(time.RFC3339); start != instance.start {
+			t.Errorf("Start of the instance #%d is wrong! Got %s (expected %s)", i+1, start, instance.start)
+		}
+		for j, b := range buckets {
+			if b.label != instance.labels[j] {
+				t.Errorf("Label of the bucket #%d of the instance #%d is wrong! Got %s (expected %s)", j+1, i+1,
+					b.label, instance.labels[j])
+			}
+			if hours := int((b.end - b.start) / 3600); hours != instance.hours[j] {
+				t.Errorf("Length of the bucket #%d of the instance #%d is wrong! Got %d hours (expected %d)", j+1,
+					i+1, hours, instance.hours[j])
+			}
+			if j > 0 && b.start != buckets[j-1].end {
+				t.Errorf("Bucket #%d of the instance #%d does not follow the previous one!", j+1, i+1)
+			}
+		}
+	}
+}
+
+func TestBucketRanges(t *testing.T) {
+	for i, instance := range []struct {
+		nBuckets int
+		n        int
+		sizes    []int
+	}{
+		{0, 3, []int{}},
+		{1, 3, []int{1}},
+		{2, 3, []int{1, 1}},
+		{7, 3, []int{2, 2, 3}},
+		{24, 3, []int{8, 8, 8}},
+		{5, 1, []int{5}},
+	} {
+		buckets := make([]bucket, instance.nBuckets)
+		for j := range buckets {
+			buckets[j].start = int64(j)
+		}
+
+		ranges := bucketRanges(buckets, instance.n)
+		if len(ranges) != len(instance.sizes) {
+			t.Errorf("Number of the ranges of the instance #%d is wrong! Got %d (expected %d)", i+1,
+				len(ranges), len(instance.sizes))
+			continue
+		}
+		next := int64(0)
+		for j, r := range ranges {
+			if len(r) != instance.sizes[j] {
+				t.Errorf("Size of the range #%d of the instance #%d is wrong! Got %d (expected %d)", j+1, i+1,
+					len(r), instance.sizes[j])
+			}
+			if len(r) > 0 && r[0].start != next {
+				t.Errorf("Range #%d of the instance #%d does not follow the previous one!", j+1, i+1)
+			}
+			next += int64(len(r))
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// InjectedError is the transient error that is injected by the chaos engine (see chaos).
+var InjectedError = errors.New("Error injected by chaos")
+
+// chaos injects latency, timeouts, and transient errors (InjectedError) into the calls to the
+// engine that it decorates, so that how the crawler and the web interface cope with a faulty
+// database can be tested. Its URL is the URL of the decorated engine prefixed by chaos:// (e.g.
+// chaos://postgres://...?chaos_error_rate=0.1), whose parameters are the rates (from 0 to 1) of:
+//
+//   - chaos_latency_rate: the calls that are delayed by up to chaos_latency (100ms by default);
+//   - chaos_timeout_rate: the calls that time out after chaos_timeout (30s by default, as the
+//     query_timeout of the engines does), failing with context.DeadlineExceeded;
+//   - chaos_error_rate: the calls that fail with InjectedError right away.
+//
+// The parameters are removed from the URL of the decorated engine. Neither Engine nor Close is ever
+// injected into, whereas the calls in the transactions (see WithTx) are.
+type chaos struct {
+	latencyRate float64
+	latency     time.Duration
+	timeoutRate float64
+	timeout     time.Duration
+	errorRate   float64
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+// chaosDatabase is the decorated engine (or a transaction of it).
+type chaosDatabase struct {
+	db    Database
+	chaos *chaos
+}
+
+// The chaos engine is registered apart from the other built-in engines, as it opens the engine that
+// it decorates (using openDatabase, which refers to the engines).
+func init() {
+	engines["chaos"] = makeChaosDatabase
+}
+
+func makeChaosDatabase(url_ *url.URL) (Database, error) {
+	decorated, err := url.Parse(strings.TrimPrefix(url_.String(), url_.Scheme+"://"))
+	if err != nil {
+		return nil, errors.Wrap(err, "url.Parse")
+	}
+	c, err := parseChaos(decorated)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openDatabase(decorated)
+	if err != nil {
+		return nil, err
+	}
+	return &chaosDatabase{db: db, chaos: c}, nil
+}
+
+// parseChaos parses the parameters of the chaos from the URL of the decorated engine, and removes
+// them from the URL.
+func parseChaos(url_ *url.URL) (*chaos, error) {
+	query := url_.Query()
+	c := &chaos{
+		latency: 100 * time.Millisecond,
+		timeout: defaultQueryTimeout,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	for name, rate := range map[string]*float64{
+		"chaos_latency_rate": &c.latencyRate,
+		"chaos_timeout_rate": &c.timeoutRate,
+		"chaos_error_rate":   &c.errorRate,
+	} {
+		if value := query.Get(name); value != "" {
+			var err error
+			if *rate, err = strconv.ParseFloat(value, 64); err != nil || *rate < 0 || *rate > 1 {
+				return nil, fmt.Errorf("%s must be in range [0, 1]", name)
+			}
+		}
+		query.Del(name)
+	}
+	for name, duration := range map[string]*time.Duration{
+		"chaos_latency": &c.latency,
+		"chaos_timeout": &c.timeout,
+	} {
+		if value := query.Get(name); value != "" {
+			var err error
+			if *duration, err = time.ParseDuration(value); err != nil || *duration < 0 {
+				return nil, fmt.Errorf("%s must be a non-negative duration (e.g. 1s)", name)
+			}
+		}
+		query.Del(name)
+	}
+
+	url_.RawQuery = query.Encode()
+	return c, nil
+}
+
+// inject delays the call and returns the error to fail it with, if any, as the dice decide.
+func (c *chaos) inject() error {
+	c.mutex.Lock()
+	var delay time.Duration
+	if c.rand.Float64() < c.latencyRate {
+		delay = time.Duration(c.rand.Int63n(int64(c.latency) + 1))
+	}
+	timesOut := c.rand.Float64() < c.timeoutRate
+	fails := c.rand.Float64() < c.errorRate
+	c.mutex.Unlock()
+
+	time.Sleep(delay)
+	if timesOut {
+		time.Sleep(c.timeout)
+		return errors.Wrap(context.DeadlineExceeded, "chaos")
+	}
+	if fails {
+		return InjectedError
+	}
+	return nil
+}
+
+func (db *chaosDatabase) Engine() DatabaseEngine {
+	return db.db.Engine()
+}
+
+func (db *chaosDatabase) Close() error {
+	return db.db.Close()
+}
+
+func (db *chaosDatabase) GetPoolStats() (*PoolStats, error) {
+	return db.db.GetPoolStats()
+}
+
+func (db *chaosDatabase) WithTx(fn func(tx Database) error) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.WithTx(func(tx Database) error {
+		return fn(&chaosDatabase{db: tx, chaos: db.chaos})
+	})
+}
+
+func (db *chaosDatabase) DoesTorrentExist(infoHash []byte) (bool, error) {
+	if err := db.chaos.inject(); err != nil {
+		return false, err
+	}
+	return db.db.DoesTorrentExist(infoHash)
+}
+
+func (db *chaosDatabase) AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.AddNewTorrent(infoHash, name, files, metadata, source)
+}
+
+func (db *chaosDatabase) UpsertTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) (bool, error) {
+	if err := db.chaos.inject(); err != nil {
+		return false, err
+	}
+	return db.db.UpsertTorrent(infoHash, name, files, metadata, source)
+}
+
+func (db *chaosDatabase) SetDiscoveredOn(infoHash []byte, discoveredOn int64) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.SetDiscoveredOn(infoHash, discoveredOn)
+}
+
+func (db *chaosDatabase) GetNumberOfTorrents() (uint, error) {
+	if err := db.chaos.inject(); err != nil {
+		return 0, err
+	}
+	return db.db.GetNumberOfTorrents()
+}
+
+func (db *chaosDatabase) GetTotalSize() (uint64, error) {
+	if err := db.chaos.inject(); err != nil {
+		return 0, err
+	}
+	return db.db.GetTotalSize()
+}
+
+func (db *chaosDatabase) GetNumberOfDiscoveredTorrents(from int64) (uint64, error) {
+	if err := db.chaos.inject(); err != nil {
+		return 0, err
+	}
+	return db.db.GetNumberOfDiscoveredTorrents(from)
+}
+
+func (db *chaosDatabase) GetRecentTorrents(limit uint) ([]TorrentMetadata, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetRecentTorrents(limit)
+}
+
+func (db *chaosDatabase) QueryTorrents(
+	query string,
+	epoch int64,
+	orderBy OrderingCriteria,
+	ascending bool,
+	limit uint,
+	lastOrderedValue *float64,
+	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
+) ([]TorrentMetadata, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.QueryTorrents(query, epoch, orderBy, ascending, limit, lastOrderedValue, lastID, filters, fields)
+}
+
+func (db *chaosDatabase) ExplainTorrents(
+	analyze bool,
+	query string,
+	epoch int64,
+	orderBy OrderingCriteria,
+	ascending bool,
+	limit uint,
+	lastOrderedValue *float64,
+	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
+) (*QueryPlan, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.ExplainTorrents(analyze, query, epoch, orderBy, ascending, limit, lastOrderedValue, lastID, filters, fields)
+}
+
+func (db *chaosDatabase) GetTorrent(infoHash []byte) (*TorrentMetadata, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetTorrent(infoHash)
+}
+
+func (db *chaosDatabase) GetFiles(infoHash []byte) ([]File, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetFiles(infoHash)
+}
+
+func (db *chaosDatabase) GetMetadata(infoHash []byte) ([]byte, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetMetadata(infoHash)
+}
+
+func (db *chaosDatabase) QueryFiles(infoHash []byte, pathContains string, offset uint, limit uint) ([]File, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.QueryFiles(infoHash, pathContains, offset, limit)
+}
+
+func (db *chaosDatabase) GetFileTree(infoHash []byte) (*FileTreeNode, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetFileTree(infoHash)
+}
+
+func (db *chaosDatabase) GetStatistics(from string, n uint, loc *time.Location) (*Statistics, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetStatistics(from, n, loc)
+}
+
+func (db *chaosDatabase) GetDashboard(from int64) (*Dashboard, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetDashboard(from)
+}
+
+func (db *chaosDatabase) GetFacets(query string, epoch int64, filters QueryFilters) (*Facets, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetFacets(query, epoch, filters)
+}
+
+func (db *chaosDatabase) GetStorageReport() (*StorageReport, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetStorageReport()
+}
+
+func (db *chaosDatabase) AdviseIndexes(queries []QueryStat, create bool) ([]IndexAdvice, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.AdviseIndexes(queries, create)
+}
+
+func (db *chaosDatabase) RefreshSynonyms() (uint64, error) {
+	if err := db.chaos.inject(); err != nil {
+		return 0, err
+	}
+	return db.db.RefreshSynonyms()
+}
+
+func (db *chaosDatabase) ReportTorrent(infoHash []byte, reason string) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.ReportTorrent(infoHash, reason)
+}
+
+func (db *chaosDatabase) GetModerationQueue(limit uint) ([]ModerationQueueItem, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetModerationQueue(limit)
+}
+
+func (db *chaosDatabase) SetModerationState(infoHash []byte, state ModerationState) (bool, error) {
+	if err := db.chaos.inject(); err != nil {
+		return false, err
+	}
+	return db.db.SetModerationState(infoHash, state)
+}
+
+func (db *chaosDatabase) RequestTorrent(infoHash []byte) (*TorrentRequest, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.RequestTorrent(infoHash)
+}
+
+func (db *chaosDatabase) GetTorrentRequest(infoHash []byte) (*TorrentRequest, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetTorrentRequest(infoHash)
+}
+
+func (db *chaosDatabase) GetPendingTorrentRequests(limit uint) ([]TorrentRequest, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetPendingTorrentRequests(limit)
+}
+
+func (db *chaosDatabase) UpdateTorrentRequest(infoHash []byte, status RequestStatus) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.UpdateTorrentRequest(infoHash, status)
+}
+
+func (db *chaosDatabase) AddFavorite(username string, infoHash []byte) (bool, error) {
+	if err := db.chaos.inject(); err != nil {
+		return false, err
+	}
+	return db.db.AddFavorite(username, infoHash)
+}
+
+func (db *chaosDatabase) RemoveFavorite(username string, infoHash []byte) (bool, error) {
+	if err := db.chaos.inject(); err != nil {
+		return false, err
+	}
+	return db.db.RemoveFavorite(username, infoHash)
+}
+
+func (db *chaosDatabase) IsFavorite(username string, infoHash []byte) (bool, error) {
+	if err := db.chaos.inject(); err != nil {
+		return false, err
+	}
+	return db.db.IsFavorite(username, infoHash)
+}
+
+func (db *chaosDatabase) GetFavorites(username string, limit uint) ([]Favorite, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetFavorites(username, limit)
+}
+
+func (db *chaosDatabase) AddInteraction(infoHash []byte, interaction Interaction, on int64) (bool, error) {
+	if err := db.chaos.inject(); err != nil {
+		return false, err
+	}
+	return db.db.AddInteraction(infoHash, interaction, on)
+}
+
+func (db *chaosDatabase) GetInteractions(infoHash []byte, from int64) ([]Interactions, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetInteractions(infoHash, from)
+}
+
+func (db *chaosDatabase) AddAPIKey(name string, keyHash []byte, limits APIKeyLimits, createdOn int64) (uint64, error) {
+	if err := db.chaos.inject(); err != nil {
+		return 0, err
+	}
+	return db.db.AddAPIKey(name, keyHash, limits, createdOn)
+}
+
+func (db *chaosDatabase) GetAPIKey(keyHash []byte, on int64) (*APIKey, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetAPIKey(keyHash, on)
+}
+
+func (db *chaosDatabase) GetAPIKeys(on int64) ([]APIKey, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetAPIKeys(on)
+}
+
+func (db *chaosDatabase) UpdateAPIKey(id uint64, limits APIKeyLimits) (bool, error) {
+	if err := db.chaos.inject(); err != nil {
+		return false, err
+	}
+	return db.db.UpdateAPIKey(id, limits)
+}
+
+func (db *chaosDatabase) RevokeAPIKey(id uint64, on int64) (bool, error) {
+	if err := db.chaos.inject(); err != nil {
+		return false, err
+	}
+	return db.db.RevokeAPIKey(id, on)
+}
+
+func (db *chaosDatabase) AddAPIKeyUsage(id uint64, nRequests uint64, nRows uint64, on int64) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.AddAPIKeyUsage(id, nRequests, nRows, on)
+}
+
+func (db *chaosDatabase) AddSightings(sightings []Sighting, on int64) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.AddSightings(sightings, on)
+}
+
+func (db *chaosDatabase) UpdateTrending(since int64) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.UpdateTrending(since)
+}
+
+func (db *chaosDatabase) GetTrendingTorrents(limit uint) ([]TorrentMetadata, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetTrendingTorrents(limit)
+}
+
+func (db *chaosDatabase) AddCrawlerStats(stats CrawlerStats) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.AddCrawlerStats(stats)
+}
+
+func (db *chaosDatabase) GetCrawlerStats(from int64) ([]CrawlerStats, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetCrawlerStats(from)
+}
+
+func (db *chaosDatabase) AddDiscovery(infoHash []byte, discovery Discovery) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.AddDiscovery(infoHash, discovery)
+}
+
+func (db *chaosDatabase) SetText(infoHash []byte, text TorrentText) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.SetText(infoHash, text)
+}
+
+func (db *chaosDatabase) ClaimFetch(infoHash []byte, claimant string, ttl time.Duration) (bool, error) {
+	if err := db.chaos.inject(); err != nil {
+		return false, err
+	}
+	return db.db.ClaimFetch(infoHash, claimant, ttl)
+}
+
+func (db *chaosDatabase) AcquireSlot(n int) (Slot, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.AcquireSlot(n)
+}
+
+func (db *chaosDatabase) LogSearch(entry SearchLogEntry) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.LogSearch(entry)
+}
+
+func (db *chaosDatabase) GetSearchAnalytics(since int64, limit uint) (*SearchAnalytics, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetSearchAnalytics(since, limit)
+}
+
+func (db *chaosDatabase) PurgeSearchLog(before int64) error {
+	if err := db.chaos.inject(); err != nil {
+		return err
+	}
+	return db.db.PurgeSearchLog(before)
+}
+
+func (db *chaosDatabase) GetSuggestions(prefix string, limit uint) ([]string, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetSuggestions(prefix, limit)
+}
+
+func (db *chaosDatabase) GetCorrections(query string, limit uint) ([]string, error) {
+	if err := db.chaos.inject(); err != nil {
+		return nil, err
+	}
+	return db.db.GetCorrections(query, limit)
+}
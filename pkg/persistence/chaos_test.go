@@ -0,0 +1,73 @@
+package persistence
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var parseChaosTest_instances = []struct {
+	url       string
+	decorated string // empty if the URL is not valid
+	errorRate float64
+	latency   time.Duration
+}{
+	{"postgres://localhost/magnetico?sslmode=disable&chaos_error_rate=0.25",
+		"postgres://localhost/magnetico?sslmode=disable", 0.25, 100 * time.Millisecond},
+	{"sqlite3:///tmp/database.sqlite3?chaos_latency=1s&chaos_latency_rate=1", "sqlite3:///tmp/database.sqlite3", 0,
+		time.Second},
+	{"sqlite3:///tmp/database.sqlite3?chaos_error_rate=2", "", 0, 0},
+	{"sqlite3:///tmp/database.sqlite3?chaos_timeout=soon", "", 0, 0},
+}
+
+func TestParseChaos(t *testing.T) {
+	for i, instance := range parseChaosTest_instances {
+		url_, err := url.Parse(instance.url)
+		if err != nil {
+			t.Fatalf("Could not parse the URL of the instance #%d: %s", i+1, err.Error())
+		}
+		c, err := parseChaos(url_)
+		if instance.decorated == "" {
+			if err == nil {
+				t.Errorf("The URL of the instance #%d is parsed! (expected an error)", i+1)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Could not parse the chaos of the instance #%d: %s", i+1, err.Error())
+			continue
+		}
+
+		if url_.String() != instance.decorated {
+			t.Errorf("The decorated URL of the instance #%d is wrong! Got %s (expected %s)", i+1, url_,
+				instance.decorated)
+		}
+		if c.errorRate != instance.errorRate || c.latency != instance.latency {
+			t.Errorf("The chaos of the instance #%d is wrong! Got %f and %s (expected %f and %s)", i+1, c.errorRate,
+				c.latency, instance.errorRate, instance.latency)
+		}
+	}
+}
+
+func TestChaosInject(t *testing.T) {
+	url_, _ := url.Parse("stdout://?chaos_latency=0")
+	c, err := parseChaos(url_)
+	if err != nil {
+		t.Fatalf("Could not parse the chaos: %s", err.Error())
+	}
+	if err = c.inject(); err != nil {
+		t.Errorf("An error is injected without any chaos! Got %s", err.Error())
+	}
+
+	c.errorRate = 1
+	if err = c.inject(); err != InjectedError {
+		t.Errorf("The injected error is wrong! Got %v (expected %v)", err, InjectedError)
+	}
+
+	c.timeoutRate, c.timeout = 1, time.Millisecond
+	if err = c.inject(); errors.Cause(err) != context.DeadlineExceeded {
+		t.Errorf("The injected timeout is wrong! Got %v (expected %v)", err, context.DeadlineExceeded)
+	}
+}
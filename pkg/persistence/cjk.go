@@ -0,0 +1,108 @@
+package persistence
+
+import (
+	"database/sql"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// parseCJKBigrams parses the cjk_bigrams parameter of the URL of a database (and removes it from
+// the URL), which enables splitting the CJK words of the queries into their bigrams (see
+// expandCJK), so that the names are searched by their bigrams (see cjkBigrams) for any word. It is
+// disabled by default, since the bigrams match across the boundaries of the words too, which makes
+// the searches less precise; the words of two characters match the bigrams either way.
+func parseCJKBigrams(url_ *url.URL) (bool, error) {
+	return parseFlag(url_, "cjk_bigrams")
+}
+
+// isCJK returns true if the rune is of the scripts that are (mostly) written without spaces between
+// the words, whose names are tokenized into a single word by the full-text indices: Han, Hiragana,
+// Katakana (along with its prolonged sound mark), and Hangul.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || r == 'ー'
+}
+
+// cjkBigrams returns the overlapping bigrams of the runs of the CJK characters of the name (see
+// isCJK), separated by spaces, or NULL if the name has none. The name of a torrent such as
+// "東京ガイド" is a single word to the full-text indices, hence cannot be searched for "東京" unless
+// its bigrams ("東京 京ガ ガイ イド") are indexed as well, which both engines store in the
+// cjk_bigrams column of the torrents. The runs of a single character are stored as they are.
+func cjkBigrams(name string) sql.NullString {
+	var bigrams []string
+	for _, run := range cjkRuns(name) {
+		bigrams = append(bigrams, runBigrams(run)...)
+	}
+	if len(bigrams) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: strings.Join(bigrams, " "), Valid: true}
+}
+
+// expandCJK replaces the runs of the CJK characters of the query with their bigrams (see
+// cjkBigrams), so that they are searched in the cjk_bigrams column. The rest of the query is kept as
+// it is, hence the bigrams of a run in a phrase (in quotes) are searched as a phrase as well, and a
+// prefix query (e.g. `東京ガ*`) is of the last bigram of the run.
+func expandCJK(query string) string {
+	var sb strings.Builder
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		if !isCJK(runes[i]) {
+			sb.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isCJK(runes[j]) {
+			j++
+		}
+		sb.WriteString(" " + strings.Join(runBigrams(runes[i:j]), " "))
+		if j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			sb.WriteRune(' ')
+		}
+		i = j
+	}
+	return sb.String()
+}
+
+// expandCJKSearch expands the query and the refinements of a search (see expandCJK).
+func expandCJKSearch(query string, filters QueryFilters) (string, QueryFilters) {
+	if len(filters.Refinements) > 0 {
+		refinements := make([]string, len(filters.Refinements))
+		for i, refinement := range filters.Refinements {
+			refinements[i] = expandCJK(refinement)
+		}
+		filters.Refinements = refinements
+	}
+	return expandCJK(query), filters
+}
+
+func cjkRuns(s string) [][]rune {
+	var runs [][]rune
+	var run []rune
+	for _, r := range s {
+		if isCJK(r) {
+			run = append(run, r)
+			continue
+		}
+		if len(run) > 0 {
+			runs = append(runs, run)
+			run = nil
+		}
+	}
+	if len(run) > 0 {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+func runBigrams(run []rune) []string {
+	if len(run) == 1 {
+		return []string{string(run)}
+	}
+	bigrams := make([]string, 0, len(run)-1)
+	for i := 0; i+1 < len(run); i++ {
+		bigrams = append(bigrams, string(run[i:i+2]))
+	}
+	return bigrams
+}
@@ -0,0 +1,93 @@
+//go:build fts5
+// +build fts5
+
+package persistence
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var cjkBigramsTest_instances = []struct {
+	name    string
+	bigrams sql.NullString
+}{
+	{"東京ガイド", sql.NullString{String: "東京 京ガ ガイ イド", Valid: true}},
+	{"Tokyo 東京 Guide 2020", sql.NullString{String: "東京", Valid: true}},
+	{"한국어 강좌", sql.NullString{String: "한국 국어 강좌", Valid: true}},
+	// The runs of a single character are kept as they are.
+	{"第1話", sql.NullString{String: "第 話", Valid: true}},
+	{"Ubuntu 20.04", sql.NullString{}},
+	{"Сборник", sql.NullString{}},
+}
+
+func TestCJKBigrams(t *testing.T) {
+	for i, instance := range cjkBigramsTest_instances {
+		if bigrams := cjkBigrams(instance.name); bigrams != instance.bigrams {
+			t.Errorf("Bigrams of the instance #%d are wrong! Got %+v (expected %+v)", i+1, bigrams, instance.bigrams)
+		}
+	}
+}
+
+var expandCJKTest_instances = []struct {
+	query    string
+	expanded string
+}{
+	{"ubuntu desktop", "ubuntu desktop"},
+	{"東京ガイド", " 東京 京ガ ガイ イド"},
+	{"東京 guide", " 東京 guide"},
+	{`"東京ガイド" 2020`, `" 東京 京ガ ガイ イド" 2020`},
+	{"東京ガ*", " 東京 京ガ*"},
+}
+
+func TestExpandCJK(t *testing.T) {
+	for i, instance := range expandCJKTest_instances {
+		if expanded := expandCJK(instance.query); expanded != instance.expanded {
+			t.Errorf("Expansion of the instance #%d is wrong! Got %q (expected %q)", i+1, expanded,
+				instance.expanded)
+		}
+	}
+}
+
+// TestCJKPrefixSearch searches the CJK names by the prefixes of their words, which are of SQLite
+// only (see the CJK cases of the kit for the rest).
+func TestCJKPrefixSearch(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		db, err := MakeDatabase(fmt.Sprintf("%s?cjk_bigrams=%t", testEngines(t)["sqlite3"], enabled), nil)
+		if err != nil {
+			t.Fatalf("Could not open the database: %s", err.Error())
+		}
+		for i, name := range []string{"東京ガイド", "京都ガイド"} {
+			infoHash := make([]byte, 20)
+			infoHash[0], infoHash[19] = 0xcf, byte(i)
+			files := []File{{Size: int64(i + 1), Path: name}}
+			if err = db.AddNewTorrent(infoHash, name, files, []byte("d4:name1:xe"), SourceUnknown); err != nil {
+				t.Fatalf("Could not add the torrent #%d: %s", i+1, err.Error())
+			}
+		}
+
+		results, err := db.QueryTorrents("ガイド*", time.Now().Unix()+60, ByTotalSize, true, 10, nil, nil,
+			QueryFilters{}, AllFields)
+		if err != nil {
+			t.Fatalf("Could not search for the prefix: %s", err.Error())
+		}
+		got := make([]string, len(results))
+		for j, result := range results {
+			got[j] = result.Name
+		}
+		expected := []string{}
+		if enabled {
+			expected = []string{"東京ガイド", "京都ガイド"}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("The results of the prefix (cjk_bigrams=%t) are wrong! Got %q (expected %q)", enabled, got,
+				expected)
+		}
+
+		if err = db.Close(); err != nil {
+			t.Errorf("Could not close the database: %s", err.Error())
+		}
+	}
+}
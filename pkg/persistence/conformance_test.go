@@ -0,0 +1,77 @@
+//go:build fts5
+// +build fts5
+
+package persistence_test
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+	"github.com/boramalper/magnetico/pkg/persistence/tests"
+)
+
+func TestSqlite3Conformance(t *testing.T) {
+	tests.Run(t, func(t *testing.T, params url.Values) persistence.Database {
+		dir, err := ioutil.TempDir("", "magnetico-conformance")
+		if err != nil {
+			t.Fatalf("Could not create the temporary directory: %s", err.Error())
+		}
+		t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+		url_ := url.URL{Scheme: "sqlite3", Path: path.Join(dir, "database.sqlite3"), RawQuery: params.Encode()}
+		db, err := persistence.MakeDatabase(url_.String(), nil)
+		if err != nil {
+			t.Fatalf("Could not open the database: %s", err.Error())
+		}
+		return db
+	})
+}
+
+// TestPostgresConformance runs the kit against the PostgreSQL database at MAGNETICO_TEST_POSTGRES,
+// if set. Each test is run in a schema of its own (that is dropped afterwards), which is put before
+// the public one (where pg_trgm is) in the search_path.
+func TestPostgresConformance(t *testing.T) {
+	rawURL := os.Getenv("MAGNETICO_TEST_POSTGRES")
+	if rawURL == "" {
+		t.Skip("MAGNETICO_TEST_POSTGRES is not set")
+	}
+
+	conn, err := sql.Open("pgx", rawURL)
+	if err != nil {
+		t.Fatalf("Could not connect to the database: %s", err.Error())
+	}
+	defer conn.Close()
+
+	n := 0
+	tests.Run(t, func(t *testing.T, params url.Values) persistence.Database {
+		n++
+		schema := fmt.Sprintf("magnetico_conformance_%d", n)
+		if _, err := conn.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE; CREATE SCHEMA " + schema + ";"); err != nil {
+			t.Fatalf("Could not create the schema: %s", err.Error())
+		}
+		t.Cleanup(func() { _, _ = conn.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE;") })
+
+		url_, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("Could not parse MAGNETICO_TEST_POSTGRES: %s", err.Error())
+		}
+		query := url_.Query()
+		for name, values := range params {
+			query[name] = values
+		}
+		query.Set("search_path", schema+",public")
+		url_.RawQuery = query.Encode()
+
+		db, err := persistence.MakeDatabase(url_.String(), nil)
+		if err != nil {
+			t.Fatalf("Could not open the database: %s", err.Error())
+		}
+		return db
+	})
+}
@@ -0,0 +1,178 @@
+package persistence
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ExpensiveQueryError is returned by QueryTorrents (and GetFacets) for the search queries that would
+// force the database to scan (most of) the torrents, such as the ones that consist of a single
+// character, so that a handful of them cannot pin the database.
+type ExpensiveQueryError struct {
+	Query string
+	// Reason is a helpful explanation of why the query is rejected, to be shown to the users.
+	Reason string
+	// Overloaded is true if the query is rejected only because the database is overloaded (see
+	// breaker), in which case it can be retried later.
+	Overloaded bool
+}
+
+func (e *ExpensiveQueryError) Error() string {
+	return fmt.Sprintf("query `%s` is too expensive: %s", e.Query, e.Reason)
+}
+
+// costModel is what makes the search queries expensive for an engine. The terms of the queries
+// that are shorter than minTermLength (in runes) match too many torrents to be searched for on
+// their own, and so do the prefix queries (e.g. `ubu*`) whose prefixes are shorter than
+// minPrefixLength.
+type costModel struct {
+	minTermLength   int
+	minPrefixLength int
+	// prefixes is true if the engine supports the prefix queries; the asterisks are ignored
+	// otherwise.
+	prefixes bool
+}
+
+var (
+	// sqlite3CostModel is for the full-text search of SQLite (FTS5), where the prefix queries scan
+	// the range of all the tokens that start with the prefix.
+	sqlite3CostModel = costModel{minTermLength: 2, minPrefixLength: 3, prefixes: true}
+	// postgresCostModel is for the full-text search of PostgreSQL; the similarity of the trigrams
+	// is not computed for the queries that are shorter than a trigram (see trigramMinLength).
+	postgresCostModel = costModel{minTermLength: 2}
+)
+
+// trigramMinLength is the length (in runes) of the shortest queries whose trigrams are matched by
+// PostgreSQL (using pg_trgm), as the shorter ones have no trigram of their own to look up in the
+// index, and would force a sequential scan instead.
+const trigramMinLength = 3
+
+// strict returns the cost model that is used while the breaker is open, which rejects the
+// moderately expensive queries too.
+func (model costModel) strict() costModel {
+	model.minTermLength++
+	model.minPrefixLength++
+	return model
+}
+
+// check returns an ExpensiveQueryError if the query is too expensive by the cost model, or nil.
+func (model costModel) check(query string) *ExpensiveQueryError {
+	terms := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '*'
+	})
+
+	cheap := false
+	for _, term := range terms {
+		if strings.HasPrefix(term, "*") && strings.Trim(term, "*") != "" {
+			return &ExpensiveQueryError{Query: query, Reason: fmt.Sprintf(
+				"leading wildcards (as in `%s`) are not supported; search for the whole words instead", term)}
+		}
+
+		word := strings.TrimRight(term, "*")
+		length := utf8.RuneCountInString(word)
+		if model.prefixes && word != term && length > 0 && length < model.minPrefixLength {
+			return &ExpensiveQueryError{Query: query, Reason: fmt.Sprintf(
+				"prefixes (as in `%s`) must be at least %d characters long", term, model.minPrefixLength)}
+		}
+		if length >= model.minTermLength {
+			cheap = true
+		}
+	}
+
+	// The short terms are cheap enough along with a longer one, which narrows the search down.
+	if !cheap {
+		return &ExpensiveQueryError{Query: query, Reason: fmt.Sprintf(
+			"at least one of the words must be at least %d characters long", model.minTermLength)}
+	}
+	return nil
+}
+
+const (
+	// breakerThreshold is the number of the searches that time out within breakerWindow after
+	// which the breaker opens, for breakerCooldown.
+	breakerThreshold = 5
+	breakerWindow    = time.Minute
+	breakerCooldown  = time.Minute
+)
+
+// breaker is a circuit breaker on the searches: once too many of them time out (which means that
+// the database is overloaded), the moderately expensive ones are rejected too for a while (see
+// costModel.strict), so that the database can recover.
+type breaker struct {
+	mutex     sync.Mutex
+	timeouts  []time.Time // within breakerWindow
+	openUntil time.Time
+}
+
+// fail records a search that has timed out at the time.
+func (b *breaker) fail(now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	recent := b.timeouts[:0]
+	for _, t := range b.timeouts {
+		if now.Sub(t) < breakerWindow {
+			recent = append(recent, t)
+		}
+	}
+	b.timeouts = append(recent, now)
+
+	if len(b.timeouts) >= breakerThreshold {
+		b.openUntil = now.Add(breakerCooldown)
+		b.timeouts = b.timeouts[:0]
+	}
+}
+
+// isOpen returns true if the moderately expensive searches are to be rejected at the time.
+func (b *breaker) isOpen(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return now.Before(b.openUntil)
+}
+
+// checkSearch returns an ExpensiveQueryError if the query (unless empty) or any of the refinements
+// of a search is too expensive by the cost model (or by its strict version, if the breaker is
+// open), or nil.
+func checkSearch(query string, refinements []string, model costModel, b *breaker) error {
+	if query != "" {
+		if err := checkQuery(query, model, b); err != nil {
+			return err
+		}
+	}
+	for _, refinement := range refinements {
+		if err := checkQuery(refinement, model, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkQuery(query string, model costModel, b *breaker) error {
+	if err := model.check(query); err != nil {
+		return err
+	}
+	if !b.isOpen(time.Now()) {
+		return nil
+	}
+	if err := model.strict().check(query); err != nil {
+		err.Overloaded = true
+		err.Reason += " while the database is overloaded"
+		return err
+	}
+	return nil
+}
+
+// recordIfTimedOut records a failed search in the breaker if it has taken (about) as long as the
+// timeout of the statements, as the drivers report the cancelled statements differently.
+func recordIfTimedOut(err error, startedOn time.Time, timeout time.Duration, b *breaker) {
+	if err == nil || timeout == 0 {
+		return
+	}
+	if now := time.Now(); now.Sub(startedOn) >= timeout {
+		b.fail(now)
+	}
+}
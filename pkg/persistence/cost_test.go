@@ -0,0 +1,54 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCostModel(t *testing.T) {
+	for i, test := range []struct {
+		model     costModel
+		query     string
+		expensive bool
+	}{
+		{sqlite3CostModel, "ubuntu", false},
+		{sqlite3CostModel, "ubuntu 2 x", false},
+		{sqlite3CostModel, "ubu*", false},
+		{sqlite3CostModel, "東京", false},
+		{sqlite3CostModel, "a", true},
+		{sqlite3CostModel, "a b c", true},
+		{sqlite3CostModel, "ubuntu u*", true},
+		{sqlite3CostModel, "*buntu", true},
+		{sqlite3CostModel, "!!!", true},
+		{postgresCostModel, "ubuntu u*", false},
+		{postgresCostModel, "a", true},
+		{sqlite3CostModel.strict(), "ubuntu", false},
+		{sqlite3CostModel.strict(), "ub", true},
+		{sqlite3CostModel.strict(), "ubu*", true},
+	} {
+		if err := test.model.check(test.query); (err != nil) != test.expensive {
+			t.Errorf("Cost of the instance #%d is wrong! Got %v (expected expensive: %t)", i+1, err, test.expensive)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var b breaker
+	now := time.Now()
+
+	for i := 0; i < breakerThreshold-1; i++ {
+		b.fail(now.Add(-breakerWindow)) // too long ago to count
+		b.fail(now)
+	}
+	if b.isOpen(now) {
+		t.Errorf("Breaker should not have opened before the threshold!")
+	}
+
+	b.fail(now)
+	if !b.isOpen(now) {
+		t.Errorf("Breaker should have opened at the threshold!")
+	}
+	if b.isOpen(now.Add(breakerCooldown)) {
+		t.Errorf("Breaker should have closed after the cooldown!")
+	}
+}
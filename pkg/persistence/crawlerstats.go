@@ -0,0 +1,19 @@
+package persistence
+
+import "time"
+
+// CrawlerStats are the operational statistics of the crawlers that share the database in an hour,
+// which are kept across the restarts of the crawlers (unlike the ones that are served by expvar).
+type CrawlerStats struct {
+	// Hour is the start of the hour (in Unix time).
+	Hour int64 `json:"hour"`
+	// NTrawled is the number of the infohashes trawled (i.e. seen on the DHT, sans the duplicates
+	// that are deduped).
+	NTrawled uint64 `json:"nTrawled"`
+	// NFetched is the number of the torrents whose metadata are fetched.
+	NFetched uint64 `json:"nFetched"`
+}
+
+// MaxCrawlerStatsWindow is how far back the statistics of the crawlers are returned by
+// GetCrawlerStats.
+const MaxCrawlerStatsWindow = 366 * 24 * time.Hour
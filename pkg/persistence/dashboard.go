@@ -0,0 +1,196 @@
+package persistence
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Category is the (rough) kind of the content of a torrent, decided by the extensions of the
+// files that make up the most of its size.
+type Category string
+
+const (
+	CategoryVideo    Category = "video"
+	CategoryAudio    Category = "audio"
+	CategoryImage    Category = "image"
+	CategoryDocument Category = "document"
+	CategoryArchive  Category = "archive"
+	CategorySoftware Category = "software"
+	CategoryOther    Category = "other"
+	// CategoryUnknown is the category of the torrents that are discovered before the categories
+	// were introduced.
+	CategoryUnknown Category = ""
+)
+
+var extensionCategories = map[string]Category{}
+
+func init() {
+	for category, extensions := range map[Category][]string{
+		CategoryAudio: {"mp3", "flac", "ogg", "opus", "m4a", "aac", "wav", "wma", "ape", "alac",
+			"aiff", "dsf", "m4b", "mka"},
+		CategoryImage: {"jpg", "jpeg", "png", "gif", "bmp", "webp", "tif", "tiff", "heic", "raw",
+			"cr2", "nef", "psd"},
+		CategoryDocument: {"pdf", "epub", "mobi", "azw3", "djvu", "doc", "docx", "txt", "cbr",
+			"cbz", "chm", "fb2", "odt", "rtf", "xls", "xlsx", "ppt", "pptx"},
+		CategorySoftware: {"apk", "dmg", "pkg", "deb", "rpm", "appimage", "bin", "cue", "nsp",
+			"xci", "cia"},
+	} {
+		for _, extension := range extensions {
+			extensionCategories[extension] = category
+		}
+	}
+	for extension := range videoExtensions {
+		extensionCategories[extension] = CategoryVideo
+	}
+	for extension := range archiveExtensions {
+		extensionCategories[extension] = CategoryArchive
+	}
+	for _, extension := range []string{"gz", "bz2", "xz", "tar", "tgz", "zst"} {
+		extensionCategories[extension] = CategoryArchive
+	}
+	for extension := range executableExtensions {
+		extensionCategories[extension] = CategorySoftware
+	}
+	extensionCategories["iso"] = CategorySoftware
+}
+
+// TorrentCategory returns the category of the torrent of the given files, which is computed once
+// at insert time.
+func TorrentCategory(files []File) Category {
+	sizes := make(map[Category]int64)
+	for _, file := range files {
+		category, ok := extensionCategories[fileExtension(file.Path)]
+		if !ok {
+			category = CategoryOther
+		}
+		sizes[category] += file.Size
+	}
+
+	best := CategoryOther
+	for category, size := range sizes {
+		// Break the ties by the name so that the category is deterministic.
+		if size > sizes[best] || (size == sizes[best] && category < best) {
+			best = category
+		}
+	}
+	return best
+}
+
+// Dashboard is the summary of the torrents discovered in a period, for the statistics dashboard.
+type Dashboard struct {
+	NDiscovered      uint64 `json:"nDiscovered"`
+	LastDiscoveredOn int64  `json:"lastDiscoveredOn"` // zero if none discovered yet
+
+	SizeDistribution []SizeBucket        `json:"sizeDistribution"`
+	Categories       map[Category]uint64 `json:"categories"`
+	// Sources are the numbers of the torrents discovered by each mechanism.
+	Sources map[Source]uint64 `json:"sources"`
+	// Countries are the numbers of the torrents discovered by the countries of the peers that
+	// announced them (see Discovery.Country), out of the ones whose discoveries are recorded.
+	Countries map[string]uint64 `json:"countries"`
+	// TopExtensions are the most common file extensions among the files of (at most)
+	// dashboardFileSample most recently discovered torrents of the period.
+	TopExtensions []ExtensionCount `json:"topExtensions"`
+}
+
+// SizeBucket is the number of the torrents whose total size is in range [MinSize, MaxSize), where
+// MaxSize is zero for the last bucket.
+type SizeBucket struct {
+	MinSize   uint64 `json:"minSize"`
+	MaxSize   uint64 `json:"maxSize"`
+	NTorrents uint64 `json:"nTorrents"`
+}
+
+type ExtensionCount struct {
+	Extension string `json:"extension"`
+	NFiles    uint64 `json:"nFiles"`
+	Size      uint64 `json:"size"`
+}
+
+// sizeBucketBounds are the lower bounds of the size buckets of the dashboard.
+var sizeBucketBounds = []uint64{
+	0,
+	1 << 20,   // 1 MiB
+	10 << 20,  // 10 MiB
+	100 << 20, // 100 MiB
+	1 << 30,   // 1 GiB
+	4 << 30,   // 4 GiB
+	10 << 30,  // 10 GiB
+	50 << 30,  // 50 GiB
+}
+
+// dashboardFileSample is the number of the torrents whose files are read to compute the top
+// extensions, lest the dashboard reads every file of the period.
+const dashboardFileSample = 5000
+
+// dashboardTopExtensions is the number of the top extensions returned.
+const dashboardTopExtensions = 20
+
+func newDashboard() *Dashboard {
+	dashboard := &Dashboard{
+		SizeDistribution: make([]SizeBucket, len(sizeBucketBounds)),
+		Categories:       make(map[Category]uint64),
+		Sources:          make(map[Source]uint64),
+		Countries:        make(map[string]uint64),
+		TopExtensions:    make([]ExtensionCount, 0),
+	}
+	for i, bound := range sizeBucketBounds {
+		dashboard.SizeDistribution[i].MinSize = bound
+		if i+1 < len(sizeBucketBounds) {
+			dashboard.SizeDistribution[i].MaxSize = sizeBucketBounds[i+1]
+		}
+	}
+	return dashboard
+}
+
+// sizeBucketCase returns an SQL CASE expression over total_size that evaluates to the index of
+// the size bucket of a torrent.
+func sizeBucketCase() string {
+	expr := "CASE"
+	for i := len(sizeBucketBounds) - 1; i > 0; i-- {
+		expr += " WHEN total_size >= " + strconv.FormatUint(sizeBucketBounds[i], 10) + " THEN " + strconv.Itoa(i)
+	}
+	return expr + " ELSE 0 END"
+}
+
+// countExtensions computes the top extensions out of the rows of (path, size).
+func countExtensions(rows *timedRows) ([]ExtensionCount, error) {
+	counts := make(map[string]*ExtensionCount)
+	for rows.Next() {
+		var path string
+		var size uint64
+		if err := rows.Scan(&path, &size); err != nil {
+			return nil, err
+		}
+
+		ext := fileExtension(path)
+		if ext == "" {
+			continue
+		}
+		count, ok := counts[ext]
+		if !ok {
+			count = &ExtensionCount{Extension: ext}
+			counts[ext] = count
+		}
+		count.NFiles++
+		count.Size += size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	top := make([]ExtensionCount, 0, len(counts))
+	for _, count := range counts {
+		top = append(top, *count)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].NFiles != top[j].NFiles {
+			return top[i].NFiles > top[j].NFiles
+		}
+		return top[i].Extension < top[j].Extension
+	})
+	if len(top) > dashboardTopExtensions {
+		top = top[:dashboardTopExtensions]
+	}
+	return top, nil
+}
@@ -0,0 +1,24 @@
+package persistence
+
+import "testing"
+
+var torrentCategoryTest_instances = []struct {
+	files    []File
+	category Category
+}{
+	{[]File{{Size: 1 << 30, Path: "Movie.2019.1080p.mkv"}, {Size: 1 << 10, Path: "Movie.2019.1080p.srt"}}, CategoryVideo},
+	{[]File{{Size: 1 << 20, Path: "01 - Track.flac"}, {Size: 1 << 20, Path: "02 - Track.flac"}, {Size: 1 << 19, Path: "cover.jpg"}}, CategoryAudio},
+	{[]File{{Size: 1 << 30, Path: "ubuntu-20.04-desktop-amd64.iso"}}, CategorySoftware},
+	{[]File{{Size: 1 << 10, Path: "README"}}, CategoryOther},
+	// Ties are broken by the name of the category.
+	{[]File{{Size: 1 << 20, Path: "book.pdf"}, {Size: 1 << 20, Path: "book.zip"}}, CategoryArchive},
+}
+
+func TestTorrentCategory(t *testing.T) {
+	for i, instance := range torrentCategoryTest_instances {
+		if category := TorrentCategory(instance.files); category != instance.category {
+			t.Errorf("Category of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, category,
+				instance.category)
+		}
+	}
+}
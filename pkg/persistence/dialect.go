@@ -0,0 +1,189 @@
+package persistence
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// dialect renders the parts of the logical queries (see queryBuilder) that differ between the SQL
+// engines, so that the queries are written once for both of them.
+type dialect struct {
+	// placeholder returns the placeholder of the nth argument (from 1), which can be used more
+	// than once.
+	placeholder func(n int) string
+	// unixTime converts a Unix time to the type of the time columns (e.g. discovered_on).
+	unixTime func(t int64) interface{}
+	// modifiedOn is the column that the epochs of the searches are compared to, so that the
+	// torrents that are modified after the epoch do not shift the pages of a search.
+	modifiedOn identifier
+	// match returns the condition that the name of the torrent matches the query, fuzzily (if
+	// supported by the engine) if fuzzy is true.
+	match func(q *queryBuilder, query string, fuzzy bool) string
+	// rankedMatches returns the join of the torrents that match the query along with the columns of
+	// their relevance (see ranking.columns) as idx, where the age of the torrents is by the epoch.
+	rankedMatches func(q *queryBuilder, r ranking, query string, epoch int64) string
+	// pathMatches returns the condition that any of the files of the torrent has a path that
+	// matches the LIKE pattern (escaped by backslashes), case-insensitively.
+	pathMatches func(q *queryBuilder, pattern string) string
+	// nonASCIIName is the condition that the name of the torrent is not in ASCII (see fillNames).
+	nonASCIIName string
+}
+
+var sqlite3Dialect = &dialect{
+	// The numbered parameters of SQLite (`?NNN`) can be used more than once, unlike `?`.
+	placeholder: func(n int) string { return "?" + strconv.Itoa(n) },
+	unixTime:    func(t int64) interface{} { return t },
+	modifiedOn:  "modified_on",
+	match: func(q *queryBuilder, query string, _ bool) string {
+		return "torrents.id IN (SELECT rowid FROM torrents_idx WHERE torrents_idx MATCH " + q.arg(query) + ")"
+	},
+	rankedMatches: func(q *queryBuilder, r ranking, query string, epoch int64) string {
+		// The epoch is an integer, hence it is safe to be formatted into the query.
+		ranking := r.columns("bm25(torrents_idx)", fmt.Sprintf("MAX(%d - discovered_on, 0)", epoch))
+		return `INNER JOIN (
+			SELECT torrents.id AS id
+				 , ` + ranking + `
+			FROM torrents_idx
+			INNER JOIN torrents ON torrents.id = torrents_idx.rowid
+			WHERE torrents_idx MATCH ` + q.arg(query) + `
+		) AS idx USING(id)`
+	},
+	// LIKE is case-insensitive for the ASCII characters only. There is no index of the paths, since
+	// the trigram tokenizer of FTS5 requires SQLite 3.34.0, hence the files are scanned.
+	pathMatches: func(q *queryBuilder, pattern string) string {
+		return "torrents.id IN (SELECT torrent_id FROM files WHERE path LIKE " + q.arg(pattern) + " ESCAPE '\\')"
+	},
+	nonASCIIName: "length(CAST(name AS BLOB)) <> length(name)",
+}
+
+// postgresSearchedName is the name of the torrents that PostgreSQL searches (and indexes), which is
+// folded if it has any diacritics (see foldedName).
+const postgresSearchedName = "COALESCE(folded_name, name)"
+
+// postgresSearchedDocument is the text of the torrents whose words PostgreSQL searches (and
+// indexes): the searched name, the bigrams of its CJK characters (see cjkBigrams), the canonical
+// terms of its synonyms (see synonyms), and the text of the torrent (see TorrentText).
+const postgresSearchedDocument = postgresSearchedName +
+	" || ' ' || COALESCE(cjk_bigrams, '') || ' ' || COALESCE(synonyms, '') || ' ' || COALESCE(text_content, '')"
+
+var postgresDialect = &dialect{
+	placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	unixTime:    func(t int64) interface{} { return time.Unix(t, 0) },
+	// The torrents of PostgreSQL are never modified after they are discovered.
+	modifiedOn: "discovered_on",
+	// The folded names are searched for the folded queries (see foldedName).
+	match: func(q *queryBuilder, query string, fuzzy bool) string {
+		placeholder := q.arg(FoldDiacritics(query))
+		match := "to_tsvector('simple', " + postgresSearchedDocument + ") @@ plainto_tsquery('simple', " + placeholder + ")"
+		if fuzzy && utf8.RuneCountInString(query) >= trigramMinLength {
+			match = "(" + match + " OR " + postgresSearchedName + " % " + placeholder + ")"
+		}
+		return match
+	},
+	rankedMatches: func(q *queryBuilder, r ranking, query string, epoch int64) string {
+		// The textual relevance is negated (like bm25() of SQLite, the lower the better) so that the
+		// torrents are ordered by relevance the same way in both engines. Uses the GIN indexes on
+		// the words and on the trigrams of the names.
+		queryPlaceholder := q.arg(FoldDiacritics(query))
+		ranking := r.columns(
+			fmt.Sprintf("-(ts_rank(to_tsvector('simple', %[1]s), plainto_tsquery('simple', %[3]s)) + similarity(%[2]s, %[3]s))",
+				postgresSearchedDocument, postgresSearchedName, queryPlaceholder),
+			fmt.Sprintf("GREATEST(EXTRACT(EPOCH FROM to_timestamp(%d) - discovered_on), 0)", epoch),
+		)
+		match := "to_tsvector('simple', " + postgresSearchedDocument + ") @@ plainto_tsquery('simple', " + queryPlaceholder + ")"
+		if utf8.RuneCountInString(query) >= trigramMinLength {
+			match += " OR " + postgresSearchedName + " % " + queryPlaceholder
+		}
+		return `INNER JOIN (
+			SELECT id
+				 , ` + ranking + `
+			FROM torrents
+			WHERE ` + match + `
+		) AS idx USING(id)`
+	},
+	// The torrents are semi-joined to the files whose paths match, rather than each torrent being
+	// checked for a matching file, so that the files are looked up in the trigram index of their
+	// paths (see pathIndex) at once.
+	pathMatches: func(q *queryBuilder, pattern string) string {
+		return "torrents.id IN (SELECT torrent_id FROM files WHERE path ILIKE " + q.arg(pattern) + " ESCAPE '\\')"
+	},
+	nonASCIIName: "octet_length(name) <> char_length(name)",
+}
+
+// searchQuery builds the query of QueryTorrents (see Database) in the dialect, along with the
+// function that returns the destinations of the columns of the query to be scanned into.
+func searchQuery(
+	d *dialect,
+	r ranking,
+	query string,
+	epoch int64,
+	orderBy OrderingCriteria,
+	ascending bool,
+	limit uint,
+	lastOrderedValue *float64,
+	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
+) (string, []interface{}, func(*TorrentMetadata) []interface{}, error) {
+	if query == "" && orderBy == ByRelevance {
+		return "", nil, nil, fmt.Errorf("torrents cannot be ordered by relevance when the query is empty")
+	}
+	if (lastOrderedValue == nil) != (lastID == nil) {
+		return "", nil, nil, fmt.Errorf("lastOrderedValue and lastID should be supplied together, if supplied")
+	}
+	orderOn, err := orderColumn(orderBy)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	idx := ""
+	if query != "" {
+		idx = "idx"
+	}
+	columns, scanDests := queryColumns(fields, orderBy, idx)
+
+	q := newQueryBuilder(d, "torrents")
+	q.selectColumnList(columns)
+	if query != "" {
+		q.join(d.rankedMatches(q, r, query, epoch))
+	}
+	q.compare(d.modifiedOn, lessOrEqual, d.unixTime(epoch))
+	q.filter(filters)
+	if lastID != nil {
+		// The cursors of the times are in Unix time.
+		var lastValue interface{} = *lastOrderedValue
+		if orderBy == ByDiscoveredOn {
+			lastValue = d.unixTime(int64(*lastOrderedValue))
+		}
+		op := less
+		if ascending {
+			op = greater
+		}
+		q.compareRow([]identifier{orderOn, "id"}, op, lastValue, *lastID)
+	}
+	q.orderByColumn(orderOn, ascending)
+	q.orderByColumn("id", ascending)
+	q.limitTo(limit)
+
+	sqlQuery, args, err := q.build()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return sqlQuery, args, scanDests, nil
+}
+
+// facetsQuery returns the builder of the query of the torrents that QueryTorrents would return for
+// the same query, epoch, and filters (regardless of the pagination), whose id, total_size,
+// category, and discovered_on are selected for GetFacets (see Database).
+func facetsQuery(d *dialect, query string, epoch int64, filters QueryFilters) *queryBuilder {
+	q := newQueryBuilder(d, "torrents")
+	q.selectColumns("torrents.id", "total_size", "category", "discovered_on", "album_artist", "album_title")
+	q.compare(d.modifiedOn, lessOrEqual, d.unixTime(epoch))
+	if query != "" {
+		q.whereFragment(d.match(q, query, true))
+	}
+	q.filter(filters)
+	return q
+}
@@ -0,0 +1,178 @@
+//go:build fts5
+// +build fts5
+
+package persistence
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+// dialectOf returns the connection and the dialect of the database.
+func dialectOf(t *testing.T, db Database) (*timedConn, *dialect) {
+	switch db := db.(type) {
+	case *instrumentedDatabase:
+		return dialectOf(t, db.db)
+	case *sqlite3Database:
+		return db.conn, sqlite3Dialect
+	case *postgresDatabase:
+		return db.conn, postgresDialect
+	default:
+		t.Fatalf("%T has no dialect", db)
+		return nil, nil
+	}
+}
+
+// TestDialects executes the queries that are built in the dialects against the engines (see
+// testEngines), which must return the same torrents.
+func TestDialects(t *testing.T) {
+	names := []string{"ubuntu desktop", "ubuntu server", "debian desktop", "debian server", "fedora workstation"}
+	since, until := time.Now().Unix()-3600, time.Now().Unix()+3600
+	maxSpamScore := 1.0
+	lastOrderedValue, lastID := 3.0, uint64(3)
+
+	testCases := []struct {
+		query            string
+		orderBy          OrderingCriteria
+		ascending        bool
+		lastOrderedValue *float64
+		lastID           *uint64
+		filters          QueryFilters
+		expected         []string
+	}{
+		{"", ByTotalSize, false, nil, nil, QueryFilters{},
+			[]string{"fedora workstation", "debian server", "debian desktop", "ubuntu server", "ubuntu desktop"}},
+		{"", ByTotalSize, true, &lastOrderedValue, &lastID, QueryFilters{},
+			[]string{"debian server", "fedora workstation"}},
+		{"", ByDiscoveredOn, false, nil, nil, QueryFilters{DiscoveredSince: &since, DiscoveredUntil: &until},
+			[]string{"fedora workstation", "debian server", "debian desktop", "ubuntu server", "ubuntu desktop"}},
+		{"", ByNFiles, true, nil, nil, QueryFilters{MaxSpamScore: &maxSpamScore, Refinements: []string{"desktop"}},
+			[]string{"ubuntu desktop", "debian desktop"}},
+		{"ubuntu", ByTotalSize, false, nil, nil, QueryFilters{}, []string{"ubuntu server", "ubuntu desktop"}},
+		{"ubuntu", ByRelevance, true, nil, nil, QueryFilters{}, []string{"ubuntu desktop", "ubuntu server"}},
+		{"debian", ByTotalSize, false, nil, nil, QueryFilters{Refinements: []string{"server"}},
+			[]string{"debian server"}},
+		{"debian", ByTotalSize, false, nil, nil, QueryFilters{OnlyVerified: true}, []string{}},
+		{"", ByTotalSize, false, nil, nil, QueryFilters{PathContains: "SKTO"},
+			[]string{"debian desktop", "ubuntu desktop"}},
+		{"", ByTotalSize, false, nil, nil, QueryFilters{PathContains: "n_s"}, []string{}},
+	}
+
+	for engine, url := range testEngines(t) {
+		db, err := MakeDatabase(url, nil)
+		if err != nil {
+			t.Fatalf("Could not open the %s database: %s", engine, err.Error())
+		}
+		conn, d := dialectOf(t, db)
+
+		for i, name := range names {
+			infoHash := make([]byte, 20)
+			infoHash[0], infoHash[19] = 0xfd, byte(i)
+			files := []File{{Size: int64(i + 1), Path: name}}
+			if err = db.AddNewTorrent(infoHash, name, files, []byte("d4:name1:xe"), SourceUnknown); err != nil {
+				t.Fatalf("Could not add the torrent #%d to the %s database: %s", i+1, engine, err.Error())
+			}
+			// The torrents are discovered a second apart, so that they are ordered by their discovery.
+			setDiscoveredOn(t, db, infoHash, time.Now().Add(time.Duration(i-len(names))*time.Second))
+		}
+		epoch := time.Now().Unix() + 60
+
+		for i, tc := range testCases {
+			sqlQuery, args, _, err := searchQuery(d, ranking{recencyHalfLife: time.Hour}, tc.query, epoch, tc.orderBy,
+				tc.ascending, 10, tc.lastOrderedValue, tc.lastID, tc.filters, 0)
+			if err != nil {
+				t.Fatalf("Could not build the query #%d for %s: %s", i+1, engine, err.Error())
+			}
+			got := queryNames(t, conn, "SELECT name FROM ("+sqlQuery+") AS results", args)
+			if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+				t.Errorf("The results of the query #%d on %s are wrong! Got %q (expected %q)", i+1, engine, got,
+					tc.expected)
+			}
+
+			q := facetsQuery(d, tc.query, epoch, tc.filters)
+			matches, args, err := q.build()
+			if err != nil {
+				t.Fatalf("Could not build the facets query #%d for %s: %s", i+1, engine, err.Error())
+			}
+			got = queryNames(t, conn, "SELECT name FROM torrents WHERE id IN (SELECT id FROM ("+matches+
+				") AS matches)", args)
+			expected := append([]string{}, tc.expected...)
+			if tc.lastID != nil {
+				// The facets are regardless of the pagination.
+				expected = append([]string{}, names...)
+			}
+			sort.Strings(got)
+			sort.Strings(expected)
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("The matches of the facets query #%d on %s are wrong! Got %q (expected %q)", i+1, engine,
+					got, expected)
+			}
+		}
+
+		if err = db.Close(); err != nil {
+			t.Errorf("Could not close the %s database: %s", engine, err.Error())
+		}
+	}
+}
+
+// TestExplainTorrents explains a search on the engines (see testEngines), whose plans must not be
+// empty, and must be measured if analyzed.
+func TestExplainTorrents(t *testing.T) {
+	for engine, url := range testEngines(t) {
+		db, err := MakeDatabase(url, nil)
+		if err != nil {
+			t.Fatalf("Could not open the %s database: %s", engine, err.Error())
+		}
+
+		infoHash := make([]byte, 20)
+		infoHash[0] = 0xfe
+		if err = db.AddNewTorrent(infoHash, "ubuntu desktop", []File{{Size: 1, Path: "ubuntu.iso"}},
+			[]byte("d4:name1:xe"), SourceUnknown); err != nil {
+			t.Fatalf("Could not add the torrent to the %s database: %s", engine, err.Error())
+		}
+
+		for _, analyze := range []bool{false, true} {
+			plan, err := db.ExplainTorrents(analyze, "ubuntu", time.Now().Unix()+60, ByRelevance, true, 10, nil, nil,
+				QueryFilters{}, AllFields)
+			if err != nil {
+				t.Fatalf("Could not explain the search on %s: %s", engine, err.Error())
+			}
+			if plan.SQL == "" || len(plan.Plan) == 0 {
+				t.Errorf("The plan on %s is empty! Got %+v", engine, plan)
+			}
+			if plan.Analyzed != analyze {
+				t.Errorf("Analyzed of the plan on %s is wrong! Got %t (expected %t)", engine, plan.Analyzed, analyze)
+			}
+			if analyze && plan.Rows != 1 {
+				t.Errorf("Rows of the plan on %s is wrong! Got %d (expected 1)", engine, plan.Rows)
+			}
+		}
+
+		if err = db.Close(); err != nil {
+			t.Errorf("Could not close the %s database: %s", engine, err.Error())
+		}
+	}
+}
+
+func queryNames(t *testing.T, conn *timedConn, query string, args []interface{}) []string {
+	rows, err := conn.Query(query, args...)
+	if err != nil {
+		t.Fatalf("Could not execute `%s`: %s", query, err.Error())
+	}
+	defer closeRows(rows)
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			t.Fatalf("Could not scan the name: %s", err.Error())
+		}
+		names = append(names, name)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatalf("Could not execute `%s`: %s", query, err.Error())
+	}
+	return names
+}
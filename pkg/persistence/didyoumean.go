@@ -0,0 +1,151 @@
+package persistence
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// queryWordRE matches the words of a search query that are candidates to be corrected; the
+// operators (such as quotes, asterisks, and carets) are left intact.
+var queryWordRE = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// termFrequency is a term in the vocabulary of the torrent names, along with the number of the
+// torrents whose names contain it.
+type termFrequency struct {
+	term      string
+	frequency uint
+}
+
+// maxEditDistance is the maximum number of edits that a misspelt word can be away from its
+// correction. Short words are not corrected at all, for nearly every other short word is a
+// couple of edits away from them.
+func maxEditDistance(word string) int {
+	switch n := utf8.RuneCountInString(word); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// isQueryOperator returns true if the word at [start, end) of the query is an operator (AND, OR,
+// NOT) or a prefix (followed by an asterisk) that should not be corrected.
+func isQueryOperator(query string, start, end int) bool {
+	word := query[start:end]
+	if word == "AND" || word == "OR" || word == "NOT" {
+		return true
+	}
+	return strings.HasPrefix(strings.TrimLeft(query[end:], " "), "*")
+}
+
+// correctQuery corrects the words of the query one by one (see isQueryOperator), and returns the
+// corrected query, or none if no word is corrected (or if @limit is zero).
+func correctQuery(query string, limit uint, correctWord func(word string) (string, error)) ([]string, error) {
+	var corrected strings.Builder
+	nCorrections, last := 0, 0
+	for _, loc := range queryWordRE.FindAllStringIndex(query, -1) {
+		start, end := loc[0], loc[1]
+		if isQueryOperator(query, start, end) {
+			continue
+		}
+
+		correction, err := correctWord(strings.ToLower(query[start:end]))
+		if err != nil {
+			return nil, err
+		} else if correction == "" {
+			continue
+		}
+
+		corrected.WriteString(query[last:start])
+		corrected.WriteString(correction)
+		last = end
+		nCorrections++
+	}
+
+	if nCorrections == 0 || limit == 0 {
+		return []string{}, nil
+	}
+	corrected.WriteString(query[last:])
+	return []string{corrected.String()}, nil
+}
+
+// closestTerm returns the candidate that is closest to the word, within maxEditDistance(word)
+// edits; the more frequent candidate wins if there are multiple candidates equally close.
+func closestTerm(word string, candidates []termFrequency) (string, bool) {
+	maxDistance := maxEditDistance(word)
+	if maxDistance == 0 {
+		return "", false
+	}
+
+	var best termFrequency
+	bestDistance := maxDistance + 1
+	for _, candidate := range candidates {
+		d := editDistance(word, candidate.term, maxDistance)
+		if d == 0 {
+			return "", false // the word is not misspelt after all
+		}
+		if d < bestDistance || (d == bestDistance && candidate.frequency > best.frequency) {
+			best, bestDistance = candidate, d
+		}
+	}
+
+	if bestDistance > maxDistance {
+		return "", false
+	}
+	return best.term, true
+}
+
+// editDistance returns the optimal string alignment distance (i.e. the Levenshtein distance that
+// also counts the transposition of two adjacent characters as a single edit) between a and b, or
+// any value greater than max if the distance is greater than max.
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return max + 1
+	}
+
+	// Only the last three rows of the matrix are needed.
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && prev2[j-2]+1 < curr[j] {
+				curr[j] = prev2[j-2] + 1
+			}
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
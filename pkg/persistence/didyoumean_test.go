@@ -0,0 +1,51 @@
+package persistence
+
+import "testing"
+
+var editDistanceTest_instances = []struct {
+	a, b     string
+	max      int
+	distance int
+}{
+	{"ubuntu", "ubuntu", 2, 0},
+	{"ubnutu", "ubuntu", 2, 1},  // transposition
+	{"ubuntuu", "ubuntu", 2, 1}, // deletion
+	{"ubunt", "ubuntu", 2, 1},   // insertion
+	{"ubantu", "ubuntu", 2, 1},  // substitution
+	{"kubuntu", "ubantu", 2, 2},
+	{"debian", "ubuntu", 2, 3}, // anything greater than max
+	{"çalışma", "calısma", 2, 2},
+}
+
+func TestEditDistance(t *testing.T) {
+	for i, instance := range editDistanceTest_instances {
+		d := editDistance(instance.a, instance.b, instance.max)
+		if d != instance.distance && !(d > instance.max && instance.distance > instance.max) {
+			t.Errorf("Edit distance of the instance #%d is wrong! Got %d (expected %d)", i+1, d,
+				instance.distance)
+		}
+	}
+}
+
+func TestClosestTerm(t *testing.T) {
+	candidates := []termFrequency{
+		{"linux", 100},
+		{"linus", 5},
+		{"ubuntu", 50},
+		{"kubuntu", 10},
+	}
+
+	if term, ok := closestTerm("ubnutu", candidates); !ok || term != "ubuntu" {
+		t.Errorf("`ubnutu` should be corrected as `ubuntu`, got `%s` (%t)", term, ok)
+	}
+	// Both "linux" and "linus" are an edit away, but "linux" is more frequent.
+	if term, ok := closestTerm("linuz", candidates); !ok || term != "linux" {
+		t.Errorf("`linuz` should be corrected as `linux`, got `%s` (%t)", term, ok)
+	}
+	if _, ok := closestTerm("linus", candidates); ok {
+		t.Error("`linus` should not be corrected since it is a term itself")
+	}
+	if _, ok := closestTerm("lnx", candidates); ok {
+		t.Error("short words should not be corrected")
+	}
+}
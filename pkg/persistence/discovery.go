@@ -0,0 +1,96 @@
+package persistence
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Discovery is when a torrent was first seen on the DHT, and by which peer it was announced, which
+// is recorded (see Database.AddDiscovery) only if opted in, for studying the dynamics of the DHT.
+//
+// Unlike the other times (see times.go), On is stored at the precision of milliseconds.
+type Discovery struct {
+	On time.Time
+	// PeerIP is nil if the peer is not recorded (see PeerPrivacy).
+	PeerIP net.IP
+	// PeerPort is zero if the peer is not recorded, or if it is anonymised.
+	PeerPort uint16
+	// Country is the ISO 3166-1 alpha-2 code of the country of the peer (see geoip.Reader), which is
+	// recorded regardless of the privacy of the peer as it is coarse; it is empty if unknown.
+	Country string
+}
+
+// PeerPrivacy is how much of the peers that announce the torrents is recorded along with their
+// discoveries.
+type PeerPrivacy uint8
+
+const (
+	// PeerNone records none of the peer.
+	PeerNone PeerPrivacy = iota
+	// PeerSubnet records only the subnet of the peer: the /24 of IPv4 addresses and the /48 of
+	// IPv6 addresses, without the port.
+	PeerSubnet
+	// PeerFull records the address and the port of the peer as they are.
+	PeerFull
+)
+
+// ParsePeerPrivacy parses the PeerPrivacy from "none", "subnet", or "full".
+func ParsePeerPrivacy(s string) (PeerPrivacy, error) {
+	switch s {
+	case "none":
+		return PeerNone, nil
+	case "subnet":
+		return PeerSubnet, nil
+	case "full":
+		return PeerFull, nil
+	default:
+		return PeerNone, fmt.Errorf("unknown peer privacy: %s", s)
+	}
+}
+
+// Anonymise returns the discovery with only as much of its peer as the privacy permits, and with its
+// time at the precision of milliseconds (as it is stored).
+func (d Discovery) Anonymise(privacy PeerPrivacy) Discovery {
+	anonymised := Discovery{On: d.On.Truncate(time.Millisecond), Country: d.Country}
+	if d.PeerIP == nil {
+		return anonymised
+	}
+
+	switch privacy {
+	case PeerSubnet:
+		if ip4 := d.PeerIP.To4(); ip4 != nil {
+			anonymised.PeerIP = ip4.Mask(net.CIDRMask(24, 32))
+		} else {
+			anonymised.PeerIP = d.PeerIP.Mask(net.CIDRMask(48, 128))
+		}
+	case PeerFull:
+		anonymised.PeerIP = d.PeerIP
+		anonymised.PeerPort = d.PeerPort
+	}
+	return anonymised
+}
+
+// peerIP returns the IP address of the peer as text, or nil if the peer is not recorded.
+func (d Discovery) peerIP() interface{} {
+	if d.PeerIP == nil {
+		return nil
+	}
+	return d.PeerIP.String()
+}
+
+// country returns the country of the peer, or nil if it is unknown.
+func (d Discovery) country() interface{} {
+	if d.Country == "" {
+		return nil
+	}
+	return d.Country
+}
+
+// peerPort returns the port of the peer, or nil if it is not recorded.
+func (d Discovery) peerPort() interface{} {
+	if d.PeerPort == 0 {
+		return nil
+	}
+	return int(d.PeerPort)
+}
@@ -0,0 +1,61 @@
+package persistence
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+var anonymisations = []struct {
+	ip       string
+	port     uint16
+	privacy  PeerPrivacy
+	expectIP string // empty if the peer is not expected to be recorded
+	expectPt uint16
+}{
+	{"203.0.113.57", 6881, PeerNone, "", 0},
+	{"203.0.113.57", 6881, PeerSubnet, "203.0.113.0", 0},
+	{"203.0.113.57", 6881, PeerFull, "203.0.113.57", 6881},
+	{"2001:db8:85a3:8d3:1319:8a2e:370:7348", 6881, PeerSubnet, "2001:db8:85a3::", 0},
+	{"2001:db8:85a3:8d3:1319:8a2e:370:7348", 6881, PeerFull, "2001:db8:85a3:8d3:1319:8a2e:370:7348", 6881},
+	{"::ffff:203.0.113.57", 6881, PeerSubnet, "203.0.113.0", 0},
+}
+
+func TestDiscoveryAnonymise(t *testing.T) {
+	on := time.Date(2020, 2, 29, 12, 34, 56, 789654321, time.UTC)
+	for i, a := range anonymisations {
+		discovery := Discovery{On: on, PeerIP: net.ParseIP(a.ip), PeerPort: a.port, Country: "TR"}.Anonymise(a.privacy)
+
+		if !discovery.On.Equal(on.Truncate(time.Millisecond)) {
+			t.Errorf("Time of the instance #%d is wrong! Got %s (expected %s)",
+				i+1, discovery.On, on.Truncate(time.Millisecond))
+		}
+		if a.expectIP == "" {
+			if discovery.PeerIP != nil {
+				t.Errorf("IP of the instance #%d is wrong! Got %s (expected none)", i+1, discovery.PeerIP)
+			}
+		} else if !discovery.PeerIP.Equal(net.ParseIP(a.expectIP)) {
+			t.Errorf("IP of the instance #%d is wrong! Got %s (expected %s)", i+1, discovery.PeerIP, a.expectIP)
+		}
+		if discovery.PeerPort != a.expectPt {
+			t.Errorf("Port of the instance #%d is wrong! Got %d (expected %d)", i+1, discovery.PeerPort, a.expectPt)
+		}
+		if discovery.Country != "TR" {
+			t.Errorf("Country of the instance #%d is wrong! Got %q (expected \"TR\")", i+1, discovery.Country)
+		}
+	}
+}
+
+func TestParsePeerPrivacy(t *testing.T) {
+	for s, expected := range map[string]PeerPrivacy{"none": PeerNone, "subnet": PeerSubnet, "full": PeerFull} {
+		privacy, err := ParsePeerPrivacy(s)
+		if err != nil {
+			t.Errorf("Error while parsing valid privacy %s: %s", s, err.Error())
+		} else if privacy != expected {
+			t.Errorf("Privacy %s is parsed wrong! Got %d (expected %d)", s, privacy, expected)
+		}
+	}
+	if _, err := ParsePeerPrivacy("partial"); err == nil {
+		t.Errorf("Invalid privacy is parsed without an error!")
+	}
+}
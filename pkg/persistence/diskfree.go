@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package persistence
+
+import "golang.org/x/sys/unix"
+
+// diskFree returns the free space (available to the unprivileged users) of the disk of the
+// directory.
+func diskFree(dir string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,16 @@
+package persistence
+
+import "golang.org/x/sys/windows"
+
+// diskFree returns the free space (available to the user) of the disk of the directory.
+func diskFree(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err = windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
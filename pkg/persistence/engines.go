@@ -0,0 +1,66 @@
+package persistence
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// EngineFactory opens the database at the URL (whose scheme is the one that the engine is
+// registered for).
+type EngineFactory func(url_ *url.URL) (Database, error)
+
+var (
+	enginesMutex sync.RWMutex
+	// engines are the factories of the engines by the schemes of their URLs.
+	engines = map[string]EngineFactory{
+		"sqlite3":    makeSqlite3Database,
+		"postgres":   makePostgresDatabase,
+		"stdout":     makeStdoutDatabase,
+		"beanstalk":  makeBeanstalkDatabase,
+		"beanstalkd": makeBeanstalkDatabase,
+	}
+)
+
+// RegisterEngine makes an engine available to MakeDatabase for the URLs of the scheme, so that
+// the forks and the other programs can plug their own engines in (ideally in an init function),
+// whose Engine is External. It panics if the factory is nil or if the scheme is registered
+// already, including the schemes of the built-in engines.
+func RegisterEngine(scheme string, factory EngineFactory) {
+	if factory == nil {
+		panic("persistence: RegisterEngine factory is nil")
+	}
+
+	enginesMutex.Lock()
+	defer enginesMutex.Unlock()
+	if _, dup := engines[scheme]; dup {
+		panic(fmt.Sprintf("persistence: RegisterEngine called twice for scheme `%s`", scheme))
+	}
+	engines[scheme] = factory
+}
+
+// engineFactory returns the factory of the engine for the scheme, or nil if there is none.
+func engineFactory(scheme string) EngineFactory {
+	enginesMutex.RLock()
+	defer enginesMutex.RUnlock()
+	return engines[scheme]
+}
+
+// parseFlag parses the boolean parameter of the URL of a database (and removes it from the URL),
+// which is false if not supplied.
+func parseFlag(url_ *url.URL, name string) (bool, error) {
+	query := url_.Query()
+	value := query.Get(name)
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be either true or false", name)
+	}
+
+	query.Del(name)
+	url_.RawQuery = query.Encode()
+	return enabled, nil
+}
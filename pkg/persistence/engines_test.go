@@ -0,0 +1,58 @@
+package persistence
+
+import (
+	"net/url"
+	"testing"
+)
+
+// externalDatabase is a Database of an external engine, whose methods (other than Engine, and
+// GetPoolStats which the metrics call) are not to be called.
+type externalDatabase struct {
+	Database
+	url *url.URL
+}
+
+func (db *externalDatabase) Engine() DatabaseEngine {
+	return External
+}
+
+func (db *externalDatabase) GetPoolStats() (*PoolStats, error) {
+	return nil, NotImplementedError
+}
+
+func TestRegisterEngine(t *testing.T) {
+	RegisterEngine("external", func(url_ *url.URL) (Database, error) {
+		return &externalDatabase{url: url_}, nil
+	})
+
+	db, err := MakeDatabase("external://host/path?param=value", nil)
+	if err != nil {
+		t.Fatalf("Could not make the database of the external engine: %s", err.Error())
+	}
+	// MakeDatabase instruments the databases of all the engines, including the external ones.
+	if instrumented, ok := db.(*instrumentedDatabase); ok {
+		db = instrumented.db
+	}
+	external, ok := db.(*externalDatabase)
+	if !ok || external.Engine() != External {
+		t.Fatalf("The database of the external engine is wrong! Got %T (expected *externalDatabase)", db)
+	}
+	if external.url.Host != "host" || external.url.Query().Get("param") != "value" {
+		t.Errorf("The URL of the external engine is wrong! Got %s", external.url)
+	}
+
+	for i, scheme := range []string{"external", "sqlite3", "stdout"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Registering the scheme #%d (`%s`) again did not panic!", i+1, scheme)
+				}
+			}()
+			RegisterEngine(scheme, func(*url.URL) (Database, error) { return nil, nil })
+		}()
+	}
+
+	if _, err = MakeDatabase("unregistered://host", nil); err == nil {
+		t.Errorf("The database of an unregistered scheme is made!")
+	}
+}
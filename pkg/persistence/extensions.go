@@ -0,0 +1,79 @@
+package persistence
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ExtensionShare is the share of a file extension in a torrent.
+type ExtensionShare struct {
+	// Extension is lower-case and without the leading dot, or empty for the files without an
+	// extension.
+	Extension string `json:"extension"`
+	NFiles    uint   `json:"nFiles"`
+	Size      int64  `json:"size"`
+	// Share is the ratio of Size to the total size of the torrent, in range [0, 1].
+	Share float64 `json:"share"`
+}
+
+// ExtensionBreakdown returns the shares of the file extensions in the given files, in descending
+// order of their sizes (and ascending order of their extensions, if their sizes are equal).
+func ExtensionBreakdown(files []File) []ExtensionShare {
+	var totalSize int64
+	shares := make(map[string]*ExtensionShare)
+	for _, file := range files {
+		ext := fileExtension(file.Path)
+		share, ok := shares[ext]
+		if !ok {
+			share = &ExtensionShare{Extension: ext}
+			shares[ext] = share
+		}
+		share.NFiles++
+		share.Size += file.Size
+		totalSize += file.Size
+	}
+
+	breakdown := make([]ExtensionShare, 0, len(shares))
+	for _, share := range shares {
+		if totalSize > 0 {
+			share.Share = float64(share.Size) / float64(totalSize)
+		}
+		breakdown = append(breakdown, *share)
+	}
+
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].Size != breakdown[j].Size {
+			return breakdown[i].Size > breakdown[j].Size
+		}
+		return breakdown[i].Extension < breakdown[j].Extension
+	})
+
+	return breakdown
+}
+
+// fileExtension returns the lower-case extension of the file at the given path, without the
+// leading dot. Extensions that are unlikely to be real (such as the "Smith" in "Dr. Smith", or
+// the "2" in "Vol.2") are ignored.
+func fileExtension(filePath string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(filePath), "."))
+	if len(ext) == 0 || len(ext) > 5 {
+		return ""
+	}
+
+	hasLetter := false
+	for _, r := range ext {
+		if !(r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))) {
+			return ""
+		}
+		if unicode.IsLetter(r) {
+			hasLetter = true
+		}
+	}
+	if !hasLetter {
+		return ""
+	}
+
+	return ext
+}
@@ -0,0 +1,50 @@
+package persistence
+
+import (
+	"math"
+	"testing"
+)
+
+var fileExtensionTest_instances = []struct {
+	path string
+	ext  string
+}{
+	{"Movie/movie.MKV", "mkv"},
+	{"Movie/Subs/en.srt", "srt"},
+	{"archive.tar.gz", "gz"},
+	{"README", ""},
+	{"Dr. Smith", ""},
+	{"Vol.2", ""},
+	{"Season.1/.hidden", ""},
+	{"track.mp3", "mp3"},
+	{"weird.ext with space", ""},
+}
+
+func TestFileExtension(t *testing.T) {
+	for i, instance := range fileExtensionTest_instances {
+		if ext := fileExtension(instance.path); ext != instance.ext {
+			t.Errorf("Extension of the path #%d is wrong! Got `%s` (expected `%s`)", i+1, ext, instance.ext)
+		}
+	}
+}
+
+func TestExtensionBreakdown(t *testing.T) {
+	breakdown := ExtensionBreakdown([]File{
+		{Size: 95, Path: "Movie/movie.mkv"},
+		{Size: 3, Path: "Movie/en.srt"},
+		{Size: 2, Path: "Movie/fr.SRT"},
+	})
+
+	if len(breakdown) != 2 {
+		t.Fatalf("breakdown should have 2 extensions, got %d", len(breakdown))
+	}
+
+	if breakdown[0].Extension != "mkv" || breakdown[0].NFiles != 1 || breakdown[0].Size != 95 ||
+		math.Abs(breakdown[0].Share-0.95) > 1e-9 {
+		t.Errorf("share of mkv is wrong! %+v", breakdown[0])
+	}
+	if breakdown[1].Extension != "srt" || breakdown[1].NFiles != 2 || breakdown[1].Size != 5 ||
+		math.Abs(breakdown[1].Share-0.05) > 1e-9 {
+		t.Errorf("share of srt is wrong! %+v", breakdown[1])
+	}
+}
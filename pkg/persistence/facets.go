@@ -0,0 +1,52 @@
+package persistence
+
+// Facets are the counts of the torrents that match a search, by which the search can be narrowed
+// down (e.g. in a sidebar of filters).
+type Facets struct {
+	NTorrents  uint64              `json:"nTorrents"`
+	Categories map[Category]uint64 `json:"categories"`
+	// Years are the numbers of the torrents discovered in each year (in UTC).
+	Years            map[int]uint64 `json:"years"`
+	SizeDistribution []SizeBucket   `json:"sizeDistribution"`
+	// TopExtensions are the most common file extensions among the files of (at most)
+	// facetFileSample most recently discovered torrents that match the search.
+	TopExtensions []ExtensionCount `json:"topExtensions"`
+	// TopArtists and TopAlbums are the most common artists and albums among the audio torrents that
+	// match the search (see ParseAlbum), at most facetTopAlbums of each.
+	TopArtists []ArtistCount `json:"topArtists"`
+	TopAlbums  []AlbumCount  `json:"topAlbums"`
+}
+
+// facetFileSample is the number of the torrents whose files are read to compute the top
+// extensions, lest the facets of a broad search read millions of files.
+const facetFileSample = 1000
+
+func newFacets() *Facets {
+	dashboard := newDashboard()
+	return &Facets{
+		Categories:       dashboard.Categories,
+		Years:            make(map[int]uint64),
+		SizeDistribution: dashboard.SizeDistribution,
+		TopExtensions:    dashboard.TopExtensions,
+		TopArtists:       make([]ArtistCount, 0),
+		TopAlbums:        make([]AlbumCount, 0),
+	}
+}
+
+// scanCounts adds up the rows of (category, year, size bucket, count), which are counted in a
+// single pass over the torrents that match the search.
+func (facets *Facets) scanCounts(rows *timedRows) error {
+	for rows.Next() {
+		var category Category
+		var year, bucket int
+		var n uint64
+		if err := rows.Scan(&category, &year, &bucket, &n); err != nil {
+			return err
+		}
+		facets.NTorrents += n
+		facets.Categories[category] += n
+		facets.Years[year] += n
+		facets.SizeDistribution[bucket].NTorrents += n
+	}
+	return rows.Err()
+}
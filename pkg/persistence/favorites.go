@@ -0,0 +1,13 @@
+package persistence
+
+// MaxFavorites is the maximum number of the favorites of a user.
+const MaxFavorites = 10000
+
+// Favorite is a torrent that a user has bookmarked (see Database.AddFavorite).
+type Favorite struct {
+	// Torrent has its ID, InfoHash, Name, Size, DiscoveredOn, NFiles, SpamScore, and Moderation
+	// populated.
+	Torrent TorrentMetadata `json:"torrent"`
+	// FavoritedOn is in Unix time.
+	FavoritedOn int64 `json:"favoritedOn"`
+}
@@ -0,0 +1,142 @@
+package persistence
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fields is a set of the optional fields of TorrentMetadata to be returned by QueryTorrents, so
+// that the callers can skip the columns that they do not need. The fields that are left out are
+// zero.
+//
+// ID, InfoHash, and Name are always returned, and so is the field that the torrents are ordered by
+// (as it is the cursor of the next page).
+type Fields uint8
+
+const (
+	FieldSize Fields = 1 << iota
+	FieldDiscoveredOn
+	FieldNFiles
+	FieldSpamScore
+	FieldModeration
+	// FieldRelevance is returned only if the torrents are searched for.
+	FieldRelevance
+	// FieldExplanation (the components of the relevance) is returned only if the torrents are
+	// searched for, and is not one of AllFields as it is for tuning the ranking.
+	FieldExplanation
+	FieldPopularity
+
+	AllFields = FieldSize | FieldDiscoveredOn | FieldNFiles | FieldSpamScore | FieldModeration | FieldRelevance |
+		FieldPopularity
+)
+
+// fieldNames are the names of the fields, as in the JSON of TorrentMetadata.
+var fieldNames = map[string]Fields{
+	"size":         FieldSize,
+	"discoveredOn": FieldDiscoveredOn,
+	"nFiles":       FieldNFiles,
+	"spamScore":    FieldSpamScore,
+	"moderation":   FieldModeration,
+	"relevance":    FieldRelevance,
+	"explanation":  FieldExplanation,
+	"popularity":   FieldPopularity,
+}
+
+// ParseFields parses a comma-separated list of the names of the fields (as in the JSON of
+// TorrentMetadata, e.g. `size,discoveredOn`), where the names of the fields that are always
+// returned are accepted as well.
+func ParseFields(s string) (Fields, error) {
+	var fields Fields
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "", "id", "infoHash", "name":
+			continue
+		}
+		field, ok := fieldNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown field: %s", name)
+		}
+		fields |= field
+	}
+	return fields, nil
+}
+
+// orderedField returns the field that the torrents are ordered by.
+func orderedField(orderBy OrderingCriteria) Fields {
+	switch orderBy {
+	case ByRelevance:
+		return FieldRelevance
+	case ByTotalSize:
+		return FieldSize
+	case ByDiscoveredOn:
+		return FieldDiscoveredOn
+	case ByNFiles:
+		return FieldNFiles
+	case BySpamScore:
+		return FieldSpamScore
+	case ByPopularity:
+		return FieldPopularity
+	default:
+		return 0
+	}
+}
+
+// queryColumns returns the SELECT list of QueryTorrents for the fields (along with the field that
+// the torrents are ordered by), and the destinations of the columns of a torrent to be scanned
+// into. idx is the alias of the relevance of the torrents (see ranking.columns), which is empty if
+// the torrents are not searched for.
+func queryColumns(fields Fields, orderBy OrderingCriteria, idx string) (string, func(*TorrentMetadata) []interface{}) {
+	fields |= orderedField(orderBy)
+	if idx == "" {
+		fields &^= FieldRelevance | FieldExplanation
+	}
+
+	columns := []string{"id", "info_hash", "name"}
+	var selected []Fields
+	for _, column := range []struct {
+		field Fields
+		expr  string
+	}{
+		{FieldSize, "total_size"},
+		{FieldDiscoveredOn, "discovered_on"},
+		{FieldNFiles, "n_files"},
+		{FieldSpamScore, "spam_score"},
+		{FieldModeration, "moderation"},
+		{FieldRelevance, idx + ".rank"},
+		{FieldExplanation, idx + ".text, " + idx + ".recency, " + idx + ".size, " + idx + ".spam"},
+		{FieldPopularity, "popularity"},
+	} {
+		if fields&column.field != 0 {
+			columns = append(columns, column.expr)
+			selected = append(selected, column.field)
+		}
+	}
+
+	return strings.Join(columns, ", "), func(torrent *TorrentMetadata) []interface{} {
+		dests := []interface{}{&torrent.ID, &torrent.InfoHash, &torrent.Name}
+		for _, field := range selected {
+			switch field {
+			case FieldSize:
+				dests = append(dests, &torrent.Size)
+			case FieldDiscoveredOn:
+				dests = append(dests, timeScanner{&torrent.DiscoveredOn})
+			case FieldNFiles:
+				dests = append(dests, &torrent.NFiles)
+			case FieldSpamScore:
+				dests = append(dests, &torrent.SpamScore)
+			case FieldModeration:
+				dests = append(dests, &torrent.Moderation)
+			case FieldRelevance:
+				dests = append(dests, &torrent.Relevance)
+			case FieldExplanation:
+				torrent.Explanation = new(RelevanceComponents)
+				dests = append(dests, &torrent.Explanation.Text, &torrent.Explanation.Recency,
+					&torrent.Explanation.Size, &torrent.Explanation.Spam)
+			case FieldPopularity:
+				dests = append(dests, &torrent.Popularity)
+			}
+		}
+		return dests
+	}
+}
@@ -0,0 +1,61 @@
+package persistence
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	for i, test := range []struct {
+		s      string
+		fields Fields
+		fails  bool
+	}{
+		{"", 0, false},
+		{"size,discoveredOn", FieldSize | FieldDiscoveredOn, false},
+		{"infoHash, name, nFiles", FieldNFiles, false},
+		{"relevance,explanation", FieldRelevance | FieldExplanation, false},
+		{"popularity", FieldPopularity, false},
+		{"size,seeders", 0, true},
+	} {
+		fields, err := ParseFields(test.s)
+		if test.fails {
+			if err == nil {
+				t.Errorf("Instance #%d is parsed although it is invalid!", i+1)
+			}
+		} else if err != nil {
+			t.Errorf("Instance #%d could not be parsed! %s", i+1, err.Error())
+		} else if fields != test.fields {
+			t.Errorf("Fields of the instance #%d are wrong! Got %b (expected %b)", i+1, fields, test.fields)
+		}
+	}
+}
+
+func TestQueryColumns(t *testing.T) {
+	for i, test := range []struct {
+		fields  Fields
+		orderBy OrderingCriteria
+		idx     string
+		columns []string
+	}{
+		{0, ByDiscoveredOn, "", []string{"id", "info_hash", "name", "discovered_on"}},
+		{FieldSize | FieldRelevance, ByTotalSize, "", []string{"id", "info_hash", "name", "total_size"}},
+		{FieldSize, ByRelevance, "idx", []string{"id", "info_hash", "name", "total_size", "idx.rank"}},
+		{AllFields, ByDiscoveredOn, "idx", []string{"id", "info_hash", "name", "total_size", "discovered_on",
+			"n_files", "spam_score", "moderation", "idx.rank", "popularity"}},
+		{FieldExplanation, ByRelevance, "idx", []string{"id", "info_hash", "name", "idx.rank", "idx.text",
+			"idx.recency", "idx.size", "idx.spam"}},
+		{FieldExplanation, ByNFiles, "", []string{"id", "info_hash", "name", "n_files"}},
+		{0, ByPopularity, "", []string{"id", "info_hash", "name", "popularity"}},
+	} {
+		columns, scanDests := queryColumns(test.fields, test.orderBy, test.idx)
+		if columns != strings.Join(test.columns, ", ") {
+			t.Errorf("Columns of the instance #%d are wrong! Got `%s` (expected `%s`)", i+1, columns,
+				strings.Join(test.columns, ", "))
+		}
+		if n := len(scanDests(new(TorrentMetadata))); n != len(test.columns) {
+			t.Errorf("Number of the destinations of the instance #%d is wrong! Got %d (expected %d)", i+1,
+				n, len(test.columns))
+		}
+	}
+}
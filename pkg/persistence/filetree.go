@@ -0,0 +1,72 @@
+package persistence
+
+import (
+	"sort"
+	"strings"
+)
+
+// FileTreeNode is a node in the hierarchical representation of the files of a torrent. Leaves are
+// files, and every other node is a directory whose Size and NFiles are the aggregates of its
+// descendants.
+type FileTreeNode struct {
+	Name     string          `json:"name"`
+	Size     int64           `json:"size"`
+	NFiles   uint            `json:"nFiles"`
+	Children []*FileTreeNode `json:"children,omitempty"`
+
+	// children is used for fast lookups whilst the tree is being built, and is discarded (i.e.
+	// flattened into Children) afterwards.
+	children map[string]*FileTreeNode
+}
+
+// IsDir returns true if the node is a directory (i.e. not a leaf).
+func (n *FileTreeNode) IsDir() bool {
+	return len(n.Children) != 0
+}
+
+// NewFileTree builds the file tree of the given flat list of files, whose paths are separated by
+// forward slashes. The root node has an empty name. Children of every directory are ordered such
+// that directories come before files, and each group is ordered by name.
+func NewFileTree(files []File) *FileTreeNode {
+	root := &FileTreeNode{children: make(map[string]*FileTreeNode)}
+
+	for _, file := range files {
+		node := root
+		node.Size += file.Size
+		node.NFiles++
+
+		for _, elem := range strings.Split(file.Path, "/") {
+			// Paths such as "a//b" or "/a" would yield empty elements, which are meaningless.
+			if elem == "" {
+				continue
+			}
+
+			child, ok := node.children[elem]
+			if !ok {
+				child = &FileTreeNode{Name: elem, children: make(map[string]*FileTreeNode)}
+				node.children[elem] = child
+			}
+			child.Size += file.Size
+			child.NFiles++
+			node = child
+		}
+	}
+
+	root.flatten()
+	return root
+}
+
+func (n *FileTreeNode) flatten() {
+	for _, child := range n.children {
+		child.flatten()
+		n.Children = append(n.Children, child)
+	}
+	n.children = nil
+
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].IsDir() != n.Children[j].IsDir() {
+			return n.Children[i].IsDir()
+		}
+		return n.Children[i].Name < n.Children[j].Name
+	})
+}
@@ -0,0 +1,49 @@
+package persistence
+
+import "testing"
+
+func TestNewFileTree(t *testing.T) {
+	root := NewFileTree([]File{
+		{Size: 10, Path: "Movie/movie.mkv"},
+		{Size: 1, Path: "Movie/Subs/en.srt"},
+		{Size: 2, Path: "Movie/Subs/fr.srt"},
+		{Size: 5, Path: "README.txt"},
+	})
+
+	if root.Size != 18 || root.NFiles != 4 {
+		t.Fatalf("root aggregates are wrong! Got size %d and nFiles %d", root.Size, root.NFiles)
+	}
+
+	if len(root.Children) != 2 {
+		t.Fatalf("root should have 2 children, got %d", len(root.Children))
+	}
+
+	movie := root.Children[0]
+	if movie.Name != "Movie" || !movie.IsDir() {
+		t.Fatalf("directories should come before files! Got `%s` first", movie.Name)
+	}
+	if movie.Size != 13 || movie.NFiles != 3 {
+		t.Errorf("`Movie` aggregates are wrong! Got size %d and nFiles %d", movie.Size, movie.NFiles)
+	}
+
+	subs := movie.Children[0]
+	if subs.Name != "Subs" || subs.Size != 3 || subs.NFiles != 2 {
+		t.Errorf("`Movie/Subs` is wrong! Got name `%s`, size %d, and nFiles %d",
+			subs.Name, subs.Size, subs.NFiles)
+	}
+	if subs.Children[0].Name != "en.srt" || subs.Children[1].Name != "fr.srt" {
+		t.Errorf("files are not ordered by name!")
+	}
+
+	readme := root.Children[1]
+	if readme.Name != "README.txt" || readme.IsDir() || readme.Size != 5 {
+		t.Errorf("`README.txt` is wrong!")
+	}
+}
+
+func TestNewFileTreeEmpty(t *testing.T) {
+	root := NewFileTree(nil)
+	if root.Size != 0 || root.NFiles != 0 || len(root.Children) != 0 {
+		t.Errorf("the tree of no files should be empty!")
+	}
+}
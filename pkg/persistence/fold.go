@@ -0,0 +1,103 @@
+package persistence
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// FoldDiacritics removes the diacritics of the Latin letters of the string (e.g. "Amélie" to
+// "Amelie") so that the searches (and the watches of pkg/notify) are accent-insensitive. SQLite
+// needs no folding, since the unicode61 tokenizer of its full-text index removes the diacritics of
+// both the names and the queries (remove_diacritics=1 by default), whereas PostgreSQL searches the
+// folded names (see foldedName).
+//
+// The characters are decomposed canonically, the nonspacing marks of the Latin letters are removed,
+// and the rest are composed back. Just like the unicode61 tokenizer, the letters that have no
+// decomposition (such as ø and ß) are kept as they are, and so are the marks of the other scripts
+// (such as the dakuten of ガ, or the breve of й), which make different letters rather than accents.
+func FoldDiacritics(s string) string {
+	var sb strings.Builder
+	var base rune
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			base = r
+		} else if unicode.Is(unicode.Latin, base) {
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return norm.NFC.String(sb.String())
+}
+
+// foldedName returns the name of a torrent without its diacritics, which PostgreSQL stores in the
+// folded_name column of the torrents to search, or NULL if the name has no diacritics, in which
+// case the name itself is searched (see postgresSearchedName) and no space is wasted.
+func foldedName(name string) sql.NullString {
+	if folded := FoldDiacritics(name); folded != name {
+		return sql.NullString{String: folded, Valid: true}
+	}
+	return sql.NullString{}
+}
+
+// fillNames fills the column of the torrents by the function of their names (such as foldedName),
+// in batches, by the migrations that add such columns. Only the names that are not in ASCII are
+// considered, as the others have neither diacritics nor CJK characters, hence their columns are
+// NULL.
+func fillNames(tx *timedTx, d *dialect, column string, fill func(name string) sql.NullString) error {
+	const batchSize = 1000
+	type torrent struct {
+		id   int64
+		name string
+	}
+
+	selectBatch := fmt.Sprintf(`
+		SELECT id, name
+		FROM torrents
+		WHERE id > %s AND %s
+		ORDER BY id
+		LIMIT %s;`, d.placeholder(1), d.nonASCIIName, d.placeholder(2))
+	update := fmt.Sprintf("UPDATE torrents SET %s = %s WHERE id = %s;", column, d.placeholder(1), d.placeholder(2))
+
+	var lastID int64
+	for {
+		rows, err := tx.Query(selectBatch, lastID, batchSize)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Query")
+		}
+		// The rows are read before the torrents are updated, as the rows of a query must be closed
+		// before the next statement is executed in the transaction.
+		batch := make([]torrent, 0, batchSize)
+		for rows.Next() {
+			var t torrent
+			if err = rows.Scan(&t.id, &t.name); err != nil {
+				closeRows(rows)
+				return errors.Wrap(err, "sql.Rows.Scan")
+			}
+			batch = append(batch, t)
+		}
+		closeRows(rows)
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "sql.Rows.Err")
+		}
+
+		for _, t := range batch {
+			value := fill(t.name)
+			if !value.Valid {
+				continue
+			}
+			if _, err = tx.Exec(update, value, t.id); err != nil {
+				return errors.Wrap(err, "sql.Tx.Exec (UPDATE torrents)")
+			}
+		}
+
+		if len(batch) < batchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].id
+	}
+}
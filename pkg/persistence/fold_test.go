@@ -0,0 +1,31 @@
+package persistence
+
+import (
+	"database/sql"
+	"testing"
+)
+
+var foldedNameTest_instances = []struct {
+	name   string
+	folded sql.NullString
+}{
+	{"Amélie", sql.NullString{String: "Amelie", Valid: true}},
+	{"Ünïcödé Ñames", sql.NullString{String: "Unicode Names", Valid: true}},
+	// The decomposed diacritics are folded too.
+	{"Ame\u0301lie", sql.NullString{String: "Amelie", Valid: true}},
+	// The letters that have no decomposition are kept, and so are the other scripts.
+	{"Smørrebrød", sql.NullString{}},
+	{"Сборник классики", sql.NullString{}},
+	{"Йошкар-Ола", sql.NullString{}},
+	{"東京 ガイド", sql.NullString{}},
+	{"Ubuntu 20.04", sql.NullString{}},
+}
+
+func TestFoldedName(t *testing.T) {
+	for i, instance := range foldedNameTest_instances {
+		if folded := foldedName(instance.name); folded != instance.folded {
+			t.Errorf("Folded name of the instance #%d is wrong! Got %+v (expected %+v)", i+1, folded,
+				instance.folded)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package persistence
+
+import (
+	"time"
+)
+
+// instrumentedDatabase records the metrics (see metrics) of every call to the engine that it
+// decorates (or to a transaction of it), except for Engine, Close, and GetPoolStats. MakeDatabase
+// decorates all the engines with it.
+type instrumentedDatabase struct {
+	db Database
+}
+
+func (db *instrumentedDatabase) Engine() DatabaseEngine {
+	return db.db.Engine()
+}
+
+func (db *instrumentedDatabase) Close() error {
+	pools.Lock()
+	delete(pools.databases, db)
+	pools.Unlock()
+	return db.db.Close()
+}
+
+func (db *instrumentedDatabase) GetPoolStats() (*PoolStats, error) {
+	return db.db.GetPoolStats()
+}
+
+func (db *instrumentedDatabase) WithTx(fn func(tx Database) error) error {
+	startedOn := time.Now()
+	err := db.db.WithTx(func(tx Database) error {
+		return fn(&instrumentedDatabase{db: tx})
+	})
+	observe("WithTx", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) DoesTorrentExist(infoHash []byte) (bool, error) {
+	startedOn := time.Now()
+	result, err := db.db.DoesTorrentExist(infoHash)
+	observe("DoesTorrentExist", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) error {
+	startedOn := time.Now()
+	err := db.db.AddNewTorrent(infoHash, name, files, metadata, source)
+	observe("AddNewTorrent", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) UpsertTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) (bool, error) {
+	startedOn := time.Now()
+	result, err := db.db.UpsertTorrent(infoHash, name, files, metadata, source)
+	observe("UpsertTorrent", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) SetDiscoveredOn(infoHash []byte, discoveredOn int64) error {
+	startedOn := time.Now()
+	err := db.db.SetDiscoveredOn(infoHash, discoveredOn)
+	observe("SetDiscoveredOn", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) GetNumberOfTorrents() (uint, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetNumberOfTorrents()
+	observe("GetNumberOfTorrents", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetTotalSize() (uint64, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetTotalSize()
+	observe("GetTotalSize", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetNumberOfDiscoveredTorrents(from int64) (uint64, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetNumberOfDiscoveredTorrents(from)
+	observe("GetNumberOfDiscoveredTorrents", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetRecentTorrents(limit uint) ([]TorrentMetadata, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetRecentTorrents(limit)
+	observe("GetRecentTorrents", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) QueryTorrents(
+	query string,
+	epoch int64,
+	orderBy OrderingCriteria,
+	ascending bool,
+	limit uint,
+	lastOrderedValue *float64,
+	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
+) ([]TorrentMetadata, error) {
+	startedOn := time.Now()
+	result, err := db.db.QueryTorrents(query, epoch, orderBy, ascending, limit, lastOrderedValue, lastID, filters, fields)
+	observe("QueryTorrents", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) ExplainTorrents(
+	analyze bool,
+	query string,
+	epoch int64,
+	orderBy OrderingCriteria,
+	ascending bool,
+	limit uint,
+	lastOrderedValue *float64,
+	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
+) (*QueryPlan, error) {
+	startedOn := time.Now()
+	result, err := db.db.ExplainTorrents(analyze, query, epoch, orderBy, ascending, limit, lastOrderedValue, lastID, filters, fields)
+	observe("ExplainTorrents", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetTorrent(infoHash []byte) (*TorrentMetadata, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetTorrent(infoHash)
+	observe("GetTorrent", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetFiles(infoHash []byte) ([]File, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetFiles(infoHash)
+	observe("GetFiles", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetMetadata(infoHash []byte) ([]byte, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetMetadata(infoHash)
+	observe("GetMetadata", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) QueryFiles(infoHash []byte, pathContains string, offset uint, limit uint) ([]File, error) {
+	startedOn := time.Now()
+	result, err := db.db.QueryFiles(infoHash, pathContains, offset, limit)
+	observe("QueryFiles", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetFileTree(infoHash []byte) (*FileTreeNode, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetFileTree(infoHash)
+	observe("GetFileTree", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetStatistics(from string, n uint, loc *time.Location) (*Statistics, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetStatistics(from, n, loc)
+	observe("GetStatistics", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetDashboard(from int64) (*Dashboard, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetDashboard(from)
+	observe("GetDashboard", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetFacets(query string, epoch int64, filters QueryFilters) (*Facets, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetFacets(query, epoch, filters)
+	observe("GetFacets", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetStorageReport() (*StorageReport, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetStorageReport()
+	observe("GetStorageReport", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) AdviseIndexes(queries []QueryStat, create bool) ([]IndexAdvice, error) {
+	startedOn := time.Now()
+	result, err := db.db.AdviseIndexes(queries, create)
+	observe("AdviseIndexes", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) RefreshSynonyms() (uint64, error) {
+	startedOn := time.Now()
+	result, err := db.db.RefreshSynonyms()
+	observe("RefreshSynonyms", startedOn, int(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) ReportTorrent(infoHash []byte, reason string) error {
+	startedOn := time.Now()
+	err := db.db.ReportTorrent(infoHash, reason)
+	observe("ReportTorrent", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) GetModerationQueue(limit uint) ([]ModerationQueueItem, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetModerationQueue(limit)
+	observe("GetModerationQueue", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) SetModerationState(infoHash []byte, state ModerationState) (bool, error) {
+	startedOn := time.Now()
+	result, err := db.db.SetModerationState(infoHash, state)
+	observe("SetModerationState", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) RequestTorrent(infoHash []byte) (*TorrentRequest, error) {
+	startedOn := time.Now()
+	result, err := db.db.RequestTorrent(infoHash)
+	observe("RequestTorrent", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetTorrentRequest(infoHash []byte) (*TorrentRequest, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetTorrentRequest(infoHash)
+	observe("GetTorrentRequest", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetPendingTorrentRequests(limit uint) ([]TorrentRequest, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetPendingTorrentRequests(limit)
+	observe("GetPendingTorrentRequests", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) UpdateTorrentRequest(infoHash []byte, status RequestStatus) error {
+	startedOn := time.Now()
+	err := db.db.UpdateTorrentRequest(infoHash, status)
+	observe("UpdateTorrentRequest", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) AddFavorite(username string, infoHash []byte) (bool, error) {
+	startedOn := time.Now()
+	result, err := db.db.AddFavorite(username, infoHash)
+	observe("AddFavorite", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) RemoveFavorite(username string, infoHash []byte) (bool, error) {
+	startedOn := time.Now()
+	result, err := db.db.RemoveFavorite(username, infoHash)
+	observe("RemoveFavorite", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) IsFavorite(username string, infoHash []byte) (bool, error) {
+	startedOn := time.Now()
+	result, err := db.db.IsFavorite(username, infoHash)
+	observe("IsFavorite", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetFavorites(username string, limit uint) ([]Favorite, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetFavorites(username, limit)
+	observe("GetFavorites", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) AddInteraction(infoHash []byte, interaction Interaction, on int64) (bool, error) {
+	startedOn := time.Now()
+	result, err := db.db.AddInteraction(infoHash, interaction, on)
+	observe("AddInteraction", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetInteractions(infoHash []byte, from int64) ([]Interactions, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetInteractions(infoHash, from)
+	observe("GetInteractions", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) AddAPIKey(name string, keyHash []byte, limits APIKeyLimits, createdOn int64) (uint64, error) {
+	startedOn := time.Now()
+	result, err := db.db.AddAPIKey(name, keyHash, limits, createdOn)
+	observe("AddAPIKey", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetAPIKey(keyHash []byte, on int64) (*APIKey, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetAPIKey(keyHash, on)
+	observe("GetAPIKey", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetAPIKeys(on int64) ([]APIKey, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetAPIKeys(on)
+	observe("GetAPIKeys", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) UpdateAPIKey(id uint64, limits APIKeyLimits) (bool, error) {
+	startedOn := time.Now()
+	result, err := db.db.UpdateAPIKey(id, limits)
+	observe("UpdateAPIKey", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) RevokeAPIKey(id uint64, on int64) (bool, error) {
+	startedOn := time.Now()
+	result, err := db.db.RevokeAPIKey(id, on)
+	observe("RevokeAPIKey", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) AddAPIKeyUsage(id uint64, nRequests uint64, nRows uint64, on int64) error {
+	startedOn := time.Now()
+	err := db.db.AddAPIKeyUsage(id, nRequests, nRows, on)
+	observe("AddAPIKeyUsage", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) AddSightings(sightings []Sighting, on int64) error {
+	startedOn := time.Now()
+	err := db.db.AddSightings(sightings, on)
+	observe("AddSightings", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) UpdateTrending(since int64) error {
+	startedOn := time.Now()
+	err := db.db.UpdateTrending(since)
+	observe("UpdateTrending", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) GetTrendingTorrents(limit uint) ([]TorrentMetadata, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetTrendingTorrents(limit)
+	observe("GetTrendingTorrents", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) AddCrawlerStats(stats CrawlerStats) error {
+	startedOn := time.Now()
+	err := db.db.AddCrawlerStats(stats)
+	observe("AddCrawlerStats", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) GetCrawlerStats(from int64) ([]CrawlerStats, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetCrawlerStats(from)
+	observe("GetCrawlerStats", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) AddDiscovery(infoHash []byte, discovery Discovery) error {
+	startedOn := time.Now()
+	err := db.db.AddDiscovery(infoHash, discovery)
+	observe("AddDiscovery", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) SetText(infoHash []byte, text TorrentText) error {
+	startedOn := time.Now()
+	err := db.db.SetText(infoHash, text)
+	observe("SetText", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) ClaimFetch(infoHash []byte, claimant string, ttl time.Duration) (bool, error) {
+	startedOn := time.Now()
+	claimed, err := db.db.ClaimFetch(infoHash, claimant, ttl)
+	observe("ClaimFetch", startedOn, 0, err)
+	return claimed, err
+}
+
+func (db *instrumentedDatabase) AcquireSlot(n int) (Slot, error) {
+	startedOn := time.Now()
+	slot, err := db.db.AcquireSlot(n)
+	observe("AcquireSlot", startedOn, 0, err)
+	return slot, err
+}
+
+func (db *instrumentedDatabase) LogSearch(entry SearchLogEntry) error {
+	startedOn := time.Now()
+	err := db.db.LogSearch(entry)
+	observe("LogSearch", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) GetSearchAnalytics(since int64, limit uint) (*SearchAnalytics, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetSearchAnalytics(since, limit)
+	observe("GetSearchAnalytics", startedOn, 0, err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) PurgeSearchLog(before int64) error {
+	startedOn := time.Now()
+	err := db.db.PurgeSearchLog(before)
+	observe("PurgeSearchLog", startedOn, 0, err)
+	return err
+}
+
+func (db *instrumentedDatabase) GetSuggestions(prefix string, limit uint) ([]string, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetSuggestions(prefix, limit)
+	observe("GetSuggestions", startedOn, len(result), err)
+	return result, err
+}
+
+func (db *instrumentedDatabase) GetCorrections(query string, limit uint) ([]string, error) {
+	startedOn := time.Now()
+	result, err := db.db.GetCorrections(query, limit)
+	observe("GetCorrections", startedOn, len(result), err)
+	return result, err
+}
@@ -0,0 +1,49 @@
+package persistence
+
+import "fmt"
+
+// Interaction is a kind of the interactions of the users with a torrent, which are counted by the
+// day (see Database.AddInteraction) without recording who interacted, nor from where.
+type Interaction string
+
+const (
+	// InteractionMagnet is a click of the magnet link of a torrent.
+	InteractionMagnet Interaction = "magnet"
+	// InteractionDownload is a download of the .torrent file of a torrent.
+	InteractionDownload Interaction = "download"
+)
+
+func ParseInteraction(s string) (Interaction, error) {
+	switch interaction := Interaction(s); interaction {
+	case InteractionMagnet, InteractionDownload:
+		return interaction, nil
+	default:
+		return "", fmt.Errorf("unknown interaction: %s", s)
+	}
+}
+
+// Interactions are the numbers of the interactions with a torrent on a day (in UTC).
+type Interactions struct {
+	// Day is the start of the day, in Unix time.
+	Day        int64  `json:"day"`
+	NMagnets   uint64 `json:"nMagnets"`
+	NDownloads uint64 `json:"nDownloads"`
+}
+
+// interactionDay returns the start of the day (in Unix time) of the time, by which the interactions
+// are counted.
+func interactionDay(on int64) int64 {
+	return on - on%86400
+}
+
+// interactionColumn returns the column of the `interactions` table that counts the interaction.
+func interactionColumn(interaction Interaction) (string, error) {
+	switch interaction {
+	case InteractionMagnet:
+		return "n_magnets", nil
+	case InteractionDownload:
+		return "n_downloads", nil
+	default:
+		return "", fmt.Errorf("unknown interaction: %s", interaction)
+	}
+}
@@ -15,19 +15,47 @@ import (
 var NotImplementedError = errors.New("Function not implemented")
 
 type Database interface {
-	Engine() databaseEngine
+	Engine() DatabaseEngine
 	DoesTorrentExist(infoHash []byte) (bool, error)
-	AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte) error
+	AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) error
+	// UpsertTorrent adds the torrent as AddNewTorrent does if it does not exist in the database,
+	// else replaces its name, metadata, and files (atomically) if its name or metadata differ,
+	// e.g. once it is fetched again after its metadata was truncated. Its discovery (and source),
+	// moderation, and reports are kept. Returns true if the torrent is added or replaced.
+	UpsertTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) (bool, error)
+	// SetDiscoveredOn sets the discovery time (in Unix time) of the torrent of the given InfoHash, as
+	// AddNewTorrent records the current time, for the torrents that were discovered earlier (e.g.
+	// the synthesized ones, see package synth). The torrents that do not exist are ignored.
+	SetDiscoveredOn(infoHash []byte, discoveredOn int64) error
 	Close() error
+	// WithTx calls @fn with a database whose methods are all run in a single transaction, which is
+	// committed if @fn returns nil, else rolled back (and the error is returned), so that several
+	// operations can be composed atomically (e.g. upserting a torrent and moderating it). The
+	// database must neither be closed nor used after @fn returns. WithTx can be nested, where the
+	// nested transactions are savepoints of the outer one.
+	WithTx(fn func(tx Database) error) error
 
 	// GetNumberOfTorrents returns the number of torrents saved in the database. Might be an
 	// approximation.
 	GetNumberOfTorrents() (uint, error)
+	// GetTotalSize returns the total size of the torrents saved in the database.
+	GetTotalSize() (uint64, error)
+	// GetNumberOfDiscoveredTorrents returns the number of the torrents discovered since @from (in
+	// Unix time), which is cheap (unlike GetDashboard) as it uses the index on the discovery times
+	// (i.e. discovered_on_index on SQLite, and idx_torrents_discovered_on on PostgreSQL).
+	GetNumberOfDiscoveredTorrents(from int64) (uint64, error)
+	// GetRecentTorrents returns at most @limit (up to MaxRecentTorrents) of the most recently
+	// discovered torrents that are not flagged, the most recent first, without a search.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of TorrentMetadata and nil.
+	GetRecentTorrents(limit uint) ([]TorrentMetadata, error)
 	// QueryTorrents returns @pageSize amount of torrents,
 	// * that are discovered before @discoveredOnBefore
 	// * that match the @query if it's not empty, else all torrents
+	// * that satisfy the @filters
 	// * ordered by the @orderBy in ascending order if @ascending is true, else in descending order
-	// after skipping (@page * @pageSize) torrents that also fits the criteria above.
+	// after skipping (@page * @pageSize) torrents that also fits the criteria above, with only the
+	// @fields (see Fields) populated.
 	//
 	// On error, returns (nil, error), otherwise a non-nil slice of TorrentMetadata and nil.
 	QueryTorrents(
@@ -38,12 +66,210 @@ type Database interface {
 		limit uint,
 		lastOrderedValue *float64,
 		lastID *uint64,
+		filters QueryFilters,
+		fields Fields,
 	) ([]TorrentMetadata, error)
-	// GetTorrents returns the TorrentExtMetadata for the torrent of the given InfoHash. Will return
-	// nil, nil if the torrent does not exist in the database.
+	// ExplainTorrents returns the plan of the search of QueryTorrents for the same arguments. If
+	// @analyze is true, the search is run too to measure it (see QueryPlan), hence it is as
+	// expensive as the search itself.
+	ExplainTorrents(
+		analyze bool,
+		query string,
+		epoch int64,
+		orderBy OrderingCriteria,
+		ascending bool,
+		limit uint,
+		lastOrderedValue *float64,
+		lastID *uint64,
+		filters QueryFilters,
+		fields Fields,
+	) (*QueryPlan, error)
+	// GetTorrents returns the TorrentExtMetadata for the torrent of the given InfoHash, including
+	// the breakdown of its file extensions. Will return nil, nil if the torrent does not exist in
+	// the database.
 	GetTorrent(infoHash []byte) (*TorrentMetadata, error)
 	GetFiles(infoHash []byte) ([]File, error)
-	GetStatistics(from string, n uint) (*Statistics, error)
+	// GetMetadata returns the metadata (i.e. the bencoded info dictionary) of the torrent of the
+	// given InfoHash, which is empty if it is not known (e.g. of the imported torrents). Returns nil
+	// if the torrent does not exist.
+	GetMetadata(infoHash []byte) ([]byte, error)
+	// QueryFiles returns at most @limit files of the torrent of the given InfoHash after skipping
+	// @offset of them, whose paths contain @pathContains (case-insensitively) if it's not empty,
+	// in the order they have been inserted.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of File and nil. The slice is
+	// empty if the torrent does not exist in the database.
+	QueryFiles(infoHash []byte, pathContains string, offset uint, limit uint) ([]File, error)
+	// GetFileTree returns the files of the torrent of the given InfoHash as a hierarchical tree
+	// whose directories carry the aggregated size and number of the files beneath them. Will
+	// return nil, nil if the torrent does not exist in the database.
+	GetFileTree(infoHash []byte) (*FileTreeNode, error)
+	// GetStatistics returns the statistics of the @n (up to MaxStatisticsPeriods) consecutive
+	// periods of the granularity of @from (see ParseISO8601) from the one of @from on, labelled as
+	// in ISO 8601, where @from and the periods are in the time zone @loc (so that, for instance, the
+	// days start at the midnight of @loc). The periods without any torrents are included as zero.
+	GetStatistics(from string, n uint, loc *time.Location) (*Statistics, error)
+	// GetDashboard returns the summary of the torrents discovered on or after @from (in Unix
+	// time): their size distribution, the shares of their categories, and the top extensions of
+	// their files.
+	GetDashboard(from int64) (*Dashboard, error)
+	// GetFacets returns the facet counts of the torrents that QueryTorrents would return for the
+	// same @query, @epoch, and @filters (regardless of the pagination).
+	GetFacets(query string, epoch int64, filters QueryFilters) (*Facets, error)
+	// GetStorageReport estimates the disk usage of the database and of its biggest tables, and
+	// their growth by the torrents discovered recently, projected to when the disk will be full.
+	GetStorageReport() (*StorageReport, error)
+	// GetPoolStats returns the statistics of the pool of the connections to the database, to
+	// diagnose the exhaustion of the pool under load.
+	GetPoolStats() (*PoolStats, error)
+	// AdviseIndexes recommends the indices that are missing for the statements that are run on
+	// the database (see IndexAdvice): the @queries (e.g. of the slow-query log) and, on PostgreSQL,
+	// the ones of pg_stat_statements (if installed). The indices are created too if @create is true.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of IndexAdvice and nil.
+	AdviseIndexes(queries []QueryStat, create bool) ([]IndexAdvice, error)
+	// RefreshSynonyms re-indexes the synonyms of the names of all the torrents by the current
+	// synonym list of the database (see the synonyms parameter of its URL), which must be called
+	// after the list is changed, and returns the number of the torrents that are re-indexed.
+	RefreshSynonyms() (uint64, error)
+
+	// ReportTorrent records a report, with the given reason, on the torrent of the given InfoHash
+	// to be reviewed by the operators. Reports on the torrents that do not exist in the database
+	// are silently ignored.
+	ReportTorrent(infoHash []byte, reason string) error
+	// GetModerationQueue returns at most @limit torrents that have been reported since they were
+	// last moderated, in descending order of their most recent reports.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of ModerationQueueItem and nil.
+	GetModerationQueue(limit uint) ([]ModerationQueueItem, error)
+	// SetModerationState sets the moderation state of the torrent of the given InfoHash, and
+	// dismisses all the reports on it. Returns false if the torrent does not exist.
+	SetModerationState(infoHash []byte, state ModerationState) (bool, error)
+
+	// RequestTorrent requests the torrent of the given InfoHash to be looked up on the DHT by the
+	// crawler, unless it is requested already (or the request has failed, in which case it is
+	// requested again), and returns the request. The request for a torrent that is in the
+	// database already is fetched right away.
+	RequestTorrent(infoHash []byte) (*TorrentRequest, error)
+	// GetTorrentRequest returns the request for the torrent of the given InfoHash. Will return
+	// nil, nil if the torrent is not requested.
+	GetTorrentRequest(infoHash []byte) (*TorrentRequest, error)
+	// GetPendingTorrentRequests returns at most @limit requests that are either pending or being
+	// looked up, the least recently looked up first.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of TorrentRequest and nil.
+	GetPendingTorrentRequests(limit uint) ([]TorrentRequest, error)
+	// UpdateTorrentRequest sets the status of the request for the torrent of the given InfoHash,
+	// which is counted as an attempt if the status is RequestLookingUp.
+	UpdateTorrentRequest(infoHash []byte, status RequestStatus) error
+
+	// AddFavorite adds the torrent of the given InfoHash to the favorites of the user (see
+	// Favorite), unless it is one of them already. Returns false if the torrent does not exist, or if
+	// the user has MaxFavorites favorites already.
+	AddFavorite(username string, infoHash []byte) (bool, error)
+	// RemoveFavorite removes the torrent of the given InfoHash from the favorites of the user.
+	// Returns false if it is not one of them.
+	RemoveFavorite(username string, infoHash []byte) (bool, error)
+	// IsFavorite returns true if the torrent of the given InfoHash is one of the favorites of the
+	// user.
+	IsFavorite(username string, infoHash []byte) (bool, error)
+	// GetFavorites returns at most @limit favorites of the user, the most recently favorited first,
+	// except the ones that are flagged by the operators.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of Favorite and nil.
+	GetFavorites(username string, limit uint) ([]Favorite, error)
+
+	// AddInteraction counts the interaction with the torrent of the given InfoHash on the day (in
+	// UTC) of @on (in Unix time), and in the Popularity of the torrent. Returns false if the torrent
+	// does not exist.
+	AddInteraction(infoHash []byte, interaction Interaction, on int64) (bool, error)
+	// GetInteractions returns the interactions with the torrent of the given InfoHash on the days
+	// on or after the one of @from (in Unix time), the earliest first. The days without any
+	// interaction are omitted.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of Interactions and nil.
+	GetInteractions(infoHash []byte, from int64) ([]Interactions, error)
+
+	// AddAPIKey adds an API key of the given SHA-256 hash, created on @createdOn (in Unix time), and
+	// returns its ID.
+	AddAPIKey(name string, keyHash []byte, limits APIKeyLimits, createdOn int64) (uint64, error)
+	// GetAPIKey returns the API key of the given SHA-256 hash (even if it is revoked), with its usage
+	// on the day (in UTC) of @on (in Unix time). Will return nil, nil if the key does not exist.
+	GetAPIKey(keyHash []byte, on int64) (*APIKey, error)
+	// GetAPIKeys returns all the API keys with their usages on the day (in UTC) of @on (in Unix
+	// time), the most recently created first.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of APIKey and nil.
+	GetAPIKeys(on int64) ([]APIKey, error)
+	// UpdateAPIKey sets the limits of the API key of the given ID. Returns false if the key does not
+	// exist.
+	UpdateAPIKey(id uint64, limits APIKeyLimits) (bool, error)
+	// RevokeAPIKey revokes the API key of the given ID on @on (in Unix time). Returns false if the
+	// key does not exist, or if it is revoked already.
+	RevokeAPIKey(id uint64, on int64) (bool, error)
+	// AddAPIKeyUsage counts the requests and the rows in their responses in the usage of the API key
+	// of the given ID on the day (in UTC) of @on (in Unix time).
+	AddAPIKeyUsage(id uint64, nRequests uint64, nRows uint64, on int64) error
+
+	// AddSightings counts the sightings of the torrents on the DHT in the hour of @on (in Unix
+	// time). The sightings of the torrents that are not in the database are ignored.
+	AddSightings(sightings []Sighting, on int64) error
+	// UpdateTrending ranks the MaxTrendingTorrents torrents that are sighted the most since @since
+	// (in Unix time) as the trending ones, and purges the sightings before @since.
+	UpdateTrending(since int64) error
+	// GetTrendingTorrents returns at most @limit (up to MaxTrendingTorrents) of the trending torrents
+	// that are not flagged, as of the last UpdateTrending, the most sighted first, with their
+	// Sightings populated.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of TorrentMetadata and nil.
+	GetTrendingTorrents(limit uint) ([]TorrentMetadata, error)
+
+	// AddCrawlerStats adds the statistics of a crawler (see CrawlerStats) to the ones of the hour
+	// that @stats.Hour (in Unix time) is in.
+	AddCrawlerStats(stats CrawlerStats) error
+	// GetCrawlerStats returns the statistics of the crawlers of the hours on or after @from (in Unix
+	// time, and at most MaxCrawlerStatsWindow ago), the earliest first. The hours in which no
+	// crawler ran are omitted.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of CrawlerStats and nil.
+	GetCrawlerStats(from int64) ([]CrawlerStats, error)
+
+	// AddDiscovery records the discovery of the torrent of the given InfoHash (see Discovery), as
+	// is, hence it is to be anonymised beforehand. The discoveries of the torrents that are not in
+	// the database are ignored, and the first discovery of a torrent is kept.
+	AddDiscovery(infoHash []byte, discovery Discovery) error
+	// SetText sets the text of the torrent of the given InfoHash (see TorrentText), which is searched
+	// along with its name, replacing the one that it has, if any. The texts of the torrents that do
+	// not exist are ignored, and the ones that are larger than MaxTextSize are rejected.
+	SetText(infoHash []byte, text TorrentText) error
+	// ClaimFetch claims the fetch of the torrent of the given InfoHash for the claimant (e.g. one of
+	// the crawlers that share the database), and returns true, unless another claimant has claimed
+	// it within the last @ttl, so that the crawlers do not fetch the same torrents (see README).
+	// The claims that are older than @ttl are deleted.
+	ClaimFetch(infoHash []byte, claimant string, ttl time.Duration) (bool, error)
+	// AcquireSlot acquires one of the @n slots (see Slot) that no other instance sharing the
+	// database holds, which is held until it is released, or until the instance exits (or loses
+	// its connection to the database). The slot is nil if all of them are held.
+	AcquireSlot(n int) (Slot, error)
+
+	// LogSearch records a search for the search analytics.
+	LogSearch(entry SearchLogEntry) error
+	// GetSearchAnalytics summarises the searches made since @since (in Unix time), listing at most
+	// @limit queries in each of the lists.
+	GetSearchAnalytics(since int64, limit uint) (*SearchAnalytics, error)
+	// PurgeSearchLog deletes the searches made before @before (in Unix time).
+	PurgeSearchLog(before int64) error
+	// GetSuggestions returns at most @limit suggestions for a search box in which @prefix is typed:
+	// first the popular past queries (that yielded results) which start with @prefix, then the
+	// names of the torrents that match @prefix.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of string and nil.
+	GetSuggestions(prefix string, limit uint) ([]string, error)
+	// GetCorrections returns at most @limit near-misses of the @query that are likely to yield
+	// results, to be offered as "did you mean" to the user when @query yields no results.
+	//
+	// On error, returns (nil, error), otherwise a non-nil slice of string and nil.
+	GetCorrections(query string, limit uint) ([]string, error)
 }
 
 type OrderingCriteria uint8
@@ -56,17 +282,60 @@ const (
 	ByNSeeders
 	ByNLeechers
 	ByUpdatedOn
+	BySpamScore
+	ByPopularity
 )
 
+// QueryFilters narrows down the results of QueryTorrents. Its zero value filters out only the
+// torrents that are flagged by the operators.
+type QueryFilters struct {
+	// MaxSpamScore, if not nil, excludes the torrents whose spam score is greater than it.
+	MaxSpamScore *float64
+	// IncludeFlagged includes the torrents that are flagged by the operators as well.
+	IncludeFlagged bool
+	// OnlyVerified excludes the torrents that are not verified by the operators.
+	OnlyVerified bool
+	// DiscoveredSince and DiscoveredUntil, if not nil, exclude the torrents that are discovered
+	// before and on or after them (in Unix time) respectively.
+	DiscoveredSince *int64
+	DiscoveredUntil *int64
+	// Refinements are the queries that the torrents must match as well, which (unlike the query)
+	// do not affect the relevance of the torrents. Hence a search can be refined without changing
+	// the order of its results, and paginated further from its cursor.
+	Refinements []string
+	// PathContains, if not empty, excludes the torrents none of whose files' paths contain it
+	// (case-insensitively). It requires the path search to be enabled on the database (see the
+	// path_search parameter of its URL), and to be at least 3 characters long.
+	PathContains string
+	// Resolution, Codec, and ReleaseGroup, if not empty, exclude the torrents whose names are not of
+	// the releases of them (see ParseRelease), where the resolutions and the codecs are compared by
+	// their canonical names (e.g. `4K` is `2160p`), and the groups case-insensitively.
+	Resolution   string
+	Codec        string
+	ReleaseGroup string
+	// Year, Season, and Episode, if not nil, exclude the torrents whose names are not of the releases
+	// of them (see ParseRelease).
+	Year    *int
+	Season  *int
+	Episode *int
+	// Artist and Album, if not empty, exclude the torrents that are not of the albums of them (see
+	// ParseAlbum), case-insensitively.
+	Artist string
+	Album  string
+}
+
 // TODO: search `swtich (orderBy)` and see if all cases are covered all the time
 
-type databaseEngine uint8
+// DatabaseEngine is the engine of a Database.
+type DatabaseEngine uint8
 
 const (
-	Sqlite3 databaseEngine = iota + 1
+	Sqlite3 DatabaseEngine = iota + 1
 	Postgres
 	Beanstalkd
 	Stdout
+	// External is the engine of the databases that are registered by RegisterEngine.
+	External
 )
 
 type Statistics struct {
@@ -85,19 +354,48 @@ type File struct {
 }
 
 type TorrentMetadata struct {
-	ID           uint64    `json:"id"`
-	InfoHash     []byte    `json:"infoHash"` // marshalled differently
-	Name         string    `json:"name"`
-	Size         uint64    `json:"size"`
-	DiscoveredOn time.Time `json:"discoveredOn"`
-	NFiles       uint      `json:"nFiles"`
-	Relevance    float64   `json:"relevance"`
+	ID           uint64          `json:"id"`
+	InfoHash     []byte          `json:"infoHash"` // marshalled differently
+	Name         string          `json:"name"`
+	Size         uint64          `json:"size"`
+	DiscoveredOn time.Time       `json:"discoveredOn"` // in UTC, at the precision of seconds
+	NFiles       uint            `json:"nFiles"`
+	Relevance    float64         `json:"relevance"`
+	SpamScore    float64         `json:"spamScore"`
+	Moderation   ModerationState `json:"moderation"`
+	Source       Source          `json:"source"`
+	Popularity   uint64          `json:"popularity"` // the number of the interactions, see Database.AddInteraction
+
+	// Sightings is populated only by GetTrendingTorrents.
+	Sightings uint `json:"sightings,omitempty"`
+	// Extensions is populated only by GetTorrent.
+	Extensions []ExtensionShare `json:"extensions,omitempty"`
+	// Release is populated only by GetTorrent, if its name is a release name (see ParseRelease).
+	Release *Release `json:"release,omitempty"`
+	// Album is populated only by GetTorrent, if it is an audio torrent (see ParseAlbum).
+	Album *Album `json:"album,omitempty"`
+	// Text is populated only by GetTorrent, if the torrent has a text (see Database.SetText).
+	Text *TorrentText `json:"text,omitempty"`
+	// Explanation is populated only by QueryTorrents, if FieldExplanation is selected.
+	Explanation *RelevanceComponents `json:"explanation,omitempty"`
+}
+
+// RelevanceComponents are the components of the relevance of a search result, by which the
+// relevance is computed given the weights of the ranking of the database.
+type RelevanceComponents struct {
+	// Text is how well the name of the torrent matches the query (the lower the better).
+	Text float64 `json:"text"`
+	// Recency, Size, and Spam are in [0, 1].
+	Recency float64 `json:"recency"`
+	Size    float64 `json:"size"`
+	Spam    float64 `json:"spam"`
 }
 
 type SimpleTorrentSummary struct {
 	InfoHash string `json:"infoHash"`
 	Name     string `json:"name"`
 	Files    []File `json:"files"`
+	Source   Source `json:"source,omitempty"`
 }
 
 func (tm *TorrentMetadata) MarshalJSON() ([]byte, error) {
@@ -111,6 +409,22 @@ func (tm *TorrentMetadata) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// UnmarshalJSON is the inverse of MarshalJSON, for the clients of the API (see pkg/client).
+func (tm *TorrentMetadata) UnmarshalJSON(data []byte) (err error) {
+	type Alias TorrentMetadata
+	aux := &struct {
+		InfoHash string `json:"infoHash"`
+		*Alias
+	}{
+		Alias: (*Alias)(tm),
+	}
+	if err = json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	tm.InfoHash, err = hex.DecodeString(aux.InfoHash)
+	return errors.Wrap(err, "hex.DecodeString")
+}
+
 func MakeDatabase(rawURL string, logger *zap.Logger) (Database, error) {
 	if logger != nil {
 		zap.ReplaceGlobals(logger)
@@ -121,25 +435,30 @@ func MakeDatabase(rawURL string, logger *zap.Logger) (Database, error) {
 		return nil, errors.Wrap(err, "url.Parse")
 	}
 
-	switch url_.Scheme {
-	case "sqlite3":
-		return makeSqlite3Database(url_)
-
-	case "postgres":
-		return makePostgresDatabase(url_)
-
-	case "stdout":
-		return makeStdoutDatabase(url_)
-
-	case "beanstalk", "beanstalkd":
-		return makeBeanstalkDatabase(url_)
+	db, err := openDatabase(url_)
+	if err != nil {
+		return nil, err
+	}
+	instrumented := &instrumentedDatabase{db: db}
+	pools.Lock()
+	pools.databases[instrumented] = url_.Scheme
+	pools.Unlock()
+	return instrumented, nil
+}
 
-	case "mysql":
+// openDatabase opens the database of the engine of the scheme of the URL, without the decorations
+// that MakeDatabase applies to all of them (so that the decorators can open the databases that they
+// decorate without applying them twice).
+func openDatabase(url_ *url.URL) (Database, error) {
+	if url_.Scheme == "mysql" {
 		return nil, fmt.Errorf("mysql is not yet supported")
+	}
 
-	default:
+	factory := engineFactory(url_.Scheme)
+	if factory == nil {
 		return nil, fmt.Errorf("unknown URI scheme: `%s`", url_.Scheme)
 	}
+	return factory(url_)
 }
 
 func NewStatistics() (s *Statistics) {
@@ -46,7 +46,7 @@ func ParseISO8601(s string) (*time.Time, Granularity, error) {
 			return nil, -1, err
 		}
 
-		t := time.Date(year, month, 31, 23, 59, 59, 0, time.UTC)
+		t := time.Date(year, month, daysOfMonth(month, year), 23, 59, 59, 0, time.UTC)
 		return &t, Month, nil
 	}
 
@@ -60,7 +60,11 @@ func ParseISO8601(s string) (*time.Time, Granularity, error) {
 			return nil, -1, err
 		}
 
-		t := time.Date(year, time.January, week*7, 23, 59, 59, 0, time.UTC)
+		// The first week of a year (in ISO 8601) is the one with its first Thursday, hence with
+		// the 4th of January, and the weeks start on Monday.
+		jan4 := time.Date(year, time.January, 4, 23, 59, 59, 0, time.UTC)
+		firstMonday := jan4.AddDate(0, 0, -(int(jan4.Weekday())+6)%7)
+		t := firstMonday.AddDate(0, 0, (week-1)*7+6) // the Sunday of the week
 		return &t, Week, nil
 	}
 
@@ -107,6 +111,12 @@ func ParseISO8601(s string) (*time.Time, Granularity, error) {
 	return nil, -1, fmt.Errorf("string does not match any formats")
 }
 
+// InLocation returns the time that has the same wall clock as t (which is parsed by ParseISO8601
+// in UTC) in the time zone loc instead.
+func InLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
 func daysOfMonth(month time.Month, year int) int {
 	switch month {
 	case time.January:
@@ -1,6 +1,9 @@
 package persistence
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 var validDates = []struct {
 	date        string
@@ -43,3 +46,16 @@ func TestParseISO8601(t *testing.T) {
 		}
 	}
 }
+
+func TestInLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	from, _, err := ParseISO8601("2018-04-20")
+	if err != nil {
+		t.Fatalf("Error while parsing valid date: %s", err.Error())
+	}
+
+	// The end of the day in UTC+3 is three hours before the end of the day in UTC.
+	if in := InLocation(*from, loc); from.Sub(in) != 3*time.Hour {
+		t.Errorf("Date in the location is wrong! Got %s (expected 3 hours before %s)", in, from)
+	}
+}
@@ -0,0 +1,127 @@
+package persistence
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/util"
+)
+
+// latencyBuckets are the upper bounds (in seconds) of the buckets of the histograms of the
+// latencies, from the lookups of the indices to the searches that time out.
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// methodMetrics are the metrics of the calls to a method of Database, across all the databases.
+type methodMetrics struct {
+	calls  uint64
+	errors uint64
+	// rows is the total number of the rows (e.g. the torrents, the files) that the calls returned.
+	rows uint64
+	// buckets are the numbers of the calls by the buckets of their latencies (see latencyBuckets),
+	// the last of which is for the calls that took longer than all of them.
+	buckets []uint64
+	latency time.Duration
+}
+
+var metrics = struct {
+	sync.Mutex
+	methods map[string]*methodMetrics
+}{methods: make(map[string]*methodMetrics)}
+
+func init() {
+	util.RegisterMetrics(WriteMetrics)
+}
+
+// observe records a call to the method that started on startedOn, and returned the rows (if any)
+// and the error.
+func observe(method string, startedOn time.Time, rows int, err error) {
+	latency := time.Since(startedOn)
+
+	metrics.Lock()
+	defer metrics.Unlock()
+	m, ok := metrics.methods[method]
+	if !ok {
+		m = &methodMetrics{buckets: make([]uint64, len(latencyBuckets)+1)}
+		metrics.methods[method] = m
+	}
+	m.calls++
+	if err != nil {
+		m.errors++
+	}
+	m.rows += uint64(rows)
+	m.buckets[sort.SearchFloat64s(latencyBuckets, latency.Seconds())]++
+	m.latency += latency
+}
+
+// WriteMetrics writes the metrics of the calls to the methods of the databases (see MakeDatabase)
+// in the text format of Prometheus:
+//
+//	magnetico_database_calls_total{method}            the number of the calls
+//	magnetico_database_errors_total{method}           the number of the calls that failed
+//	magnetico_database_rows_total{method}             the number of the rows that the calls returned
+//	magnetico_database_call_duration_seconds{method}  the histogram of the latencies of the calls
+//
+// along with the statistics of the pools of the connections to the databases (see PoolStats),
+// labelled by their engines.
+func WriteMetrics(w io.Writer) error {
+	metrics.Lock()
+	names := make([]string, 0, len(metrics.methods))
+	snapshot := make(map[string]methodMetrics, len(metrics.methods))
+	for name, m := range metrics.methods {
+		names = append(names, name)
+		snapshot[name] = methodMetrics{
+			calls:   m.calls,
+			errors:  m.errors,
+			rows:    m.rows,
+			buckets: append([]uint64(nil), m.buckets...),
+			latency: m.latency,
+		}
+	}
+	metrics.Unlock()
+	sort.Strings(names)
+
+	var err error
+	printf := func(format string, a ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, a...)
+		}
+	}
+	for _, counter := range []struct {
+		name, help string
+		value      func(m methodMetrics) uint64
+	}{
+		{"calls_total", "Number of the calls to the methods of the database.",
+			func(m methodMetrics) uint64 { return m.calls }},
+		{"errors_total", "Number of the calls to the methods of the database that failed.",
+			func(m methodMetrics) uint64 { return m.errors }},
+		{"rows_total", "Number of the rows that the calls to the methods of the database returned.",
+			func(m methodMetrics) uint64 { return m.rows }},
+	} {
+		printf("# HELP magnetico_database_%s %s\n", counter.name, counter.help)
+		printf("# TYPE magnetico_database_%s counter\n", counter.name)
+		for _, name := range names {
+			printf("magnetico_database_%s{method=%q} %d\n", counter.name, name, counter.value(snapshot[name]))
+		}
+	}
+
+	printf("# HELP magnetico_database_call_duration_seconds Latencies of the calls to the methods of the database.\n")
+	printf("# TYPE magnetico_database_call_duration_seconds histogram\n")
+	for _, name := range names {
+		m := snapshot[name]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += m.buckets[i]
+			printf("magnetico_database_call_duration_seconds_bucket{method=%q,le=\"%g\"} %d\n", name, bound,
+				cumulative)
+		}
+		printf("magnetico_database_call_duration_seconds_bucket{method=%q,le=\"+Inf\"} %d\n", name, m.calls)
+		printf("magnetico_database_call_duration_seconds_sum{method=%q} %g\n", name, m.latency.Seconds())
+		printf("magnetico_database_call_duration_seconds_count{method=%q} %d\n", name, m.calls)
+	}
+
+	writePoolMetrics(printf)
+	return err
+}
@@ -0,0 +1,55 @@
+package persistence
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	// The metrics are global, hence the method that no other test calls.
+	now := time.Now()
+	observe("TestWriteMetrics", now, 3, nil)
+	observe("TestWriteMetrics", now.Add(-30*time.Millisecond), 0, errors.New("failed"))
+	observe("TestWriteMetrics", now.Add(-time.Minute), 2, nil)
+
+	var buf bytes.Buffer
+	if err := WriteMetrics(&buf); err != nil {
+		t.Fatalf("Could not write the metrics: %s", err.Error())
+	}
+	for _, line := range []string{
+		`magnetico_database_calls_total{method="TestWriteMetrics"} 3`,
+		`magnetico_database_errors_total{method="TestWriteMetrics"} 1`,
+		`magnetico_database_rows_total{method="TestWriteMetrics"} 5`,
+		`magnetico_database_call_duration_seconds_bucket{method="TestWriteMetrics",le="0.025"} 1`,
+		`magnetico_database_call_duration_seconds_bucket{method="TestWriteMetrics",le="0.05"} 2`,
+		`magnetico_database_call_duration_seconds_bucket{method="TestWriteMetrics",le="10"} 2`,
+		`magnetico_database_call_duration_seconds_bucket{method="TestWriteMetrics",le="+Inf"} 3`,
+		`magnetico_database_call_duration_seconds_count{method="TestWriteMetrics"} 3`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Metrics do not contain `%s`! Got:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestInstrumentedDatabase(t *testing.T) {
+	db, err := MakeDatabase("stdout://", nil)
+	if err != nil {
+		t.Fatalf("Could not open the database: %s", err.Error())
+	}
+	if _, ok := db.(*instrumentedDatabase); !ok {
+		t.Fatalf("Database is not instrumented! Got %T", db)
+	}
+	_, _ = db.GetNumberOfTorrents()
+
+	var buf bytes.Buffer
+	if err = WriteMetrics(&buf); err != nil {
+		t.Fatalf("Could not write the metrics: %s", err.Error())
+	}
+	if !strings.Contains(buf.String(), `magnetico_database_calls_total{method="GetNumberOfTorrents"}`) {
+		t.Errorf("Metrics do not contain the calls to GetNumberOfTorrents! Got:\n%s", buf.String())
+	}
+}
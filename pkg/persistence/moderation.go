@@ -0,0 +1,79 @@
+package persistence
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// ModerationState is the verdict of the operators on a torrent.
+type ModerationState uint8
+
+const (
+	// Unmoderated torrents have not been reviewed by the operators (yet).
+	Unmoderated ModerationState = iota
+	// Verified torrents have been reviewed and are known to be what they claim to be.
+	Verified
+	// Flagged torrents have been reviewed and found to be fake, spam, or otherwise unwanted; they
+	// are excluded from the search results by default.
+	Flagged
+)
+
+func (s ModerationState) String() string {
+	switch s {
+	case Unmoderated:
+		return "unmoderated"
+	case Verified:
+		return "verified"
+	case Flagged:
+		return "flagged"
+	default:
+		return fmt.Sprintf("ModerationState(%d)", s)
+	}
+}
+
+func (s ModerationState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *ModerationState) UnmarshalText(text []byte) (err error) {
+	*s, err = ParseModerationState(string(text))
+	return
+}
+
+// ParseModerationState is the inverse of ModerationState.String.
+func ParseModerationState(s string) (ModerationState, error) {
+	switch s {
+	case "unmoderated":
+		return Unmoderated, nil
+	case "verified":
+		return Verified, nil
+	case "flagged":
+		return Flagged, nil
+	default:
+		return Unmoderated, fmt.Errorf("unknown moderation state: %s", s)
+	}
+}
+
+// ModerationQueueItem is a torrent that has been reported by the users, awaiting to be reviewed by
+// the operators.
+type ModerationQueueItem struct {
+	InfoHash   []byte          `json:"infoHash"` // marshalled differently
+	Name       string          `json:"name"`
+	Moderation ModerationState `json:"moderation"`
+	NReports   uint            `json:"nReports"`
+	// LastReportedOn is in Unix time.
+	LastReportedOn int64  `json:"lastReportedOn"`
+	LastReason     string `json:"lastReason"`
+}
+
+func (item *ModerationQueueItem) MarshalJSON() ([]byte, error) {
+	type Alias ModerationQueueItem
+	return json.Marshal(&struct {
+		InfoHash string `json:"infoHash"`
+		*Alias
+	}{
+		InfoHash: hex.EncodeToString(item.InfoHash),
+		Alias:    (*Alias)(item),
+	})
+}
@@ -0,0 +1,55 @@
+package persistence
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestModerationStateRoundTrip(t *testing.T) {
+	for _, state := range []ModerationState{Unmoderated, Verified, Flagged} {
+		parsed, err := ParseModerationState(state.String())
+		if err != nil {
+			t.Errorf("could not parse `%s`: %s", state.String(), err.Error())
+		} else if parsed != state {
+			t.Errorf("`%s` is parsed as `%s`", state.String(), parsed.String())
+		}
+	}
+
+	if _, err := ParseModerationState("Verified"); err == nil {
+		t.Error("moderation states should be case-sensitive")
+	}
+}
+
+func TestTorrentMetadataJSONRoundTrip(t *testing.T) {
+	torrent := TorrentMetadata{
+		ID:           7,
+		InfoHash:     []byte("\xc0\xff\xee\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f\x10"),
+		Name:         "Torrent",
+		Size:         42,
+		DiscoveredOn: time.Unix(1600000000, 0).UTC(),
+		NFiles:       2,
+		Moderation:   Flagged,
+		Source:       SourceUnknown,
+	}
+	data, err := json.Marshal(&torrent)
+	if err != nil {
+		t.Fatalf("Could not marshal the torrent: %s", err.Error())
+	}
+
+	var unmarshalled TorrentMetadata
+	if err = json.Unmarshal(data, &unmarshalled); err != nil {
+		t.Fatalf("Could not unmarshal `%s`: %s", data, err.Error())
+	}
+	if !reflect.DeepEqual(unmarshalled, torrent) {
+		t.Errorf("Torrent is unmarshalled wrong! Got %+v (expected %+v)", unmarshalled, torrent)
+	}
+
+	if err = json.Unmarshal([]byte(`{"infoHash": "not hex"}`), &unmarshalled); err == nil {
+		t.Error("Unmarshalling the torrent of a malformed infohash should fail!")
+	}
+	if err = json.Unmarshal([]byte(`{"moderation": "deleted"}`), &unmarshalled); err == nil {
+		t.Error("Unmarshalling the torrent of an unknown moderation state should fail!")
+	}
+}
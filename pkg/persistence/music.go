@@ -0,0 +1,255 @@
+package persistence
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Album is the hints of the music album of an audio torrent, derived from its name and the names of
+// its files by ParseAlbum. The hints that cannot be derived are zero.
+type Album struct {
+	Artist string `json:"artist,omitempty"`
+	Title  string `json:"title,omitempty"`
+	// NTracks is the number of the audio files of the torrent.
+	NTracks int `json:"nTracks,omitempty"`
+}
+
+// AlbumCount is the number of the torrents of an album (see Album) that match a search.
+type AlbumCount struct {
+	Artist    string `json:"artist"`
+	Title     string `json:"title"`
+	NTorrents uint64 `json:"nTorrents"`
+}
+
+// ArtistCount is the number of the torrents of the albums of an artist that match a search.
+type ArtistCount struct {
+	Artist    string `json:"artist"`
+	NTorrents uint64 `json:"nTorrents"`
+}
+
+// facetTopAlbums is the number of the top artists and albums among the facets of a search.
+const facetTopAlbums = 10
+
+var (
+	// albumTagsRE matches the tags in the brackets, such as "(2019)" and "[FLAC 24-96]".
+	albumTagsRE = regexp.MustCompile(`\s*[\[({][^\])}]*[\])}]`)
+	// albumYearRE matches a trailing year, such as of "Artist - Album - 2019".
+	albumYearRE = regexp.MustCompile(`[\s-]+(19|20)\d{2}$`)
+	// trackNumberRE matches the number of a track at the start of its name, such as "01 - " and
+	// "1-01. ".
+	trackNumberRE = regexp.MustCompile(`^(\d{1,2}-)?\d{1,3}[\s.\-_]*`)
+)
+
+// ParseAlbum derives the hints of the album of an audio torrent (i.e. of CategoryAudio) of the given
+// name and files, or returns the zero Album for the other torrents. The artist and the title are of
+// the first "Artist - Title" of the name of the torrent and of the directory of its tracks (as in
+// "Artist - Title (2019) [FLAC]", or "Artist-Title-2019-GROUP" of the scene), else the artist is
+// the one that all the names of the tracks share (as in "01 - Artist - Track.flac").
+//
+// It is a set of cheap heuristics, computed once at insert time as the category is.
+func ParseAlbum(name string, files []File) Album {
+	if TorrentCategory(files) != CategoryAudio {
+		return Album{}
+	}
+
+	var tracks []string
+	for _, file := range files {
+		if extensionCategories[fileExtension(file.Path)] == CategoryAudio {
+			tracks = append(tracks, file.Path)
+		}
+	}
+	album := Album{NTracks: len(tracks)}
+	if len(tracks) == 0 {
+		return album
+	}
+
+	candidates := []string{name}
+	if dir := path.Dir(tracks[0]); dir != "." {
+		candidates = append(candidates, path.Base(dir))
+	}
+	for _, candidate := range candidates {
+		if artist, title := splitAlbum(candidate); artist != "" {
+			album.Artist, album.Title = artist, title
+			return album
+		}
+	}
+
+	album.Title = cleanAlbum(name)
+	for i, track := range tracks {
+		base := path.Base(track)
+		base = trackNumberRE.ReplaceAllString(strings.TrimSuffix(base, path.Ext(base)), "")
+		parts := strings.SplitN(base, " - ", 2)
+		if len(parts) < 2 || (i > 0 && strings.TrimSpace(parts[0]) != album.Artist) {
+			album.Artist = ""
+			break
+		}
+		album.Artist = strings.TrimSpace(parts[0])
+	}
+	return album
+}
+
+// splitAlbum splits "Artist - Title" (or "Artist-Title-..." if it has no spaces, as the names of
+// the scene) into the artist and the title, or returns empty strings if it cannot.
+func splitAlbum(s string) (string, string) {
+	var parts []string
+	if !strings.ContainsAny(s, " ") {
+		parts = strings.Split(strings.ReplaceAll(s, "_", " "), "-")
+	} else {
+		parts = strings.SplitN(strings.ReplaceAll(s, "_", " "), " - ", 2)
+	}
+	if len(parts) < 2 {
+		return "", ""
+	}
+	artist, title := cleanAlbum(parts[0]), cleanAlbum(parts[1])
+	if artist == "" || title == "" {
+		return "", ""
+	}
+	return artist, title
+}
+
+// cleanAlbum removes the tags and the trailing year of the artist or the title of an album.
+func cleanAlbum(s string) string {
+	s = albumTagsRE.ReplaceAllString(strings.ReplaceAll(s, "_", " "), "")
+	s = albumYearRE.ReplaceAllString(strings.TrimSpace(s), "")
+	return strings.Join(strings.Fields(strings.Trim(s, " -")), " ")
+}
+
+// values returns the values of the album columns of the torrents (album_artist, album_title, and
+// album_n_tracks), where the hints that are zero are NULL.
+func (a Album) values() []interface{} {
+	return []interface{}{
+		sql.NullString{String: a.Artist, Valid: a.Artist != ""},
+		sql.NullString{String: a.Title, Valid: a.Title != ""},
+		sql.NullInt64{Int64: int64(a.NTracks), Valid: a.NTracks != 0},
+	}
+}
+
+// countAlbums returns the top artists and albums (see facetTopAlbums) among the matches of a search
+// (see facetsQuery), the most common first.
+func countAlbums(conn *timedConn, matches string, args []interface{}) ([]ArtistCount, []AlbumCount, error) {
+	rows, err := conn.Query(fmt.Sprintf(`
+		SELECT album_artist, COUNT(*)
+		FROM (%s) AS matches
+		WHERE album_artist IS NOT NULL
+		GROUP BY album_artist
+		ORDER BY COUNT(*) DESC, album_artist
+		LIMIT %d;`, matches, facetTopAlbums), args...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "sql.DB.Query (artists)")
+	}
+	artists := make([]ArtistCount, 0)
+	for rows.Next() {
+		var artist ArtistCount
+		if err = rows.Scan(&artist.Artist, &artist.NTorrents); err != nil {
+			closeRows(rows)
+			return nil, nil, err
+		}
+		artists = append(artists, artist)
+	}
+	closeRows(rows)
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = conn.Query(fmt.Sprintf(`
+		SELECT COALESCE(album_artist, ''), album_title, COUNT(*)
+		FROM (%s) AS matches
+		WHERE album_title IS NOT NULL
+		GROUP BY album_artist, album_title
+		ORDER BY COUNT(*) DESC, album_artist, album_title
+		LIMIT %d;`, matches, facetTopAlbums), args...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "sql.DB.Query (albums)")
+	}
+	defer closeRows(rows)
+	albums := make([]AlbumCount, 0)
+	for rows.Next() {
+		var album AlbumCount
+		if err = rows.Scan(&album.Artist, &album.Title, &album.NTorrents); err != nil {
+			return nil, nil, err
+		}
+		albums = append(albums, album)
+	}
+	return artists, albums, rows.Err()
+}
+
+// fillAlbums stores the albums of all the audio torrents (see ParseAlbum), in batches, for the
+// migrations that add the album columns. The torrents that are discovered before the categories
+// were introduced are not considered, as their categories are unknown.
+func fillAlbums(tx *timedTx, d *dialect) error {
+	const batchSize = 1000
+	type torrent struct {
+		id   int64
+		name string
+	}
+
+	selectBatch := fmt.Sprintf(`
+		SELECT id, name
+		FROM torrents
+		WHERE id > %s AND category = %s
+		ORDER BY id
+		LIMIT %s;`, d.placeholder(1), d.placeholder(2), d.placeholder(3))
+	selectFiles := fmt.Sprintf("SELECT size, path FROM files WHERE torrent_id = %s;", d.placeholder(1))
+	update := fmt.Sprintf("UPDATE torrents SET album_artist = %s, album_title = %s, album_n_tracks = %s WHERE id = %s;",
+		d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4))
+
+	var lastID int64
+	for {
+		rows, err := tx.Query(selectBatch, lastID, CategoryAudio, batchSize)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Query (torrents)")
+		}
+		// The rows are read before the files are, as the rows of a query must be closed before the
+		// next statement is executed in the transaction.
+		batch := make([]torrent, 0)
+		for rows.Next() {
+			var t torrent
+			if err = rows.Scan(&t.id, &t.name); err != nil {
+				closeRows(rows)
+				return errors.Wrap(err, "sql.Rows.Scan")
+			}
+			batch = append(batch, t)
+		}
+		closeRows(rows)
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "sql.Rows.Err")
+		}
+
+		for _, t := range batch {
+			lastID = t.id
+			if rows, err = tx.Query(selectFiles, t.id); err != nil {
+				return errors.Wrap(err, "sql.Tx.Query (files)")
+			}
+			var files []File
+			for rows.Next() {
+				var file File
+				if err = rows.Scan(&file.Size, &file.Path); err != nil {
+					closeRows(rows)
+					return errors.Wrap(err, "sql.Rows.Scan")
+				}
+				files = append(files, file)
+			}
+			closeRows(rows)
+			if err = rows.Err(); err != nil {
+				return errors.Wrap(err, "sql.Rows.Err")
+			}
+
+			album := ParseAlbum(t.name, files)
+			if album == (Album{}) {
+				continue
+			}
+			if _, err = tx.Exec(update, append(album.values(), t.id)...); err != nil {
+				return errors.Wrap(err, "sql.Tx.Exec (UPDATE torrents)")
+			}
+		}
+
+		if len(batch) < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,58 @@
+//go:build fts5
+// +build fts5
+
+package persistence
+
+import "testing"
+
+var parseAlbumTest_instances = []struct {
+	name     string
+	files    []File
+	expected Album
+}{
+	{
+		name: "Pink Floyd - The Dark Side of the Moon (1973) [FLAC]",
+		files: []File{
+			{Size: 30e6, Path: "01 - Speak to Me.flac"},
+			{Size: 40e6, Path: "02 - Breathe.flac"},
+			{Size: 1e5, Path: "cover.jpg"},
+		},
+		expected: Album{Artist: "Pink Floyd", Title: "The Dark Side of the Moon", NTracks: 2},
+	},
+	{
+		name: "Some_Artist-Some_Album-WEB-2019-GROUP",
+		files: []File{
+			{Size: 8e6, Path: "101-some_artist-track.mp3"},
+		},
+		expected: Album{Artist: "Some Artist", Title: "Some Album", NTracks: 1},
+	},
+	{
+		name: "Greatest Hits",
+		files: []File{
+			{Size: 8e6, Path: "Queen/Greatest Hits/01 - Queen - Bohemian Rhapsody.mp3"},
+			{Size: 8e6, Path: "Queen/Greatest Hits/02 - Queen - Another One Bites the Dust.mp3"},
+		},
+		expected: Album{Artist: "Queen", Title: "Greatest Hits", NTracks: 2},
+	},
+	{
+		name: "Mixtape",
+		files: []File{
+			{Size: 8e6, Path: "01 - Queen - Bohemian Rhapsody.mp3"},
+			{Size: 8e6, Path: "02 - ABBA - Waterloo.mp3"},
+		},
+		expected: Album{Title: "Mixtape", NTracks: 2},
+	},
+	{
+		name:     "Some.Movie.2019.1080p.BluRay.x264-GROUP",
+		files:    []File{{Size: 8e9, Path: "Some.Movie.2019.1080p.BluRay.x264-GROUP.mkv"}},
+		expected: Album{},
+	},
+}
+
+func TestParseAlbum(t *testing.T) {
+	for i, instance := range parseAlbumTest_instances {
+		if album := ParseAlbum(instance.name, instance.files); album != instance.expected {
+			t.Errorf("Album of the instance #%d is wrong! Got %+v (expected %+v)", i+1, album, instance.expected)
+		}
+	}
+}
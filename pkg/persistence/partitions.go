@@ -0,0 +1,87 @@
+package persistence
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// partitionedTables are the tables of PostgreSQL that are partitioned by the months (in UTC) of the
+// discoveries of the torrents, so that the torrents of a month (and their files) can be dropped at
+// once, and that the old months are not vacuumed over and over again as the new torrents are added.
+var partitionedTables = []string{"torrents", "files"}
+
+// execer is either a connection or a transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// partitions are the months whose partitions are known to exist, so that they are created once
+// (see ensure) rather than before every insert.
+type partitions struct {
+	mutex  sync.Mutex
+	months map[time.Time]bool
+}
+
+func newPartitions() *partitions {
+	return &partitions{months: make(map[time.Time]bool)}
+}
+
+// ensure creates the partitions of the month of @on, and of the month after it (so that they are
+// created ahead of the first torrent of the month, usually), unless they exist already. The
+// partitions that are created in a transaction (i.e. if @cacheable is false) are not remembered,
+// as the transaction might be rolled back.
+func (p *partitions) ensure(conn execer, on time.Time, cacheable bool) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, month := range []time.Time{monthOf(on), monthOf(on).AddDate(0, 1, 0)} {
+		if p.months[month] {
+			continue
+		}
+		if err := createPartitions(conn, month); err != nil {
+			return err
+		}
+		if cacheable {
+			p.months[month] = true
+		}
+	}
+	return nil
+}
+
+// createPartitions creates the partitions of the partitionedTables for the month, unless they
+// exist already (even if they are created concurrently, e.g. by another magneticod).
+func createPartitions(conn execer, month time.Time) error {
+	for _, table := range partitionedTables {
+		if _, err := conn.Exec(partitionDDL(table, month)); err != nil {
+			return errors.Wrapf(err, "sql.Exec (CREATE TABLE %s)", partitionName(table, month))
+		}
+	}
+	return nil
+}
+
+func partitionDDL(table string, month time.Time) string {
+	return fmt.Sprintf(`
+		DO $$ BEGIN
+			CREATE TABLE IF NOT EXISTS %s PARTITION OF %s
+				FOR VALUES FROM ('%s') TO ('%s');
+		EXCEPTION WHEN duplicate_table OR unique_violation THEN NULL;
+		END $$;`,
+		partitionName(table, month), table,
+		month.Format("2006-01-02 15:04:05-07"), month.AddDate(0, 1, 0).Format("2006-01-02 15:04:05-07"),
+	)
+}
+
+// partitionName returns the name of the partition of the table for the month, such as
+// torrents_y2021m03.
+func partitionName(table string, month time.Time) string {
+	return fmt.Sprintf("%s_y%04dm%02d", table, month.Year(), int(month.Month()))
+}
+
+// monthOf returns the start of the month (in UTC) of the time.
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,78 @@
+package persistence
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+var partitionDDLTest_instances = []struct {
+	on   time.Time
+	name string
+	from string
+	to   string
+}{
+	{time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC), "torrents_y2021m03", "2021-03-01 00:00:00+00",
+		"2021-04-01 00:00:00+00"},
+	{time.Date(2020, 12, 31, 23, 59, 59, 0, time.UTC), "torrents_y2020m12", "2020-12-01 00:00:00+00",
+		"2021-01-01 00:00:00+00"},
+	// The months are in UTC regardless of the time zone of the time.
+	{time.Date(2021, 1, 1, 0, 30, 0, 0, time.FixedZone("CET", 3600)), "torrents_y2020m12",
+		"2020-12-01 00:00:00+00", "2021-01-01 00:00:00+00"},
+}
+
+func TestPartitionDDL(t *testing.T) {
+	for i, test := range partitionDDLTest_instances {
+		ddl := partitionDDL("torrents", monthOf(test.on))
+		if name := partitionName("torrents", monthOf(test.on)); name != test.name {
+			t.Errorf("Name of the instance #%d is wrong! Got %s (expected %s)", i+1, name, test.name)
+		}
+		expected := "CREATE TABLE IF NOT EXISTS " + test.name + " PARTITION OF torrents\n\t\t\t\tFOR VALUES FROM ('" +
+			test.from + "') TO ('" + test.to + "');"
+		if !strings.Contains(ddl, expected) {
+			t.Errorf("DDL of the instance #%d is wrong! Got %s (expected to contain %s)", i+1, ddl, expected)
+		}
+	}
+}
+
+// recordingExecer records the statements that it is to execute, without executing them.
+type recordingExecer struct {
+	statements []string
+}
+
+func (re *recordingExecer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	re.statements = append(re.statements, query)
+	return nil, nil
+}
+
+func TestPartitionsEnsure(t *testing.T) {
+	p := newPartitions()
+	conn := new(recordingExecer)
+	on := time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)
+
+	// The partitions of March and April of both of the tables.
+	if err := p.ensure(conn, on, true); err != nil {
+		t.Fatalf("Could not ensure the partitions: %s", err.Error())
+	}
+	if len(conn.statements) != 4 {
+		t.Fatalf("Number of the statements is wrong! Got %d (expected 4)", len(conn.statements))
+	}
+	// The partitions of April are created already, but not the ones of May.
+	if err := p.ensure(conn, on.AddDate(0, 1, 0), true); err != nil {
+		t.Fatalf("Could not ensure the partitions: %s", err.Error())
+	}
+	if len(conn.statements) != 6 || !strings.Contains(conn.statements[5], "files_y2021m05") {
+		t.Fatalf("Statements are wrong! Got %v", conn.statements)
+	}
+	// The partitions that are created in the transactions are created again.
+	if err := p.ensure(conn, on.AddDate(1, 0, 0), false); err != nil {
+		t.Fatalf("Could not ensure the partitions: %s", err.Error())
+	}
+	if err := p.ensure(conn, on.AddDate(1, 0, 0), false); err != nil {
+		t.Fatalf("Could not ensure the partitions: %s", err.Error())
+	}
+	if len(conn.statements) != 14 {
+		t.Errorf("Number of the statements is wrong! Got %d (expected 14)", len(conn.statements))
+	}
+}
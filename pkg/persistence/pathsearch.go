@@ -0,0 +1,37 @@
+package persistence
+
+import (
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+)
+
+// pathIndex is the trigram index (of pg_trgm) of the paths of the files on PostgreSQL, which the
+// path search (see parsePathSearch) uses.
+const pathIndex = "idx_files_path_gin_trgm"
+
+// parsePathSearch parses the path_search parameter of the URL of a database (and removes it from
+// the URL), which enables searching the torrents by the paths of their files (see
+// QueryFilters.PathContains). It is disabled by default, since the index that it requires on
+// PostgreSQL is about as large as the files themselves.
+func parsePathSearch(url_ *url.URL) (bool, error) {
+	return parseFlag(url_, "path_search")
+}
+
+// checkPathSearch returns an ExpensiveQueryError if the filters search the paths of the files
+// while the path search is disabled, or for a substring that is shorter than a trigram (which
+// cannot be looked up in the index, hence would scan all the files), or nil.
+func checkPathSearch(filters QueryFilters, enabled bool) error {
+	if filters.PathContains == "" {
+		return nil
+	}
+	if !enabled {
+		return &ExpensiveQueryError{Query: filters.PathContains, Reason: "the paths of the files cannot be " +
+			"searched on this database (see path_search)"}
+	}
+	if utf8.RuneCountInString(filters.PathContains) < trigramMinLength {
+		return &ExpensiveQueryError{Query: filters.PathContains, Reason: fmt.Sprintf(
+			"the paths of the files can be searched for at least %d characters", trigramMinLength)}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package persistence
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParsePathSearch(t *testing.T) {
+	for i, test := range []struct {
+		rawURL   string
+		enabled  bool
+		rawQuery string
+		fails    bool
+	}{
+		{"sqlite3:///db.sqlite3?_busy_timeout=3000", false, "_busy_timeout=3000", false},
+		{"sqlite3:///db.sqlite3?path_search=true", true, "", false},
+		{"postgres://localhost/db?path_search=0&sslmode=disable", false, "sslmode=disable", false},
+		{"postgres://localhost/db?path_search=yes", false, "", true},
+	} {
+		url_, err := url.Parse(test.rawURL)
+		if err != nil {
+			t.Fatalf("Could not parse the URL of the instance #%d! %s", i+1, err.Error())
+		}
+
+		enabled, err := parsePathSearch(url_)
+		if test.fails {
+			if err == nil {
+				t.Errorf("Instance #%d is parsed although it is invalid!", i+1)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Instance #%d could not be parsed! %s", i+1, err.Error())
+			continue
+		}
+		if enabled != test.enabled {
+			t.Errorf("Path search of the instance #%d is wrong! Got %t (expected %t)", i+1, enabled, test.enabled)
+		}
+		if url_.RawQuery != test.rawQuery {
+			t.Errorf("Query of the URL of the instance #%d is wrong! Got %q (expected %q)", i+1, url_.RawQuery,
+				test.rawQuery)
+		}
+	}
+}
+
+func TestCheckPathSearch(t *testing.T) {
+	for i, test := range []struct {
+		pathContains string
+		enabled      bool
+		rejected     bool
+	}{
+		{"", false, false},
+		{"readme", false, true},
+		{"readme", true, false},
+		{"nf", true, true},
+		{"ünl", true, false},
+	} {
+		err := checkPathSearch(QueryFilters{PathContains: test.pathContains}, test.enabled)
+		if (err != nil) != test.rejected {
+			t.Errorf("Check of the instance #%d is wrong! Got %v (expected rejected: %t)", i+1, err, test.rejected)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package persistence
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryPlan is the plan of a search (see Database.ExplainTorrents), as reported by the engine, for
+// the operators to understand why a search is slow on their data.
+type QueryPlan struct {
+	// SQL is the statement of the search, whose arguments are not included.
+	SQL string `json:"sql"`
+	// Plan is the plan of the statement, line by line, indented as a tree.
+	Plan []string `json:"plan"`
+	// Analyzed is true if the search is run to measure it, in which case Elapsed is how long it
+	// took (in milliseconds) and Rows is the number of the torrents it returned; the plans of the
+	// engines that can measure their steps (i.e. PostgreSQL) carry their measurements too.
+	Analyzed bool    `json:"analyzed"`
+	Elapsed  float64 `json:"elapsed,omitempty"`
+	Rows     uint    `json:"rows,omitempty"`
+}
+
+// sqlite3Plan indents the rows of `EXPLAIN QUERY PLAN` (i.e. id, parent, notused, detail) as a tree,
+// as the shell of SQLite does; the parents come before their children.
+func sqlite3Plan(rows *timedRows) ([]string, error) {
+	plan := make([]string, 0)
+	depths := make(map[int]int)
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return nil, err
+		}
+		depth := 0
+		if parentDepth, ok := depths[parent]; ok {
+			depth = parentDepth + 1
+		}
+		depths[id] = depth
+		plan = append(plan, strings.Repeat("  ", depth)+detail)
+	}
+	return plan, rows.Err()
+}
+
+var postgresActualRows = regexp.MustCompile(`\(actual time=[0-9.]+\.\.[0-9.]+ rows=([0-9]+) loops=[0-9]+\)`)
+
+// postgresPlanRows returns the number of the rows returned by the plan of `EXPLAIN ANALYZE`, which
+// are the actual rows of its root (i.e. of its first line), or zero if it cannot be found.
+func postgresPlanRows(plan []string) uint {
+	if len(plan) == 0 {
+		return 0
+	}
+	match := postgresActualRows.FindStringSubmatch(plan[0])
+	if match == nil {
+		return 0
+	}
+	rows, _ := strconv.ParseUint(match[1], 10, 64)
+	return uint(rows)
+}
+
+// measure runs the search to measure it, and returns how long it took (in milliseconds) along with
+// the number of the rows it returned.
+func measure(conn *timedConn, sqlQuery string, queryArgs []interface{}) (float64, uint, error) {
+	startedOn := time.Now()
+	rows, err := conn.Query(sqlQuery, queryArgs...)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer closeRows(rows)
+
+	var n uint
+	for rows.Next() {
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	return float64(time.Since(startedOn)) / float64(time.Millisecond), n, nil
+}
@@ -0,0 +1,28 @@
+package persistence
+
+import (
+	"testing"
+)
+
+var postgresPlanRowsTest_instances = []struct {
+	plan     []string
+	expected uint
+}{
+	{[]string{
+		"Limit  (cost=0.28..8.30 rows=20 width=72) (actual time=0.031..0.093 rows=17 loops=1)",
+		"  ->  Index Scan using discovered_on_index on torrents  (cost=0.28..80.30 rows=200 width=72) (actual time=0.030..0.090 rows=17 loops=1)",
+		"Planning Time: 0.210 ms",
+		"Execution Time: 0.120 ms",
+	}, 17},
+	// The plan is not analyzed.
+	{[]string{"Limit  (cost=0.28..8.30 rows=20 width=72)"}, 0},
+	{[]string{}, 0},
+}
+
+func TestPostgresPlanRows(t *testing.T) {
+	for i, instance := range postgresPlanRowsTest_instances {
+		if got := postgresPlanRows(instance.plan); got != instance.expected {
+			t.Errorf("Rows of the instance #%d is wrong! Got %d (expected %d)", i+1, got, instance.expected)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package persistence
+
+import (
+	"database/sql"
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PoolStats are the statistics of the pool of the connections to a database (see sql.DBStats).
+type PoolStats struct {
+	MaxOpenConnections int `json:"maxOpenConnections"`
+	OpenConnections    int `json:"openConnections"`
+	InUse              int `json:"inUse"`
+	Idle               int `json:"idle"`
+	// WaitCount is the number of the times that a connection was waited for as all of them were in
+	// use, and WaitDuration is the total time waited for them (in nanoseconds). If they keep
+	// increasing under load, the pool is exhausted.
+	WaitCount    int64         `json:"waitCount"`
+	WaitDuration time.Duration `json:"waitDuration"`
+}
+
+func newPoolStats(stats sql.DBStats) *PoolStats {
+	return &PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration,
+	}
+}
+
+func (ps *PoolStats) add(other *PoolStats) {
+	ps.MaxOpenConnections += other.MaxOpenConnections
+	ps.OpenConnections += other.OpenConnections
+	ps.InUse += other.InUse
+	ps.Idle += other.Idle
+	ps.WaitCount += other.WaitCount
+	ps.WaitDuration += other.WaitDuration
+}
+
+// pools are the databases that are opened by MakeDatabase (and not closed yet), by the schemes of
+// their URLs, whose pools are served at /debug/vars (under `pools`) and at /debug/metrics.
+var pools = struct {
+	sync.Mutex
+	databases map[Database]string
+}{databases: make(map[Database]string)}
+
+func init() {
+	expvar.Publish("pools", expvar.Func(func() interface{} { return getPoolStats() }))
+}
+
+// getPoolStats returns the statistics of the pools of the databases (see pools) by their schemes,
+// summed if there are several databases of the same scheme. The databases that do not have a pool
+// (e.g. stdout) are left out.
+func getPoolStats() map[string]*PoolStats {
+	pools.Lock()
+	defer pools.Unlock()
+	stats := make(map[string]*PoolStats)
+	for db, scheme := range pools.databases {
+		poolStats, err := db.GetPoolStats()
+		if err != nil {
+			continue
+		}
+		if stats[scheme] == nil {
+			stats[scheme] = new(PoolStats)
+		}
+		stats[scheme].add(poolStats)
+	}
+	return stats
+}
+
+// writePoolMetrics writes the statistics of the pools of the databases (see getPoolStats) in the
+// text format of Prometheus, labelled by the schemes of the databases as `engine`.
+func writePoolMetrics(printf func(format string, a ...interface{})) {
+	stats := getPoolStats()
+	schemes := make([]string, 0, len(stats))
+	for scheme := range stats {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	for _, metric := range []struct {
+		name, kind, help string
+		value            func(ps *PoolStats) string
+	}{
+		{"connections_max", "gauge", "Maximum number of the open connections to the database.",
+			func(ps *PoolStats) string { return fmt.Sprint(ps.MaxOpenConnections) }},
+		{"connections_open", "gauge", "Number of the open connections to the database.",
+			func(ps *PoolStats) string { return fmt.Sprint(ps.OpenConnections) }},
+		{"connections_in_use", "gauge", "Number of the connections to the database that are in use.",
+			func(ps *PoolStats) string { return fmt.Sprint(ps.InUse) }},
+		{"connections_idle", "gauge", "Number of the idle connections to the database.",
+			func(ps *PoolStats) string { return fmt.Sprint(ps.Idle) }},
+		{"connection_waits_total", "counter", "Number of the times a connection to the database was waited for.",
+			func(ps *PoolStats) string { return fmt.Sprint(ps.WaitCount) }},
+		{"connection_wait_seconds_total", "counter", "Total time waited for the connections to the database.",
+			func(ps *PoolStats) string { return fmt.Sprintf("%g", ps.WaitDuration.Seconds()) }},
+	} {
+		printf("# HELP magnetico_database_%s %s\n", metric.name, metric.help)
+		printf("# TYPE magnetico_database_%s %s\n", metric.name, metric.kind)
+		for _, scheme := range schemes {
+			printf("magnetico_database_%s{engine=%q} %s\n", metric.name, scheme, metric.value(stats[scheme]))
+		}
+	}
+}
@@ -0,0 +1,48 @@
+//go:build fts5
+// +build fts5
+
+package persistence
+
+import (
+	"testing"
+)
+
+func TestGetPoolStats(t *testing.T) {
+	for engine, url := range testEngines(t) {
+		db, err := MakeDatabase(url, nil)
+		if err != nil {
+			t.Fatalf("Could not open the %s database: %s", engine, err.Error())
+		}
+		if _, err = db.GetNumberOfTorrents(); err != nil {
+			t.Fatalf("Could not count the torrents of the %s database: %s", engine, err.Error())
+		}
+
+		stats, err := db.GetPoolStats()
+		if err != nil {
+			t.Fatalf("Could not get the pool statistics of the %s database: %s", engine, err.Error())
+		}
+		if stats.MaxOpenConnections != 3 {
+			t.Errorf("MaxOpenConnections of the %s database is wrong! Got %d (expected 3)", engine,
+				stats.MaxOpenConnections)
+		}
+		if stats.OpenConnections < 1 || stats.InUse != 0 || stats.Idle != stats.OpenConnections {
+			t.Errorf("Connections of the %s database are wrong! Got %+v", engine, stats)
+		}
+
+		pools.Lock()
+		_, ok := pools.databases[db]
+		pools.Unlock()
+		if !ok {
+			t.Errorf("The %s database is not among the pools!", engine)
+		}
+		if err = db.Close(); err != nil {
+			t.Fatalf("Could not close the %s database: %s", engine, err.Error())
+		}
+		pools.Lock()
+		_, ok = pools.databases[db]
+		pools.Unlock()
+		if ok {
+			t.Errorf("The closed %s database is still among the pools!", engine)
+		}
+	}
+}
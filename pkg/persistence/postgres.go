@@ -1,10 +1,13 @@
 package persistence
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/binary"
 	"fmt"
 	"net/url"
-	"text/template"
+	"strings"
 	"time"
 	"unicode/utf8"
 
@@ -16,12 +19,20 @@ import (
 )
 
 type postgresDatabase struct {
-	conn   *sql.DB
-	schema string
+	conn       *timedConn
+	schema     string
+	ranking    ranking
+	breaker    breaker
+	partitions *partitions
+	// pathSearch is true if the paths of the files can be searched (see parsePathSearch).
+	pathSearch bool
+	// cjkBigrams is true if the CJK names are searched by their bigrams (see parseCJKBigrams).
+	cjkBigrams bool
+	synonyms   synonyms
 }
 
 func makePostgresDatabase(url_ *url.URL) (Database, error) {
-	db := new(postgresDatabase)
+	db := &postgresDatabase{partitions: newPartitions()}
 
 	schema := url_.Query().Get("schema")
 	if schema == "" {
@@ -33,11 +44,28 @@ func makePostgresDatabase(url_ *url.URL) (Database, error) {
 	}
 	url_.Query().Del("schema")
 
-	var err error
-	db.conn, err = sql.Open("pgx", url_.String())
+	timeout, slowQueryThreshold, err := parseQueryLimits(url_)
+	if err != nil {
+		return nil, err
+	}
+	if db.ranking, err = parseRanking(url_); err != nil {
+		return nil, err
+	}
+	if db.pathSearch, err = parsePathSearch(url_); err != nil {
+		return nil, err
+	}
+	if db.cjkBigrams, err = parseCJKBigrams(url_); err != nil {
+		return nil, err
+	}
+	if db.synonyms, err = parseSynonyms(url_); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("pgx", url_.String())
 	if err != nil {
 		return nil, errors.Wrap(err, "sql.Open")
 	}
+	db.conn = &timedConn{DB: conn}
 
 	// > Open may just validate its arguments without creating a connection to the database. To
 	// > verify that the data source Name is valid, call Ping.
@@ -54,11 +82,43 @@ func makePostgresDatabase(url_ *url.URL) (Database, error) {
 	if err := db.setupDatabase(); err != nil {
 		return nil, errors.Wrap(err, "setupDatabase")
 	}
+	if err := db.partitions.ensure(db.conn, time.Now(), true); err != nil {
+		return nil, errors.Wrap(err, "partitions.ensure")
+	}
+	if db.pathSearch {
+		if err := db.createPathIndex(); err != nil {
+			return nil, errors.Wrap(err, "createPathIndex")
+		}
+	}
+	// The migrations (in setupDatabase) might take long on large databases, hence are not limited.
+	db.conn.timeout, db.conn.slowQueryThreshold = timeout, slowQueryThreshold
 
 	return db, nil
 }
 
-func (db *postgresDatabase) Engine() databaseEngine {
+// createPathIndex creates the trigram index of the paths of the files (see pathIndex) unless it
+// exists. The index is created on the partitioned table, hence PostgreSQL creates it on the
+// partitions that are created later as well.
+//
+// The index is not dropped when the path search is disabled, since the other daemons that share
+// the database might have it enabled; it can be dropped by `DROP INDEX idx_files_path_gin_trgm;`.
+func (db *postgresDatabase) createPathIndex() error {
+	var exists bool
+	if err := db.conn.QueryRow("SELECT to_regclass($1) IS NOT NULL;", pathIndex).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	zap.L().Named("persistence").Info("Creating the trigram index of the paths of the files for the path " +
+		"search, which might take long on large databases...")
+	// Like the migrations, the creation of the index is not limited by the query timeout.
+	_, err := db.conn.DB.Exec("CREATE INDEX IF NOT EXISTS " + pathIndex + " ON files USING GIN (path gin_trgm_ops);")
+	return err
+}
+
+func (db *postgresDatabase) Engine() DatabaseEngine {
 	return Postgres
 }
 
@@ -77,9 +137,27 @@ func (db *postgresDatabase) DoesTorrentExist(infoHash []byte) (bool, error) {
 	return exists, nil
 }
 
-func (db *postgresDatabase) AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte) error {
+// advisoryLockClass and migrationsLockID are the keys of the advisory lock of the migrations (see
+// setupDatabase), whose space of the pairs of keys is apart from the space of the single keys of the
+// infohashes (see infoHashLockKey). The advisory locks of the slots (see AcquireSlot) are of
+// slotsLockClass, by their indices.
+const (
+	advisoryLockClass = 0x6d61676e // "magn"
+	migrationsLockID  = 1
+	slotsLockClass    = advisoryLockClass + 1
+)
+
+// infoHashLockKey returns the key of the advisory lock of the infohash (see AddNewTorrent), which is
+// its first 8 bytes, as the infohashes are uniformly distributed.
+func infoHashLockKey(infoHash []byte) int64 {
+	var key [8]byte
+	copy(key[:], infoHash)
+	return int64(binary.BigEndian.Uint64(key[:]))
+}
+
+func (db *postgresDatabase) AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) error {
 	if !utf8.ValidString(name) {
-		zap.L().Warn(
+		zap.L().Named("persistence").Warn(
 			"Ignoring a torrent whose name is not UTF-8 compliant.",
 			zap.ByteString("infoHash", infoHash),
 			zap.Binary("name", []byte(name)),
@@ -88,16 +166,6 @@ func (db *postgresDatabase) AddNewTorrent(infoHash []byte, name string, files []
 		return nil
 	}
 
-	tx, err := db.conn.Begin()
-	if err != nil {
-		return errors.Wrap(err, "conn.Begin")
-	}
-	// If everything goes as planned and no error occurs, we will commit the transaction before
-	// returning from the function so the tx.Rollback() call will fail, trying to rollback a
-	// committed transaction. BUT, if an error occurs, we'll get our transaction rollback'ed, which
-	// is nice.
-	defer tx.Rollback()
-
 	var totalSize uint64 = 0
 	for _, file := range files {
 		totalSize += uint64(file.Size)
@@ -105,33 +173,85 @@ func (db *postgresDatabase) AddNewTorrent(infoHash []byte, name string, files []
 
 	// This is a workaround for a bug: the database will not accept total_size to be zero.
 	if totalSize == 0 {
-		zap.L().Debug("Ignoring a torrent whose total size is zero.")
+		zap.L().Named("persistence").Debug("Ignoring a torrent whose total size is zero.")
 		return nil
 	}
 
+	// The check and the partitions are before the transaction is begun, lest the concurrent inserts
+	// hold all the connections of the pool while waiting for one more.
 	if exist, err := db.DoesTorrentExist(infoHash); exist || err != nil {
 		return err
 	}
 
+	discoveredOn := now()
+	if err := db.partitions.ensure(db.conn, discoveredOn, db.conn.tx == nil); err != nil {
+		return errors.Wrap(err, "partitions.ensure")
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "conn.Begin")
+	}
+	// If everything goes as planned and no error occurs, we will commit the transaction before
+	// returning from the function so the tx.Rollback() call will fail, trying to rollback a
+	// committed transaction. BUT, if an error occurs, we'll get our transaction rollback'ed, which
+	// is nice.
+	defer tx.Rollback()
+
+	// info_hash cannot be unique by constraint as the torrents are partitioned (see partitions),
+	// hence ON CONFLICT DO NOTHING is not an option. Instead, the concurrent inserts of the same
+	// torrent (e.g. by multiple crawlers), which can both race past the check above, are serialised
+	// by an advisory lock of the infohash (held until the end of the transaction), and the torrent
+	// is checked again under the lock, which sees the torrents committed by the others.
+	if _, err = tx.Exec("SELECT pg_advisory_xact_lock($1);", infoHashLockKey(infoHash)); err != nil {
+		return errors.Wrap(err, "tx.Exec (pg_advisory_xact_lock)")
+	}
+	var exists bool
+	if err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM torrents WHERE info_hash = $1);", infoHash).Scan(&exists); err != nil {
+		return errors.Wrap(err, "tx.QueryRow (SELECT FROM torrents)")
+	} else if exists {
+		zap.L().Named("persistence").Debug("Ignoring a torrent that is added concurrently.")
+		return nil
+	}
+
 	var lastInsertId int64
 
 	err = tx.QueryRow(`
 		INSERT INTO torrents (
 			info_hash,
 			name,
+			folded_name,
+			cjk_bigrams,
+			synonyms,
 			metadata,
 			total_size,
-			discovered_on
-		) VALUES ($1, $2, $3, $4, $5)
+			discovered_on,
+			spam_score,
+			category,
+			source,
+			n_files,
+			release_title,
+			release_year,
+			release_season,
+			release_episode,
+			release_resolution,
+			release_codec,
+			release_group,
+			album_artist,
+			album_title,
+			album_n_tracks
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
 		RETURNING id;
-	`, infoHash, name, metadata, totalSize, time.Now()).Scan(&lastInsertId)
+	`, append(append([]interface{}{infoHash, name, foldedName(name), cjkBigrams(name), db.synonyms.ofName(name),
+		metadata, totalSize, discoveredOn, SpamScore(name, files), TorrentCategory(files), source, len(files)},
+		ParseRelease(name).values()...), ParseAlbum(name, files).values()...)...).Scan(&lastInsertId)
 	if err != nil {
 		return errors.Wrap(err, "tx.QueryRow (INSERT INTO torrents)")
 	}
 
 	for _, file := range files {
 		if !utf8.ValidString(file.Path) {
-			zap.L().Warn(
+			zap.L().Named("persistence").Warn(
 				"Ignoring a file whose path is not UTF-8 compliant.",
 				zap.Binary("path", []byte(file.Path)),
 			)
@@ -140,14 +260,40 @@ func (db *postgresDatabase) AddNewTorrent(infoHash []byte, name string, files []
 			return nil
 		}
 
-		_, err = tx.Exec("INSERT INTO files (torrent_id, size, path) VALUES ($1, $2, $3);",
-			lastInsertId, file.Size, file.Path,
+		_, err = tx.Exec("INSERT INTO files (torrent_id, discovered_on, size, path) VALUES ($1, $2, $3, $4);",
+			lastInsertId, discoveredOn, file.Size, file.Path,
 		)
 		if err != nil {
 			return errors.Wrap(err, "tx.Exec (INSERT INTO files)")
 		}
 	}
 
+	_, err = tx.Exec(`
+		INSERT INTO recent_torrents (
+			slot,
+			torrent_id,
+			info_hash,
+			name,
+			total_size,
+			discovered_on,
+			n_files,
+			spam_score
+		) SELECT id % $2, id, info_hash, name, total_size, discovered_on, n_files, spam_score
+		  FROM torrents
+		  WHERE id = $1
+		ON CONFLICT (slot) DO UPDATE SET
+			torrent_id    = EXCLUDED.torrent_id,
+			info_hash     = EXCLUDED.info_hash,
+			name          = EXCLUDED.name,
+			total_size    = EXCLUDED.total_size,
+			discovered_on = EXCLUDED.discovered_on,
+			n_files       = EXCLUDED.n_files,
+			spam_score    = EXCLUDED.spam_score;
+	`, lastInsertId, MaxRecentTorrents)
+	if err != nil {
+		return errors.Wrap(err, "tx.Exec (INSERT INTO recent_torrents)")
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return errors.Wrap(err, "tx.Commit")
@@ -156,6 +302,180 @@ func (db *postgresDatabase) AddNewTorrent(infoHash []byte, name string, files []
 	return nil
 }
 
+func (db *postgresDatabase) UpsertTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) (bool, error) {
+	if !utf8.ValidString(name) {
+		zap.L().Named("persistence").Warn(
+			"Ignoring a torrent whose name is not UTF-8 compliant.",
+			zap.ByteString("infoHash", infoHash),
+			zap.Binary("name", []byte(name)),
+		)
+
+		return false, nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	// The row is locked so that the concurrent upserts of the same torrent are serialised.
+	var id int64
+	var oldName string
+	var oldMetadata []byte
+	var discoveredOn time.Time
+	err = tx.QueryRow(
+		"SELECT id, name, metadata, discovered_on FROM torrents WHERE info_hash = $1 FOR UPDATE;", infoHash,
+	).Scan(&id, &oldName, &oldMetadata, &discoveredOn)
+	if err == sql.ErrNoRows {
+		if err = tx.Rollback(); err != nil {
+			return false, errors.Wrap(err, "tx.Rollback")
+		}
+		if err = db.AddNewTorrent(infoHash, name, files, metadata, source); err != nil {
+			return false, errors.Wrap(err, "AddNewTorrent")
+		}
+		// The torrents whose total size is zero are ignored by AddNewTorrent.
+		return db.DoesTorrentExist(infoHash)
+	} else if err != nil {
+		return false, errors.Wrap(err, "tx.QueryRow (SELECT FROM torrents)")
+	}
+
+	if name == oldName && bytes.Equal(metadata, oldMetadata) {
+		return false, nil
+	}
+
+	var totalSize uint64 = 0
+	for _, file := range files {
+		totalSize += uint64(file.Size)
+	}
+	if totalSize == 0 {
+		zap.L().Named("persistence").Debug("Ignoring a torrent whose total size is zero.")
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+		UPDATE torrents
+		SET name        = $1,
+			folded_name = $2,
+			cjk_bigrams = $3,
+			synonyms    = $4,
+			metadata    = $5,
+			total_size  = $6,
+			n_files     = $7,
+			spam_score  = $8,
+			category    = $9,
+			release_title      = $10,
+			release_year       = $11,
+			release_season     = $12,
+			release_episode    = $13,
+			release_resolution = $14,
+			release_codec      = $15,
+			release_group      = $16,
+			album_artist       = $17,
+			album_title        = $18,
+			album_n_tracks     = $19
+		WHERE id = $20;
+	`, append(append(append([]interface{}{name, foldedName(name), cjkBigrams(name), db.synonyms.ofName(name),
+		metadata, totalSize, len(files), SpamScore(name, files), TorrentCategory(files)},
+		ParseRelease(name).values()...), ParseAlbum(name, files).values()...), id)...)
+	if err != nil {
+		return false, errors.Wrap(err, "tx.Exec (UPDATE torrents)")
+	}
+
+	if _, err = tx.Exec("DELETE FROM files WHERE torrent_id = $1;", id); err != nil {
+		return false, errors.Wrap(err, "tx.Exec (DELETE FROM files)")
+	}
+	for _, file := range files {
+		if !utf8.ValidString(file.Path) {
+			zap.L().Named("persistence").Warn(
+				"Ignoring a file whose path is not UTF-8 compliant.",
+				zap.Binary("path", []byte(file.Path)),
+			)
+
+			// Returning so deferred tx.Rollback() will be called and transaction will be canceled.
+			return false, nil
+		}
+
+		_, err = tx.Exec("INSERT INTO files (torrent_id, discovered_on, size, path) VALUES ($1, $2, $3, $4);",
+			id, discoveredOn, file.Size, file.Path)
+		if err != nil {
+			return false, errors.Wrap(err, "tx.Exec (INSERT INTO files)")
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE recent_torrents
+		SET name       = torrents.name,
+			total_size = torrents.total_size,
+			n_files    = torrents.n_files,
+			spam_score = torrents.spam_score
+		FROM torrents
+		WHERE torrents.id = $1 AND recent_torrents.torrent_id = torrents.id;
+	`, id)
+	if err != nil {
+		return false, errors.Wrap(err, "tx.Exec (UPDATE recent_torrents)")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "tx.Commit")
+	}
+	return true, nil
+}
+
+func (db *postgresDatabase) SetDiscoveredOn(infoHash []byte, discoveredOn int64) error {
+	// The torrent (and its files) are moved to the partitions of the month of their discovery.
+	if err := db.partitions.ensure(db.conn, fromUnix(discoveredOn), db.conn.tx == nil); err != nil {
+		return errors.Wrap(err, "partitions.ensure")
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE files SET discovered_on = $1 WHERE torrent_id IN (SELECT id FROM torrents WHERE info_hash = $2);",
+		fromUnix(discoveredOn), infoHash)
+	if err != nil {
+		return errors.Wrap(err, "tx.Exec (UPDATE files)")
+	}
+	_, err = tx.Exec("UPDATE torrents SET discovered_on = $1 WHERE info_hash = $2;", fromUnix(discoveredOn), infoHash)
+	if err != nil {
+		return errors.Wrap(err, "tx.Exec (UPDATE torrents)")
+	}
+	_, err = tx.Exec("UPDATE recent_torrents SET discovered_on = $1 WHERE info_hash = $2;", fromUnix(discoveredOn),
+		infoHash)
+	if err != nil {
+		return errors.Wrap(err, "tx.Exec (UPDATE recent_torrents)")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "tx.Commit")
+	}
+	return nil
+}
+
+func (db *postgresDatabase) WithTx(fn func(tx Database) error) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	// The searches in the transaction have a breaker of their own, as they are few.
+	tdb := &postgresDatabase{conn: db.conn.bind(tx), schema: db.schema, ranking: db.ranking, partitions: db.partitions,
+		pathSearch: db.pathSearch, cjkBigrams: db.cjkBigrams, synonyms: db.synonyms}
+	if err = fn(tdb); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "tx.Commit")
+	}
+	return nil
+}
+
 func (db *postgresDatabase) Close() error {
 	return db.conn.Close()
 }
@@ -164,8 +484,12 @@ func (db *postgresDatabase) GetNumberOfTorrents() (uint, error) {
 	// Using estimated number of rows which can make queries much faster
 	// https://www.postgresql.org/message-id/568BF820.9060101%40comarch.com
 	// https://wiki.postgresql.org/wiki/Count_estimate
-	rows, err := db.conn.Query(
-		"SELECT reltuples::BIGINT AS estimate_count FROM pg_class WHERE relname='torrents';",
+	// The estimates are of the partitions of the torrents (see partitions), as the partitioned
+	// table itself has none.
+	rows, err := db.conn.Query(`
+		SELECT COALESCE(SUM(GREATEST(c.reltuples, 0)), 0)::BIGINT AS estimate_count
+		FROM pg_partition_tree('torrents') AS p
+		INNER JOIN pg_class AS c ON c.oid = p.relid;`,
 	)
 	if err != nil {
 		return 0, err
@@ -190,6 +514,53 @@ func (db *postgresDatabase) GetNumberOfTorrents() (uint, error) {
 	}
 }
 
+func (db *postgresDatabase) GetTotalSize() (uint64, error) {
+	var totalSize uint64
+	err := db.conn.QueryRow("SELECT COALESCE(SUM(total_size), 0) FROM torrents;").Scan(&totalSize)
+	return totalSize, err
+}
+
+func (db *postgresDatabase) GetNumberOfDiscoveredTorrents(from int64) (uint64, error) {
+	var n uint64
+	err := db.conn.QueryRow("SELECT COUNT(*) FROM torrents WHERE discovered_on >= $1;", time.Unix(from, 0)).Scan(&n)
+	return n, err
+}
+
+func (db *postgresDatabase) GetRecentTorrents(limit uint) ([]TorrentMetadata, error) {
+	rows, err := db.conn.Query(`
+		SELECT
+			torrent_id,
+			info_hash,
+			name,
+			total_size,
+			discovered_on,
+			n_files,
+			spam_score
+		FROM recent_torrents
+		ORDER BY torrent_id DESC
+		LIMIT $1;`,
+		limit,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "conn.Query (SELECT FROM recent_torrents)")
+	}
+	defer db.closeRows(rows)
+
+	torrents := make([]TorrentMetadata, 0)
+	for rows.Next() {
+		var tm TorrentMetadata
+		if err = rows.Scan(&tm.ID, &tm.InfoHash, &tm.Name, &tm.Size, timeScanner{&tm.DiscoveredOn}, &tm.NFiles, &tm.SpamScore); err != nil {
+			return nil, err
+		}
+		torrents = append(torrents, tm)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return torrents, nil
+}
+
 func (db *postgresDatabase) QueryTorrents(
 	query string,
 	epoch int64,
@@ -198,94 +569,112 @@ func (db *postgresDatabase) QueryTorrents(
 	limit uint,
 	lastOrderedValue *float64,
 	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
 ) ([]TorrentMetadata, error) {
-	if query == "" && orderBy == ByRelevance {
-		return nil, fmt.Errorf("torrents cannot be ordered by relevance when the query is empty")
-	}
-	if (lastOrderedValue == nil) != (lastID == nil) {
-		return nil, fmt.Errorf("lastOrderedValue and lastID should be supplied together, if supplied")
-	}
-
-	doJoin := query != ""
-	firstPage := lastID == nil
-
-	// executeTemplate is used to prepare the SQL query, WITH PLACEHOLDERS FOR USER INPUT.
-	sqlQuery := executeTemplate(`
-    		SELECT id
-                 , info_hash
-    			 , name
-    			 , total_size
-    			 , discovered_on
-    			 , (SELECT COUNT(*) FROM files WHERE torrents.id = files.torrent_id) AS n_files
-    		FROM torrents
-    	{{ if not .FirstPage }}
-    			  AND ( {{.OrderOn}}, id ) {{GTEorLTE .Ascending}} (?, ?) -- https://www.sqlite.org/rowvalue.html#row_value_comparisons
-    	{{ end }}
-    		ORDER BY {{.OrderOn}} {{AscOrDesc .Ascending}}, id {{AscOrDesc .Ascending}}
-    		LIMIT ?;
-    	`, struct {
-		DoJoin    bool
-		FirstPage bool
-		OrderOn   string
-		Ascending bool
-	}{
-		DoJoin:    doJoin,
-		FirstPage: firstPage,
-		OrderOn:   orderOn(orderBy),
-		Ascending: ascending,
-	}, template.FuncMap{
-		"GTEorLTE": func(ascending bool) string {
-			if ascending {
-				return ">"
-			} else {
-				return "<"
-			}
-		},
-		"AscOrDesc": func(ascending bool) string {
-			if ascending {
-				return "ASC"
-			} else {
-				return "DESC"
-			}
-		},
-	})
-	print(sqlQuery)
+	if err := checkSearch(query, filters.Refinements, postgresCostModel, &db.breaker); err != nil {
+		return nil, err
+	}
+	if err := checkPathSearch(filters, db.pathSearch); err != nil {
+		return nil, err
+	}
+	query, filters = db.synonyms.canonicalizeSearch(query, filters)
+	if db.cjkBigrams {
+		query, filters = expandCJKSearch(query, filters)
+	}
 
-	// Prepare query
-	queryArgs := make([]interface{}, 0)
-	queryArgs = append(queryArgs, epoch)
-	if !firstPage {
-		queryArgs = append(queryArgs, lastOrderedValue)
-		queryArgs = append(queryArgs, lastID)
+	sqlQuery, queryArgs, scanDests, err := searchQuery(postgresDialect, db.ranking, query, epoch, orderBy, ascending, limit,
+		lastOrderedValue, lastID, filters, fields)
+	if err != nil {
+		return nil, err
 	}
-	queryArgs = append(queryArgs, limit)
 
+	startedOn := time.Now()
 	rows, err := db.conn.Query(sqlQuery, queryArgs...)
-	defer closeRows(rows)
 	if err != nil {
+		recordIfTimedOut(err, startedOn, db.conn.timeout, &db.breaker)
 		return nil, errors.Wrap(err, "query error")
 	}
+	defer closeRows(rows)
 
 	torrents := make([]TorrentMetadata, 0)
 	for rows.Next() {
 		var torrent TorrentMetadata
-		err = rows.Scan(
-			&torrent.ID,
-			&torrent.InfoHash,
-			&torrent.Name,
-			&torrent.Size,
-			&torrent.DiscoveredOn,
-			&torrent.NFiles,
-		)
-		if err != nil {
+		if err = rows.Scan(scanDests(&torrent)...); err != nil {
 			return nil, err
 		}
 		torrents = append(torrents, torrent)
 	}
+	if err = rows.Err(); err != nil {
+		recordIfTimedOut(err, startedOn, db.conn.timeout, &db.breaker)
+		return nil, err
+	}
 
 	return torrents, nil
 }
 
+func (db *postgresDatabase) ExplainTorrents(
+	analyze bool,
+	query string,
+	epoch int64,
+	orderBy OrderingCriteria,
+	ascending bool,
+	limit uint,
+	lastOrderedValue *float64,
+	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
+) (*QueryPlan, error) {
+	if err := checkSearch(query, filters.Refinements, postgresCostModel, &db.breaker); err != nil {
+		return nil, err
+	}
+	if err := checkPathSearch(filters, db.pathSearch); err != nil {
+		return nil, err
+	}
+	query, filters = db.synonyms.canonicalizeSearch(query, filters)
+	if db.cjkBigrams {
+		query, filters = expandCJKSearch(query, filters)
+	}
+
+	sqlQuery, queryArgs, _, err := searchQuery(postgresDialect, db.ranking, query, epoch, orderBy, ascending, limit,
+		lastOrderedValue, lastID, filters, fields)
+	if err != nil {
+		return nil, err
+	}
+	plan := &QueryPlan{SQL: sqlQuery, Plan: make([]string, 0)}
+
+	explain := "EXPLAIN "
+	if analyze {
+		explain = "EXPLAIN (ANALYZE, BUFFERS) "
+	}
+	startedOn := time.Now()
+	rows, err := db.conn.Query(explain+sqlQuery, queryArgs...)
+	if err != nil {
+		recordIfTimedOut(err, startedOn, db.conn.timeout, &db.breaker)
+		return nil, errors.Wrap(err, "sql.DB.Query (EXPLAIN)")
+	}
+	defer db.closeRows(rows)
+	for rows.Next() {
+		var line string
+		if err = rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		plan.Plan = append(plan.Plan, line)
+	}
+	if err = rows.Err(); err != nil {
+		recordIfTimedOut(err, startedOn, db.conn.timeout, &db.breaker)
+		return nil, err
+	}
+
+	if analyze {
+		plan.Analyzed = true
+		plan.Elapsed = float64(time.Since(startedOn)) / float64(time.Millisecond)
+		plan.Rows = postgresPlanRows(plan.Plan)
+	}
+
+	return plan, nil
+}
+
 func (db *postgresDatabase) GetTorrent(infoHash []byte) (*TorrentMetadata, error) {
 	rows, err := db.conn.Query(`
 		SELECT
@@ -293,24 +682,47 @@ func (db *postgresDatabase) GetTorrent(infoHash []byte) (*TorrentMetadata, error
 			t.name,
 			t.total_size,
 			t.discovered_on,
-			(SELECT COUNT(*) FROM files f WHERE f.torrent_id = t.id) AS n_files
+			t.n_files,
+			t.spam_score,
+			t.moderation,
+			t.source,
+			t.popularity,
+			t.text_path,
+			t.text_content
 		FROM torrents t
 		WHERE t.info_hash = $1;`,
 		infoHash,
 	)
-	defer db.closeRows(rows)
 	if err != nil {
 		return nil, err
 	}
+	defer db.closeRows(rows)
 
 	if !rows.Next() {
 		return nil, nil
 	}
 
 	var tm TorrentMetadata
-	if err = rows.Scan(&tm.InfoHash, &tm.Name, &tm.Size, &tm.DiscoveredOn, &tm.NFiles); err != nil {
+	var textPath, textContent sql.NullString
+	if err = rows.Scan(&tm.InfoHash, &tm.Name, &tm.Size, timeScanner{&tm.DiscoveredOn}, &tm.NFiles, &tm.SpamScore, &tm.Moderation, &tm.Source,
+		&tm.Popularity, &textPath, &textContent); err != nil {
 		return nil, err
 	}
+	if textPath.Valid {
+		tm.Text = &TorrentText{Path: textPath.String, Content: textContent.String}
+	}
+
+	files, err := db.GetFiles(infoHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetFiles")
+	}
+	tm.Extensions = ExtensionBreakdown(files)
+	if release := ParseRelease(tm.Name); release != (Release{}) {
+		tm.Release = &release
+	}
+	if album := ParseAlbum(tm.Name, files); album != (Album{}) {
+		tm.Album = &album
+	}
 
 	return &tm, nil
 }
@@ -323,10 +735,10 @@ func (db *postgresDatabase) GetFiles(infoHash []byte) ([]File, error) {
 		FROM files f, torrents t WHERE f.torrent_id = t.id AND t.info_hash = $1;`,
 		infoHash,
 	)
-	defer db.closeRows(rows)
 	if err != nil {
 		return nil, err
 	}
+	defer db.closeRows(rows)
 
 	var files []File
 	for rows.Next() {
@@ -340,74 +752,1328 @@ func (db *postgresDatabase) GetFiles(infoHash []byte) ([]File, error) {
 	return files, nil
 }
 
-func (db *postgresDatabase) GetStatistics(from string, n uint) (*Statistics, error) {
-	fromTime, gran, err := ParseISO8601(from)
-	if err != nil {
-		return nil, errors.Wrap(err, "parsing ISO8601 error")
+func (db *postgresDatabase) GetMetadata(infoHash []byte) ([]byte, error) {
+	var metadata []byte
+	err := db.conn.QueryRow("SELECT metadata FROM torrents WHERE info_hash = $1;", infoHash).Scan(&metadata)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow")
 	}
+	if metadata == nil {
+		metadata = []byte{}
+	}
+	return metadata, nil
+}
 
-	var toTime time.Time
-	var timef string // time format: https://www.sqlite.org/lang_datefunc.html
-
-	switch gran {
-	case Year:
-		toTime = fromTime.AddDate(int(n), 0, 0)
-		timef = "YYYY"
-	case Month:
-		toTime = fromTime.AddDate(0, int(n), 0)
-		timef = "YYYY-mm"
-	case Week:
-		toTime = fromTime.AddDate(0, 0, int(n)*7)
-		timef = "YYYY-WW"
-	case Day:
-		toTime = fromTime.AddDate(0, 0, int(n))
-		timef = "YYYY-mm-dd"
-	case Hour:
-		toTime = fromTime.Add(time.Duration(n) * time.Hour)
-		timef = "YYYY-mm-dd\"T\"HH"
-	}
-
-	// TODO: make it faster!
-	rows, err := db.conn.Query(fmt.Sprintf(`
-	SELECT to_char(to_timestamp(discovered_on), '%s') AS dT, 
-		   sum(files.size) AS tS, 
-		   count(DISTINCT torrents.id) AS nD, 
-		   count(DISTINCT files.id) AS nF
-	FROM torrents, files
-	 WHERE torrents.id = files.torrent_id AND discovered_on >= $1 AND discovered_on <= $2
-	GROUP BY dt;`,
-		timef), fromTime.Unix(), toTime.Unix())
-	defer closeRows(rows)
+func (db *postgresDatabase) QueryFiles(infoHash []byte, pathContains string, offset uint, limit uint) ([]File, error) {
+	rows, err := db.conn.Query(`
+		SELECT
+			f.size,
+			f.path
+		FROM files f, torrents t
+		WHERE     f.torrent_id = t.id
+		      AND t.info_hash = $1
+		      AND f.path ILIKE $2 ESCAPE '\'
+		ORDER BY f.id
+		LIMIT $3 OFFSET $4;`,
+		infoHash, "%"+escapeLike(pathContains)+"%", limit, offset,
+	)
 	if err != nil {
 		return nil, err
 	}
+	defer db.closeRows(rows)
 
-	stats := NewStatistics()
-
+	files := make([]File, 0)
 	for rows.Next() {
-		var dT string
-		var tS, nD, nF uint64
-		if err := rows.Scan(&dT, &tS, &nD, &nF); err != nil {
-			if err := rows.Close(); err != nil {
-				panic(err.Error())
-			}
+		var file File
+		if err = rows.Scan(&file.Size, &file.Path); err != nil {
 			return nil, err
 		}
-		stats.NDiscovered[dT] = nD
-		stats.TotalSize[dT] = tS
-		stats.NFiles[dT] = nF
+		files = append(files, file)
 	}
 
-	return stats, nil
+	return files, nil
 }
 
-func (db *postgresDatabase) setupDatabase() error {
-	tx, err := db.conn.Begin()
+func (db *postgresDatabase) GetFileTree(infoHash []byte) (*FileTreeNode, error) {
+	files, err := db.GetFiles(infoHash)
 	if err != nil {
-		return errors.Wrap(err, "sql.DB.Begin")
+		return nil, err
+	} else if files == nil {
+		return nil, nil
 	}
 
-	defer tx.Rollback()
+	return NewFileTree(files), nil
+}
+
+func (db *postgresDatabase) GetStatistics(from string, n uint, loc *time.Location) (*Statistics, error) {
+	fromTime, gran, err := ParseISO8601(from)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing ISO8601 error")
+	}
+	if n > MaxStatisticsPeriods {
+		return nil, fmt.Errorf("n must be at most %d", MaxStatisticsPeriods)
+	}
+	buckets := statisticsBuckets(InLocation(*fromTime, loc), gran, n)
+	if len(buckets) == 0 {
+		return NewStatistics(), nil
+	}
+
+	// The torrents of each bucket are read using the index on discovered_on.
+	return parallelStatistics(buckets, db.statisticsWorkers(), func(buckets []bucket) (*timedRows, error) {
+		return db.conn.Query(`
+			WITH buckets (i, start_on, end_on) AS (` + bucketsValues(buckets, "to_timestamp(%d)") + `)
+			SELECT buckets.i
+				 , COALESCE(SUM(files.size), 0)
+				 , COUNT(DISTINCT torrents.id)
+				 , COUNT(files.id)
+			FROM buckets
+			INNER JOIN torrents ON torrents.discovered_on >= buckets.start_on AND torrents.discovered_on < buckets.end_on
+			INNER JOIN files ON files.torrent_id = torrents.id
+			GROUP BY buckets.i;`,
+		)
+	})
+}
+
+// statisticsWorkers returns the number of the queries of GetStatistics that can be run
+// concurrently, which is one in a transaction.
+func (db *postgresDatabase) statisticsWorkers() int {
+	if db.conn.tx != nil {
+		return 1
+	}
+	return statisticsWorkers
+}
+
+func (db *postgresDatabase) GetDashboard(from int64) (*Dashboard, error) {
+	dashboard := newDashboard()
+	fromTime := time.Unix(from, 0)
+
+	var lastDiscoveredOn sql.NullTime
+	err := db.conn.QueryRow(
+		"SELECT COUNT(*), MAX(discovered_on) FROM torrents WHERE discovered_on >= $1;",
+		fromTime,
+	).Scan(&dashboard.NDiscovered, &lastDiscoveredOn)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow (totals)")
+	}
+	if lastDiscoveredOn.Valid {
+		dashboard.LastDiscoveredOn = lastDiscoveredOn.Time.Unix()
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT `+sizeBucketCase()+` AS bucket, COUNT(*)
+		FROM torrents
+		WHERE discovered_on >= $1
+		GROUP BY bucket;`,
+		fromTime,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (size distribution)")
+	}
+	for rows.Next() {
+		var bucket int
+		var n uint64
+		if err = rows.Scan(&bucket, &n); err != nil {
+			db.closeRows(rows)
+			return nil, err
+		}
+		dashboard.SizeDistribution[bucket].NTorrents = n
+	}
+	if err = rows.Err(); err != nil {
+		db.closeRows(rows)
+		return nil, errors.Wrap(err, "sql.Rows.Err (size distribution)")
+	}
+	db.closeRows(rows)
+
+	rows, err = db.conn.Query(
+		"SELECT category, COUNT(*) FROM torrents WHERE discovered_on >= $1 GROUP BY category;",
+		fromTime,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (categories)")
+	}
+	for rows.Next() {
+		var category Category
+		var n uint64
+		if err = rows.Scan(&category, &n); err != nil {
+			db.closeRows(rows)
+			return nil, err
+		}
+		dashboard.Categories[category] = n
+	}
+	if err = rows.Err(); err != nil {
+		db.closeRows(rows)
+		return nil, errors.Wrap(err, "sql.Rows.Err (categories)")
+	}
+	db.closeRows(rows)
+
+	rows, err = db.conn.Query(
+		"SELECT source, COUNT(*) FROM torrents WHERE discovered_on >= $1 GROUP BY source;",
+		fromTime,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (sources)")
+	}
+	for rows.Next() {
+		var source Source
+		var n uint64
+		if err = rows.Scan(&source, &n); err != nil {
+			db.closeRows(rows)
+			return nil, err
+		}
+		dashboard.Sources[source] = n
+	}
+	if err = rows.Err(); err != nil {
+		db.closeRows(rows)
+		return nil, errors.Wrap(err, "sql.Rows.Err (sources)")
+	}
+	db.closeRows(rows)
+
+	rows, err = db.conn.Query(`
+		SELECT discoveries.peer_country, COUNT(*)
+		FROM discoveries
+		INNER JOIN torrents ON torrents.id = discoveries.torrent_id
+		WHERE torrents.discovered_on >= $1 AND discoveries.peer_country IS NOT NULL
+		GROUP BY discoveries.peer_country;`,
+		fromTime,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (countries)")
+	}
+	for rows.Next() {
+		var country string
+		var n uint64
+		if err = rows.Scan(&country, &n); err != nil {
+			db.closeRows(rows)
+			return nil, err
+		}
+		dashboard.Countries[country] = n
+	}
+	if err = rows.Err(); err != nil {
+		db.closeRows(rows)
+		return nil, errors.Wrap(err, "sql.Rows.Err (countries)")
+	}
+	db.closeRows(rows)
+
+	rows, err = db.conn.Query(`
+		SELECT files.path, files.size
+		FROM files
+		WHERE files.torrent_id IN (
+			SELECT id FROM torrents WHERE discovered_on >= $1 ORDER BY discovered_on DESC LIMIT $2
+		);`,
+		fromTime, dashboardFileSample,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (extensions)")
+	}
+	dashboard.TopExtensions, err = countExtensions(rows)
+	db.closeRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return dashboard, nil
+}
+
+func (db *postgresDatabase) GetFacets(query string, epoch int64, filters QueryFilters) (*Facets, error) {
+	if err := checkSearch(query, filters.Refinements, postgresCostModel, &db.breaker); err != nil {
+		return nil, err
+	}
+	if err := checkPathSearch(filters, db.pathSearch); err != nil {
+		return nil, err
+	}
+	query, filters = db.synonyms.canonicalizeSearch(query, filters)
+	if db.cjkBigrams {
+		query, filters = expandCJKSearch(query, filters)
+	}
+	facets := newFacets()
+
+	q := facetsQuery(postgresDialect, query, epoch, filters)
+	matches, matchesArgs, err := q.build()
+	if err != nil {
+		return nil, errors.Wrap(err, "queryBuilder.build")
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT category
+			 , CAST(EXTRACT(YEAR FROM discovered_on AT TIME ZONE 'UTC') AS INTEGER) AS year
+			 , `+sizeBucketCase()+` AS bucket
+			 , COUNT(*)
+		FROM (`+matches+`) AS matches
+		GROUP BY category, year, bucket;`,
+		matchesArgs...,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (counts)")
+	}
+	err = facets.scanCounts(rows)
+	db.closeRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = db.conn.Query(`
+		SELECT files.path, files.size
+		FROM files
+		WHERE files.torrent_id IN (
+			SELECT id FROM (`+matches+`) AS matches ORDER BY discovered_on DESC LIMIT `+q.arg(facetFileSample)+`
+		);`,
+		q.args...,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (extensions)")
+	}
+	facets.TopExtensions, err = countExtensions(rows)
+	db.closeRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if facets.TopArtists, facets.TopAlbums, err = countAlbums(db.conn, matches, matchesArgs); err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
+
+func (db *postgresDatabase) GetPoolStats() (*PoolStats, error) {
+	return newPoolStats(db.conn.Stats()), nil
+}
+
+// maxStatementStats is the maximum number of the statements of pg_stat_statements that the indices
+// are advised for, the ones that took the most time in total.
+const maxStatementStats = 500
+
+func (db *postgresDatabase) RefreshSynonyms() (uint64, error) {
+	tx, err := db.conn.unlimited().Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	n, err := refreshSynonyms(tx, postgresDialect, db.synonyms)
+	if err != nil {
+		return 0, errors.Wrap(err, "refreshSynonyms")
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "tx.Commit")
+	}
+	return n, nil
+}
+
+func (db *postgresDatabase) AdviseIndexes(queries []QueryStat, create bool) ([]IndexAdvice, error) {
+	statements, err := db.getStatementStats()
+	if err != nil {
+		return nil, errors.Wrap(err, "getStatementStats")
+	}
+	queries = append(queries, statements...)
+
+	schema := newIndexSchema()
+	rows, err := db.conn.Query(
+		"SELECT table_name, column_name FROM information_schema.columns WHERE table_schema = current_schema();")
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (information_schema.columns)")
+	}
+	defer db.closeRows(rows)
+	for rows.Next() {
+		var table, column string
+		if err = rows.Scan(&table, &column); err != nil {
+			return nil, errors.Wrap(err, "sql.Rows.Scan (information_schema.columns)")
+		}
+		schema.addColumn(table, column)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "sql.Rows.Err (information_schema.columns)")
+	}
+
+	// The leading columns of the indices (which are not on an expression), and whether they are of
+	// pg_trgm.
+	rows, err = db.conn.Query(`
+		SELECT t.relname, a.attname, COALESCE(opc.opcname = 'gin_trgm_ops', FALSE)
+		FROM pg_index AS i
+		INNER JOIN pg_class AS t ON t.oid = i.indrelid
+		INNER JOIN pg_attribute AS a ON a.attrelid = t.oid AND a.attnum = i.indkey[0]
+		LEFT JOIN pg_opclass AS opc ON opc.oid = i.indclass[0]
+		WHERE t.relnamespace = current_schema()::regnamespace;`)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (pg_index)")
+	}
+	defer db.closeRows(rows)
+	for rows.Next() {
+		var table, column string
+		var trigram bool
+		if err = rows.Scan(&table, &column, &trigram); err != nil {
+			return nil, errors.Wrap(err, "sql.Rows.Scan (pg_index)")
+		}
+		schema.addIndex(table, column, trigram)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "sql.Rows.Err (pg_index)")
+	}
+
+	advices := adviseIndexes(queries, schema, true)
+	if create {
+		for _, advice := range advices {
+			// The indices of the large tables take longer than the queries are limited to.
+			if _, err = db.conn.DB.Exec(advice.DDL); err != nil {
+				return nil, errors.Wrapf(err, "sql.DB.Exec (%s)", advice.DDL)
+			}
+		}
+	}
+	return advices, nil
+}
+
+// getStatementStats returns the statistics of the statements on the database that took the most
+// time in total, as of pg_stat_statements, or none if the extension is not installed.
+func (db *postgresDatabase) getStatementStats() ([]QueryStat, error) {
+	// The extension might be in another schema than the one of magnetico, and its column of the
+	// total time is `total_exec_time` since PostgreSQL 13.
+	var schema, column string
+	err := db.conn.QueryRow(`
+		SELECT n.nspname, c.column_name
+		FROM pg_extension AS e
+		INNER JOIN pg_namespace AS n ON n.oid = e.extnamespace
+		INNER JOIN information_schema.columns AS c
+			ON c.table_schema = n.nspname AND c.table_name = 'pg_stat_statements'
+		WHERE e.extname = 'pg_stat_statements' AND c.column_name IN ('total_exec_time', 'total_time')
+		LIMIT 1;`,
+	).Scan(&schema, &column)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow (pg_extension)")
+	}
+
+	rows, err := db.conn.Query(fmt.Sprintf(`
+		SELECT query, calls, %s
+		FROM %s.pg_stat_statements
+		WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+		ORDER BY 3 DESC
+		LIMIT $1;`,
+		column, quoteIdentifier(schema),
+	), maxStatementStats)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (pg_stat_statements)")
+	}
+	defer db.closeRows(rows)
+
+	stats := make([]QueryStat, 0)
+	for rows.Next() {
+		var stat QueryStat
+		var totalTime float64 // in milliseconds
+		if err = rows.Scan(&stat.Query, &stat.Calls, &totalTime); err != nil {
+			return nil, errors.Wrap(err, "sql.Rows.Scan (pg_stat_statements)")
+		}
+		stat.TotalTime = time.Duration(totalTime * float64(time.Millisecond))
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// quoteIdentifier quotes the identifier (e.g. the name of a schema) for PostgreSQL.
+func quoteIdentifier(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
+func (db *postgresDatabase) GetStorageReport() (*StorageReport, error) {
+	report := new(StorageReport)
+
+	if err := db.conn.QueryRow("SELECT pg_database_size(current_database());").Scan(&report.TotalBytes); err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow (pg_database_size)")
+	}
+
+	for _, table := range []string{"torrents", "files"} {
+		storage := TableStorage{Name: table}
+		// reltuples is an estimate of the number of the rows (see GetNumberOfTorrents), which is
+		// negative if the table has never been analysed. The tables are summed over their
+		// partitions (see partitions).
+		err := db.conn.QueryRow(`
+			SELECT COALESCE(SUM(GREATEST(c.reltuples, 0)), 0)::BIGINT, COALESCE(SUM(pg_total_relation_size(c.oid)), 0)
+			FROM pg_partition_tree($1::regclass) AS p
+			INNER JOIN pg_class AS c ON c.oid = p.relid;`,
+			table,
+		).Scan(&storage.Rows, &storage.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "sql.DB.QueryRow (%s)", table)
+		}
+		report.Tables = append(report.Tables, storage)
+	}
+
+	now := time.Now()
+	var nDiscovered uint64
+	var oldest int64
+	err := db.conn.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM torrents WHERE discovered_on >= to_timestamp($1))
+			 , (SELECT COALESCE(EXTRACT(EPOCH FROM MIN(discovered_on))::BIGINT, 0) FROM torrents);`,
+		now.Add(-growthWindow).Unix(),
+	).Scan(&nDiscovered, &oldest)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow (growth)")
+	}
+
+	// The free space of the disk of the database is unknown, as it might be on another host.
+	report.project(report.Tables[0].Rows, nDiscovered, growthPeriod(oldest, now), now)
+
+	return report, nil
+}
+
+func (db *postgresDatabase) ReportTorrent(infoHash []byte, reason string) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO reports (torrent_id, reason, reported_on)
+		SELECT id, $1, $2 FROM torrents WHERE info_hash = $3;`,
+		reason, now(), infoHash,
+	)
+	return err
+}
+
+func (db *postgresDatabase) GetModerationQueue(limit uint) ([]ModerationQueueItem, error) {
+	rows, err := db.conn.Query(`
+		SELECT t.info_hash
+			 , t.name
+			 , t.moderation
+			 , COUNT(*)
+			 , EXTRACT(EPOCH FROM MAX(r.reported_on))::BIGINT AS last_reported_on
+			 , (SELECT reason FROM reports lr WHERE lr.torrent_id = t.id ORDER BY lr.id DESC LIMIT 1)
+		FROM reports r
+		INNER JOIN torrents t ON r.torrent_id = t.id
+		GROUP BY t.id, t.discovered_on
+		ORDER BY last_reported_on DESC, t.id DESC
+		LIMIT $1;`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer db.closeRows(rows)
+
+	items := make([]ModerationQueueItem, 0)
+	for rows.Next() {
+		var item ModerationQueueItem
+		err = rows.Scan(&item.InfoHash, &item.Name, &item.Moderation, &item.NReports, &item.LastReportedOn,
+			&item.LastReason)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (db *postgresDatabase) SetModerationState(infoHash []byte, state ModerationState) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "conn.Begin")
+	}
+	// If everything goes as planned and no error occurs, we will commit the transaction before
+	// returning from the function so the tx.Rollback() call will fail, trying to rollback a
+	// committed transaction. BUT, if an error occurs, we'll get our transaction rollback'ed, which
+	// is nice.
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE torrents SET moderation = $1 WHERE info_hash = $2;", state, infoHash)
+	if err != nil {
+		return false, errors.Wrap(err, "tx.Exec (UPDATE torrents)")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	} else if n == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(
+		"DELETE FROM reports WHERE torrent_id = (SELECT id FROM torrents WHERE info_hash = $1);",
+		infoHash,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "tx.Exec (DELETE FROM reports)")
+	}
+
+	if state == Flagged {
+		_, err = tx.Exec("DELETE FROM recent_torrents WHERE info_hash = $1;", infoHash)
+		if err != nil {
+			return false, errors.Wrap(err, "tx.Exec (DELETE FROM recent_torrents)")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "tx.Commit")
+	}
+
+	return true, nil
+}
+
+func (db *postgresDatabase) RequestTorrent(infoHash []byte) (*TorrentRequest, error) {
+	_, err := db.conn.Exec(`
+		INSERT INTO requests (info_hash, status, requested_on)
+		VALUES ($1, CASE WHEN EXISTS (SELECT 1 FROM torrents WHERE info_hash = $1) THEN $2 ELSE $3 END, $4)
+		ON CONFLICT (info_hash) DO UPDATE
+			SET status = excluded.status, attempts = 0, requested_on = excluded.requested_on, last_attempted_on = NULL
+			WHERE requests.status = $5;`,
+		infoHash, RequestFetched, RequestPending, now(), RequestFailed,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Exec (INSERT INTO requests)")
+	}
+
+	return db.GetTorrentRequest(infoHash)
+}
+
+func (db *postgresDatabase) GetTorrentRequest(infoHash []byte) (*TorrentRequest, error) {
+	var request TorrentRequest
+	err := db.conn.QueryRow(`
+		SELECT info_hash
+			 , status
+			 , attempts
+			 , EXTRACT(EPOCH FROM requested_on)::BIGINT
+			 , COALESCE(EXTRACT(EPOCH FROM last_attempted_on)::BIGINT, 0)
+		FROM requests
+		WHERE info_hash = $1;`,
+		infoHash,
+	).Scan(&request.InfoHash, &request.Status, &request.Attempts, &request.RequestedOn, &request.LastAttemptedOn)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+func (db *postgresDatabase) GetPendingTorrentRequests(limit uint) ([]TorrentRequest, error) {
+	rows, err := db.conn.Query(`
+		SELECT info_hash
+			 , status
+			 , attempts
+			 , EXTRACT(EPOCH FROM requested_on)::BIGINT
+			 , COALESCE(EXTRACT(EPOCH FROM last_attempted_on)::BIGINT, 0)
+		FROM requests
+		WHERE status IN ($1, $2)
+		ORDER BY last_attempted_on NULLS FIRST, requested_on
+		LIMIT $3;`,
+		RequestPending, RequestLookingUp, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer db.closeRows(rows)
+
+	requests := make([]TorrentRequest, 0)
+	for rows.Next() {
+		var request TorrentRequest
+		if err = rows.Scan(&request.InfoHash, &request.Status, &request.Attempts, &request.RequestedOn,
+			&request.LastAttemptedOn); err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+
+	return requests, rows.Err()
+}
+
+func (db *postgresDatabase) UpdateTorrentRequest(infoHash []byte, status RequestStatus) error {
+	_, err := db.conn.Exec(`
+		UPDATE requests
+		SET status = $1
+		  , attempts = attempts + (CASE WHEN $2 THEN 1 ELSE 0 END)
+		  , last_attempted_on = (CASE WHEN $2 THEN $3 ELSE last_attempted_on END)
+		WHERE info_hash = $4;`,
+		status, status == RequestLookingUp, now(), infoHash,
+	)
+	return err
+}
+
+func (db *postgresDatabase) AddFavorite(username string, infoHash []byte) (bool, error) {
+	// The no-op update counts the favorites that exist already as added.
+	res, err := db.conn.Exec(`
+		INSERT INTO favorites (username, torrent_id, favorited_on)
+		SELECT $1, id, $2 FROM torrents
+		WHERE info_hash = $3 AND (SELECT COUNT(*) FROM favorites WHERE username = $1) < $4
+		ON CONFLICT (username, torrent_id) DO UPDATE SET favorited_on = favorites.favorited_on;`,
+		username, now(), infoHash, MaxFavorites,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (INSERT INTO favorites)")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	} else if n == 0 {
+		// The favorites that exist already are not added if the user has MaxFavorites of them.
+		return db.IsFavorite(username, infoHash)
+	}
+	return true, nil
+}
+
+func (db *postgresDatabase) RemoveFavorite(username string, infoHash []byte) (bool, error) {
+	res, err := db.conn.Exec(`
+		DELETE FROM favorites
+		WHERE username = $1 AND torrent_id = (SELECT id FROM torrents WHERE info_hash = $2);`,
+		username, infoHash,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (DELETE FROM favorites)")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	}
+	return n > 0, nil
+}
+
+func (db *postgresDatabase) IsFavorite(username string, infoHash []byte) (bool, error) {
+	var exists bool
+	err := db.conn.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM favorites f
+			INNER JOIN torrents t ON t.id = f.torrent_id
+			WHERE f.username = $1 AND t.info_hash = $2
+		);`,
+		username, infoHash,
+	).Scan(&exists)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.QueryRow")
+	}
+	return exists, nil
+}
+
+func (db *postgresDatabase) GetFavorites(username string, limit uint) ([]Favorite, error) {
+	rows, err := db.conn.Query(`
+		SELECT
+			t.id,
+			t.info_hash,
+			t.name,
+			t.total_size,
+			t.discovered_on,
+			t.n_files,
+			t.spam_score,
+			t.moderation,
+			EXTRACT(EPOCH FROM f.favorited_on)::BIGINT
+		FROM favorites f
+		INNER JOIN torrents t ON t.id = f.torrent_id
+		WHERE f.username = $1 AND t.moderation <> $2
+		ORDER BY f.favorited_on DESC, t.id DESC
+		LIMIT $3;`,
+		username, Flagged, limit,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (SELECT FROM favorites)")
+	}
+	defer db.closeRows(rows)
+
+	favorites := make([]Favorite, 0)
+	for rows.Next() {
+		var favorite Favorite
+		tm := &favorite.Torrent
+		if err = rows.Scan(&tm.ID, &tm.InfoHash, &tm.Name, &tm.Size, timeScanner{&tm.DiscoveredOn}, &tm.NFiles,
+			&tm.SpamScore, &tm.Moderation, &favorite.FavoritedOn); err != nil {
+			return nil, err
+		}
+		favorites = append(favorites, favorite)
+	}
+
+	return favorites, rows.Err()
+}
+
+func (db *postgresDatabase) AddInteraction(infoHash []byte, interaction Interaction, on int64) (bool, error) {
+	column, err := interactionColumn(interaction)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	var id uint64
+	err = tx.QueryRow("UPDATE torrents SET popularity = popularity + 1 WHERE info_hash = $1 RETURNING id;",
+		infoHash).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "tx.QueryRow (UPDATE torrents)")
+	}
+
+	// The column is one of interactionColumn, never an input.
+	_, err = tx.Exec(`
+		INSERT INTO interactions (torrent_id, day, `+column+`)
+		VALUES ($1, to_timestamp($2), 1)
+		ON CONFLICT (torrent_id, day) DO UPDATE SET `+column+` = interactions.`+column+` + 1;`,
+		id, interactionDay(on),
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "tx.Exec (INSERT INTO interactions)")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "tx.Commit")
+	}
+	return true, nil
+}
+
+func (db *postgresDatabase) GetInteractions(infoHash []byte, from int64) ([]Interactions, error) {
+	rows, err := db.conn.Query(`
+		SELECT EXTRACT(EPOCH FROM i.day)::BIGINT, i.n_magnets, i.n_downloads
+		FROM interactions i
+		INNER JOIN torrents t ON t.id = i.torrent_id
+		WHERE t.info_hash = $1 AND i.day >= to_timestamp($2)
+		ORDER BY i.day ASC;`,
+		infoHash, interactionDay(from),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (SELECT FROM interactions)")
+	}
+	defer db.closeRows(rows)
+
+	interactions := make([]Interactions, 0)
+	for rows.Next() {
+		var i Interactions
+		if err = rows.Scan(&i.Day, &i.NMagnets, &i.NDownloads); err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, i)
+	}
+
+	return interactions, rows.Err()
+}
+
+func (db *postgresDatabase) AddAPIKey(name string, keyHash []byte, limits APIKeyLimits, createdOn int64) (uint64, error) {
+	var id uint64
+	err := db.conn.QueryRow(`
+		INSERT INTO api_keys (name, key_hash, requests_per_minute, rows_per_day, created_on)
+		VALUES ($1, $2, $3, $4, to_timestamp($5))
+		RETURNING id;`,
+		name, keyHash, limits.RequestsPerMinute, limits.RowsPerDay, createdOn,
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "sql.DB.QueryRow (INSERT INTO api_keys)")
+	}
+	return id, nil
+}
+
+func (db *postgresDatabase) GetAPIKey(keyHash []byte, on int64) (*APIKey, error) {
+	rows, err := db.conn.Query(`
+		SELECT k.id, k.name, k.requests_per_minute, k.rows_per_day,
+			EXTRACT(EPOCH FROM k.created_on)::BIGINT, COALESCE(EXTRACT(EPOCH FROM k.revoked_on)::BIGINT, 0),
+			COALESCE(u.n_requests, 0), COALESCE(u.n_rows, 0)
+		FROM api_keys k
+		LEFT JOIN api_key_usage u ON u.api_key_id = k.id AND u.day = to_timestamp($1)
+		WHERE k.key_hash = $2;`,
+		apiKeyUsageDay(on), keyHash,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (SELECT FROM api_keys)")
+	}
+	defer db.closeRows(rows)
+
+	keys, err := scanAPIKeys(rows)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	return &keys[0], nil
+}
+
+func (db *postgresDatabase) GetAPIKeys(on int64) ([]APIKey, error) {
+	rows, err := db.conn.Query(`
+		SELECT k.id, k.name, k.requests_per_minute, k.rows_per_day,
+			EXTRACT(EPOCH FROM k.created_on)::BIGINT, COALESCE(EXTRACT(EPOCH FROM k.revoked_on)::BIGINT, 0),
+			COALESCE(u.n_requests, 0), COALESCE(u.n_rows, 0)
+		FROM api_keys k
+		LEFT JOIN api_key_usage u ON u.api_key_id = k.id AND u.day = to_timestamp($1)
+		ORDER BY k.created_on DESC, k.id DESC;`,
+		apiKeyUsageDay(on),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (SELECT FROM api_keys)")
+	}
+	defer db.closeRows(rows)
+
+	return scanAPIKeys(rows)
+}
+
+func (db *postgresDatabase) UpdateAPIKey(id uint64, limits APIKeyLimits) (bool, error) {
+	res, err := db.conn.Exec(`
+		UPDATE api_keys SET requests_per_minute = $1, rows_per_day = $2 WHERE id = $3;`,
+		limits.RequestsPerMinute, limits.RowsPerDay, id,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (UPDATE api_keys)")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	}
+	return n > 0, nil
+}
+
+func (db *postgresDatabase) RevokeAPIKey(id uint64, on int64) (bool, error) {
+	res, err := db.conn.Exec(`
+		UPDATE api_keys SET revoked_on = to_timestamp($1) WHERE id = $2 AND revoked_on IS NULL;`,
+		on, id,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (UPDATE api_keys)")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	}
+	return n > 0, nil
+}
+
+func (db *postgresDatabase) AddAPIKeyUsage(id uint64, nRequests uint64, nRows uint64, on int64) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO api_key_usage (api_key_id, day, n_requests, n_rows)
+		VALUES ($1, to_timestamp($2), $3, $4)
+		ON CONFLICT (api_key_id, day) DO UPDATE SET
+			n_requests = api_key_usage.n_requests + excluded.n_requests,
+			n_rows     = api_key_usage.n_rows + excluded.n_rows;`,
+		id, apiKeyUsageDay(on), nRequests, nRows,
+	)
+	if err != nil {
+		return errors.Wrap(err, "sql.DB.Exec (INSERT INTO api_key_usage)")
+	}
+	return nil
+}
+
+func (db *postgresDatabase) AddSightings(sightings []Sighting, on int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	hour := sightingHour(on)
+	for _, sighting := range sightings {
+		_, err = tx.Exec(`
+			INSERT INTO sightings (torrent_id, hour, count)
+			SELECT id, to_timestamp($1), $2 FROM torrents WHERE info_hash = $3
+			ON CONFLICT (torrent_id, hour) DO UPDATE SET count = sightings.count + EXCLUDED.count;`,
+			hour, sighting.Count, sighting.InfoHash,
+		)
+		if err != nil {
+			return errors.Wrap(err, "tx.Exec (INSERT INTO sightings)")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "tx.Commit")
+	}
+	return nil
+}
+
+func (db *postgresDatabase) UpdateTrending(since int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM sightings WHERE hour < to_timestamp($1);", sightingHour(since)); err != nil {
+		return errors.Wrap(err, "tx.Exec (DELETE FROM sightings)")
+	}
+	if _, err = tx.Exec("DELETE FROM trending;"); err != nil {
+		return errors.Wrap(err, "tx.Exec (DELETE FROM trending)")
+	}
+	_, err = tx.Exec(`
+		INSERT INTO trending (torrent_id, sightings)
+		SELECT torrent_id, SUM(count) AS total
+		FROM sightings
+		GROUP BY torrent_id
+		ORDER BY total DESC
+		LIMIT $1;`,
+		MaxTrendingTorrents,
+	)
+	if err != nil {
+		return errors.Wrap(err, "tx.Exec (INSERT INTO trending)")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "tx.Commit")
+	}
+	return nil
+}
+
+func (db *postgresDatabase) GetTrendingTorrents(limit uint) ([]TorrentMetadata, error) {
+	rows, err := db.conn.Query(`
+		SELECT
+			t.id,
+			t.info_hash,
+			t.name,
+			t.total_size,
+			t.discovered_on,
+			t.n_files,
+			t.spam_score,
+			tr.sightings
+		FROM trending tr
+		INNER JOIN torrents t ON t.id = tr.torrent_id
+		WHERE t.moderation <> $1
+		ORDER BY tr.sightings DESC, t.id DESC
+		LIMIT $2;`,
+		Flagged, limit,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "conn.Query (SELECT FROM trending)")
+	}
+	defer db.closeRows(rows)
+
+	torrents := make([]TorrentMetadata, 0)
+	for rows.Next() {
+		var tm TorrentMetadata
+		if err = rows.Scan(&tm.ID, &tm.InfoHash, &tm.Name, &tm.Size, timeScanner{&tm.DiscoveredOn}, &tm.NFiles, &tm.SpamScore,
+			&tm.Sightings); err != nil {
+			return nil, err
+		}
+		torrents = append(torrents, tm)
+	}
+
+	return torrents, rows.Err()
+}
+
+func (db *postgresDatabase) AddCrawlerStats(stats CrawlerStats) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO crawler_stats (hour, n_trawled, n_fetched)
+		VALUES (to_timestamp($1), $2, $3)
+		ON CONFLICT (hour) DO UPDATE SET
+			n_trawled = crawler_stats.n_trawled + EXCLUDED.n_trawled,
+			n_fetched = crawler_stats.n_fetched + EXCLUDED.n_fetched;`,
+		sightingHour(stats.Hour), stats.NTrawled, stats.NFetched,
+	)
+	if err != nil {
+		return errors.Wrap(err, "sql.DB.Exec (INSERT INTO crawler_stats)")
+	}
+	return nil
+}
+
+func (db *postgresDatabase) GetCrawlerStats(from int64) ([]CrawlerStats, error) {
+	if earliest := time.Now().Add(-MaxCrawlerStatsWindow).Unix(); from < earliest {
+		from = earliest
+	}
+	rows, err := db.conn.Query(`
+		SELECT EXTRACT(EPOCH FROM hour)::BIGINT, n_trawled, n_fetched
+		FROM crawler_stats
+		WHERE hour >= to_timestamp($1)
+		ORDER BY hour;`, sightingHour(from))
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query")
+	}
+	defer closeRows(rows)
+
+	stats := make([]CrawlerStats, 0)
+	for rows.Next() {
+		var s CrawlerStats
+		if err = rows.Scan(&s.Hour, &s.NTrawled, &s.NFetched); err != nil {
+			return nil, errors.Wrap(err, "sql.Rows.Scan")
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+func (db *postgresDatabase) AddDiscovery(infoHash []byte, discovery Discovery) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO discoveries (torrent_id, discovered_on, peer_ip, peer_port, peer_country)
+		SELECT id, $1, $2, $3, $4 FROM torrents WHERE info_hash = $5
+		ON CONFLICT (torrent_id) DO NOTHING;`,
+		discovery.On.Truncate(time.Millisecond), discovery.peerIP(), discovery.peerPort(), discovery.country(),
+		infoHash,
+	)
+	return err
+}
+
+func (db *postgresDatabase) SetText(infoHash []byte, text TorrentText) error {
+	if len(text.Content) > MaxTextSize {
+		return fmt.Errorf("the text is larger than %d bytes", MaxTextSize)
+	}
+	_, err := db.conn.Exec("UPDATE torrents SET text_path = $1, text_content = $2 WHERE info_hash = $3;",
+		text.Path, text.Content, infoHash)
+	return err
+}
+
+func (db *postgresDatabase) ClaimFetch(infoHash []byte, claimant string, ttl time.Duration) (bool, error) {
+	claimedOn := now()
+	expiredOn := claimedOn.Add(-ttl)
+	if _, err := db.conn.Exec("DELETE FROM fetch_claims WHERE claimed_on < $1;", expiredOn); err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (DELETE FROM fetch_claims)")
+	}
+	// The claim is taken over only if it is expired (should it be not deleted yet), or if it is of
+	// the same claimant; else nothing is upserted.
+	res, err := db.conn.Exec(`
+		INSERT INTO fetch_claims (info_hash, claimant, claimed_on) VALUES ($1, $2, $3)
+		ON CONFLICT (info_hash) DO UPDATE SET claimant = EXCLUDED.claimant, claimed_on = EXCLUDED.claimed_on
+		WHERE fetch_claims.claimed_on < $4 OR fetch_claims.claimant = EXCLUDED.claimant;`,
+		infoHash, claimant, claimedOn, expiredOn)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (INSERT INTO fetch_claims)")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	}
+	return n == 1, nil
+}
+
+// AcquireSlot acquires the first of the slots whose advisory lock (of the session) it can take, on a
+// connection that is set aside for the slot, so that the lock is released if the connection is lost.
+func (db *postgresDatabase) AcquireSlot(n int) (Slot, error) {
+	if db.conn.tx != nil {
+		return nil, fmt.Errorf("the slots cannot be acquired in a transaction")
+	}
+	conn, err := db.conn.DB.Conn(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Conn")
+	}
+	for i := 0; i < n; i++ {
+		var acquired bool
+		ctx, cancel := db.conn.context()
+		err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, $2);", slotsLockClass, i).
+			Scan(&acquired)
+		cancel()
+		if err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrap(err, "sql.Conn.QueryRow (pg_try_advisory_lock)")
+		} else if acquired {
+			return &postgresSlot{conn: conn, index: i, timedConn: db.conn}, nil
+		}
+	}
+	return nil, conn.Close()
+}
+
+type postgresSlot struct {
+	conn      *sql.Conn
+	index     int
+	timedConn *timedConn
+}
+
+func (s *postgresSlot) Index() int {
+	return s.index
+}
+
+func (s *postgresSlot) Check() error {
+	ctx, cancel := s.timedConn.context()
+	defer cancel()
+	return s.conn.PingContext(ctx)
+}
+
+func (s *postgresSlot) Release() error {
+	var released bool
+	ctx, cancel := s.timedConn.context()
+	err := s.conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1, $2);", slotsLockClass, s.index).
+		Scan(&released)
+	cancel()
+	if err == nil && !released {
+		err = fmt.Errorf("the slot %d is not held", s.index)
+	}
+	if closeErr := s.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (db *postgresDatabase) LogSearch(entry SearchLogEntry) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO search_log (client_hash, query, n_results, latency_ms, searched_on)
+		VALUES ($1, $2, $3, $4, to_timestamp($5));`,
+		entry.ClientHash, entry.Query, entry.NResults, entry.LatencyMs, entry.SearchedOn,
+	)
+	return err
+}
+
+func (db *postgresDatabase) GetSearchAnalytics(since int64, limit uint) (*SearchAnalytics, error) {
+	analytics := new(SearchAnalytics)
+
+	err := db.conn.QueryRow(
+		"SELECT COUNT(*), COUNT(DISTINCT client_hash) FROM search_log WHERE searched_on >= to_timestamp($1);",
+		since,
+	).Scan(&analytics.NSearches, &analytics.NClients)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow (totals)")
+	}
+
+	for _, list := range []struct {
+		having string
+		stats  *[]QueryStats
+	}{
+		{"", &analytics.TopQueries},
+		{"HAVING MAX(n_results) = 0", &analytics.ZeroResultQueries},
+	} {
+		rows, err := db.conn.Query(`
+			SELECT query
+				 , COUNT(*) AS n_searches
+				 , COUNT(DISTINCT client_hash)
+				 , AVG(n_results)::DOUBLE PRECISION
+				 , AVG(latency_ms)::DOUBLE PRECISION
+				 , EXTRACT(EPOCH FROM MAX(searched_on))::BIGINT
+			FROM search_log
+			WHERE searched_on >= to_timestamp($1)
+			GROUP BY query
+			`+list.having+`
+			ORDER BY n_searches DESC, query ASC
+			LIMIT $2;`,
+			since, limit,
+		)
+		if err != nil {
+			return nil, err
+		}
+		*list.stats, err = scanQueryStats(rows)
+		db.closeRows(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return analytics, nil
+}
+
+func (db *postgresDatabase) PurgeSearchLog(before int64) error {
+	_, err := db.conn.Exec("DELETE FROM search_log WHERE searched_on < to_timestamp($1);", before)
+	return err
+}
+
+func (db *postgresDatabase) GetSuggestions(prefix string, limit uint) ([]string, error) {
+	rows, err := db.conn.Query(`
+		SELECT query
+		FROM search_log
+		WHERE query ILIKE $1 ESCAPE '\'
+		GROUP BY query
+		HAVING MAX(n_results) > 0
+		ORDER BY COUNT(*) DESC, query ASC
+		LIMIT $2;`,
+		escapeLike(prefix)+"%", limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	suggestions, err := appendSuggestions(make([]string, 0), rows, limit)
+	db.closeRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if uint(len(suggestions)) >= limit {
+		return suggestions, nil
+	}
+
+	// Uses the pg_trgm GIN index on the (folded) names.
+	rows, err = db.conn.Query(`
+		SELECT name
+		FROM torrents
+		WHERE     `+postgresSearchedName+` ILIKE $1 ESCAPE '\'
+			  AND moderation <> $2
+		ORDER BY length(name) ASC
+		LIMIT $3;`,
+		escapeLike(FoldDiacritics(prefix))+"%", Flagged, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer db.closeRows(rows)
+
+	return appendSuggestions(suggestions, rows, limit)
+}
+
+func (db *postgresDatabase) GetCorrections(query string, limit uint) ([]string, error) {
+	return correctQuery(query, limit, db.correctWord)
+}
+
+// correctWordsSample is the number of the names (that contain a word similar to the word to be
+// corrected) whose words are considered as the corrections.
+const correctWordsSample = 1000
+
+// correctWordsThreshold is the pg_trgm.word_similarity_threshold of the names to be sampled.
+const correctWordsThreshold = 0.3
+
+// correctWord returns the correction of the word if it does not appear in any of the torrent
+// names, or an empty string if it does or if there are no words close enough to it.
+func (db *postgresDatabase) correctWord(word string) (string, error) {
+	if maxEditDistance(word) == 0 {
+		return "", nil
+	}
+	word = FoldDiacritics(word)
+
+	var exists bool
+	err := db.conn.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1
+			FROM torrents
+			WHERE to_tsvector('simple', `+postgresSearchedDocument+`) @@ plainto_tsquery('simple', $1)
+		);`,
+		word,
+	).Scan(&exists)
+	if err != nil {
+		return "", errors.Wrap(err, "sql.DB.QueryRow (exists)")
+	} else if exists {
+		return "", nil
+	}
+
+	// There is no vocabulary of the names in Postgres, so the words of (a sample of) the names that
+	// contain a word similar to the word are considered instead, which uses the pg_trgm GIN index on
+	// the (folded) names, see:
+	//   https://www.postgresql.org/docs/current/pgtrgm.html#id-1.11.7.40.8
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return "", errors.Wrap(err, "sql.DB.Begin")
+	}
+	// The transaction is read-only, so it is always rolled back.
+	defer tx.Rollback()
+
+	// The default threshold (0.6) is too high for the misspellings, which share few trigrams with
+	// their corrections (e.g. "moveis" and "movies" share 3 out of 7).
+	if _, err = tx.Exec(fmt.Sprintf("SET LOCAL pg_trgm.word_similarity_threshold = %g;", correctWordsThreshold)); err != nil {
+		return "", errors.Wrap(err, "sql.Tx.Exec (word_similarity_threshold)")
+	}
+
+	n := utf8.RuneCountInString(word)
+	rows, err := tx.Query(`
+		SELECT term, COUNT(*)
+		FROM (
+			SELECT `+postgresSearchedName+` AS name
+			FROM torrents
+			WHERE     $1 <% `+postgresSearchedName+`
+				  AND moderation <> $2
+			LIMIT $3
+		) AS similar_torrents, regexp_split_to_table(lower(similar_torrents.name), '[^[:alnum:]]+') AS term
+		WHERE length(term) BETWEEN $4 AND $5
+		GROUP BY term;`,
+		word, Flagged, correctWordsSample, n-maxEditDistance(word), n+maxEditDistance(word),
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "sql.Tx.Query (word_similarity)")
+	}
+	defer db.closeRows(rows)
+
+	candidates := make([]termFrequency, 0)
+	for rows.Next() {
+		var candidate termFrequency
+		if err = rows.Scan(&candidate.term, &candidate.frequency); err != nil {
+			return "", err
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
+	correction, _ := closestTerm(word, candidates)
+	return correction, nil
+}
+
+func (db *postgresDatabase) setupDatabase() error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "sql.DB.Begin")
+	}
+
+	defer tx.Rollback()
+
+	// The instances that share the database (e.g. the crawlers in several datacenters) set it up one
+	// at a time, lest they migrate it concurrently: the advisory lock is held until the end of the
+	// transaction, after which the others find it migrated already.
+	if _, err = tx.Exec("SELECT pg_advisory_xact_lock($1, $2);", advisoryLockClass, migrationsLockID); err != nil {
+		return errors.Wrap(err, "sql.Tx.Exec (pg_advisory_xact_lock)")
+	}
 
 	rows, err := db.conn.Query("SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm';")
 	if err != nil {
@@ -493,16 +2159,554 @@ func (db *postgresDatabase) setupDatabase() error {
 	// https://stackoverflow.com/questions/36295883/golang-postgres-commit-unknown-command-error/36866993#36866993
 	db.closeRows(rows)
 
-	// Uncomment for future migrations:
-	//switch schemaVersion {
-	//case 0: // FROZEN.
-	//	zap.L().Warn("Updating (fake) database schema from 0 to 1...")
-	//	_, err = tx.Exec(`INSERT INTO migrations (schema_version) VALUES (1);`)
-	//	if err != nil {
-	//		return errors.Wrap(err, "sql.Tx.Exec (v0 -> v1)")
-	//	}
-	//	//fallthrough
-	//}
+	switch schemaVersion {
+	case 0: // NOT FROZEN! (subject to change complying with our versioning policy)
+		// Changes:
+		//   * Added `spam_score` column to the `torrents` table.
+		zap.L().Named("persistence").Warn("Updating database schema from 0 to 1... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN spam_score REAL NOT NULL DEFAULT 0
+				CHECK (spam_score >= 0 AND spam_score <= 1);
+
+			CREATE INDEX IF NOT EXISTS idx_torrents_spam_score ON torrents (spam_score);
+
+			INSERT INTO migrations (schema_version) VALUES (1);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v0 -> v1)")
+		}
+		fallthrough
+
+	case 1:
+		// Changes:
+		//   * Added `moderation` column to the `torrents` table.
+		//   * Added `reports` table to keep the reports of the users until they are moderated.
+		zap.L().Named("persistence").Warn("Updating database schema from 1 to 2... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN moderation SMALLINT NOT NULL DEFAULT 0;
+
+			CREATE INDEX IF NOT EXISTS idx_torrents_moderation ON torrents (moderation);
+
+			CREATE SEQUENCE IF NOT EXISTS seq_reports_id;
+
+			CREATE TABLE IF NOT EXISTS reports (
+				id           INTEGER PRIMARY KEY DEFAULT nextval('seq_reports_id'),
+				torrent_id   INTEGER NOT NULL REFERENCES torrents ON DELETE CASCADE ON UPDATE RESTRICT,
+				reason       TEXT NOT NULL,
+				reported_on  TIMESTAMP WITH TIME ZONE NOT NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_reports_torrent_id ON reports (torrent_id);
+
+			INSERT INTO migrations (schema_version) VALUES (2);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v1 -> v2)")
+		}
+		fallthrough
+
+	case 2:
+		// Changes:
+		//   * Added `search_log` table for the search analytics.
+		zap.L().Named("persistence").Warn("Updating database schema from 2 to 3... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE SEQUENCE IF NOT EXISTS seq_search_log_id;
+
+			CREATE TABLE IF NOT EXISTS search_log (
+				id           BIGINT PRIMARY KEY DEFAULT nextval('seq_search_log_id'),
+				client_hash  bytea NOT NULL,
+				query        TEXT NOT NULL,
+				n_results    INTEGER NOT NULL,
+				latency_ms   REAL NOT NULL,
+				searched_on  TIMESTAMP WITH TIME ZONE NOT NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_search_log_searched_on ON search_log (searched_on);
+
+			INSERT INTO migrations (schema_version) VALUES (3);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v2 -> v3)")
+		}
+		fallthrough
+
+	case 3:
+		// Changes:
+		//   * Added `category` column to the `torrents` table for the statistics dashboard.
+		zap.L().Named("persistence").Warn("Updating database schema from 3 to 4... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN category TEXT NOT NULL DEFAULT '';
+
+			INSERT INTO migrations (schema_version) VALUES (4);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v3 -> v4)")
+		}
+		fallthrough
+
+	case 4:
+		// Changes:
+		//   * Added `source` column to the `torrents` table for the source attribution.
+		zap.L().Named("persistence").Warn("Updating database schema from 4 to 5... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN source TEXT NOT NULL DEFAULT '';
+
+			INSERT INTO migrations (schema_version) VALUES (5);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v4 -> v5)")
+		}
+		fallthrough
+
+	case 5:
+		// Changes:
+		//   * Added `n_files` column to the `torrents` table, so that the files of the torrents are
+		//     not counted for every search result (and can be ordered by using an index).
+		zap.L().Named("persistence").Warn("Updating database schema from 5 to 6... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN n_files INTEGER NOT NULL DEFAULT 0;
+			UPDATE torrents SET n_files = f.n_files
+				FROM (SELECT torrent_id, COUNT(*) AS n_files FROM files GROUP BY torrent_id) AS f
+				WHERE torrents.id = f.torrent_id;
+			CREATE INDEX IF NOT EXISTS idx_torrents_n_files ON torrents (n_files);
+
+			INSERT INTO migrations (schema_version) VALUES (6);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v5 -> v6)")
+		}
+		fallthrough
+
+	case 6:
+		// Changes:
+		//   * Added a GIN index on the words of the names of the torrents, so that the torrents can
+		//     be ordered by relevance.
+		zap.L().Named("persistence").Warn("Updating database schema from 6 to 7... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE INDEX IF NOT EXISTS idx_torrents_name_gin_tsvector ON torrents
+				USING GIN (to_tsvector('simple', name));
+
+			INSERT INTO migrations (schema_version) VALUES (7);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v6 -> v7)")
+		}
+		fallthrough
+
+	case 7:
+		// Changes:
+		//   * Added `requests` table for the requests of the users for the torrents to be looked
+		//     up by the crawler.
+		zap.L().Named("persistence").Warn("Updating database schema from 7 to 8... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE IF NOT EXISTS requests (
+				info_hash          bytea PRIMARY KEY,
+				status             TEXT NOT NULL,
+				attempts           INTEGER NOT NULL DEFAULT 0,
+				requested_on       TIMESTAMP WITH TIME ZONE NOT NULL,
+				last_attempted_on  TIMESTAMP WITH TIME ZONE
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_requests_status ON requests (status, last_attempted_on);
+
+			INSERT INTO migrations (schema_version) VALUES (8);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v7 -> v8)")
+		}
+		fallthrough
+
+	case 8:
+		// Changes:
+		//   * Added `recent_torrents` table, the ring buffer of the most recently discovered
+		//     torrents (see MaxRecentTorrents), seeded with the most recent ones in `torrents`.
+		zap.L().Named("persistence").Warn("Updating database schema from 8 to 9... (this might take a while)")
+		_, err = tx.Exec(executeTemplate(`
+			CREATE TABLE IF NOT EXISTS recent_torrents (
+				slot           INTEGER PRIMARY KEY,
+				torrent_id     INTEGER NOT NULL,
+				info_hash      bytea NOT NULL,
+				name           TEXT NOT NULL,
+				total_size     BIGINT NOT NULL,
+				discovered_on  TIMESTAMP WITH TIME ZONE NOT NULL,
+				n_files        INTEGER NOT NULL,
+				spam_score     REAL NOT NULL
+			);
+
+			INSERT INTO recent_torrents
+			SELECT id % {{.Capacity}}, id, info_hash, name, total_size, discovered_on, n_files, spam_score
+			FROM torrents
+			WHERE moderation <> {{.Flagged}}
+			ORDER BY id DESC
+			LIMIT {{.Capacity}}
+			ON CONFLICT (slot) DO NOTHING;
+
+			INSERT INTO migrations (schema_version) VALUES (9);
+		`, struct {
+			Capacity int
+			Flagged  uint8
+		}{MaxRecentTorrents, uint8(Flagged)}, nil))
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v8 -> v9)")
+		}
+		fallthrough
+
+	case 9:
+		// Changes:
+		//   * Added `sightings` table for the number of the times that the torrents are seen on the
+		//     DHT by the hour, and `trending` table for the torrents that are sighted the most.
+		zap.L().Named("persistence").Warn("Updating database schema from 9 to 10... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE IF NOT EXISTS sightings (
+				torrent_id  INTEGER NOT NULL REFERENCES torrents ON DELETE CASCADE ON UPDATE RESTRICT,
+				hour        TIMESTAMP WITH TIME ZONE NOT NULL,
+				count       BIGINT NOT NULL,
+
+				PRIMARY KEY (torrent_id, hour)
+			);
+			CREATE INDEX IF NOT EXISTS idx_sightings_hour ON sightings (hour);
+
+			CREATE TABLE IF NOT EXISTS trending (
+				torrent_id  INTEGER PRIMARY KEY REFERENCES torrents ON DELETE CASCADE ON UPDATE RESTRICT,
+				sightings   BIGINT NOT NULL
+			);
+
+			INSERT INTO migrations (schema_version) VALUES (10);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v9 -> v10)")
+		}
+		fallthrough
+
+	case 10:
+		// Changes:
+		//   * Truncated the times to the precision of seconds (as SQLite stores them), as the
+		//     searches are paginated by the Unix times of the torrents.
+		zap.L().Named("persistence").Warn("Updating database schema from 10 to 11... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents
+				ALTER COLUMN discovered_on TYPE TIMESTAMP(0) WITH TIME ZONE USING date_trunc('second', discovered_on);
+			ALTER TABLE recent_torrents
+				ALTER COLUMN discovered_on TYPE TIMESTAMP(0) WITH TIME ZONE USING date_trunc('second', discovered_on);
+			ALTER TABLE reports
+				ALTER COLUMN reported_on TYPE TIMESTAMP(0) WITH TIME ZONE USING date_trunc('second', reported_on);
+			ALTER TABLE search_log
+				ALTER COLUMN searched_on TYPE TIMESTAMP(0) WITH TIME ZONE USING date_trunc('second', searched_on);
+			ALTER TABLE requests
+				ALTER COLUMN requested_on TYPE TIMESTAMP(0) WITH TIME ZONE USING date_trunc('second', requested_on),
+				ALTER COLUMN last_attempted_on TYPE TIMESTAMP(0) WITH TIME ZONE USING date_trunc('second', last_attempted_on);
+
+			INSERT INTO migrations (schema_version) VALUES (11);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v10 -> v11)")
+		}
+		fallthrough
+
+	case 11:
+		// Changes:
+		//   * Added `discoveries` table for the precise times of the discoveries of the torrents,
+		//     and the (anonymised) peers that announced them, if opted in (see Discovery).
+		zap.L().Named("persistence").Warn("Updating database schema from 11 to 12... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE discoveries (
+				torrent_id     INTEGER PRIMARY KEY REFERENCES torrents ON DELETE CASCADE ON UPDATE RESTRICT,
+				discovered_on  TIMESTAMP(3) WITH TIME ZONE NOT NULL,
+				peer_ip        INET,
+				peer_port      INTEGER
+			);
+
+			INSERT INTO migrations (schema_version) VALUES (12);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v11 -> v12)")
+		}
+		fallthrough
+
+	case 12:
+		// Changes:
+		//   * Partitioned `torrents` and `files` by the months of the discoveries of the torrents
+		//     (see partitions), hence added `discovered_on` column to the `files` table too.
+		//   * Dropped the uniqueness of `info_hash` and the foreign keys that refer to `torrents`, as
+		//     neither can be enforced across the partitions without `discovered_on`.
+		zap.L().Named("persistence").Warn("Updating database schema from 12 to 13... (this might take a while)")
+		if err = db.partitionTorrents(tx); err != nil {
+			return errors.Wrap(err, "partitionTorrents (v12 -> v13)")
+		}
+		fallthrough
+
+	case 13:
+		// Changes:
+		//   * Added `folded_name` column to the `torrents` table for the names without their
+		//     diacritics (see foldedName), and indexed the folded names instead of the names, so
+		//     that the searches are accent-insensitive.
+		zap.L().Named("persistence").Warn("Updating database schema from 13 to 14... (this might take a while)")
+		if _, err = tx.Exec("ALTER TABLE torrents ADD COLUMN folded_name TEXT;"); err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v13 -> v14)")
+		}
+		if err = fillNames(tx, postgresDialect, "folded_name", foldedName); err != nil {
+			return errors.Wrap(err, "fillNames (v13 -> v14)")
+		}
+		_, err = tx.Exec(`
+			DROP INDEX idx_torrents_name_gin_trgm, idx_torrents_name_gin_tsvector;
+			CREATE INDEX idx_torrents_name_gin_trgm ON torrents
+				USING GIN ((` + postgresSearchedName + `) gin_trgm_ops);
+			CREATE INDEX idx_torrents_name_gin_tsvector ON torrents
+				USING GIN (to_tsvector('simple', ` + postgresSearchedName + `));
+
+			INSERT INTO migrations (schema_version) VALUES (14);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v13 -> v14)")
+		}
+		fallthrough
+
+	case 14:
+		// Changes:
+		//   * Added `cjk_bigrams` column to the `torrents` table for the bigrams of the CJK names
+		//     (see cjkBigrams), and indexed them along with the (folded) names.
+		zap.L().Named("persistence").Warn("Updating database schema from 14 to 15... (this might take a while)")
+		if _, err = tx.Exec("ALTER TABLE torrents ADD COLUMN cjk_bigrams TEXT;"); err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v14 -> v15)")
+		}
+		if err = fillNames(tx, postgresDialect, "cjk_bigrams", cjkBigrams); err != nil {
+			return errors.Wrap(err, "fillNames (v14 -> v15)")
+		}
+		_, err = tx.Exec(`
+			DROP INDEX idx_torrents_name_gin_tsvector;
+			CREATE INDEX idx_torrents_name_gin_tsvector ON torrents
+				USING GIN (to_tsvector('simple', COALESCE(folded_name, name) || ' ' || COALESCE(cjk_bigrams, '')));
+
+			INSERT INTO migrations (schema_version) VALUES (15);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v14 -> v15)")
+		}
+		fallthrough
+
+	case 15:
+		// Changes:
+		//   * Added `synonyms` column to the `torrents` table for the canonical terms of the names
+		//     (see synonyms), and indexed them along with the (folded) names.
+		zap.L().Named("persistence").Warn("Updating database schema from 15 to 16... (this might take a while)")
+		if _, err = tx.Exec("ALTER TABLE torrents ADD COLUMN synonyms TEXT;"); err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v15 -> v16)")
+		}
+		if _, err = refreshSynonyms(tx, postgresDialect, db.synonyms); err != nil {
+			return errors.Wrap(err, "refreshSynonyms (v15 -> v16)")
+		}
+		_, err = tx.Exec(`
+			DROP INDEX idx_torrents_name_gin_tsvector;
+			CREATE INDEX idx_torrents_name_gin_tsvector ON torrents
+				USING GIN (to_tsvector('simple', COALESCE(folded_name, name) || ' ' || COALESCE(cjk_bigrams, '') || ' ' || COALESCE(synonyms, '')));
+
+			INSERT INTO migrations (schema_version) VALUES (16);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v15 -> v16)")
+		}
+		fallthrough
+
+	case 16:
+		// Changes:
+		//   * Added `release_*` columns to the `torrents` table for the releases of the names (see
+		//     ParseRelease).
+		zap.L().Named("persistence").Warn("Updating database schema from 16 to 17... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents
+				ADD COLUMN release_title      TEXT,
+				ADD COLUMN release_year       INTEGER,
+				ADD COLUMN release_season     INTEGER,
+				ADD COLUMN release_episode    INTEGER,
+				ADD COLUMN release_resolution TEXT,
+				ADD COLUMN release_codec      TEXT,
+				ADD COLUMN release_group      TEXT;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v16 -> v17)")
+		}
+		if err = fillReleases(tx, postgresDialect); err != nil {
+			return errors.Wrap(err, "fillReleases (v16 -> v17)")
+		}
+		if _, err = tx.Exec("INSERT INTO migrations (schema_version) VALUES (17);"); err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v16 -> v17)")
+		}
+		fallthrough
+
+	case 17:
+		// Changes:
+		//   * Added `album_*` columns to the `torrents` table for the albums of the audio torrents
+		//     (see ParseAlbum).
+		zap.L().Named("persistence").Warn("Updating database schema from 17 to 18... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents
+				ADD COLUMN album_artist   TEXT,
+				ADD COLUMN album_title    TEXT,
+				ADD COLUMN album_n_tracks INTEGER;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v17 -> v18)")
+		}
+		if err = fillAlbums(tx, postgresDialect); err != nil {
+			return errors.Wrap(err, "fillAlbums (v17 -> v18)")
+		}
+		if _, err = tx.Exec("INSERT INTO migrations (schema_version) VALUES (18);"); err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v17 -> v18)")
+		}
+		fallthrough
+
+	case 18:
+		// Changes:
+		//   * Added `text_path` and `text_content` columns to the `torrents` table for the texts of
+		//     the torrents (see TorrentText), and indexed them along with the names.
+		zap.L().Named("persistence").Warn("Updating database schema from 18 to 19... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents
+				ADD COLUMN text_path    TEXT,
+				ADD COLUMN text_content TEXT;
+
+			DROP INDEX idx_torrents_name_gin_tsvector;
+			CREATE INDEX idx_torrents_name_gin_tsvector ON torrents
+				USING GIN (to_tsvector('simple', ` + postgresSearchedDocument + `));
+
+			INSERT INTO migrations (schema_version) VALUES (19);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v18 -> v19)")
+		}
+		fallthrough
+
+	case 19:
+		// Changes:
+		//   * Added `fetch_claims` table for the claims of the fetches of the torrents by the
+		//     crawlers that share the database (see Database.ClaimFetch).
+		zap.L().Named("persistence").Warn("Updating database schema from 19 to 20... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE fetch_claims (
+				info_hash   bytea PRIMARY KEY,
+				claimant    TEXT NOT NULL,
+				claimed_on  TIMESTAMP WITH TIME ZONE NOT NULL
+			);
+			CREATE INDEX idx_fetch_claims_claimed_on ON fetch_claims (claimed_on);
+
+			INSERT INTO migrations (schema_version) VALUES (20);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v19 -> v20)")
+		}
+		fallthrough
+
+	case 20:
+		// Changes:
+		//   * Added `crawler_stats` table for the hourly statistics of the crawlers (see
+		//     Database.AddCrawlerStats).
+		zap.L().Named("persistence").Warn("Updating database schema from 20 to 21... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE crawler_stats (
+				hour       TIMESTAMP WITH TIME ZONE PRIMARY KEY,
+				n_trawled  BIGINT NOT NULL,
+				n_fetched  BIGINT NOT NULL
+			);
+
+			INSERT INTO migrations (schema_version) VALUES (21);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v20 -> v21)")
+		}
+		fallthrough
+
+	case 21:
+		// Changes:
+		//   * Added `peer_country` column to `discoveries` for the countries of the peers (see
+		//     Discovery.Country).
+		zap.L().Named("persistence").Warn("Updating database schema from 21 to 22... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE discoveries ADD COLUMN peer_country TEXT;
+
+			INSERT INTO migrations (schema_version) VALUES (22);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v21 -> v22)")
+		}
+		fallthrough
+
+	case 22:
+		// Changes:
+		//   * Added `favorites` table for the torrents that the users have bookmarked (see
+		//     Database.AddFavorite), without a foreign key as the torrents are partitioned (see v13).
+		zap.L().Named("persistence").Warn("Updating database schema from 22 to 23... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE favorites (
+				username      TEXT NOT NULL,
+				torrent_id    INTEGER NOT NULL,
+				favorited_on  TIMESTAMP WITH TIME ZONE NOT NULL,
+				PRIMARY KEY (username, torrent_id)
+			);
+			CREATE INDEX idx_favorites_username_favorited_on ON favorites (username, favorited_on);
+
+			INSERT INTO migrations (schema_version) VALUES (23);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v22 -> v23)")
+		}
+		fallthrough
+
+	case 23:
+		// Changes:
+		//   * Added `interactions` table for the daily numbers of the interactions of the users with
+		//     the torrents (see Database.AddInteraction), and `popularity` column to the `torrents`
+		//     table for their totals, so that the torrents can be ordered by it.
+		zap.L().Named("persistence").Warn("Updating database schema from 23 to 24... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN popularity BIGINT NOT NULL DEFAULT 0;
+			CREATE INDEX idx_torrents_popularity ON torrents (popularity);
+
+			CREATE TABLE interactions (
+				torrent_id   INTEGER NOT NULL,
+				day          TIMESTAMP WITH TIME ZONE NOT NULL,
+				n_magnets    BIGINT NOT NULL DEFAULT 0,
+				n_downloads  BIGINT NOT NULL DEFAULT 0,
+				PRIMARY KEY (torrent_id, day)
+			);
+
+			INSERT INTO migrations (schema_version) VALUES (24);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v23 -> v24)")
+		}
+		fallthrough
+
+	case 24:
+		// Changes:
+		//   * Added `api_keys` table for the keys to the API that the operators issue (see
+		//     Database.AddAPIKey), and `api_key_usage` table for their daily usages.
+		zap.L().Named("persistence").Warn("Updating database schema from 24 to 25... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE SEQUENCE seq_api_keys_id;
+			CREATE TABLE api_keys (
+				id                   INTEGER PRIMARY KEY DEFAULT nextval('seq_api_keys_id'),
+				name                 TEXT NOT NULL,
+				key_hash             bytea NOT NULL UNIQUE,
+				requests_per_minute  BIGINT NOT NULL,
+				rows_per_day         BIGINT NOT NULL,
+				created_on           TIMESTAMP WITH TIME ZONE NOT NULL,
+				revoked_on           TIMESTAMP WITH TIME ZONE
+			);
+
+			CREATE TABLE api_key_usage (
+				api_key_id  INTEGER NOT NULL REFERENCES api_keys ON DELETE CASCADE ON UPDATE RESTRICT,
+				day         TIMESTAMP WITH TIME ZONE NOT NULL,
+				n_requests  BIGINT NOT NULL DEFAULT 0,
+				n_rows      BIGINT NOT NULL DEFAULT 0,
+				PRIMARY KEY (api_key_id, day)
+			);
+
+			INSERT INTO migrations (schema_version) VALUES (25);
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v24 -> v25)")
+		}
+	}
 
 	if err = tx.Commit(); err != nil {
 		return errors.Wrap(err, "sql.Tx.Commit")
@@ -511,8 +2715,82 @@ func (db *postgresDatabase) setupDatabase() error {
 	return nil
 }
 
-func (db *postgresDatabase) closeRows(rows *sql.Rows) {
+// partitionTorrents replaces the `torrents` and `files` tables with the partitioned ones (see
+// partitions), into which their rows are copied.
+func (db *postgresDatabase) partitionTorrents(tx *timedTx) error {
+	// The names of the indices (including the ones of the constraints) are unique in a schema, hence
+	// the ones of the old tables are renamed or dropped before the new tables are created.
+	_, err := tx.Exec(`
+		ALTER TABLE torrents RENAME TO torrents_unpartitioned;
+		ALTER TABLE files RENAME TO files_unpartitioned;
+		ALTER INDEX torrents_pkey RENAME TO torrents_unpartitioned_pkey;
+		ALTER INDEX files_pkey RENAME TO files_unpartitioned_pkey;
+		DROP INDEX idx_torrents_total_size, idx_torrents_discovered_on, idx_torrents_name_gin_trgm,
+			idx_torrents_spam_score, idx_torrents_moderation, idx_torrents_n_files,
+			idx_torrents_name_gin_tsvector, idx_files_torrent_id;
+
+		CREATE TABLE torrents (
+			LIKE torrents_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS,
+			PRIMARY KEY (id, discovered_on)
+		) PARTITION BY RANGE (discovered_on);
+
+		CREATE TABLE files (
+			LIKE files_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS,
+			discovered_on  TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+			PRIMARY KEY (id, discovered_on)
+		) PARTITION BY RANGE (discovered_on);
+	`)
+	if err != nil {
+		return errors.Wrap(err, "sql.Tx.Exec (CREATE TABLE)")
+	}
+
+	var oldest sql.NullTime
+	if err = tx.QueryRow("SELECT MIN(discovered_on) FROM torrents_unpartitioned;").Scan(&oldest); err != nil {
+		return errors.Wrap(err, "sql.Tx.QueryRow (MIN(discovered_on))")
+	}
+	until := monthOf(time.Now()).AddDate(0, 1, 0)
+	month := until
+	if oldest.Valid {
+		month = monthOf(oldest.Time)
+	}
+	for ; !month.After(until); month = month.AddDate(0, 1, 0) {
+		if err = createPartitions(tx, month); err != nil {
+			return err
+		}
+	}
+
+	// The indices are created after the rows are copied, as it is faster than updating them for
+	// every row. The foreign keys that refer to the old `torrents` are dropped along with it.
+	_, err = tx.Exec(`
+		INSERT INTO torrents SELECT * FROM torrents_unpartitioned;
+		INSERT INTO files
+			SELECT f.*, t.discovered_on
+			FROM files_unpartitioned AS f
+			INNER JOIN torrents_unpartitioned AS t ON t.id = f.torrent_id;
+
+		DROP TABLE files_unpartitioned;
+		DROP TABLE torrents_unpartitioned CASCADE;
+
+		CREATE INDEX idx_torrents_info_hash ON torrents (info_hash);
+		CREATE INDEX idx_torrents_total_size ON torrents (total_size);
+		CREATE INDEX idx_torrents_discovered_on ON torrents (discovered_on);
+		CREATE INDEX idx_torrents_name_gin_trgm ON torrents USING GIN (name gin_trgm_ops);
+		CREATE INDEX idx_torrents_spam_score ON torrents (spam_score);
+		CREATE INDEX idx_torrents_moderation ON torrents (moderation);
+		CREATE INDEX idx_torrents_n_files ON torrents (n_files);
+		CREATE INDEX idx_torrents_name_gin_tsvector ON torrents USING GIN (to_tsvector('simple', name));
+		CREATE INDEX idx_files_torrent_id ON files (torrent_id);
+
+		INSERT INTO migrations (schema_version) VALUES (13);
+	`)
+	if err != nil {
+		return errors.Wrap(err, "sql.Tx.Exec (INSERT INTO torrents)")
+	}
+	return nil
+}
+
+func (db *postgresDatabase) closeRows(rows *timedRows) {
 	if err := rows.Close(); err != nil {
-		zap.L().Error("could not close row", zap.Error(err))
+		zap.L().Named("persistence").Error("could not close row", zap.Error(err))
 	}
 }
@@ -0,0 +1,270 @@
+package persistence
+
+import (
+	"fmt"
+	"strings"
+)
+
+// identifier is the name of a column (optionally qualified by its table or by the alias of a
+// subquery), which is written into the queries only if it is whitelisted (see identifiers).
+type identifier string
+
+// identifiers are all the identifiers that can be written into the queries that are built by
+// queryBuilder.
+var identifiers = map[identifier]bool{
+	"torrents":      true,
+	"id":            true,
+	"torrents.id":   true,
+	"info_hash":     true,
+	"name":          true,
+	"total_size":    true,
+	"discovered_on": true,
+	"modified_on":   true,
+	"n_files":       true,
+	"spam_score":    true,
+	"popularity":    true,
+	"moderation":    true,
+	"category":      true,
+
+	"release_year":       true,
+	"release_season":     true,
+	"release_episode":    true,
+	"release_resolution": true,
+	"release_codec":      true,
+	"album_artist":       true,
+	"album_title":        true,
+	"idx.rank":           true,
+	"idx.text":           true,
+	"idx.recency":        true,
+	"idx.size":           true,
+	"idx.spam":           true,
+}
+
+// orderColumns are the columns that the torrents are ordered by, by the criteria.
+var orderColumns = map[OrderingCriteria]identifier{
+	ByRelevance:    "idx.rank",
+	ByTotalSize:    "total_size",
+	ByDiscoveredOn: "discovered_on",
+	ByNFiles:       "n_files",
+	BySpamScore:    "spam_score",
+	ByPopularity:   "popularity",
+}
+
+// orderColumn returns the column that the torrents are ordered by, or an error if they cannot be
+// ordered by the criteria (e.g. by the number of seeders, which are not tracked).
+func orderColumn(orderBy OrderingCriteria) (identifier, error) {
+	column, ok := orderColumns[orderBy]
+	if !ok {
+		return "", fmt.Errorf("torrents cannot be ordered by %d", orderBy)
+	}
+	return column, nil
+}
+
+// comparison is a comparison operator.
+type comparison uint8
+
+const (
+	equal comparison = iota
+	notEqual
+	less
+	lessOrEqual
+	greater
+	greaterOrEqual
+)
+
+var comparisonOperators = map[comparison]string{
+	equal:          "=",
+	notEqual:       "<>",
+	less:           "<",
+	lessOrEqual:    "<=",
+	greater:        ">",
+	greaterOrEqual: ">=",
+}
+
+// queryBuilder builds a SELECT query out of typed parts: the identifiers are whitelisted, the
+// operators and the directions are typed, and the values are always bound as arguments, so that
+// no input is ever written into the query. The fragments of the query (of the select list, of the
+// joins, and of the conditions) are to be constants of the code, into which the values are bound
+// using arg.
+//
+// The first error (e.g. of an identifier that is not whitelisted) is returned by build.
+type queryBuilder struct {
+	dialect *dialect
+	args    []interface{}
+
+	columns []string
+	from    identifier
+	joins   []string
+	where   []string
+	orderBy []string
+	limit   string
+	err     error
+}
+
+func newQueryBuilder(d *dialect, from identifier) *queryBuilder {
+	return &queryBuilder{dialect: d, from: from}
+}
+
+// arg binds the value as an argument of the query, and returns its placeholder.
+func (q *queryBuilder) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return q.dialect.placeholder(len(q.args))
+}
+
+// ident returns the identifier if it is whitelisted, else records an error.
+func (q *queryBuilder) ident(id identifier) string {
+	if !identifiers[id] && q.err == nil {
+		q.err = fmt.Errorf("identifier `%s` is not whitelisted", id)
+	}
+	return string(id)
+}
+
+// selectColumns adds the columns to the select list.
+func (q *queryBuilder) selectColumns(columns ...identifier) {
+	for _, column := range columns {
+		q.columns = append(q.columns, q.ident(column))
+	}
+}
+
+// selectColumnList adds the comma-separated list of the columns (see queryColumns) to the select
+// list.
+func (q *queryBuilder) selectColumnList(columns string) {
+	for _, column := range strings.Split(columns, ", ") {
+		q.selectColumns(identifier(column))
+	}
+}
+
+// selectExprs adds the expressions (along with their aliases) to the select list.
+func (q *queryBuilder) selectExprs(exprs ...string) {
+	q.columns = append(q.columns, exprs...)
+}
+
+func (q *queryBuilder) join(fragment string) {
+	q.joins = append(q.joins, fragment)
+}
+
+// whereFragment adds a condition to the WHERE clause (joined by AND).
+func (q *queryBuilder) whereFragment(fragment string) {
+	q.where = append(q.where, fragment)
+}
+
+// compare adds the condition that the column compares to the value by the operator.
+func (q *queryBuilder) compare(column identifier, op comparison, value interface{}) {
+	q.whereFragment(fmt.Sprintf("%s %s %s", q.ident(column), q.operator(op), q.arg(value)))
+}
+
+// compareRow adds the condition that the row of the columns compares to the row of the values by
+// the operator (as the cursors of the pages are compared).
+func (q *queryBuilder) compareRow(columns []identifier, op comparison, values ...interface{}) {
+	if len(columns) != len(values) && q.err == nil {
+		q.err = fmt.Errorf("%d columns are compared to %d values", len(columns), len(values))
+		return
+	}
+
+	lhs, rhs := make([]string, len(columns)), make([]string, len(values))
+	for i := range columns {
+		lhs[i], rhs[i] = q.ident(columns[i]), q.arg(values[i])
+	}
+	q.whereFragment(fmt.Sprintf("(%s) %s (%s)", strings.Join(lhs, ", "), q.operator(op),
+		strings.Join(rhs, ", ")))
+}
+
+func (q *queryBuilder) operator(op comparison) string {
+	operator, ok := comparisonOperators[op]
+	if !ok && q.err == nil {
+		q.err = fmt.Errorf("unknown comparison: %d", op)
+	}
+	return operator
+}
+
+// filter adds the conditions of the filters.
+func (q *queryBuilder) filter(filters QueryFilters) {
+	if filters.MaxSpamScore != nil {
+		q.compare("spam_score", lessOrEqual, *filters.MaxSpamScore)
+	}
+	if filters.DiscoveredSince != nil {
+		q.compare("discovered_on", greaterOrEqual, q.dialect.unixTime(*filters.DiscoveredSince))
+	}
+	if filters.DiscoveredUntil != nil {
+		q.compare("discovered_on", less, q.dialect.unixTime(*filters.DiscoveredUntil))
+	}
+	for _, refinement := range filters.Refinements {
+		q.whereFragment(q.dialect.match(q, refinement, false))
+	}
+	if filters.PathContains != "" {
+		q.whereFragment(q.dialect.pathMatches(q, "%"+escapeLike(filters.PathContains)+"%"))
+	}
+	if filters.Resolution != "" {
+		q.compare("release_resolution", equal, canonicalResolution(filters.Resolution))
+	}
+	if filters.Codec != "" {
+		q.compare("release_codec", equal, canonicalCodec(filters.Codec))
+	}
+	if filters.ReleaseGroup != "" {
+		q.whereFragment("LOWER(release_group) = " + q.arg(strings.ToLower(filters.ReleaseGroup)))
+	}
+	if filters.Year != nil {
+		q.compare("release_year", equal, *filters.Year)
+	}
+	if filters.Season != nil {
+		q.compare("release_season", equal, *filters.Season)
+	}
+	if filters.Episode != nil {
+		q.compare("release_episode", equal, *filters.Episode)
+	}
+	if filters.Artist != "" {
+		q.whereFragment("LOWER(album_artist) = " + q.arg(strings.ToLower(filters.Artist)))
+	}
+	if filters.Album != "" {
+		q.whereFragment("LOWER(album_title) = " + q.arg(strings.ToLower(filters.Album)))
+	}
+	if filters.OnlyVerified {
+		q.compare("moderation", equal, uint8(Verified))
+	} else if !filters.IncludeFlagged {
+		q.compare("moderation", notEqual, uint8(Flagged))
+	}
+}
+
+// orderByColumn orders the rows by the column, in ascending order if ascending is true, else in
+// descending order.
+func (q *queryBuilder) orderByColumn(column identifier, ascending bool) {
+	direction := "DESC"
+	if ascending {
+		direction = "ASC"
+	}
+	q.orderBy = append(q.orderBy, q.ident(column)+" "+direction)
+}
+
+func (q *queryBuilder) limitTo(n uint) {
+	q.limit = q.arg(n)
+}
+
+// build returns the query and its arguments, or the first error that is recorded.
+func (q *queryBuilder) build() (string, []interface{}, error) {
+	from := q.ident(q.from)
+	if q.err != nil {
+		return "", nil, q.err
+	}
+	if len(q.columns) == 0 {
+		return "", nil, fmt.Errorf("no columns are selected")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT " + strings.Join(q.columns, ", ") + "\nFROM " + from)
+	for _, join := range q.joins {
+		sb.WriteString("\n" + join)
+	}
+	if len(q.where) > 0 {
+		sb.WriteString("\nWHERE " + strings.Join(q.where, "\n  AND "))
+	}
+	if len(q.orderBy) > 0 {
+		sb.WriteString("\nORDER BY " + strings.Join(q.orderBy, ", "))
+	}
+	if q.limit != "" {
+		sb.WriteString("\nLIMIT " + q.limit)
+	}
+
+	args := make([]interface{}, len(q.args))
+	copy(args, q.args)
+	return sb.String(), args, nil
+}
@@ -0,0 +1,101 @@
+package persistence
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	maxSpamScore := 0.5
+	for i, test := range []struct {
+		d     *dialect
+		build func(q *queryBuilder)
+		query string
+		args  []interface{}
+		fails bool
+	}{
+		{sqlite3Dialect, func(q *queryBuilder) {
+			q.selectColumns("id", "name")
+			q.compare("modified_on", lessOrEqual, int64(100))
+			q.filter(QueryFilters{MaxSpamScore: &maxSpamScore})
+			q.compareRow([]identifier{"total_size", "id"}, less, 10.0, uint64(3))
+			q.orderByColumn("total_size", false)
+			q.orderByColumn("id", false)
+			q.limitTo(20)
+		}, "SELECT id, name FROM torrents WHERE modified_on <= ?1 AND spam_score <= ?2 AND moderation <> ?3 " +
+			"AND (total_size, id) < (?4, ?5) ORDER BY total_size DESC, id DESC LIMIT ?6",
+			[]interface{}{int64(100), 0.5, uint8(Flagged), 10.0, uint64(3), uint(20)}, false},
+		// The placeholders can be used more than once.
+		{postgresDialect, func(q *queryBuilder) {
+			query := q.arg("ubuntu")
+			q.selectExprs("similarity(name, " + query + ") AS rank")
+			q.whereFragment("name % " + query)
+			q.filter(QueryFilters{OnlyVerified: true})
+		}, "SELECT similarity(name, $1) AS rank FROM torrents WHERE name % $1 AND moderation = $2",
+			[]interface{}{"ubuntu", uint8(Verified)}, false},
+		// The identifiers that are not whitelisted are rejected,
+		{sqlite3Dialect, func(q *queryBuilder) {
+			q.selectColumns("id")
+			q.orderByColumn("id; DROP TABLE torrents", true)
+		}, "", nil, true},
+		{sqlite3Dialect, func(q *queryBuilder) {
+			q.selectColumnList("id, info_hash, (SELECT 1)")
+		}, "", nil, true},
+		// and so are the unknown operators,
+		{sqlite3Dialect, func(q *queryBuilder) {
+			q.selectColumns("id")
+			q.compare("id", comparison(42), 1)
+		}, "", nil, true},
+		// and the rows of different lengths.
+		{sqlite3Dialect, func(q *queryBuilder) {
+			q.selectColumns("id")
+			q.compareRow([]identifier{"total_size", "id"}, greater, 10.0)
+		}, "", nil, true},
+	} {
+		q := newQueryBuilder(test.d, "torrents")
+		test.build(q)
+		query, args, err := q.build()
+		if test.fails {
+			if err == nil {
+				t.Errorf("Instance #%d is built although it is invalid! Got `%s`", i+1, query)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Instance #%d could not be built! %s", i+1, err.Error())
+			continue
+		}
+
+		if query = strings.Join(strings.Fields(query), " "); query != test.query {
+			t.Errorf("Query of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, query, test.query)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("Arguments of the instance #%d are wrong! Got %v (expected %v)", i+1, args, test.args)
+		}
+	}
+}
+
+func TestOrderColumn(t *testing.T) {
+	for i, test := range []struct {
+		orderBy OrderingCriteria
+		column  identifier
+		fails   bool
+	}{
+		{ByRelevance, "idx.rank", false},
+		{ByTotalSize, "total_size", false},
+		{ByDiscoveredOn, "discovered_on", false},
+		{ByNSeeders, "", true},
+		{OrderingCriteria(42), "", true},
+	} {
+		column, err := orderColumn(test.orderBy)
+		if test.fails {
+			if err == nil {
+				t.Errorf("Instance #%d is ordered by `%s` although it is invalid!", i+1, column)
+			}
+		} else if err != nil {
+			t.Errorf("Instance #%d could not be ordered! %s", i+1, err.Error())
+		} else if column != test.column {
+			t.Errorf("Column of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, column, test.column)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package persistence
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ranking is the weights of the components of the relevance of the search results, by which the
+// textual relevance (how well the names of the torrents match the query) is boosted or penalised:
+//
+//	relevance = text × ((1 - recencyBoost) + recencyBoost × recency)
+//	                 × (1 + sizePreference × (size - 0.5))
+//	                 × (1 - spamPenalty × spam)
+//
+// where recency, size, and spam are in [0, 1]. The textual relevance is negative (like bm25() of
+// SQLite, the lower the better), hence so is the relevance.
+type ranking struct {
+	// recencyBoost (in [0, 1]) is the share of the relevance that is due to the recency of the
+	// torrents, which is halved at the age of recencyHalfLife (and is a third at twice the age).
+	recencyBoost    float64
+	recencyHalfLife time.Duration
+	// sizePreference (in [-1, 1]) prefers the larger torrents if positive, and the smaller ones if
+	// negative. The size of a torrent is 0.5 at 1 GiB.
+	sizePreference float64
+	// spamPenalty (in [0, 1]) is the share of the relevance that is lost by a certain spam.
+	spamPenalty float64
+}
+
+// sizePivot is the total size of a torrent whose size (as a component of the relevance) is 0.5.
+const sizePivot = 1 << 30
+
+var defaultRanking = ranking{
+	recencyBoost:    0.25,
+	recencyHalfLife: 30 * 24 * time.Hour,
+}
+
+// parseRanking parses the rank_recency_boost, rank_recency_half_life, rank_size_preference, and
+// rank_spam_penalty parameters of the URL of the database (e.g. `?rank_spam_penalty=0.5`), and
+// removes them from the URL lest they are passed on to the driver.
+func parseRanking(url_ *url.URL) (ranking, error) {
+	query := url_.Query()
+	r := defaultRanking
+
+	for _, param := range []struct {
+		name     string
+		weight   *float64
+		min, max float64
+	}{
+		{"rank_recency_boost", &r.recencyBoost, 0, 1},
+		{"rank_size_preference", &r.sizePreference, -1, 1},
+		{"rank_spam_penalty", &r.spamPenalty, 0, 1},
+	} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil || weight < param.min || weight > param.max {
+			return ranking{}, fmt.Errorf("%s must be in range [%g, %g]", param.name, param.min, param.max)
+		}
+		*param.weight = weight
+		query.Del(param.name)
+	}
+
+	if value := query.Get("rank_recency_half_life"); value != "" {
+		halfLife, err := time.ParseDuration(value)
+		if err != nil || halfLife <= 0 {
+			return ranking{}, fmt.Errorf("rank_recency_half_life must be a positive duration (e.g. 720h)")
+		}
+		r.recencyHalfLife = halfLife
+		query.Del("rank_recency_half_life")
+	}
+
+	url_.RawQuery = query.Encode()
+	return r, nil
+}
+
+// columns returns the SELECT list of the relevance (`rank`) and of its components (`text`,
+// `recency`, `size`, and `spam`) of the torrents, given the expressions of the textual relevance
+// and of the age of the torrents in seconds (which must be non-negative).
+func (r ranking) columns(text, age string) string {
+	halfLife := formatFloat(r.recencyHalfLife.Seconds())
+	recency := fmt.Sprintf("(%s / (%s + %s))", halfLife, halfLife, age)
+	size := fmt.Sprintf("(total_size / (total_size + %d.0))", sizePivot)
+	spam := "spam_score"
+
+	rank := fmt.Sprintf("%s * (%s + %s * %s) * (1 + %s * (%s - 0.5)) * (1 - %s * %s)",
+		text,
+		formatFloat(1-r.recencyBoost), formatFloat(r.recencyBoost), recency,
+		formatFloat(r.sizePreference), size,
+		formatFloat(r.spamPenalty), spam,
+	)
+
+	return fmt.Sprintf("%s AS text, %s AS recency, %s AS size, %s AS spam, %s AS rank", text, recency, size,
+		spam, rank)
+}
+
+// formatFloat formats the float as an SQL literal, which always has a decimal point lest the
+// divisions by it are integer divisions in SQLite.
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
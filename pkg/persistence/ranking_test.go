@@ -0,0 +1,54 @@
+package persistence
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseRanking(t *testing.T) {
+	for i, test := range []struct {
+		rawURL   string
+		ranking  ranking
+		rawQuery string
+		fails    bool
+	}{
+		{"sqlite3:///db.sqlite3?_busy_timeout=3000", defaultRanking, "_busy_timeout=3000", false},
+		{"sqlite3:///db.sqlite3?rank_spam_penalty=0.5&rank_size_preference=-0.25", ranking{
+			recencyBoost:    defaultRanking.recencyBoost,
+			recencyHalfLife: defaultRanking.recencyHalfLife,
+			sizePreference:  -0.25,
+			spamPenalty:     0.5,
+		}, "", false},
+		{"postgres://localhost/db?rank_recency_boost=0&rank_recency_half_life=168h&sslmode=disable", ranking{
+			recencyBoost:    0,
+			recencyHalfLife: 168 * time.Hour,
+		}, "sslmode=disable", false},
+		{"postgres://localhost/db?rank_recency_boost=1.5", ranking{}, "", true},
+		{"postgres://localhost/db?rank_spam_penalty=much", ranking{}, "", true},
+		{"postgres://localhost/db?rank_recency_half_life=0", ranking{}, "", true},
+	} {
+		url_, err := url.Parse(test.rawURL)
+		if err != nil {
+			t.Fatalf("Could not parse the URL of the instance #%d! %s", i+1, err.Error())
+		}
+
+		r, err := parseRanking(url_)
+		if test.fails {
+			if err == nil {
+				t.Errorf("Instance #%d is parsed although it is invalid!", i+1)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Instance #%d could not be parsed! %s", i+1, err.Error())
+			continue
+		}
+		if r != test.ranking {
+			t.Errorf("Ranking of the instance #%d is wrong! Got %+v (expected %+v)", i+1, r, test.ranking)
+		}
+		if url_.RawQuery != test.rawQuery {
+			t.Errorf("Query of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, url_.RawQuery, test.rawQuery)
+		}
+	}
+}
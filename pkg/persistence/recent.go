@@ -0,0 +1,9 @@
+package persistence
+
+// MaxRecentTorrents is the number of the most recently discovered torrents that are kept in the
+// `recent_torrents` ring buffer by the writer, hence the maximum @limit of GetRecentTorrents.
+//
+// The torrent whose ID is `id` is kept in the slot `id % MaxRecentTorrents`, overwriting the
+// torrent that has been discovered MaxRecentTorrents torrents before it, so that the ring buffer
+// never grows and GetRecentTorrents never has to touch the (big) `torrents` table.
+const MaxRecentTorrents = 100
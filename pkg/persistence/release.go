@@ -0,0 +1,226 @@
+package persistence
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Release is the structured metadata of a scene-style release name, such as
+// "The.Matrix.1999.1080p.BluRay.x264-GROUP", as parsed by ParseRelease. The attributes that cannot
+// be found in the name are zero.
+type Release struct {
+	Title string `json:"title,omitempty"`
+	Year  int    `json:"year,omitempty"`
+	// Season and Episode are of the TV series (e.g. S05E14), where the season packs have no
+	// episode.
+	Season  int `json:"season,omitempty"`
+	Episode int `json:"episode,omitempty"`
+	// Resolution and Codec are canonical (see canonicalResolution and canonicalCodec), e.g.
+	// "2160p" for 4K, and "h264" for x264.
+	Resolution string `json:"resolution,omitempty"`
+	Codec      string `json:"codec,omitempty"`
+	Group      string `json:"group,omitempty"`
+}
+
+// The names are matched after their dots and underscores are replaced by spaces (see ParseRelease),
+// hence the patterns expect spaces between the words (e.g. "h 264" for "H.264").
+var (
+	releaseSeasonEpisodeREs = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bS(\d{1,2}) ?(?:E(\d{1,3}))?\b`),
+		regexp.MustCompile(`\b(\d{1,2})x(\d{2,3})\b`),
+	}
+	releaseResolutionRE = regexp.MustCompile(`(?i)\b(2160p|1080p|1080i|720p|576p|480p|4k|uhd)\b`)
+	releaseCodecRE      = regexp.MustCompile(`(?i)\b(x ?26[45]|h ?26[45]|hevc|avc|xvid|divx|av1|vp9)\b`)
+	// releaseSourceRE is of the sources of the releases, which are not extracted, but end the titles
+	// as the other attributes do.
+	releaseSourceRE = regexp.MustCompile(
+		`(?i)\b(blu ?ray|bdrip|brrip|bdremux|remux|web-?dl|web ?dl|webrip|hdtv|hdrip|dvdrip|hdcam|telesync)\b`)
+	releaseYearRE = regexp.MustCompile(`\b(19\d{2}|20\d{2})\b`)
+
+	releaseGroupPrefixRE  = regexp.MustCompile(`^\[([^\]]+)\] *`)
+	releaseGroupSuffixRE  = regexp.MustCompile(`- ?([A-Za-z0-9]+)$`)
+	releaseTrailingTagsRE = regexp.MustCompile(`( *\[[^\]]*\])+$`)
+)
+
+// ParseRelease parses the name of a torrent as a scene-style release name (see Release). The title
+// is what precedes the year and the other attributes, hence the names that have none of them are
+// not parsed at all (i.e. the zero Release is returned), as they are not release names.
+//
+// It is a set of cheap heuristics, computed once at insert time as the spam score is, rather than
+// a strict parser of the naming standards of the scene, which are followed loosely at best.
+func ParseRelease(name string) Release {
+	if videoExtensions[fileExtension(name)] {
+		name = name[:strings.LastIndexByte(name, '.')]
+	}
+	s := strings.NewReplacer(".", " ", "_", " ").Replace(strings.TrimSpace(name))
+
+	var release Release
+	start := 0
+	if m := releaseGroupPrefixRE.FindStringSubmatchIndex(s); m != nil {
+		release.Group = strings.TrimSpace(s[m[2]:m[3]])
+		start = m[1]
+	}
+
+	// The title ends at the first of the attributes (other than the year).
+	end := -1
+	first := func(i int) {
+		if end == -1 || i < end {
+			end = i
+		}
+	}
+	for _, re := range releaseSeasonEpisodeREs {
+		if m := re.FindStringSubmatchIndex(s[start:]); m != nil {
+			if release.Season == 0 {
+				release.Season, _ = strconv.Atoi(s[start+m[2] : start+m[3]])
+				if m[4] != -1 {
+					release.Episode, _ = strconv.Atoi(s[start+m[4] : start+m[5]])
+				}
+			}
+			first(start + m[0])
+		}
+	}
+	if m := releaseResolutionRE.FindStringIndex(s[start:]); m != nil {
+		release.Resolution = canonicalResolution(s[start+m[0] : start+m[1]])
+		first(start + m[0])
+	}
+	if m := releaseCodecRE.FindStringIndex(s[start:]); m != nil {
+		release.Codec = canonicalCodec(s[start+m[0] : start+m[1]])
+		first(start + m[0])
+	}
+	if m := releaseSourceRE.FindStringIndex(s[start:]); m != nil {
+		first(start + m[0])
+	}
+
+	// The year is the last one before the other attributes, but not at the start of the title,
+	// so that the years in the titles (e.g. "2001 A Space Odyssey 1968") are told apart.
+	year := -1
+	for _, m := range releaseYearRE.FindAllStringIndex(s[start:], -1) {
+		if m[0] > 0 && (end == -1 || start+m[0] < end) {
+			year = start + m[0]
+		}
+	}
+	if year != -1 {
+		release.Year, _ = strconv.Atoi(s[year : year+4])
+		first(year)
+	}
+	if end == -1 {
+		return Release{}
+	}
+	release.Title = strings.Join(strings.Fields(strings.Trim(s[start:end], " -([{")), " ")
+
+	// The group is the suffix after the last hyphen (e.g. "x264-GROUP"), if it is not one of the
+	// attributes (e.g. "WEB-DL") or a number (e.g. the episode of "Title - 01").
+	tail := releaseTrailingTagsRE.ReplaceAllString(s, "")
+	if m := releaseGroupSuffixRE.FindStringSubmatchIndex(tail); m != nil && m[0] > end {
+		group, word := tail[m[2]:m[3]], tail[strings.LastIndexByte(tail[:m[0]], ' ')+1:]
+		if _, err := strconv.Atoi(group); err != nil && !releaseResolutionRE.MatchString(group) &&
+			!releaseCodecRE.MatchString(group) && !releaseSourceRE.MatchString(word) {
+			release.Group = group
+		}
+	}
+
+	return release
+}
+
+// canonicalResolution returns the canonical name of the resolution, e.g. "2160p" for "4K".
+func canonicalResolution(resolution string) string {
+	resolution = strings.ToLower(resolution)
+	switch resolution {
+	case "4k", "uhd":
+		return "2160p"
+	default:
+		return resolution
+	}
+}
+
+// canonicalCodec returns the canonical name of the codec, e.g. "h264" for "x264" and "H.264".
+func canonicalCodec(codec string) string {
+	codec = strings.NewReplacer(" ", "", ".", "").Replace(strings.ToLower(codec))
+	switch codec {
+	case "x264", "h264", "avc":
+		return "h264"
+	case "x265", "h265", "hevc":
+		return "h265"
+	default:
+		return codec
+	}
+}
+
+// values returns the values of the release columns of the torrents (in the order of
+// releaseColumns), where the attributes that are zero are NULL.
+func (r Release) values() []interface{} {
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: s != ""} }
+	num := func(n int) sql.NullInt64 { return sql.NullInt64{Int64: int64(n), Valid: n != 0} }
+	return []interface{}{str(r.Title), num(r.Year), num(r.Season), num(r.Episode), str(r.Resolution),
+		str(r.Codec), str(r.Group)}
+}
+
+// releaseColumns are the columns of the torrents that both engines store the releases of their
+// names in (see ParseRelease), so that the searches can be filtered by them (see QueryFilters).
+var releaseColumns = []string{"release_title", "release_year", "release_season", "release_episode",
+	"release_resolution", "release_codec", "release_group"}
+
+// fillReleases stores the releases of the names of all the torrents (see ParseRelease), in batches,
+// for the migrations that add the release columns.
+func fillReleases(tx *timedTx, d *dialect) error {
+	const batchSize = 1000
+	type torrent struct {
+		id      int64
+		release Release
+	}
+
+	selectBatch := fmt.Sprintf(`
+		SELECT id, name
+		FROM torrents
+		WHERE id > %s
+		ORDER BY id
+		LIMIT %s;`, d.placeholder(1), d.placeholder(2))
+	assignments := make([]string, len(releaseColumns))
+	for i, column := range releaseColumns {
+		assignments[i] = fmt.Sprintf("%s = %s", column, d.placeholder(i+1))
+	}
+	update := fmt.Sprintf("UPDATE torrents SET %s WHERE id = %s;", strings.Join(assignments, ", "),
+		d.placeholder(len(releaseColumns)+1))
+
+	var lastID int64
+	for {
+		rows, err := tx.Query(selectBatch, lastID, batchSize)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Query")
+		}
+		// The rows are read before the torrents are updated, as the rows of a query must be closed
+		// before the next statement is executed in the transaction.
+		parsed := make([]torrent, 0)
+		nRows := 0
+		for rows.Next() {
+			var name string
+			if err = rows.Scan(&lastID, &name); err != nil {
+				closeRows(rows)
+				return errors.Wrap(err, "sql.Rows.Scan")
+			}
+			nRows++
+			if release := ParseRelease(name); release != (Release{}) {
+				parsed = append(parsed, torrent{lastID, release})
+			}
+		}
+		closeRows(rows)
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "sql.Rows.Err")
+		}
+
+		for _, t := range parsed {
+			if _, err = tx.Exec(update, append(t.release.values(), t.id)...); err != nil {
+				return errors.Wrap(err, "sql.Tx.Exec (UPDATE torrents)")
+			}
+		}
+
+		if nRows < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,35 @@
+//go:build fts5
+// +build fts5
+
+package persistence
+
+import "testing"
+
+var parseReleaseTest_instances = []struct {
+	name     string
+	expected Release
+}{
+	{"The.Matrix.1999.1080p.BluRay.x264-GROUP", Release{Title: "The Matrix", Year: 1999, Resolution: "1080p",
+		Codec: "h264", Group: "GROUP"}},
+	{"Breaking.Bad.S05E14.720p.HDTV.x264-IMMERSE.mkv", Release{Title: "Breaking Bad", Season: 5, Episode: 14,
+		Resolution: "720p", Codec: "h264", Group: "IMMERSE"}},
+	{"Some Show S02 Complete 2160p WEB-DL H.265", Release{Title: "Some Show", Season: 2, Resolution: "2160p",
+		Codec: "h265"}},
+	{"2001 A Space Odyssey (1968) [4K UHD HEVC]", Release{Title: "2001 A Space Odyssey", Year: 1968,
+		Resolution: "2160p", Codec: "h265"}},
+	{"Blade Runner 2049 2017 1080p WEB-DL", Release{Title: "Blade Runner 2049", Year: 2017, Resolution: "1080p"}},
+	{"[SubGroup] Some Anime - 01 [1080p][ABCD1234].mkv", Release{Title: "Some Anime - 01", Resolution: "1080p",
+		Group: "SubGroup"}},
+	{"Spider-Man 2002", Release{Title: "Spider-Man", Year: 2002}},
+	{"Ubuntu 20.04 LTS Desktop", Release{}},
+	{"SomeEditor 1.2.3", Release{}},
+}
+
+func TestParseRelease(t *testing.T) {
+	for i, instance := range parseReleaseTest_instances {
+		if release := ParseRelease(instance.name); release != instance.expected {
+			t.Errorf("Release of the instance #%d is wrong! Got %+v (expected %+v)", i+1, release,
+				instance.expected)
+		}
+	}
+}
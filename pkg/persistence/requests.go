@@ -0,0 +1,45 @@
+package persistence
+
+import (
+	"encoding/hex"
+	"encoding/json"
+)
+
+// RequestStatus is the progress of the crawler on a request for a torrent.
+type RequestStatus string
+
+const (
+	// RequestPending requests have not been looked up on the DHT yet.
+	RequestPending RequestStatus = "pending"
+	// RequestLookingUp requests have been looked up on the DHT at least once, but their torrents
+	// have not been fetched yet.
+	RequestLookingUp RequestStatus = "looking-up"
+	// RequestFetched requests are fulfilled, i.e. their torrents are in the database.
+	RequestFetched RequestStatus = "fetched"
+	// RequestFailed requests are given up on, after they have been looked up too many times.
+	RequestFailed RequestStatus = "failed"
+)
+
+// TorrentRequest is a request of the users for a torrent that is not in the database, to be looked
+// up on the DHT (and fetched) by the crawler.
+type TorrentRequest struct {
+	InfoHash []byte        `json:"infoHash"` // marshalled differently
+	Status   RequestStatus `json:"status"`
+	// Attempts is the number of the times that the infohash has been looked up.
+	Attempts uint `json:"attempts"`
+	// RequestedOn and LastAttemptedOn are in Unix time, where LastAttemptedOn is zero if the
+	// infohash has not been looked up yet.
+	RequestedOn     int64 `json:"requestedOn"`
+	LastAttemptedOn int64 `json:"lastAttemptedOn"`
+}
+
+func (request *TorrentRequest) MarshalJSON() ([]byte, error) {
+	type Alias TorrentRequest
+	return json.Marshal(&struct {
+		InfoHash string `json:"infoHash"`
+		*Alias
+	}{
+		InfoHash: hex.EncodeToString(request.InfoHash),
+		Alias:    (*Alias)(request),
+	})
+}
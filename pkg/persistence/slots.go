@@ -0,0 +1,13 @@
+package persistence
+
+// Slot is one of the slots that the instances sharing a database hold exclusively (see
+// Database.AcquireSlot), such as the partitions of the keyspace of the DHT among the crawlers.
+type Slot interface {
+	// Index is the index of the slot, from 0.
+	Index() int
+	// Check returns an error if the slot is lost (e.g. as the connection to the database is lost),
+	// in which case it is to be released, and acquired again.
+	Check() error
+	// Release releases the slot, so that the other instances can acquire it.
+	Release() error
+}
@@ -0,0 +1,27 @@
+package persistence
+
+// Source is the mechanism by which a torrent is discovered, for evaluating the crawl strategies.
+type Source string
+
+const (
+	// SourceAnnounce is for the torrents announced to our DHT nodes (using announce_peer).
+	SourceAnnounce Source = "announce"
+	// SourceSample is for the torrents sampled from the other DHT nodes (using sample_infohashes,
+	// BEP 51).
+	SourceSample Source = "sample"
+	// SourceTracker is for the torrents scraped from the trackers.
+	SourceTracker Source = "tracker"
+	// SourceImport is for the torrents imported from the dumps.
+	SourceImport Source = "import"
+	// SourceRequest is for the torrents requested by the users, which are looked up on the DHT
+	// (using get_peers).
+	SourceRequest Source = "request"
+	// SourceFederation is for the torrents received from the other instances.
+	SourceFederation Source = "federation"
+	// SourceSynthetic is for the torrents synthesized for the development databases (see package
+	// synth), which are not real.
+	SourceSynthetic Source = "synthetic"
+	// SourceUnknown is the source of the torrents that are discovered before the sources were
+	// recorded.
+	SourceUnknown Source = ""
+)
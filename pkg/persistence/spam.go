@@ -0,0 +1,95 @@
+package persistence
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Spam scoring is a set of cheap heuristics, computed once at insert time, that flag the torrents
+// that are likely to be fake or spam. It is by no means accurate, and it should be used to push
+// likely spam down (or out) of the search results rather than to delete anything.
+
+var videoNameRE = regexp.MustCompile(
+	`(?i)\b(2160p|1080p|720p|480p|4k|uhd|bluray|blu-ray|bdrip|brrip|web-?dl|webrip|hdrip|dvdrip|` +
+		`hdtv|x264|x265|h\.?264|h\.?265|hevc|xvid|divx|cam|hdcam|telesync|movie|film)\b`,
+)
+
+var spamNameREs = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(download|watch)\b.*\b(free|online|now)\b`),
+	regexp.MustCompile(`(?i)\bfull\s+movie\b`),
+	regexp.MustCompile(`(?i)\b(free|hot)\s+(gift|prize|bitcoin|btc)\b`),
+	regexp.MustCompile(`(?i)\bclick\s+here\b`),
+	regexp.MustCompile(`(?i)\b(codec|player)\s+required\b`),
+}
+
+var passwordFileRE = regexp.MustCompile(`(?i)(^|/)(pass(word)?s?|get[ _-]?pass(word)?|unlock)[^/]*\.(txt|url|html?|lnk)$`)
+
+var executableExtensions = map[string]bool{
+	"exe": true, "scr": true, "bat": true, "cmd": true, "com": true, "msi": true, "lnk": true,
+	"vbs": true, "pif": true, "jar": true, "ps1": true,
+}
+
+var videoExtensions = map[string]bool{
+	"mkv": true, "mp4": true, "avi": true, "m4v": true, "mov": true, "wmv": true, "ts": true,
+	"m2ts": true, "webm": true, "mpg": true, "mpeg": true, "vob": true, "flv": true,
+}
+
+var archiveExtensions = map[string]bool{
+	"zip": true, "rar": true, "7z": true,
+}
+
+// SpamScore returns how likely, in range [0, 1], the torrent of the given name and files is spam.
+func SpamScore(name string, files []File) float64 {
+	var score float64
+
+	var nExecutables, nVideos, nArchives int
+	var executablesSize, totalSize int64
+	hasPasswordFile := false
+	for _, file := range files {
+		ext := fileExtension(file.Path)
+		switch {
+		case executableExtensions[ext]:
+			nExecutables++
+			executablesSize += file.Size
+		case videoExtensions[ext]:
+			nVideos++
+		case archiveExtensions[ext]:
+			nArchives++
+		}
+		if passwordFileRE.MatchString(file.Path) {
+			hasPasswordFile = true
+		}
+		totalSize += file.Size
+	}
+
+	// A "movie" that ships an executable but not a single video file is the textbook example.
+	if videoNameRE.MatchString(name) && nExecutables > 0 && nVideos == 0 {
+		score += 0.6
+	}
+
+	// A single, small executable (e.g. an "installer" or a "codec") is rarely anything good.
+	if len(files) == 1 && nExecutables == 1 && totalSize < 10*1024*1024 {
+		score += 0.3
+	} else if nExecutables > 0 && totalSize > 0 && float64(executablesSize)/float64(totalSize) > 0.9 &&
+		videoNameRE.MatchString(name) {
+		score += 0.2
+	}
+
+	// Password-protected archives whose password is to be "obtained" from a website.
+	if nArchives > 0 && (hasPasswordFile || strings.Contains(strings.ToLower(name), "password")) {
+		score += 0.4
+	} else if hasPasswordFile {
+		score += 0.2
+	}
+
+	for _, re := range spamNameREs {
+		if re.MatchString(name) {
+			score += 0.2
+		}
+	}
+
+	if score > 1 {
+		return 1
+	}
+	return score
+}
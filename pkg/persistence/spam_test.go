@@ -0,0 +1,69 @@
+package persistence
+
+import "testing"
+
+var spamScoreTest_instances = []struct {
+	name    string
+	files   []File
+	minimum float64
+	maximum float64
+}{
+	// A regular movie:
+	{
+		name: "Some.Movie.2019.1080p.BluRay.x264-GROUP",
+		files: []File{
+			{Size: 8 * 1024 * 1024 * 1024, Path: "Some.Movie.2019.1080p.BluRay.x264-GROUP.mkv"},
+			{Size: 100 * 1024, Path: "Some.Movie.2019.1080p.BluRay.x264-GROUP.srt"},
+		},
+		minimum: 0,
+		maximum: 0,
+	},
+	// A regular software:
+	{
+		name: "SomeEditor 1.2.3",
+		files: []File{
+			{Size: 200 * 1024 * 1024, Path: "SomeEditor 1.2.3/setup.exe"},
+			{Size: 1024, Path: "SomeEditor 1.2.3/README.txt"},
+		},
+		minimum: 0,
+		maximum: 0,
+	},
+	// A "movie" with a single small executable:
+	{
+		name: "Some.Movie.2019.1080p.WEB-DL",
+		files: []File{
+			{Size: 2 * 1024 * 1024, Path: "Some.Movie.2019.1080p.WEB-DL.exe"},
+		},
+		minimum: 0.89,
+		maximum: 1,
+	},
+	// A password-protected archive:
+	{
+		name: "Some Album (2020) [FLAC]",
+		files: []File{
+			{Size: 300 * 1024 * 1024, Path: "Some Album (2020) [FLAC]/album.rar"},
+			{Size: 100, Path: "Some Album (2020) [FLAC]/Password.txt"},
+		},
+		minimum: 0.4,
+		maximum: 0.4,
+	},
+	// Known spam name patterns:
+	{
+		name: "Watch Some Movie Online Free Full Movie",
+		files: []File{
+			{Size: 700 * 1024 * 1024, Path: "Some Movie.mp4"},
+		},
+		minimum: 0.4,
+		maximum: 0.4,
+	},
+}
+
+func TestSpamScore(t *testing.T) {
+	for i, instance := range spamScoreTest_instances {
+		score := SpamScore(instance.name, instance.files)
+		if score < instance.minimum || score > instance.maximum {
+			t.Errorf("Spam score of the instance #%d is out of range! Got %f (expected [%f, %f])",
+				i+1, score, instance.minimum, instance.maximum)
+		}
+	}
+}
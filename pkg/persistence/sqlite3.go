@@ -7,8 +7,11 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
@@ -19,7 +22,15 @@ import (
 // See https://github.com/mattn/go-sqlite3/issues/2741
 
 type sqlite3Database struct {
-	conn *sql.DB
+	conn    *timedConn
+	dir     string // of the database file, for the free space of its disk
+	ranking ranking
+	breaker breaker
+	// pathSearch is true if the paths of the files can be searched (see parsePathSearch).
+	pathSearch bool
+	// cjkBigrams is true if the CJK names are searched by their bigrams (see parseCJKBigrams).
+	cjkBigrams bool
+	synonyms   synonyms
 }
 
 func makeSqlite3Database(url_ *url.URL) (Database, error) {
@@ -29,17 +40,49 @@ func makeSqlite3Database(url_ *url.URL) (Database, error) {
 	if err := os.MkdirAll(dbDir, 0755); err != nil {
 		return nil, errors.Wrapf(err, "mkdirAll error for `%s`", dbDir)
 	}
+	db.dir = dbDir
+
+	timeout, slowQueryThreshold, err := parseQueryLimits(url_)
+	if err != nil {
+		return nil, err
+	}
+	if db.ranking, err = parseRanking(url_); err != nil {
+		return nil, err
+	}
+	if db.pathSearch, err = parsePathSearch(url_); err != nil {
+		return nil, err
+	}
+	if db.cjkBigrams, err = parseCJKBigrams(url_); err != nil {
+		return nil, err
+	}
+	if db.synonyms, err = parseSynonyms(url_); err != nil {
+		return nil, err
+	}
+
+	// The concurrent writers (e.g. the crawler adding the same torrent twice) would fail with
+	// SQLITE_BUSY right away without a busy timeout, so there is one by default. Moreover, the
+	// transactions take the write lock as soon as they begin (unless set otherwise), since the
+	// busy timeout is of no use to a transaction whose snapshot is stale by the time it writes
+	// (i.e. SQLITE_BUSY_SNAPSHOT), see https://www.sqlite.org/lang_transaction.html
+	query := url_.Query()
+	if query.Get("_busy_timeout") == "" && query.Get("_timeout") == "" {
+		query.Set("_busy_timeout", strconv.Itoa(defaultBusyTimeout))
+	}
+	if query.Get("_txlock") == "" {
+		query.Set("_txlock", "immediate")
+	}
+	url_.RawQuery = query.Encode()
 
-	var err error
 	// To handle spaces in the file path, we ensure that URI path handling is triggered in the
 	// sqlite3 driver, and that escaping is applied to the URL on this side. See issue #240.
 	url_.Scheme = "file"
 	// To ensure that // isn't injected into the URI. The query is still handled.
 	url_.Opaque = url_.Path
-	db.conn, err = sql.Open("sqlite3", url_.String())
+	conn, err := sql.Open("sqlite3", url_.String())
 	if err != nil {
 		return nil, errors.Wrap(err, "sql.Open")
 	}
+	db.conn = &timedConn{DB: conn}
 
 	// > Open may just validate its arguments without creating a connection to the database. To
 	// > verify that the data source Name is valid, call Ping.
@@ -72,11 +115,17 @@ func makeSqlite3Database(url_ *url.URL) (Database, error) {
 	if err := db.setupDatabase(); err != nil {
 		return nil, errors.Wrap(err, "setupDatabase")
 	}
+	// The migrations (in setupDatabase) might take long on large databases, hence are not limited.
+	db.conn.timeout, db.conn.slowQueryThreshold = timeout, slowQueryThreshold
 
 	return db, nil
 }
 
-func (db *sqlite3Database) Engine() databaseEngine {
+// defaultBusyTimeout is the busy timeout (in milliseconds) of the SQLite databases whose URLs do not
+// set one, see https://www.sqlite.org/c3ref/busy_timeout.html
+const defaultBusyTimeout = 5000
+
+func (db *sqlite3Database) Engine() DatabaseEngine {
 	return Sqlite3
 }
 
@@ -97,28 +146,7 @@ func (db *sqlite3Database) DoesTorrentExist(infoHash []byte) (bool, error) {
 	return exists, nil
 }
 
-func (db *sqlite3Database) AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte) error {
-	tx, err := db.conn.Begin()
-	if err != nil {
-		return errors.Wrap(err, "conn.Begin")
-	}
-	// If everything goes as planned and no error occurs, we will commit the transaction before
-	// returning from the function so the tx.Rollback() call will fail, trying to rollback a
-	// committed transaction. BUT, if an error occurs, we'll get our transaction rollback'ed, which
-	// is nice.
-	defer tx.Rollback()
-
-	var totalSize uint64 = 0
-	for _, file := range files {
-		totalSize += uint64(file.Size)
-	}
-
-	// This is a workaround for a bug: the database will not accept total_size to be zero.
-	if totalSize == 0 {
-		zap.L().Debug("Ignoring a torrent whose total size is zero.")
-		return nil
-	}
-
+func (db *sqlite3Database) AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) error {
 	// Although we check whether the torrent exists in the database before asking MetadataSink to
 	// fetch its metadata, the torrent can also exists in the Sink before that:
 	//
@@ -126,6 +154,12 @@ func (db *sqlite3Database) AddNewTorrent(infoHash []byte, name string, files []F
 	// received, a race condition arises when we query the database and seeing that it doesn't
 	// exists there, add it to the sink.
 	//
+	// The check below is merely the cheap way out of the common case; the concurrent inserts of the
+	// same torrent (e.g. by multiple crawlers) can both race past it, hence the insert does nothing
+	// on the conflicts of info_hash (and of info_hash only, unlike INSERT OR IGNORE INTO). It is
+	// before the transaction is begun, lest the concurrent inserts hold all the connections of the
+	// pool while waiting for one more to check.
+	//
 	// Do NOT try to be clever and attempt to use INSERT OR IGNORE INTO or INSERT OR REPLACE INTO
 	// without understanding their consequences fully:
 	//
@@ -156,16 +190,63 @@ func (db *sqlite3Database) AddNewTorrent(infoHash []byte, name string, files []F
 		return err
 	}
 
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "conn.Begin")
+	}
+	// If everything goes as planned and no error occurs, we will commit the transaction before
+	// returning from the function so the tx.Rollback() call will fail, trying to rollback a
+	// committed transaction. BUT, if an error occurs, we'll get our transaction rollback'ed, which
+	// is nice.
+	defer tx.Rollback()
+
+	var totalSize uint64 = 0
+	for _, file := range files {
+		totalSize += uint64(file.Size)
+	}
+
+	// This is a workaround for a bug: the database will not accept total_size to be zero.
+	if totalSize == 0 {
+		zap.L().Named("persistence").Debug("Ignoring a torrent whose total size is zero.")
+		return nil
+	}
+
 	res, err := tx.Exec(`
 		INSERT INTO torrents (
 			info_hash,
 			name,
+			cjk_bigrams,
+			synonyms,
+			metadata,
 			total_size,
-			discovered_on
-		) VALUES (?, ?, ?, ?);
-	`, infoHash, name, totalSize, time.Now().Unix())
+			discovered_on,
+			spam_score,
+			category,
+			source,
+			n_files,
+			release_title,
+			release_year,
+			release_season,
+			release_episode,
+			release_resolution,
+			release_codec,
+			release_group,
+			album_artist,
+			album_title,
+			album_n_tracks
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (info_hash) DO NOTHING;
+	`, append(append([]interface{}{infoHash, name, cjkBigrams(name), db.synonyms.ofName(name), metadata, totalSize,
+		now().Unix(), SpamScore(name, files), TorrentCategory(files), source, len(files)},
+		ParseRelease(name).values()...), ParseAlbum(name, files).values()...)...)
 	if err != nil {
-		return errors.Wrap(err, "tx.Exec (INSERT OR REPLACE INTO torrents)")
+		return errors.Wrap(err, "tx.Exec (INSERT INTO torrents)")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrap(err, "sql.Result.RowsAffected")
+	} else if n == 0 {
+		zap.L().Named("persistence").Debug("Ignoring a torrent that is added concurrently.")
+		return nil
 	}
 
 	var lastInsertId int64
@@ -184,7 +265,7 @@ func (db *sqlite3Database) AddNewTorrent(infoHash []byte, name string, files []F
 	// Now, last_insert_rowid() should never return zero (or any negative values really) as we
 	// insert into torrents and handle any errors accordingly right afterwards.
 	if lastInsertId <= 0 {
-		zap.L().Panic("last_insert_rowid() <= 0 (this should have never happened!)",
+		zap.L().Named("persistence").Panic("last_insert_rowid() <= 0 (this should have never happened!)",
 			zap.Int64("lastInsertId", lastInsertId))
 	}
 
@@ -197,6 +278,24 @@ func (db *sqlite3Database) AddNewTorrent(infoHash []byte, name string, files []F
 		}
 	}
 
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO recent_torrents (
+			slot,
+			torrent_id,
+			info_hash,
+			name,
+			total_size,
+			discovered_on,
+			n_files,
+			spam_score
+		) SELECT id % ?, id, info_hash, name, total_size, discovered_on, n_files, spam_score
+		  FROM torrents
+		  WHERE id = ?;
+	`, MaxRecentTorrents, lastInsertId)
+	if err != nil {
+		return errors.Wrap(err, "tx.Exec (INSERT OR REPLACE INTO recent_torrents)")
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return errors.Wrap(err, "tx.Commit")
@@ -205,6 +304,149 @@ func (db *sqlite3Database) AddNewTorrent(infoHash []byte, name string, files []F
 	return nil
 }
 
+func (db *sqlite3Database) UpsertTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var oldName string
+	var oldMetadata []byte
+	err = tx.QueryRow("SELECT id, name, metadata FROM torrents WHERE info_hash = ?;", infoHash).Scan(
+		&id, &oldName, &oldMetadata)
+	if err == sql.ErrNoRows {
+		if err = tx.Rollback(); err != nil {
+			return false, errors.Wrap(err, "tx.Rollback")
+		}
+		if err = db.AddNewTorrent(infoHash, name, files, metadata, source); err != nil {
+			return false, errors.Wrap(err, "AddNewTorrent")
+		}
+		// The torrents whose total size is zero are ignored by AddNewTorrent.
+		return db.DoesTorrentExist(infoHash)
+	} else if err != nil {
+		return false, errors.Wrap(err, "tx.QueryRow (SELECT FROM torrents)")
+	}
+
+	if name == oldName && bytes.Equal(metadata, oldMetadata) {
+		return false, nil
+	}
+
+	var totalSize uint64 = 0
+	for _, file := range files {
+		totalSize += uint64(file.Size)
+	}
+	if totalSize == 0 {
+		zap.L().Named("persistence").Debug("Ignoring a torrent whose total size is zero.")
+		return false, nil
+	}
+
+	// The full-text index of the name is updated by the torrents_idx_au_t trigger.
+	_, err = tx.Exec(`
+		UPDATE torrents
+		SET name        = ?,
+			cjk_bigrams = ?,
+			synonyms    = ?,
+			metadata    = ?,
+			total_size  = ?,
+			n_files     = ?,
+			spam_score  = ?,
+			category    = ?,
+			modified_on = MAX(?, discovered_on),
+			release_title      = ?,
+			release_year       = ?,
+			release_season     = ?,
+			release_episode    = ?,
+			release_resolution = ?,
+			release_codec      = ?,
+			release_group      = ?,
+			album_artist       = ?,
+			album_title        = ?,
+			album_n_tracks     = ?
+		WHERE id = ?;
+	`, append(append(append([]interface{}{name, cjkBigrams(name), db.synonyms.ofName(name), metadata, totalSize,
+		len(files), SpamScore(name, files), TorrentCategory(files), now().Unix()}, ParseRelease(name).values()...),
+		ParseAlbum(name, files).values()...), id)...)
+	if err != nil {
+		return false, errors.Wrap(err, "tx.Exec (UPDATE torrents)")
+	}
+
+	if _, err = tx.Exec("DELETE FROM files WHERE torrent_id = ?;", id); err != nil {
+		return false, errors.Wrap(err, "tx.Exec (DELETE FROM files)")
+	}
+	for _, file := range files {
+		_, err = tx.Exec("INSERT INTO files (torrent_id, size, path) VALUES (?, ?, ?);", id, file.Size, file.Path)
+		if err != nil {
+			return false, errors.Wrap(err, "tx.Exec (INSERT INTO files)")
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE recent_torrents
+		SET (name, total_size, n_files, spam_score) = (
+			SELECT name, total_size, n_files, spam_score FROM torrents WHERE id = ?
+		)
+		WHERE torrent_id = ?;
+	`, id, id)
+	if err != nil {
+		return false, errors.Wrap(err, "tx.Exec (UPDATE recent_torrents)")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "tx.Commit")
+	}
+	return true, nil
+}
+
+func (db *sqlite3Database) SetDiscoveredOn(infoHash []byte, discoveredOn int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	// The torrents that are not modified since they were discovered are not modified still.
+	_, err = tx.Exec(`
+		UPDATE torrents
+		SET discovered_on = ?1,
+			modified_on   = CASE WHEN modified_on = discovered_on THEN ?1 ELSE MAX(modified_on, ?1) END
+		WHERE info_hash = ?2;
+	`, discoveredOn, infoHash)
+	if err != nil {
+		return errors.Wrap(err, "tx.Exec (UPDATE torrents)")
+	}
+	_, err = tx.Exec("UPDATE recent_torrents SET discovered_on = ? WHERE info_hash = ?;", discoveredOn, infoHash)
+	if err != nil {
+		return errors.Wrap(err, "tx.Exec (UPDATE recent_torrents)")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "tx.Commit")
+	}
+	return nil
+}
+
+func (db *sqlite3Database) WithTx(fn func(tx Database) error) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	// The searches in the transaction have a breaker of their own, as they are few.
+	tdb := &sqlite3Database{conn: db.conn.bind(tx), dir: db.dir, ranking: db.ranking, pathSearch: db.pathSearch,
+		cjkBigrams: db.cjkBigrams, synonyms: db.synonyms}
+	if err = fn(tdb); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "tx.Commit")
+	}
+	return nil
+}
+
 func (db *sqlite3Database) Close() error {
 	return db.conn.Close()
 }
@@ -235,6 +477,55 @@ func (db *sqlite3Database) GetNumberOfTorrents() (uint, error) {
 	}
 }
 
+func (db *sqlite3Database) GetTotalSize() (uint64, error) {
+	var totalSize uint64
+	err := db.conn.QueryRow("SELECT COALESCE(SUM(total_size), 0) FROM torrents;").Scan(&totalSize)
+	return totalSize, err
+}
+
+func (db *sqlite3Database) GetNumberOfDiscoveredTorrents(from int64) (uint64, error) {
+	var n uint64
+	err := db.conn.QueryRow("SELECT COUNT(*) FROM torrents WHERE discovered_on >= ?;", from).Scan(&n)
+	return n, err
+}
+
+func (db *sqlite3Database) GetRecentTorrents(limit uint) ([]TorrentMetadata, error) {
+	rows, err := db.conn.Query(`
+		SELECT
+			torrent_id,
+			info_hash,
+			name,
+			total_size,
+			discovered_on,
+			n_files,
+			spam_score
+		FROM recent_torrents
+		ORDER BY torrent_id DESC
+		LIMIT ?;`,
+		limit,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "conn.Query (SELECT FROM recent_torrents)")
+	}
+	defer closeRows(rows)
+
+	torrents := make([]TorrentMetadata, 0)
+	for rows.Next() {
+		var tm TorrentMetadata
+		var discoveredOn int64 // in Unix time, which the driver does not convert to time.Time
+		if err = rows.Scan(&tm.ID, &tm.InfoHash, &tm.Name, &tm.Size, &discoveredOn, &tm.NFiles, &tm.SpamScore); err != nil {
+			return nil, err
+		}
+		tm.DiscoveredOn = fromUnix(discoveredOn)
+		torrents = append(torrents, tm)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return torrents, nil
+}
+
 func (db *sqlite3Database) QueryTorrents(
 	query string,
 	epoch int64,
@@ -243,128 +534,101 @@ func (db *sqlite3Database) QueryTorrents(
 	limit uint,
 	lastOrderedValue *float64,
 	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
 ) ([]TorrentMetadata, error) {
-	if query == "" && orderBy == ByRelevance {
-		return nil, fmt.Errorf("torrents cannot be ordered by relevance when the query is empty")
-	}
-	if (lastOrderedValue == nil) != (lastID == nil) {
-		return nil, fmt.Errorf("lastOrderedValue and lastID should be supplied together, if supplied")
-	}
-
-	doJoin := query != ""
-	firstPage := lastID == nil
-
-	// executeTemplate is used to prepare the SQL query, WITH PLACEHOLDERS FOR USER INPUT.
-	sqlQuery := executeTemplate(`
-		SELECT id 
-             , info_hash
-			 , name
-			 , total_size
-			 , discovered_on
-			 , (SELECT COUNT(*) FROM files WHERE torrents.id = files.torrent_id) AS n_files
-	{{ if .DoJoin }}
-			 , idx.rank
-	{{ else }}
-			 , 0
-	{{ end }}
-		FROM torrents
-	{{ if .DoJoin }}
-		INNER JOIN (
-			SELECT rowid AS id
-				 , bm25(torrents_idx) AS rank
-			FROM torrents_idx
-			WHERE torrents_idx MATCH ?
-		) AS idx USING(id)
-	{{ end }}
-		WHERE     modified_on <= ?
-	{{ if not .FirstPage }}
-			  AND ( {{.OrderOn}}, id ) {{GTEorLTE .Ascending}} (?, ?) -- https://www.sqlite.org/rowvalue.html#row_value_comparisons
-	{{ end }}
-		ORDER BY {{.OrderOn}} {{AscOrDesc .Ascending}}, id {{AscOrDesc .Ascending}}
-		LIMIT ?;	
-	`, struct {
-		DoJoin    bool
-		FirstPage bool
-		OrderOn   string
-		Ascending bool
-	}{
-		DoJoin:    doJoin,
-		FirstPage: firstPage,
-		OrderOn:   orderOn(orderBy),
-		Ascending: ascending,
-	}, template.FuncMap{
-		"GTEorLTE": func(ascending bool) string {
-			if ascending {
-				return ">"
-			} else {
-				return "<"
-			}
-		},
-		"AscOrDesc": func(ascending bool) string {
-			if ascending {
-				return "ASC"
-			} else {
-				return "DESC"
-			}
-		},
-	})
-
-	// Prepare query
-	queryArgs := make([]interface{}, 0)
-	if doJoin {
-		queryArgs = append(queryArgs, query)
+	if err := checkSearch(query, filters.Refinements, sqlite3CostModel, &db.breaker); err != nil {
+		return nil, err
+	}
+	if err := checkPathSearch(filters, db.pathSearch); err != nil {
+		return nil, err
+	}
+	query, filters = db.synonyms.canonicalizeSearch(query, filters)
+	if db.cjkBigrams {
+		query, filters = expandCJKSearch(query, filters)
 	}
-	queryArgs = append(queryArgs, epoch)
-	if !firstPage {
-		queryArgs = append(queryArgs, lastOrderedValue)
-		queryArgs = append(queryArgs, lastID)
+
+	sqlQuery, queryArgs, scanDests, err := searchQuery(sqlite3Dialect, db.ranking, query, epoch, orderBy, ascending, limit,
+		lastOrderedValue, lastID, filters, fields)
+	if err != nil {
+		return nil, err
 	}
-	queryArgs = append(queryArgs, limit)
 
+	startedOn := time.Now()
 	rows, err := db.conn.Query(sqlQuery, queryArgs...)
-	defer closeRows(rows)
 	if err != nil {
+		recordIfTimedOut(err, startedOn, db.conn.timeout, &db.breaker)
 		return nil, errors.Wrap(err, "query error")
 	}
+	defer closeRows(rows)
 
 	torrents := make([]TorrentMetadata, 0)
 	for rows.Next() {
 		var torrent TorrentMetadata
-		err = rows.Scan(
-			&torrent.ID,
-			&torrent.InfoHash,
-			&torrent.Name,
-			&torrent.Size,
-			&torrent.DiscoveredOn,
-			&torrent.NFiles,
-			&torrent.Relevance,
-		)
-		if err != nil {
+		if err = rows.Scan(scanDests(&torrent)...); err != nil {
 			return nil, err
 		}
 		torrents = append(torrents, torrent)
 	}
+	if err = rows.Err(); err != nil {
+		recordIfTimedOut(err, startedOn, db.conn.timeout, &db.breaker)
+		return nil, err
+	}
 
 	return torrents, nil
 }
 
-func orderOn(orderBy OrderingCriteria) string {
-	switch orderBy {
-	case ByRelevance:
-		return "idx.rank"
-
-	case ByTotalSize:
-		return "total_size"
+func (db *sqlite3Database) ExplainTorrents(
+	analyze bool,
+	query string,
+	epoch int64,
+	orderBy OrderingCriteria,
+	ascending bool,
+	limit uint,
+	lastOrderedValue *float64,
+	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
+) (*QueryPlan, error) {
+	if err := checkSearch(query, filters.Refinements, sqlite3CostModel, &db.breaker); err != nil {
+		return nil, err
+	}
+	if err := checkPathSearch(filters, db.pathSearch); err != nil {
+		return nil, err
+	}
+	query, filters = db.synonyms.canonicalizeSearch(query, filters)
+	if db.cjkBigrams {
+		query, filters = expandCJKSearch(query, filters)
+	}
 
-	case ByDiscoveredOn:
-		return "discovered_on"
+	sqlQuery, queryArgs, _, err := searchQuery(sqlite3Dialect, db.ranking, query, epoch, orderBy, ascending, limit,
+		lastOrderedValue, lastID, filters, fields)
+	if err != nil {
+		return nil, err
+	}
+	plan := &QueryPlan{SQL: sqlQuery}
 
-	case ByNFiles:
-		return "n_files"
+	rows, err := db.conn.Query("EXPLAIN QUERY PLAN "+sqlQuery, queryArgs...)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (EXPLAIN QUERY PLAN)")
+	}
+	plan.Plan, err = sqlite3Plan(rows)
+	closeRows(rows)
+	if err != nil {
+		return nil, err
+	}
 
-	default:
-		panic(fmt.Sprintf("unknown orderBy: %v", orderBy))
+	// SQLite cannot measure the steps of the plan, hence the search is measured as a whole.
+	if analyze {
+		startedOn := time.Now()
+		if plan.Elapsed, plan.Rows, err = measure(db.conn, sqlQuery, queryArgs); err != nil {
+			recordIfTimedOut(err, startedOn, db.conn.timeout, &db.breaker)
+			return nil, errors.Wrap(err, "measure")
+		}
+		plan.Analyzed = true
 	}
+
+	return plan, nil
 }
 
 func (db *sqlite3Database) GetTorrent(infoHash []byte) (*TorrentMetadata, error) {
@@ -374,24 +638,47 @@ func (db *sqlite3Database) GetTorrent(infoHash []byte) (*TorrentMetadata, error)
 			name,
 			total_size,
 			discovered_on,
-			(SELECT COUNT(*) FROM files WHERE torrent_id = torrents.id) AS n_files
+			n_files,
+			spam_score,
+			moderation,
+			source,
+			popularity,
+			text_path,
+			text_content
 		FROM torrents
 		WHERE info_hash = ?`,
 		infoHash,
 	)
-	defer closeRows(rows)
 	if err != nil {
 		return nil, err
 	}
+	defer closeRows(rows)
 
 	if !rows.Next() {
 		return nil, nil
 	}
 
 	var tm TorrentMetadata
-	if err = rows.Scan(&tm.InfoHash, &tm.Name, &tm.Size, &tm.DiscoveredOn, &tm.NFiles); err != nil {
+	var textPath, textContent sql.NullString
+	if err = rows.Scan(&tm.InfoHash, &tm.Name, &tm.Size, timeScanner{&tm.DiscoveredOn}, &tm.NFiles, &tm.SpamScore, &tm.Moderation, &tm.Source,
+		&tm.Popularity, &textPath, &textContent); err != nil {
 		return nil, err
 	}
+	if textPath.Valid {
+		tm.Text = &TorrentText{Path: textPath.String, Content: textContent.String}
+	}
+
+	files, err := db.GetFiles(infoHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetFiles")
+	}
+	tm.Extensions = ExtensionBreakdown(files)
+	if release := ParseRelease(tm.Name); release != (Release{}) {
+		tm.Release = &release
+	}
+	if album := ParseAlbum(tm.Name, files); album != (Album{}) {
+		tm.Album = &album
+	}
 
 	return &tm, nil
 }
@@ -400,10 +687,10 @@ func (db *sqlite3Database) GetFiles(infoHash []byte) ([]File, error) {
 	rows, err := db.conn.Query(
 		"SELECT size, path FROM files, torrents WHERE files.torrent_id = torrents.id AND torrents.info_hash = ?;",
 		infoHash)
-	defer closeRows(rows)
 	if err != nil {
 		return nil, err
 	}
+	defer closeRows(rows)
 
 	var files []File
 	for rows.Next() {
@@ -417,95 +704,1219 @@ func (db *sqlite3Database) GetFiles(infoHash []byte) ([]File, error) {
 	return files, nil
 }
 
-func (db *sqlite3Database) GetStatistics(from string, n uint) (*Statistics, error) {
-	fromTime, gran, err := ParseISO8601(from)
-	if err != nil {
-		return nil, errors.Wrap(err, "parsing ISO8601 error")
+func (db *sqlite3Database) GetMetadata(infoHash []byte) ([]byte, error) {
+	var metadata []byte
+	err := db.conn.QueryRow("SELECT metadata FROM torrents WHERE info_hash = ?;", infoHash).Scan(&metadata)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow")
 	}
+	if metadata == nil {
+		metadata = []byte{}
+	}
+	return metadata, nil
+}
 
-	var toTime time.Time
-	var timef string // time format: https://www.sqlite.org/lang_datefunc.html
-
-	switch gran {
-	case Year:
-		toTime = fromTime.AddDate(int(n), 0, 0)
-		timef = "%Y"
-	case Month:
-		toTime = fromTime.AddDate(0, int(n), 0)
-		timef = "%Y-%m"
-	case Week:
-		toTime = fromTime.AddDate(0, 0, int(n)*7)
-		timef = "%Y-%W"
-	case Day:
-		toTime = fromTime.AddDate(0, 0, int(n))
-		timef = "%Y-%m-%d"
-	case Hour:
-		toTime = fromTime.Add(time.Duration(n) * time.Hour)
-		timef = "%Y-%m-%dT%H"
-	}
-
-	// TODO: make it faster!
-	rows, err := db.conn.Query(fmt.Sprintf(`
-			SELECT strftime('%s', discovered_on, 'unixepoch') AS dT
-                 , sum(files.size) AS tS
-                 , count(DISTINCT torrents.id) AS nD              
-                 , count(DISTINCT files.id) AS nF
-			FROM torrents, files
- 			WHERE     torrents.id = files.torrent_id
-                  AND discovered_on >= ?
-                  AND discovered_on <= ?
-			GROUP BY dt;`,
-		timef),
-		fromTime.Unix(), toTime.Unix())
-	defer closeRows(rows)
+func (db *sqlite3Database) QueryFiles(infoHash []byte, pathContains string, offset uint, limit uint) ([]File, error) {
+	// LIKE is case-insensitive for ASCII characters in SQLite by default.
+	rows, err := db.conn.Query(`
+		SELECT files.size, files.path
+		FROM files
+		INNER JOIN torrents ON files.torrent_id = torrents.id
+		WHERE     torrents.info_hash = ?
+		      AND files.path LIKE ? ESCAPE '\'
+		ORDER BY files.id
+		LIMIT ? OFFSET ?;`,
+		infoHash, "%"+escapeLike(pathContains)+"%", limit, offset,
+	)
 	if err != nil {
 		return nil, err
 	}
+	defer closeRows(rows)
 
-	stats := NewStatistics()
-
+	files := make([]File, 0)
 	for rows.Next() {
-		var dT string
-		var tS, nD, nF uint64
-		if err := rows.Scan(&dT, &tS, &nD, &nF); err != nil {
-			if err := rows.Close(); err != nil {
-				panic(err.Error())
-			}
+		var file File
+		if err = rows.Scan(&file.Size, &file.Path); err != nil {
 			return nil, err
 		}
-		stats.NDiscovered[dT] = nD
-		stats.TotalSize[dT] = tS
-		stats.NFiles[dT] = nF
+		files = append(files, file)
 	}
 
-	return stats, nil
+	return files, nil
 }
 
-func (db *sqlite3Database) setupDatabase() error {
-	// Enable Write-Ahead Logging for SQLite as "WAL provides more concurrency as readers do not
-	// block writers and a writer does not block readers. Reading and writing can proceed
-	// concurrently."
-	// Caveats:
-	//   * Might be unsupported by OSes other than Windows and UNIXes.
-	//   * Does not work over a network filesystem.
-	//   * Transactions that involve changes against multiple ATTACHed databases are not atomic
-	//     across all databases as a set.
-	// See: https://www.sqlite.org/wal.html
-	//
-	// Force SQLite to use disk, instead of memory, for all temporary files to reduce the memory
-	// footprint.
-	//
-	// Enable foreign key constraints in SQLite which are crucial to prevent programmer errors on
-	// our side.
-	_, err := db.conn.Exec(`
-		PRAGMA journal_mode=WAL;
-		PRAGMA temp_store=1;
-		PRAGMA foreign_keys=ON;
-		PRAGMA encoding='UTF-8';
-	`)
+func (db *sqlite3Database) GetFileTree(infoHash []byte) (*FileTreeNode, error) {
+	files, err := db.GetFiles(infoHash)
 	if err != nil {
-		return errors.Wrap(err, "sql.DB.Exec (PRAGMAs)")
-	}
+		return nil, err
+	} else if files == nil {
+		return nil, nil
+	}
+
+	return NewFileTree(files), nil
+}
+
+func (db *sqlite3Database) GetStatistics(from string, n uint, loc *time.Location) (*Statistics, error) {
+	fromTime, gran, err := ParseISO8601(from)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing ISO8601 error")
+	}
+	if n > MaxStatisticsPeriods {
+		return nil, fmt.Errorf("n must be at most %d", MaxStatisticsPeriods)
+	}
+	buckets := statisticsBuckets(InLocation(*fromTime, loc), gran, n)
+	if len(buckets) == 0 {
+		return NewStatistics(), nil
+	}
+
+	// The torrents of each bucket are read using discovered_on_index.
+	return parallelStatistics(buckets, db.statisticsWorkers(), func(buckets []bucket) (*timedRows, error) {
+		return db.conn.Query(`
+			WITH buckets (i, start_on, end_on) AS (` + bucketsValues(buckets, "%d") + `)
+			SELECT buckets.i
+				 , IFNULL(SUM(files.size), 0)
+				 , COUNT(DISTINCT torrents.id)
+				 , COUNT(files.id)
+			FROM buckets
+			INNER JOIN torrents ON torrents.discovered_on >= buckets.start_on AND torrents.discovered_on < buckets.end_on
+			INNER JOIN files ON files.torrent_id = torrents.id
+			GROUP BY buckets.i;`,
+		)
+	})
+}
+
+// statisticsWorkers returns the number of the queries of GetStatistics that can be run
+// concurrently, which is one in a transaction.
+func (db *sqlite3Database) statisticsWorkers() int {
+	if db.conn.tx != nil {
+		return 1
+	}
+	return statisticsWorkers
+}
+
+func (db *sqlite3Database) GetDashboard(from int64) (*Dashboard, error) {
+	dashboard := newDashboard()
+
+	err := db.conn.QueryRow(
+		"SELECT COUNT(*), IFNULL(MAX(discovered_on), 0) FROM torrents WHERE discovered_on >= ?;",
+		from,
+	).Scan(&dashboard.NDiscovered, &dashboard.LastDiscoveredOn)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow (totals)")
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT `+sizeBucketCase()+` AS bucket, COUNT(*)
+		FROM torrents
+		WHERE discovered_on >= ?
+		GROUP BY bucket;`,
+		from,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (size distribution)")
+	}
+	for rows.Next() {
+		var bucket int
+		var n uint64
+		if err = rows.Scan(&bucket, &n); err != nil {
+			closeRows(rows)
+			return nil, err
+		}
+		dashboard.SizeDistribution[bucket].NTorrents = n
+	}
+	if err = rows.Err(); err != nil {
+		closeRows(rows)
+		return nil, errors.Wrap(err, "sql.Rows.Err (size distribution)")
+	}
+	closeRows(rows)
+
+	rows, err = db.conn.Query(
+		"SELECT category, COUNT(*) FROM torrents WHERE discovered_on >= ? GROUP BY category;",
+		from,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (categories)")
+	}
+	for rows.Next() {
+		var category Category
+		var n uint64
+		if err = rows.Scan(&category, &n); err != nil {
+			closeRows(rows)
+			return nil, err
+		}
+		dashboard.Categories[category] = n
+	}
+	if err = rows.Err(); err != nil {
+		closeRows(rows)
+		return nil, errors.Wrap(err, "sql.Rows.Err (categories)")
+	}
+	closeRows(rows)
+
+	rows, err = db.conn.Query(
+		"SELECT source, COUNT(*) FROM torrents WHERE discovered_on >= ? GROUP BY source;",
+		from,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (sources)")
+	}
+	for rows.Next() {
+		var source Source
+		var n uint64
+		if err = rows.Scan(&source, &n); err != nil {
+			closeRows(rows)
+			return nil, err
+		}
+		dashboard.Sources[source] = n
+	}
+	if err = rows.Err(); err != nil {
+		closeRows(rows)
+		return nil, errors.Wrap(err, "sql.Rows.Err (sources)")
+	}
+	closeRows(rows)
+
+	rows, err = db.conn.Query(`
+		SELECT discoveries.peer_country, COUNT(*)
+		FROM discoveries
+		INNER JOIN torrents ON torrents.id = discoveries.torrent_id
+		WHERE torrents.discovered_on >= ? AND discoveries.peer_country IS NOT NULL
+		GROUP BY discoveries.peer_country;`,
+		from,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (countries)")
+	}
+	for rows.Next() {
+		var country string
+		var n uint64
+		if err = rows.Scan(&country, &n); err != nil {
+			closeRows(rows)
+			return nil, err
+		}
+		dashboard.Countries[country] = n
+	}
+	if err = rows.Err(); err != nil {
+		closeRows(rows)
+		return nil, errors.Wrap(err, "sql.Rows.Err (countries)")
+	}
+	closeRows(rows)
+
+	rows, err = db.conn.Query(`
+		SELECT files.path, files.size
+		FROM files
+		WHERE files.torrent_id IN (
+			SELECT id FROM torrents WHERE discovered_on >= ? ORDER BY discovered_on DESC LIMIT ?
+		);`,
+		from, dashboardFileSample,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (extensions)")
+	}
+	dashboard.TopExtensions, err = countExtensions(rows)
+	closeRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return dashboard, nil
+}
+
+func (db *sqlite3Database) GetFacets(query string, epoch int64, filters QueryFilters) (*Facets, error) {
+	if err := checkSearch(query, filters.Refinements, sqlite3CostModel, &db.breaker); err != nil {
+		return nil, err
+	}
+	if err := checkPathSearch(filters, db.pathSearch); err != nil {
+		return nil, err
+	}
+	query, filters = db.synonyms.canonicalizeSearch(query, filters)
+	if db.cjkBigrams {
+		query, filters = expandCJKSearch(query, filters)
+	}
+	facets := newFacets()
+
+	q := facetsQuery(sqlite3Dialect, query, epoch, filters)
+	matches, matchesArgs, err := q.build()
+	if err != nil {
+		return nil, errors.Wrap(err, "queryBuilder.build")
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT category
+			 , CAST(strftime('%Y', discovered_on, 'unixepoch') AS INTEGER) AS year
+			 , `+sizeBucketCase()+` AS bucket
+			 , COUNT(*)
+		FROM (`+matches+`)
+		GROUP BY category, year, bucket;`,
+		matchesArgs...,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (counts)")
+	}
+	err = facets.scanCounts(rows)
+	closeRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = db.conn.Query(`
+		SELECT files.path, files.size
+		FROM files
+		WHERE files.torrent_id IN (
+			SELECT id FROM (`+matches+`) ORDER BY discovered_on DESC LIMIT `+q.arg(facetFileSample)+`
+		);`,
+		q.args...,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (extensions)")
+	}
+	facets.TopExtensions, err = countExtensions(rows)
+	closeRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if facets.TopArtists, facets.TopAlbums, err = countAlbums(db.conn, matches, matchesArgs); err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
+
+func (db *sqlite3Database) GetPoolStats() (*PoolStats, error) {
+	return newPoolStats(db.conn.Stats()), nil
+}
+
+func (db *sqlite3Database) RefreshSynonyms() (uint64, error) {
+	tx, err := db.conn.unlimited().Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	n, err := refreshSynonyms(tx, sqlite3Dialect, db.synonyms)
+	if err != nil {
+		return 0, errors.Wrap(err, "refreshSynonyms")
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "tx.Commit")
+	}
+	return n, nil
+}
+
+func (db *sqlite3Database) AdviseIndexes(queries []QueryStat, create bool) ([]IndexAdvice, error) {
+	schema := newIndexSchema()
+	rows, err := db.conn.Query(`
+		SELECT m.name, c.name, c.pk, c.type
+		FROM sqlite_master AS m, pragma_table_info(m.name) AS c
+		WHERE m.type = 'table';`)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (pragma_table_info)")
+	}
+	defer closeRows(rows)
+	for rows.Next() {
+		var table, column, type_ string
+		var pk int
+		if err = rows.Scan(&table, &column, &pk, &type_); err != nil {
+			return nil, errors.Wrap(err, "sql.Rows.Scan (pragma_table_info)")
+		}
+		schema.addColumn(table, column)
+		// The INTEGER PRIMARY KEY is the alias of the ROWID, which is not listed as an index.
+		if pk == 1 && strings.EqualFold(type_, "INTEGER") {
+			schema.addIndex(table, column, false)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "sql.Rows.Err (pragma_table_info)")
+	}
+
+	rows, err = db.conn.Query(`
+		SELECT m.name, i.name
+		FROM sqlite_master AS m, pragma_index_list(m.name) AS l, pragma_index_info(l.name) AS i
+		WHERE m.type = 'table' AND i.seqno = 0;`)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (pragma_index_info)")
+	}
+	defer closeRows(rows)
+	for rows.Next() {
+		var table string
+		var column sql.NullString // NULL if the index is on an expression
+		if err = rows.Scan(&table, &column); err != nil {
+			return nil, errors.Wrap(err, "sql.Rows.Scan (pragma_index_info)")
+		}
+		if column.Valid {
+			schema.addIndex(table, column.String, false)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "sql.Rows.Err (pragma_index_info)")
+	}
+
+	// SQLite has no trigram indices, and its statements are known only from the slow-query log.
+	advices := adviseIndexes(queries, schema, false)
+	if create {
+		for _, advice := range advices {
+			// The indices of the large tables take longer than the queries are limited to.
+			if _, err = db.conn.DB.Exec(advice.DDL); err != nil {
+				return nil, errors.Wrapf(err, "sql.DB.Exec (%s)", advice.DDL)
+			}
+		}
+	}
+	return advices, nil
+}
+
+func (db *sqlite3Database) GetStorageReport() (*StorageReport, error) {
+	report := new(StorageReport)
+
+	var pageCount, pageSize uint64
+	if err := db.conn.QueryRow("PRAGMA page_count;").Scan(&pageCount); err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow (PRAGMA page_count)")
+	}
+	if err := db.conn.QueryRow("PRAGMA page_size;").Scan(&pageSize); err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow (PRAGMA page_size)")
+	}
+	report.TotalBytes = pageCount * pageSize
+
+	// SQLite does not report the sizes of the tables (unless it is compiled with the dbstat virtual
+	// table), hence the size of the database is apportioned by the sizes of their latest rows.
+	var estimates []float64
+	for _, table := range []struct {
+		name    string
+		rowSize string
+	}{
+		{"torrents", "length(info_hash) + length(name) + length(metadata)"},
+		{"files", "length(path)"},
+	} {
+		storage := TableStorage{Name: table.name}
+		var rowSize float64
+		// MAX(ROWID) is an approximation of the number of the rows (see GetNumberOfTorrents).
+		err := db.conn.QueryRow(fmt.Sprintf(`
+			SELECT IFNULL(MAX(ROWID), 0)
+				 , (SELECT IFNULL(AVG(%s), 0) FROM (SELECT * FROM %s ORDER BY ROWID DESC LIMIT 1000))
+			FROM %s;`,
+			table.rowSize, table.name, table.name,
+		)).Scan(&storage.Rows, &rowSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "sql.DB.QueryRow (%s)", table.name)
+		}
+		report.Tables = append(report.Tables, storage)
+		estimates = append(estimates, float64(storage.Rows)*rowSize)
+	}
+	report.apportion(estimates)
+
+	now := time.Now()
+	var nDiscovered uint64
+	var oldest int64
+	err := db.conn.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM torrents WHERE discovered_on >= ?)
+			 , (SELECT IFNULL(MIN(discovered_on), 0) FROM torrents);`,
+		now.Add(-growthWindow).Unix(),
+	).Scan(&nDiscovered, &oldest)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow (growth)")
+	}
+
+	if report.FreeBytes, err = diskFree(db.dir); err != nil {
+		zap.L().Named("persistence").Warn("Could not get the free space of the disk", zap.String("dir", db.dir),
+			zap.Error(err))
+	}
+	report.project(report.Tables[0].Rows, nDiscovered, growthPeriod(oldest, now), now)
+
+	return report, nil
+}
+
+func (db *sqlite3Database) ReportTorrent(infoHash []byte, reason string) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO reports (torrent_id, reason, reported_on)
+		SELECT id, ?, ? FROM torrents WHERE info_hash = ?;`,
+		reason, now().Unix(), infoHash,
+	)
+	return err
+}
+
+func (db *sqlite3Database) GetModerationQueue(limit uint) ([]ModerationQueueItem, error) {
+	rows, err := db.conn.Query(`
+		SELECT torrents.info_hash
+			 , torrents.name
+			 , torrents.moderation
+			 , COUNT(*)
+			 , MAX(reports.reported_on) AS last_reported_on
+			 , (SELECT reason FROM reports AS r WHERE r.torrent_id = torrents.id ORDER BY r.id DESC LIMIT 1)
+		FROM reports
+		INNER JOIN torrents ON reports.torrent_id = torrents.id
+		GROUP BY torrents.id
+		ORDER BY last_reported_on DESC, torrents.id DESC
+		LIMIT ?;`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	items := make([]ModerationQueueItem, 0)
+	for rows.Next() {
+		var item ModerationQueueItem
+		err = rows.Scan(&item.InfoHash, &item.Name, &item.Moderation, &item.NReports, &item.LastReportedOn,
+			&item.LastReason)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (db *sqlite3Database) SetModerationState(infoHash []byte, state ModerationState) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "conn.Begin")
+	}
+	// If everything goes as planned and no error occurs, we will commit the transaction before
+	// returning from the function so the tx.Rollback() call will fail, trying to rollback a
+	// committed transaction. BUT, if an error occurs, we'll get our transaction rollback'ed, which
+	// is nice.
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE torrents SET moderation = ? WHERE info_hash = ?;", state, infoHash)
+	if err != nil {
+		return false, errors.Wrap(err, "tx.Exec (UPDATE torrents)")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	} else if n == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(
+		"DELETE FROM reports WHERE torrent_id = (SELECT id FROM torrents WHERE info_hash = ?);",
+		infoHash,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "tx.Exec (DELETE FROM reports)")
+	}
+
+	if state == Flagged {
+		_, err = tx.Exec("DELETE FROM recent_torrents WHERE info_hash = ?;", infoHash)
+		if err != nil {
+			return false, errors.Wrap(err, "tx.Exec (DELETE FROM recent_torrents)")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "tx.Commit")
+	}
+
+	return true, nil
+}
+
+func (db *sqlite3Database) RequestTorrent(infoHash []byte) (*TorrentRequest, error) {
+	_, err := db.conn.Exec(`
+		INSERT INTO requests (info_hash, status, requested_on)
+		VALUES (?, CASE WHEN EXISTS (SELECT 1 FROM torrents WHERE info_hash = ?) THEN ? ELSE ? END, ?)
+		ON CONFLICT (info_hash) DO UPDATE
+			SET status = excluded.status, attempts = 0, requested_on = excluded.requested_on, last_attempted_on = 0
+			WHERE requests.status = ?;`,
+		infoHash, infoHash, RequestFetched, RequestPending, now().Unix(), RequestFailed,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Exec (INSERT INTO requests)")
+	}
+
+	return db.GetTorrentRequest(infoHash)
+}
+
+func (db *sqlite3Database) GetTorrentRequest(infoHash []byte) (*TorrentRequest, error) {
+	var request TorrentRequest
+	err := db.conn.QueryRow(`
+		SELECT info_hash, status, attempts, requested_on, last_attempted_on
+		FROM requests
+		WHERE info_hash = ?;`,
+		infoHash,
+	).Scan(&request.InfoHash, &request.Status, &request.Attempts, &request.RequestedOn, &request.LastAttemptedOn)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+func (db *sqlite3Database) GetPendingTorrentRequests(limit uint) ([]TorrentRequest, error) {
+	rows, err := db.conn.Query(`
+		SELECT info_hash, status, attempts, requested_on, last_attempted_on
+		FROM requests
+		WHERE status IN (?, ?)
+		ORDER BY last_attempted_on, requested_on
+		LIMIT ?;`,
+		RequestPending, RequestLookingUp, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	requests := make([]TorrentRequest, 0)
+	for rows.Next() {
+		var request TorrentRequest
+		if err = rows.Scan(&request.InfoHash, &request.Status, &request.Attempts, &request.RequestedOn,
+			&request.LastAttemptedOn); err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+
+	return requests, rows.Err()
+}
+
+func (db *sqlite3Database) UpdateTorrentRequest(infoHash []byte, status RequestStatus) error {
+	_, err := db.conn.Exec(`
+		UPDATE requests
+		SET status = ?
+		  , attempts = attempts + (CASE WHEN ? THEN 1 ELSE 0 END)
+		  , last_attempted_on = (CASE WHEN ? THEN ? ELSE last_attempted_on END)
+		WHERE info_hash = ?;`,
+		status, status == RequestLookingUp, status == RequestLookingUp, now().Unix(), infoHash,
+	)
+	return err
+}
+
+func (db *sqlite3Database) AddFavorite(username string, infoHash []byte) (bool, error) {
+	// The no-op update counts the favorites that exist already as added.
+	res, err := db.conn.Exec(`
+		INSERT INTO favorites (username, torrent_id, favorited_on)
+		SELECT ?, id, ? FROM torrents
+		WHERE info_hash = ? AND (SELECT COUNT(*) FROM favorites WHERE username = ?) < ?
+		ON CONFLICT (username, torrent_id) DO UPDATE SET favorited_on = favorites.favorited_on;`,
+		username, now().Unix(), infoHash, username, MaxFavorites,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (INSERT INTO favorites)")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	} else if n == 0 {
+		// The favorites that exist already are not added if the user has MaxFavorites of them.
+		return db.IsFavorite(username, infoHash)
+	}
+	return true, nil
+}
+
+func (db *sqlite3Database) RemoveFavorite(username string, infoHash []byte) (bool, error) {
+	res, err := db.conn.Exec(`
+		DELETE FROM favorites
+		WHERE username = ? AND torrent_id = (SELECT id FROM torrents WHERE info_hash = ?);`,
+		username, infoHash,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (DELETE FROM favorites)")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	}
+	return n > 0, nil
+}
+
+func (db *sqlite3Database) IsFavorite(username string, infoHash []byte) (bool, error) {
+	var exists bool
+	err := db.conn.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM favorites
+			INNER JOIN torrents ON torrents.id = favorites.torrent_id
+			WHERE favorites.username = ? AND torrents.info_hash = ?
+		);`,
+		username, infoHash,
+	).Scan(&exists)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.QueryRow")
+	}
+	return exists, nil
+}
+
+func (db *sqlite3Database) GetFavorites(username string, limit uint) ([]Favorite, error) {
+	rows, err := db.conn.Query(`
+		SELECT
+			torrents.id,
+			torrents.info_hash,
+			torrents.name,
+			torrents.total_size,
+			torrents.discovered_on,
+			torrents.n_files,
+			torrents.spam_score,
+			torrents.moderation,
+			favorites.favorited_on
+		FROM favorites
+		INNER JOIN torrents ON torrents.id = favorites.torrent_id
+		WHERE favorites.username = ? AND torrents.moderation <> ?
+		ORDER BY favorites.favorited_on DESC, torrents.id DESC
+		LIMIT ?;`,
+		username, Flagged, limit,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (SELECT FROM favorites)")
+	}
+	defer closeRows(rows)
+
+	favorites := make([]Favorite, 0)
+	for rows.Next() {
+		var favorite Favorite
+		tm := &favorite.Torrent
+		var discoveredOn int64 // see GetRecentTorrents
+		if err = rows.Scan(&tm.ID, &tm.InfoHash, &tm.Name, &tm.Size, &discoveredOn, &tm.NFiles, &tm.SpamScore,
+			&tm.Moderation, &favorite.FavoritedOn); err != nil {
+			return nil, err
+		}
+		tm.DiscoveredOn = fromUnix(discoveredOn)
+		favorites = append(favorites, favorite)
+	}
+
+	return favorites, rows.Err()
+}
+
+func (db *sqlite3Database) AddInteraction(infoHash []byte, interaction Interaction, on int64) (bool, error) {
+	column, err := interactionColumn(interaction)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	var id uint64
+	if err = tx.QueryRow("SELECT id FROM torrents WHERE info_hash = ?;", infoHash).Scan(&id); err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "tx.QueryRow (SELECT FROM torrents)")
+	}
+	if _, err = tx.Exec("UPDATE torrents SET popularity = popularity + 1 WHERE id = ?;", id); err != nil {
+		return false, errors.Wrap(err, "tx.Exec (UPDATE torrents)")
+	}
+
+	// The column is one of interactionColumn, never an input.
+	_, err = tx.Exec(`
+		INSERT INTO interactions (torrent_id, day, `+column+`)
+		VALUES (?, ?, 1)
+		ON CONFLICT (torrent_id, day) DO UPDATE SET `+column+` = `+column+` + 1;`,
+		id, interactionDay(on),
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "tx.Exec (INSERT INTO interactions)")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "tx.Commit")
+	}
+	return true, nil
+}
+
+func (db *sqlite3Database) GetInteractions(infoHash []byte, from int64) ([]Interactions, error) {
+	rows, err := db.conn.Query(`
+		SELECT interactions.day, interactions.n_magnets, interactions.n_downloads
+		FROM interactions
+		INNER JOIN torrents ON torrents.id = interactions.torrent_id
+		WHERE torrents.info_hash = ? AND interactions.day >= ?
+		ORDER BY interactions.day ASC;`,
+		infoHash, interactionDay(from),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (SELECT FROM interactions)")
+	}
+	defer closeRows(rows)
+
+	interactions := make([]Interactions, 0)
+	for rows.Next() {
+		var i Interactions
+		if err = rows.Scan(&i.Day, &i.NMagnets, &i.NDownloads); err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, i)
+	}
+
+	return interactions, rows.Err()
+}
+
+func (db *sqlite3Database) AddAPIKey(name string, keyHash []byte, limits APIKeyLimits, createdOn int64) (uint64, error) {
+	res, err := db.conn.Exec(`
+		INSERT INTO api_keys (name, key_hash, requests_per_minute, rows_per_day, created_on)
+		VALUES (?, ?, ?, ?, ?);`,
+		name, keyHash, limits.RequestsPerMinute, limits.RowsPerDay, createdOn,
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "sql.DB.Exec (INSERT INTO api_keys)")
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, errors.Wrap(err, "sql.Result.LastInsertId")
+	}
+	return uint64(id), nil
+}
+
+func (db *sqlite3Database) GetAPIKey(keyHash []byte, on int64) (*APIKey, error) {
+	rows, err := db.conn.Query(`
+		SELECT api_keys.id, api_keys.name, api_keys.requests_per_minute, api_keys.rows_per_day,
+			api_keys.created_on, IFNULL(api_keys.revoked_on, 0),
+			IFNULL(api_key_usage.n_requests, 0), IFNULL(api_key_usage.n_rows, 0)
+		FROM api_keys
+		LEFT JOIN api_key_usage ON api_key_usage.api_key_id = api_keys.id AND api_key_usage.day = ?
+		WHERE api_keys.key_hash = ?;`,
+		apiKeyUsageDay(on), keyHash,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (SELECT FROM api_keys)")
+	}
+	defer closeRows(rows)
+
+	keys, err := scanAPIKeys(rows)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	return &keys[0], nil
+}
+
+func (db *sqlite3Database) GetAPIKeys(on int64) ([]APIKey, error) {
+	rows, err := db.conn.Query(`
+		SELECT api_keys.id, api_keys.name, api_keys.requests_per_minute, api_keys.rows_per_day,
+			api_keys.created_on, IFNULL(api_keys.revoked_on, 0),
+			IFNULL(api_key_usage.n_requests, 0), IFNULL(api_key_usage.n_rows, 0)
+		FROM api_keys
+		LEFT JOIN api_key_usage ON api_key_usage.api_key_id = api_keys.id AND api_key_usage.day = ?
+		ORDER BY api_keys.created_on DESC, api_keys.id DESC;`,
+		apiKeyUsageDay(on),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query (SELECT FROM api_keys)")
+	}
+	defer closeRows(rows)
+
+	return scanAPIKeys(rows)
+}
+
+func (db *sqlite3Database) UpdateAPIKey(id uint64, limits APIKeyLimits) (bool, error) {
+	res, err := db.conn.Exec(`
+		UPDATE api_keys SET requests_per_minute = ?, rows_per_day = ? WHERE id = ?;`,
+		limits.RequestsPerMinute, limits.RowsPerDay, id,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (UPDATE api_keys)")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	}
+	return n > 0, nil
+}
+
+func (db *sqlite3Database) RevokeAPIKey(id uint64, on int64) (bool, error) {
+	res, err := db.conn.Exec(`
+		UPDATE api_keys SET revoked_on = ? WHERE id = ? AND revoked_on IS NULL;`,
+		on, id,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (UPDATE api_keys)")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	}
+	return n > 0, nil
+}
+
+func (db *sqlite3Database) AddAPIKeyUsage(id uint64, nRequests uint64, nRows uint64, on int64) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO api_key_usage (api_key_id, day, n_requests, n_rows)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (api_key_id, day) DO UPDATE SET
+			n_requests = n_requests + excluded.n_requests,
+			n_rows     = n_rows + excluded.n_rows;`,
+		id, apiKeyUsageDay(on), nRequests, nRows,
+	)
+	if err != nil {
+		return errors.Wrap(err, "sql.DB.Exec (INSERT INTO api_key_usage)")
+	}
+	return nil
+}
+
+func (db *sqlite3Database) AddSightings(sightings []Sighting, on int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	hour := sightingHour(on)
+	for _, sighting := range sightings {
+		_, err = tx.Exec(`
+			INSERT INTO sightings (torrent_id, hour, count)
+			SELECT id, ?, ? FROM torrents WHERE info_hash = ?
+			ON CONFLICT (torrent_id, hour) DO UPDATE SET count = count + excluded.count;`,
+			hour, sighting.Count, sighting.InfoHash,
+		)
+		if err != nil {
+			return errors.Wrap(err, "tx.Exec (INSERT INTO sightings)")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "tx.Commit")
+	}
+	return nil
+}
+
+func (db *sqlite3Database) UpdateTrending(since int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "conn.Begin")
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM sightings WHERE hour < ?;", sightingHour(since)); err != nil {
+		return errors.Wrap(err, "tx.Exec (DELETE FROM sightings)")
+	}
+	if _, err = tx.Exec("DELETE FROM trending;"); err != nil {
+		return errors.Wrap(err, "tx.Exec (DELETE FROM trending)")
+	}
+	_, err = tx.Exec(`
+		INSERT INTO trending (torrent_id, sightings)
+		SELECT torrent_id, SUM(count) AS total
+		FROM sightings
+		GROUP BY torrent_id
+		ORDER BY total DESC
+		LIMIT ?;`,
+		MaxTrendingTorrents,
+	)
+	if err != nil {
+		return errors.Wrap(err, "tx.Exec (INSERT INTO trending)")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "tx.Commit")
+	}
+	return nil
+}
+
+func (db *sqlite3Database) GetTrendingTorrents(limit uint) ([]TorrentMetadata, error) {
+	rows, err := db.conn.Query(`
+		SELECT
+			torrents.id,
+			torrents.info_hash,
+			torrents.name,
+			torrents.total_size,
+			torrents.discovered_on,
+			torrents.n_files,
+			torrents.spam_score,
+			trending.sightings
+		FROM trending
+		INNER JOIN torrents ON torrents.id = trending.torrent_id
+		WHERE torrents.moderation <> ?
+		ORDER BY trending.sightings DESC, torrents.id DESC
+		LIMIT ?;`,
+		Flagged, limit,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "conn.Query (SELECT FROM trending)")
+	}
+	defer closeRows(rows)
+
+	torrents := make([]TorrentMetadata, 0)
+	for rows.Next() {
+		var tm TorrentMetadata
+		var discoveredOn int64 // see GetRecentTorrents
+		if err = rows.Scan(&tm.ID, &tm.InfoHash, &tm.Name, &tm.Size, &discoveredOn, &tm.NFiles, &tm.SpamScore,
+			&tm.Sightings); err != nil {
+			return nil, err
+		}
+		tm.DiscoveredOn = fromUnix(discoveredOn)
+		torrents = append(torrents, tm)
+	}
+
+	return torrents, rows.Err()
+}
+
+func (db *sqlite3Database) AddCrawlerStats(stats CrawlerStats) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO crawler_stats (hour, n_trawled, n_fetched)
+		VALUES (?, ?, ?)
+		ON CONFLICT (hour) DO UPDATE SET
+			n_trawled = n_trawled + excluded.n_trawled,
+			n_fetched = n_fetched + excluded.n_fetched;`,
+		sightingHour(stats.Hour), stats.NTrawled, stats.NFetched,
+	)
+	if err != nil {
+		return errors.Wrap(err, "sql.DB.Exec (INSERT INTO crawler_stats)")
+	}
+	return nil
+}
+
+func (db *sqlite3Database) GetCrawlerStats(from int64) ([]CrawlerStats, error) {
+	if earliest := time.Now().Add(-MaxCrawlerStatsWindow).Unix(); from < earliest {
+		from = earliest
+	}
+	rows, err := db.conn.Query(`
+		SELECT hour, n_trawled, n_fetched
+		FROM crawler_stats
+		WHERE hour >= ?
+		ORDER BY hour;`, sightingHour(from))
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.Query")
+	}
+	defer closeRows(rows)
+
+	stats := make([]CrawlerStats, 0)
+	for rows.Next() {
+		var s CrawlerStats
+		if err = rows.Scan(&s.Hour, &s.NTrawled, &s.NFetched); err != nil {
+			return nil, errors.Wrap(err, "sql.Rows.Scan")
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+func (db *sqlite3Database) AddDiscovery(infoHash []byte, discovery Discovery) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO discoveries (torrent_id, discovered_on_ms, peer_ip, peer_port, peer_country)
+		SELECT id, ?, ?, ?, ? FROM torrents WHERE info_hash = ?
+		ON CONFLICT (torrent_id) DO NOTHING;`,
+		discovery.On.UnixNano()/int64(time.Millisecond), discovery.peerIP(), discovery.peerPort(),
+		discovery.country(), infoHash,
+	)
+	return err
+}
+
+func (db *sqlite3Database) SetText(infoHash []byte, text TorrentText) error {
+	if len(text.Content) > MaxTextSize {
+		return fmt.Errorf("the text is larger than %d bytes", MaxTextSize)
+	}
+	// The full-text index of the text is updated by the torrents_idx_au_t trigger.
+	_, err := db.conn.Exec("UPDATE torrents SET text_path = ?, text_content = ? WHERE info_hash = ?;",
+		text.Path, text.Content, infoHash)
+	return err
+}
+
+func (db *sqlite3Database) ClaimFetch(infoHash []byte, claimant string, ttl time.Duration) (bool, error) {
+	claimedOn := now()
+	expiredOn := claimedOn.Add(-ttl).Unix()
+	if _, err := db.conn.Exec("DELETE FROM fetch_claims WHERE claimed_on < ?;", expiredOn); err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (DELETE FROM fetch_claims)")
+	}
+	// The claim is taken over only if it is expired (should it be not deleted yet), or if it is of
+	// the same claimant; else nothing is upserted.
+	res, err := db.conn.Exec(`
+		INSERT INTO fetch_claims (info_hash, claimant, claimed_on) VALUES (?, ?, ?)
+		ON CONFLICT (info_hash) DO UPDATE SET claimant = excluded.claimant, claimed_on = excluded.claimed_on
+		WHERE fetch_claims.claimed_on < ? OR fetch_claims.claimant = excluded.claimant;`,
+		infoHash, claimant, claimedOn.Unix(), expiredOn)
+	if err != nil {
+		return false, errors.Wrap(err, "sql.DB.Exec (INSERT INTO fetch_claims)")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected")
+	}
+	return n == 1, nil
+}
+
+// AcquireSlot is not implemented, as the instances that share an SQLite database are on the same
+// host, where there is no need for them to partition their work.
+func (db *sqlite3Database) AcquireSlot(n int) (Slot, error) {
+	return nil, NotImplementedError
+}
+
+func (db *sqlite3Database) LogSearch(entry SearchLogEntry) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO search_log (client_hash, query, n_results, latency_ms, searched_on)
+		VALUES (?, ?, ?, ?, ?);`,
+		entry.ClientHash, entry.Query, entry.NResults, entry.LatencyMs, entry.SearchedOn,
+	)
+	return err
+}
+
+func (db *sqlite3Database) GetSearchAnalytics(since int64, limit uint) (*SearchAnalytics, error) {
+	analytics := new(SearchAnalytics)
+
+	err := db.conn.QueryRow(
+		"SELECT COUNT(*), COUNT(DISTINCT client_hash) FROM search_log WHERE searched_on >= ?;",
+		since,
+	).Scan(&analytics.NSearches, &analytics.NClients)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.DB.QueryRow (totals)")
+	}
+
+	for _, list := range []struct {
+		having string
+		stats  *[]QueryStats
+	}{
+		{"", &analytics.TopQueries},
+		{"HAVING MAX(n_results) = 0", &analytics.ZeroResultQueries},
+	} {
+		rows, err := db.conn.Query(`
+			SELECT query
+				 , COUNT(*) AS n_searches
+				 , COUNT(DISTINCT client_hash)
+				 , AVG(n_results)
+				 , AVG(latency_ms)
+				 , MAX(searched_on)
+			FROM search_log
+			WHERE searched_on >= ?
+			GROUP BY query
+			`+list.having+`
+			ORDER BY n_searches DESC, query ASC
+			LIMIT ?;`,
+			since, limit,
+		)
+		if err != nil {
+			return nil, err
+		}
+		*list.stats, err = scanQueryStats(rows)
+		closeRows(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return analytics, nil
+}
+
+func (db *sqlite3Database) PurgeSearchLog(before int64) error {
+	_, err := db.conn.Exec("DELETE FROM search_log WHERE searched_on < ?;", before)
+	return err
+}
+
+func (db *sqlite3Database) GetSuggestions(prefix string, limit uint) ([]string, error) {
+	// LIKE is case-insensitive for ASCII characters in SQLite by default.
+	rows, err := db.conn.Query(`
+		SELECT query
+		FROM search_log
+		WHERE query LIKE ? ESCAPE '\'
+		GROUP BY query
+		HAVING MAX(n_results) > 0
+		ORDER BY COUNT(*) DESC, query ASC
+		LIMIT ?;`,
+		escapeLike(prefix)+"%", limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	suggestions, err := appendSuggestions(make([]string, 0), rows, limit)
+	closeRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if uint(len(suggestions)) >= limit {
+		return suggestions, nil
+	}
+
+	// The prefix is searched as a phrase whose last term is a prefix, see "3.5. FTS5 Prefix
+	// Queries" in https://sqlite.org/fts5.html
+	rows, err = db.conn.Query(`
+		SELECT torrents.name
+		FROM torrents_idx
+		INNER JOIN torrents ON torrents_idx.rowid = torrents.id
+		WHERE     torrents_idx MATCH ?
+			  AND torrents.moderation <> ?
+		ORDER BY torrents_idx.rank
+		LIMIT ?;`,
+		`"`+strings.ReplaceAll(prefix, `"`, `""`)+`" *`, Flagged, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	return appendSuggestions(suggestions, rows, limit)
+}
+
+func (db *sqlite3Database) GetCorrections(query string, limit uint) ([]string, error) {
+	return correctQuery(query, limit, db.correctWord)
+}
+
+// correctWord returns the correction of the word if it does not appear in any of the torrent
+// names, or an empty string if it does or if there are no words close enough to it.
+//
+// The corrections are the words of the names as they are (see torrents_words), not the stemmed
+// terms of the full-text index.
+func (db *sqlite3Database) correctWord(word string) (string, error) {
+	if maxEditDistance(word) == 0 {
+		return "", nil
+	}
+
+	var exists bool
+	err := db.conn.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM torrents_idx WHERE torrents_idx MATCH ?);",
+		`"`+word+`"`,
+	).Scan(&exists)
+	if err != nil {
+		return "", errors.Wrap(err, "sql.DB.QueryRow (torrents_idx)")
+	} else if exists {
+		return "", nil
+	}
+
+	// Scanning the whole vocabulary would be too expensive, so only the terms that start with the
+	// same character as the word (and whose lengths are close enough) are considered; luckily
+	// it is rare to misspell the very first character of a word.
+	first, _ := utf8.DecodeRuneInString(word)
+	n := utf8.RuneCountInString(word)
+	rows, err := db.conn.Query(`
+		SELECT term, doc
+		FROM torrents_words
+		WHERE     term >= ?
+			  AND term < ?
+			  AND length(term) BETWEEN ? AND ?;`,
+		string(first), string(first+1), n-maxEditDistance(word), n+maxEditDistance(word),
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "sql.DB.Query (torrents_words)")
+	}
+	defer closeRows(rows)
+
+	candidates := make([]termFrequency, 0)
+	for rows.Next() {
+		var candidate termFrequency
+		if err = rows.Scan(&candidate.term, &candidate.frequency); err != nil {
+			return "", err
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	correction, _ := closestTerm(word, candidates)
+	return correction, nil
+}
+
+func (db *sqlite3Database) setupDatabase() error {
+	// Enable Write-Ahead Logging for SQLite as "WAL provides more concurrency as readers do not
+	// block writers and a writer does not block readers. Reading and writing can proceed
+	// concurrently."
+	// Caveats:
+	//   * Might be unsupported by OSes other than Windows and UNIXes.
+	//   * Does not work over a network filesystem.
+	//   * Transactions that involve changes against multiple ATTACHed databases are not atomic
+	//     across all databases as a set.
+	// See: https://www.sqlite.org/wal.html
+	//
+	// Force SQLite to use disk, instead of memory, for all temporary files to reduce the memory
+	// footprint.
+	//
+	// Enable foreign key constraints in SQLite which are crucial to prevent programmer errors on
+	// our side.
+	_, err := db.conn.Exec(`
+		PRAGMA journal_mode=WAL;
+		PRAGMA temp_store=1;
+		PRAGMA foreign_keys=ON;
+		PRAGMA encoding='UTF-8';
+	`)
+	if err != nil {
+		return errors.Wrap(err, "sql.DB.Exec (PRAGMAs)")
+	}
 
 	tx, err := db.conn.Begin()
 	if err != nil {
@@ -554,13 +1965,18 @@ func (db *sqlite3Database) setupDatabase() error {
 	if err = rows.Scan(&userVersion); err != nil {
 		return errors.Wrap(err, "sql.Rows.Scan (user_version)")
 	}
+	// The statement is closed before the migrations, since the tables cannot be dropped while it is
+	// active.
+	if err = rows.Close(); err != nil {
+		return errors.Wrap(err, "sql.Rows.Close (user_version)")
+	}
 
 	switch userVersion {
 	case 0: // FROZEN.
 		// Upgrade from user_version 0 to 1
 		// Changes:
 		//   * `info_hash_index` is recreated as UNIQUE.
-		zap.L().Warn("Updating database schema from 0 to 1... (this might take a while)")
+		zap.L().Named("persistence").Warn("Updating database schema from 0 to 1... (this might take a while)")
 		_, err = tx.Exec(`
 			DROP INDEX IF EXISTS info_hash_index;
 			CREATE UNIQUE INDEX info_hash_index ON torrents	(info_hash);
@@ -579,7 +1995,7 @@ func (db *sqlite3Database) setupDatabase() error {
 		//   * Added `is_readme` and `content` columns to the `files` table, and the constraints & the
 		//     the indices they entail.
 		//     * Added unique index `readme_index`  on `files` table.
-		zap.L().Warn("Updating database schema from 1 to 2... (this might take a while)")
+		zap.L().Named("persistence").Warn("Updating database schema from 1 to 2... (this might take a while)")
 		// We introduce two new columns in `files`: content BLOB, and is_readme INTEGER which we
 		// treat as a bool (NULL for false, and 1 for true; see the CHECK statement).
 		// The reason for the change is that as we introduce the new "readme" feature which
@@ -626,7 +2042,7 @@ func (db *sqlite3Database) setupDatabase() error {
 		//     * https://sqlite.org/fts3.html
 		//
 		//   * Added `modified_on` column to the `torrents` table.
-		zap.L().Warn("Updating database schema from 2 to 3... (this might take a while)")
+		zap.L().Named("persistence").Warn("Updating database schema from 2 to 3... (this might take a while)")
 		_, err = tx.Exec(`
 			CREATE VIRTUAL TABLE torrents_idx USING fts5(name, content='torrents', content_rowid='id', tokenize="porter unicode61 separators ' !""#$%&''()*+,-./:;<=>?@[\]^_` + "`" + `{|}~'");
 			
@@ -673,6 +2089,603 @@ func (db *sqlite3Database) setupDatabase() error {
 		if err != nil {
 			return errors.Wrap(err, "sql.Tx.Exec (v2 -> v3)")
 		}
+		fallthrough
+
+	case 3:
+		// Upgrade from user_version 3 to 4
+		// Changes:
+		//   * Added `spam_score` column to the `torrents` table.
+		//
+		// Spam scores of the existing torrents are left as 0 (i.e. "not spam") since computing
+		// them requires the files of every single torrent to be read in Go.
+		zap.L().Named("persistence").Warn("Updating database schema from 3 to 4... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN spam_score REAL NOT NULL DEFAULT 0
+				CHECK (spam_score >= 0 AND spam_score <= 1);
+
+			CREATE INDEX spam_score_index ON torrents (spam_score);
+
+			PRAGMA user_version = 4;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v3 -> v4)")
+		}
+		fallthrough
+
+	case 4:
+		// Upgrade from user_version 4 to 5
+		// Changes:
+		//   * Added `moderation` column to the `torrents` table.
+		//   * Added `reports` table to keep the reports of the users until they are moderated.
+		zap.L().Named("persistence").Warn("Updating database schema from 4 to 5... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN moderation INTEGER NOT NULL DEFAULT 0;
+
+			CREATE INDEX moderation_index ON torrents (moderation);
+
+			CREATE TABLE reports (
+				id           INTEGER PRIMARY KEY,
+				torrent_id   INTEGER NOT NULL REFERENCES torrents ON DELETE CASCADE ON UPDATE RESTRICT,
+				reason       TEXT NOT NULL,
+				reported_on  INTEGER NOT NULL CHECK(reported_on > 0)
+			);
+
+			CREATE INDEX reports_torrent_id_index ON reports (torrent_id);
+
+			PRAGMA user_version = 5;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v4 -> v5)")
+		}
+		fallthrough
+
+	case 5:
+		// Upgrade from user_version 5 to 6
+		// Changes:
+		//   * Added `search_log` table for the search analytics.
+		zap.L().Named("persistence").Warn("Updating database schema from 5 to 6... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE search_log (
+				id           INTEGER PRIMARY KEY,
+				client_hash  BLOB NOT NULL,
+				query        TEXT NOT NULL,
+				n_results    INTEGER NOT NULL,
+				latency_ms   REAL NOT NULL,
+				searched_on  INTEGER NOT NULL CHECK(searched_on > 0)
+			);
+
+			CREATE INDEX search_log_searched_on_index ON search_log (searched_on);
+
+			PRAGMA user_version = 6;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v5 -> v6)")
+		}
+		fallthrough
+
+	case 6:
+		// Upgrade from user_version 6 to 7
+		// Changes:
+		//   * Created `torrents_vocab` FTS5 vocabulary virtual table for the spelling corrections.
+		//     * https://sqlite.org/fts5.html#the_fts5vocab_virtual_table_module
+		zap.L().Named("persistence").Warn("Updating database schema from 6 to 7...")
+		_, err = tx.Exec(`
+			CREATE VIRTUAL TABLE torrents_vocab USING fts5vocab(torrents_idx, row);
+
+			PRAGMA user_version = 7;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v6 -> v7)")
+		}
+		fallthrough
+
+	case 7:
+		// Upgrade from user_version 7 to 8
+		// Changes:
+		//   * Added `category` column to the `torrents` table for the statistics dashboard.
+		//
+		// Categories of the existing torrents are left empty (i.e. "unknown") for the same reason
+		// as the spam scores.
+		zap.L().Named("persistence").Warn("Updating database schema from 7 to 8... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN category TEXT NOT NULL DEFAULT '';
+
+			PRAGMA user_version = 8;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v7 -> v8)")
+		}
+		fallthrough
+
+	case 8:
+		// Upgrade from user_version 8 to 9
+		// Changes:
+		//   * Added `source` column to the `torrents` table for the source attribution.
+		zap.L().Named("persistence").Warn("Updating database schema from 8 to 9... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN source TEXT NOT NULL DEFAULT '';
+
+			PRAGMA user_version = 9;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v8 -> v9)")
+		}
+		fallthrough
+
+	case 9:
+		// Upgrade from user_version 9 to 10
+		// Changes:
+		//   * Added `n_files` column to the `torrents` table, so that the files of the torrents are
+		//     not counted for every search result (and can be ordered by using an index).
+		zap.L().Named("persistence").Warn("Updating database schema from 9 to 10... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN n_files INTEGER NOT NULL DEFAULT 0;
+			UPDATE torrents SET n_files = (SELECT COUNT(*) FROM files WHERE torrent_id = torrents.id);
+			CREATE INDEX n_files_index ON torrents (n_files);
+
+			PRAGMA user_version = 10;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v9 -> v10)")
+		}
+		fallthrough
+
+	case 10:
+		// Upgrade from user_version 10 to 11
+		// Changes:
+		//   * Added `requests` table for the requests of the users for the torrents to be looked
+		//     up by the crawler.
+		zap.L().Named("persistence").Warn("Updating database schema from 10 to 11... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE requests (
+				info_hash          BLOB NOT NULL UNIQUE,
+				status             TEXT NOT NULL,
+				attempts           INTEGER NOT NULL DEFAULT 0,
+				requested_on       INTEGER NOT NULL,
+				last_attempted_on  INTEGER NOT NULL DEFAULT 0
+			);
+			CREATE INDEX requests_status_index ON requests (status, last_attempted_on);
+
+			PRAGMA user_version = 11;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v10 -> v11)")
+		}
+		fallthrough
+
+	case 11:
+		// Changes:
+		//   * Added `recent_torrents` table, the ring buffer of the most recently discovered
+		//     torrents (see MaxRecentTorrents), seeded with the most recent ones in `torrents`.
+		zap.L().Named("persistence").Warn("Updating database schema from 11 to 12... (this might take a while)")
+		_, err = tx.Exec(executeTemplate(`
+			CREATE TABLE recent_torrents (
+				slot           INTEGER PRIMARY KEY,
+				torrent_id     INTEGER NOT NULL,
+				info_hash      BLOB NOT NULL,
+				name           TEXT NOT NULL,
+				total_size     INTEGER NOT NULL,
+				discovered_on  INTEGER NOT NULL,
+				n_files        INTEGER NOT NULL,
+				spam_score     REAL NOT NULL
+			);
+
+			INSERT INTO recent_torrents
+			SELECT id % {{.Capacity}}, id, info_hash, name, total_size, discovered_on, n_files, spam_score
+			FROM torrents
+			WHERE moderation <> {{.Flagged}}
+			ORDER BY id DESC
+			LIMIT {{.Capacity}};
+
+			PRAGMA user_version = 12;
+		`, struct {
+			Capacity int
+			Flagged  uint8
+		}{MaxRecentTorrents, uint8(Flagged)}, nil))
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v11 -> v12)")
+		}
+		fallthrough
+
+	case 12:
+		// Changes:
+		//   * Added `sightings` table for the number of the times that the torrents are seen on the
+		//     DHT by the hour, and `trending` table for the torrents that are sighted the most.
+		zap.L().Named("persistence").Warn("Updating database schema from 12 to 13... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE sightings (
+				torrent_id  INTEGER NOT NULL REFERENCES torrents ON DELETE CASCADE ON UPDATE RESTRICT,
+				hour        INTEGER NOT NULL,
+				count       INTEGER NOT NULL,
+
+				PRIMARY KEY (torrent_id, hour)
+			) WITHOUT ROWID;
+			CREATE INDEX sightings_hour_index ON sightings (hour);
+
+			CREATE TABLE trending (
+				torrent_id  INTEGER PRIMARY KEY REFERENCES torrents ON DELETE CASCADE ON UPDATE RESTRICT,
+				sightings   INTEGER NOT NULL
+			);
+
+			PRAGMA user_version = 13;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v12 -> v13)")
+		}
+		fallthrough
+
+	case 13:
+		// Changes:
+		//   * Added `discoveries` table for the precise times of the discoveries of the torrents,
+		//     and the (anonymised) peers that announced them, if opted in (see Discovery).
+		zap.L().Named("persistence").Warn("Updating database schema from 13 to 14... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE discoveries (
+				torrent_id        INTEGER PRIMARY KEY REFERENCES torrents ON DELETE CASCADE ON UPDATE RESTRICT,
+				discovered_on_ms  INTEGER NOT NULL,
+				peer_ip           TEXT,
+				peer_port         INTEGER
+			);
+
+			PRAGMA user_version = 14;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v13 -> v14)")
+		}
+		fallthrough
+
+	case 14:
+		// Changes:
+		//   * Added `cjk_bigrams` column to the `torrents` table for the bigrams of the CJK names
+		//     (see cjkBigrams), and re-created `torrents_idx` (and `torrents_vocab`) to index them
+		//     along with the names.
+		zap.L().Named("persistence").Warn("Updating database schema from 14 to 15... (this might take a while)")
+		if _, err = tx.Exec("ALTER TABLE torrents ADD COLUMN cjk_bigrams TEXT;"); err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v14 -> v15)")
+		}
+		if err = fillNames(tx, sqlite3Dialect, "cjk_bigrams", cjkBigrams); err != nil {
+			return errors.Wrap(err, "fillNames (v14 -> v15)")
+		}
+		_, err = tx.Exec(`
+			DROP TRIGGER torrents_idx_ai_t;
+			DROP TRIGGER torrents_idx_ad_t;
+			DROP TRIGGER torrents_idx_au_t;
+			DROP TABLE torrents_vocab;
+			DROP TABLE torrents_idx;
+
+			CREATE VIRTUAL TABLE torrents_idx USING fts5(name, cjk_bigrams, content='torrents', content_rowid='id', tokenize="porter unicode61 separators ' !""#$%&''()*+,-./:;<=>?@[\]^_` + "`" + `{|}~'");
+			INSERT INTO torrents_idx(torrents_idx) VALUES ('rebuild');
+
+			CREATE TRIGGER torrents_idx_ai_t AFTER INSERT ON torrents BEGIN
+			  INSERT INTO torrents_idx(rowid, name, cjk_bigrams) VALUES (new.id, new.name, new.cjk_bigrams);
+			END;
+			CREATE TRIGGER torrents_idx_ad_t AFTER DELETE ON torrents BEGIN
+			  INSERT INTO torrents_idx(torrents_idx, rowid, name, cjk_bigrams) VALUES('delete', old.id, old.name, old.cjk_bigrams);
+			END;
+			CREATE TRIGGER torrents_idx_au_t AFTER UPDATE ON torrents BEGIN
+			  INSERT INTO torrents_idx(torrents_idx, rowid, name, cjk_bigrams) VALUES('delete', old.id, old.name, old.cjk_bigrams);
+			  INSERT INTO torrents_idx(rowid, name, cjk_bigrams) VALUES (new.id, new.name, new.cjk_bigrams);
+			END;
+
+			CREATE VIRTUAL TABLE torrents_vocab USING fts5vocab(torrents_idx, row);
+
+			PRAGMA user_version = 15;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v14 -> v15)")
+		}
+		fallthrough
+
+	case 15:
+		// Changes:
+		//   * Added `synonyms` column to the `torrents` table for the canonical terms of the names
+		//     (see synonyms), and re-created `torrents_idx` (and `torrents_vocab`) to index them along
+		//     with the names.
+		zap.L().Named("persistence").Warn("Updating database schema from 15 to 16... (this might take a while)")
+		if _, err = tx.Exec("ALTER TABLE torrents ADD COLUMN synonyms TEXT;"); err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v15 -> v16)")
+		}
+		if _, err = refreshSynonyms(tx, sqlite3Dialect, db.synonyms); err != nil {
+			return errors.Wrap(err, "refreshSynonyms (v15 -> v16)")
+		}
+		_, err = tx.Exec(`
+			DROP TRIGGER torrents_idx_ai_t;
+			DROP TRIGGER torrents_idx_ad_t;
+			DROP TRIGGER torrents_idx_au_t;
+			DROP TABLE torrents_vocab;
+			DROP TABLE torrents_idx;
+
+			CREATE VIRTUAL TABLE torrents_idx USING fts5(name, cjk_bigrams, synonyms, content='torrents', content_rowid='id', tokenize="porter unicode61 separators ' !""#$%&''()*+,-./:;<=>?@[\]^_` + "`" + `{|}~'");
+			INSERT INTO torrents_idx(torrents_idx) VALUES ('rebuild');
+
+			CREATE TRIGGER torrents_idx_ai_t AFTER INSERT ON torrents BEGIN
+			  INSERT INTO torrents_idx(rowid, name, cjk_bigrams, synonyms) VALUES (new.id, new.name, new.cjk_bigrams, new.synonyms);
+			END;
+			CREATE TRIGGER torrents_idx_ad_t AFTER DELETE ON torrents BEGIN
+			  INSERT INTO torrents_idx(torrents_idx, rowid, name, cjk_bigrams, synonyms) VALUES('delete', old.id, old.name, old.cjk_bigrams, old.synonyms);
+			END;
+			CREATE TRIGGER torrents_idx_au_t AFTER UPDATE ON torrents BEGIN
+			  INSERT INTO torrents_idx(torrents_idx, rowid, name, cjk_bigrams, synonyms) VALUES('delete', old.id, old.name, old.cjk_bigrams, old.synonyms);
+			  INSERT INTO torrents_idx(rowid, name, cjk_bigrams, synonyms) VALUES (new.id, new.name, new.cjk_bigrams, new.synonyms);
+			END;
+
+			CREATE VIRTUAL TABLE torrents_vocab USING fts5vocab(torrents_idx, row);
+
+			PRAGMA user_version = 16;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v15 -> v16)")
+		}
+		fallthrough
+
+	case 16:
+		// Changes:
+		//   * Added `release_*` columns to the `torrents` table for the releases of the names (see
+		//     ParseRelease).
+		zap.L().Named("persistence").Warn("Updating database schema from 16 to 17... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN release_title      TEXT;
+			ALTER TABLE torrents ADD COLUMN release_year       INTEGER;
+			ALTER TABLE torrents ADD COLUMN release_season     INTEGER;
+			ALTER TABLE torrents ADD COLUMN release_episode    INTEGER;
+			ALTER TABLE torrents ADD COLUMN release_resolution TEXT;
+			ALTER TABLE torrents ADD COLUMN release_codec      TEXT;
+			ALTER TABLE torrents ADD COLUMN release_group      TEXT;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v16 -> v17)")
+		}
+		if err = fillReleases(tx, sqlite3Dialect); err != nil {
+			return errors.Wrap(err, "fillReleases (v16 -> v17)")
+		}
+		if _, err = tx.Exec("PRAGMA user_version = 17;"); err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v16 -> v17)")
+		}
+		fallthrough
+
+	case 17:
+		// Changes:
+		//   * Added `album_*` columns to the `torrents` table for the albums of the audio torrents
+		//     (see ParseAlbum).
+		zap.L().Named("persistence").Warn("Updating database schema from 17 to 18... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN album_artist   TEXT;
+			ALTER TABLE torrents ADD COLUMN album_title    TEXT;
+			ALTER TABLE torrents ADD COLUMN album_n_tracks INTEGER;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v17 -> v18)")
+		}
+		if err = fillAlbums(tx, sqlite3Dialect); err != nil {
+			return errors.Wrap(err, "fillAlbums (v17 -> v18)")
+		}
+		if _, err = tx.Exec("PRAGMA user_version = 18;"); err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v17 -> v18)")
+		}
+		fallthrough
+
+	case 18:
+		// Changes:
+		//   * Added `text_path` and `text_content` columns to the `torrents` table for the texts of
+		//     the torrents (see TorrentText), and re-created `torrents_idx` (and `torrents_vocab`) to
+		//     index them along with the names.
+		zap.L().Named("persistence").Warn("Updating database schema from 18 to 19... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN text_path    TEXT;
+			ALTER TABLE torrents ADD COLUMN text_content TEXT;
+
+			DROP TRIGGER torrents_idx_ai_t;
+			DROP TRIGGER torrents_idx_ad_t;
+			DROP TRIGGER torrents_idx_au_t;
+			DROP TABLE torrents_vocab;
+			DROP TABLE torrents_idx;
+
+			CREATE VIRTUAL TABLE torrents_idx USING fts5(name, cjk_bigrams, synonyms, text_content, content='torrents', content_rowid='id', tokenize="porter unicode61 separators ' !""#$%&''()*+,-./:;<=>?@[\]^_` + "`" + `{|}~'");
+			INSERT INTO torrents_idx(torrents_idx) VALUES ('rebuild');
+
+			CREATE TRIGGER torrents_idx_ai_t AFTER INSERT ON torrents BEGIN
+			  INSERT INTO torrents_idx(rowid, name, cjk_bigrams, synonyms, text_content) VALUES (new.id, new.name, new.cjk_bigrams, new.synonyms, new.text_content);
+			END;
+			CREATE TRIGGER torrents_idx_ad_t AFTER DELETE ON torrents BEGIN
+			  INSERT INTO torrents_idx(torrents_idx, rowid, name, cjk_bigrams, synonyms, text_content) VALUES('delete', old.id, old.name, old.cjk_bigrams, old.synonyms, old.text_content);
+			END;
+			CREATE TRIGGER torrents_idx_au_t AFTER UPDATE ON torrents BEGIN
+			  INSERT INTO torrents_idx(torrents_idx, rowid, name, cjk_bigrams, synonyms, text_content) VALUES('delete', old.id, old.name, old.cjk_bigrams, old.synonyms, old.text_content);
+			  INSERT INTO torrents_idx(rowid, name, cjk_bigrams, synonyms, text_content) VALUES (new.id, new.name, new.cjk_bigrams, new.synonyms, new.text_content);
+			END;
+
+			CREATE VIRTUAL TABLE torrents_vocab USING fts5vocab(torrents_idx, row);
+
+			PRAGMA user_version = 19;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v18 -> v19)")
+		}
+		fallthrough
+
+	case 19:
+		// Changes:
+		//   * Added `fetch_claims` table for the claims of the fetches of the torrents by the
+		//     crawlers that share the database (see Database.ClaimFetch).
+		zap.L().Named("persistence").Warn("Updating database schema from 19 to 20... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE fetch_claims (
+				info_hash   BLOB PRIMARY KEY,
+				claimant    TEXT NOT NULL,
+				claimed_on  INTEGER NOT NULL
+			);
+			CREATE INDEX fetch_claims_claimed_on_index ON fetch_claims (claimed_on);
+
+			PRAGMA user_version = 20;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v19 -> v20)")
+		}
+		fallthrough
+
+	case 20:
+		// Changes:
+		//   * Added `crawler_stats` table for the hourly statistics of the crawlers (see
+		//     Database.AddCrawlerStats).
+		zap.L().Named("persistence").Warn("Updating database schema from 20 to 21... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE crawler_stats (
+				hour       INTEGER PRIMARY KEY,
+				n_trawled  INTEGER NOT NULL,
+				n_fetched  INTEGER NOT NULL
+			);
+
+			PRAGMA user_version = 21;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v20 -> v21)")
+		}
+		fallthrough
+
+	case 21:
+		// Changes:
+		//   * Added `peer_country` column to `discoveries` for the countries of the peers (see
+		//     Discovery.Country).
+		zap.L().Named("persistence").Warn("Updating database schema from 21 to 22... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE discoveries ADD COLUMN peer_country TEXT;
+
+			PRAGMA user_version = 22;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v21 -> v22)")
+		}
+		fallthrough
+
+	case 22:
+		// Changes:
+		//   * Added `favorites` table for the torrents that the users have bookmarked (see
+		//     Database.AddFavorite).
+		zap.L().Named("persistence").Warn("Updating database schema from 22 to 23... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE favorites (
+				username      TEXT NOT NULL,
+				torrent_id    INTEGER NOT NULL REFERENCES torrents ON DELETE CASCADE ON UPDATE RESTRICT,
+				favorited_on  INTEGER NOT NULL CHECK(favorited_on > 0),
+				PRIMARY KEY (username, torrent_id)
+			);
+			CREATE INDEX favorites_username_favorited_on_index ON favorites (username, favorited_on);
+			CREATE INDEX favorites_torrent_id_index ON favorites (torrent_id);
+
+			PRAGMA user_version = 23;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v22 -> v23)")
+		}
+		fallthrough
+
+	case 23:
+		// Changes:
+		//   * Added `interactions` table for the daily numbers of the interactions of the users with
+		//     the torrents (see Database.AddInteraction), and `popularity` column to the `torrents`
+		//     table for their totals, so that the torrents can be ordered by it.
+		//   * Re-indexed the torrents on the updates of only the indexed columns, lest every
+		//     interaction re-indexes the torrent.
+		zap.L().Named("persistence").Warn("Updating database schema from 23 to 24... (this might take a while)")
+		_, err = tx.Exec(`
+			ALTER TABLE torrents ADD COLUMN popularity INTEGER NOT NULL DEFAULT 0;
+			CREATE INDEX popularity_index ON torrents (popularity);
+
+			DROP TRIGGER torrents_idx_au_t;
+			CREATE TRIGGER torrents_idx_au_t AFTER UPDATE OF name, cjk_bigrams, synonyms, text_content ON torrents BEGIN
+			  INSERT INTO torrents_idx(torrents_idx, rowid, name, cjk_bigrams, synonyms, text_content) VALUES('delete', old.id, old.name, old.cjk_bigrams, old.synonyms, old.text_content);
+			  INSERT INTO torrents_idx(rowid, name, cjk_bigrams, synonyms, text_content) VALUES (new.id, new.name, new.cjk_bigrams, new.synonyms, new.text_content);
+			END;
+
+			CREATE TABLE interactions (
+				torrent_id   INTEGER NOT NULL REFERENCES torrents ON DELETE CASCADE ON UPDATE RESTRICT,
+				day          INTEGER NOT NULL,
+				n_magnets    INTEGER NOT NULL DEFAULT 0,
+				n_downloads  INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (torrent_id, day)
+			);
+
+			PRAGMA user_version = 24;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v23 -> v24)")
+		}
+		fallthrough
+
+	case 24:
+		// Changes:
+		//   * Added `api_keys` table for the keys to the API that the operators issue (see
+		//     Database.AddAPIKey), and `api_key_usage` table for their daily usages.
+		zap.L().Named("persistence").Warn("Updating database schema from 24 to 25... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE TABLE api_keys (
+				id                   INTEGER PRIMARY KEY,
+				name                 TEXT NOT NULL,
+				key_hash             BLOB NOT NULL UNIQUE,
+				requests_per_minute  INTEGER NOT NULL,
+				rows_per_day         INTEGER NOT NULL,
+				created_on           INTEGER NOT NULL,
+				revoked_on           INTEGER
+			);
+
+			CREATE TABLE api_key_usage (
+				api_key_id  INTEGER NOT NULL REFERENCES api_keys ON DELETE CASCADE ON UPDATE RESTRICT,
+				day         INTEGER NOT NULL,
+				n_requests  INTEGER NOT NULL DEFAULT 0,
+				n_rows      INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (api_key_id, day)
+			);
+
+			PRAGMA user_version = 25;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v24 -> v25)")
+		}
+		fallthrough
+
+	case 25:
+		// Changes:
+		//   * Added `torrents_words_idx` FTS5 virtual table, which indexes the names without
+		//     stemming them, and `torrents_words` FTS5 vocabulary virtual table of it for the
+		//     spelling corrections (as the terms of `torrents_vocab` are stemmed, e.g. "movi").
+		zap.L().Named("persistence").Warn("Updating database schema from 25 to 26... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE VIRTUAL TABLE torrents_words_idx USING fts5(name, content='torrents', content_rowid='id', detail=none, tokenize="unicode61 separators ' !""#$%&''()*+,-./:;<=>?@[\]^_` + "`" + `{|}~'");
+			INSERT INTO torrents_words_idx(torrents_words_idx) VALUES ('rebuild');
+
+			CREATE TRIGGER torrents_words_idx_ai_t AFTER INSERT ON torrents BEGIN
+			  INSERT INTO torrents_words_idx(rowid, name) VALUES (new.id, new.name);
+			END;
+			CREATE TRIGGER torrents_words_idx_ad_t AFTER DELETE ON torrents BEGIN
+			  INSERT INTO torrents_words_idx(torrents_words_idx, rowid, name) VALUES('delete', old.id, old.name);
+			END;
+			CREATE TRIGGER torrents_words_idx_au_t AFTER UPDATE OF name ON torrents BEGIN
+			  INSERT INTO torrents_words_idx(torrents_words_idx, rowid, name) VALUES('delete', old.id, old.name);
+			  INSERT INTO torrents_words_idx(rowid, name) VALUES (new.id, new.name);
+			END;
+
+			CREATE VIRTUAL TABLE torrents_words USING fts5vocab(torrents_words_idx, row);
+
+			PRAGMA user_version = 26;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v25 -> v26)")
+		}
+		fallthrough
+
+	case 26:
+		// Changes:
+		//   * Added `discovered_on_index` on `torrents` for the counts of the torrents discovered in
+		//     a period (e.g. the buckets of GetStatistics, and GetNumberOfDiscoveredTorrents).
+		zap.L().Named("persistence").Warn("Updating database schema from 26 to 27... (this might take a while)")
+		_, err = tx.Exec(`
+			CREATE INDEX discovered_on_index ON torrents (discovered_on);
+
+			PRAGMA user_version = 27;
+		`)
+		if err != nil {
+			return errors.Wrap(err, "sql.Tx.Exec (v26 -> v27)")
+		}
 	}
 
 	if err = tx.Commit(); err != nil {
@@ -693,8 +2706,14 @@ func executeTemplate(text string, data interface{}, funcs template.FuncMap) stri
 	return buf.String()
 }
 
-func closeRows(rows *sql.Rows) {
+// escapeLike escapes the wildcard characters of LIKE patterns (and the escape character itself)
+// so that s is matched literally, given that the pattern is followed by ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func closeRows(rows *timedRows) {
 	if err := rows.Close(); err != nil {
-		zap.L().Error("could not close row", zap.Error(err))
+		zap.L().Named("persistence").Error("could not close row", zap.Error(err))
 	}
 }
@@ -0,0 +1,195 @@
+//go:build fts5
+// +build fts5
+
+package persistence
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEngines returns the URLs of the databases that the engines are compared across: a fresh
+// SQLite database always, and the PostgreSQL database at MAGNETICO_TEST_POSTGRES (which is
+// modified!) if set.
+func testEngines(t *testing.T) map[string]string {
+	dir, err := ioutil.TempDir("", "magnetico-engines")
+	if err != nil {
+		t.Fatalf("Could not create the temporary directory: %s", err.Error())
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	engines := map[string]string{"sqlite3": "sqlite3://" + path.Join(dir, "database.sqlite3")}
+	if url := os.Getenv("MAGNETICO_TEST_POSTGRES"); url != "" {
+		engines["postgres"] = url
+	}
+	return engines
+}
+
+// setDiscoveredOn backdates the torrent, as AddNewTorrent records the current time.
+func setDiscoveredOn(t *testing.T, db Database, infoHash []byte, on time.Time) {
+	var err error
+	switch db := db.(type) {
+	case *instrumentedDatabase:
+		setDiscoveredOn(t, db.db, infoHash, on)
+		return
+	case *sqlite3Database:
+		_, err = db.conn.Exec("UPDATE torrents SET discovered_on = ? WHERE info_hash = ?;", on.Unix(), infoHash)
+	case *postgresDatabase:
+		if err = db.partitions.ensure(db.conn, on, true); err != nil {
+			t.Fatalf("Could not create the partitions: %s", err.Error())
+		}
+		_, err = db.conn.Exec("UPDATE torrents SET discovered_on = $1 WHERE info_hash = $2;", on, infoHash)
+	default:
+		t.Fatalf("Torrents of %T cannot be backdated", db)
+	}
+	if err != nil {
+		t.Fatalf("Could not backdate the torrent: %s", err.Error())
+	}
+}
+
+func TestStatisticsConformance(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("Could not load the time zone: %s", err.Error())
+	}
+
+	// The torrents are discovered around the midnights (in London) of the 28th of March 2021, when
+	// the clocks go forward, and of the 3rd of January 2021, which is in the first week of 2021
+	// (in ISO 8601) but in the week 00 of SQLite.
+	torrents := []struct {
+		discoveredOn time.Time
+		files        []File
+	}{
+		{time.Date(2021, time.March, 27, 23, 59, 0, 0, london), []File{{Size: 1, Path: "a"}}},
+		{time.Date(2021, time.March, 28, 0, 1, 0, 0, london), []File{{Size: 2, Path: "a"}, {Size: 3, Path: "b"}}},
+		{time.Date(2021, time.March, 28, 23, 59, 0, 0, london), []File{{Size: 4, Path: "a"}}},
+		{time.Date(2021, time.March, 29, 0, 0, 0, 0, london), []File{{Size: 8, Path: "a"}}},
+		{time.Date(2021, time.January, 3, 12, 0, 0, 0, london), []File{{Size: 16, Path: "a"}}},
+		{time.Date(2021, time.January, 4, 12, 0, 0, 0, london), []File{{Size: 32, Path: "a"}}},
+	}
+
+	queries := []struct {
+		from     string
+		n        uint
+		expected *Statistics
+	}{
+		{"2021-03-27", 3, &Statistics{
+			NDiscovered: map[string]uint64{"2021-03-27": 1, "2021-03-28": 2, "2021-03-29": 1},
+			NFiles:      map[string]uint64{"2021-03-27": 1, "2021-03-28": 3, "2021-03-29": 1},
+			TotalSize:   map[string]uint64{"2021-03-27": 1, "2021-03-28": 9, "2021-03-29": 8},
+		}},
+		{"2020-W53", 2, &Statistics{
+			NDiscovered: map[string]uint64{"2020-W53": 1, "2021-W01": 1},
+			NFiles:      map[string]uint64{"2020-W53": 1, "2021-W01": 1},
+			TotalSize:   map[string]uint64{"2020-W53": 16, "2021-W01": 32},
+		}},
+		{"2021-01", 3, &Statistics{
+			NDiscovered: map[string]uint64{"2021-01": 2, "2021-02": 0, "2021-03": 4},
+			NFiles:      map[string]uint64{"2021-01": 2, "2021-02": 0, "2021-03": 5},
+			TotalSize:   map[string]uint64{"2021-01": 48, "2021-02": 0, "2021-03": 18},
+		}},
+	}
+
+	for engine, url := range testEngines(t) {
+		db, err := MakeDatabase(url, nil)
+		if err != nil {
+			t.Fatalf("Could not open the %s database: %s", engine, err.Error())
+		}
+
+		for i, torrent := range torrents {
+			infoHash := make([]byte, 20)
+			infoHash[0], infoHash[19] = 0xfe, byte(i)
+			if err = db.AddNewTorrent(infoHash, "torrent", torrent.files, []byte("d4:name7:torrente"), SourceUnknown); err != nil {
+				t.Fatalf("Could not add the torrent #%d to the %s database: %s", i+1, engine, err.Error())
+			}
+			setDiscoveredOn(t, db, infoHash, torrent.discoveredOn)
+		}
+
+		for i, query := range queries {
+			stats, err := db.GetStatistics(query.from, query.n, london)
+			if err != nil {
+				t.Errorf("Statistics of the query #%d on %s failed: %s", i+1, engine, err.Error())
+			} else if !reflect.DeepEqual(stats, query.expected) {
+				t.Errorf("Statistics of the query #%d on %s are wrong! Got %+v (expected %+v)", i+1, engine,
+					*stats, *query.expected)
+			}
+		}
+
+		if err = db.Close(); err != nil {
+			t.Errorf("Could not close the %s database: %s", engine, err.Error())
+		}
+	}
+}
+
+// BenchmarkSqlite3Statistics measures GetStatistics of the days of a month on a database of the
+// torrents discovered throughout a year, whose buckets are read using discovered_on_index.
+func BenchmarkSqlite3Statistics(b *testing.B) {
+	dir, err := ioutil.TempDir("", "magnetico-statistics")
+	if err != nil {
+		b.Fatalf("Could not create the temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := MakeDatabase("sqlite3://"+path.Join(dir, "database.sqlite3"), nil)
+	if err != nil {
+		b.Fatalf("Could not open the database: %s", err.Error())
+	}
+	defer db.Close()
+
+	const nTorrents = 50000
+	start := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	conn := db.(*instrumentedDatabase).db.(*sqlite3Database).conn
+	err = db.WithTx(func(tx Database) error {
+		for i := 0; i < nTorrents; i++ {
+			infoHash := make([]byte, 20)
+			infoHash[0], infoHash[1], infoHash[2] = byte(i>>16), byte(i>>8), byte(i)
+			if err := tx.AddNewTorrent(infoHash, "torrent", []File{{Size: 1, Path: "a"}}, []byte("d4:name7:torrente"), SourceUnknown); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatalf("Could not add the torrents: %s", err.Error())
+	}
+	// The torrents are spread throughout the year, every ~10 minutes.
+	if _, err = conn.Exec("UPDATE torrents SET discovered_on = ? + id * 631;", start.Unix()); err != nil {
+		b.Fatalf("Could not backdate the torrents: %s", err.Error())
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = db.GetStatistics("2021-06-01", 30, time.UTC); err != nil {
+			b.Fatalf("Could not get the statistics: %s", err.Error())
+		}
+	}
+}
+
+// TestSqlite3DiscoveredOnIndex tests that the torrents discovered since a time are counted using
+// discovered_on_index (see GetNumberOfDiscoveredTorrents), rather than by scanning the torrents.
+func TestSqlite3DiscoveredOnIndex(t *testing.T) {
+	db, err := MakeDatabase(testEngines(t)["sqlite3"], nil)
+	if err != nil {
+		t.Fatalf("Could not open the database: %s", err.Error())
+	}
+	defer db.Close()
+
+	conn := db.(*instrumentedDatabase).db.(*sqlite3Database).conn
+	rows, err := conn.Query("EXPLAIN QUERY PLAN SELECT COUNT(*) FROM torrents WHERE discovered_on >= ?;", 0)
+	if err != nil {
+		t.Fatalf("Could not explain the query: %s", err.Error())
+	}
+	defer closeRows(rows)
+	plan, err := sqlite3Plan(rows)
+	if err != nil {
+		t.Fatalf("Could not read the plan: %s", err.Error())
+	}
+	if !strings.Contains(strings.Join(plan, "\n"), "discovered_on_index") {
+		t.Errorf("The torrents are not counted using discovered_on_index! Got %q", plan)
+	}
+}
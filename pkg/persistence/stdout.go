@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -19,7 +20,7 @@ type stdout struct {
 	encoder *json.Encoder
 }
 
-func (s *stdout) Engine() databaseEngine {
+func (s *stdout) Engine() DatabaseEngine {
 	return Stdout
 }
 
@@ -32,11 +33,12 @@ func (s *stdout) DoesTorrentExist(infoHash []byte) (bool, error) {
 	return false, nil
 }
 
-func (s *stdout) AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte) error {
+func (s *stdout) AddNewTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) error {
 	err := s.encoder.Encode(SimpleTorrentSummary{
 		InfoHash: hex.EncodeToString(infoHash),
 		Name:     name,
 		Files:    files,
+		Source:   source,
 	})
 	if err != nil {
 		return errors.Wrap(err, "DB engine stdout encode error")
@@ -45,6 +47,18 @@ func (s *stdout) AddNewTorrent(infoHash []byte, name string, files []File, metad
 	return nil
 }
 
+func (s *stdout) UpsertTorrent(infoHash []byte, name string, files []File, metadata []byte, source Source) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *stdout) WithTx(fn func(tx Database) error) error {
+	return NotImplementedError
+}
+
+func (s *stdout) SetDiscoveredOn(infoHash []byte, discoveredOn int64) error {
+	return NotImplementedError
+}
+
 func (s *stdout) Close() error {
 	return os.Stdout.Sync()
 }
@@ -53,6 +67,18 @@ func (s *stdout) GetNumberOfTorrents() (uint, error) {
 	return 0, NotImplementedError
 }
 
+func (s *stdout) GetTotalSize() (uint64, error) {
+	return 0, NotImplementedError
+}
+
+func (s *stdout) GetNumberOfDiscoveredTorrents(from int64) (uint64, error) {
+	return 0, NotImplementedError
+}
+
+func (s *stdout) GetRecentTorrents(limit uint) ([]TorrentMetadata, error) {
+	return nil, NotImplementedError
+}
+
 func (s *stdout) QueryTorrents(
 	query string,
 	epoch int64,
@@ -61,10 +87,27 @@ func (s *stdout) QueryTorrents(
 	limit uint,
 	lastOrderedValue *float64,
 	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
 ) ([]TorrentMetadata, error) {
 	return nil, NotImplementedError
 }
 
+func (s *stdout) ExplainTorrents(
+	analyze bool,
+	query string,
+	epoch int64,
+	orderBy OrderingCriteria,
+	ascending bool,
+	limit uint,
+	lastOrderedValue *float64,
+	lastID *uint64,
+	filters QueryFilters,
+	fields Fields,
+) (*QueryPlan, error) {
+	return nil, NotImplementedError
+}
+
 func (s *stdout) GetTorrent(infoHash []byte) (*TorrentMetadata, error) {
 	return nil, NotImplementedError
 }
@@ -73,6 +116,174 @@ func (s *stdout) GetFiles(infoHash []byte) ([]File, error) {
 	return nil, NotImplementedError
 }
 
-func (s *stdout) GetStatistics(from string, n uint) (*Statistics, error) {
+func (s *stdout) GetMetadata(infoHash []byte) ([]byte, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) QueryFiles(infoHash []byte, pathContains string, offset uint, limit uint) ([]File, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) GetFileTree(infoHash []byte) (*FileTreeNode, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) GetStatistics(from string, n uint, loc *time.Location) (*Statistics, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) GetDashboard(from int64) (*Dashboard, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) GetFacets(query string, epoch int64, filters QueryFilters) (*Facets, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) GetStorageReport() (*StorageReport, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) GetPoolStats() (*PoolStats, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) AdviseIndexes(queries []QueryStat, create bool) ([]IndexAdvice, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) RefreshSynonyms() (uint64, error) {
+	return 0, NotImplementedError
+}
+
+func (s *stdout) ReportTorrent(infoHash []byte, reason string) error {
+	return NotImplementedError
+}
+
+func (s *stdout) GetModerationQueue(limit uint) ([]ModerationQueueItem, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) SetModerationState(infoHash []byte, state ModerationState) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *stdout) RequestTorrent(infoHash []byte) (*TorrentRequest, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) GetTorrentRequest(infoHash []byte) (*TorrentRequest, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) GetPendingTorrentRequests(limit uint) ([]TorrentRequest, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) UpdateTorrentRequest(infoHash []byte, status RequestStatus) error {
+	return NotImplementedError
+}
+
+func (s *stdout) AddFavorite(username string, infoHash []byte) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *stdout) RemoveFavorite(username string, infoHash []byte) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *stdout) IsFavorite(username string, infoHash []byte) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *stdout) GetFavorites(username string, limit uint) ([]Favorite, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) AddInteraction(infoHash []byte, interaction Interaction, on int64) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *stdout) GetInteractions(infoHash []byte, from int64) ([]Interactions, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) AddAPIKey(name string, keyHash []byte, limits APIKeyLimits, createdOn int64) (uint64, error) {
+	return 0, NotImplementedError
+}
+
+func (s *stdout) GetAPIKey(keyHash []byte, on int64) (*APIKey, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) GetAPIKeys(on int64) ([]APIKey, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) UpdateAPIKey(id uint64, limits APIKeyLimits) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *stdout) RevokeAPIKey(id uint64, on int64) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *stdout) AddAPIKeyUsage(id uint64, nRequests uint64, nRows uint64, on int64) error {
+	return NotImplementedError
+}
+
+func (s *stdout) AddSightings(sightings []Sighting, on int64) error {
+	return NotImplementedError
+}
+
+func (s *stdout) UpdateTrending(since int64) error {
+	return NotImplementedError
+}
+
+func (s *stdout) GetTrendingTorrents(limit uint) ([]TorrentMetadata, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) AddCrawlerStats(stats CrawlerStats) error {
+	return NotImplementedError
+}
+
+func (s *stdout) GetCrawlerStats(from int64) ([]CrawlerStats, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) AddDiscovery(infoHash []byte, discovery Discovery) error {
+	return NotImplementedError
+}
+
+func (s *stdout) SetText(infoHash []byte, text TorrentText) error {
+	return NotImplementedError
+}
+
+func (s *stdout) ClaimFetch(infoHash []byte, claimant string, ttl time.Duration) (bool, error) {
+	return false, NotImplementedError
+}
+
+func (s *stdout) AcquireSlot(n int) (Slot, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) LogSearch(entry SearchLogEntry) error {
+	return NotImplementedError
+}
+
+func (s *stdout) GetSearchAnalytics(since int64, limit uint) (*SearchAnalytics, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) PurgeSearchLog(before int64) error {
+	return NotImplementedError
+}
+
+func (s *stdout) GetSuggestions(prefix string, limit uint) ([]string, error) {
+	return nil, NotImplementedError
+}
+
+func (s *stdout) GetCorrections(query string, limit uint) ([]string, error) {
 	return nil, NotImplementedError
 }
@@ -0,0 +1,85 @@
+package persistence
+
+import (
+	"time"
+)
+
+// TableStorage is the disk usage of a table (along with its indexes) and its growth, both of which
+// are estimates.
+type TableStorage struct {
+	Name        string  `json:"name"`
+	Rows        uint64  `json:"rows"`
+	Bytes       uint64  `json:"bytes"`
+	RowsPerDay  float64 `json:"rowsPerDay"`
+	BytesPerDay float64 `json:"bytesPerDay"`
+}
+
+// StorageReport is the disk usage of the database and its growth, projected to when the disk will
+// be full.
+type StorageReport struct {
+	// Tables are the biggest tables of the database.
+	Tables      []TableStorage `json:"tables"`
+	TotalBytes  uint64         `json:"totalBytes"`
+	BytesPerDay float64        `json:"bytesPerDay"`
+	// FreeBytes is the free space of the disk of the database, and FullOn is when the disk is
+	// projected to be full (in Unix time) at the current growth; either is zero if unknown (e.g.
+	// if the database is on another host, or if it is not growing).
+	FreeBytes uint64 `json:"freeBytes,omitempty"`
+	FullOn    int64  `json:"fullOn,omitempty"`
+}
+
+const (
+	// growthWindow is how far back the torrents discovered are counted for the growth of the
+	// database, and minGrowthPeriod is the shortest period (for the younger databases) in which the
+	// growth is not too noisy to be projected.
+	growthWindow    = 7 * 24 * time.Hour
+	minGrowthPeriod = time.Hour
+)
+
+// growthPeriod returns the period in which the torrents discovered are counted for the growth of
+// the database, which is shorter than growthWindow if the oldest torrent (discovered on @oldest, in
+// Unix time) is more recent.
+func growthPeriod(oldest int64, now time.Time) time.Duration {
+	if since := now.Add(-growthWindow); oldest > since.Unix() {
+		return now.Sub(time.Unix(oldest, 0))
+	}
+	return growthWindow
+}
+
+// project estimates the growth of the database and of its tables (whose Rows and Bytes are
+// measured) from the number of the torrents discovered in the period, as all the tables grow
+// along with the torrents, and projects when the disk will be full.
+func (report *StorageReport) project(nTorrents uint64, nDiscovered uint64, period time.Duration, now time.Time) {
+	if nTorrents == 0 || period < minGrowthPeriod {
+		return
+	}
+	torrentsPerDay := float64(nDiscovered) / (float64(period) / float64(24*time.Hour))
+
+	for i := range report.Tables {
+		table := &report.Tables[i]
+		table.RowsPerDay = torrentsPerDay * float64(table.Rows) / float64(nTorrents)
+		table.BytesPerDay = torrentsPerDay * float64(table.Bytes) / float64(nTorrents)
+	}
+	report.BytesPerDay = torrentsPerDay * float64(report.TotalBytes) / float64(nTorrents)
+
+	if report.FreeBytes > 0 && report.BytesPerDay > 0 {
+		days := float64(report.FreeBytes) / report.BytesPerDay
+		report.FullOn = now.Add(time.Duration(days * float64(24*time.Hour))).Unix()
+	}
+}
+
+// apportion sets the Bytes of the tables by splitting the total disk usage of the database in
+// proportion to their estimated sizes, for the engines that do not report the sizes of the
+// tables.
+func (report *StorageReport) apportion(estimates []float64) {
+	var sum float64
+	for _, estimate := range estimates {
+		sum += estimate
+	}
+	if sum == 0 {
+		return
+	}
+	for i, estimate := range estimates {
+		report.Tables[i].Bytes = uint64(float64(report.TotalBytes) * estimate / sum)
+	}
+}
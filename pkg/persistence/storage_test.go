@@ -0,0 +1,65 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+)
+
+var projectTest_instances = []struct {
+	nDiscovered uint64
+	period      time.Duration
+	freeBytes   uint64
+	bytesPerDay float64
+	fullIn      time.Duration // zero if not projected
+}{
+	// 1000 torrents a day of the 10000 torrents in 1 MB, i.e. 100 bytes a day each.
+	{7000, growthWindow, 1000000, 100000, 10 * 24 * time.Hour},
+	{1000, 24 * time.Hour, 50000, 100000, 12 * time.Hour},
+	// The free space is unknown.
+	{7000, growthWindow, 0, 100000, 0},
+	// The database is not growing.
+	{0, growthWindow, 1000000, 0, 0},
+	// The database is too young.
+	{100, time.Minute, 1000000, 0, 0},
+}
+
+func TestProject(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	for i, instance := range projectTest_instances {
+		report := StorageReport{
+			Tables:     []TableStorage{{Name: "torrents", Rows: 10000, Bytes: 800000}},
+			TotalBytes: 1000000,
+			FreeBytes:  instance.freeBytes,
+		}
+		report.project(10000, instance.nDiscovered, instance.period, now)
+
+		if report.BytesPerDay != instance.bytesPerDay {
+			t.Errorf("BytesPerDay of the instance #%d is wrong! Got %f (expected %f)", i+1,
+				report.BytesPerDay, instance.bytesPerDay)
+		}
+		if tableBytesPerDay := report.BytesPerDay * 0.8; report.Tables[0].BytesPerDay != tableBytesPerDay {
+			t.Errorf("BytesPerDay of the table of the instance #%d is wrong! Got %f (expected %f)", i+1,
+				report.Tables[0].BytesPerDay, tableBytesPerDay)
+		}
+
+		var fullOn int64
+		if instance.fullIn != 0 {
+			fullOn = now.Add(instance.fullIn).Unix()
+		}
+		if report.FullOn != fullOn {
+			t.Errorf("FullOn of the instance #%d is wrong! Got %d (expected %d)", i+1, report.FullOn, fullOn)
+		}
+	}
+}
+
+func TestApportion(t *testing.T) {
+	report := StorageReport{
+		Tables:     []TableStorage{{Name: "torrents"}, {Name: "files"}},
+		TotalBytes: 1000,
+	}
+	report.apportion([]float64{300, 100})
+	if report.Tables[0].Bytes != 750 || report.Tables[1].Bytes != 250 {
+		t.Errorf("Apportioned sizes are wrong! Got %d and %d (expected 750 and 250)", report.Tables[0].Bytes,
+			report.Tables[1].Bytes)
+	}
+}
@@ -0,0 +1,23 @@
+package persistence
+
+// appendSuggestions appends the suggestions in the (single column) rows to @suggestions, skipping
+// the duplicates, until there are @limit suggestions in total.
+func appendSuggestions(suggestions []string, rows *timedRows, limit uint) ([]string, error) {
+	seen := make(map[string]bool, len(suggestions))
+	for _, s := range suggestions {
+		seen[s] = true
+	}
+
+	for rows.Next() && uint(len(suggestions)) < limit {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		if !seen[s] {
+			seen[s] = true
+			suggestions = append(suggestions, s)
+		}
+	}
+
+	return suggestions, rows.Err()
+}
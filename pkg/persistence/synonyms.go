@@ -0,0 +1,241 @@
+package persistence
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// synonyms maps the terms (in lower case) to the canonical terms of their groups, which are the
+// first terms of the groups, such as "ii" to "2". The canonical terms of the names are indexed
+// along with the names (see synonyms.ofName), and the terms of the queries are replaced by their
+// canonical terms (see synonyms.canonicalize), hence "Part II" and "Part 2" match each other.
+type synonyms map[string]string
+
+// defaultSynonymList is the synonym list of the databases whose URLs have no synonyms parameter:
+// the Roman numerals (except I, which is mostly the pronoun) and the names of the resolutions.
+const defaultSynonymList = `
+2, ii
+3, iii
+4, iv
+5, v
+6, vi
+7, vii
+8, viii
+9, ix
+10, x
+11, xi
+12, xii
+13, xiii
+14, xiv
+15, xv
+16, xvi
+17, xvii
+18, xviii
+19, xix
+20, xx
+2160p, 4k, uhd
+4320p, 8k
+1080p, fhd
+`
+
+var defaultSynonyms = mustParseSynonymList(defaultSynonymList)
+
+// parseSynonyms parses the synonyms parameter of the URL of a database (and removes it from the
+// URL), which is the path of the file of the synonym list (see parseSynonymList), or the default
+// synonym list if not supplied. The names are indexed by the synonym list when they are added (or
+// updated), hence Database.RefreshSynonyms must be called after the list is changed.
+func parseSynonyms(url_ *url.URL) (synonyms, error) {
+	query := url_.Query()
+	path := query.Get("synonyms")
+	if path == "" {
+		return defaultSynonyms, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "synonyms")
+	}
+	defer file.Close()
+	s, err := parseSynonymList(file)
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+
+	query.Del("synonyms")
+	url_.RawQuery = query.Encode()
+	return s, nil
+}
+
+// parseSynonymList parses a synonym list, each line of which is a group of the terms that are
+// separated by commas, whose first term is canonical. The terms are single words (of letters and
+// digits) in any case, which cannot be in more than one group. The empty lines, and the lines that
+// start with #, are ignored.
+func parseSynonymList(r io.Reader) (synonyms, error) {
+	s := make(synonyms)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		terms := strings.Split(line, ",")
+		if len(terms) < 2 {
+			return nil, fmt.Errorf("line %d: a group must have at least two terms", n)
+		}
+		canonical := strings.ToLower(strings.TrimSpace(terms[0]))
+		for _, term := range terms {
+			term = strings.ToLower(strings.TrimSpace(term))
+			if term == "" || strings.IndexFunc(term, isNotWordRune) != -1 {
+				return nil, fmt.Errorf("line %d: `%s` is not a single word", n, term)
+			}
+			if _, dup := s[term]; dup {
+				return nil, fmt.Errorf("line %d: `%s` is in more than one group", n, term)
+			}
+			s[term] = canonical
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func mustParseSynonymList(list string) synonyms {
+	s, err := parseSynonymList(strings.NewReader(list))
+	if err != nil {
+		panic(fmt.Sprintf("persistence: invalid synonym list: %s", err.Error()))
+	}
+	return s
+}
+
+func isNotWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// ofName returns the canonical terms of the terms of the name that are not canonical themselves,
+// separated by spaces, which both engines store in the synonyms column of the torrents (to be
+// indexed along with the names), or NULL if there are none.
+func (s synonyms) ofName(name string) sql.NullString {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, term := range strings.FieldsFunc(strings.ToLower(name), isNotWordRune) {
+		canonical, ok := s[term]
+		if !ok || canonical == term || seen[canonical] {
+			continue
+		}
+		seen[canonical] = true
+		terms = append(terms, canonical)
+	}
+	if len(terms) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: strings.Join(terms, " "), Valid: true}
+}
+
+// canonicalize replaces the terms of the query by their canonical terms. The rest of the query
+// (such as the quotes of the phrases, and the asterisks of the prefix queries) is kept as it is.
+func (s synonyms) canonicalize(query string) string {
+	if len(s) == 0 {
+		return query
+	}
+
+	var sb strings.Builder
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		if isNotWordRune(runes[i]) {
+			sb.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && !isNotWordRune(runes[j]) {
+			j++
+		}
+		term := string(runes[i:j])
+		if canonical, ok := s[strings.ToLower(term)]; ok {
+			term = canonical
+		}
+		sb.WriteString(term)
+		i = j
+	}
+	return sb.String()
+}
+
+// canonicalizeSearch canonicalizes the query and the refinements of a search (see canonicalize).
+func (s synonyms) canonicalizeSearch(query string, filters QueryFilters) (string, QueryFilters) {
+	if len(filters.Refinements) > 0 {
+		refinements := make([]string, len(filters.Refinements))
+		for i, refinement := range filters.Refinements {
+			refinements[i] = s.canonicalize(refinement)
+		}
+		filters.Refinements = refinements
+	}
+	return s.canonicalize(query), filters
+}
+
+// refreshSynonyms re-derives the synonyms column of all the torrents by the synonym list (see
+// synonyms.ofName), in batches, and returns the number of the torrents whose synonyms are changed.
+func refreshSynonyms(tx *timedTx, d *dialect, s synonyms) (uint64, error) {
+	const batchSize = 1000
+	type torrent struct {
+		id       int64
+		synonyms sql.NullString
+	}
+
+	selectBatch := fmt.Sprintf(`
+		SELECT id, name, synonyms
+		FROM torrents
+		WHERE id > %s
+		ORDER BY id
+		LIMIT %s;`, d.placeholder(1), d.placeholder(2))
+	update := fmt.Sprintf("UPDATE torrents SET synonyms = %s WHERE id = %s;", d.placeholder(1), d.placeholder(2))
+
+	var lastID int64
+	var n uint64
+	for {
+		rows, err := tx.Query(selectBatch, lastID, batchSize)
+		if err != nil {
+			return 0, errors.Wrap(err, "sql.Tx.Query")
+		}
+		// The rows are read before the torrents are updated, as the rows of a query must be closed
+		// before the next statement is executed in the transaction.
+		changed := make([]torrent, 0)
+		nRows := 0
+		for rows.Next() {
+			var name string
+			var old sql.NullString
+			if err = rows.Scan(&lastID, &name, &old); err != nil {
+				closeRows(rows)
+				return 0, errors.Wrap(err, "sql.Rows.Scan")
+			}
+			nRows++
+			if derived := s.ofName(name); derived != old {
+				changed = append(changed, torrent{lastID, derived})
+			}
+		}
+		closeRows(rows)
+		if err = rows.Err(); err != nil {
+			return 0, errors.Wrap(err, "sql.Rows.Err")
+		}
+
+		for _, t := range changed {
+			if _, err = tx.Exec(update, t.synonyms, t.id); err != nil {
+				return 0, errors.Wrap(err, "sql.Tx.Exec (UPDATE torrents)")
+			}
+		}
+		n += uint64(len(changed))
+
+		if nRows < batchSize {
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,146 @@
+//go:build fts5
+// +build fts5
+
+package persistence
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+var parseSynonymListTest_instances = []struct {
+	list  string
+	fails bool
+}{
+	{"# Roman numerals\n2, II\n\n3,iii\n", false},
+	{"2\n", true},
+	{"2, ii\nii, two\n", true},
+	{"2160p, 4 k\n", true},
+}
+
+func TestParseSynonymList(t *testing.T) {
+	for i, instance := range parseSynonymListTest_instances {
+		s, err := parseSynonymList(strings.NewReader(instance.list))
+		if instance.fails {
+			if err == nil {
+				t.Errorf("Instance #%d is parsed although it is invalid!", i+1)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Instance #%d could not be parsed! %s", i+1, err.Error())
+			continue
+		}
+		if s["ii"] != "2" || s["2"] != "2" || s["iii"] != "3" {
+			t.Errorf("Synonyms of the instance #%d are wrong! Got %v", i+1, s)
+		}
+	}
+}
+
+var synonymsTest_instances = []struct {
+	text         string
+	ofName       sql.NullString
+	canonicalize string
+}{
+	{"Rocky II (1979)", sql.NullString{String: "2", Valid: true}, "Rocky 2 (1979)"},
+	{"Planet Earth II 4K UHD", sql.NullString{String: "2 2160p", Valid: true}, "Planet Earth 2 2160p 2160p"},
+	{"Part 2 2160p", sql.NullString{}, "Part 2 2160p"},
+	{`"part ii" x264 uhd*`, sql.NullString{String: "2 2160p", Valid: true}, `"part 2" x264 2160p*`},
+}
+
+func TestSynonyms(t *testing.T) {
+	for i, instance := range synonymsTest_instances {
+		if ofName := defaultSynonyms.ofName(instance.text); ofName != instance.ofName {
+			t.Errorf("Synonyms of the name of the instance #%d are wrong! Got %+v (expected %+v)", i+1, ofName,
+				instance.ofName)
+		}
+		if canonicalized := defaultSynonyms.canonicalize(instance.text); canonicalized != instance.canonicalize {
+			t.Errorf("Canonicalized query of the instance #%d is wrong! Got %q (expected %q)", i+1, canonicalized,
+				instance.canonicalize)
+		}
+	}
+}
+
+// TestSynonymSearch searches the synonyms on SQLite, by the default synonym list and by a list of
+// its own (once the synonyms are refreshed).
+func TestSynonymSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "magnetico-synonyms")
+	if err != nil {
+		t.Fatalf("Could not create the temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := MakeDatabase("sqlite3://"+path.Join(dir, "database.sqlite3"), nil)
+	if err != nil {
+		t.Fatalf("Could not open the database: %s", err.Error())
+	}
+	for i, name := range []string{"The Godfather Part II", "The Godfather Part 3", "Planet Earth 4K"} {
+		infoHash := make([]byte, 20)
+		infoHash[0], infoHash[19] = 0x5e, byte(i)
+		if err = db.AddNewTorrent(infoHash, name, []File{{Size: int64(i + 1), Path: name}}, []byte("d4:name1:xe"),
+			SourceUnknown); err != nil {
+			t.Fatalf("Could not add the torrent #%d: %s", i+1, err.Error())
+		}
+	}
+
+	search := func(db Database, query string) string {
+		results, err := db.QueryTorrents(query, time.Now().Unix()+60, ByTotalSize, true, 10, nil, nil,
+			QueryFilters{}, AllFields)
+		if err != nil {
+			t.Fatalf("Could not search for `%s`: %s", query, err.Error())
+		}
+		names := make([]string, len(results))
+		for i, result := range results {
+			names[i] = result.Name
+		}
+		return fmt.Sprint(names)
+	}
+
+	for i, tc := range []struct {
+		query    string
+		expected string
+	}{
+		{"godfather part 2", "[The Godfather Part II]"},
+		{"godfather part iii", "[The Godfather Part 3]"},
+		{"earth 2160p", "[Planet Earth 4K]"},
+		{"earth 4k", "[Planet Earth 4K]"},
+	} {
+		if got := search(db, tc.query); got != tc.expected {
+			t.Errorf("The results of the query #%d are wrong! Got %s (expected %s)", i+1, got, tc.expected)
+		}
+	}
+	if err = db.Close(); err != nil {
+		t.Fatalf("Could not close the database: %s", err.Error())
+	}
+
+	list := path.Join(dir, "synonyms.txt")
+	if err = ioutil.WriteFile(list, []byte("earth, planet\n"), 0644); err != nil {
+		t.Fatalf("Could not write the synonym list: %s", err.Error())
+	}
+	db, err = MakeDatabase("sqlite3://"+path.Join(dir, "database.sqlite3")+"?synonyms="+list, nil)
+	if err != nil {
+		t.Fatalf("Could not open the database: %s", err.Error())
+	}
+	defer db.Close()
+
+	n, err := db.RefreshSynonyms()
+	if err != nil {
+		t.Fatalf("Could not refresh the synonyms: %s", err.Error())
+	}
+	// The synonyms of "Part II" and "4K" are dropped, and "Planet" is added.
+	if n != 2 {
+		t.Errorf("Number of the refreshed torrents is wrong! Got %d (expected 2)", n)
+	}
+	if got := search(db, "godfather part 2"); got != "[]" {
+		t.Errorf("The results of the stale synonym are wrong! Got %s (expected [])", got)
+	}
+	if got := search(db, "earth earth"); got != "[Planet Earth 4K]" {
+		t.Errorf("The results of the new synonym are wrong! Got %s (expected [Planet Earth 4K])", got)
+	}
+}
@@ -0,0 +1,1102 @@
+// Package tests is a test-kit that any implementation of persistence.Database can run against
+// itself, so that the engines behave alike in the ways that magneticod and magneticow rely on:
+// adding and getting the torrents, the semantics of the searches, the pagination of the results,
+// and the handling of the names and the paths in all the scripts.
+//
+// An engine is tested by calling Run from one of its tests:
+//
+//	func TestConformance(t *testing.T) {
+//		tests.Run(t, func(t *testing.T, params url.Values) persistence.Database {
+//			return ... // an empty database, whose URL has the params
+//		})
+//	}
+package tests
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// Opener returns an empty database for a test, which is closed by the test-kit. The params are
+// added to the URL of the database (see persistence.MakeDatabase), and are nil for most tests.
+type Opener func(t *testing.T, params url.Values) persistence.Database
+
+// Run runs all the tests of the test-kit, each as a subtest against a database of its own.
+func Run(t *testing.T, open Opener) {
+	params := map[string]url.Values{
+		"CJKBigrams": {"cjk_bigrams": {"true"}},
+	}
+	for _, test := range []struct {
+		name string
+		run  func(t *testing.T, db persistence.Database)
+	}{
+		{"CRUD", testCRUD},
+		{"Upsert", testUpsert},
+		{"ConcurrentAdd", testConcurrentAdd},
+		{"ClaimFetch", testClaimFetch},
+		{"Slots", testSlots},
+		{"Tx", testTx},
+		{"Search", testSearch},
+		{"Corrections", testCorrections},
+		{"Pagination", testPagination},
+		{"Unicode", testUnicode},
+		{"Favorites", testFavorites},
+		{"Interactions", testInteractions},
+		{"APIKeys", testAPIKeys},
+		{"DashboardCountries", testDashboardCountries},
+		{"CrawlerStats", testCrawlerStats},
+		{"Texts", testTexts},
+		{"ReleaseFilters", testReleaseFilters},
+		{"AlbumFacets", testAlbumFacets},
+		{"CJK", testCJK},
+		{"CJKBigrams", testCJKBigrams},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			db := open(t, params[test.name])
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Errorf("Could not close the database: %s", err.Error())
+				}
+			}()
+			test.run(t, db)
+		})
+	}
+}
+
+// torrent is a torrent to be added to the database by the tests.
+type torrent struct {
+	name  string
+	files []persistence.File
+}
+
+// infoHash derives a distinct infohash from the name of a torrent.
+func (tor torrent) infoHash() []byte {
+	sum := sha1.Sum([]byte(tor.name))
+	return sum[:]
+}
+
+func (tor torrent) size() uint64 {
+	var size uint64
+	for _, file := range tor.files {
+		size += uint64(file.Size)
+	}
+	return size
+}
+
+func addTorrents(t *testing.T, db persistence.Database, torrents []torrent) {
+	t.Helper()
+	for i, tor := range torrents {
+		metadata := []byte(fmt.Sprintf("d4:name%d:%se", len(tor.name), tor.name))
+		if err := db.AddNewTorrent(tor.infoHash(), tor.name, tor.files, metadata, persistence.SourceUnknown); err != nil {
+			t.Fatalf("Could not add the torrent #%d: %s", i+1, err.Error())
+		}
+	}
+}
+
+// epoch is the epoch of the searches, after which no torrent is added by the tests.
+func epoch() int64 {
+	return time.Now().Unix() + 60
+}
+
+// search returns the names of the torrents that match the query, ordered by their size (the
+// biggest first).
+func search(t *testing.T, db persistence.Database, query string) []string {
+	t.Helper()
+	return filter(t, db, query, persistence.QueryFilters{})
+}
+
+// filter is search with the filters.
+func filter(t *testing.T, db persistence.Database, query string, filters persistence.QueryFilters) []string {
+	t.Helper()
+	results, err := db.QueryTorrents(query, epoch(), persistence.ByTotalSize, false, 100, nil, nil, filters,
+		persistence.AllFields)
+	if err != nil {
+		t.Fatalf("Could not search for `%s`: %s", query, err.Error())
+	}
+	names := make([]string, len(results))
+	for i, result := range results {
+		names[i] = result.Name
+	}
+	return names
+}
+
+func testCRUD(t *testing.T, db persistence.Database) {
+	tor := torrent{"Ubuntu 20.04 Desktop", []persistence.File{
+		{Size: 100, Path: "ubuntu.iso"},
+		{Size: 20, Path: "docs/README"},
+		{Size: 3, Path: "docs/LICENSE"},
+	}}
+	absent := torrent{name: "absent"}
+
+	if exists, err := db.DoesTorrentExist(tor.infoHash()); err != nil || exists {
+		t.Fatalf("The torrent exists before it is added! Got %t, %v (expected false, nil)", exists, err)
+	}
+	addTorrents(t, db, []torrent{tor})
+	// Adding a torrent again must be harmless, as the crawler might fetch it twice.
+	addTorrents(t, db, []torrent{tor})
+
+	if exists, err := db.DoesTorrentExist(tor.infoHash()); err != nil || !exists {
+		t.Fatalf("The torrent does not exist after it is added! Got %t, %v (expected true, nil)", exists, err)
+	}
+	if n, err := db.GetNumberOfTorrents(); err != nil || n != 1 {
+		t.Errorf("The number of the torrents is wrong! Got %d, %v (expected 1, nil)", n, err)
+	}
+	if size, err := db.GetTotalSize(); err != nil || size != tor.size() {
+		t.Errorf("The total size of the torrents is wrong! Got %d, %v (expected %d, nil)", size, err, tor.size())
+	}
+	if n, err := db.GetNumberOfDiscoveredTorrents(time.Now().Add(-time.Hour).Unix()); err != nil || n != 1 {
+		t.Errorf("The number of the torrents discovered in the past hour is wrong! Got %d, %v (expected 1, nil)", n, err)
+	}
+	if n, err := db.GetNumberOfDiscoveredTorrents(time.Now().Add(time.Hour).Unix()); err != nil || n != 0 {
+		t.Errorf("The number of the torrents discovered in the next hour is wrong! Got %d, %v (expected 0, nil)", n, err)
+	}
+
+	got, err := db.GetTorrent(tor.infoHash())
+	if err != nil || got == nil {
+		t.Fatalf("Could not get the torrent! Got %v, %v (expected non-nil, nil)", got, err)
+	}
+	if !bytes.Equal(got.InfoHash, tor.infoHash()) || got.Name != tor.name || got.Size != tor.size() ||
+		got.NFiles != uint(len(tor.files)) {
+		t.Errorf("The torrent is wrong! Got %x %q of %d bytes in %d files (expected %x %q of %d bytes in %d files)",
+			got.InfoHash, got.Name, got.Size, got.NFiles, tor.infoHash(), tor.name, tor.size(), len(tor.files))
+	}
+	if since := time.Since(got.DiscoveredOn); since < -time.Minute || since > time.Hour {
+		t.Errorf("The torrent is discovered on a wrong time! Got %s (expected about now)", got.DiscoveredOn)
+	}
+	// The times are in UTC, at the precision of seconds.
+	if got.DiscoveredOn.Location() != time.UTC || got.DiscoveredOn.Nanosecond() != 0 {
+		t.Errorf("The time of the discovery of the torrent is not canonical! Got %s (expected %s)",
+			got.DiscoveredOn, got.DiscoveredOn.Truncate(time.Second).UTC())
+	}
+
+	if got, err = db.GetTorrent(absent.infoHash()); err != nil || got != nil {
+		t.Errorf("An absent torrent is got! Got %v, %v (expected nil, nil)", got, err)
+	}
+
+	files, err := db.GetFiles(tor.infoHash())
+	if err != nil {
+		t.Fatalf("Could not get the files: %s", err.Error())
+	}
+	if len(files) != len(tor.files) {
+		t.Fatalf("The number of the files is wrong! Got %d (expected %d)", len(files), len(tor.files))
+	}
+	for i, file := range files {
+		if file != tor.files[i] {
+			t.Errorf("The file #%d is wrong! Got %+v (expected %+v)", i+1, file, tor.files[i])
+		}
+	}
+
+	files, err = db.QueryFiles(tor.infoHash(), "DOCS/", 1, 10)
+	if err != nil {
+		t.Fatalf("Could not query the files: %s", err.Error())
+	}
+	if len(files) != 1 || files[0] != tor.files[2] {
+		t.Errorf("The files queried are wrong! Got %+v (expected %+v)", files, tor.files[2:])
+	}
+
+	files, err = db.QueryFiles(absent.infoHash(), "", 0, 10)
+	if err != nil || files == nil || len(files) != 0 {
+		t.Errorf("The files of an absent torrent are wrong! Got %+v, %v (expected [], nil)", files, err)
+	}
+}
+
+func testUpsert(t *testing.T, db persistence.Database) {
+	truncated := torrent{"Truncated Nam", []persistence.File{{Size: 10, Path: "a"}}}
+	refetched := torrent{"Refetched Name", []persistence.File{{Size: 20, Path: "b"}, {Size: 30, Path: "c/d"}}}
+
+	testCases := []struct {
+		tor      torrent
+		metadata string
+		expected bool
+	}{
+		// Added,
+		{truncated, "d4:name13:Truncated Nam", true},
+		// unchanged,
+		{truncated, "d4:name13:Truncated Nam", false},
+		// and replaced (as the infohash is of the truncated one in all cases).
+		{refetched, "d4:name14:Refetched Namee", true},
+		{refetched, "d4:name14:Refetched Namee", false},
+	}
+	for i, tc := range testCases {
+		upserted, err := db.UpsertTorrent(truncated.infoHash(), tc.tor.name, tc.tor.files, []byte(tc.metadata),
+			persistence.SourceUnknown)
+		if err != nil {
+			t.Fatalf("Could not upsert the torrent #%d: %s", i+1, err.Error())
+		}
+		if upserted != tc.expected {
+			t.Errorf("Upserting the torrent #%d is wrong! Got %t (expected %t)", i+1, upserted, tc.expected)
+		}
+	}
+
+	got, err := db.GetTorrent(truncated.infoHash())
+	if err != nil || got == nil {
+		t.Fatalf("Could not get the torrent! Got %v, %v (expected non-nil, nil)", got, err)
+	}
+	if got.Name != refetched.name || got.Size != refetched.size() || got.NFiles != uint(len(refetched.files)) {
+		t.Errorf("The torrent is wrong! Got %q of %d bytes in %d files (expected %q of %d bytes in %d files)",
+			got.Name, got.Size, got.NFiles, refetched.name, refetched.size(), len(refetched.files))
+	}
+
+	files, err := db.GetFiles(truncated.infoHash())
+	if err != nil {
+		t.Fatalf("Could not get the files: %s", err.Error())
+	}
+	if fmt.Sprint(files) != fmt.Sprint(refetched.files) {
+		t.Errorf("The files are wrong! Got %+v (expected %+v)", files, refetched.files)
+	}
+
+	// The torrent is found by its new name only.
+	if names := search(t, db, "refetched"); len(names) != 1 {
+		t.Errorf("The torrent is not found by its new name! Got %q", names)
+	}
+	if names := search(t, db, "truncated"); len(names) != 0 {
+		t.Errorf("The torrent is found by its old name! Got %q", names)
+	}
+	if n, err := db.GetNumberOfTorrents(); err != nil || n != 1 {
+		t.Errorf("The number of the torrents is wrong! Got %d, %v (expected 1, nil)", n, err)
+	}
+}
+
+// testConcurrentAdd adds the same torrent concurrently (as multiple crawlers might), all of which
+// must succeed, adding the torrent once.
+func testConcurrentAdd(t *testing.T, db persistence.Database) {
+	const nAdders = 8
+	tor := torrent{"Concurrent", []persistence.File{{Size: 1, Path: "a"}, {Size: 2, Path: "b"}}}
+	metadata := []byte("d4:name10:Concurrente")
+
+	start := make(chan struct{})
+	errs := make(chan error, nAdders)
+	var wg sync.WaitGroup
+	for i := 0; i < nAdders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- db.AddNewTorrent(tor.infoHash(), tor.name, tor.files, metadata, persistence.SourceUnknown)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Could not add the torrent concurrently: %s", err.Error())
+		}
+	}
+	if n, err := db.GetNumberOfTorrents(); err != nil || n != 1 {
+		t.Errorf("The number of the torrents is wrong! Got %d, %v (expected 1, nil)", n, err)
+	}
+	if files, err := db.GetFiles(tor.infoHash()); err != nil || len(files) != len(tor.files) {
+		t.Errorf("The files are wrong! Got %+v, %v (expected %+v, nil)", files, err, tor.files)
+	}
+}
+
+// testClaimFetch claims the fetch of a torrent by two claimants, as two crawlers would.
+func testClaimFetch(t *testing.T, db persistence.Database) {
+	infoHash := torrent{name: "Claimed"}.infoHash()
+	testCases := []struct {
+		claimant string
+		ttl      time.Duration
+		expected bool
+	}{
+		// Claimed by a,
+		{"a", time.Hour, true},
+		// not by b while the claim of a lasts,
+		{"b", time.Hour, false},
+		// by a again,
+		{"a", time.Hour, true},
+		// and by b once the claim of a is expired.
+		{"b", -time.Hour, true},
+		{"a", time.Hour, false},
+	}
+	for i, tc := range testCases {
+		claimed, err := db.ClaimFetch(infoHash, tc.claimant, tc.ttl)
+		if err != nil {
+			t.Fatalf("Could not claim the fetch #%d: %s", i+1, err.Error())
+		}
+		if claimed != tc.expected {
+			t.Errorf("Claiming the fetch #%d is wrong! Got %t (expected %t)", i+1, claimed, tc.expected)
+		}
+	}
+}
+
+// testSlots tests that the slots are held exclusively, and can be acquired again once released. It
+// is skipped for the engines that do not support the slots.
+func testSlots(t *testing.T, db persistence.Database) {
+	const n = 2
+	acquire := func() persistence.Slot {
+		slot, err := db.AcquireSlot(n)
+		if err == persistence.NotImplementedError {
+			t.Skip("The slots are not supported by the engine.")
+		} else if err != nil {
+			t.Fatalf("Could not acquire a slot: %s", err.Error())
+		}
+		return slot
+	}
+
+	first, second := acquire(), acquire()
+	if first == nil || second == nil {
+		t.Fatalf("Could not acquire the slots! Got %v and %v", first, second)
+	}
+	if first.Index() == second.Index() {
+		t.Errorf("The slots are the same! Got %d twice", first.Index())
+	}
+	if slot := acquire(); slot != nil {
+		t.Errorf("Acquired more slots than there are! Got %d", slot.Index())
+	}
+	if err := first.Check(); err != nil {
+		t.Errorf("Could not check the slot: %s", err.Error())
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatalf("Could not release the slot: %s", err.Error())
+	}
+	third := acquire()
+	if third == nil || third.Index() != first.Index() {
+		t.Errorf("The released slot is not acquired again! Got %v (expected %d)", third, first.Index())
+	}
+	for _, slot := range []persistence.Slot{second, third} {
+		if slot == nil {
+			continue
+		}
+		if err := slot.Release(); err != nil {
+			t.Errorf("Could not release the slot: %s", err.Error())
+		}
+	}
+}
+
+func testTx(t *testing.T, db persistence.Database) {
+	committed := torrent{"Committed", []persistence.File{{Size: 1, Path: "a"}}}
+	rolledBack := torrent{"Rolled Back", []persistence.File{{Size: 2, Path: "b"}}}
+	nested := torrent{"Nested", []persistence.File{{Size: 3, Path: "c"}}}
+	errRollback := errors.New("rollback")
+
+	err := db.WithTx(func(tx persistence.Database) error {
+		addTorrents(t, tx, []torrent{committed})
+		if _, err := tx.SetModerationState(committed.infoHash(), persistence.Flagged); err != nil {
+			return err
+		}
+
+		// The nested transaction is rolled back on its own.
+		if err := tx.WithTx(func(tx persistence.Database) error {
+			addTorrents(t, tx, []torrent{nested})
+			return errRollback
+		}); err != errRollback {
+			t.Errorf("The error of the nested transaction is wrong! Got %v (expected %v)", err, errRollback)
+		}
+
+		// The transaction sees its own changes.
+		if exists, err := tx.DoesTorrentExist(committed.infoHash()); err != nil || !exists {
+			t.Errorf("The transaction does not see its own torrent! Got %t, %v (expected true, nil)", exists, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Could not commit the transaction: %s", err.Error())
+	}
+
+	if err = db.WithTx(func(tx persistence.Database) error {
+		addTorrents(t, tx, []torrent{rolledBack})
+		return errRollback
+	}); err != errRollback {
+		t.Errorf("The error of the transaction is wrong! Got %v (expected %v)", err, errRollback)
+	}
+
+	for i, tc := range []struct {
+		tor      torrent
+		expected bool
+	}{
+		{committed, true},
+		{rolledBack, false},
+		{nested, false},
+	} {
+		if exists, err := db.DoesTorrentExist(tc.tor.infoHash()); err != nil || exists != tc.expected {
+			t.Errorf("The existence of the torrent #%d is wrong! Got %t, %v (expected %t, nil)", i+1, exists, err,
+				tc.expected)
+		}
+	}
+
+	got, err := db.GetTorrent(committed.infoHash())
+	if err != nil || got == nil {
+		t.Fatalf("Could not get the torrent! Got %v, %v (expected non-nil, nil)", got, err)
+	}
+	if got.Moderation != persistence.Flagged {
+		t.Errorf("The moderation of the torrent is wrong! Got %v (expected %v)", got.Moderation, persistence.Flagged)
+	}
+}
+
+func testSearch(t *testing.T, db persistence.Database) {
+	addTorrents(t, db, []torrent{
+		{"Ubuntu 20.04 Desktop amd64", []persistence.File{{Size: 400, Path: "ubuntu.iso"}}},
+		{"Ubuntu 20.04 Server amd64", []persistence.File{{Size: 300, Path: "ubuntu.iso"}}},
+		{"Debian 10 Netinst amd64", []persistence.File{{Size: 200, Path: "debian.iso"}}},
+		{"Debian 10 Desktop i386", []persistence.File{{Size: 100, Path: "debian.iso"}}},
+	})
+
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{"ubuntu", []string{"Ubuntu 20.04 Desktop amd64", "Ubuntu 20.04 Server amd64"}},
+		// The searches are case-insensitive.
+		{"DEBIAN", []string{"Debian 10 Netinst amd64", "Debian 10 Desktop i386"}},
+		// All the words must match, in any order.
+		{"desktop debian", []string{"Debian 10 Desktop i386"}},
+		{"amd64", []string{"Ubuntu 20.04 Desktop amd64", "Ubuntu 20.04 Server amd64", "Debian 10 Netinst amd64"}},
+		{"fedora", []string{}},
+		// All the torrents are listed if the query is empty.
+		{"", []string{"Ubuntu 20.04 Desktop amd64", "Ubuntu 20.04 Server amd64", "Debian 10 Netinst amd64",
+			"Debian 10 Desktop i386"}},
+	}
+
+	for i, tc := range testCases {
+		got := search(t, db, tc.query)
+		if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+			t.Errorf("The results of the query #%d (`%s`) are wrong! Got %q (expected %q)", i+1, tc.query,
+				got, tc.expected)
+		}
+	}
+
+	// The torrents cannot be ordered by relevance without a query.
+	if _, err := db.QueryTorrents("", epoch(), persistence.ByRelevance, false, 10, nil, nil,
+		persistence.QueryFilters{}, persistence.AllFields); err == nil {
+		t.Errorf("The torrents are ordered by relevance without a query!")
+	}
+	// Nor can a search be continued from a cursor of which only a half is supplied.
+	lastID := uint64(1)
+	if _, err := db.QueryTorrents("ubuntu", epoch(), persistence.ByTotalSize, false, 10, nil, &lastID,
+		persistence.QueryFilters{}, persistence.AllFields); err == nil {
+		t.Errorf("The search is continued from a half of a cursor!")
+	}
+}
+
+func testCorrections(t *testing.T, db persistence.Database) {
+	addTorrents(t, db, []torrent{
+		{"Classic Movies Collection", []persistence.File{{Size: 1, Path: "a"}}},
+		{"Silent Movies", []persistence.File{{Size: 2, Path: "b"}}},
+	})
+
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{"silent moveis", []string{"silent movies"}}, // not stemmed (i.e. "movi")
+		{"clasic movies", []string{"classic movies"}},
+		{"classic movies", []string{}},
+		{"movie", []string{}}, // matches "movies" after all
+		{"zzzzzzzz", []string{}},
+	}
+	for i, tc := range testCases {
+		corrections, err := db.GetCorrections(tc.query, 1)
+		if err != nil {
+			t.Fatalf("Could not get the corrections of the query #%d: %s", i+1, err.Error())
+		}
+		if fmt.Sprint(corrections) != fmt.Sprint(tc.expected) {
+			t.Errorf("The corrections of the query #%d are wrong! Got %q (expected %q)", i+1, corrections, tc.expected)
+		}
+	}
+}
+
+func testPagination(t *testing.T, db persistence.Database) {
+	// The sizes repeat so that the torrents of the same size are ordered (and paginated) by their
+	// IDs as well.
+	const nTorrents = 25
+	torrents := make([]torrent, nTorrents)
+	for i := range torrents {
+		torrents[i] = torrent{fmt.Sprintf("Paginated %02d", i), []persistence.File{{Size: int64(1 + i%7), Path: "file"}}}
+	}
+	addTorrents(t, db, torrents)
+	// So do the popularities.
+	for i, tor := range torrents {
+		for j := 0; j < i%5; j++ {
+			if _, err := db.AddInteraction(tor.infoHash(), persistence.InteractionMagnet, time.Now().Unix()); err != nil {
+				t.Fatalf("Could not add the interaction with the torrent #%d: %s", i+1, err.Error())
+			}
+		}
+	}
+
+	for _, orderBy := range []persistence.OrderingCriteria{persistence.ByTotalSize, persistence.ByDiscoveredOn,
+		persistence.ByNFiles, persistence.ByPopularity} {
+		for _, ascending := range []bool{true, false} {
+			for _, query := range []string{"", "paginated"} {
+				testPages(t, db, query, orderBy, ascending, nTorrents)
+			}
+		}
+	}
+}
+
+// testPages pages through the results of the query, 10 at a time, checking that each torrent is
+// returned exactly once and in the order.
+func testPages(t *testing.T, db persistence.Database, query string, orderBy persistence.OrderingCriteria,
+	ascending bool, nTorrents int) {
+	t.Helper()
+
+	seen := make(map[uint64]bool)
+	var lastOrderedValue *float64
+	var lastID *uint64
+	var previous *persistence.TorrentMetadata
+	for page := 0; ; page++ {
+		results, err := db.QueryTorrents(query, epoch(), orderBy, ascending, 10, lastOrderedValue, lastID,
+			persistence.QueryFilters{}, persistence.AllFields)
+		if err != nil {
+			t.Fatalf("Could not get the page #%d of `%s` by %d (ascending: %t): %s", page+1, query, orderBy,
+				ascending, err.Error())
+		}
+		if len(results) == 0 {
+			break
+		}
+
+		for i := range results {
+			result := &results[i]
+			if seen[result.ID] {
+				t.Fatalf("The torrent %q is returned twice for `%s` by %d (ascending: %t)!", result.Name, query,
+					orderBy, ascending)
+			}
+			seen[result.ID] = true
+
+			if previous != nil && !inOrder(previous, result, orderBy, ascending) {
+				t.Errorf("The torrents %q and %q are out of order for `%s` by %d (ascending: %t)!", previous.Name,
+					result.Name, query, orderBy, ascending)
+			}
+			previous = result
+		}
+
+		value := orderedValue(previous, orderBy)
+		lastOrderedValue, lastID = &value, &previous.ID
+	}
+
+	if len(seen) != nTorrents {
+		t.Errorf("The number of the torrents paginated for `%s` by %d (ascending: %t) is wrong! Got %d (expected %d)",
+			query, orderBy, ascending, len(seen), nTorrents)
+	}
+}
+
+// orderedValue returns the value of the torrent that the torrents are ordered by, as the cursor of
+// the next page.
+func orderedValue(torrent *persistence.TorrentMetadata, orderBy persistence.OrderingCriteria) float64 {
+	switch orderBy {
+	case persistence.ByTotalSize:
+		return float64(torrent.Size)
+	case persistence.ByDiscoveredOn:
+		return float64(torrent.DiscoveredOn.Unix())
+	case persistence.ByNFiles:
+		return float64(torrent.NFiles)
+	case persistence.ByPopularity:
+		return float64(torrent.Popularity)
+	default:
+		panic(fmt.Sprintf("the torrents cannot be paginated by %d in the test-kit", orderBy))
+	}
+}
+
+// inOrder returns true if the torrent b may follow the torrent a.
+func inOrder(a, b *persistence.TorrentMetadata, orderBy persistence.OrderingCriteria, ascending bool) bool {
+	va, vb := orderedValue(a, orderBy), orderedValue(b, orderBy)
+	if ascending {
+		return va < vb || va == vb && a.ID < b.ID
+	}
+	return va > vb || va == vb && a.ID > b.ID
+}
+
+func testUnicode(t *testing.T, db persistence.Database) {
+	torrents := []torrent{
+		{"Ünïcödé Ñames", []persistence.File{{Size: 1, Path: "Ünïcödé/Ñames.txt"}}},
+		{"Сборник классики", []persistence.File{{Size: 2, Path: "Классика/01 — Увертюра.flac"}}},
+		{"東京 ガイド", []persistence.File{{Size: 3, Path: "東京/ガイド.pdf"}}},
+		{"Emoji 🎉 party", []persistence.File{{Size: 4, Path: "🎉/party.mp4"}}},
+		{"Le Fabuleux Destin d'Amélie Poulain", []persistence.File{{Size: 5, Path: "Amélie.mkv"}}},
+	}
+	addTorrents(t, db, torrents)
+
+	// The names and the paths must be returned byte for byte.
+	for i, tor := range torrents {
+		got, err := db.GetTorrent(tor.infoHash())
+		if err != nil || got == nil {
+			t.Fatalf("Could not get the torrent #%d! Got %v, %v (expected non-nil, nil)", i+1, got, err)
+		}
+		if got.Name != tor.name {
+			t.Errorf("The name of the torrent #%d is wrong! Got %q (expected %q)", i+1, got.Name, tor.name)
+		}
+
+		files, err := db.GetFiles(tor.infoHash())
+		if err != nil {
+			t.Fatalf("Could not get the files of the torrent #%d: %s", i+1, err.Error())
+		}
+		if len(files) != 1 || files[0] != tor.files[0] {
+			t.Errorf("The files of the torrent #%d are wrong! Got %+v (expected %+v)", i+1, files, tor.files)
+		}
+	}
+
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{"ünïcödé", []string{"Ünïcödé Ñames"}},
+		{"сборник", []string{"Сборник классики"}},
+		{"party", []string{"Emoji 🎉 party"}},
+		// The searches are accent-insensitive, either way.
+		{"amelie", []string{"Le Fabuleux Destin d'Amélie Poulain"}},
+		{"AMÉLIE poulain", []string{"Le Fabuleux Destin d'Amélie Poulain"}},
+		{"unicode names", []string{"Ünïcödé Ñames"}},
+	}
+	for i, tc := range testCases {
+		got := search(t, db, tc.query)
+		if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+			t.Errorf("The results of the query #%d (`%s`) are wrong! Got %q (expected %q)", i+1, tc.query,
+				got, tc.expected)
+		}
+	}
+}
+
+func testFavorites(t *testing.T, db persistence.Database) {
+	torrents := []torrent{
+		{"Favorite One", []persistence.File{{Size: 1, Path: "a"}}},
+		{"Favorite Two", []persistence.File{{Size: 2, Path: "b"}}},
+		{"Favorite Flagged", []persistence.File{{Size: 3, Path: "c"}}},
+	}
+	addTorrents(t, db, torrents)
+	if _, err := db.SetModerationState(torrents[2].infoHash(), persistence.Flagged); err != nil {
+		t.Fatalf("Could not flag the torrent: %s", err.Error())
+	}
+
+	testCases := []struct {
+		remove   bool
+		username string
+		infoHash []byte
+		expected bool
+	}{
+		{false, "alice", torrents[0].infoHash(), true},
+		{false, "alice", torrents[0].infoHash(), true}, // adding a favorite again is a no-op
+		{false, "alice", torrents[1].infoHash(), true},
+		{false, "alice", torrents[2].infoHash(), true},
+		{false, "alice", make([]byte, 20), false}, // no such torrent
+		{false, "bob", torrents[1].infoHash(), true},
+		{true, "bob", torrents[1].infoHash(), true},
+		{true, "bob", torrents[1].infoHash(), false},
+		{true, "bob", torrents[0].infoHash(), false},
+	}
+	for i, tc := range testCases {
+		var got bool
+		var err error
+		if tc.remove {
+			got, err = db.RemoveFavorite(tc.username, tc.infoHash)
+		} else {
+			got, err = db.AddFavorite(tc.username, tc.infoHash)
+		}
+		if err != nil {
+			t.Fatalf("Could not change the favorite #%d: %s", i+1, err.Error())
+		}
+		if got != tc.expected {
+			t.Errorf("The result of the change #%d is wrong! Got %t (expected %t)", i+1, got, tc.expected)
+		}
+	}
+
+	for i, tc := range []struct {
+		username string
+		infoHash []byte
+		expected bool
+	}{
+		{"alice", torrents[0].infoHash(), true},
+		{"alice", torrents[2].infoHash(), true},
+		{"bob", torrents[1].infoHash(), false},
+		{"", torrents[0].infoHash(), false},
+	} {
+		got, err := db.IsFavorite(tc.username, tc.infoHash)
+		if err != nil {
+			t.Fatalf("Could not check the favorite #%d: %s", i+1, err.Error())
+		}
+		if got != tc.expected {
+			t.Errorf("Whether the torrent #%d is a favorite is wrong! Got %t (expected %t)", i+1, got, tc.expected)
+		}
+	}
+
+	// The flagged torrents are not listed, and the favorites are listed the most recent first (the ties
+	// are broken by the most recently added torrent first).
+	favorites, err := db.GetFavorites("alice", 10)
+	if err != nil {
+		t.Fatalf("Could not get the favorites: %s", err.Error())
+	}
+	names := make([]string, len(favorites))
+	for i, favorite := range favorites {
+		names[i] = favorite.Torrent.Name
+		if favorite.FavoritedOn <= 0 {
+			t.Errorf("The time of the favorite #%d is wrong! Got %d", i+1, favorite.FavoritedOn)
+		}
+	}
+	if expected := []string{"Favorite Two", "Favorite One"}; fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("The favorites are wrong! Got %q (expected %q)", names, expected)
+	}
+
+	if favorites, err = db.GetFavorites("bob", 10); err != nil || favorites == nil || len(favorites) != 0 {
+		t.Errorf("The favorites of bob are wrong! Got %v, %v (expected [], nil)", favorites, err)
+	}
+}
+
+func testInteractions(t *testing.T, db persistence.Database) {
+	popular, unpopular := torrent{"Popular", []persistence.File{{Size: 1, Path: "a"}}},
+		torrent{"Unpopular", []persistence.File{{Size: 2, Path: "b"}}}
+	addTorrents(t, db, []torrent{popular, unpopular})
+
+	const day = 86400
+	today := time.Now().Unix() / day * day
+	testCases := []struct {
+		infoHash    []byte
+		interaction persistence.Interaction
+		on          int64
+		expected    bool
+	}{
+		{popular.infoHash(), persistence.InteractionMagnet, today - day + 1, true},
+		{popular.infoHash(), persistence.InteractionMagnet, today + 1, true},
+		{popular.infoHash(), persistence.InteractionDownload, today + day - 1, true},
+		{popular.infoHash(), persistence.InteractionMagnet, today - 3*day, true},
+		{make([]byte, 20), persistence.InteractionMagnet, today, false}, // no such torrent
+	}
+	for i, tc := range testCases {
+		got, err := db.AddInteraction(tc.infoHash, tc.interaction, tc.on)
+		if err != nil {
+			t.Fatalf("Could not add the interaction #%d: %s", i+1, err.Error())
+		}
+		if got != tc.expected {
+			t.Errorf("The result of the interaction #%d is wrong! Got %t (expected %t)", i+1, got, tc.expected)
+		}
+	}
+
+	// The interactions of the days before the one of @from are omitted.
+	interactions, err := db.GetInteractions(popular.infoHash(), today-day+100)
+	if err != nil {
+		t.Fatalf("Could not get the interactions: %s", err.Error())
+	}
+	expected := []persistence.Interactions{
+		{Day: today - day, NMagnets: 1},
+		{Day: today, NMagnets: 1, NDownloads: 1},
+	}
+	if fmt.Sprint(interactions) != fmt.Sprint(expected) {
+		t.Errorf("The interactions are wrong! Got %+v (expected %+v)", interactions, expected)
+	}
+	if interactions, err = db.GetInteractions(unpopular.infoHash(), 0); err != nil || interactions == nil ||
+		len(interactions) != 0 {
+		t.Errorf("The interactions of the unpopular torrent are wrong! Got %v, %v (expected [], nil)",
+			interactions, err)
+	}
+
+	got, err := db.GetTorrent(popular.infoHash())
+	if err != nil || got == nil {
+		t.Fatalf("Could not get the torrent! Got %v, %v (expected non-nil, nil)", got, err)
+	}
+	if got.Popularity != 4 {
+		t.Errorf("The popularity of the torrent is wrong! Got %d (expected 4)", got.Popularity)
+	}
+
+	results, err := db.QueryTorrents("", epoch(), persistence.ByPopularity, false, 10, nil, nil,
+		persistence.QueryFilters{}, persistence.FieldPopularity)
+	if err != nil {
+		t.Fatalf("Could not order the torrents by their popularities: %s", err.Error())
+	}
+	if len(results) != 2 || results[0].Name != popular.name || results[0].Popularity != 4 ||
+		results[1].Popularity != 0 {
+		t.Errorf("The torrents ordered by their popularities are wrong! Got %+v", results)
+	}
+
+	metadata, err := db.GetMetadata(popular.infoHash())
+	if expected := fmt.Sprintf("d4:name%d:%se", len(popular.name), popular.name); err != nil ||
+		string(metadata) != expected {
+		t.Errorf("The metadata is wrong! Got %q, %v (expected %q, nil)", metadata, err, expected)
+	}
+	if metadata, err = db.GetMetadata(make([]byte, 20)); err != nil || metadata != nil {
+		t.Errorf("The metadata of a torrent that does not exist is wrong! Got %q, %v (expected nil, nil)",
+			metadata, err)
+	}
+}
+
+func testAPIKeys(t *testing.T, db persistence.Database) {
+	const day = 86400
+	today := time.Now().Unix() / day * day
+	limits := persistence.APIKeyLimits{RequestsPerMinute: 60, RowsPerDay: 1000}
+
+	alice, err := db.AddAPIKey("alice", []byte("hash of alice"), limits, today)
+	if err != nil {
+		t.Fatalf("Could not add the API key of alice: %s", err.Error())
+	}
+	bob, err := db.AddAPIKey("bob", []byte("hash of bob"), persistence.APIKeyLimits{}, today+1)
+	if err != nil {
+		t.Fatalf("Could not add the API key of bob: %s", err.Error())
+	}
+	if _, err = db.AddAPIKey("eve", []byte("hash of alice"), limits, today); err == nil {
+		t.Errorf("An API key of the same hash is added again!")
+	}
+
+	// The usage of the days other than the one of @on is not counted.
+	usages := []struct {
+		nRequests, nRows uint64
+		on               int64
+	}{
+		{1, 20, today + 10},
+		{1, 0, today + day - 1},
+		{1, 500, today - 1},
+	}
+	for i, u := range usages {
+		if err = db.AddAPIKeyUsage(alice, u.nRequests, u.nRows, u.on); err != nil {
+			t.Fatalf("Could not add the usage #%d: %s", i+1, err.Error())
+		}
+	}
+
+	key, err := db.GetAPIKey([]byte("hash of alice"), today+100)
+	if err != nil || key == nil {
+		t.Fatalf("Could not get the API key! Got %v, %v (expected non-nil, nil)", key, err)
+	}
+	expected := persistence.APIKey{ID: alice, Name: "alice", APIKeyLimits: limits, CreatedOn: today,
+		NRequests: 2, NRows: 20}
+	if *key != expected {
+		t.Errorf("The API key is wrong! Got %+v (expected %+v)", *key, expected)
+	}
+	if key, err = db.GetAPIKey([]byte("hash of nobody"), today); err != nil || key != nil {
+		t.Errorf("The API key that does not exist is wrong! Got %v, %v (expected nil, nil)", key, err)
+	}
+
+	limits = persistence.APIKeyLimits{RequestsPerMinute: 10}
+	if ok, err := db.UpdateAPIKey(alice, limits); err != nil || !ok {
+		t.Errorf("Could not update the API key! Got %t, %v (expected true, nil)", ok, err)
+	}
+	if ok, err := db.UpdateAPIKey(bob+100, limits); err != nil || ok {
+		t.Errorf("The update of the API key that does not exist is wrong! Got %t, %v (expected false, nil)",
+			ok, err)
+	}
+
+	if ok, err := db.RevokeAPIKey(bob, today+2); err != nil || !ok {
+		t.Errorf("Could not revoke the API key! Got %t, %v (expected true, nil)", ok, err)
+	}
+	if ok, err := db.RevokeAPIKey(bob, today+3); err != nil || ok {
+		t.Errorf("The API key is revoked again! Got %t, %v (expected false, nil)", ok, err)
+	}
+
+	keys, err := db.GetAPIKeys(today)
+	if err != nil {
+		t.Fatalf("Could not get the API keys: %s", err.Error())
+	}
+	expectedKeys := []persistence.APIKey{
+		{ID: bob, Name: "bob", CreatedOn: today + 1, RevokedOn: today + 2},
+		{ID: alice, Name: "alice", APIKeyLimits: limits, CreatedOn: today, NRequests: 2, NRows: 20},
+	}
+	if fmt.Sprint(keys) != fmt.Sprint(expectedKeys) {
+		t.Errorf("The API keys are wrong! Got %+v (expected %+v)", keys, expectedKeys)
+	}
+}
+
+// testDashboardCountries counts the torrents discovered by the countries of their peers.
+func testDashboardCountries(t *testing.T, db persistence.Database) {
+	torrents := []torrent{
+		{"Turkish One", []persistence.File{{Size: 1, Path: "a"}}},
+		{"Turkish Two", []persistence.File{{Size: 2, Path: "b"}}},
+		{"German", []persistence.File{{Size: 3, Path: "c"}}},
+		{"Nowhere", []persistence.File{{Size: 4, Path: "d"}}},
+	}
+	addTorrents(t, db, torrents)
+	for i, country := range []string{"TR", "TR", "DE", ""} {
+		discovery := persistence.Discovery{On: time.Now(), Country: country}
+		if err := db.AddDiscovery(torrents[i].infoHash(), discovery); err != nil {
+			t.Fatalf("Could not add the discovery #%d: %s", i+1, err.Error())
+		}
+	}
+
+	dashboard, err := db.GetDashboard(time.Now().Add(-time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("Could not get the dashboard: %s", err.Error())
+	}
+	expected := map[string]uint64{"TR": 2, "DE": 1}
+	if !reflect.DeepEqual(dashboard.Countries, expected) {
+		t.Errorf("The countries are wrong! Got %v (expected %v)", dashboard.Countries, expected)
+	}
+}
+
+// testCrawlerStats adds the statistics of the crawlers in several hours, some of which are of the
+// same hour.
+func testCrawlerStats(t *testing.T, db persistence.Database) {
+	now := time.Now().Unix()
+	hour := now - now%3600
+	for i, stats := range []persistence.CrawlerStats{
+		{Hour: hour - 2*3600, NTrawled: 100, NFetched: 10},
+		{Hour: hour + 59, NTrawled: 5, NFetched: 1},
+		{Hour: hour + 3599, NTrawled: 7, NFetched: 2},
+		{Hour: hour - int64(persistence.MaxCrawlerStatsWindow.Seconds()) - 3600, NTrawled: 1},
+	} {
+		if err := db.AddCrawlerStats(stats); err != nil {
+			t.Fatalf("Could not add the crawler stats #%d: %s", i+1, err.Error())
+		}
+	}
+
+	stats, err := db.GetCrawlerStats(0)
+	if err != nil {
+		t.Fatalf("Could not get the crawler stats: %s", err.Error())
+	}
+	expected := []persistence.CrawlerStats{
+		{Hour: hour - 2*3600, NTrawled: 100, NFetched: 10},
+		{Hour: hour, NTrawled: 12, NFetched: 3},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("The crawler stats are wrong! Got %+v (expected %+v)", stats, expected)
+	}
+
+	if stats, err = db.GetCrawlerStats(hour - 3600); err != nil {
+		t.Fatalf("Could not get the recent crawler stats: %s", err.Error())
+	} else if len(stats) != 1 || stats[0].Hour != hour {
+		t.Errorf("The recent crawler stats are wrong! Got %+v", stats)
+	}
+}
+
+// testTexts stores the text of a torrent, and searches the words that are only in it.
+func testTexts(t *testing.T, db persistence.Database) {
+	tor := torrent{"Some.Release-GROUP", []persistence.File{{Size: 4096, Path: "some.nfo"}}}
+	addTorrents(t, db, []torrent{tor})
+
+	text := persistence.TorrentText{Path: "some.nfo", Content: "Greetings to our friends at Zanzibar"}
+	if err := db.SetText(tor.infoHash(), text); err != nil {
+		t.Fatalf("Could not set the text: %s", err.Error())
+	}
+	tooLong := persistence.TorrentText{Path: "some.nfo", Content: strings.Repeat("x", persistence.MaxTextSize+1)}
+	if err := db.SetText(tor.infoHash(), tooLong); err == nil {
+		t.Errorf("The text longer than MaxTextSize is set!")
+	}
+
+	if names := search(t, db, "zanzibar"); fmt.Sprint(names) != fmt.Sprint([]string{tor.name}) {
+		t.Errorf("The results of the text are wrong! Got %q (expected [%q])", names, tor.name)
+	}
+
+	got, err := db.GetTorrent(tor.infoHash())
+	if err != nil || got == nil {
+		t.Fatalf("Could not get the torrent! Got %v, %v (expected non-nil, nil)", got, err)
+	}
+	if got.Text == nil || *got.Text != text {
+		t.Errorf("The text of the torrent is wrong! Got %+v (expected %+v)", got.Text, text)
+	}
+}
+
+// testReleaseFilters filters the torrents by their releases (see persistence.ParseRelease).
+func testReleaseFilters(t *testing.T, db persistence.Database) {
+	torrents := []torrent{
+		{"The.Matrix.1999.1080p.BluRay.x264-GROUP", []persistence.File{{Size: 500, Path: "a.mkv"}}},
+		{"The.Matrix.1999.2160p.UHD.BluRay.x265-OTHER", []persistence.File{{Size: 400, Path: "b.mkv"}}},
+		{"Breaking.Bad.S05E14.720p.HDTV.x264-IMMERSE", []persistence.File{{Size: 300, Path: "c.mkv"}}},
+		{"Breaking.Bad.S05E15.1080p.WEB-DL.H.264", []persistence.File{{Size: 200, Path: "d.mkv"}}},
+		{"ubuntu desktop", []persistence.File{{Size: 100, Path: "ubuntu.iso"}}},
+	}
+	addTorrents(t, db, torrents)
+	year, season, episode := 1999, 5, 15
+
+	testCases := []struct {
+		filters  persistence.QueryFilters
+		expected []string
+	}{
+		{persistence.QueryFilters{Resolution: "1080p"}, []string{torrents[0].name, torrents[3].name}},
+		{persistence.QueryFilters{Resolution: "4K"}, []string{torrents[1].name}},
+		{persistence.QueryFilters{Codec: "H.264", Year: &year}, []string{torrents[0].name}},
+		{persistence.QueryFilters{ReleaseGroup: "immerse"}, []string{torrents[2].name}},
+		{persistence.QueryFilters{Season: &season}, []string{torrents[2].name, torrents[3].name}},
+		{persistence.QueryFilters{Season: &season, Episode: &episode}, []string{torrents[3].name}},
+	}
+
+	for i, tc := range testCases {
+		got := filter(t, db, "", tc.filters)
+		if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+			t.Errorf("The results of the filters #%d are wrong! Got %q (expected %q)", i+1, got, tc.expected)
+		}
+	}
+
+	got, err := db.GetTorrent(torrents[2].infoHash())
+	if err != nil || got == nil {
+		t.Fatalf("Could not get the torrent! Got %v, %v (expected non-nil, nil)", got, err)
+	}
+	if got.Release == nil || got.Release.Title != "Breaking Bad" || got.Release.Episode != 14 {
+		t.Errorf("The release of the torrent is wrong! Got %+v", got.Release)
+	}
+}
+
+// testAlbumFacets filters the torrents by their albums (see persistence.ParseAlbum), and counts
+// their artists and albums.
+func testAlbumFacets(t *testing.T, db persistence.Database) {
+	torrents := []torrent{
+		{"Queen - Greatest Hits [FLAC]", []persistence.File{{Size: 500, Path: "01 - Bohemian Rhapsody.flac"}}},
+		{"Queen - Greatest Hits (2011 Remaster) [MP3]",
+			[]persistence.File{{Size: 400, Path: "01 - Bohemian Rhapsody.mp3"}}},
+		{"Queen - A Night at the Opera", []persistence.File{{Size: 300, Path: "01 - Death on Two Legs.flac"}}},
+		{"ABBA - Gold", []persistence.File{{Size: 200, Path: "01 - Dancing Queen.flac"}}},
+		{"Queen Live Concert 1986", []persistence.File{{Size: 100, Path: "Queen.Live.1986.mkv"}}},
+	}
+	addTorrents(t, db, torrents)
+
+	got := filter(t, db, "", persistence.QueryFilters{Artist: "queen", Album: "Greatest Hits"})
+	if expected := []string{torrents[0].name, torrents[1].name}; fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("The results of the album are wrong! Got %q (expected %q)", got, expected)
+	}
+
+	facets, err := db.GetFacets("queen", epoch(), persistence.QueryFilters{})
+	if err != nil {
+		t.Fatalf("Could not get the facets: %s", err.Error())
+	}
+	if got := fmt.Sprint(facets.TopArtists); got != "[{Queen 3}]" {
+		t.Errorf("The top artists are wrong! Got %s (expected [{Queen 3}])", got)
+	}
+	if got := fmt.Sprint(facets.TopAlbums); got != "[{Queen Greatest Hits 2} {Queen A Night at the Opera 1}]" {
+		t.Errorf("The top albums are wrong! Got %s", got)
+	}
+}
+
+// cjkTorrents are the torrents of testCJK and testCJKBigrams, whose CJK names are a single word
+// each to the full-text indices.
+var cjkTorrents = []torrent{
+	{"東京ガイド", []persistence.File{{Size: 300, Path: "東京ガイド.pdf"}}},
+	{"京都ガイド", []persistence.File{{Size: 200, Path: "京都ガイド.pdf"}}},
+	{"Ubuntu 20.04", []persistence.File{{Size: 100, Path: "ubuntu.iso"}}},
+}
+
+// testCJK searches the CJK names by their words without the bigrams, where only the words of (up
+// to) two characters are found.
+func testCJK(t *testing.T, db persistence.Database) {
+	testCJKSearch(t, db, []struct {
+		query    string
+		expected []string
+	}{
+		{"東京", []string{"東京ガイド"}},
+		{"ガイド", []string{}},
+		{"東京ガイド", []string{"東京ガイド"}},
+		{"ubuntu", []string{"Ubuntu 20.04"}},
+	})
+}
+
+// testCJKBigrams searches the CJK names by their words with the bigrams (see cjk_bigrams), where
+// the words of any length are found.
+func testCJKBigrams(t *testing.T, db persistence.Database) {
+	testCJKSearch(t, db, []struct {
+		query    string
+		expected []string
+	}{
+		{"東京", []string{"東京ガイド"}},
+		{"ガイド", []string{"東京ガイド", "京都ガイド"}},
+		{"東京ガイド", []string{"東京ガイド"}},
+		{"ubuntu", []string{"Ubuntu 20.04"}},
+	})
+}
+
+func testCJKSearch(t *testing.T, db persistence.Database, testCases []struct {
+	query    string
+	expected []string
+}) {
+	addTorrents(t, db, cjkTorrents)
+	for i, tc := range testCases {
+		got := search(t, db, tc.query)
+		if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+			t.Errorf("The results of the query #%d (`%s`) are wrong! Got %q (expected %q)", i+1, tc.query,
+				got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package persistence
+
+// TorrentText is the contents of a small text file of a torrent (such as its .nfo), which is fetched
+// from the peers only if opted in (see the --index-texts flag of magneticod), and is searched along
+// with the name of the torrent.
+type TorrentText struct {
+	// Path is the path of the file in the torrent.
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// MaxTextSize is the maximum size (in bytes) of the contents of a TorrentText.
+const MaxTextSize = 1024 * 1024
+
+// IsTextFile returns true if the file of the path is of the text files that can be fetched as the
+// TorrentText of a torrent: the .nfo files, and the .txt files.
+func IsTextFile(path string) bool {
+	switch fileExtension(path) {
+	case "nfo", "txt":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,240 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultQueryTimeout is the default deadline of the statements (and of the transactions),
+	// after which they are cancelled, lest a runaway search pins the database.
+	defaultQueryTimeout = 30 * time.Second
+	// defaultSlowQueryThreshold is the default duration after which the statements are logged as
+	// slow.
+	defaultSlowQueryThreshold = time.Second
+)
+
+// timedConn is a connection (pool) whose statements are cancelled after the timeout, and are
+// logged (with their parameters) if they take longer than the slow query threshold. Either is
+// disabled if zero.
+//
+// The statements of a transaction are subject to the timeout of the transaction as a whole, and are
+// not logged individually.
+//
+// A timedConn that is bound to a transaction (see bind) runs all its statements in the
+// transaction, and the transactions that are begun on it are savepoints of the transaction, so
+// that the methods of the databases can be composed in a transaction (see Database.WithTx) as they
+// are.
+type timedConn struct {
+	*sql.DB
+	timeout            time.Duration
+	slowQueryThreshold time.Duration
+
+	tx *sql.Tx
+}
+
+// timedTx is a transaction begun on a timedConn, which is a savepoint if the connection is bound
+// to a transaction.
+type timedTx struct {
+	*sql.Tx
+	savepoint bool
+	done      bool
+
+	cancel context.CancelFunc // of the context of the transaction, if not a savepoint
+}
+
+// timedRows are the rows of a query, whose context is cancelled once they are closed.
+type timedRows struct {
+	*sql.Rows
+	cancel context.CancelFunc
+}
+
+func (rows *timedRows) Close() error {
+	defer rows.cancel()
+	return rows.Rows.Close()
+}
+
+// timedRow is the row of a query, whose context is cancelled once it is scanned.
+type timedRow struct {
+	*sql.Row
+	cancel context.CancelFunc
+}
+
+func (row *timedRow) Scan(dest ...interface{}) error {
+	defer row.cancel()
+	return row.Row.Scan(dest...)
+}
+
+// savepointName is the name of all the savepoints, as they are nested (and released) like a stack.
+const savepointName = "magnetico_savepoint"
+
+func (tx *timedTx) Commit() error {
+	if !tx.savepoint {
+		defer tx.cancel()
+		return tx.Tx.Commit()
+	}
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	_, err := tx.Tx.Exec("RELEASE SAVEPOINT " + savepointName + ";")
+	return err
+}
+
+func (tx *timedTx) Rollback() error {
+	if !tx.savepoint {
+		defer tx.cancel()
+		return tx.Tx.Rollback()
+	}
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	if _, err := tx.Tx.Exec("ROLLBACK TO SAVEPOINT " + savepointName + ";"); err != nil {
+		return err
+	}
+	_, err := tx.Tx.Exec("RELEASE SAVEPOINT " + savepointName + ";")
+	return err
+}
+
+func (tx *timedTx) Query(query string, args ...interface{}) (*timedRows, error) {
+	rows, err := tx.Tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &timedRows{Rows: rows, cancel: func() {}}, nil
+}
+
+// parseQueryLimits parses the query_timeout and the slow_query_threshold parameters of the URL of
+// the database (e.g. `?query_timeout=10s&slow_query_threshold=500ms`), and removes them from the
+// URL lest they are passed on to the driver.
+func parseQueryLimits(url_ *url.URL) (timeout time.Duration, slowQueryThreshold time.Duration, err error) {
+	query := url_.Query()
+	timeout, slowQueryThreshold = defaultQueryTimeout, defaultSlowQueryThreshold
+	if value := query.Get("query_timeout"); value != "" {
+		if timeout, err = time.ParseDuration(value); err != nil || timeout < 0 {
+			return 0, 0, fmt.Errorf("query_timeout must be a non-negative duration (e.g. 10s)")
+		}
+	}
+	if value := query.Get("slow_query_threshold"); value != "" {
+		if slowQueryThreshold, err = time.ParseDuration(value); err != nil || slowQueryThreshold < 0 {
+			return 0, 0, fmt.Errorf("slow_query_threshold must be a non-negative duration (e.g. 500ms)")
+		}
+	}
+
+	query.Del("query_timeout")
+	query.Del("slow_query_threshold")
+	url_.RawQuery = query.Encode()
+	return timeout, slowQueryThreshold, nil
+}
+
+// context returns the context of a statement, which must be cancelled once the statement ends
+// (i.e. once its rows are closed, or once the transaction is committed or rolled back).
+func (c *timedConn) context() (context.Context, context.CancelFunc) {
+	if c.timeout == 0 {
+		return context.Background(), func() {}
+	}
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+func (c *timedConn) Query(query string, args ...interface{}) (*timedRows, error) {
+	if c.tx != nil {
+		rows, err := c.tx.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		return &timedRows{Rows: rows, cancel: func() {}}, nil
+	}
+	defer c.logIfSlow(time.Now(), query, args)
+	ctx, cancel := c.context()
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timedRows{Rows: rows, cancel: cancel}, nil
+}
+
+func (c *timedConn) QueryRow(query string, args ...interface{}) *timedRow {
+	if c.tx != nil {
+		return &timedRow{Row: c.tx.QueryRow(query, args...), cancel: func() {}}
+	}
+	defer c.logIfSlow(time.Now(), query, args)
+	ctx, cancel := c.context()
+	return &timedRow{Row: c.DB.QueryRowContext(ctx, query, args...), cancel: cancel}
+}
+
+func (c *timedConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if c.tx != nil {
+		return c.tx.Exec(query, args...)
+	}
+	defer c.logIfSlow(time.Now(), query, args)
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.DB.ExecContext(ctx, query, args...)
+}
+
+func (c *timedConn) Begin() (*timedTx, error) {
+	if c.tx != nil {
+		if _, err := c.tx.Exec("SAVEPOINT " + savepointName + ";"); err != nil {
+			return nil, err
+		}
+		return &timedTx{Tx: c.tx, savepoint: true}, nil
+	}
+
+	ctx, cancel := c.context()
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timedTx{Tx: tx, cancel: cancel}, nil
+}
+
+// unlimited returns the connection whose statements are not subject to the timeout, for the
+// maintenance of the whole database (like the migrations).
+func (c *timedConn) unlimited() *timedConn {
+	return &timedConn{DB: c.DB, slowQueryThreshold: c.slowQueryThreshold, tx: c.tx}
+}
+
+// bind returns the connection bound to the transaction.
+func (c *timedConn) bind(tx *timedTx) *timedConn {
+	return &timedConn{DB: c.DB, timeout: c.timeout, slowQueryThreshold: c.slowQueryThreshold, tx: tx.Tx}
+}
+
+// Close closes the connection pool, unless the connection is bound to a transaction.
+func (c *timedConn) Close() error {
+	if c.tx != nil {
+		return fmt.Errorf("the database of a transaction cannot be closed")
+	}
+	return c.DB.Close()
+}
+
+// logIfSlow logs the statement if it has taken longer than the slow query threshold since it is
+// started. The duration of the queries is until their first row, as their rows are read later.
+func (c *timedConn) logIfSlow(startedOn time.Time, query string, args []interface{}) {
+	elapsed := time.Since(startedOn)
+	if c.slowQueryThreshold == 0 || elapsed < c.slowQueryThreshold {
+		return
+	}
+
+	formattedArgs := make([]string, len(args))
+	for i, arg := range args {
+		if b, ok := arg.([]byte); ok {
+			formattedArgs[i] = hex.EncodeToString(b)
+		} else {
+			formattedArgs[i] = fmt.Sprintf("%v", arg)
+		}
+	}
+	zap.L().Named("persistence").Warn("Slow query",
+		zap.Duration("elapsed", elapsed),
+		zap.String("query", strings.Join(strings.Fields(query), " ")),
+		zap.Strings("args", formattedArgs))
+}
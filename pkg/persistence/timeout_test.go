@@ -0,0 +1,94 @@
+package persistence
+
+import (
+	"database/sql"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestParseQueryLimits(t *testing.T) {
+	for i, test := range []struct {
+		rawURL                      string
+		timeout, slowQueryThreshold time.Duration
+		rawQuery                    string
+		fails                       bool
+	}{
+		{"sqlite3:///db.sqlite3?_busy_timeout=3000", defaultQueryTimeout, defaultSlowQueryThreshold, "_busy_timeout=3000", false},
+		{"sqlite3:///db.sqlite3?query_timeout=10s&_busy_timeout=3000", 10 * time.Second, defaultSlowQueryThreshold, "_busy_timeout=3000", false},
+		{"postgres://localhost/db?slow_query_threshold=0&query_timeout=0", 0, 0, "", false},
+		{"postgres://localhost/db?slow_query_threshold=500ms", defaultQueryTimeout, 500 * time.Millisecond, "", false},
+		{"postgres://localhost/db?query_timeout=10", 0, 0, "", true},
+		{"postgres://localhost/db?slow_query_threshold=-1s", 0, 0, "", true},
+	} {
+		url_, err := url.Parse(test.rawURL)
+		if err != nil {
+			t.Fatalf("Could not parse the URL of the instance #%d! %s", i+1, err.Error())
+		}
+
+		timeout, slowQueryThreshold, err := parseQueryLimits(url_)
+		if test.fails {
+			if err == nil {
+				t.Errorf("Instance #%d is parsed although it is invalid!", i+1)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Instance #%d could not be parsed! %s", i+1, err.Error())
+			continue
+		}
+		if timeout != test.timeout || slowQueryThreshold != test.slowQueryThreshold {
+			t.Errorf("Limits of the instance #%d are wrong! Got %s and %s (expected %s and %s)", i+1,
+				timeout, slowQueryThreshold, test.timeout, test.slowQueryThreshold)
+		}
+		if url_.RawQuery != test.rawQuery {
+			t.Errorf("Query of the instance #%d is wrong! Got `%s` (expected `%s`)", i+1, url_.RawQuery, test.rawQuery)
+		}
+	}
+}
+
+func TestTimedConn(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Could not open the database: %s", err.Error())
+	}
+	defer conn.Close()
+	c := &timedConn{DB: conn, timeout: 100 * time.Millisecond, slowQueryThreshold: 10 * time.Millisecond}
+
+	// Counts to a billion, which takes far longer than the timeout.
+	startedOn := time.Now()
+	_, err = c.Exec(`
+		WITH RECURSIVE counter (n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM counter WHERE n < ?)
+		SELECT COUNT(*) FROM counter;`,
+		1000000000,
+	)
+	if err == nil {
+		t.Fatalf("The statement is not cancelled!")
+	}
+	if elapsed := time.Since(startedOn); elapsed > 5*time.Second {
+		t.Errorf("The statement is cancelled too late! Got %s (expected ~100ms)", elapsed)
+	}
+
+	slow := logs.FilterMessage("Slow query").All()
+	if len(slow) != 1 {
+		t.Fatalf("The slow query is not logged! Got %d entries (expected 1)", len(slow))
+	}
+	if args := slow[0].ContextMap()["args"]; len(args.([]interface{})) != 1 {
+		t.Errorf("The arguments of the slow query are wrong! Got %v", args)
+	}
+
+	// The statements that are quick enough are neither cancelled nor logged.
+	var n int
+	if err = c.QueryRow("SELECT 1;").Scan(&n); err != nil || n != 1 {
+		t.Errorf("The quick statement failed! Got %d, %v (expected 1, nil)", n, err)
+	}
+	if logs.FilterMessage("Slow query").Len() != 1 {
+		t.Errorf("The quick statement is logged as slow!")
+	}
+}
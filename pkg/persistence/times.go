@@ -0,0 +1,41 @@
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// The times are stored by all the engines at the precision of seconds: as Unix times (INTEGER) by
+// SQLite, and as TIMESTAMP(0) WITH TIME ZONE by PostgreSQL. They cross the Database interface
+// either as Unix times (int64) or as time.Time in UTC (e.g. TorrentMetadata.DiscoveredOn), which
+// are converted to each other losslessly, so that the pages of the searches can be continued from
+// the Unix times of their last torrents. The only exception are the times of the discoveries (see
+// Discovery), which are stored at the precision of milliseconds.
+
+// now returns the current time at the precision of the databases.
+func now() time.Time {
+	return time.Now().Truncate(time.Second)
+}
+
+// fromUnix returns the Unix time as a time.Time in UTC.
+func fromUnix(t int64) time.Time {
+	return time.Unix(t, 0).UTC()
+}
+
+// timeScanner scans a time either as is (PostgreSQL) or from Unix time (SQLite, whose driver cannot
+// scan its integers into time.Time), in UTC.
+type timeScanner struct {
+	t *time.Time
+}
+
+func (ts timeScanner) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case time.Time:
+		*ts.t = src.UTC()
+	case int64:
+		*ts.t = fromUnix(src)
+	default:
+		return fmt.Errorf("cannot scan %T into time", src)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeScanner(t *testing.T) {
+	istanbul := time.FixedZone("Istanbul", 3*60*60)
+	for i, test := range []struct {
+		src      interface{}
+		expected time.Time
+		fails    bool
+	}{
+		{int64(1609459200), time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC), false},
+		{time.Date(2021, time.January, 1, 3, 0, 0, 0, istanbul), time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2021-01-01", time.Time{}, true},
+		{nil, time.Time{}, true},
+	} {
+		var got time.Time
+		err := timeScanner{&got}.Scan(test.src)
+		if test.fails {
+			if err == nil {
+				t.Errorf("Instance #%d is scanned although it is invalid!", i+1)
+			}
+		} else if err != nil {
+			t.Errorf("Instance #%d could not be scanned! %s", i+1, err.Error())
+		} else if got != test.expected {
+			t.Errorf("Time of the instance #%d is wrong! Got %s (expected %s)", i+1, got, test.expected)
+		}
+	}
+}
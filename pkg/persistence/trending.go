@@ -0,0 +1,25 @@
+package persistence
+
+import "time"
+
+// Sighting is the number of the times that a torrent has been seen on the DHT (i.e. its infohash
+// has been trawled) by the crawler, which is how active its swarm is.
+type Sighting struct {
+	InfoHash []byte
+	Count    uint
+}
+
+const (
+	// TrendingWindow is how far back the sightings are counted by UpdateTrending, beyond which they
+	// are purged.
+	TrendingWindow = 24 * time.Hour
+	// MaxTrendingTorrents is the number of the torrents that are ranked by UpdateTrending, hence the
+	// maximum @limit of GetTrendingTorrents.
+	MaxTrendingTorrents = 100
+)
+
+// sightingHour returns the start of the hour (in Unix time) of the time, by which the sightings are
+// counted.
+func sightingHour(on int64) int64 {
+	return on - on%3600
+}
@@ -0,0 +1,99 @@
+// Package service lets the daemons be managed by the service manager of their platform, namely
+// systemd on Linux and the Service Control Manager on Windows, through the `service` subcommand:
+//
+//	<DAEMON> service install [FLAGS...]
+//	<DAEMON> service uninstall
+//	<DAEMON> service unit [FLAGS...]
+//
+// where FLAGS are the flags that the daemon is started with as a service.
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	// Name is the name of the service, which is the name of the daemon as well (e.g. magneticod).
+	Name        string
+	DisplayName string
+	Description string
+}
+
+// IsCommand returns true if the command-line arguments are of the `service` subcommand.
+func IsCommand(args []string) bool {
+	return len(args) > 1 && args[1] == "service"
+}
+
+// Command runs the `service` subcommand, where args are the command-line arguments (i.e.
+// os.Args).
+func Command(config Config, args []string) error {
+	if !IsCommand(args) || len(args) < 3 {
+		return fmt.Errorf("usage: %s service install|uninstall|unit [FLAGS...]", config.Name)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "os.Executable")
+	}
+	if executable, err = filepath.Abs(executable); err != nil {
+		return errors.Wrap(err, "filepath.Abs")
+	}
+
+	subcommand, flags := args[2], args[3:]
+	switch subcommand {
+	case "install":
+		return install(config, executable, flags)
+
+	case "uninstall":
+		if len(flags) > 0 {
+			return fmt.Errorf("uninstall does not take any flags")
+		}
+		return uninstall(config)
+
+	case "unit":
+		fmt.Print(SystemdUnit(config, executable, flags))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown subcommand `%s` (expected install, uninstall, or unit)", subcommand)
+	}
+}
+
+// SystemdUnit returns the systemd unit of the daemon that is started with the given flags.
+func SystemdUnit(config Config, executable string, flags []string) string {
+	execStart := quoteSystemdArg(executable)
+	for _, flag := range flags {
+		execStart += " " + quoteSystemdArg(flag)
+	}
+
+	return fmt.Sprintf(`[Unit]
+Description=%s
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+RestartSec=10
+
+[Install]
+WantedBy=multi-user.target
+`, config.Description, execStart)
+}
+
+// quoteSystemdArg quotes the argument for the command lines of systemd, which split on the
+// whitespace and expand the specifiers (%) and the environment variables ($).
+//
+// https://www.freedesktop.org/software/systemd/man/systemd.service.html#Command%20lines
+func quoteSystemdArg(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(arg) + `"`
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const unitsDir = "/etc/systemd/system"
+
+func install(config Config, executable string, flags []string) error {
+	unit := SystemdUnit(config, executable, flags)
+	// So that the daemon uses the same (default) database as when run by the user, instead of
+	// root's.
+	if user := os.Getenv("SUDO_USER"); user != "" {
+		unit = strings.Replace(unit, "[Service]\n", "[Service]\nUser="+user+"\n", 1)
+	}
+
+	unitPath := path.Join(unitsDir, config.Name+".service")
+	if err := ioutil.WriteFile(unitPath, []byte(unit), 0644); err != nil {
+		return errors.Wrap(err, "could not write the unit (are you root?)")
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+
+	fmt.Printf("Installed %s; start it (and enable it on boot) with:\n\n    systemctl enable --now %s\n",
+		unitPath, config.Name)
+	return nil
+}
+
+func uninstall(config Config) error {
+	// The service might not be running (or enabled), which is fine.
+	_ = systemctl("disable", "--now", config.Name)
+
+	if err := os.Remove(path.Join(unitsDir, config.Name+".service")); err != nil {
+		return errors.Wrap(err, "could not remove the unit")
+	}
+	return systemctl("daemon-reload")
+}
+
+func systemctl(args ...string) error {
+	output, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "systemctl %v: %s", args, output)
+	}
+	return nil
+}
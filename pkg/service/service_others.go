@@ -0,0 +1,13 @@
+// +build !linux,!windows
+
+package service
+
+import "fmt"
+
+func install(config Config, executable string, flags []string) error {
+	return fmt.Errorf("installing as a service is not supported on this platform; see `%s service unit`", config.Name)
+}
+
+func uninstall(config Config) error {
+	return fmt.Errorf("uninstalling the service is not supported on this platform")
+}
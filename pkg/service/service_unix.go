@@ -0,0 +1,16 @@
+// +build !windows
+
+package service
+
+import "os"
+
+// Notify relays the stop requests of the service manager to c as os.Interrupt (like Ctrl-C), if
+// the daemon is started by the service manager. Stopped must be called before the daemon exits.
+//
+// systemd sends SIGTERM to stop the daemons, so there is nothing to relay; the daemons must notify
+// c of SIGTERM themselves.
+func Notify(name string, c chan<- os.Signal) {}
+
+// Stopped reports the service manager that the daemon has stopped, if it is started by the
+// service manager.
+func Stopped() {}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func install(config Config, executable string, flags []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Wrap(err, "could not connect to the service manager (are you an administrator?)")
+	}
+	defer m.Disconnect()
+
+	s, err := m.CreateService(config.Name, executable, mgr.Config{
+		DisplayName: config.DisplayName,
+		Description: config.Description,
+		StartType:   mgr.StartAutomatic,
+	}, flags...)
+	if err != nil {
+		return errors.Wrap(err, "could not create the service")
+	}
+	defer s.Close()
+
+	fmt.Printf("Installed %s; start it with:\n\n    sc start %s\n", config.Name, config.Name)
+	return nil
+}
+
+func uninstall(config Config) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Wrap(err, "could not connect to the service manager (are you an administrator?)")
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(config.Name)
+	if err != nil {
+		return errors.Wrap(err, "could not open the service")
+	}
+	defer s.Close()
+
+	// The service might not be running, which is fine.
+	_, _ = s.Control(svc.Stop)
+	return errors.Wrap(s.Delete(), "could not delete the service")
+}
+
+var stopped = struct {
+	sync.Once
+	stopped chan interface{}
+	exited  chan interface{}
+}{
+	stopped: make(chan interface{}),
+	exited:  make(chan interface{}),
+}
+
+// Notify relays the stop requests of the service manager to c as os.Interrupt (like Ctrl-C), if
+// the daemon is started by the service manager. Stopped must be called before the daemon exits.
+func Notify(name string, c chan<- os.Signal) {
+	if interactive, err := svc.IsAnInteractiveSession(); err != nil || interactive {
+		close(stopped.exited)
+		return
+	}
+
+	go func() {
+		defer close(stopped.exited)
+		_ = svc.Run(name, handler{c})
+	}()
+}
+
+// Stopped reports the service manager that the daemon has stopped, if it is started by the
+// service manager.
+func Stopped() {
+	stopped.Do(func() { close(stopped.stopped) })
+	<-stopped.exited
+}
+
+type handler struct {
+	c chan<- os.Signal
+}
+
+func (h handler) Execute(args []string, requests <-chan svc.ChangeRequest, statuses chan<- svc.Status) (bool, uint32) {
+	statuses <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				statuses <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				statuses <- svc.Status{State: svc.StopPending}
+				h.c <- os.Interrupt
+			}
+
+		case <-stopped.stopped:
+			return false, 0
+		}
+	}
+}
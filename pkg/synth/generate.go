@@ -0,0 +1,87 @@
+package synth
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+// generateBatchSize is the number of the torrents that are added in a single transaction whilst
+// generating, as adding them one by one is much slower (especially on SQLite).
+const generateBatchSize = 1000
+
+// Generate adds n torrents synthesized from the seed (see Synthesizer) to the database, as of
+// persistence.SourceSynthetic, which are discovered (uniformly) between since and until. They are
+// added the least recently discovered first, so that their IDs are in the order of their
+// discoveries as the ones of the crawled torrents are. The progress is reported with the number of
+// the torrents added so far after every batch, if it is not nil.
+//
+// As the same torrents are synthesized from the same seed, generating again with the same seed
+// only rediscovers the torrents that are in the database already.
+func Generate(database persistence.Database, n uint, since time.Time, until time.Time, seed int64,
+	progress func(added uint)) error {
+	if until.Before(since) {
+		return errors.New("until is before since")
+	}
+	synthesizer := NewSynthesizer(seed)
+	times := newSortedUniform(rand.New(rand.NewSource(^seed)), n)
+	span := until.Unix() - since.Unix()
+
+	for added := uint(0); added < n; {
+		batch := n - added
+		if batch > generateBatchSize {
+			batch = generateBatchSize
+		}
+		err := database.WithTx(func(tx persistence.Database) error {
+			for i := uint(0); i < batch; i++ {
+				torrent := synthesizer.Torrent()
+				err := tx.AddNewTorrent(torrent.InfoHash, torrent.Name, torrent.Files, torrent.Metadata,
+					persistence.SourceSynthetic)
+				if err != nil {
+					return errors.Wrap(err, "AddNewTorrent")
+				}
+				discoveredOn := since.Unix() + int64(times.next()*float64(span))
+				if err = tx.SetDiscoveredOn(torrent.InfoHash, discoveredOn); err != nil {
+					return errors.Wrap(err, "SetDiscoveredOn")
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "WithTx")
+		}
+
+		added += batch
+		if progress != nil {
+			progress(added)
+		}
+	}
+	return nil
+}
+
+// sortedUniform draws n values from the uniform distribution over [0, 1) one by one in ascending
+// order, without drawing all of them upfront to sort them.
+type sortedUniform struct {
+	rand *rand.Rand
+	n    uint
+	last float64
+}
+
+func newSortedUniform(r *rand.Rand, n uint) *sortedUniform {
+	return &sortedUniform{rand: r, n: n}
+}
+
+// next returns the next value, which is the minimum of the remaining values (i.e. of n uniform
+// values over [last, 1)), or the last value if all n of them are drawn already.
+func (su *sortedUniform) next() float64 {
+	if su.n == 0 {
+		return su.last
+	}
+	su.last += (1 - su.last) * (1 - math.Pow(su.rand.Float64(), 1/float64(su.n)))
+	su.n--
+	return su.last
+}
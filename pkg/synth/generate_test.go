@@ -0,0 +1,62 @@
+//go:build fts5
+// +build fts5
+
+package synth
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "magnetico-synth")
+	if err != nil {
+		t.Fatalf("Could not create the temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := persistence.MakeDatabase("sqlite3://"+path.Join(dir, "database.sqlite3"), nil)
+	if err != nil {
+		t.Fatalf("Could not open the database: %s", err.Error())
+	}
+	defer db.Close()
+
+	since := time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var progress []uint
+	if err = Generate(db, 1500, since, until, 42, func(added uint) { progress = append(progress, added) }); err != nil {
+		t.Fatalf("Could not generate the torrents: %s", err.Error())
+	}
+	if len(progress) != 2 || progress[0] != 1000 || progress[1] != 1500 {
+		t.Errorf("Progress is wrong! Got %v (expected [1000 1500])", progress)
+	}
+
+	// The torrents are ordered by their IDs, hence by their discoveries too.
+	torrents, err := db.QueryTorrents("", until.Unix()+1, persistence.ByDiscoveredOn, true, 1500, nil, nil,
+		persistence.QueryFilters{}, persistence.AllFields)
+	if err != nil {
+		t.Fatalf("Could not query the torrents: %s", err.Error())
+	}
+	if len(torrents) != 1500 {
+		t.Fatalf("Number of the torrents is wrong! Got %d (expected 1500)", len(torrents))
+	}
+	for i, torrent := range torrents {
+		if torrent.DiscoveredOn.Before(since) || torrent.DiscoveredOn.After(until) {
+			t.Fatalf("Discovery of the torrent #%d is wrong! Got %s (expected between %s and %s)", i+1,
+				torrent.DiscoveredOn, since, until)
+		}
+		if i > 0 && torrent.ID < torrents[i-1].ID {
+			t.Fatalf("Torrent #%d is out of order! Got ID %d after %d", i+1, torrent.ID, torrents[i-1].ID)
+		}
+	}
+	// The discoveries are spread over the years.
+	first, last := torrents[0].DiscoveredOn, torrents[1499].DiscoveredOn
+	if first.Year() != 2018 || last.Year() != 2020 {
+		t.Errorf("Discoveries are not spread! Got from %s until %s", first, last)
+	}
+}
@@ -0,0 +1,241 @@
+// Package synth synthesizes torrents that resemble the ones on the DHT, and fills the databases with
+// them (see Generate), so that the web interface and the performance of the searches can be worked
+// on without crawling the DHT for weeks.
+package synth
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/boramalper/magnetico/pkg/persistence"
+)
+
+var (
+	words = []string{
+		"black", "blue", "city", "dark", "dead", "dream", "fire", "ghost", "gold", "green", "heart", "house",
+		"iron", "king", "last", "light", "lost", "moon", "night", "ocean", "queen", "red", "river", "road",
+		"shadow", "silver", "sky", "star", "storm", "summer", "sun", "time", "war", "water", "white", "wild",
+		"winter", "wolf", "world", "zero",
+	}
+	groups      = []string{"RARBG", "YIFY", "NTb", "FGT", "SPARKS", "EVO", "ION10", "CMRG", "GalaxyRG", "PSA"}
+	resolutions = []string{"480p", "720p", "1080p", "2160p"}
+	sources     = []string{"WEB-DL", "WEBRip", "BluRay", "HDTV", "DVDRip"}
+	codecs      = []string{"x264", "x265", "H.264", "HEVC", "XviD"}
+	softwares   = []string{"ubuntu", "debian", "fedora", "archlinux", "gimp", "blender", "libreoffice", "krita"}
+	archs       = []string{"amd64", "i386", "arm64", "x86_64"}
+	languages   = []string{"English", "French", "German", "Spanish", "Turkish"}
+)
+
+// Torrent is a synthesized torrent.
+type Torrent struct {
+	InfoHash []byte
+	Name     string
+	Files    []persistence.File
+	// Metadata is the info dictionary of the torrent, whose pieces are random, and whose SHA-1 is
+	// the InfoHash.
+	Metadata []byte
+}
+
+// Synthesizer synthesizes torrents that resemble the ones on the DHT: movies, episodes and
+// complete series of TV shows, music albums, e-books, and software releases, along with their
+// files (in directories, as they are released) of plausible sizes. Their names are made up of a
+// small vocabulary, so that the searches for its words (see Query) match a realistic share of
+// them. The torrents and the queries are the same for the same seed.
+//
+// A Synthesizer is not safe for concurrent use.
+type Synthesizer struct {
+	rand *rand.Rand
+}
+
+func NewSynthesizer(seed int64) *Synthesizer {
+	return &Synthesizer{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Torrent synthesizes a torrent.
+func (s *Synthesizer) Torrent() Torrent {
+	var name string
+	var files []persistence.File
+	switch n := s.rand.Intn(20); {
+	case n < 8:
+		name, files = s.movie()
+	case n < 13:
+		name, files = s.season()
+	case n < 14:
+		name, files = s.series()
+	case n < 17:
+		name, files = s.album()
+	case n < 18:
+		name, files = s.ebooks()
+	default:
+		name, files = s.software()
+	}
+
+	info := metainfo.Info{Name: name}
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file.Size
+		info.Files = append(info.Files, metainfo.FileInfo{
+			Length: file.Size,
+			Path:   strings.Split(file.Path, "/"),
+		})
+	}
+	if len(files) == 1 {
+		info.Length, info.Files = files[0].Size, nil
+	}
+	// The pieces are 256 KiB at least, and are doubled until there are at most 2000 of them.
+	info.PieceLength = 256 << 10
+	for totalSize/info.PieceLength > 2000 {
+		info.PieceLength *= 2
+	}
+	info.Pieces = make([]byte, 20*((totalSize+info.PieceLength-1)/info.PieceLength))
+	s.rand.Read(info.Pieces)
+
+	metadata, err := bencode.Marshal(info)
+	if err != nil {
+		panic(err) // The info dictionaries are always marshalled.
+	}
+	hash := sha1.Sum(metadata)
+	return Torrent{InfoHash: hash[:], Name: name, Files: files, Metadata: metadata}
+}
+
+// Query synthesizes a search query of one or two words of the vocabulary, or an empty one (i.e. a
+// browse) once in ten times.
+func (s *Synthesizer) Query() string {
+	switch n := s.rand.Intn(10); {
+	case n < 1:
+		return ""
+	case n < 7:
+		return s.word()
+	default:
+		return s.word() + " " + s.word()
+	}
+}
+
+// The files of the single-file torrents are named after the torrents, whereas the files of the
+// others are in the directories named after the torrents.
+
+func (s *Synthesizer) movie() (string, []persistence.File) {
+	release := fmt.Sprintf("%s.%d.%s.%s.%s-%s", s.title("."), 1950+s.rand.Intn(71), s.pick(resolutions),
+		s.pick(sources), s.pick(codecs), s.pick(groups))
+	video := persistence.File{Size: s.size(700<<20, 0.8), Path: release + ".mkv"}
+	if s.rand.Intn(2) == 0 {
+		return video.Path, []persistence.File{video}
+	}
+
+	video.Path = release + "/" + video.Path
+	files := []persistence.File{video, {Size: s.size(4<<10, 0.3), Path: release + "/" + release + ".nfo"}}
+	for i, n := 0, s.rand.Intn(4); i < n; i++ {
+		files = append(files, persistence.File{
+			Size: s.size(80<<10, 0.3),
+			Path: fmt.Sprintf("%s/Subs/%d_%s.srt", release, i+2, s.pick(languages)),
+		})
+	}
+	return release, files
+}
+
+func (s *Synthesizer) season() (string, []persistence.File) {
+	show, season := s.title("."), 1+s.rand.Intn(12)
+	release := fmt.Sprintf("%s.S%02d.%s.%s.%s-%s", show, season, s.pick(resolutions), s.pick(sources),
+		s.pick(codecs), s.pick(groups))
+	return release, s.episodes(release, show, season, 6+s.rand.Intn(19))
+}
+
+func (s *Synthesizer) series() (string, []persistence.File) {
+	show, seasons := s.title("."), 2+s.rand.Intn(7)
+	release := fmt.Sprintf("%s.Complete.Series.%s.%s-%s", show, s.pick(resolutions), s.pick(sources),
+		s.pick(groups))
+	var files []persistence.File
+	for season := 1; season <= seasons; season++ {
+		directory := fmt.Sprintf("%s/Season %02d", release, season)
+		files = append(files, s.episodes(directory, show, season, 6+s.rand.Intn(19))...)
+	}
+	return release, files
+}
+
+func (s *Synthesizer) episodes(directory string, show string, season int, n int) []persistence.File {
+	files := make([]persistence.File, 0, n)
+	for episode := 1; episode <= n; episode++ {
+		files = append(files, persistence.File{
+			Size: s.size(350<<20, 0.5),
+			Path: fmt.Sprintf("%s/%s.S%02dE%02d.mkv", directory, show, season, episode),
+		})
+	}
+	return files
+}
+
+func (s *Synthesizer) album() (string, []persistence.File) {
+	format, extension, trackSize := "FLAC", ".flac", int64(30<<20)
+	if s.rand.Intn(2) == 0 {
+		format, extension, trackSize = "MP3 320", ".mp3", 9<<20
+	}
+	release := fmt.Sprintf("%s - %s (%d) [%s]", s.title(" "), s.title(" "), 1960+s.rand.Intn(61), format)
+
+	// One in five albums has two discs.
+	discs := []string{release}
+	if s.rand.Intn(5) == 0 {
+		discs = []string{release + "/CD1", release + "/CD2"}
+	}
+	var files []persistence.File
+	for _, disc := range discs {
+		for track, n := 1, 8+s.rand.Intn(9); track <= n; track++ {
+			files = append(files, persistence.File{
+				Size: s.size(trackSize, 0.4),
+				Path: fmt.Sprintf("%s/%02d - %s%s", disc, track, s.title(" "), extension),
+			})
+		}
+	}
+	files = append(files, persistence.File{Size: s.size(500<<10, 0.5), Path: release + "/cover.jpg"})
+	return release, files
+}
+
+func (s *Synthesizer) ebooks() (string, []persistence.File) {
+	release := fmt.Sprintf("%s Collection (%s)", s.title(" "), s.pick(languages))
+	var files []persistence.File
+	for i, n := 0, 5+s.rand.Intn(40); i < n; i++ {
+		author, extension := s.title(" "), ".epub"
+		if s.rand.Intn(3) == 0 {
+			extension = ".pdf"
+		}
+		files = append(files, persistence.File{
+			Size: s.size(2<<20, 0.7),
+			Path: fmt.Sprintf("%s/%s/%s%s", release, author, s.title(" "), extension),
+		})
+	}
+	return release, files
+}
+
+func (s *Synthesizer) software() (string, []persistence.File) {
+	release := fmt.Sprintf("%s-%d.%d-%s", s.pick(softwares), 1+s.rand.Intn(30), s.rand.Intn(10), s.pick(archs))
+	return release + ".iso", []persistence.File{{Size: s.size(2<<30, 0.6), Path: release + ".iso"}}
+}
+
+// title synthesizes a title of one to three capitalised words of the vocabulary, separated by sep.
+func (s *Synthesizer) title(sep string) string {
+	n := 1 + s.rand.Intn(3)
+	title := make([]string, n)
+	for i := range title {
+		word := s.word()
+		title[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(title, sep)
+}
+
+func (s *Synthesizer) word() string {
+	return s.pick(words)
+}
+
+func (s *Synthesizer) pick(choices []string) string {
+	return choices[s.rand.Intn(len(choices))]
+}
+
+// size synthesizes a size that is log-normally distributed around the median, with the standard
+// deviation sigma (of its natural logarithm).
+func (s *Synthesizer) size(median int64, sigma float64) int64 {
+	return 1 + int64(float64(median)*math.Exp(sigma*s.rand.NormFloat64()))
+}
@@ -0,0 +1,41 @@
+package synth
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSynthesizer(t *testing.T) {
+	a, b := NewSynthesizer(42), NewSynthesizer(42)
+	for i := 0; i < 100; i++ {
+		torrentA, torrentB := a.Torrent(), b.Torrent()
+		if string(torrentA.InfoHash) != string(torrentB.InfoHash) || torrentA.Name != torrentB.Name {
+			t.Fatalf("Torrents of the same seed differ! Got %s and %s", torrentA.Name, torrentB.Name)
+		}
+		if len(torrentA.InfoHash) != 20 || torrentA.Name == "" || len(torrentA.Files) == 0 {
+			t.Errorf("Torrent #%d is not valid! Got %x %q %v", i+1, torrentA.InfoHash, torrentA.Name,
+				torrentA.Files)
+		}
+		for _, file := range torrentA.Files {
+			if file.Size <= 0 || file.Path == "" {
+				t.Errorf("File of the torrent #%d is not valid! Got %+v", i+1, file)
+			}
+		}
+	}
+}
+
+func TestSortedUniform(t *testing.T) {
+	su := newSortedUniform(rand.New(rand.NewSource(42)), 1000)
+	var last float64
+	for i := 0; i < 1000; i++ {
+		value := su.next()
+		if value < last || value > 1 {
+			t.Fatalf("Value #%d is wrong! Got %f (expected in [%f, 1])", i+1, value, last)
+		}
+		last = value
+	}
+	// The maximum of 1000 uniform values is above 0.99 unless once in 20000 or so.
+	if last < 0.99 {
+		t.Errorf("Maximum is wrong! Got %f (expected above 0.99)", last)
+	}
+}
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// DebugHandler serves the runtime diagnostics under /debug/ so that the memory leaks (and the
+// like) of the long-running daemons can be diagnosed without rebuilding them:
+//
+//	/debug/pprof/    the profiles of net/http/pprof
+//	/debug/vars      the variables of expvar (including the memory statistics)
+//	/debug/runtime   the summary of the goroutines, the heap, and the garbage collector
+//	/debug/metrics   the metrics of the packages (see RegisterMetrics) for Prometheus
+//
+// It must not be exposed to the public, as the profiles reveal a lot about the process.
+func DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/runtime", runtimeHandler)
+	mux.HandleFunc("/debug/metrics", metricsHandler)
+	return mux
+}
+
+type runtimeStats struct {
+	Goroutines int `json:"goroutines"`
+
+	HeapAlloc   uint64 `json:"heapAlloc"`
+	HeapInuse   uint64 `json:"heapInuse"`
+	HeapObjects uint64 `json:"heapObjects"`
+	// Sys is the total memory obtained from the operating system.
+	Sys uint64 `json:"sys"`
+
+	NumGC uint32 `json:"numGC"`
+	// LastGC is in Unix time; PauseTotal is in nanoseconds.
+	LastGC     int64         `json:"lastGC"`
+	PauseTotal time.Duration `json:"pauseTotal"`
+}
+
+func runtimeHandler(w http.ResponseWriter, r *http.Request) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(runtimeStats{
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   memStats.HeapAlloc,
+		HeapInuse:   memStats.HeapInuse,
+		HeapObjects: memStats.HeapObjects,
+		Sys:         memStats.Sys,
+		NumGC:       memStats.NumGC,
+		LastGC:      time.Unix(0, int64(memStats.LastGC)).Unix(),
+		PauseTotal:  time.Duration(memStats.PauseTotalNs),
+	})
+}
@@ -0,0 +1,17 @@
+package util
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	handler := DebugHandler()
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/vars", "/debug/runtime", "/debug/metrics"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 {
+			t.Errorf("Status code of %s is wrong! Got %d (expected 200)", path, w.Code)
+		}
+	}
+}
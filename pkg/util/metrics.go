@@ -0,0 +1,40 @@
+package util
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// MetricsWriter writes metrics in the text format of Prometheus.
+type MetricsWriter func(w io.Writer) error
+
+var metricsWriters struct {
+	sync.Mutex
+	writers []MetricsWriter
+}
+
+// RegisterMetrics registers the writer of the metrics of a package, which DebugHandler serves (along
+// with the ones of the other packages) at /debug/metrics.
+func RegisterMetrics(writer MetricsWriter) {
+	metricsWriters.Lock()
+	defer metricsWriters.Unlock()
+	metricsWriters.writers = append(metricsWriters.writers, writer)
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	metricsWriters.Lock()
+	writers := append([]MetricsWriter(nil), metricsWriters.writers...)
+	metricsWriters.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	for _, writer := range writers {
+		if err := writer(w); err != nil {
+			zap.L().Named("debug").Warn("Could not write the metrics", zap.Error(err))
+			return
+		}
+	}
+}
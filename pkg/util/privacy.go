@@ -0,0 +1,75 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces the IP addresses that are scrubbed by ScrubIPs.
+const Redacted = "[redacted]"
+
+// ipCandidates matches the IPv4 addresses, and the strings that might be IPv6 addresses (which are
+// then validated, lest e.g. the times are scrubbed).
+var ipCandidates = regexp.MustCompile(
+	`\b(?:\d{1,3}\.){3}\d{1,3}\b|[0-9A-Fa-f]{0,4}(?::(?:(?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f]{0,4})){2,7}`)
+
+// ScrubIPs replaces the IP addresses (IPv4 and IPv6) in the string with Redacted, leaving their ports
+// (if any) as is.
+func ScrubIPs(s string) string {
+	return ipCandidates.ReplaceAllStringFunc(s, func(candidate string) string {
+		if net.ParseIP(candidate) == nil {
+			return candidate
+		}
+		return Redacted
+	})
+}
+
+// scrubbingCore scrubs the IP addresses (see ScrubIPs) off the messages and the fields of the
+// entries before they are written by the underlying core, so that no IP address is ever logged.
+type scrubbingCore struct {
+	zapcore.Core
+}
+
+// NewScrubbingCore wraps the core so that the IP addresses are scrubbed off its entries.
+func NewScrubbingCore(core zapcore.Core) zapcore.Core {
+	return &scrubbingCore{Core: core}
+}
+
+func (c *scrubbingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &scrubbingCore{Core: c.Core.With(scrubFields(fields))}
+}
+
+func (c *scrubbingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *scrubbingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = ScrubIPs(entry.Message)
+	return c.Core.Write(entry, scrubFields(fields))
+}
+
+// scrubFields returns the fields with the IP addresses scrubbed off the ones that might contain text
+// (e.g. the errors), which are turned into strings.
+func scrubFields(fields []zapcore.Field) []zapcore.Field {
+	scrubbed := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		switch field.Type {
+		case zapcore.StringType:
+			field.String = ScrubIPs(field.String)
+		case zapcore.ByteStringType, zapcore.BinaryType, zapcore.ErrorType, zapcore.StringerType,
+			zapcore.ReflectType, zapcore.ArrayMarshalerType, zapcore.ObjectMarshalerType:
+			// The fields of arbitrary types are rendered as they would be encoded, then scrubbed.
+			enc := zapcore.NewMapObjectEncoder()
+			field.AddTo(enc)
+			field = zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: ScrubIPs(fmt.Sprint(enc.Fields[field.Key]))}
+		}
+		scrubbed[i] = field
+	}
+	return scrubbed
+}
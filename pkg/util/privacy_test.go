@@ -0,0 +1,65 @@
+package util
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var scrubIPs_instances = []struct {
+	s        string
+	expected string
+}{
+	{"dial tcp 203.0.113.57:6881: i/o timeout", "dial tcp [redacted]:6881: i/o timeout"},
+	{"dial tcp [2001:db8::1]:6881: connection refused", "dial tcp [[redacted]]:6881: connection refused"},
+	{"peer ::ffff:203.0.113.57 and fe80::1", "peer [redacted] and [redacted]"},
+	{"fetched at 2020-02-29T12:34:56.789Z", "fetched at 2020-02-29T12:34:56.789Z"},
+	{"magneticod v0.12.0 has been started.", "magneticod v0.12.0 has been started."},
+	{"infohash 0123456789abcdef0123456789abcdef01234567", "infohash 0123456789abcdef0123456789abcdef01234567"},
+}
+
+func TestScrubIPs(t *testing.T) {
+	for i, instance := range scrubIPs_instances {
+		if scrubbed := ScrubIPs(instance.s); scrubbed != instance.expected {
+			t.Errorf("Scrubbed string of the instance #%d is wrong! Got `%s` (expected `%s`)",
+				i+1, scrubbed, instance.expected)
+		}
+	}
+}
+
+func TestScrubbingCore(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(NewScrubbingCore(core)).With(zap.String("node", "198.51.100.1:6881"))
+
+	logger.Debug("leech error from 203.0.113.57",
+		zap.Error(errors.New("dial tcp 203.0.113.57:6881: i/o timeout")),
+		zap.Stringer("addr", &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 6881}),
+		zap.Strings("peers", []string{"203.0.113.58:1", "203.0.113.59:2"}),
+		zap.Int("port", 6881),
+	)
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("Number of the entries is wrong! Got %d (expected 1)", len(entries))
+	}
+	if entries[0].Message != "leech error from [redacted]" {
+		t.Errorf("Message is wrong! Got `%s`", entries[0].Message)
+	}
+	expected := map[string]interface{}{
+		"node":  "[redacted]:6881",
+		"error": "dial tcp [redacted]:6881: i/o timeout",
+		"addr":  "[[redacted]]:6881",
+		"peers": "[[redacted]:1 [redacted]:2]",
+		"port":  int64(6881),
+	}
+	fields := entries[0].ContextMap()
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("Field `%s` is wrong! Got %v (expected %v)", key, fields[key], value)
+		}
+	}
+}
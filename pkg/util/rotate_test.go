@@ -0,0 +1,49 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "magnetico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := path.Join(dir, "access.log")
+	f, err := OpenRotatingFile(logPath, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err = f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, instance := range []struct {
+		path     string
+		expected string
+	}{
+		{logPath, "fourth\n"},
+		{logPath + ".1", "third\n"},
+		{logPath + ".2", "second\n"},
+	} {
+		data, err := ioutil.ReadFile(instance.path)
+		if err != nil {
+			t.Errorf("Could not read %s: %s", instance.path, err.Error())
+		} else if string(data) != instance.expected {
+			t.Errorf("Content of %s is wrong! Got `%s` (expected `%s`)", instance.path, data, instance.expected)
+		}
+	}
+	if _, err = os.Stat(logPath + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Only two backups should have been kept")
+	}
+}